@@ -0,0 +1,119 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AlertPolicy tunes the deduplication of modem alerts (ALERT_COOLDOWNS,
+// ALERT_EVERY_OCCURRENCE, ALERT_FLAP_INTERVAL). The zero value is the
+// default behavior: one alert per condition, one recovery, no hold-backs.
+type AlertPolicy struct {
+	// Cooldowns: a condition (by alertGroup) alerts a chat again only this
+	// long after its previous alert for it, also across a recovery.
+	Cooldowns map[DiagnosticErrorType]time.Duration
+	// EveryOccurrence types alert on every occurrence instead of once per
+	// condition; a cooldown still limits them.
+	EveryOccurrence map[DiagnosticErrorType]bool
+	// FlapInterval is the minimum time between a recovery message and the
+	// next alert to the same chat.
+	FlapInterval time.Duration
+}
+
+// alertPolicyTypes are the diagnostic types the policy can name; storage
+// and rejected-delivery warnings have their own once-only alerts.
+var alertPolicyTypes = []DiagnosticErrorType{
+	ErrTypeSerialPort, ErrTypeModemNotResponding, ErrTypeSimNotDetected,
+	ErrTypeSimPinRequired, ErrTypeSimPukLocked, ErrTypeNetworkDenied,
+	ErrTypeNetworkNotRegistered, ErrTypeNoSignal, ErrTypeModemInitFailed,
+}
+
+// errorTypeKey is the configuration name of an error type: "No Signal"
+// becomes "no_signal".
+func errorTypeKey(t DiagnosticErrorType) string {
+	return strings.ReplaceAll(strings.ToLower(errorTypeName(t)), " ", "_")
+}
+
+func parseErrorTypeKey(key string) (DiagnosticErrorType, error) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	for _, t := range alertPolicyTypes {
+		if errorTypeKey(t) == key {
+			return t, nil
+		}
+	}
+	names := make([]string, len(alertPolicyTypes))
+	for i, t := range alertPolicyTypes {
+		names[i] = errorTypeKey(t)
+	}
+	return ErrTypeNone, fmt.Errorf("unknown alert type %q (one of %s)", key, strings.Join(names, ", "))
+}
+
+// parseAlertCooldowns parses "no_signal=30m,modem_not_responding=2h". Types
+// of one group (no_signal, network_not_registered) share a cooldown.
+func parseAlertCooldowns(s string) (map[DiagnosticErrorType]time.Duration, error) {
+	cooldowns := map[DiagnosticErrorType]time.Duration{}
+	for _, entry := range strings.Split(s, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("entry %q: want type=duration", strings.TrimSpace(entry))
+		}
+		t, err := parseErrorTypeKey(key)
+		if err != nil {
+			return nil, err
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("entry %q: invalid duration", strings.TrimSpace(entry))
+		}
+		cooldowns[alertGroup(t)] = d
+	}
+	return cooldowns, nil
+}
+
+// parseAlertTypes parses a comma-separated list of alert type keys.
+func parseAlertTypes(s string) (map[DiagnosticErrorType]bool, error) {
+	types := map[DiagnosticErrorType]bool{}
+	for _, key := range strings.Split(s, ",") {
+		if strings.TrimSpace(key) == "" {
+			continue
+		}
+		t, err := parseErrorTypeKey(key)
+		if err != nil {
+			return nil, err
+		}
+		types[t] = true
+	}
+	return types, nil
+}
+
+// alertKey identifies a condition per chat for the cooldowns.
+type alertKey struct {
+	chatID int64
+	group  DiagnosticErrorType
+}
+
+// holdAlert reports why a new alert of type t to chatID is held back by the
+// policy, or "" to send it. A held alert leaves the chat state alone, so the
+// next NotifyError call for a persisting condition tries again. Called with
+// n.mu held.
+func (n *ErrorNotifier) holdAlert(chatID int64, t DiagnosticErrorType, now time.Time) string {
+	if flap := n.policy.FlapInterval; flap > 0 {
+		if recovered, ok := n.recoveredAt[chatID]; ok && now.Sub(recovered) < flap {
+			return "flapping"
+		}
+	}
+	group := alertGroup(t)
+	if cooldown := n.policy.Cooldowns[group]; cooldown > 0 {
+		if last, ok := n.groupAlerted[alertKey{chatID, group}]; ok && now.Sub(last) < cooldown {
+			return "cooldown"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseAlertCooldowns(t *testing.T) {
+	got, err := parseAlertCooldowns(" no_signal=30m, Modem_Not_Responding=2h,")
+	if err != nil {
+		t.Fatalf("parseAlertCooldowns() error = %v", err)
+	}
+	if len(got) != 2 || got[ErrTypeNoSignal] != 30*time.Minute || got[ErrTypeModemNotResponding] != 2*time.Hour {
+		t.Errorf("cooldowns = %v", got)
+	}
+	// network_not_registered shares the radio group's cooldown.
+	if got, _ := parseAlertCooldowns("network_not_registered=1h"); got[ErrTypeNoSignal] != time.Hour {
+		t.Errorf("network_not_registered cooldown = %v, want keyed by its group", got)
+	}
+
+	for _, bad := range []string{"no_signal", "no_signal=soon", "no_signal=0s", "sim_storage_low=1h", "bogus=1h"} {
+		if _, err := parseAlertCooldowns(bad); err == nil {
+			t.Errorf("parseAlertCooldowns(%q) should fail", bad)
+		}
+	}
+	if _, err := parseAlertTypes("modem_init_failed,nope"); err == nil {
+		t.Error("parseAlertTypes with an unknown type should fail")
+	}
+}
+
+// TestErrorNotifier_AlertPolicy: cooldowns survive a recovery, every-occurrence
+// types re-alert while the condition persists, and an alert right after a
+// recovery waits out the flap interval.
+func TestErrorNotifier_AlertPolicy(t *testing.T) {
+	ctx := context.Background()
+	setup := func(policy AlertPolicy) (*ErrorNotifier, *fakeSender, *fakeClock) {
+		clock := newFakeClock()
+		t.Cleanup(swapClock(clock))
+		sender := &fakeSender{}
+		notifier := NewErrorNotifier(sender, []int64{1}, false, "gw1", time.Second)
+		notifier.policy = policy
+		return notifier, sender, clock
+	}
+	noSignal := NewDiagnosticError(ErrTypeNoSignal, "CSQ=99")
+
+	t.Run("cooldown", func(t *testing.T) {
+		n, sender, clock := setup(AlertPolicy{Cooldowns: map[DiagnosticErrorType]time.Duration{ErrTypeNoSignal: time.Hour}})
+		n.NotifyError(ctx, noSignal)
+		n.NotifyRecovery(ctx)
+		clock.Advance(10 * time.Minute)
+		if n.NotifyError(ctx, noSignal) {
+			t.Error("alert within the cooldown was sent")
+		}
+		// Held back: no recovery owed either.
+		if n.NotifyRecovery(ctx) {
+			t.Error("recovery sent for a held-back alert")
+		}
+		// Other conditions are not affected.
+		if !n.NotifyError(ctx, NewDiagnosticError(ErrTypeSimNotDetected, "x")) {
+			t.Error("different condition held back")
+		}
+		n.NotifyRecovery(ctx)
+		clock.Advance(time.Hour)
+		if !n.NotifyError(ctx, NewDiagnosticError(ErrTypeNetworkNotRegistered, "CREG=2")) {
+			t.Error("alert after the cooldown was not sent")
+		}
+		if got := len(sender.sentTo(1)); got != 5 {
+			t.Errorf("messages = %d, want 5", got)
+		}
+	})
+
+	t.Run("every occurrence", func(t *testing.T) {
+		n, sender, clock := setup(AlertPolicy{
+			EveryOccurrence: map[DiagnosticErrorType]bool{ErrTypeModemInitFailed: true},
+			Cooldowns:       map[DiagnosticErrorType]time.Duration{ErrTypeModemInitFailed: 5 * time.Minute},
+		})
+		initFailed := NewDiagnosticError(ErrTypeModemInitFailed, "CNMI")
+		for range 3 {
+			n.NotifyError(ctx, initFailed)
+			clock.Advance(2 * time.Minute)
+		}
+		// t=0 sent, t=2m held by the cooldown, t=4m held, t=6m sent.
+		n.NotifyError(ctx, initFailed)
+		if got := len(sender.sentTo(1)); got != 2 {
+			t.Errorf("messages = %d, want 2", got)
+		}
+		// Without the flag the same type is deduplicated as usual.
+		n.NotifyError(ctx, noSignal)
+		clock.Advance(time.Hour)
+		n.NotifyError(ctx, noSignal)
+		if got := len(sender.sentTo(1)); got != 3 {
+			t.Errorf("messages = %d, want 3", got)
+		}
+	})
+
+	t.Run("flap interval", func(t *testing.T) {
+		n, sender, clock := setup(AlertPolicy{FlapInterval: 5 * time.Minute})
+		n.NotifyError(ctx, noSignal)
+		n.NotifyRecovery(ctx)
+		clock.Advance(time.Minute)
+		if n.NotifyError(ctx, noSignal) {
+			t.Error("alert right after a recovery was sent")
+		}
+		clock.Advance(4 * time.Minute)
+		if !n.NotifyError(ctx, noSignal) {
+			t.Error("persisting condition not alerted after the flap interval")
+		}
+		if got := len(sender.sentTo(1)); got != 3 {
+			t.Errorf("messages = %d, want 3", got)
+		}
+	})
+}
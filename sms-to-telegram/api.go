@@ -0,0 +1,266 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTP API (HTTP_LISTEN): liveness/readiness probes, Prometheus metrics
+// and, with ARCHIVE, read-only access to received SMS for dashboards and
+// scripts that do not go through Telegram; with INJECT_API, synthetic test
+// SMS; with DASHBOARD, the web dashboard (dashboard.go).
+
+const (
+	apiDefaultLimit = 100
+	apiMaxLimit     = 1000
+	// apiMaxInjectBody bounds a POST /api/v1/inject body.
+	apiMaxInjectBody = 64 << 10
+)
+
+// apiMessagesResponse is the body of GET /api/v1/messages.
+type apiMessagesResponse struct {
+	Messages []ArchiveRecord `json:"messages"`
+	// Truncated is set when more records matched than limit; continue with
+	// since = the last record's time.
+	Truncated bool `json:"truncated"`
+}
+
+// APIServer serves the HTTP API. The archive holds message content (2FA
+// codes), so once credentials are configured (auth.go) everything except
+// the probes, which orchestrators call anonymously, requires them.
+type APIServer struct {
+	archive *MessageArchive // nil: no /api/v1/messages
+	health  *HealthState
+	// metrics adds the modem gauges to /metrics; nil serves build_info only.
+	metrics *Metrics
+	auth    *APIAuth
+	mux     *http.ServeMux
+	// injector takes POST /api/v1/inject (INJECT_API); nil: not served.
+	injector *Injector
+	// dashboard backs the DASHBOARD endpoints; nil: not served.
+	dashboard *DashboardOptions
+	// tls serves HTTPS (HTTP_TLS_*); nil: plain HTTP.
+	tls *tls.Config
+}
+
+func NewAPIServer(archive *MessageArchive, health *HealthState, auth *APIAuth) *APIServer {
+	s := &APIServer{archive: archive, health: health, auth: auth, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
+	s.mux.HandleFunc("GET /metrics", s.handleMetrics)
+	if archive != nil {
+		s.mux.HandleFunc("GET /api/v1/messages", s.handleMessages)
+	}
+	return s
+}
+
+// EnableInject serves POST /api/v1/inject, feeding inj. Call before Serve.
+func (s *APIServer) EnableInject(inj *Injector) {
+	s.injector = inj
+	s.mux.HandleFunc("POST /api/v1/inject", s.handleInject)
+}
+
+// Serve serves on ln until ctx ends.
+func (s *APIServer) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+		TLSConfig:         s.tls,
+	}
+	slog.Info("HTTP API listening", "addr", ln.Addr().String(), "tls", s.tls != nil, "auth", s.auth.Enabled(), "archive", s.archive != nil)
+	return serveUntilDone(ctx, srv, ln)
+}
+
+// serveUntilDone runs srv on ln, over TLS when srv.TLSConfig is set, and
+// closes it when ctx ends.
+func serveUntilDone(ctx context.Context, srv *http.Server, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	serve := srv.Serve
+	if srv.TLSConfig != nil {
+		serve = func(ln net.Listener) error { return srv.ServeTLS(ln, "", "") }
+	}
+	if err := serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *APIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.auth.authorize(w, r, apiRequiredScope(r, s.dashboard != nil)) {
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Debug("Writing API response failed", "error", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeAPIJSON(w, status, map[string]string{"error": msg})
+}
+
+// handleHealthz is the liveness probe: the process serves HTTP and the
+// modem goroutine is not stuck. A modem that is down but being retried is
+// still live — restarting the process would not help it.
+func (s *APIServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if live, reason := s.health.Live(); !live {
+		writeAPIJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "stalled", "reason": reason})
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz is the readiness probe: modem session healthy and Telegram
+// reachable.
+func (s *APIServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ready, checks := s.health.Ready(r.Context())
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not ready", http.StatusServiceUnavailable
+	}
+	writeAPIJSON(w, code, map[string]any{"status": status, "checks": checks})
+}
+
+// handleMetrics serves the Prometheus metrics.
+func (s *APIServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metricsContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	m := newMetricsWriter(w)
+	writeBuildInfoMetric(s.metrics.labeled(m), currentBuildInfo())
+	s.metrics.write(m)
+	if err := m.flush(); err != nil {
+		slog.Debug("Writing metrics failed", "error", err)
+	}
+}
+
+// parseAPITime accepts RFC 3339 timestamps and YYYY-MM-DD dates (local
+// midnight, like /export).
+func parseAPITime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, clk.Now().Location()); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use RFC 3339 or YYYY-MM-DD)", s)
+}
+
+// handleMessages serves GET /api/v1/messages?since=&until=&from=&q=&limit=:
+// archived SMS with since <= time < until, oldest first, optionally only
+// those from one sender (compared like BLOCKED_SENDERS entries) and those
+// whose sender or text contains q, ignoring case.
+func (s *APIServer) handleMessages(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	since := time.Time{}
+	until := time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	var err error
+	if v := q.Get("since"); v != "" {
+		if since, err = parseAPITime(v); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "since: "+err.Error())
+			return
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if until, err = parseAPITime(v); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "until: "+err.Error())
+			return
+		}
+	}
+	limit := apiDefaultLimit
+	if v := q.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > apiMaxLimit {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("limit must be 1-%d", apiMaxLimit))
+			return
+		}
+	}
+
+	records, err := s.archive.Query(since, until)
+	if err != nil {
+		slog.Error("Archive query failed", "error", err)
+		writeAPIError(w, http.StatusInternalServerError, "archive query failed")
+		return
+	}
+	resp := apiMessagesResponse{Messages: []ArchiveRecord{}}
+	filter := archiveFilter{sender: q.Get("from"), search: q.Get("q")}
+	for _, rec := range records {
+		if !filter.match(rec) {
+			continue
+		}
+		if len(resp.Messages) == limit {
+			resp.Truncated = true
+			break
+		}
+		resp.Messages = append(resp.Messages, rec)
+	}
+	slog.Debug("API messages query", "remote", r.RemoteAddr, "records", len(resp.Messages), "truncated", resp.Truncated)
+	writeAPIJSON(w, http.StatusOK, resp)
+}
+
+// apiInjectRequest is the body of POST /api/v1/inject: either hex PDUs as the
+// modem lists them, or a text from a phone number.
+type apiInjectRequest struct {
+	PDUs []string `json:"pdus"`
+	From string   `json:"from"`
+	Text string   `json:"text"`
+}
+
+// handleInject queues synthetic SMS for the next poll and answers with their
+// virtual SIM slots.
+func (s *APIServer) handleInject(w http.ResponseWriter, r *http.Request) {
+	var req apiInjectRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxInjectBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	var slots []int
+	var err error
+	switch {
+	case len(req.PDUs) > 0 && (req.From != "" || req.Text != ""):
+		writeAPIError(w, http.StatusBadRequest, "set either pdus or from and text")
+		return
+	case len(req.PDUs) > 0:
+		slots, err = s.injector.InjectPDUs(req.PDUs)
+	case req.From != "" && req.Text != "":
+		slots, err = s.injector.InjectText(req.From, req.Text)
+	default:
+		writeAPIError(w, http.StatusBadRequest, "set either pdus or from and text")
+		return
+	}
+	if errors.Is(err, errInjectFull) {
+		writeAPIError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if errors.Is(err, errInjectTextMode) {
+		writeAPIError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeAPIJSON(w, http.StatusAccepted, map[string][]int{"slots": slots})
+}
@@ -0,0 +1,122 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestAPI(t *testing.T, token string) *APIServer {
+	t.Helper()
+	t.Cleanup(swapClock(newFakeClock()))
+	archive := NewMessageArchive(filepath.Join(t.TempDir(), archiveFileName))
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	for _, p := range []PendingSMS{
+		archivedSMS("+49 170 100", "one", day.Add(time.Hour), 1),
+		archivedSMS("Bank", "two", day.Add(2*time.Hour), 2),
+		archivedSMS("+49170100", "three", day.Add(26*time.Hour), 3),
+	} {
+		if err := archive.Record(p, archiveForwarded, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewAPIServer(archive, NewHealthState(nil), NewAPIAuth(token, nil, nil))
+}
+
+func getMessages(t *testing.T, api *APIServer, target, token string) (int, apiMessagesResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	var body apiMessagesResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decoding %s: %v", rec.Body, err)
+		}
+	}
+	return rec.Code, body
+}
+
+func TestAPIServer_Messages(t *testing.T) {
+	api := newTestAPI(t, "")
+	tests := []struct {
+		target        string
+		wantTexts     []string
+		wantTruncated bool
+	}{
+		{"/api/v1/messages", []string{"one", "two", "three"}, false},
+		{"/api/v1/messages?since=2026-03-10T01:30:00Z", []string{"two", "three"}, false},
+		{"/api/v1/messages?since=2026-03-10&until=2026-03-11", []string{"one", "two"}, false},
+		{"/api/v1/messages?from=%2B49170100", []string{"one", "three"}, false},
+		{"/api/v1/messages?from=bank", []string{"two"}, false},
+		{"/api/v1/messages?q=TW", []string{"two"}, false},
+		{"/api/v1/messages?q=bank", []string{"two"}, false},
+		{"/api/v1/messages?q=e&from=%2B49170100", []string{"one", "three"}, false},
+		{"/api/v1/messages?limit=2", []string{"one", "two"}, true},
+		{"/api/v1/messages?since=2027-01-01", []string{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			code, body := getMessages(t, api, tt.target, "")
+			if code != http.StatusOK {
+				t.Fatalf("status = %d", code)
+			}
+			var texts []string
+			for _, m := range body.Messages {
+				texts = append(texts, m.Text)
+			}
+			if len(texts) != len(tt.wantTexts) || body.Truncated != tt.wantTruncated {
+				t.Fatalf("messages = %v (truncated %v), want %v (%v)", texts, body.Truncated, tt.wantTexts, tt.wantTruncated)
+			}
+			for i := range texts {
+				if texts[i] != tt.wantTexts[i] {
+					t.Errorf("messages = %v, want %v", texts, tt.wantTexts)
+				}
+			}
+		})
+	}
+
+	for _, target := range []string{
+		"/api/v1/messages?since=yesterday",
+		"/api/v1/messages?until=2026-13-01",
+		"/api/v1/messages?limit=0",
+		"/api/v1/messages?limit=5000",
+	} {
+		if code, _ := getMessages(t, api, target, ""); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", target, code)
+		}
+	}
+	if code, _ := getMessages(t, api, "/api/v1/nope", ""); code != http.StatusNotFound {
+		t.Errorf("unknown path: status = %d, want 404", code)
+	}
+}
+
+func TestAPIServer_Auth(t *testing.T) {
+	api := newTestAPI(t, "s3cret")
+	for token, want := range map[string]int{
+		"":       http.StatusUnauthorized,
+		"wrong":  http.StatusUnauthorized,
+		"s3cret": http.StatusOK,
+	} {
+		if code, _ := getMessages(t, api, "/api/v1/messages", token); code != want {
+			t.Errorf("token %q: status = %d, want %d", token, code, want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/messages", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status = %d, want 405 (read-only API)", rec.Code)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archiveFileName is the message archive inside STATE_DIR.
+const archiveFileName = "archive.ndjson"
+
+// Archive outcomes: what happened to the SMS before its SIM slots were freed.
+const (
+	archiveForwarded = "forwarded"
+	archiveBlocked   = "blocked"
+)
+
+// ArchiveRecord is one archived SMS (one JSON line).
+type ArchiveRecord struct {
+	ArchivedAt time.Time  `json:"archived_at"`
+	SMSTime    *time.Time `json:"sms_time,omitempty"` // nil when SCTS was invalid
+	From       string     `json:"from"`
+	Text       string     `json:"text"`
+	SMSC       string     `json:"smsc,omitempty"`
+	Parts      int        `json:"parts"`
+	SIMIndices []int      `json:"sim_indices"`
+	Outcome    string     `json:"outcome"`
+	// RawReason is set for undecodable PDUs archived as raw hex.
+	RawReason string `json:"raw_reason,omitempty"`
+	// Telegram are the messages a forwarded SMS became, in chat and chunk
+	// order; empty when Telegram was not reached (blocked, DRY_RUN).
+	Telegram []TelegramMessageRef `json:"telegram,omitempty"`
+}
+
+// Time is the SMS timestamp, or the archive time when the SCTS was invalid.
+func (r ArchiveRecord) Time() time.Time {
+	if r.SMSTime != nil {
+		return *r.SMSTime
+	}
+	return r.ArchivedAt
+}
+
+// MessageArchive is an append-only NDJSON log of every SMS the gateway
+// finished with. The archive holds message content (2FA codes) and is
+// written 0600. Writes come from the modem goroutine, reads from bot
+// commands; the mutex serializes them.
+type MessageArchive struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewMessageArchive returns an archive appending to path.
+func NewMessageArchive(path string) *MessageArchive {
+	return &MessageArchive{path: path}
+}
+
+// Record appends one SMS outcome and the Telegram messages it became.
+// Nil-safe (archive disabled).
+func (a *MessageArchive) Record(pending PendingSMS, outcome string, telegram []TelegramMessageRef) error {
+	if a == nil {
+		return nil
+	}
+	msg := pending.Message
+	rec := ArchiveRecord{
+		ArchivedAt: clk.Now(),
+		From:       msg.From,
+		Text:       msg.Text,
+		SMSC:       msg.SMSC,
+		Parts:      len(pending.PartIndices),
+		SIMIndices: pending.PartIndices,
+		Outcome:    outcome,
+		Telegram:   telegram,
+	}
+	if !msg.Time.IsZero() {
+		t := msg.Time
+		rec.SMSTime = &t
+	}
+	if pending.RawFallback {
+		rec.RawReason = pending.RawReason
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("writing archive: %w", err)
+	}
+	return f.Close()
+}
+
+// Query returns the records whose Time() falls in [from, to). Lines that do
+// not parse (e.g. a torn final line after a crash) are skipped.
+func (a *MessageArchive) Query(from, to time.Time) ([]ArchiveRecord, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, err := os.Open(a.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening archive: %w", err)
+	}
+	defer f.Close()
+
+	var out []ArchiveRecord
+	scanner := bufio.NewScanner(f)
+	// A concatenated SMS may carry tens of KB of text.
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var rec ArchiveRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		if t := rec.Time(); !t.Before(from) && t.Before(to) {
+			out = append(out, rec)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading archive: %w", err)
+	}
+	return out, nil
+}
+
+// archiveFilter selects archived SMS: from one sender (compared like
+// BLOCKED_SENDERS entries), with search in the sender or text (ignoring
+// case), with one outcome. Empty fields match everything.
+type archiveFilter struct {
+	sender, search, outcome string
+}
+
+func (f archiveFilter) match(rec ArchiveRecord) bool {
+	if f.sender != "" && normalizeSender(rec.From) != normalizeSender(f.sender) {
+		return false
+	}
+	if search := strings.ToLower(f.search); search != "" &&
+		!strings.Contains(strings.ToLower(rec.From), search) && !strings.Contains(strings.ToLower(rec.Text), search) {
+		return false
+	}
+	return f.outcome == "" || rec.Outcome == f.outcome
+}
+
+// Compact rewrites the archive without the records archived before cutoff
+// (ARCHIVE_RETENTION) and lines that do not parse, and returns how many it
+// removed. Nil-safe.
+func (a *MessageArchive) Compact(cutoff time.Time) (int, error) {
+	if a == nil {
+		return 0, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	data, err := os.ReadFile(a.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading archive: %w", err)
+	}
+	var kept bytes.Buffer
+	removed := 0
+	for line := range bytes.Lines(data) {
+		var rec ArchiveRecord
+		if json.Unmarshal(line, &rec) != nil || rec.ArchivedAt.Before(cutoff) {
+			removed++
+			continue
+		}
+		kept.Write(line)
+		if !bytes.HasSuffix(line, []byte("\n")) {
+			kept.WriteByte('\n')
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	if err := writeFileAtomic(a.path, kept.Bytes(), 0o600); err != nil {
+		return 0, fmt.Errorf("compacting archive: %w", err)
+	}
+	return removed, nil
+}
+
+// exportCSV renders records as CSV with a header row.
+func exportCSV(records []ArchiveRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"sms_time", "archived_at", "from", "outcome", "parts", "smsc", "text"})
+	for _, r := range records {
+		smsTime := ""
+		if r.SMSTime != nil {
+			smsTime = r.SMSTime.Format(time.RFC3339)
+		}
+		w.Write([]string{
+			smsTime,
+			r.ArchivedAt.Format(time.RFC3339),
+			r.From,
+			r.Outcome,
+			strconv.Itoa(r.Parts),
+			r.SMSC,
+			r.Text,
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// exportJSON renders records as an indented JSON array.
+func exportJSON(records []ArchiveRecord) ([]byte, error) {
+	if records == nil {
+		records = []ArchiveRecord{}
+	}
+	return json.MarshalIndent(records, "", "  ")
+}
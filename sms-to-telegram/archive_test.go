@@ -0,0 +1,205 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func archivedSMS(from, text string, at time.Time, indices ...int) PendingSMS {
+	return PendingSMS{
+		Message:     SMSMessage{Index: indices[0], From: from, Text: text, Time: at},
+		PartIndices: indices,
+	}
+}
+
+func TestMessageArchive_RecordQuery(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	path := filepath.Join(t.TempDir(), archiveFileName)
+	archive := NewMessageArchive(path)
+
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	for i, p := range []PendingSMS{
+		archivedSMS("+100", "before", day.Add(-time.Minute), 1),
+		archivedSMS("+200", "first", day, 2, 3),
+		archivedSMS("Bank", "last", day.Add(24*time.Hour-time.Second), 4),
+		archivedSMS("+300", "after", day.Add(24*time.Hour), 5),
+	} {
+		outcome := archiveForwarded
+		if i == 2 {
+			outcome = archiveBlocked
+		}
+		if err := archive.Record(p, outcome, nil); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("archive not written: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("archive mode = %o, want 600 (it holds SMS content)", perm)
+	}
+
+	got, err := archive.Query(day, day.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Text != "first" || got[1].Text != "last" {
+		t.Fatalf("Query() = %+v, want [first last]", got)
+	}
+	if got[0].Parts != 2 || got[1].Outcome != archiveBlocked {
+		t.Errorf("records = %+v, want parts/outcome preserved", got)
+	}
+}
+
+// TestMessageArchive_QueryTolerant: a missing archive is empty, and a torn
+// final line (crash mid-append) does not hide the records before it.
+func TestMessageArchive_QueryTolerant(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	path := filepath.Join(t.TempDir(), archiveFileName)
+	archive := NewMessageArchive(path)
+	all := func() []ArchiveRecord {
+		t.Helper()
+		recs, err := archive.Query(time.Time{}, time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+		return recs
+	}
+
+	if recs := all(); len(recs) != 0 {
+		t.Fatalf("Query() on missing archive = %+v, want empty", recs)
+	}
+
+	// An SMS without a valid SCTS is filed under its archive time.
+	if err := archive.Record(archivedSMS("+100", "no scts", time.Time{}, 1), archiveForwarded, nil); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"archived_at":"2026-01-0`)
+	f.Close()
+
+	recs := all()
+	if len(recs) != 1 || recs[0].SMSTime != nil || !recs[0].Time().Equal(clk.Now()) {
+		t.Fatalf("Query() = %+v, want one record timed at archive time", recs)
+	}
+}
+
+// TestMessageArchive_Compact: records archived before the cutoff and torn
+// lines go, the rest stays in order.
+func TestMessageArchive_Compact(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	path := filepath.Join(t.TempDir(), archiveFileName)
+	archive := NewMessageArchive(path)
+	if n, err := archive.Compact(clk.Now()); n != 0 || err != nil {
+		t.Fatalf("Compact() on missing archive = %d, %v", n, err)
+	}
+
+	for _, text := range []string{"old", "kept", "newest"} {
+		archive.Record(archivedSMS("+100", text, clk.Now(), 1), archiveForwarded, nil)
+		clock.Advance(24 * time.Hour)
+	}
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString("{\"archived_at\":\"2026-01-0\n")
+	f.Close()
+
+	cutoff := clk.Now().Add(-2 * 24 * time.Hour)
+	if n, err := archive.Compact(cutoff); n != 2 || err != nil {
+		t.Fatalf("Compact() = %d, %v; want the old record and the torn line removed", n, err)
+	}
+	recs, _ := archive.Query(time.Time{}, clk.Now())
+	if len(recs) != 2 || recs[0].Text != "kept" || recs[1].Text != "newest" {
+		t.Errorf("after Compact() = %+v, want [kept newest]", recs)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("archive after Compact(): %v, %v; want mode 600", info, err)
+	}
+	if n, _ := archive.Compact(cutoff); n != 0 {
+		t.Errorf("second Compact() removed %d", n)
+	}
+}
+
+func TestArchiveExport(t *testing.T) {
+	smsTime := time.Date(2026, 3, 10, 8, 30, 0, 0, time.UTC)
+	records := []ArchiveRecord{
+		{ArchivedAt: smsTime.Add(time.Minute), SMSTime: &smsTime, From: "+100",
+			Text: "code 1234, \"quoted\"\nline 2", Parts: 1, Outcome: archiveForwarded},
+		{ArchivedAt: smsTime, From: "Bank", Text: "<b>", Parts: 2, Outcome: archiveBlocked},
+	}
+
+	data, err := exportCSV(records)
+	if err != nil {
+		t.Fatalf("exportCSV() error = %v", err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		t.Fatalf("exportCSV() produced invalid CSV: %v", err)
+	}
+	if len(rows) != 3 || rows[0][0] != "sms_time" {
+		t.Fatalf("rows = %q, want header + 2 records", rows)
+	}
+	if rows[1][0] != "2026-03-10T08:30:00Z" || rows[1][6] != records[0].Text {
+		t.Errorf("row 1 = %q, want SMS time and text round-tripped", rows[1])
+	}
+	if rows[2][0] != "" || rows[2][4] != "2" {
+		t.Errorf("row 2 = %q, want empty sms_time and 2 parts", rows[2])
+	}
+
+	data, err = exportJSON(records)
+	if err != nil {
+		t.Fatalf("exportJSON() error = %v", err)
+	}
+	var decoded []ArchiveRecord
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded) != 2 || decoded[1].Text != "<b>" {
+		t.Errorf("exportJSON() = %s (err %v), want both records", data, err)
+	}
+	if data, _ := exportJSON(nil); string(data) != "[]" {
+		t.Errorf("exportJSON(nil) = %s, want []", data)
+	}
+}
+
+// TestDeliverer_ArchivesTelegramMessages: a forwarded SMS is archived with
+// the Telegram message of every chat it reached.
+func TestDeliverer_ArchivesTelegramMessages(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 5,1,,29", testPDUSingle}), nil)
+	cfg := testConfig()
+	deliverer, _, _ := newTestDeliverer(cfg)
+	deliverer.archive = NewMessageArchive(filepath.Join(t.TempDir(), archiveFileName))
+	deliverer.AddSink(&fakeSink{name: "webhook", errs: []error{errors.New("down")}})
+
+	// The webhook defers the first poll; Telegram is not sent again.
+	for range 2 {
+		if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+			t.Fatalf("processMessages() error = %v", err)
+		}
+	}
+	got, err := deliverer.archive.Query(time.Time{}, time.Now().AddDate(100, 0, 0))
+	if err != nil || len(got) != 1 {
+		t.Fatalf("Query() = %+v, %v; want one record", got, err)
+	}
+	want := []TelegramMessageRef{{ChatID: 100, MessageID: 1000}, {ChatID: 200, MessageID: 1001}}
+	if !slices.Equal(got[0].Telegram, want) {
+		t.Errorf("archived Telegram messages = %+v, want %+v", got[0].Telegram, want)
+	}
+	if len(deliverer.telegramSent) != 0 {
+		t.Errorf("telegramSent not emptied: %v", deliverer.telegramSent)
+	}
+}
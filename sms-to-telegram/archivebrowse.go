@@ -0,0 +1,132 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// archive: searches the message archive (ARCHIVE) from the terminal and
+// exports the matches, without the gateway. It only reads the file, so it
+// is safe while the gateway appends to it; a line being written is skipped
+// like a torn one.
+
+// archiveTextWidth is how much of the text a table row shows.
+const archiveTextWidth = 80
+
+func cmdArchive(args []string, stdout, stderr io.Writer) int {
+	fs := newCommandFlags("archive", stderr)
+	file := fs.String("file", "", "archive file (default: $STATE_DIR/"+archiveFileName+")")
+	sinceStr := fs.String("since", "", "only SMS from this time on (RFC 3339 or YYYY-MM-DD)")
+	untilStr := fs.String("until", "", "only SMS before this time (RFC 3339 or YYYY-MM-DD)")
+	sender := fs.String("from", "", "only SMS from this sender")
+	search := fs.String("q", "", "only SMS whose sender or text contains this, ignoring case")
+	outcome := fs.String("outcome", "", "only "+archiveForwarded+" or "+archiveBlocked+" SMS")
+	limit := fs.Int("limit", 0, "only the newest N matches (0: all)")
+	format := fs.String("format", "table", "output: table (one line per SMS), csv or json")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	path := *file
+	if path == "" {
+		if dir := os.Getenv("STATE_DIR"); dir != "" {
+			path = filepath.Join(dir, archiveFileName)
+		}
+	}
+	since, until := time.Time{}, time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	var err error
+	switch {
+	case path == "":
+		err = fmt.Errorf("no archive: set -file or STATE_DIR")
+	case *outcome != "" && *outcome != archiveForwarded && *outcome != archiveBlocked:
+		err = fmt.Errorf("invalid -outcome %q: must be %s or %s", *outcome, archiveForwarded, archiveBlocked)
+	case *format != "table" && *format != "csv" && *format != "json":
+		err = fmt.Errorf("invalid -format %q: must be table, csv or json", *format)
+	case *limit < 0:
+		err = fmt.Errorf("invalid -limit %d: must not be negative", *limit)
+	}
+	if err == nil && *sinceStr != "" {
+		if since, err = parseAPITime(*sinceStr); err != nil {
+			err = fmt.Errorf("-since: %w", err)
+		}
+	}
+	if err == nil && *untilStr != "" {
+		if until, err = parseAPITime(*untilStr); err != nil {
+			err = fmt.Errorf("-until: %w", err)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 2
+	}
+
+	// Query reads a missing archive as empty; here it is a wrong path.
+	if _, err := os.Stat(path); err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+	records, err := NewMessageArchive(path).Query(since, until)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+	filter := archiveFilter{sender: *sender, search: *search, outcome: *outcome}
+	var matches []ArchiveRecord
+	for _, rec := range records {
+		if filter.match(rec) {
+			matches = append(matches, rec)
+		}
+	}
+	shown := matches
+	if *limit > 0 && len(shown) > *limit {
+		shown = shown[len(shown)-*limit:]
+	}
+
+	switch *format {
+	case "table":
+		writeArchiveTable(stdout, shown)
+	case "csv", "json":
+		export := exportCSV
+		if *format == "json" {
+			export = exportJSON
+		}
+		data, err := export(shown)
+		if err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return 1
+		}
+		stdout.Write(data)
+		if *format == "json" {
+			fmt.Fprintln(stdout)
+		}
+	}
+	fmt.Fprintf(stderr, "%d of %d matching SMS (%d in range)\n", len(shown), len(matches), len(records))
+	return 0
+}
+
+// writeArchiveTable prints one line per SMS, oldest first: local time,
+// sender, outcome and the text on one line, shortened.
+func writeArchiveTable(w io.Writer, records []ArchiveRecord) {
+	for _, r := range records {
+		text := strings.Join(strings.Fields(r.Text), " ")
+		if r.RawReason != "" {
+			text = "[raw: " + r.RawReason + "]"
+		}
+		if utf8.RuneCountInString(text) > archiveTextWidth {
+			text = string([]rune(text)[:archiveTextWidth-1]) + "…"
+		}
+		fmt.Fprintf(w, "%s  %-16s %-9s  %s\n", r.Time().Local().Format("2006-01-02 15:04:05"), r.From, r.Outcome, text)
+	}
+}
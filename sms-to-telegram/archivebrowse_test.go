@@ -0,0 +1,83 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCmdArchive(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	dir := t.TempDir()
+	path := filepath.Join(dir, archiveFileName)
+	archive := NewMessageArchive(path)
+	day := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	for i, p := range []PendingSMS{
+		archivedSMS("+49170100", "code 1111", day, 1),
+		archivedSMS("Bank", "Your balance:\n42 EUR", day.Add(time.Hour), 2),
+		archivedSMS("+49170100", "code 2222 "+strings.Repeat("x", 100), day.Add(24*time.Hour), 3),
+	} {
+		outcome := archiveForwarded
+		if i == 1 {
+			outcome = archiveBlocked
+		}
+		if err := archive.Record(p, outcome, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("STATE_DIR", dir)
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		want     []string // substrings of stdout, in order
+		notWant  string
+		stderr   string
+	}{
+		{name: "all from STATE_DIR", want: []string{"code 1111", "Your balance: 42 EUR", "code 2222"}, stderr: "3 of 3 matching SMS"},
+		{name: "sender", args: []string{"-from", "49170100"}, want: []string{"code 1111", "code 2222"}, notWant: "Bank"},
+		{name: "search and outcome", args: []string{"-q", "BALANCE", "-outcome", "blocked"}, want: []string{"Bank             blocked    Your balance"}},
+		{name: "range", args: []string{"-since", "2026-03-10", "-until", "2026-03-11"}, want: []string{"code 1111", "Bank"}, notWant: "2222"},
+		{name: "newest", args: []string{"-limit", "1"}, want: []string{"code 2222 xxx", "…"}, notWant: "1111", stderr: "1 of 3 matching"},
+		{name: "csv", args: []string{"-format", "csv", "-q", "1111"}, want: []string{"sms_time,archived_at,from", "code 1111"}},
+		{name: "json", args: []string{"-format", "json", "-outcome", "blocked"}, want: []string{`"text": "Your balance:\n42 EUR"`}},
+		{name: "missing file", args: []string{"-file", filepath.Join(dir, "nope.ndjson")}, wantCode: 1, stderr: "no such file"},
+		{name: "bad outcome", args: []string{"-outcome", "lost"}, wantCode: 2, stderr: "invalid -outcome"},
+		{name: "bad format", args: []string{"-format", "xml"}, wantCode: 2, stderr: "invalid -format"},
+		{name: "bad time", args: []string{"-since", "yesterday"}, wantCode: 2, stderr: "-since: invalid time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := cmdArchive(tt.args, &stdout, &stderr); code != tt.wantCode {
+				t.Fatalf("exit code = %d, want %d\nstderr: %s", code, tt.wantCode, stderr.String())
+			}
+			out := stdout.String()
+			for _, want := range tt.want {
+				i := strings.Index(out, want)
+				if i < 0 {
+					t.Fatalf("stdout lacks %q (in order):\n%s", want, stdout.String())
+				}
+				out = out[i+len(want):]
+			}
+			if tt.notWant != "" && strings.Contains(stdout.String(), tt.notWant) {
+				t.Errorf("stdout has %q:\n%s", tt.notWant, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("stderr lacks %q:\n%s", tt.stderr, stderr.String())
+			}
+		})
+	}
+
+	t.Setenv("STATE_DIR", "")
+	var stdout, stderr bytes.Buffer
+	if code := cmdArchive(nil, &stdout, &stderr); code != 2 || !strings.Contains(stderr.String(), "set -file or STATE_DIR") {
+		t.Errorf("without STATE_DIR: %d, %s", code, stderr.String())
+	}
+}
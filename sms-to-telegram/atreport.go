@@ -0,0 +1,238 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// AT timing report: the per-command statistics the metrics keep, summed up
+// for deciding whether the modem or the carrier is the flaky part. A
+// timeout is the modem's or its USB link's (the network never leaves a
+// command unanswered); an error is the carrier's for the commands that need
+// the network, the modem's or the SIM's for the others. Shown by /diag and
+// diag -report, both also as JSON.
+
+const (
+	// atReportWindow and atReportWindows: the report's trend is the last
+	// day by the hour.
+	atReportWindow  = time.Hour
+	atReportWindows = 24
+	// atReportHealthy is the failure rate below which neither side is
+	// blamed.
+	atReportHealthy = 0.01
+)
+
+// networkCommandClasses are the command classes answered by the network:
+// sending, operator selection, USSD, calls and packet attach.
+var networkCommandClasses = []string{"CMGS", "CMSS", "COPS", "CUSD", "ATD", "CGATT"}
+
+// atWindow is one atReportWindow of AT command totals.
+type atWindow struct {
+	start                      time.Time
+	commands, timeouts, errors uint64
+}
+
+// ATReport is the AT timing and reliability report.
+type ATReport struct {
+	Since    time.Time         `json:"since"`
+	Until    time.Time         `json:"until"`
+	Commands []ATCommandReport `json:"commands"`
+	Hours    []ATHourReport    `json:"hours"`
+	// Verdict is healthy, modem, carrier or unknown (no commands yet);
+	// Summary explains it.
+	Verdict string `json:"verdict"`
+	Summary string `json:"summary"`
+}
+
+// ATCommandReport is one command class. P95Seconds is the upper bound of
+// the latency histogram bucket holding the 95th percentile, capped at the
+// maximum.
+type ATCommandReport struct {
+	Command     string  `json:"command"`
+	Network     bool    `json:"network"`
+	Count       uint64  `json:"count"`
+	Timeouts    uint64  `json:"timeouts"`
+	Errors      uint64  `json:"errors"`
+	SuccessRate float64 `json:"success_rate"`
+	MeanSeconds float64 `json:"mean_seconds"`
+	P95Seconds  float64 `json:"p95_seconds"`
+	MaxSeconds  float64 `json:"max_seconds"`
+}
+
+// ATHourReport is one atReportWindow.
+type ATHourReport struct {
+	Start       time.Time `json:"start"`
+	Count       uint64    `json:"count"`
+	Timeouts    uint64    `json:"timeouts"`
+	Errors      uint64    `json:"errors"`
+	SuccessRate float64   `json:"success_rate"`
+}
+
+// successRate is the share of count that did not fail; 1 without commands.
+func successRate(count, failed uint64) float64 {
+	if count == 0 {
+		return 1
+	}
+	return float64(count-failed) / float64(count)
+}
+
+// ATReport returns the AT report over the commands since the start.
+func (m *Metrics) ATReport() ATReport {
+	if m == nil {
+		return ATReport{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := ATReport{Since: m.startedAt, Until: clk.Now()}
+	for _, class := range slices.Sorted(maps.Keys(m.atCommands)) {
+		st := m.atCommands[class]
+		c := ATCommandReport{
+			Command:     class,
+			Network:     slices.Contains(networkCommandClasses, class),
+			Count:       st.count,
+			Timeouts:    st.timeouts,
+			Errors:      st.errors,
+			SuccessRate: successRate(st.count, st.timeouts+st.errors),
+			MaxSeconds:  st.max,
+			P95Seconds:  st.max,
+		}
+		if st.count > 0 {
+			c.MeanSeconds = st.sum / float64(st.count)
+		}
+		rank := uint64(math.Ceil(0.95 * float64(st.count)))
+		var cumulative uint64
+		for i, le := range atLatencyBuckets {
+			if cumulative += st.buckets[i]; cumulative >= rank {
+				c.P95Seconds = min(le, st.max)
+				break
+			}
+		}
+		r.Commands = append(r.Commands, c)
+	}
+	for _, w := range m.atWindows {
+		r.Hours = append(r.Hours, ATHourReport{
+			Start:       w.start,
+			Count:       w.commands,
+			Timeouts:    w.timeouts,
+			Errors:      w.errors,
+			SuccessRate: successRate(w.commands, w.timeouts+w.errors),
+		})
+	}
+	r.Verdict, r.Summary = atVerdict(r.Commands)
+	return r
+}
+
+// atVerdict blames the side with the higher failure rate: timeouts and
+// errors of local commands against all commands for the modem, errors of
+// network commands against the network commands for the carrier.
+func atVerdict(commands []ATCommandReport) (verdict, summary string) {
+	var total, modemFailed, network, networkFailed uint64
+	for _, c := range commands {
+		total += c.Count
+		modemFailed += c.Timeouts
+		if c.Network {
+			network += c.Count
+			networkFailed += c.Errors
+		} else {
+			modemFailed += c.Errors
+		}
+	}
+	if total == 0 {
+		return "unknown", "No AT commands yet."
+	}
+	modemRate := float64(modemFailed) / float64(total)
+	networkRate := 0.0
+	if network > 0 {
+		networkRate = float64(networkFailed) / float64(network)
+	}
+	switch {
+	case modemRate < atReportHealthy && networkRate < atReportHealthy:
+		return "healthy", fmt.Sprintf("Modem failures %.1f%%, network failures %.1f%%: neither stands out.",
+			100*modemRate, 100*networkRate)
+	case modemRate >= networkRate:
+		return "modem", fmt.Sprintf("%.1f%% of the commands timed out or failed in the modem (network commands: %.1f%%): "+
+			"suspect the modem, its USB link or power supply.", 100*modemRate, 100*networkRate)
+	default:
+		return "carrier", fmt.Sprintf("%.1f%% of the network commands failed (modem: %.1f%%): "+
+			"suspect the carrier or the coverage.", 100*networkRate, 100*modemRate)
+	}
+}
+
+// formatSeconds renders a latency to the millisecond.
+func formatSeconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond).String()
+}
+
+// formatATReport renders the report as a plain-text table.
+func formatATReport(r ATReport) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "AT commands %s – %s\n", r.Since.Format("2006-01-02 15:04"), r.Until.Format("2006-01-02 15:04"))
+	if len(r.Commands) > 0 {
+		fmt.Fprintf(&sb, "\n%-10s %7s %7s %7s %7s %8s %8s %8s\n", "Command", "Count", "OK", "Timeout", "Error", "Mean", "P95", "Max")
+		for _, c := range r.Commands {
+			name := c.Command
+			if c.Network {
+				name += "*"
+			}
+			fmt.Fprintf(&sb, "%-10s %7d %6.1f%% %7d %7d %8s %8s %8s\n", name, c.Count, 100*c.SuccessRate,
+				c.Timeouts, c.Errors, formatSeconds(c.MeanSeconds), formatSeconds(c.P95Seconds), formatSeconds(c.MaxSeconds))
+		}
+		sb.WriteString("* needs the network\n")
+	}
+	if len(r.Hours) > 0 {
+		fmt.Fprintf(&sb, "\n%-16s %7s %7s %7s %7s\n", "Hour", "Count", "OK", "Timeout", "Error")
+		for _, h := range r.Hours {
+			fmt.Fprintf(&sb, "%-16s %7d %6.1f%% %7d %7d\n", h.Start.Format("2006-01-02 15:04"), h.Count,
+				100*h.SuccessRate, h.Timeouts, h.Errors)
+		}
+	}
+	fmt.Fprintf(&sb, "\nVerdict: %s. %s\n", r.Verdict, r.Summary)
+	return sb.String()
+}
+
+// registerDiagCommand wires /diag, the AT report of the running gateway,
+// as a message or, with "json", a document. It reads the metrics only.
+func registerDiagCommand(r *CommandRouter, metrics *Metrics, docs DocumentSender) {
+	r.Register("diag", botCommand{
+		usage:       "/diag [json]",
+		description: "Show AT command success rates and latencies (modem or carrier?)",
+		handle: func(ctx context.Context, req commandRequest) string {
+			report := metrics.ATReport()
+			if len(req.Args) == 0 {
+				return "<pre>" + escapeHTML(formatATReport(report)) + "</pre>"
+			}
+			if len(req.Args) > 1 || !strings.EqualFold(req.Args[0], "json") {
+				return "Usage: <code>/diag [json]</code>"
+			}
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return fmt.Sprintf("Report failed: %s", escapeHTML(err.Error()))
+			}
+			sendCtx, cancel := context.WithTimeout(ctx, r.sendTimeout)
+			defer cancel()
+			if _, err := docs.SendDocument(sendCtx, &bot.SendDocumentParams{
+				ChatID:   req.ChatID,
+				Document: &models.InputFileUpload{Filename: "at-report-" + report.Until.Format("2006-01-02T1504") + ".json", Data: bytes.NewReader(data)},
+				Caption:  "AT report, verdict: " + report.Verdict,
+			}); err != nil {
+				slog.Error("Failed to upload AT report", "chat_id", req.ChatID, "error", err)
+				return fmt.Sprintf("Failed to upload the report: %s", escapeHTML(err.Error()))
+			}
+			return ""
+		},
+	})
+}
@@ -0,0 +1,124 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+func TestMetrics_ATReport(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	metrics := NewMetrics()
+	if r := metrics.ATReport(); r.Verdict != "unknown" || len(r.Commands) != 0 || len(r.Hours) != 0 {
+		t.Errorf("report before the first command = %+v", r)
+	}
+
+	for i := range 19 {
+		metrics.ATCommandDone("AT+CMGL=4", time.Duration(100+i)*time.Millisecond, nil)
+	}
+	metrics.ATCommandDone("AT+CMGL=4", 7*time.Second, at.ErrModemTimeout)
+	clock.Advance(time.Hour)
+	metrics.ATCommandDone("AT+CMGS=23", 3*time.Second, nil)
+	metrics.ATCommandDone("AT+CMGS=23", 90*time.Second, fmt.Errorf("%w: +CMS ERROR: 500", at.ErrModemError))
+
+	r := metrics.ATReport()
+	if len(r.Commands) != 2 {
+		t.Fatalf("commands = %+v, want CMGL and CMGS", r.Commands)
+	}
+	cmgl, cmgs := r.Commands[0], r.Commands[1]
+	if cmgl.Command != "CMGL" || cmgl.Network || cmgl.Count != 20 || cmgl.Timeouts != 1 || cmgl.SuccessRate != 0.95 {
+		t.Errorf("CMGL = %+v", cmgl)
+	}
+	// The 19th of 20 is in the 0.25s bucket; the mean includes the timeout.
+	if cmgl.P95Seconds != 0.25 || cmgl.MaxSeconds != 7 || cmgl.MeanSeconds < 0.45 || cmgl.MeanSeconds > 0.46 {
+		t.Errorf("CMGL latencies = %+v", cmgl)
+	}
+	// Beyond the last bucket: the maximum.
+	if cmgs.Command != "CMGS" || !cmgs.Network || cmgs.Errors != 1 || cmgs.SuccessRate != 0.5 || cmgs.P95Seconds != 90 {
+		t.Errorf("CMGS = %+v", cmgs)
+	}
+	if len(r.Hours) != 2 || r.Hours[0].Count != 20 || r.Hours[0].Timeouts != 1 || r.Hours[1].Count != 2 || r.Hours[1].Errors != 1 ||
+		!r.Hours[1].Start.Equal(clock.Now().Truncate(time.Hour)) {
+		t.Errorf("hours = %+v", r.Hours)
+	}
+	if r.Verdict != "carrier" {
+		t.Errorf("verdict = %s (%s), want carrier", r.Verdict, r.Summary)
+	}
+
+	text := formatATReport(r)
+	for _, want := range []string{"CMGL", "CMGS*", "95.0%", "250ms", "1m30s", "Verdict: carrier."} {
+		if !strings.Contains(text, want) {
+			t.Errorf("report lacks %q:\n%s", want, text)
+		}
+	}
+	if _, err := json.Marshal(r); err != nil {
+		t.Errorf("json.Marshal() error = %v", err)
+	}
+
+	// Only the last day by the hour is kept.
+	for range atReportWindows + 5 {
+		clock.Advance(time.Hour)
+		metrics.ATCommandDone("AT", time.Millisecond, nil)
+	}
+	if hours := metrics.ATReport().Hours; len(hours) != atReportWindows || !hours[len(hours)-1].Start.Equal(clock.Now()) {
+		t.Errorf("hours = %d, want the last %d", len(hours), atReportWindows)
+	}
+}
+
+func TestATVerdict(t *testing.T) {
+	tests := []struct {
+		commands []ATCommandReport
+		want     string
+	}{
+		{want: "unknown"},
+		{commands: []ATCommandReport{{Command: "CMGL", Count: 1000, Timeouts: 5}, {Command: "CMGS", Network: true, Count: 100}}, want: "healthy"},
+		// Timeouts of network commands are the modem's too.
+		{commands: []ATCommandReport{{Command: "CMGL", Count: 100}, {Command: "CMGS", Network: true, Count: 100, Timeouts: 10}}, want: "modem"},
+		{commands: []ATCommandReport{{Command: "CPMS", Count: 100, Errors: 20}, {Command: "CMGS", Network: true, Count: 10, Errors: 1}}, want: "modem"},
+		{commands: []ATCommandReport{{Command: "CMGL", Count: 1000, Errors: 10}, {Command: "CMGS", Network: true, Count: 10, Errors: 2}}, want: "carrier"},
+	}
+	for _, tt := range tests {
+		if got, summary := atVerdict(tt.commands); got != tt.want || summary == "" {
+			t.Errorf("atVerdict(%+v) = %s (%s), want %s", tt.commands, got, summary, tt.want)
+		}
+	}
+}
+
+func TestCommandRouter_Diag(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	router, sender, _ := newTestRouter(t)
+	metrics := NewMetrics()
+	metrics.ATCommandDone("AT+CSQ", 20*time.Millisecond, nil)
+	docs := &fakeDocSender{}
+	registerDiagCommand(router, metrics, docs)
+	ctx := context.Background()
+
+	router.HandleUpdate(ctx, commandUpdate(testAdminID, 42, "/diag"))
+	if replies := sender.sentTo(42); len(replies) != 1 || !strings.HasPrefix(replies[0].Text, "<pre>AT commands") ||
+		!strings.Contains(replies[0].Text, "Verdict: healthy.") {
+		t.Fatalf("replies = %+v, want the report", replies)
+	}
+
+	router.HandleUpdate(ctx, commandUpdate(testAdminID, 42, "/diag json"))
+	if len(docs.docs) != 1 || docs.docs[0].Filename != "at-report-2026-01-01T1200.json" {
+		t.Fatalf("documents = %+v, want the JSON report", docs.docs)
+	}
+	var r ATReport
+	if err := json.Unmarshal(docs.docs[0].Data, &r); err != nil || len(r.Commands) != 1 || r.Commands[0].Command != "CSQ" {
+		t.Errorf("document = %s (%v), want the CSQ stats", docs.docs[0].Data, err)
+	}
+
+	router.HandleUpdate(ctx, commandUpdate(testAdminID, 42, "/diag csv"))
+	if replies := sender.sentTo(42); len(replies) != 2 || !strings.Contains(replies[1].Text, "Usage") {
+		t.Errorf("replies = %+v, want the usage", replies)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditRejected is the audit outcome of an SMS a sink permanently refused;
+// forwarded and blocked share the archive's outcome names.
+const auditRejected = "rejected"
+
+// AuditDestination is one sink that accepted the SMS.
+type AuditDestination struct {
+	Sink string `json:"sink"`
+	// ChatIDs are the Telegram chats reached (after routing), Messages the
+	// messages created in them; telegram only.
+	ChatIDs  []int64              `json:"chat_ids,omitempty"`
+	Messages []TelegramMessageRef `json:"messages,omitempty"`
+	At       time.Time            `json:"at"`
+	// LatencyMS is the time from ReceivedAt to this sink's acceptance.
+	LatencyMS int64 `json:"latency_ms"`
+}
+
+// AuditRecord is one line of the audit log: the final outcome of one SMS.
+type AuditRecord struct {
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host"`
+	Outcome string    `json:"outcome"`
+	// ID is the gateway's message key, stable across the retries of one SMS.
+	ID      string     `json:"id"`
+	From    string     `json:"from"`
+	SMSTime *time.Time `json:"sms_time,omitempty"` // nil when SCTS was invalid
+	// ReceivedAt is when the gateway first read the SMS from the SIM.
+	ReceivedAt      time.Time `json:"received_at"`
+	LatencyMS       int64     `json:"latency_ms"`
+	Parts           int       `json:"parts"`
+	SIMIndices      []int     `json:"sim_indices"`
+	TextLength      int       `json:"text_length"`
+	TextFingerprint string    `json:"text_fingerprint"`
+	// Destinations lists the sinks that accepted the SMS; for a rejected
+	// SMS those reached before the refusal.
+	Destinations []AuditDestination `json:"destinations"`
+	RejectedBy   string             `json:"rejected_by,omitempty"`
+}
+
+// AuditLog is an append-only NDJSON record of what happened to every SMS
+// (AUDIT_LOG), kept apart from the diagnostic log so it survives log level
+// changes and rotation policies meant for debugging. It never holds the SMS
+// text — text_fingerprint matches the one in the logs and the event log —
+// and masks the sender under LOG_PRIVACY. The file is reopened for every
+// record, so external rotation (logrotate without copytruncate) is safe.
+// Nil-safe.
+type AuditLog struct {
+	mu      sync.Mutex
+	path    string
+	host    string
+	privacy bool
+}
+
+func NewAuditLog(path, host string, privacy bool) *AuditLog {
+	return &AuditLog{path: path, host: host, privacy: privacy}
+}
+
+// Record appends rec, filling in the host and applying the privacy mode.
+func (a *AuditLog) Record(rec AuditRecord) error {
+	if a == nil {
+		return nil
+	}
+	rec.Host = a.host
+	if a.privacy {
+		rec.From = maskNumber(rec.From)
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("writing audit log: %w", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,156 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readAuditLog(t *testing.T, path string) []AuditRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var recs []AuditRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("decoding %q: %v", sc.Text(), err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+// TestDeliverer_AuditLog: every final outcome is recorded once, with the
+// destinations, their latency from the first attempt and no SMS text.
+func TestDeliverer_AuditLog(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	cfg := testConfig()
+	deliverer, _, _ := newTestDeliverer(cfg)
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	deliverer.audit = NewAuditLog(path, "gw1", false)
+	hook := &fakeSink{name: "hook", errs: []error{errors.New("connection refused")}}
+	deliverer.AddSink(hook)
+	bl, err := NewSenderBlocklist([]string{"Spam"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliverer.blocklist = bl
+
+	start := clock.Now()
+	smsTime := start.Add(-time.Minute)
+	forwarded := PendingSMS{Message: SMSMessage{Index: 1, From: "+4915550001234", Text: "code 123456", Time: smsTime}, PartIndices: []int{1}}
+	ctx := context.Background()
+	if got := deliverer.Deliver(ctx, forwarded); got != deliveryDeferred {
+		t.Fatalf("first Deliver() = %v, want deliveryDeferred", got)
+	}
+	if recs := readAuditLog(t, path); len(recs) != 0 {
+		t.Fatalf("deferred delivery audited: %+v", recs)
+	}
+	clock.Advance(30 * time.Second)
+	if got := deliverer.Deliver(ctx, forwarded); got != deliveryDone {
+		t.Fatalf("retry Deliver() = %v, want deliveryDone", got)
+	}
+
+	blocked := PendingSMS{Message: SMSMessage{Index: 2, From: "SPAM", Text: "win"}, PartIndices: []int{2}}
+	if got := deliverer.Deliver(ctx, blocked); got != deliveryDropped {
+		t.Fatalf("blocked Deliver() = %v, want deliveryDropped", got)
+	}
+
+	hook.errs = []error{fmt.Errorf("%w: HTTP 400", errSinkRejected)}
+	rejected := PendingSMS{Message: SMSMessage{Index: 3, From: "Bank", Text: "hello"}, PartIndices: []int{3, 4}}
+	for range 2 {
+		if got := deliverer.Deliver(ctx, rejected); got != deliveryRejected {
+			t.Fatalf("rejected Deliver() = %v, want deliveryRejected", got)
+		}
+	}
+
+	recs := readAuditLog(t, path)
+	if len(recs) != 3 {
+		t.Fatalf("audit records = %d, want 3: %+v", len(recs), recs)
+	}
+
+	fwd := recs[0]
+	if fwd.Outcome != "forwarded" || fwd.Host != "gw1" || fwd.From != "+4915550001234" ||
+		fwd.ID != messageKey(forwarded) || fwd.SMSTime == nil || !fwd.SMSTime.Equal(smsTime) {
+		t.Errorf("forwarded record = %+v", fwd)
+	}
+	if !fwd.ReceivedAt.Equal(start) || fwd.LatencyMS != 30000 {
+		t.Errorf("received_at = %v, latency = %dms, want %v and 30000ms", fwd.ReceivedAt, fwd.LatencyMS, start)
+	}
+	if fwd.TextLength != 11 || fwd.TextFingerprint != contentFingerprint("code 123456") {
+		t.Errorf("text length/fingerprint = %d/%s", fwd.TextLength, fwd.TextFingerprint)
+	}
+	if len(fwd.Destinations) != 2 {
+		t.Fatalf("destinations = %+v, want telegram and hook", fwd.Destinations)
+	}
+	if tg := fwd.Destinations[0]; tg.Sink != "telegram" || !slices.Equal(tg.ChatIDs, cfg.ChatIDs) || len(tg.Messages) != 2 || tg.LatencyMS != 0 {
+		t.Errorf("telegram destination = %+v", tg)
+	}
+	if h := fwd.Destinations[1]; h.Sink != "hook" || h.ChatIDs != nil || h.LatencyMS != 30000 {
+		t.Errorf("hook destination = %+v", h)
+	}
+
+	if b := recs[1]; b.Outcome != "blocked" || len(b.Destinations) != 0 || b.LatencyMS != 0 {
+		t.Errorf("blocked record = %+v", b)
+	}
+	if r := recs[2]; r.Outcome != "rejected" || r.RejectedBy != "hook" || r.Parts != 2 ||
+		len(r.Destinations) != 1 || r.Destinations[0].Sink != "telegram" {
+		t.Errorf("rejected record = %+v", r)
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "123456") {
+		t.Errorf("audit log contains SMS text:\n%s", data)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("audit log mode = %v (%v), want 0600", info.Mode().Perm(), err)
+	}
+	if len(deliverer.firstSeen) != 0 {
+		t.Errorf("firstSeen = %v, want cleared", deliverer.firstSeen)
+	}
+}
+
+func TestDeliverer_AuditLogPrivacyAndDryRun(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	pending := PendingSMS{Message: SMSMessage{Index: 1, From: "+4915550001234", Text: "hi"}, PartIndices: []int{1}}
+
+	cfg := testConfig()
+	deliverer, _, _ := newTestDeliverer(cfg)
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	deliverer.audit = NewAuditLog(path, "gw1", true)
+	deliverer.Deliver(context.Background(), pending)
+	if recs := readAuditLog(t, path); len(recs) != 1 || recs[0].From != "+****34" {
+		t.Errorf("LOG_PRIVACY records = %+v, want sender masked", recs)
+	}
+
+	// DRY_RUN keeps the SMS on the SIM: nothing is final, nothing audited.
+	cfg = testConfig()
+	cfg.DryRun = true
+	deliverer, _, _ = newTestDeliverer(cfg)
+	path = filepath.Join(t.TempDir(), "audit.ndjson")
+	deliverer.audit = NewAuditLog(path, "gw1", false)
+	deliverer.Deliver(context.Background(), pending)
+	if recs := readAuditLog(t, path); len(recs) != 0 {
+		t.Errorf("DRY_RUN records = %+v, want none", recs)
+	}
+}
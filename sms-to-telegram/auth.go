@@ -0,0 +1,538 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP API authentication. Four kinds of credentials are accepted, any
+// combination of them may be configured:
+//   - API_TOKEN, a static bearer token with the admin role;
+//   - API_KEYS, random keys (gen-api-key command) stored as their SHA-256,
+//     each with its own scopes;
+//   - API_USERS, basic auth users with PBKDF2 password hashes
+//     (hash-password command) and a role each;
+//   - OIDC_ISSUER, bearer JWTs of an OpenID Connect provider, the role taken
+//     from a groups claim (oidc.go).
+//
+// Reading (GET) needs the read scope, sending an SMS (POST /api/v1/send) the
+// send scope and anything else (inject) admin; the read role grants read,
+// the admin role everything. The probes and the dashboard page are always
+// anonymous.
+
+// apiRole is what a caller may do; roles are ordered.
+type apiRole int
+
+const (
+	roleNone apiRole = iota
+	roleRead
+	roleAdmin
+)
+
+func (r apiRole) String() string {
+	switch r {
+	case roleRead:
+		return "read"
+	case roleAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+// scopes are what the role grants.
+func (r apiRole) scopes() apiScope {
+	switch r {
+	case roleRead:
+		return scopeRead
+	case roleAdmin:
+		return scopeRead | scopeSend | scopeAdmin
+	}
+	return 0
+}
+
+func parseAPIRole(s string) (apiRole, error) {
+	switch strings.ToLower(s) {
+	case "read":
+		return roleRead, nil
+	case "admin":
+		return roleAdmin, nil
+	}
+	return roleNone, fmt.Errorf("unknown role %q (use read or admin)", s)
+}
+
+// apiScope is a set of things a caller may do.
+type apiScope uint8
+
+const (
+	// scopeRead: every GET (archive, metrics, dashboard data).
+	scopeRead apiScope = 1 << iota
+	// scopeSend: POST /api/v1/send.
+	scopeSend
+	// scopeAdmin: everything else.
+	scopeAdmin
+)
+
+// apiScopeNames are the scope names of API_KEYS, in String order.
+var apiScopeNames = []struct {
+	name  string
+	scope apiScope
+}{{"read", scopeRead}, {"send", scopeSend}, {"admin", scopeAdmin}}
+
+func (s apiScope) String() string {
+	var names []string
+	for _, n := range apiScopeNames {
+		if s&n.scope != 0 {
+			names = append(names, n.name)
+		}
+	}
+	if names == nil {
+		return "none"
+	}
+	return strings.Join(names, "+")
+}
+
+// parseAPIScopes parses "+"-separated scope names; admin implies the
+// others.
+func parseAPIScopes(s string) (apiScope, error) {
+	var scopes apiScope
+	for _, name := range strings.Split(strings.ToLower(s), "+") {
+		var scope apiScope
+		for _, n := range apiScopeNames {
+			if n.name == name {
+				scope = n.scope
+			}
+		}
+		if scope == 0 {
+			return 0, fmt.Errorf("unknown scope %q (use read, send or admin, joined with +)", name)
+		}
+		scopes |= scope
+	}
+	if scopes&scopeAdmin != 0 {
+		scopes = roleAdmin.scopes()
+	}
+	return scopes, nil
+}
+
+const (
+	// passwordHashPrefix names the API_USERS hash format:
+	// pbkdf2-sha256$<iterations>$<salt>$<key>, base64 without padding.
+	passwordHashPrefix = "pbkdf2-sha256"
+	// passwordIterations follows the OWASP recommendation for PBKDF2-SHA256.
+	passwordIterations = 600000
+	passwordKeyLen     = 32
+	// verifiedTTL is how long a checked password is remembered: the
+	// dashboard polls every few seconds and PBKDF2 is slow on purpose.
+	verifiedTTL     = 10 * time.Minute
+	verifiedMaxSize = 64
+)
+
+// APIUser is one API_USERS entry.
+type APIUser struct {
+	Name string
+	Role apiRole
+	// Hash is the hash-password output.
+	Hash string
+}
+
+// parseAPIUsers parses the comma-separated name:role:hash entries of
+// API_USERS. Errors never quote the hash.
+func parseAPIUsers(s string) ([]APIUser, error) {
+	var users []APIUser
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rest, ok1 := strings.Cut(entry, ":")
+		roleStr, hash, ok2 := strings.Cut(rest, ":")
+		if !ok1 || !ok2 || name == "" {
+			return nil, fmt.Errorf("invalid API_USERS entry: want name:role:hash")
+		}
+		role, err := parseAPIRole(roleStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API_USERS entry for %q: %v", name, err)
+		}
+		if _, _, _, err := parsePasswordHash(hash); err != nil {
+			return nil, fmt.Errorf("invalid API_USERS entry for %q: %v", name, err)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("invalid API_USERS: user %q listed twice", name)
+		}
+		seen[name] = true
+		users = append(users, APIUser{Name: name, Role: role, Hash: hash})
+	}
+	return users, nil
+}
+
+// APIKey is one API_KEYS entry.
+type APIKey struct {
+	Name   string
+	Scopes apiScope
+	// Hash is the SHA-256 of the key. Keys are random, so a fast hash is
+	// enough and no cache is needed.
+	Hash [32]byte
+}
+
+// parseAPIKeys parses the comma-separated name:scopes:sha256-hex entries of
+// API_KEYS. Errors never quote the hash.
+func parseAPIKeys(s string) ([]APIKey, error) {
+	var keys []APIKey
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rest, ok1 := strings.Cut(entry, ":")
+		scopeStr, hashHex, ok2 := strings.Cut(rest, ":")
+		if !ok1 || !ok2 || name == "" {
+			return nil, fmt.Errorf("invalid API_KEYS entry: want name:scopes:hash")
+		}
+		scopes, err := parseAPIScopes(scopeStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API_KEYS entry for %q: %v", name, err)
+		}
+		key := APIKey{Name: name, Scopes: scopes}
+		if n, err := hex.Decode(key.Hash[:], []byte(hashHex)); err != nil || n != len(key.Hash) || len(hashHex) != 2*len(key.Hash) {
+			return nil, fmt.Errorf("invalid API_KEYS entry for %q: hash is not a gen-api-key output", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("invalid API_KEYS: key %q listed twice", name)
+		}
+		seen[name] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// hashPassword returns the API_USERS hash of password with a random salt.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, passwordKeyLen)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("%s$%d$%s$%s", passwordHashPrefix, passwordIterations, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+func parsePasswordHash(hash string) (iterations int, salt, key []byte, err error) {
+	fields := strings.Split(hash, "$")
+	if len(fields) != 4 || fields[0] != passwordHashPrefix {
+		return 0, nil, nil, errors.New("password hash is not a hash-password output")
+	}
+	iterations, err = strconv.Atoi(fields[1])
+	if err != nil || iterations < 1000 {
+		return 0, nil, nil, errors.New("password hash has an invalid iteration count")
+	}
+	enc := base64.RawStdEncoding
+	salt, err1 := enc.DecodeString(fields[2])
+	key, err2 := enc.DecodeString(fields[3])
+	if err1 != nil || err2 != nil || len(salt) == 0 || len(key) == 0 {
+		return 0, nil, nil, errors.New("password hash is not valid base64")
+	}
+	return iterations, salt, key, nil
+}
+
+// checkPassword reports whether password matches hash.
+func checkPassword(hash, password string) bool {
+	iterations, salt, want, err := parsePasswordHash(hash)
+	if err != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	return err == nil && subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// APIAuth checks the credentials of HTTP API requests. A zero APIAuth (no
+// credentials configured) lets everybody in with the admin role.
+type APIAuth struct {
+	token string
+	users map[string]APIUser
+	oidc  *OIDCVerifier
+	// keys are the API_KEYS by hash.
+	keys map[[32]byte]APIKey
+	// limiter caps the requests per caller (API_RATE_LIMIT); nil is
+	// unlimited.
+	limiter *rateLimiter
+
+	mu sync.Mutex
+	// verified remembers recently checked basic credentials by their
+	// SHA-256, never in clear.
+	verified map[[32]byte]time.Time
+}
+
+func NewAPIAuth(token string, users []APIUser, oidc *OIDCVerifier) *APIAuth {
+	a := &APIAuth{token: token, oidc: oidc, users: make(map[string]APIUser), verified: make(map[[32]byte]time.Time)}
+	for _, u := range users {
+		a.users[u.Name] = u
+	}
+	return a
+}
+
+// SetKeys adds the API_KEYS.
+func (a *APIAuth) SetKeys(keys []APIKey) {
+	a.keys = make(map[[32]byte]APIKey, len(keys))
+	for _, k := range keys {
+		a.keys[k.Hash] = k
+	}
+}
+
+// Enabled reports whether any credentials are configured.
+func (a *APIAuth) Enabled() bool {
+	return a != nil && (a.token != "" || len(a.users) > 0 || a.oidc != nil || len(a.keys) > 0)
+}
+
+// Authenticate returns who sent r and their scopes. An error means the
+// credentials are missing or invalid; its text names no secret.
+func (a *APIAuth) Authenticate(r *http.Request) (string, apiScope, error) {
+	if !a.Enabled() {
+		return "anonymous", roleAdmin.scopes(), nil
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		if k, ok := a.keys[sha256.Sum256([]byte(key))]; ok {
+			return "key:" + k.Name, k.Scopes, nil
+		}
+		return "", 0, errors.New("invalid API key")
+	}
+	header := r.Header.Get("Authorization")
+	if bearer, ok := strings.CutPrefix(header, "Bearer "); ok {
+		if a.token != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(a.token)) == 1 {
+			return "api-token", roleAdmin.scopes(), nil
+		}
+		if k, ok := a.keys[sha256.Sum256([]byte(bearer))]; ok {
+			return "key:" + k.Name, k.Scopes, nil
+		}
+		if a.oidc != nil {
+			name, role, err := a.oidc.Verify(r.Context(), bearer)
+			return name, role.scopes(), err
+		}
+		return "", 0, errors.New("invalid bearer token")
+	}
+	if name, password, ok := r.BasicAuth(); ok && len(a.users) > 0 {
+		if a.checkUser(name, password) {
+			return name, a.users[name].Role.scopes(), nil
+		}
+		return "", 0, fmt.Errorf("invalid password for user %q", name)
+	}
+	return "", 0, errors.New("no credentials")
+}
+
+func (a *APIAuth) checkUser(name, password string) bool {
+	sum := sha256.Sum256([]byte(name + "\x00" + password))
+	now := clk.Now()
+	a.mu.Lock()
+	at, ok := a.verified[sum]
+	a.mu.Unlock()
+	if ok && now.Sub(at) < verifiedTTL {
+		return true
+	}
+	user, known := a.users[name]
+	if !known {
+		// Take as long as for a known user.
+		for _, other := range a.users {
+			checkPassword(other.Hash, password)
+			break
+		}
+		return false
+	}
+	if !checkPassword(user.Hash, password) {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.verified) >= verifiedMaxSize {
+		clear(a.verified)
+	}
+	a.verified[sum] = now
+	return true
+}
+
+// challenge sets the WWW-Authenticate headers of a 401 reply.
+func (a *APIAuth) challenge(w http.ResponseWriter) {
+	if len(a.users) > 0 {
+		w.Header().Add("WWW-Authenticate", `Basic realm="sms-to-telegram", charset="UTF-8"`)
+	}
+	if a.token != "" || a.oidc != nil || len(a.keys) > 0 {
+		w.Header().Add("WWW-Authenticate", `Bearer realm="sms-to-telegram"`)
+	}
+}
+
+// apiRequiredScope is the scope r needs: none for the probes and, when the
+// dashboard is served, its page; read to read; send to send; admin for
+// anything else.
+func apiRequiredScope(r *http.Request, dashboard bool) apiScope {
+	switch {
+	case r.URL.Path == "/healthz" || r.URL.Path == "/readyz":
+		return 0
+	case dashboard && dashboardPublic(r.URL.Path):
+		return 0
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return scopeRead
+	case r.URL.Path == "/api/v1/send":
+		return scopeSend
+	}
+	return scopeAdmin
+}
+
+// authorize lets r through or writes the 401/403/429 reply. Requests that
+// change something are logged with the caller. With a rate limit, callers
+// are limited by name, and failed authentications by remote address.
+func (a *APIAuth) authorize(w http.ResponseWriter, r *http.Request, need apiScope) bool {
+	if need == 0 {
+		return true
+	}
+	if !a.Enabled() {
+		return a.limit(w, r, "anonymous@"+remoteHost(r))
+	}
+	// Refuse further guesses before paying for PBKDF2.
+	if wait := a.limiter.exhausted("failed@" + remoteHost(r)); wait > 0 {
+		a.tooMany(w, r, "failed@"+remoteHost(r), wait)
+		return false
+	}
+	user, scopes, err := a.Authenticate(r)
+	if err != nil {
+		slog.Debug("HTTP API authentication failed", "remote", r.RemoteAddr, "path", r.URL.Path, "error", err)
+		a.limiter.take("failed@" + remoteHost(r))
+		a.challenge(w)
+		writeAPIError(w, http.StatusUnauthorized, "missing or invalid credentials")
+		return false
+	}
+	if !a.limit(w, r, user) {
+		return false
+	}
+	if scopes&need != need {
+		slog.Warn("HTTP API request denied", "user", user, "scopes", scopes.String(), "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+		writeAPIError(w, http.StatusForbidden, fmt.Sprintf("%s scope required", need))
+		return false
+	}
+	if need != scopeRead {
+		slog.Info("HTTP API "+need.String()+" request", "user", user, "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+	}
+	return true
+}
+
+// limit takes a request of caller from the rate limit, or writes the 429
+// reply.
+func (a *APIAuth) limit(w http.ResponseWriter, r *http.Request, caller string) bool {
+	if a == nil {
+		return true
+	}
+	if wait := a.limiter.take(caller); wait > 0 {
+		a.tooMany(w, r, caller, wait)
+		return false
+	}
+	return true
+}
+
+func (a *APIAuth) tooMany(w http.ResponseWriter, r *http.Request, caller string, wait time.Duration) {
+	slog.Warn("HTTP API rate limit exceeded", "caller", caller, "method", r.Method, "path", r.URL.Path)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeAPIError(w, http.StatusTooManyRequests, "rate limit exceeded")
+}
+
+// remoteHost is the address r came from, without the port.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func cmdGenAPIKey(args []string, stdout, stderr io.Writer) int {
+	fs := newCommandFlags("gen-api-key", stderr)
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	return genAPIKey(fs.Args(), stdout, stderr)
+}
+
+// genAPIKey prints a new random key and its API_KEYS entry. The key is
+// shown only this once; the gateway keeps just its hash.
+func genAPIKey(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 2 {
+		fmt.Fprintln(stderr, "Usage: sms-to-telegram gen-api-key <name> <scopes>  (scopes: read, send, admin; e.g. read+send)")
+		return 2
+	}
+	name := args[0]
+	scopes, err := parseAPIScopes(args[1])
+	if err != nil || name == "" || strings.ContainsAny(name, ":,") {
+		fmt.Fprintln(stderr, "The name must not contain ':' or ',' and the scopes must be read, send or admin, joined with +")
+		return 2
+	}
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	key := base64.RawURLEncoding.EncodeToString(raw)
+	sum := sha256.Sum256([]byte(key))
+	fmt.Fprintf(stdout, "API key (give it to the client, it is not shown again):\n%s\n", key)
+	fmt.Fprintf(stdout, "API_KEYS entry:\n%s:%s:%s\n", name, scopes, hex.EncodeToString(sum[:]))
+	return 0
+}
+
+func cmdHashPassword(args []string, stdout, stderr io.Writer) int {
+	fs := newCommandFlags("hash-password", stderr)
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	return hashPasswordEntry(os.Stdin, fs.Args(), stdout, stderr)
+}
+
+// hashPasswordEntry hashes the first line of r; given a user and a role it
+// prints the whole API_USERS entry. The password never reaches the
+// arguments, where ps and the shell history would see it.
+func hashPasswordEntry(r io.Reader, args []string, stdout, stderr io.Writer) int {
+	if len(args) != 0 && len(args) != 2 {
+		fmt.Fprintln(stderr, "Usage: sms-to-telegram hash-password [user role] < password-file")
+		return 2
+	}
+	if len(args) == 2 {
+		if _, err := parseAPIRole(args[1]); err != nil || args[0] == "" || strings.ContainsAny(args[0], ":,") {
+			fmt.Fprintln(stderr, "The user must not contain ':' or ',' and the role must be read or admin")
+			return 2
+		}
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		fmt.Fprintf(stderr, "Reading stdin: %v\n", err)
+		return 1
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		fmt.Fprintln(stderr, "Empty password on stdin")
+		return 1
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		fmt.Fprintf(stderr, "Hashing failed: %v\n", err)
+		return 1
+	}
+	if len(args) == 2 {
+		fmt.Fprintf(stdout, "%s:%s:%s\n", args[0], strings.ToLower(args[1]), hash)
+		return 0
+	}
+	fmt.Fprintln(stdout, hash)
+	return 0
+}
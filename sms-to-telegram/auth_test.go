@@ -0,0 +1,292 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cheapHash is an API_USERS hash with the minimum iteration count, to keep
+// the tests fast.
+func cheapHash(t *testing.T, password string) string {
+	t.Helper()
+	salt := []byte("0123456789abcdef")
+	key, err := pbkdf2.Key(sha256.New, password, salt, 1000, passwordKeyLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("pbkdf2-sha256$1000$%s$%s", enc.EncodeToString(salt), enc.EncodeToString(key))
+}
+
+func TestParseAPIUsers(t *testing.T) {
+	hash := cheapHash(t, "pw")
+	tests := []struct {
+		name    string
+		input   string
+		want    []APIUser
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"two users", "ops:admin:" + hash + ", viewer:READ:" + hash,
+			[]APIUser{{"ops", roleAdmin, hash}, {"viewer", roleRead, hash}}, false},
+		{"unknown role", "ops:root:" + hash, nil, true},
+		{"no hash", "ops:admin", nil, true},
+		{"plain password", "ops:admin:hunter2", nil, true},
+		{"low iterations", "ops:admin:pbkdf2-sha256$10$c2FsdA$a2V5", nil, true},
+		{"duplicate", "ops:admin:" + hash + ",ops:read:" + hash, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAPIUsers(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && strings.Contains(err.Error(), "hunter2") {
+				t.Errorf("error quotes the secret: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("users = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashPasswordEntry(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := hashPasswordEntry(strings.NewReader("s3cret pass\n"), []string{"ops", "Admin"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d: %s", code, stderr.String())
+	}
+	users, err := parseAPIUsers(strings.TrimSpace(stdout.String()))
+	if err != nil || len(users) != 1 || users[0].Name != "ops" || users[0].Role != roleAdmin {
+		t.Fatalf("entry %q: %v, %v", stdout.String(), users, err)
+	}
+	if !checkPassword(users[0].Hash, "s3cret pass") || checkPassword(users[0].Hash, "s3cret") {
+		t.Error("hash does not check the password")
+	}
+
+	for _, args := range [][]string{{"ops"}, {"ops", "root"}, {"a:b", "read"}} {
+		if code := hashPasswordEntry(strings.NewReader("pw\n"), args, &stdout, &stderr); code != 2 {
+			t.Errorf("args %q: exit code = %d, want 2", args, code)
+		}
+	}
+	if code := hashPasswordEntry(strings.NewReader("\n"), nil, &stdout, &stderr); code != 1 {
+		t.Errorf("empty password: exit code = %d, want 1", code)
+	}
+}
+
+func TestAPIServer_Roles(t *testing.T) {
+	users := []APIUser{
+		{"ops", roleAdmin, cheapHash(t, "ops-pw")},
+		{"viewer", roleRead, cheapHash(t, "viewer-pw")},
+	}
+	api := newTestAPI(t, "")
+	api.auth = NewAPIAuth("s3cret", users, nil)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		auth     func(*http.Request)
+		wantCode int
+	}{
+		{"probe anonymous", http.MethodGet, "/healthz", func(*http.Request) {}, http.StatusOK},
+		{"read anonymous", http.MethodGet, "/api/v1/messages", func(*http.Request) {}, http.StatusUnauthorized},
+		{"read viewer", http.MethodGet, "/api/v1/messages", basic("viewer", "viewer-pw"), http.StatusOK},
+		{"read viewer again (cached)", http.MethodGet, "/metrics", basic("viewer", "viewer-pw"), http.StatusOK},
+		{"wrong password", http.MethodGet, "/api/v1/messages", basic("viewer", "ops-pw"), http.StatusUnauthorized},
+		{"unknown user", http.MethodGet, "/api/v1/messages", basic("root", "ops-pw"), http.StatusUnauthorized},
+		{"write viewer", http.MethodPost, "/api/v1/messages", basic("viewer", "viewer-pw"), http.StatusForbidden},
+		// Past the role check, the mux refuses the method.
+		{"write ops", http.MethodPost, "/api/v1/messages", basic("ops", "ops-pw"), http.StatusMethodNotAllowed},
+		{"write token", http.MethodPost, "/api/v1/messages", bearer("s3cret"), http.StatusMethodNotAllowed},
+		{"wrong token", http.MethodGet, "/api/v1/messages", bearer("ops-pw"), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			tt.auth(req)
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if rec.Code == http.StatusUnauthorized {
+				challenges := rec.Header().Values("WWW-Authenticate")
+				if len(challenges) != 2 || !strings.HasPrefix(challenges[0], "Basic ") || !strings.HasPrefix(challenges[1], "Bearer ") {
+					t.Errorf("challenges = %q", challenges)
+				}
+			}
+		})
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	sum := sha256.Sum256([]byte("k3y"))
+	hash := hex.EncodeToString(sum[:])
+	tests := []struct {
+		name    string
+		in      string
+		want    []apiScope
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"scopes", "nas:read:" + hash + ", hass:read+send:" + hash, []apiScope{scopeRead, scopeRead | scopeSend}, false},
+		{"admin implies all", "ci:ADMIN:" + hash, []apiScope{scopeRead | scopeSend | scopeAdmin}, false},
+		{"unknown scope", "nas:write:" + hash, nil, true},
+		{"no scope", "nas::" + hash, nil, true},
+		{"uppercase hex is fine, short is not", "nas:read:" + strings.ToUpper(hash)[2:], nil, true},
+		{"not hex", "nas:read:" + strings.Repeat("zz", 32), nil, true},
+		{"missing field", "nas:" + hash, nil, true},
+		{"duplicate", "nas:read:" + hash + ",nas:send:" + hash, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := parseAPIKeys(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAPIKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && strings.Contains(err.Error(), hash[4:20]) {
+				t.Errorf("error quotes the hash: %v", err)
+			}
+			if len(keys) != len(tt.want) {
+				t.Fatalf("got %d keys, want %d", len(keys), len(tt.want))
+			}
+			for i, k := range keys {
+				if k.Scopes != tt.want[i] || k.Hash != sum {
+					t.Errorf("key %d = %+v", i, k)
+				}
+			}
+		})
+	}
+}
+
+func TestGenAPIKey(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := genAPIKey([]string{"hass", "read+send"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d: %s", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("output:\n%s", stdout.String())
+	}
+	keys, err := parseAPIKeys(lines[3])
+	if err != nil || len(keys) != 1 || keys[0].Name != "hass" || keys[0].Hash != sha256.Sum256([]byte(lines[1])) {
+		t.Fatalf("entry %q for key %q: %+v, %v", lines[3], lines[1], keys, err)
+	}
+
+	for _, args := range [][]string{nil, {"hass"}, {"ha:ss", "read"}, {"hass", "write"}} {
+		if code := genAPIKey(args, &stdout, &stderr); code != 2 {
+			t.Errorf("genAPIKey(%q) exit code = %d, want 2", args, code)
+		}
+	}
+}
+
+func TestAPIServer_Keys(t *testing.T) {
+	keys, err := parseAPIKeys(fmt.Sprintf("nas:read:%x,hass:read+send:%x", sha256.Sum256([]byte("nas-key")), sha256.Sum256([]byte("hass-key"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := newTestAPI(t, "")
+	api.auth = NewAPIAuth("", nil, nil)
+	api.auth.SetKeys(keys)
+	header := func(key string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("X-API-Key", key) }
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		auth     func(*http.Request)
+		wantCode int
+	}{
+		{"read header", http.MethodGet, "/api/v1/messages", header("nas-key"), http.StatusOK},
+		{"read bearer", http.MethodGet, "/metrics", bearer("nas-key"), http.StatusOK},
+		{"wrong key", http.MethodGet, "/api/v1/messages", header("nas-kez"), http.StatusUnauthorized},
+		{"send read-only", http.MethodPost, "/api/v1/send", header("nas-key"), http.StatusForbidden},
+		// Past the scope check, the mux has no send form to offer.
+		{"send", http.MethodPost, "/api/v1/send", header("hass-key"), http.StatusNotFound},
+		{"inject needs admin", http.MethodPost, "/api/v1/inject", bearer("hass-key"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			tt.auth(req)
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+}
+
+func TestAPIServer_RateLimit(t *testing.T) {
+	users := []APIUser{{"viewer", roleRead, cheapHash(t, "viewer-pw")}}
+	api := newTestAPI(t, "")
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	api.auth = NewAPIAuth("s3cret", users, nil)
+	api.auth.limiter = newRateLimiter(2)
+	do := func(path, remote string, auth func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remote
+		auth(req)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Two requests a minute per caller, wherever they come from.
+	for i, remote := range []string{"10.0.0.1:1000", "10.0.0.2:1000"} {
+		if rec := do("/metrics", remote, bearer("s3cret")); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d", i, rec.Code)
+		}
+	}
+	rec := do("/metrics", "10.0.0.1:1000", bearer("s3cret"))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "30" {
+		t.Fatalf("status = %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	// Other callers and the probes are not affected.
+	if rec := do("/metrics", "10.0.0.1:1000", basic("viewer", "viewer-pw")); rec.Code != http.StatusOK {
+		t.Errorf("viewer status = %d", rec.Code)
+	}
+	if rec := do("/healthz", "10.0.0.1:1000", bearer("s3cret")); rec.Code != http.StatusOK {
+		t.Errorf("probe status = %d", rec.Code)
+	}
+
+	// Guessing: after two failures the address is refused before the
+	// password is checked, even with the right one.
+	for range 2 {
+		if rec := do("/metrics", "10.0.0.9:1000", basic("viewer", "guess")); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("guess status = %d", rec.Code)
+		}
+	}
+	if rec := do("/metrics", "10.0.0.9:1000", basic("viewer", "viewer-pw")); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status after guessing = %d, want 429", rec.Code)
+	}
+	clock.Advance(time.Minute)
+	if rec := do("/metrics", "10.0.0.9:1000", basic("viewer", "viewer-pw")); rec.Code != http.StatusOK {
+		t.Errorf("status a minute later = %d", rec.Code)
+	}
+}
+
+func basic(user, password string) func(*http.Request) {
+	return func(r *http.Request) { r.SetBasicAuth(user, password) }
+}
+
+func bearer(token string) func(*http.Request) {
+	return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+}
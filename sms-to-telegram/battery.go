@@ -0,0 +1,164 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// batteryClearMargin is the hysteresis of the low-battery alert: it clears
+// at BATTERY_ALERT_PERCENT plus this many points.
+const batteryClearMargin = 5
+
+// BatterySample is one +CBC sample.
+type BatterySample struct {
+	// OnBattery: the modem runs on its battery (charge status 0).
+	OnBattery bool `json:"on_battery"`
+	Percent   int  `json:"percent"`
+	// Millivolts is the battery voltage (SIM800); 0 if not reported.
+	Millivolts int `json:"millivolts,omitempty"`
+	// Status is the raw <bcs>.
+	Status int `json:"-"`
+}
+
+// parseCBC parses "+CBC: <bcs>,<bcl>[,<voltage>]". The charge status means
+// different things per vendor (3GPP 27.007: 1 external power, 2 no
+// battery; SIM800: 1 charging, 2 charged), but 0 is "on battery" for both.
+func parseCBC(lines []string) (BatterySample, bool) {
+	for _, line := range lines {
+		rest, ok := strings.CutPrefix(line, "+CBC:")
+		if !ok {
+			continue
+		}
+		fields := strings.Split(rest, ",")
+		if len(fields) < 2 {
+			return BatterySample{}, false
+		}
+		bcs, err1 := strconv.Atoi(strings.TrimSpace(fields[0]))
+		bcl, err2 := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err1 != nil || err2 != nil || bcs < 0 || bcs > 3 || bcl < 0 || bcl > 100 {
+			return BatterySample{}, false
+		}
+		sample := BatterySample{OnBattery: bcs == 0, Percent: bcl, Status: bcs}
+		if len(fields) >= 3 {
+			sample.Millivolts, _ = strconv.Atoi(strings.TrimSpace(fields[2]))
+		}
+		return sample, true
+	}
+	return BatterySample{}, false
+}
+
+// batteryState tracks the battery alerts. Guarded by ErrorNotifier.mu.
+type batteryState struct {
+	// external: a sample showed external power, so a switch to the battery
+	// is a real transition. Many modems are powered on VBAT without a
+	// charger and always report status 0.
+	external         bool
+	onBatteryAlerted bool
+	lowAlerted       bool
+	unsupported      bool // the modem answered ERROR to AT+CBC
+}
+
+// CheckBattery evaluates one +CBC sample (every health check). Like
+// CheckSignal it is a warning outside the error-type state machine. It
+// alerts when the modem switches from external power to its battery and
+// when the charge falls below BATTERY_ALERT_PERCENT; both clear again.
+func (n *ErrorNotifier) CheckBattery(ctx context.Context, b BatterySample) {
+	low := n.batteryAlert
+	if low <= 0 {
+		return
+	}
+
+	n.mu.Lock()
+	st := &n.battery
+	var onBattery, external, lowAlert, lowCleared bool
+	switch {
+	case b.OnBattery && st.external && !st.onBatteryAlerted:
+		st.onBatteryAlerted, onBattery = true, true
+	case !b.OnBattery:
+		st.external = true
+		if st.onBatteryAlerted {
+			st.onBatteryAlerted, external = false, true
+		}
+	}
+	// Status 2 is "no battery" (27.007) or "charged" (SIM800): the level
+	// says nothing.
+	if b.Status != 2 {
+		switch {
+		case b.Percent < low && !st.lowAlerted:
+			st.lowAlerted, lowAlert = true, true
+		case b.Percent >= low+batteryClearMargin && st.lowAlerted:
+			st.lowAlerted, lowCleared = false, true
+		}
+	}
+	n.mu.Unlock()
+
+	if onBattery {
+		slog.Warn("Modem running on battery", "percent", b.Percent, "millivolts", b.Millivolts)
+		msg := fmt.Sprintf("<b>SMS Gateway Alert</b>\n\n"+
+			"<b>Host:</b> %s\n"+
+			"<b>Warning:</b> External power lost, running on battery (%d%%)\n\n"+
+			"<i>The gateway stops when the battery is empty. Check the power supply.</i>",
+			n.hostHTML(), b.Percent)
+		if err := n.sendToTelegram(ctx, msg); err != nil {
+			slog.Error("Failed to send on-battery alert", "error", err)
+			// Re-arm so the alert is retried on the next sample.
+			n.mu.Lock()
+			n.battery.onBatteryAlerted = false
+			n.mu.Unlock()
+		}
+	}
+	if external {
+		slog.Info("Modem back on external power", "percent", b.Percent)
+		msg := fmt.Sprintf("<b>SMS Gateway Recovered</b>\n\n"+
+			"<b>Host:</b> %s\n"+
+			"<b>Status:</b> External power restored (battery %d%%)",
+			n.hostHTML(), b.Percent)
+		if err := n.sendToTelegram(ctx, msg); err != nil {
+			slog.Error("Failed to send power recovery notification", "error", err)
+		}
+	}
+	if lowAlert {
+		slog.Warn("Battery below threshold", "percent", b.Percent, "threshold", low, "millivolts", b.Millivolts)
+		msg := fmt.Sprintf("<b>SMS Gateway Alert</b>\n\n"+
+			"<b>Host:</b> %s\n"+
+			"<b>Warning:</b> Low battery: %d%%, below %d%%\n\n"+
+			"<i>The gateway stops when the battery is empty.</i>",
+			n.hostHTML(), b.Percent, low)
+		if err := n.sendToTelegram(ctx, msg); err != nil {
+			slog.Error("Failed to send low battery alert", "error", err)
+			n.mu.Lock()
+			n.battery.lowAlerted = false
+			n.mu.Unlock()
+		}
+	}
+	if lowCleared {
+		slog.Info("Battery recovered", "percent", b.Percent)
+		msg := fmt.Sprintf("<b>SMS Gateway Recovered</b>\n\n"+
+			"<b>Host:</b> %s\n"+
+			"<b>Status:</b> Battery back to %d%%",
+			n.hostHTML(), b.Percent)
+		if err := n.sendToTelegram(ctx, msg); err != nil {
+			slog.Error("Failed to send battery recovery notification", "error", err)
+		}
+	}
+}
+
+// batteryUnsupported stops the AT+CBC sampling for the rest of the run.
+func (n *ErrorNotifier) batteryUnsupported() {
+	n.mu.Lock()
+	n.battery.unsupported = true
+	n.mu.Unlock()
+	slog.Info("Modem does not report its battery (AT+CBC) - battery monitoring off")
+}
+
+func (n *ErrorNotifier) batterySupported() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return !n.battery.unsupported
+}
@@ -0,0 +1,117 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+func TestParseCBC(t *testing.T) {
+	tests := []struct {
+		name   string
+		lines  []string
+		want   BatterySample
+		wantOK bool
+	}{
+		{"SIM800", []string{"+CBC: 0,85,3998", "OK"}, BatterySample{OnBattery: true, Percent: 85, Millivolts: 3998}, true},
+		{"27.007 external", []string{"+CBC: 1,100"}, BatterySample{Percent: 100, Status: 1}, true},
+		{"charged", []string{"+CBC:2,100,4190"}, BatterySample{Percent: 100, Millivolts: 4190, Status: 2}, true},
+		{"level out of range", []string{"+CBC: 0,150,3998"}, BatterySample{}, false},
+		{"unknown status", []string{"+CBC: 7,50"}, BatterySample{}, false},
+		{"one field", []string{"+CBC: 0"}, BatterySample{}, false},
+		{"no response", []string{"OK"}, BatterySample{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseCBC(tt.lines)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseCBC(%q) = %+v, %v; want %+v, %v", tt.lines, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// TestCheckBattery: on battery only alerts after external power was seen,
+// the low alert fires once and clears above the hysteresis margin, and a
+// charged (status 2) level is ignored.
+func TestCheckBattery(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	sender := &fakeSender{}
+	notifier := NewErrorNotifier(sender, []int64{1}, false, "gw1", time.Second)
+	notifier.batteryAlert = 20
+	ctx := context.Background()
+
+	steps := []struct {
+		sample   BatterySample
+		wantSent int
+		want     string
+	}{
+		{BatterySample{OnBattery: true, Percent: 90}, 0, ""}, // powered on VBAT: no transition
+		{BatterySample{Percent: 90, Status: 1}, 0, ""},
+		{BatterySample{OnBattery: true, Percent: 88}, 1, "running on battery (88%)"},
+		{BatterySample{OnBattery: true, Percent: 30}, 1, ""},
+		{BatterySample{OnBattery: true, Percent: 19}, 2, "Low battery: 19%, below 20%"},
+		{BatterySample{OnBattery: true, Percent: 15}, 2, ""},
+		{BatterySample{Percent: 22, Status: 1}, 3, "External power restored (battery 22%)"}, // inside the margin
+		{BatterySample{Percent: 25, Status: 1}, 4, "Battery back to 25%"},
+		{BatterySample{Percent: 0, Status: 2}, 4, ""}, // no battery
+	}
+	for i, step := range steps {
+		notifier.CheckBattery(ctx, step.sample)
+		sent := sender.sentTo(1)
+		if len(sent) != step.wantSent {
+			t.Fatalf("step %d (%+v): %d messages, want %d", i, step.sample, len(sent), step.wantSent)
+		}
+		if step.want != "" && !strings.Contains(sent[len(sent)-1].Text, step.want) {
+			t.Errorf("step %d: message = %q, want %q", i, sent[len(sent)-1].Text, step.want)
+		}
+		if i == 5 {
+			if alerts := strings.Join(notifier.ActiveAlerts(), ", "); alerts != "On Battery, Low Battery" {
+				t.Errorf("ActiveAlerts() = %q", alerts)
+			}
+		}
+	}
+}
+
+func TestReportBattery(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	notifier := NewErrorNotifier(nil, nil, true, "gw1", time.Second)
+	notifier.metrics = NewMetrics()
+	modem := newFakeAT()
+	modem.on("AT+CBC", []string{"+CBC: 0,85,3998", "OK"}, nil)
+	reportBattery(context.Background(), modem, notifier)
+	body := scrapeMetrics(t, notifier.metrics)
+	for _, want := range []string{
+		"sms_to_telegram_battery_percent 85\n",
+		"sms_to_telegram_on_battery 1\n",
+		"sms_to_telegram_battery_volts 3.998\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+
+	notifier = NewErrorNotifier(nil, nil, true, "gw1", time.Second)
+	notifier.batteryAlert = 20
+	modem = newFakeAT()
+	modem.on("AT+CBC", nil, at.ErrModemError)
+
+	reportBattery(context.Background(), modem, notifier)
+	reportBattery(context.Background(), modem, notifier)
+	if got := modem.commandCount("AT+CBC"); got != 1 {
+		t.Errorf("AT+CBC sent %d times, want 1 (unsupported after ERROR)", got)
+	}
+
+	// Without alerts or metrics nothing is sampled.
+	modem = newFakeAT()
+	reportBattery(context.Background(), modem, NewErrorNotifier(nil, nil, true, "gw1", time.Second))
+	if len(modem.calls) != 0 {
+		t.Errorf("commands = %q, want none", modem.calls)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// blocklistFileName is the runtime denylist inside STATE_DIR: one sender per
+// line, so it stays readable and hand-editable while the service is stopped.
+const blocklistFileName = "blocked_senders.txt"
+
+// SenderBlocklist is the sender denylist: static entries from BLOCKED_SENDERS
+// plus runtime entries managed via /block and /unblock. Runtime entries are
+// persisted to STATE_DIR when configured (in-memory only otherwise).
+//
+// Safe for concurrent use: bot commands mutate it from the update goroutine
+// while the poll loop reads it.
+type SenderBlocklist struct {
+	mu      sync.Mutex
+	static  map[string]struct{}
+	runtime map[string]struct{}
+	path    string // empty: runtime entries are not persisted
+}
+
+// normalizeSender canonicalizes a sender for denylist matching: phone numbers
+// compare by digits only ("+49 170-123" matches "49170123"), alphanumeric
+// sender IDs case-insensitively.
+func normalizeSender(s string) string {
+	s = strings.TrimSpace(s)
+	digits := make([]rune, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = append(digits, r)
+		case r == '+' || r == ' ' || r == '-' || r == '(' || r == ')':
+		default:
+			return strings.ToLower(s)
+		}
+	}
+	if len(digits) == 0 {
+		return strings.ToLower(s)
+	}
+	return string(digits)
+}
+
+// NewSenderBlocklist builds the denylist from static entries and, when
+// stateDir is set, loads the persisted runtime entries.
+func NewSenderBlocklist(static []string, stateDir string) (*SenderBlocklist, error) {
+	b := &SenderBlocklist{
+		static:  make(map[string]struct{}),
+		runtime: make(map[string]struct{}),
+	}
+	for _, s := range static {
+		if key := normalizeSender(s); key != "" {
+			b.static[key] = struct{}{}
+		}
+	}
+	if stateDir == "" {
+		return b, nil
+	}
+
+	b.path = filepath.Join(stateDir, blocklistFileName)
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading blocklist: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		b.runtime[normalizeSender(line)] = struct{}{}
+	}
+	slog.Info("Loaded sender blocklist", "static", len(b.static), "runtime", len(b.runtime))
+	return b, nil
+}
+
+// SetStatic replaces the BLOCKED_SENDERS entries (configuration reload);
+// runtime entries are kept. Nil-safe.
+func (b *SenderBlocklist) SetStatic(static []string) {
+	if b == nil {
+		return
+	}
+	entries := make(map[string]struct{}, len(static))
+	for _, s := range static {
+		if key := normalizeSender(s); key != "" {
+			entries[key] = struct{}{}
+		}
+	}
+	b.mu.Lock()
+	b.static = entries
+	b.mu.Unlock()
+}
+
+// Blocked reports whether SMS from sender must be dropped. A nil blocklist
+// and an empty sender (undecodable PDU) never match.
+func (b *SenderBlocklist) Blocked(sender string) bool {
+	if b == nil {
+		return false
+	}
+	key := normalizeSender(sender)
+	if key == "" {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, isStatic := b.static[key]
+	_, isRuntime := b.runtime[key]
+	return isStatic || isRuntime
+}
+
+// Block adds a runtime entry. Returns false when the sender was already
+// blocked (statically or at runtime).
+func (b *SenderBlocklist) Block(sender string) (bool, error) {
+	key := normalizeSender(sender)
+	if key == "" {
+		return false, fmt.Errorf("empty sender")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.static[key]; ok {
+		return false, nil
+	}
+	if _, ok := b.runtime[key]; ok {
+		return false, nil
+	}
+	b.runtime[key] = struct{}{}
+	if err := b.saveLocked(); err != nil {
+		delete(b.runtime, key)
+		return false, err
+	}
+	return true, nil
+}
+
+// errStaticBlock marks an /unblock of an entry that comes from BLOCKED_SENDERS
+// and can only be removed by changing the configuration.
+var errStaticBlock = errors.New("sender is blocked via BLOCKED_SENDERS configuration")
+
+// Unblock removes a runtime entry. Returns false when the sender was not
+// blocked at runtime.
+func (b *SenderBlocklist) Unblock(sender string) (bool, error) {
+	key := normalizeSender(sender)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.runtime[key]; !ok {
+		if _, isStatic := b.static[key]; isStatic {
+			return false, errStaticBlock
+		}
+		return false, nil
+	}
+	delete(b.runtime, key)
+	if err := b.saveLocked(); err != nil {
+		b.runtime[key] = struct{}{}
+		return false, err
+	}
+	return true, nil
+}
+
+// Entries returns the sorted static and runtime entries.
+func (b *SenderBlocklist) Entries() (static, runtime []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for k := range b.static {
+		static = append(static, k)
+	}
+	for k := range b.runtime {
+		runtime = append(runtime, k)
+	}
+	sort.Strings(static)
+	sort.Strings(runtime)
+	return static, runtime
+}
+
+// Persistent reports whether runtime changes survive a restart.
+func (b *SenderBlocklist) Persistent() bool { return b.path != "" }
+
+// saveLocked writes the runtime entries atomically (temp file + rename), so a
+// crash mid-write never leaves a truncated denylist behind.
+func (b *SenderBlocklist) saveLocked() error {
+	if b.path == "" {
+		return nil
+	}
+	entries := make([]string, 0, len(b.runtime))
+	for k := range b.runtime {
+		entries = append(entries, k)
+	}
+	sort.Strings(entries)
+	var sb strings.Builder
+	sb.WriteString("# Managed by /block and /unblock; one sender per line.\n")
+	for _, e := range entries {
+		sb.WriteString(e)
+		sb.WriteByte('\n')
+	}
+	return writeFileAtomic(b.path, []byte(sb.String()), 0o600)
+}
+
+// writeFileAtomic replaces path with data via a temp file in the same
+// directory and a rename.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
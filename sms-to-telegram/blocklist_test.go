@@ -0,0 +1,142 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeSender(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"+49 170-123", "49170123"},
+		{"49170123", "49170123"},
+		{"(0049) 170 123", "0049170123"},
+		{"Google", "google"},
+		{" MyBank ", "mybank"},
+		{"900", "900"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeSender(tt.in); got != tt.want {
+			t.Errorf("normalizeSender(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSenderBlocklist_BlockUnblock(t *testing.T) {
+	bl, err := NewSenderBlocklist([]string{"Spam"}, "")
+	if err != nil {
+		t.Fatalf("NewSenderBlocklist() error = %v", err)
+	}
+
+	if !bl.Blocked("SPAM") {
+		t.Error("static entry must match case-insensitively")
+	}
+	if bl.Blocked("") {
+		t.Error("empty sender must never be blocked")
+	}
+	if bl.Blocked("+900123") {
+		t.Error("unblocked sender reported as blocked")
+	}
+
+	if added, err := bl.Block("900123"); err != nil || !added {
+		t.Fatalf("Block() = %v, %v; want true, nil", added, err)
+	}
+	if !bl.Blocked("+900123") {
+		t.Error("runtime entry must match regardless of the leading +")
+	}
+	if added, _ := bl.Block("+900 123"); added {
+		t.Error("re-blocking an equivalent number must report already blocked")
+	}
+
+	if removed, err := bl.Unblock("+900123"); err != nil || !removed {
+		t.Fatalf("Unblock() = %v, %v; want true, nil", removed, err)
+	}
+	if bl.Blocked("900123") {
+		t.Error("sender still blocked after Unblock")
+	}
+	if removed, err := bl.Unblock("900123"); err != nil || removed {
+		t.Errorf("second Unblock() = %v, %v; want false, nil", removed, err)
+	}
+
+	// Static entries can only be removed via configuration.
+	if _, err := bl.Unblock("spam"); !errors.Is(err, errStaticBlock) {
+		t.Errorf("Unblock(static) error = %v, want errStaticBlock", err)
+	}
+
+	var nilList *SenderBlocklist
+	if nilList.Blocked("anything") {
+		t.Error("nil blocklist must block nothing")
+	}
+}
+
+func TestSenderBlocklist_Persistence(t *testing.T) {
+	dir := t.TempDir()
+	bl, err := NewSenderBlocklist(nil, dir)
+	if err != nil {
+		t.Fatalf("NewSenderBlocklist() error = %v", err)
+	}
+	if !bl.Persistent() {
+		t.Fatal("blocklist with STATE_DIR must be persistent")
+	}
+	for _, s := range []string{"+111", "Promo"} {
+		if _, err := bl.Block(s); err != nil {
+			t.Fatalf("Block(%q) error = %v", s, err)
+		}
+	}
+	if _, err := bl.Unblock("111"); err != nil {
+		t.Fatalf("Unblock() error = %v", err)
+	}
+
+	path := filepath.Join(dir, blocklistFileName)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("blocklist file not written: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("blocklist file mode = %o, want 600", perm)
+	}
+
+	reloaded, err := NewSenderBlocklist(nil, dir)
+	if err != nil {
+		t.Fatalf("reload error = %v", err)
+	}
+	if !reloaded.Blocked("PROMO") {
+		t.Error("persisted entry lost after reload")
+	}
+	if reloaded.Blocked("+111") {
+		t.Error("unblocked entry resurrected after reload")
+	}
+
+	// No temp files left behind by the atomic writes.
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			t.Errorf("leftover temp file %q", e.Name())
+		}
+	}
+}
+
+func TestSenderBlocklist_WriteFailureRollsBack(t *testing.T) {
+	dir := t.TempDir()
+	bl, err := NewSenderBlocklist(nil, dir)
+	if err != nil {
+		t.Fatalf("NewSenderBlocklist() error = %v", err)
+	}
+	// Point the blocklist into a directory that does not exist.
+	bl.path = filepath.Join(dir, "missing", blocklistFileName)
+
+	if _, err := bl.Block("+222"); err == nil {
+		t.Fatal("Block() must report the persistence failure")
+	}
+	if bl.Blocked("+222") {
+		t.Error("entry applied in memory although it could not be persisted")
+	}
+}
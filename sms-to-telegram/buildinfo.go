@@ -0,0 +1,107 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, set by the release builds:
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD) \
+//	  -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// A plain `go build` in a git checkout still gets commit and date from the
+// VCS stamp of the Go toolchain.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Version   string
+	Commit    string
+	Date      string
+	GoVersion string
+	// Modified is set when the binary was built from a dirty checkout
+	// (VCS stamp only).
+	Modified bool
+}
+
+// currentBuildInfo merges the ldflags values with the VCS stamp.
+func currentBuildInfo() BuildInfo {
+	info := BuildInfo{Version: version, Commit: commit, Date: buildDate, GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	stamped := info.Commit == ""
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if stamped {
+				info.Commit = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = stamped && s.Value == "true"
+		case "vcs.time":
+			if info.Date == "" {
+				info.Date = s.Value
+			}
+		}
+	}
+	return info
+}
+
+// ShortCommit is the commit abbreviated like `git log --oneline`.
+func (b BuildInfo) ShortCommit() string {
+	if len(b.Commit) > 7 {
+		return b.Commit[:7]
+	}
+	return b.Commit
+}
+
+// String is the --version line:
+// "sms-to-telegram 1.2.0 (commit 894ff69, built 2026-10-15T09:00:00Z, go1.25.1)".
+func (b BuildInfo) String() string {
+	s := "sms-to-telegram " + b.Version + " ("
+	if b.Commit != "" {
+		s += "commit " + b.ShortCommit()
+		if b.Modified {
+			s += "-dirty"
+		}
+		s += ", "
+	}
+	if b.Date != "" {
+		s += "built " + b.Date + ", "
+	}
+	return s + b.GoVersion + ")"
+}
+
+// writeBuildInfoMetric writes the build_info gauge, constant 1 with the
+// build as labels (the Prometheus convention for version info).
+func writeBuildInfoMetric(m metricsOutput, b BuildInfo) {
+	m.gauge("sms_to_telegram_build_info", "Build information of the running binary.",
+		1, "version", b.Version, "commit", b.Commit, "build_date", b.Date, "goversion", b.GoVersion)
+}
+
+// startupMessage is the STARTUP_NOTIFY message; host is HTML
+// (ErrorNotifier.hostHTML).
+func startupMessage(host string, b BuildInfo) string {
+	msg := fmt.Sprintf("<b>SMS Gateway Started</b>\n\n"+
+		"<b>Host:</b> %s\n"+
+		"<b>Version:</b> <code>%s</code>",
+		host, escapeHTML(b.Version))
+	if b.Commit != "" {
+		msg += "\n<b>Commit:</b> <code>" + escapeHTML(b.ShortCommit()) + "</code>"
+	}
+	if b.Date != "" {
+		msg += "\n<b>Built:</b> " + escapeHTML(b.Date)
+	}
+	return msg
+}
@@ -0,0 +1,105 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildInfo_String(t *testing.T) {
+	tests := []struct {
+		name string
+		info BuildInfo
+		want string
+	}{
+		{
+			name: "release",
+			info: BuildInfo{Version: "1.2.0", Commit: "894ff69e0a1b2c3d", Date: "2026-10-15T09:00:00Z", GoVersion: "go1.25.1"},
+			want: "sms-to-telegram 1.2.0 (commit 894ff69, built 2026-10-15T09:00:00Z, go1.25.1)",
+		},
+		{
+			name: "dirty checkout",
+			info: BuildInfo{Version: "dev", Commit: "894ff69e0a1b2c3d", Modified: true, GoVersion: "go1.25.1"},
+			want: "sms-to-telegram dev (commit 894ff69-dirty, go1.25.1)",
+		},
+		{
+			name: "no build information",
+			info: BuildInfo{Version: "dev", GoVersion: "go1.25.1"},
+			want: "sms-to-telegram dev (go1.25.1)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrentBuildInfo_LdflagsWin(t *testing.T) {
+	defer func(v, c, d string) { version, commit, buildDate = v, c, d }(version, commit, buildDate)
+	version, commit, buildDate = "1.2.0", "abcdef0123", "2026-10-15T09:00:00Z"
+
+	got := currentBuildInfo()
+	if got.Version != "1.2.0" || got.Commit != "abcdef0123" || got.Date != "2026-10-15T09:00:00Z" || got.Modified {
+		t.Errorf("currentBuildInfo() = %+v", got)
+	}
+	if !strings.HasPrefix(got.GoVersion, "go") {
+		t.Errorf("GoVersion = %q", got.GoVersion)
+	}
+}
+
+func TestNotifyStartup(t *testing.T) {
+	sender := &fakeSender{}
+	notifier := NewErrorNotifier(sender, []int64{1, 2}, false, "gw<1>", 5*time.Second)
+	notifier.NotifyStartup(context.Background(), BuildInfo{Version: "1.2.0", Commit: "894ff69e0a1b", Date: "2026-10-15T09:00:00Z"})
+
+	for _, chatID := range []int64{1, 2} {
+		sent := sender.sentTo(chatID)
+		if len(sent) != 1 {
+			t.Fatalf("chat %d: %d messages, want 1", chatID, len(sent))
+		}
+		for _, want := range []string{"SMS Gateway Started", "<code>gw&lt;1&gt;</code>", "<code>1.2.0</code>", "<code>894ff69</code>", "2026-10-15T09:00:00Z"} {
+			if !strings.Contains(sent[0].Text, want) {
+				t.Errorf("chat %d: message lacks %q:\n%s", chatID, want, sent[0].Text)
+			}
+		}
+	}
+}
+
+func TestAPIServer_Metrics(t *testing.T) {
+	defer func(v, c, d string) { version, commit, buildDate = v, c, d }(version, commit, buildDate)
+	version, commit, buildDate = "1.2.0", "abc\"def", "2026-10-15T09:00:00Z"
+
+	api := NewAPIServer(nil, NewHealthState(nil), NewAPIAuth("s3cret", nil, nil))
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous /metrics: status = %d, want 401", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != metricsContentType {
+		t.Fatalf("status = %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE sms_to_telegram_build_info gauge\n",
+		`sms_to_telegram_build_info{version="1.2.0",commit="abc\"def",build_date="2026-10-15T09:00:00Z",goversion="go`,
+		"\"} 1\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+// Incoming call handling (CALL_REJECT). Nobody is meant to call the SIM of
+// an SMS gateway, but a caller rings it until the network diverts the call
+// to voicemail, which some tariffs charge for. With "hangup" a ringing call
+// is hung up (ATH) as soon as the modem reports it; with "busy" the modem
+// rejects calls by itself (SIM800 AT+GSMBUSY=1) and the gateway hangs up
+// whatever still rings. Every call the modem reports is notified with the
+// caller's number (+CLIP).
+const (
+	callRejectOff    = "off"
+	callRejectHangup = "hangup"
+	callRejectBusy   = "busy"
+)
+
+// callRejecter hangs up incoming calls. Created in run(); used by the
+// modem goroutine only (its urc runs inside the session's reads). Nil-safe:
+// a nil rejecter leaves calls alone.
+type callRejecter struct {
+	mode   string
+	dryRun bool
+	// charset decodes the caller's number (AT+CSCS of the session).
+	charset string
+	// ringing: RING or +CLIP arrived since the last hangup; caller is the
+	// +CLIP number ("withheld"), "" until it arrives.
+	ringing bool
+	caller  string
+}
+
+func newCallRejecter(mode string, dryRun bool) *callRejecter {
+	if mode == callRejectOff {
+		return nil
+	}
+	return &callRejecter{mode: mode, dryRun: dryRun}
+}
+
+// start enables the caller ID and, with busy, the modem's own call
+// rejection for a new session. Only a transport error is returned; a modem
+// that refuses AT+GSMBUSY gets its calls hung up instead.
+func (c *callRejecter) start(modem ATCommander, charset string) error {
+	if c == nil {
+		return nil
+	}
+	c.charset, c.ringing, c.caller = charset, false, ""
+	if _, err := modem.Command("AT+CLIP=1"); at.IsTimeoutError(err) {
+		return err
+	} else if err != nil {
+		slog.Warn("Caller ID (AT+CLIP) not available", "error", err)
+	}
+	if c.mode != callRejectBusy {
+		return nil
+	}
+	if _, err := modem.Command("AT+GSMBUSY=1"); at.IsTimeoutError(err) {
+		return err
+	} else if err != nil {
+		slog.Warn("AT+GSMBUSY refused - hanging up incoming calls instead", "error", err)
+		c.mode = callRejectHangup
+	}
+	return nil
+}
+
+// urc takes the session's URCs (at.SimpleAT.OnURC). Nil-safe.
+func (c *callRejecter) urc(line string) {
+	if c == nil {
+		return
+	}
+	if line == "RING" {
+		c.ringing = true
+	} else if strings.HasPrefix(line, "+CLIP:") {
+		c.ringing = true
+		c.caller = "withheld"
+		if number := parseCLIP(line); number != "" {
+			c.caller = decodeTEString(number, c.charset)
+		}
+	}
+}
+
+// handle hangs up a ringing call and notifies it. Runs between the modem
+// loop's events. Only a transport error is returned.
+func (c *callRejecter) handle(ctx context.Context, modem ATCommander, notifier *ErrorNotifier) error {
+	if c == nil || !c.ringing {
+		return nil
+	}
+	caller := c.caller
+	c.ringing, c.caller = false, ""
+	if caller == "" {
+		caller = "unknown"
+	}
+
+	result := "rejected"
+	if c.dryRun {
+		slog.Info("DRY_RUN: Would hang up incoming call", "from", caller)
+		result = "not rejected (DRY_RUN)"
+	} else if _, err := modem.Command("ATH"); at.IsTimeoutError(err) {
+		return err
+	} else if err != nil {
+		slog.Warn("Hanging up incoming call failed", "from", caller, "error", err)
+		result = "hang-up failed"
+	} else {
+		slog.Info("Incoming call rejected", "from", caller)
+	}
+
+	msg := fmt.Sprintf("<b>SMS Gateway Incoming Call</b>\n\n"+
+		"<b>Host:</b> %s\n"+
+		"%s"+
+		"<b>Call:</b> %s",
+		notifier.hostHTML(), formatFrom(caller), escapeHTML(result))
+	if err := notifier.sendToTelegram(ctx, msg); err != nil {
+		slog.Error("Failed to send incoming call notification", "error", err)
+	}
+	return nil
+}
+
+// parseCLIP extracts the number of `+CLIP: "<number>",<type>,...`; "" for a
+// withheld number.
+func parseCLIP(line string) string {
+	rest := strings.TrimSpace(strings.TrimPrefix(line, "+CLIP:"))
+	number, _, _ := strings.Cut(rest, ",")
+	return strings.Trim(strings.TrimSpace(number), `"`)
+}
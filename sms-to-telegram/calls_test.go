@@ -0,0 +1,138 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+func TestCallRejecterHandle(t *testing.T) {
+	tests := []struct {
+		name    string
+		dryRun  bool
+		urcs    []string
+		hangup  error
+		wantErr error
+		// wantAlert is matched in the notification, "" for none.
+		wantAlert  string
+		wantHangup bool
+	}{
+		{
+			name:       "caller ID",
+			urcs:       []string{"RING", `+CLIP: "+491701234567",145,"",0,"",0`},
+			wantAlert:  "<code>+491701234567</code>\n<b>Call:</b> rejected",
+			wantHangup: true,
+		},
+		{
+			name:       "withheld number",
+			urcs:       []string{"RING", `+CLIP: "",128,"",0,"",0`},
+			wantAlert:  "<code>withheld</code>",
+			wantHangup: true,
+		},
+		{
+			name:       "RING only",
+			urcs:       []string{"RING"},
+			wantAlert:  "<code>unknown</code>",
+			wantHangup: true,
+		},
+		{
+			name: "no call",
+			urcs: []string{"+CMTI: \"SM\",3"},
+		},
+		{
+			name:       "hang-up refused",
+			urcs:       []string{"RING"},
+			hangup:     at.ErrModemError,
+			wantAlert:  "hang-up failed",
+			wantHangup: true,
+		},
+		{
+			name:       "transport error",
+			urcs:       []string{"RING"},
+			hangup:     at.ErrModemTimeout,
+			wantErr:    at.ErrModemTimeout,
+			wantHangup: true,
+		},
+		{
+			name:      "dry run",
+			dryRun:    true,
+			urcs:      []string{"RING"},
+			wantAlert: "not rejected (DRY_RUN)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeAT()
+			f.on("ATH", nil, tt.hangup)
+			sender := &fakeSender{}
+			notifier := NewErrorNotifier(sender, []int64{1}, false, "gw1", time.Second)
+			c := newCallRejecter(callRejectHangup, tt.dryRun)
+			if err := c.start(f, ""); err != nil {
+				t.Fatalf("start() error = %v", err)
+			}
+			for _, line := range tt.urcs {
+				c.urc(line)
+			}
+
+			if err := c.handle(context.Background(), f, notifier); !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("handle() error = %v, want %v", err, tt.wantErr)
+			}
+			if hungUp := f.commandCount("ATH") == 1; hungUp != tt.wantHangup {
+				t.Errorf("calls = %q, hung up %v, want %v", f.calls, hungUp, tt.wantHangup)
+			}
+			msgs := sender.sentTo(1)
+			if tt.wantAlert == "" && len(msgs) != 0 || tt.wantAlert != "" && (len(msgs) != 1 || !strings.Contains(msgs[0].Text, tt.wantAlert)) {
+				t.Errorf("notifications = %+v, want %q", msgs, tt.wantAlert)
+			}
+
+			// One call is handled once.
+			if err := c.handle(context.Background(), f, notifier); err != nil || f.commandCount("ATH") > 1 {
+				t.Errorf("second handle() = %v, ATH sent %d times", err, f.commandCount("ATH"))
+			}
+		})
+	}
+}
+
+func TestCallRejecterStart(t *testing.T) {
+	f := newFakeAT()
+	f.on("AT+GSMBUSY=1", nil, at.ErrModemError)
+	c := newCallRejecter(callRejectBusy, false)
+	if err := c.start(f, ""); err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+	if f.commandCount("AT+CLIP=1") != 1 || c.mode != callRejectHangup {
+		t.Errorf("calls = %q, mode %q; want caller ID and a fallback to hangup", f.calls, c.mode)
+	}
+
+	f = newFakeAT()
+	f.on("AT+CLIP=1", nil, at.ErrModemTimeout)
+	if err := newCallRejecter(callRejectHangup, false).start(f, ""); !errors.Is(err, at.ErrModemTimeout) {
+		t.Errorf("start() error = %v, want timeout", err)
+	}
+
+	var none *callRejecter
+	none.urc("RING")
+	if newCallRejecter(callRejectOff, false) != nil || none.start(nil, "") != nil || none.handle(context.Background(), nil, nil) != nil {
+		t.Error("nil rejecter is active")
+	}
+}
+
+func TestParseCLIP(t *testing.T) {
+	for line, want := range map[string]string{
+		`+CLIP: "+491701234567",145,"",0,"",0`: "+491701234567",
+		`+CLIP: "0301234567",129`:              "0301234567",
+		`+CLIP: "",128,"",0,"",0`:              "",
+		"+CLIP:":                               "",
+	} {
+		if got := parseCLIP(line); got != want {
+			t.Errorf("parseCLIP(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
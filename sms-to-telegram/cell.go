@@ -0,0 +1,182 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+// Cell tracking levels (CELL_TRACKING).
+const (
+	cellTrackingOff       = "off"
+	cellTrackingServing   = "serving"
+	cellTrackingNeighbors = "neighbors"
+)
+
+// cellHistorySize keeps the last serving-cell changes for GET /api/v1/cells.
+const cellHistorySize = 100
+
+// CellChange is one serving-cell change, or the first cell of the run.
+type CellChange struct {
+	Time   time.Time `json:"time"`
+	LAC    string    `json:"lac"`
+	CellID string    `json:"cell_id"`
+	// From is the "LAC/CI" of the cell left; empty for the first cell.
+	From string `json:"from,omitempty"`
+}
+
+// cellTracker follows the serving cell on the health tick (CELL_TRACKING),
+// so SMS that went missing can be correlated with handovers. Created in
+// run(); used by the modem goroutine only. Nil-safe: a nil tracker tracks
+// nothing.
+type cellTracker struct {
+	// neighbors: also log the neighbor cells (until the modem refuses).
+	neighbors bool
+	metrics   *Metrics
+	// lac, ci and since are the serving cell, kept across sessions.
+	lac, ci string
+	since   time.Time
+}
+
+func newCellTracker(mode string, metrics *Metrics) *cellTracker {
+	if mode == cellTrackingOff {
+		return nil
+	}
+	return &cellTracker{neighbors: mode == cellTrackingNeighbors, metrics: metrics}
+}
+
+// sample queries the serving cell and, with neighbors, the neighbor cells
+// (best effort). AT+CREG=2 adds the location to the answer, but also sends
+// +CREG URCs on every change, which the AT session does not know; it is
+// only on around the query.
+func (c *cellTracker) sample(modem ATCommander) {
+	if c == nil {
+		return
+	}
+	if _, err := modem.Command("AT+CREG=2"); err != nil {
+		slog.Debug("Serving cell query failed", "error", err)
+		return
+	}
+	resp, err := modem.Command("AT+CREG?")
+	modem.Command("AT+CREG=0")
+	if err == nil {
+		if lac, ci, ok := parseCREGCell(resp); ok {
+			c.serving(lac, ci)
+		}
+	}
+	if c.neighbors {
+		c.sampleNeighbors(modem)
+	}
+}
+
+// serving records a serving-cell sample.
+func (c *cellTracker) serving(lac, ci string) {
+	if lac == c.lac && ci == c.ci {
+		return
+	}
+	now := clk.Now()
+	change := CellChange{Time: now, LAC: lac, CellID: ci}
+	if c.ci == "" {
+		slog.Info("Serving cell", "lac", lac, "cell_id", ci)
+	} else {
+		change.From = c.lac + "/" + c.ci
+		slog.Info("Serving cell changed", "lac", lac, "cell_id", ci,
+			"from", change.From, "after", now.Sub(c.since).Truncate(time.Second))
+	}
+	c.lac, c.ci, c.since = lac, ci, now
+	c.metrics.CellChanged(change)
+}
+
+// sampleNeighbors logs the neighbor cells of a SIM800 engineering-mode
+// report (AT+CENG=1,1: no URCs, neighbor cell IDs included).
+func (c *cellTracker) sampleNeighbors(modem ATCommander) {
+	if _, err := modem.Command("AT+CENG=1,1"); err != nil {
+		if at.IsModemError(err) {
+			c.neighbors = false
+			slog.Info("Modem does not report neighbor cells (AT+CENG) - neighbor logging off")
+		}
+		return
+	}
+	resp, err := modem.Command("AT+CENG?")
+	modem.Command("AT+CENG=0")
+	if err != nil {
+		return
+	}
+	var cells []string
+	for _, n := range parseCENGNeighbors(resp) {
+		cells = append(cells, fmt.Sprintf("%s/%s %d dBm", n.LAC, n.CellID, n.DBm))
+	}
+	slog.Info("Neighbor cells", "serving", c.lac+"/"+c.ci, "cells", strings.Join(cells, ", "))
+}
+
+// parseCREGCell extracts the location of an AT+CREG=2 answer,
+// "+CREG: 2,<stat>,"<lac>","<ci>"[,<AcT>]"; not ok while not registered.
+func parseCREGCell(lines []string) (lac, ci string, ok bool) {
+	for _, line := range lines {
+		rest, found := strings.CutPrefix(line, "+CREG:")
+		if !found {
+			continue
+		}
+		fields := strings.Split(rest, ",")
+		if len(fields) < 4 {
+			return "", "", false
+		}
+		lac = strings.ToUpper(strings.Trim(strings.TrimSpace(fields[2]), `"`))
+		ci = strings.ToUpper(strings.Trim(strings.TrimSpace(fields[3]), `"`))
+		if !isHex(lac) || !isHex(ci) {
+			return "", "", false
+		}
+		return lac, ci, true
+	}
+	return "", "", false
+}
+
+// neighborCell is one neighbor of an AT+CENG report.
+type neighborCell struct {
+	LAC, CellID string
+	DBm         int
+}
+
+// parseCENGNeighbors extracts the neighbor cells of a SIM800 AT+CENG?
+// answer: `+CENG: <n>,"<arfcn>,<rxl>,<bsic>,<cellid>,<mcc>,<mnc>,<lac>"`
+// for n >= 1 (0 is the serving cell). Empty slots are skipped.
+func parseCENGNeighbors(lines []string) []neighborCell {
+	var cells []neighborCell
+	for _, line := range lines {
+		rest, found := strings.CutPrefix(line, "+CENG:")
+		if !found {
+			continue
+		}
+		n, quoted, found := strings.Cut(rest, ",")
+		if num, err := strconv.Atoi(strings.TrimSpace(n)); !found || err != nil || num < 1 {
+			continue
+		}
+		fields := strings.Split(strings.Trim(strings.TrimSpace(quoted), `"`), ",")
+		if len(fields) != 7 {
+			continue
+		}
+		rxl, err := strconv.Atoi(fields[1])
+		cellID, lac := strings.ToUpper(fields[3]), strings.ToUpper(fields[6])
+		if err != nil || !isHex(cellID) || !isHex(lac) || strings.Trim(cellID, "0F") == "" {
+			continue
+		}
+		// RXLEV 0-63 counts dB above -110 dBm.
+		cells = append(cells, neighborCell{LAC: lac, CellID: cellID, DBm: rxl - 110})
+	}
+	return cells
+}
+
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(s, 16, 64)
+	return err == nil
+}
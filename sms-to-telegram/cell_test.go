@@ -0,0 +1,91 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+func TestParseCREGCell(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		wantLAC string
+		wantCI  string
+		wantOK  bool
+	}{
+		{"GSM", []string{`+CREG: 2,1,"4e48","1f4e"`, "OK"}, "4E48", "1F4E", true},
+		{"LTE with AcT", []string{`+CREG: 2,5,"00A1","01B2C3D",7`}, "00A1", "01B2C3D", true},
+		{"not registered", []string{"+CREG: 2,2"}, "", "", false},
+		{"location off", []string{"+CREG: 0,1"}, "", "", false},
+		{"garbage", []string{`+CREG: 2,1,"zz","1f4e"`}, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lac, ci, ok := parseCREGCell(tt.lines)
+			if lac != tt.wantLAC || ci != tt.wantCI || ok != tt.wantOK {
+				t.Errorf("parseCREGCell() = %q, %q, %v; want %q, %q, %v", lac, ci, ok, tt.wantLAC, tt.wantCI, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseCENGNeighbors(t *testing.T) {
+	got := parseCENGNeighbors([]string{
+		"+CENG: 1,1",
+		`+CENG: 0,"0034,39,00,262,02,22,1f4e,00,05,4e48,255"`, // serving cell
+		`+CENG: 1,"0025,27,13,1f51,262,02,4e48"`,
+		`+CENG: 2,"0040,20,10,2a07,262,02,4e49"`,
+		`+CENG: 3,"0000,00,00,0000,000,00,0000"`, // empty slot
+		`+CENG: 4,"ffff,00,00,ffff,000,00,ffff"`, // empty slot
+		"OK",
+	})
+	want := []neighborCell{{LAC: "4E48", CellID: "1F51", DBm: -83}, {LAC: "4E49", CellID: "2A07", DBm: -90}}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseCENGNeighbors() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCellTracker(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	metrics := NewMetrics()
+	cells := newCellTracker(cellTrackingNeighbors, metrics)
+
+	modem := newFakeAT()
+	modem.on("AT+CREG?", []string{`+CREG: 2,1,"4E48","1F4E"`}, nil)
+	modem.on("AT+CREG?", []string{`+CREG: 2,1,"4E48","1F4E"`}, nil)
+	modem.on("AT+CREG?", []string{`+CREG: 2,1,"4E48","1F51"`}, nil)
+	modem.on("AT+CENG=1,1", nil, at.ErrModemError)
+	for range 3 {
+		cells.sample(modem)
+		clock.Advance(time.Minute)
+	}
+
+	// The location reports are only on around the query.
+	if got := strings.Join(modem.calls[:4], " "); got != "AT+CREG=2 AT+CREG? AT+CREG=0 AT+CENG=1,1" {
+		t.Errorf("first sample sent %q", got)
+	}
+	if n := modem.commandCount("AT+CENG=1,1"); n != 1 {
+		t.Errorf("AT+CENG=1,1 sent %d times, want 1 (neighbors off after ERROR)", n)
+	}
+	history := metrics.CellHistory()
+	if len(history) != 2 || history[1].From != "4E48/1F4E" || history[1].CellID != "1F51" {
+		t.Errorf("history = %+v", history)
+	}
+	if body := scrapeMetrics(t, metrics); !strings.Contains(body, "sms_to_telegram_cell_changes_total 1\n") {
+		t.Errorf("metrics lack the change counter:\n%s", body)
+	}
+
+	if newCellTracker(cellTrackingOff, metrics) != nil {
+		t.Error("off should give a nil tracker")
+	}
+	var off *cellTracker
+	off.sample(modem) // nil-safe
+}
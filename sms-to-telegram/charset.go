@@ -0,0 +1,38 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"strings"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
+)
+
+// TE character sets (MODEM_CHARSET, AT+CSCS). They apply to the text fields
+// of AT responses such as the operator name; SMS travel as PDUs and are not
+// affected (text mode, which forces UCS2, aside).
+const (
+	charsetGSM  = "GSM"
+	charsetIRA  = "IRA"
+	charsetUCS2 = "UCS2"
+)
+
+// parseCSCS extracts the character set of a +CSCS response; "" if absent.
+func parseCSCS(lines []string) string {
+	for _, line := range lines {
+		if rest, ok := strings.CutPrefix(line, "+CSCS:"); ok {
+			return strings.Trim(strings.TrimSpace(rest), `"`)
+		}
+	}
+	return ""
+}
+
+// decodeTEString decodes a string field of an AT response in the TE
+// character set; see pdu.DecodeUCS2Hex.
+func decodeTEString(s, charset string) string {
+	if charset != charsetUCS2 {
+		return s
+	}
+	return pdu.DecodeUCS2Hex(s)
+}
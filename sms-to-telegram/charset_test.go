@@ -0,0 +1,40 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import "testing"
+
+func TestDecodeTEString(t *testing.T) {
+	tests := []struct {
+		s, charset, want string
+	}{
+		{"004F0032", charsetUCS2, "O2"},
+		{"0054002D004D006F00620069006C0065", charsetUCS2, "T-Mobile"},
+		{"041C04220421", charsetUCS2, "МТС"},
+		{"SM", charsetUCS2, "SM"},             // left unencoded by the firmware
+		{"Vodafone", charsetUCS2, "Vodafone"}, // not hex
+		{"004F0032", charsetGSM, "004F0032"},
+		{"", charsetUCS2, ""},
+	}
+	for _, tt := range tests {
+		if got := decodeTEString(tt.s, tt.charset); got != tt.want {
+			t.Errorf("decodeTEString(%q, %s) = %q, want %q", tt.s, tt.charset, got, tt.want)
+		}
+	}
+}
+
+func TestParseCSCS(t *testing.T) {
+	for _, tt := range []struct {
+		lines []string
+		want  string
+	}{
+		{[]string{`+CSCS: "UCS2"`}, "UCS2"},
+		{[]string{`+CSCS: "0055004300530032"`}, "0055004300530032"},
+		{[]string{"OK"}, ""},
+	} {
+		if got := parseCSCS(tt.lines); got != tt.want {
+			t.Errorf("parseCSCS(%q) = %q, want %q", tt.lines, got, tt.want)
+		}
+	}
+}
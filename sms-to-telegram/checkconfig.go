@@ -0,0 +1,271 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+// --check-config: validate everything that can be checked without taking
+// over the modem, print one line per check and report failure via the exit
+// code, for CI and deployment pipelines. The serial port is only opened and
+// closed; no AT command is sent, so it is safe next to a running service.
+
+const checkTelegramTimeout = 10 * time.Second
+
+type configCheck struct {
+	status string // OK, FAIL or SKIP
+	name   string
+	detail string
+}
+
+// ConfigChecker collects check results and writes the report.
+type ConfigChecker struct {
+	checks []configCheck
+}
+
+func (c *ConfigChecker) add(status, name, detail string) {
+	c.checks = append(c.checks, configCheck{status, name, detail})
+}
+
+func (c *ConfigChecker) result(name, okDetail string, err error) {
+	if err != nil {
+		c.add("FAIL", name, err.Error())
+		return
+	}
+	c.add("OK", name, okDetail)
+}
+
+// Report writes the checks and returns the number of failures.
+func (c *ConfigChecker) Report(w io.Writer) int {
+	failed := 0
+	for _, ch := range c.checks {
+		fmt.Fprintf(w, "%-5s %-24s %s\n", ch.status, ch.name, ch.detail)
+		if ch.status == "FAIL" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(w, "\nConfiguration check failed: %d problem(s)\n", failed)
+	} else {
+		fmt.Fprintln(w, "\nConfiguration OK")
+	}
+	return failed
+}
+
+// Run checks a loaded configuration. tg is nil in DRY_RUN (or when the
+// bot could not be created, already reported).
+func (c *ConfigChecker) Run(ctx context.Context, cfg *Config, tg ChatInspector) {
+	c.add("OK", "configuration", fmt.Sprintf("%d chat(s), %d routing rule(s)", len(cfg.ChatIDs), len(cfg.RoutingRules)))
+	if cfg.Profile != "" {
+		c.add("OK", "profile", cfg.Profile+" from PROFILES_FILE")
+	}
+	c.checkTelegram(ctx, cfg, tg)
+	c.result("serial port", cfg.SerialPort+" can be opened read/write", probeSerialDevice(cfg.SerialPort))
+	if cfg.StateDir == "" {
+		c.add("SKIP", "state dir", "STATE_DIR not set")
+	} else {
+		c.result("state dir", cfg.StateDir+" is writable", probeWritableDir(cfg.StateDir))
+	}
+}
+
+func (c *ConfigChecker) checkTelegram(ctx context.Context, cfg *Config, tg ChatInspector) {
+	if tg == nil {
+		if cfg.DryRun {
+			c.add("SKIP", "telegram", "DRY_RUN")
+		}
+		return
+	}
+	// Errors may embed the request URL, which carries the token.
+	redact := func(err error) error {
+		return errors.New(strings.ReplaceAll(err.Error(), cfg.TelegramToken, "<token>"))
+	}
+	callCtx, cancel := context.WithTimeout(ctx, checkTelegramTimeout)
+	me, err := tg.GetMe(callCtx)
+	cancel()
+	if err != nil {
+		c.add("FAIL", "telegram", "getMe: "+redact(err).Error())
+		return // every chat check would fail the same way
+	}
+	c.add("OK", "telegram", fmt.Sprintf("bot @%s (id %d)", me.Username, me.ID))
+
+	for _, id := range configuredChats(cfg) {
+		name := fmt.Sprintf("chat %d", id)
+		label, err := inspectChat(ctx, tg, id)
+		if err != nil {
+			c.add("FAIL", name, redact(err).Error())
+			continue
+		}
+		c.add("OK", name, label)
+	}
+}
+
+// inspectChat resolves one chat with getChat and describes it as
+// `supergroup "Family"`.
+func inspectChat(ctx context.Context, tg ChatInspector, id int64) (string, error) {
+	callCtx, cancel := context.WithTimeout(ctx, checkTelegramTimeout)
+	defer cancel()
+	chat, err := tg.GetChat(callCtx, &bot.GetChatParams{ChatID: id})
+	if err != nil {
+		return "", err
+	}
+	label := chat.Title
+	if label == "" {
+		label = strings.TrimSpace(chat.FirstName + " " + chat.LastName)
+	}
+	if chat.Username != "" {
+		label += " (@" + chat.Username + ")"
+	}
+	return fmt.Sprintf("%s %q", chat.Type, label), nil
+}
+
+// validateChats repeats the chat checks of --check-config at startup, so a
+// mistyped or abandoned chat ID is reported at once instead of surfacing as
+// delivery retries on the next SMS. Unreachable chats are logged and
+// reported to the admins, or without TELEGRAM_ADMIN_IDS to the alert chats
+// that did resolve. If the bot itself cannot reach Telegram the check is
+// skipped: every chat would fail the same way.
+func validateChats(ctx context.Context, cfg *Config, tg ChatInspector, notifier *ErrorNotifier) {
+	redact := func(err error) string {
+		return strings.ReplaceAll(err.Error(), cfg.TelegramToken, "<token>")
+	}
+	callCtx, cancel := context.WithTimeout(ctx, checkTelegramTimeout)
+	_, err := tg.GetMe(callCtx)
+	cancel()
+	if err != nil {
+		slog.Warn("Skipping Telegram chat validation", "error", redact(err))
+		return
+	}
+
+	failed := make(map[int64]string)
+	var lines []string
+	for _, id := range configuredChats(cfg) {
+		label, err := inspectChat(ctx, tg, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			failed[id] = redact(err)
+			slog.Error("Telegram chat unreachable", "chat_id", id, "error", failed[id])
+			lines = append(lines, fmt.Sprintf("• <code>%d</code>: %s", id, escapeHTML(failed[id])))
+			continue
+		}
+		slog.Debug("Telegram chat reachable", "chat_id", id, "chat", label)
+	}
+	if len(failed) == 0 {
+		slog.Info("Telegram chats validated", "chats", len(configuredChats(cfg)))
+		return
+	}
+
+	recipients := cfg.AdminIDs
+	if len(recipients) == 0 {
+		for _, id := range cfg.ChatIDs {
+			if _, bad := failed[id]; !bad {
+				recipients = append(recipients, id)
+			}
+		}
+	}
+	text := fmt.Sprintf("<b>Unreachable Telegram Chats</b>\n\n"+
+		"<b>Host:</b> %s\n\n%s\n\n"+
+		"<i>Check TELEGRAM_CHAT_IDS and ROUTING_RULES, and that the bot is a member of each chat.</i>",
+		notifier.hostHTML(), strings.Join(lines, "\n"))
+	for _, id := range recipients {
+		if err := notifier.sendToChat(ctx, id, text); err != nil {
+			slog.Error("Failed to report unreachable chats", "chat_id", id, "error", redact(err))
+		}
+	}
+}
+
+// configuredChats lists every chat SMS or alerts may go to, in
+// configuration order without duplicates.
+func configuredChats(cfg *Config) []int64 {
+	seen := make(map[int64]bool)
+	var ids []int64
+	add := func(list []int64) {
+		for _, id := range list {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	add(cfg.ChatIDs)
+	for _, rule := range cfg.RoutingRules {
+		add(rule.ChatIDs)
+	}
+	for _, rule := range cfg.Rules {
+		add(rule.route)
+	}
+	return ids
+}
+
+// probeSerialDevice opens the serial device read/write without becoming its
+// controlling terminal or waiting for carrier, then closes it.
+func probeSerialDevice(path string) error {
+	path, err := resolveSerialPort(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeCharDevice == 0 {
+		return fmt.Errorf("%s is not a character device", path)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("%w (is the user in the device's group, e.g. dialout?)", err)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// probeWritableDir creates and removes a file in dir.
+func probeWritableDir(dir string) error {
+	f, err := os.CreateTemp(dir, ".check-config-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// runConfigCheck implements --check-config and returns the exit code.
+// loadErr is the startup configuration error, if any.
+func runConfigCheck(w io.Writer, cfg *Config, loadErr error) int {
+	checker := &ConfigChecker{}
+	if loadErr != nil {
+		checker.add("FAIL", "configuration", loadErr.Error())
+		checker.Report(w)
+		return 1
+	}
+	var tg ChatInspector
+	if !cfg.DryRun {
+		b, err := bot.New(cfg.TelegramToken, bot.WithSkipGetMe())
+		if err != nil {
+			checker.add("FAIL", "telegram", err.Error())
+		} else {
+			tg = b
+		}
+	}
+	checker.Run(context.Background(), cfg, tg)
+	if checker.Report(w) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,152 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// fakeInspector knows a fixed set of chats.
+type fakeInspector struct {
+	meErr error
+	chats map[int64]*models.ChatFullInfo
+	asked []int64
+}
+
+func (f *fakeInspector) GetMe(context.Context) (*models.User, error) {
+	if f.meErr != nil {
+		return nil, f.meErr
+	}
+	return &models.User{ID: 7, Username: "sms_gateway_bot"}, nil
+}
+
+func (f *fakeInspector) GetChat(_ context.Context, params *bot.GetChatParams) (*models.ChatFullInfo, error) {
+	id := params.ChatID.(int64)
+	f.asked = append(f.asked, id)
+	if chat, ok := f.chats[id]; ok {
+		return chat, nil
+	}
+	return nil, errors.New("bad request, Bad Request: chat not found")
+}
+
+func TestConfigChecker(t *testing.T) {
+	stateDir := t.TempDir()
+	notDevice := filepath.Join(t.TempDir(), "ttyUSB0")
+	os.WriteFile(notDevice, nil, 0o600)
+
+	cfg := &Config{
+		TelegramToken: "123:secret",
+		ChatIDs:       []int64{-100, 42},
+		RoutingRules:  []RoutingRule{{ChatIDs: []int64{42, 99}}},
+		SerialPort:    "/dev/null",
+		StateDir:      stateDir,
+	}
+	tg := &fakeInspector{chats: map[int64]*models.ChatFullInfo{
+		-100: {ID: -100, Type: models.ChatTypeSupergroup, Title: "Family"},
+		42:   {ID: 42, Type: models.ChatTypePrivate, FirstName: "Ann", Username: "ann"},
+	}}
+
+	checker := &ConfigChecker{}
+	checker.Run(context.Background(), cfg, tg)
+	var out bytes.Buffer
+	if failed := checker.Report(&out); failed != 1 {
+		t.Errorf("failures = %d, want 1 (chat 99):\n%s", failed, out.String())
+	}
+	report := out.String()
+	for _, want := range []string{
+		"OK    telegram                 bot @sms_gateway_bot",
+		`OK    chat -100                supergroup "Family"`,
+		`OK    chat 42                  private "Ann (@ann)"`,
+		"FAIL  chat 99                  bad request, Bad Request: chat not found",
+		"OK    serial port              /dev/null",
+		"OK    state dir",
+		"Configuration check failed: 1 problem(s)",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report lacks %q:\n%s", want, report)
+		}
+	}
+	if len(tg.asked) != 3 {
+		t.Errorf("GetChat calls = %v, want each chat once", tg.asked)
+	}
+
+	// A bad token stops the chat checks; the serial path is not a device.
+	cfg.SerialPort = notDevice
+	tg = &fakeInspector{meErr: errors.New("unauthorized, token 123:secret rejected")}
+	checker = &ConfigChecker{}
+	checker.Run(context.Background(), cfg, tg)
+	out.Reset()
+	if failed := checker.Report(&out); failed != 2 || len(tg.asked) != 0 {
+		t.Errorf("failures = %d, chats asked %v:\n%s", failed, tg.asked, out.String())
+	}
+	if strings.Contains(out.String(), "123:secret") || !strings.Contains(out.String(), "not a character device") {
+		t.Errorf("report:\n%s", out.String())
+	}
+}
+
+// TestValidateChats: unreachable chats go to the admins, or without admins
+// to the alert chats that resolved; a bot that cannot reach Telegram at all
+// reports nothing.
+func TestValidateChats(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{
+		TelegramToken: "123:secret",
+		ChatIDs:       []int64{-100, 99},
+		RoutingRules:  []RoutingRule{{ChatIDs: []int64{-5}}},
+	}
+	tg := &fakeInspector{chats: map[int64]*models.ChatFullInfo{
+		-100: {ID: -100, Type: models.ChatTypeGroup, Title: "Alerts"},
+	}}
+	sender := &fakeSender{}
+	notifier := NewErrorNotifier(sender, cfg.ChatIDs, false, "gw<1>", time.Second)
+
+	validateChats(ctx, cfg, tg, notifier)
+	sent := sender.sentTo(-100)
+	if len(sent) != 1 || len(sender.sentTo(99)) != 0 {
+		t.Fatalf("report sent to %d/%d, want only the reachable alert chat", len(sent), len(sender.sentTo(99)))
+	}
+	for _, want := range []string{"gw&lt;1&gt;", "<code>99</code>: bad request", "<code>-5</code>"} {
+		if !strings.Contains(sent[0].Text, want) {
+			t.Errorf("report lacks %q:\n%s", want, sent[0].Text)
+		}
+	}
+
+	cfg.AdminIDs = []int64{7}
+	validateChats(ctx, cfg, tg, notifier)
+	if len(sender.sentTo(7)) != 1 || len(sender.sentTo(-100)) != 1 {
+		t.Error("with admins the report goes to the admins only")
+	}
+
+	tg = &fakeInspector{meErr: errors.New("network down")}
+	validateChats(ctx, cfg, tg, notifier)
+	if len(tg.asked) != 0 || len(sender.sentTo(7)) != 1 {
+		t.Error("an unreachable Bot API must skip the validation")
+	}
+}
+
+func TestRunConfigCheck_LoadError(t *testing.T) {
+	var out bytes.Buffer
+	if code := runConfigCheck(&out, nil, errors.New("TELEGRAM_CHAT_IDS environment variable is required")); code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if !strings.HasPrefix(out.String(), "FAIL  configuration") {
+		t.Errorf("report = %q", out.String())
+	}
+
+	out.Reset()
+	cfg := &Config{DryRun: true, SerialPort: "/dev/null"}
+	if code := runConfigCheck(&out, cfg, nil); code != 0 {
+		t.Errorf("DRY_RUN exit code = %d, want 0:\n%s", code, out.String())
+	}
+}
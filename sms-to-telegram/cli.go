@@ -0,0 +1,594 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tarm/serial"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
+)
+
+// Subcommands. Without one the binary runs the gateway, so existing units,
+// containers and the --check-config / --version flags keep working. Each
+// command has its own flag set; the gateway itself stays configured by
+// environment variables. The modem commands (send, diag, esim) need the serial
+// port to themselves: stop the service first.
+
+type cliCommand struct {
+	name    string
+	args    string // usage after the name
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) int
+}
+
+func cliCommands() []cliCommand {
+	return []cliCommand{
+		{"run", "[flags]", "Run the gateway (the default without a command)",
+			func(args []string, _, stderr io.Writer) int { return cmdRun(args, stderr) }},
+		{"check-config", "[flags]", "Validate the configuration, Telegram chats, serial device and STATE_DIR", cmdCheckConfig},
+		{"send", "[flags] <number> <text>", "Send one SMS through the modem", cmdSend},
+		{"diag", "[flags]", "Initialize the modem once and print SIM, network and signal state", cmdDiag},
+		{"esim", "[flags] list | switch <ICCID>", "List the eSIM profiles or switch the active one", cmdESIM},
+		{"emulate-modem", "[flags]", "Emulate a SIM800 on a pty, for trying the gateway without a modem", cmdEmulateModem},
+		{"decode-pdu", "[hex PDU ...]", "Decode SMS-DELIVER PDUs given as arguments or on stdin, one per line", cmdDecodePDU},
+		{"replay", "[flags] <file|dir> ...", "Run captured PDUs through decoding, multipart assembly and formatting", cmdReplay},
+		{"archive", "[flags]", "Search the message archive and export the matches", cmdArchive},
+		{"hash-password", "[user role]", "Hash a password read from stdin for API_USERS", cmdHashPassword},
+		{"gen-api-key", "<name> <scopes>", "Generate a random key and its API_KEYS entry", cmdGenAPIKey},
+		{"version", "", "Print version and build information", cmdVersion},
+	}
+}
+
+// multiCallNames are the names the binary also answers to, through a
+// symlink, with the command each one runs: modem-diag is diag, for checking
+// a modem before the gateway is configured.
+var multiCallNames = map[string]string{"modem-diag": "diag"}
+
+// commandLine returns the runCLI arguments of argv (os.Args).
+func commandLine(argv []string) []string {
+	if cmd, ok := multiCallNames[filepath.Base(argv[0])]; ok {
+		return append([]string{cmd}, argv[1:]...)
+	}
+	return argv[1:]
+}
+
+// runCLI dispatches the command line and returns the exit code.
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return legacyCLI(args, stdout, stderr)
+	}
+	if args[0] == "help" {
+		printUsage(stdout)
+		return 0
+	}
+	for _, cmd := range cliCommands() {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "Unknown command %q\n\n", args[0])
+	printUsage(stderr)
+	return 2
+}
+
+// legacyCLI keeps the flag-only invocation of earlier releases.
+func legacyCLI(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("sms-to-telegram", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { printUsage(stderr) }
+	checkConfig := fs.Bool("check-config", false, "same as the check-config command")
+	showVersion := fs.Bool("version", false, "same as the version command")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	switch {
+	case fs.NArg() > 0:
+		fmt.Fprintf(stderr, "Unexpected argument %q\n\n", fs.Arg(0))
+		printUsage(stderr)
+		return 2
+	case *showVersion:
+		return cmdVersion(nil, stdout, stderr)
+	case *checkConfig:
+		return cmdCheckConfig(nil, stdout, stderr)
+	}
+	return cmdRun(nil, stderr)
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: sms-to-telegram [command] [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, cmd := range cliCommands() {
+		fmt.Fprintf(w, "  %-13s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "\nThe gateway is configured by environment variables (docs/README.md).")
+	fmt.Fprintln(w, "Run 'sms-to-telegram <command> -h' for the flags of a command.")
+}
+
+// newCommandFlags creates the flag set of one command; parseCommandFlags
+// reports the exit code when parsing ends the command (-h or a bad flag).
+func newCommandFlags(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		for _, cmd := range cliCommands() {
+			if cmd.name == name {
+				fmt.Fprintf(stderr, "Usage: sms-to-telegram %s %s\n\n%s.\n", name, cmd.args, cmd.summary)
+			}
+		}
+		if hasFlags(fs) {
+			fmt.Fprintln(stderr, "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	n := 0
+	fs.VisitAll(func(*flag.Flag) { n++ })
+	return n > 0
+}
+
+func parseCommandFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0, false
+		}
+		return 2, false
+	}
+	return 0, true
+}
+
+func cmdVersion(args []string, stdout, stderr io.Writer) int {
+	fs := newCommandFlags("version", stderr)
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	fmt.Fprintln(stdout, currentBuildInfo())
+	return 0
+}
+
+func cmdCheckConfig(args []string, stdout, stderr io.Writer) int {
+	fs := newCommandFlags("check-config", stderr)
+	profileName := profileFlag(fs)
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	// Loaded exactly as a normal start would, profile, RELOAD_FILE and
+	// Vault included.
+	profile, err := applyProfile(*profileName)
+	var cfg *Config
+	if err == nil {
+		_, _, err = startupVault()
+	}
+	if err == nil {
+		cfg, err = loadConfigWithReloadFile(reloadableEnv())
+	}
+	if cfg != nil {
+		cfg.Profile = profile
+	}
+	return runConfigCheck(stdout, cfg, err)
+}
+
+// modemFlags registers the serial port flags shared by the modem commands; the
+// defaults come from SERIAL_PORT and BAUD_RATE like for the gateway.
+func modemFlags(fs *flag.FlagSet) (port *string, baud *int, verbose *bool) {
+	defPort, defBaud := os.Getenv("SERIAL_PORT"), 115200
+	if defPort == "" {
+		defPort = "/dev/ttyUSB0"
+	}
+	if b, err := strconv.Atoi(os.Getenv("BAUD_RATE")); err == nil && b > 0 {
+		defBaud = b
+	}
+	port = fs.String("port", defPort, "serial device (SERIAL_PORT)")
+	baud = fs.Int("baud", defBaud, "baud rate (BAUD_RATE)")
+	verbose = fs.Bool("v", false, "log AT traffic and diagnostics at DEBUG level")
+	return port, baud, verbose
+}
+
+// cliLogging sends the log output of the shared modem code to stderr: only
+// warnings and errors unless -v.
+func cliLogging(stderr io.Writer, verbose bool) {
+	level := slog.LevelWarn
+	if verbose {
+		level = slog.LevelDebug
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level})))
+}
+
+// openModemPort opens the serial device with the read timeout the AT
+// framing expects (0-byte reads mark idle periods).
+func openModemPort(name string, baud int) (*serial.Port, error) {
+	device, err := resolveSerialPort(name)
+	if err != nil {
+		return nil, err
+	}
+	return serial.OpenPort(&serial.Config{Name: device, Baud: baud, ReadTimeout: 500 * time.Millisecond})
+}
+
+// resolveSerialPort expands a SERIAL_PORT glob
+// ("/dev/serial/by-id/usb-Quectel_*-if02-port0") to the first matching
+// device in lexical order. A device plugin or a re-plugged modem may bring
+// the modem back under another ttyUSB number, so the pattern is resolved on
+// every open. A plain path is returned as it is.
+func resolveSerialPort(pattern string) (string, error) {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return pattern, nil
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid serial port pattern %q: %w", pattern, err)
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no device matches %s", pattern)
+	}
+	slog.Debug("Serial port resolved", "pattern", pattern, "device", matches[0])
+	return matches[0], nil
+}
+
+// openModemSession opens the port and runs the mandatory session
+// initialization (PDU mode, SIM storage) for a one-off command. The
+// commands speak PDUs: no text-mode fallback. observe, when set, sees
+// every command (diag -report).
+func openModemSession(port string, baud int, observe func(string, time.Duration, error)) (*at.SimpleAT, io.Closer, int, int, error) {
+	p, err := openModemPort(port, baud)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	modem := at.NewSimpleAT(p, 5*time.Second)
+	modem.Observe = observe
+	// The gateway may have left the modem sleeping (LOW_POWER=auto).
+	if err := modem.Wake(autoWakeWait); err != nil {
+		p.Close()
+		return nil, nil, 0, 0, err
+	}
+	storage, err := initModemSession(modem, []string{storageSM, storageME}, "", false)
+	if err != nil {
+		p.Close()
+		return nil, nil, 0, 0, err
+	}
+	return modem, p, storage.Used, storage.Total, nil
+}
+
+func cmdSend(args []string, stdout, stderr io.Writer) int {
+	fs := newCommandFlags("send", stderr)
+	port, baud, verbose := modemFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "encode the SMS and report its parts without opening the modem")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return 2
+	}
+	cliLogging(stderr, *verbose)
+	to, text := fs.Arg(0), strings.Join(fs.Args()[1:], " ")
+	if !validDestination(to) {
+		fmt.Fprintf(stderr, "Destination %q is not a phone number\n", to)
+		return 2
+	}
+	parts, ucs2, err := pdu.SplitForSubmit(text)
+	if err != nil {
+		fmt.Fprintf(stderr, "Cannot send this text: %v\n", err)
+		return 2
+	}
+	req := outgoingSMS{ctx: context.Background(), to: to, parts: parts, ucs2: ucs2}
+	outbox := NewOutbox(*dryRun)
+	if *dryRun {
+		res, err := outbox.submitParts(nil, req)
+		if err != nil {
+			fmt.Fprintf(stderr, "Encoding failed: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "Would send %d part(s) to %s (%s)\n", res.Parts, to, submitEncoding(ucs2))
+		return 0
+	}
+
+	modem, closer, _, _, err := openModemSession(*port, *baud, nil)
+	if err != nil {
+		fmt.Fprintf(stderr, "Modem %s: %v\n", *port, err)
+		return 1
+	}
+	defer closer.Close()
+	res, err := outbox.submitParts(modem, req)
+	if err != nil {
+		fmt.Fprintf(stderr, "Send failed after %d of %d part(s): %v\n", len(res.References), res.Parts, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Sent %d part(s) to %s (%s), message references %v\n", res.Parts, to, submitEncoding(ucs2), res.References)
+	return 0
+}
+
+func submitEncoding(ucs2 bool) string {
+	if ucs2 {
+		return "UCS2"
+	}
+	return "GSM 7-bit"
+}
+
+func cmdDiag(args []string, stdout, stderr io.Writer) int {
+	fs := newCommandFlags("diag", stderr)
+	port, baud, verbose := modemFlags(fs)
+	grace := fs.Duration("grace", 30*time.Second, "how long to wait for network registration and signal")
+	report := fs.Bool("report", false, "probe the modem afterwards and add the AT timing and reliability report")
+	rounds := fs.Int("rounds", 20, "probe rounds of -report")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if *rounds < 1 || *rounds > 1000 {
+		fmt.Fprintf(stderr, "Invalid -rounds %d: must be 1-1000\n", *rounds)
+		return 2
+	}
+	cliLogging(stderr, *verbose)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var metrics *Metrics
+	if *report {
+		metrics = NewMetrics()
+	}
+	res := &diagResult{Port: *port, BaudRate: *baud, OK: true}
+	if !*asJSON {
+		res.out = stdout
+		fmt.Fprintf(stdout, "%-12s %s (%d baud)\n", "Port:", *port, *baud)
+	}
+	diagModem(ctx, res, *grace, metrics, *rounds)
+	if metrics != nil {
+		r := metrics.ATReport()
+		res.Report = &r
+	}
+	code := 0
+	if !res.OK {
+		code = 1
+	}
+	if !*asJSON {
+		if res.Report != nil {
+			fmt.Fprintf(stdout, "\n%s", formatATReport(*res.Report))
+		}
+		return code
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(res); err != nil {
+		fmt.Fprintf(stderr, "Writing the result: %v\n", err)
+		return 1
+	}
+	return code
+}
+
+// diagResult is what diag found; OK is false when a check failed.
+type diagResult struct {
+	Port     string      `json:"port"`
+	BaudRate int         `json:"baud_rate"`
+	OK       bool        `json:"ok"`
+	Checks   []diagCheck `json:"checks"`
+	Report   *ATReport   `json:"at_report,omitempty"`
+	// out, when set, gets every check as it is made.
+	out io.Writer
+}
+
+// diagCheck is one line of the diag output. Signal and Operator are
+// informational: "unknown" does not fail them.
+type diagCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+func (r *diagResult) check(name string, ok bool, format string, args ...any) {
+	c := diagCheck{Name: name, OK: ok, Detail: fmt.Sprintf(format, args...)}
+	r.Checks = append(r.Checks, c)
+	r.OK = r.OK && ok
+	if r.out != nil {
+		if !ok {
+			c.Detail = "FAIL: " + c.Detail
+		}
+		fmt.Fprintf(r.out, "%-12s %s\n", c.Name+":", c.Detail)
+	}
+}
+
+// atReportProbes are the commands diag -report repeats: answered by the
+// modem alone, so their failures are the modem's.
+var atReportProbes = []string{"AT", "AT+CSQ", "AT+CREG?", "AT+CPMS?"}
+
+// diagModem runs the diag checks on res.Port into res; with metrics, every
+// command is recorded and the probes repeat for rounds afterwards.
+func diagModem(ctx context.Context, res *diagResult, grace time.Duration, metrics *Metrics, rounds int) {
+	start := time.Now()
+	var observe func(string, time.Duration, error)
+	if metrics != nil {
+		observe = metrics.ATCommandDone
+	}
+	modem, closer, used, total, err := openModemSession(res.Port, res.BaudRate, observe)
+	if err != nil {
+		res.check("Session", false, "%v", err)
+		return
+	}
+	defer closer.Close()
+	res.check("Session", true, "OK (PDU mode, SIM storage %d/%d)", used, total)
+
+	if err := runModemDiagnostics(ctx, modem, start, grace); err != nil {
+		res.check("Diagnostics", false, "%v", err)
+	} else {
+		res.check("Diagnostics", true, "OK (SIM ready, registered, signal present)")
+	}
+	strength := "unknown"
+	if lines, err := modem.Command("AT+CSQ"); err == nil {
+		if rssi, ok := parseCSQ(lines); ok && rssi <= 31 {
+			strength = fmt.Sprintf("%d dBm (CSQ %d)", csqToDBm(rssi), rssi)
+		}
+	}
+	res.check("Signal", true, "%s", strength)
+	operator := "unknown"
+	if lines, err := modem.Command("AT+COPS?"); err == nil && parseCOPS(lines) != "" {
+		// Best effort: a broken OPERATOR_NAMES_FILE leaves the built-in names.
+		names, _ := loadOperatorNames(os.Getenv("OPERATOR_NAMES_FILE"))
+		operator = operatorName(parseCOPS(lines), names)
+	}
+	res.check("Operator", true, "%s", operator)
+	if metrics == nil {
+		return
+	}
+
+	probed := 0
+probe:
+	for ; probed < rounds && ctx.Err() == nil; probed++ {
+		for _, cmd := range atReportProbes {
+			if _, err := modem.Command(cmd); errors.Is(err, at.ErrSessionPoisoned) {
+				break probe
+			}
+		}
+	}
+	res.check("Probes", true, "%d of %d rounds of %s", probed, rounds, strings.Join(atReportProbes, ", "))
+}
+
+func cmdDecodePDU(args []string, stdout, stderr io.Writer) int {
+	fs := newCommandFlags("decode-pdu", stderr)
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	pdus := fs.Args()
+	if len(pdus) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 4096), 1<<20)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				pdus = append(pdus, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Fprintf(stderr, "Reading stdin: %v\n", err)
+			return 1
+		}
+	}
+	return decodePDUs(stdout, pdus)
+}
+
+// decodePDUs prints each PDU's fields, and an error line for those that do
+// not decode. Returns 1 if any failed.
+func decodePDUs(w io.Writer, pdus []string) int {
+	code := 0
+	for i, raw := range pdus {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		msg, err := pdu.Parse(raw)
+		var unsupported *pdu.UnsupportedEncodingError
+		if errors.As(err, &unsupported) {
+			msg = unsupported.Msg
+		}
+		if err != nil {
+			fmt.Fprintf(w, "%-10s %v\n", "Error:", err)
+			code = 1
+		}
+		if msg == nil {
+			continue
+		}
+		fmt.Fprintf(w, "%-10s %s\n", "Sender:", msg.Sender)
+		fmt.Fprintf(w, "%-10s %s\n", "SMSC:", msg.SMSC)
+		if msg.Timestamp.IsZero() {
+			fmt.Fprintf(w, "%-10s invalid\n", "Sent:")
+		} else {
+			fmt.Fprintf(w, "%-10s %s\n", "Sent:", msg.Timestamp.Format(time.RFC3339))
+		}
+		fmt.Fprintf(w, "%-10s %s\n", "Encoding:", [...]string{"GSM 7-bit", "8-bit data", "UCS2"}[msg.Alphabet])
+		if msg.IsMultipart {
+			fmt.Fprintf(w, "%-10s %d/%d (%d-bit reference %d)\n", "Part:", msg.PartNumber, msg.TotalParts, msg.RefKind, msg.MultipartRef)
+		}
+		if err == nil {
+			fmt.Fprintf(w, "%-10s %s\n", "Text:", msg.Text)
+		}
+	}
+	return code
+}
+
+// cmdESIM lists or switches the eSIM profiles. It needs no SMS session: a
+// card without an enabled profile has no SIM to initialize, and that is
+// when a switch is needed most.
+func cmdESIM(args []string, stdout, stderr io.Writer) int {
+	fs := newCommandFlags("esim", stderr)
+	port, baud, verbose := modemFlags(fs)
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	action := fs.Arg(0)
+	if !(action == "list" && fs.NArg() == 1) && !(action == "switch" && fs.NArg() == 2) {
+		fs.Usage()
+		return 2
+	}
+	cliLogging(stderr, *verbose)
+	iccid := fs.Arg(1)
+	if action == "switch" && !validICCID(iccid) {
+		fmt.Fprintf(stderr, "%q is not an ICCID (18 to 20 digits)\n", iccid)
+		return 2
+	}
+
+	p, err := openModemPort(*port, *baud)
+	if err != nil {
+		fmt.Fprintf(stderr, "Modem %s: %v\n", *port, err)
+		return 1
+	}
+	defer p.Close()
+	modem := at.NewSimpleAT(p, 5*time.Second)
+	if err := modem.Wake(autoWakeWait); err == nil {
+		_, err = modem.Command("AT")
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Modem %s: %v\n", *port, err)
+		return 1
+	}
+
+	if action == "switch" {
+		if err := switchESIMProfile(modem, iccid); err != nil {
+			fmt.Fprintf(stderr, "Switch failed: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "Switched to %s; the modem reloads the SIM\n", iccid)
+		return 0
+	}
+	profiles, err := listESIMProfiles(modem)
+	if err != nil {
+		fmt.Fprintf(stderr, "Listing failed: %v\n", err)
+		return 1
+	}
+	for _, pr := range profiles {
+		state := "disabled"
+		if pr.Enabled {
+			state = "ENABLED"
+		}
+		fmt.Fprintf(stdout, "%-20s  %-8s  %s", pr.ICCID, state, pr.Label())
+		if pr.Provider != "" && pr.Provider != pr.Label() {
+			fmt.Fprintf(stdout, " (%s)", pr.Provider)
+		}
+		if pr.Class != "" && pr.Class != "operational" {
+			fmt.Fprintf(stdout, " [%s]", pr.Class)
+		}
+		fmt.Fprintln(stdout)
+	}
+	if len(profiles) == 0 {
+		fmt.Fprintln(stdout, "No eSIM profiles installed")
+	}
+	return 0
+}
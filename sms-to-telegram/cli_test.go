@@ -0,0 +1,151 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRunCLI(t *testing.T) {
+	clearConfigEnv(t)
+	// send and diag install their own logger.
+	defaultLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		stdout   string // substring expected on stdout
+		stderr   string // substring expected on stderr
+	}{
+		{"help", []string{"help"}, 0, "decode-pdu", ""},
+		{"unknown command", []string{"frobnicate"}, 2, "", `Unknown command "frobnicate"`},
+		{"legacy version flag", []string{"--version"}, 0, "dev", ""},
+		{"version command", []string{"version"}, 0, "dev", ""},
+		{"legacy stray argument", []string{"-version", "extra"}, 2, "", `Unexpected argument "extra"`},
+		{"command help", []string{"send", "-h"}, 0, "", "Usage: sms-to-telegram send [flags] <number> <text>"},
+		{"bad flag", []string{"diag", "-nope"}, 2, "", "flag provided but not defined"},
+		{"diag bad rounds", []string{"diag", "-report", "-rounds", "0"}, 2, "", "Invalid -rounds 0"},
+		{"diag without a device", []string{"diag", "-port", "/nonexistent/ttyUSB*"}, 1,
+			"Session:     FAIL: no device matches /nonexistent/ttyUSB*", ""},
+		{"diag JSON without a device", []string{"diag", "-port", "/nonexistent/ttyUSB*", "-json"}, 1,
+			`"ok": false`, ""},
+		{"check-config without env", []string{"check-config"}, 1, "FAIL  configuration", ""},
+		{"legacy check-config flag", []string{"--check-config"}, 1, "FAIL  configuration", ""},
+		{"send dry run", []string{"send", "-dry-run", "+4915550001234", "hello", "world"}, 0,
+			"Would send 1 part(s) to +4915550001234 (GSM 7-bit)", ""},
+		{"send UCS2 dry run", []string{"send", "-dry-run", "+4915550001234", "Привет"}, 0, "(UCS2)", ""},
+		{"send without text", []string{"send", "+4915550001234"}, 2, "", "Usage:"},
+		{"send to a name", []string{"send", "-dry-run", "Bank", "hi"}, 2, "", "not a phone number"},
+		{"emulate-modem stray argument", []string{"emulate-modem", "/dev/ttyUSB0"}, 2, "", "Usage: sms-to-telegram emulate-modem"},
+		{"decode", []string{"decode-pdu", testPDUSingle}, 0, "Тест1", ""},
+		{"decode garbage", []string{"decode-pdu", "zz"}, 1, "Error:", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runCLI(tt.args, &stdout, &stderr); code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d\nstdout: %s\nstderr: %s", code, tt.wantCode, stdout.String(), stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.stdout) {
+				t.Errorf("stdout lacks %q:\n%s", tt.stdout, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("stderr lacks %q:\n%s", tt.stderr, stderr.String())
+			}
+		})
+	}
+}
+
+// TestDiagJSONReport pins the -json of the modem-diag change: unlike the
+// first diag -json, it no longer implies -report.
+func TestDiagJSONReport(t *testing.T) {
+	for _, tt := range []struct {
+		args       []string
+		wantReport bool
+	}{
+		{[]string{"diag", "-port", "/nonexistent/ttyUSB*", "-json"}, false},
+		{[]string{"diag", "-port", "/nonexistent/ttyUSB*", "-json", "-report"}, true},
+	} {
+		var stdout, stderr bytes.Buffer
+		runCLI(tt.args, &stdout, &stderr)
+		var res struct {
+			OK     bool            `json:"ok"`
+			Report json.RawMessage `json:"at_report"`
+		}
+		if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+			t.Fatalf("%q: %v\n%s", tt.args, err, stdout.String())
+		}
+		if res.OK || (res.Report != nil) != tt.wantReport {
+			t.Errorf("%q: ok = %v, at_report = %s, want report %v", tt.args, res.OK, res.Report, tt.wantReport)
+		}
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	tests := []struct {
+		argv []string
+		want []string
+	}{
+		{[]string{"/usr/local/bin/sms-to-telegram"}, []string{}},
+		{[]string{"sms-to-telegram", "diag", "-report"}, []string{"diag", "-report"}},
+		{[]string{"/opt/sms-to-telegram/modem-diag", "-port", "/dev/ttyUSB2"}, []string{"diag", "-port", "/dev/ttyUSB2"}},
+		{[]string{"modem-diag"}, []string{"diag"}},
+	}
+	for _, tt := range tests {
+		if got := commandLine(tt.argv); !slices.Equal(got, tt.want) {
+			t.Errorf("commandLine(%q) = %q, want %q", tt.argv, got, tt.want)
+		}
+	}
+}
+
+func TestDecodePDUs(t *testing.T) {
+	var out bytes.Buffer
+	if code := decodePDUs(&out, []string{testPDUSingle, "00"}); code != 1 {
+		t.Errorf("exit code = %d, want 1 for the broken second PDU", code)
+	}
+	report := out.String()
+	for _, want := range []string{
+		"Sender:    +",
+		"Encoding:  UCS2",
+		"Text:      Тест1",
+		"\n\nError:     malformed PDU",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report lacks %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestResolveSerialPort(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"usb-SimTech_SIM7600-if03-port0", "usb-SimTech_SIM7600-if02-port0", "usb-FTDI-if00-port0"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		pattern string
+		want    string
+		wantErr bool
+	}{
+		{pattern: "/dev/ttyUSB2", want: "/dev/ttyUSB2"},
+		{pattern: filepath.Join(dir, "usb-SimTech_*"), want: filepath.Join(dir, "usb-SimTech_SIM7600-if02-port0")},
+		{pattern: filepath.Join(dir, "usb-SimTech_*-if03-port?"), want: filepath.Join(dir, "usb-SimTech_SIM7600-if03-port0")},
+		{pattern: filepath.Join(dir, "usb-Quectel_*"), wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := resolveSerialPort(tt.pattern)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolveSerialPort(%q) = %q, %v; want %q (error %v)", tt.pattern, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// commandRequest is one parsed command invocation.
+type commandRequest struct {
+	ChatID int64
+	UserID int64
+	Args   []string
+}
+
+// botCommand is one admin command. Handlers run on the bot's update
+// goroutine, never on the modem goroutine: they must not touch the serial
+// port (invariant 8). They return the HTML reply for the issuing chat; an
+// empty reply means the handler already answered (e.g. with a document).
+type botCommand struct {
+	usage       string
+	description string
+	handle      func(ctx context.Context, req commandRequest) string
+}
+
+// CommandRouter dispatches admin commands received via getUpdates long
+// polling. Only messages from TELEGRAM_ADMIN_IDS users are honored; anything
+// else is ignored without a reply, so the bot does not confirm its commands
+// to strangers.
+type CommandRouter struct {
+	sender      TelegramSender
+	admins      map[int64]struct{}
+	commands    map[string]botCommand
+	sendTimeout time.Duration
+}
+
+// NewCommandRouter creates a router with the built-in /help command.
+func NewCommandRouter(sender TelegramSender, adminIDs []int64, sendTimeout time.Duration) *CommandRouter {
+	r := &CommandRouter{
+		sender:      sender,
+		admins:      make(map[int64]struct{}, len(adminIDs)),
+		commands:    make(map[string]botCommand),
+		sendTimeout: sendTimeout,
+	}
+	for _, id := range adminIDs {
+		r.admins[id] = struct{}{}
+	}
+	r.Register("help", botCommand{
+		usage:       "/help",
+		description: "List available commands",
+		handle:      func(context.Context, commandRequest) string { return r.helpText() },
+	})
+	return r
+}
+
+// Register adds (or replaces) a command by name, without the leading slash.
+func (r *CommandRouter) Register(name string, cmd botCommand) {
+	r.commands[name] = cmd
+}
+
+// names returns the registered command names in sorted order.
+func (r *CommandRouter) names() []string {
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *CommandRouter) helpText() string {
+	var sb strings.Builder
+	sb.WriteString("<b>Commands</b>\n")
+	for _, name := range r.names() {
+		cmd := r.commands[name]
+		sb.WriteString(fmt.Sprintf("\n<code>%s</code> — %s", escapeHTML(cmd.usage), escapeHTML(cmd.description)))
+	}
+	return sb.String()
+}
+
+// PublishMenu registers the command list with Telegram (setMyCommands), so
+// the chat UI offers autocompletion. The menu is scoped to each admin's
+// private chat: the commands are admin-only, and the default scope would
+// advertise them to everyone who opens the bot. Failures are logged only;
+// the commands work without a menu.
+func (r *CommandRouter) PublishMenu(ctx context.Context, api CommandMenuSetter) {
+	var menu []models.BotCommand
+	for _, name := range r.names() {
+		menu = append(menu, models.BotCommand{Command: name, Description: r.commands[name].description})
+	}
+	for admin := range r.admins {
+		callCtx, cancel := context.WithTimeout(ctx, r.sendTimeout)
+		_, err := api.SetMyCommands(callCtx, &bot.SetMyCommandsParams{
+			Commands: menu,
+			Scope:    &models.BotCommandScopeChat{ChatID: admin},
+		})
+		cancel()
+		if err != nil {
+			slog.Warn("Failed to register bot command menu", "chat_id", admin, "error", err)
+			continue
+		}
+		slog.Debug("Bot command menu registered", "chat_id", admin, "commands", len(menu))
+	}
+}
+
+// parseCommand splits "/name@bot arg1 arg2" into its lower-cased name and
+// arguments. The @bot suffix Telegram adds in group chats is dropped.
+func parseCommand(text string) (string, []string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") || len(fields[0]) < 2 {
+		return "", nil, false
+	}
+	name := strings.TrimPrefix(fields[0], "/")
+	if at := strings.IndexByte(name, '@'); at >= 0 {
+		name = name[:at]
+	}
+	if name == "" {
+		return "", nil, false
+	}
+	return strings.ToLower(name), fields[1:], true
+}
+
+// HandleUpdate processes one Telegram update (bot.HandlerFunc adapter in run).
+func (r *CommandRouter) HandleUpdate(ctx context.Context, update *models.Update) {
+	if update == nil || update.Message == nil || update.Message.From == nil {
+		return
+	}
+	msg := update.Message
+	name, args, ok := parseCommand(msg.Text)
+	if !ok {
+		return
+	}
+	if _, isAdmin := r.admins[msg.From.ID]; !isAdmin {
+		slog.Warn("Ignoring bot command from non-admin user",
+			"user_id", msg.From.ID, "chat_id", msg.Chat.ID, "command", name)
+		return
+	}
+	cmd, known := r.commands[name]
+	if !known {
+		r.reply(ctx, msg.Chat.ID, fmt.Sprintf("Unknown command <code>/%s</code>. Try /help.", escapeHTML(name)))
+		return
+	}
+	slog.Info("Executing bot command", "command", name, "user_id", msg.From.ID, "chat_id", msg.Chat.ID)
+	req := commandRequest{ChatID: msg.Chat.ID, UserID: msg.From.ID, Args: args}
+	if reply := cmd.handle(ctx, req); reply != "" {
+		r.reply(ctx, msg.Chat.ID, reply)
+	}
+}
+
+func (r *CommandRouter) reply(ctx context.Context, chatID int64, text string) {
+	sendCtx, cancel := context.WithTimeout(ctx, r.sendTimeout)
+	defer cancel()
+	if _, err := r.sender.SendMessage(sendCtx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+	}); err != nil {
+		slog.Error("Failed to send command reply", "chat_id", chatID, "error", err)
+	}
+}
+
+// registerBlocklistCommands wires /block, /unblock and /blocked.
+func registerBlocklistCommands(r *CommandRouter, bl *SenderBlocklist) {
+	persistNote := func() string {
+		if bl.Persistent() {
+			return ""
+		}
+		return "\n<i>STATE_DIR is not set: the change is lost on restart.</i>"
+	}
+
+	r.Register("block", botCommand{
+		usage:       "/block <sender>",
+		description: "Drop (and delete) all future SMS from a sender",
+		handle: func(_ context.Context, req commandRequest) string {
+			args := req.Args
+			if len(args) != 1 {
+				return "Usage: <code>/block &lt;sender&gt;</code>"
+			}
+			added, err := bl.Block(args[0])
+			if err != nil {
+				slog.Error("Failed to persist blocklist", "error", err)
+				return fmt.Sprintf("Failed to block <code>%s</code>: %s", escapeHTML(args[0]), escapeHTML(err.Error()))
+			}
+			if !added {
+				return fmt.Sprintf("<code>%s</code> is already blocked.", escapeHTML(args[0]))
+			}
+			slog.Info("Sender blocked", "sender", args[0])
+			return fmt.Sprintf("Blocked <code>%s</code>.", escapeHTML(args[0])) + persistNote()
+		},
+	})
+
+	r.Register("unblock", botCommand{
+		usage:       "/unblock <sender>",
+		description: "Remove a sender from the blocklist",
+		handle: func(_ context.Context, req commandRequest) string {
+			args := req.Args
+			if len(args) != 1 {
+				return "Usage: <code>/unblock &lt;sender&gt;</code>"
+			}
+			removed, err := bl.Unblock(args[0])
+			switch {
+			case errors.Is(err, errStaticBlock):
+				return fmt.Sprintf("<code>%s</code> is blocked via BLOCKED_SENDERS; remove it from the configuration.",
+					escapeHTML(args[0]))
+			case err != nil:
+				slog.Error("Failed to persist blocklist", "error", err)
+				return fmt.Sprintf("Failed to unblock <code>%s</code>: %s", escapeHTML(args[0]), escapeHTML(err.Error()))
+			case !removed:
+				return fmt.Sprintf("<code>%s</code> is not blocked.", escapeHTML(args[0]))
+			}
+			slog.Info("Sender unblocked", "sender", args[0])
+			return fmt.Sprintf("Unblocked <code>%s</code>.", escapeHTML(args[0])) + persistNote()
+		},
+	})
+
+	r.Register("blocked", botCommand{
+		usage:       "/blocked",
+		description: "List blocked senders",
+		handle: func(context.Context, commandRequest) string {
+			static, runtime := bl.Entries()
+			if len(static) == 0 && len(runtime) == 0 {
+				return "No senders are blocked."
+			}
+			var sb strings.Builder
+			sb.WriteString("<b>Blocked senders</b>\n")
+			for _, s := range static {
+				sb.WriteString(fmt.Sprintf("\n<code>%s</code> (config)", escapeHTML(s)))
+			}
+			for _, s := range runtime {
+				sb.WriteString(fmt.Sprintf("\n<code>%s</code>", escapeHTML(s)))
+			}
+			return sb.String()
+		},
+	})
+}
+
+// registerStatusCommand wires /status, a health summary of the gateway.
+func registerStatusCommand(r *CommandRouter, src StatusSources) {
+	r.Register("status", botCommand{
+		usage:       "/status",
+		description: "Show uptime, modem, signal, storage and queue state",
+		handle:      func(context.Context, commandRequest) string { return statusText(src) },
+	})
+}
+
+// exportDefaultDays is the range /export covers without explicit dates.
+const exportDefaultDays = 7
+
+// parseExportArgs parses "/export [from] [to] [csv|json]". Dates are
+// YYYY-MM-DD in the host's local time; to is inclusive. Returns the
+// half-open range [from, to+1d).
+func parseExportArgs(args []string, now time.Time) (from, to time.Time, format string, err error) {
+	format = "csv"
+	var dates []time.Time
+	for _, arg := range args {
+		switch strings.ToLower(arg) {
+		case "csv", "json":
+			format = strings.ToLower(arg)
+			continue
+		}
+		d, perr := time.ParseInLocation("2006-01-02", arg, now.Location())
+		if perr != nil {
+			return time.Time{}, time.Time{}, "", fmt.Errorf("invalid date %q (use YYYY-MM-DD)", arg)
+		}
+		dates = append(dates, d)
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch len(dates) {
+	case 0:
+		from, to = today.AddDate(0, 0, -(exportDefaultDays-1)), today
+	case 1:
+		from, to = dates[0], today
+	case 2:
+		from, to = dates[0], dates[1]
+	default:
+		return time.Time{}, time.Time{}, "", fmt.Errorf("at most two dates")
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, "", fmt.Errorf("end date before start date")
+	}
+	return from, to.AddDate(0, 0, 1), format, nil
+}
+
+// registerExportCommand wires /export, which uploads archived messages as a
+// CSV or JSON document to the requesting chat.
+func registerExportCommand(r *CommandRouter, archive *MessageArchive, docs DocumentSender) {
+	r.Register("export", botCommand{
+		usage:       "/export [from] [to] [csv|json]",
+		description: fmt.Sprintf("Export archived SMS (dates YYYY-MM-DD, default last %d days)", exportDefaultDays),
+		handle: func(ctx context.Context, req commandRequest) string {
+			from, to, format, err := parseExportArgs(req.Args, clk.Now())
+			if err != nil {
+				return fmt.Sprintf("Usage: <code>/export [from] [to] [csv|json]</code>\n%s", escapeHTML(err.Error()))
+			}
+			records, err := archive.Query(from, to)
+			if err != nil {
+				slog.Error("Archive export failed", "error", err)
+				return fmt.Sprintf("Export failed: %s", escapeHTML(err.Error()))
+			}
+			last := to.AddDate(0, 0, -1).Format("2006-01-02")
+			if len(records) == 0 {
+				return fmt.Sprintf("No archived SMS between %s and %s.", from.Format("2006-01-02"), last)
+			}
+
+			var data []byte
+			if format == "json" {
+				data, err = exportJSON(records)
+			} else {
+				data, err = exportCSV(records)
+			}
+			if err != nil {
+				return fmt.Sprintf("Export failed: %s", escapeHTML(err.Error()))
+			}
+
+			filename := fmt.Sprintf("sms-%s_%s.%s", from.Format("2006-01-02"), last, format)
+			sendCtx, cancel := context.WithTimeout(ctx, r.sendTimeout)
+			defer cancel()
+			if _, err := docs.SendDocument(sendCtx, &bot.SendDocumentParams{
+				ChatID:   req.ChatID,
+				Document: &models.InputFileUpload{Filename: filename, Data: bytes.NewReader(data)},
+				Caption:  fmt.Sprintf("%d SMS, %s – %s", len(records), from.Format("2006-01-02"), last),
+			}); err != nil {
+				slog.Error("Failed to upload archive export", "chat_id", req.ChatID, "error", err)
+				return fmt.Sprintf("Failed to upload the export: %s", escapeHTML(err.Error()))
+			}
+			slog.Info("Archive exported", "chat_id", req.ChatID, "records", len(records), "format", format)
+			return ""
+		},
+	})
+}
@@ -0,0 +1,262 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const testAdminID = 555
+
+func commandUpdate(userID, chatID int64, text string) *models.Update {
+	return &models.Update{Message: &models.Message{
+		From: &models.User{ID: userID},
+		Chat: models.Chat{ID: chatID},
+		Text: text,
+	}}
+}
+
+func newTestRouter(t *testing.T) (*CommandRouter, *fakeSender, *SenderBlocklist) {
+	t.Helper()
+	sender := &fakeSender{}
+	bl, err := NewSenderBlocklist([]string{"StaticSpam"}, "")
+	if err != nil {
+		t.Fatalf("NewSenderBlocklist() error = %v", err)
+	}
+	router := NewCommandRouter(sender, []int64{testAdminID}, time.Second)
+	registerBlocklistCommands(router, bl)
+	return router, sender, bl
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text     string
+		wantName string
+		wantArgs []string
+		wantOK   bool
+	}{
+		{"/block 900123", "block", []string{"900123"}, true},
+		{"/Block@sms_gateway_bot  +49 ", "block", []string{"+49"}, true},
+		{"/help", "help", nil, true},
+		{"hello /block", "", nil, false},
+		{"/", "", nil, false},
+		{"/@bot", "", nil, false},
+		{"", "", nil, false},
+	}
+	for _, tt := range tests {
+		name, args, ok := parseCommand(tt.text)
+		if ok != tt.wantOK || name != tt.wantName || strings.Join(args, ",") != strings.Join(tt.wantArgs, ",") {
+			t.Errorf("parseCommand(%q) = %q, %v, %v; want %q, %v, %v",
+				tt.text, name, args, ok, tt.wantName, tt.wantArgs, tt.wantOK)
+		}
+	}
+}
+
+func TestCommandRouter_BlockUnblock(t *testing.T) {
+	router, sender, bl := newTestRouter(t)
+	ctx := context.Background()
+
+	router.HandleUpdate(ctx, commandUpdate(testAdminID, 42, "/block +900123"))
+	if !bl.Blocked("900123") {
+		t.Fatal("/block did not block the sender")
+	}
+	replies := sender.sentTo(42)
+	if len(replies) != 1 || !strings.Contains(replies[0].Text, "Blocked") {
+		t.Fatalf("replies = %+v, want one confirmation", replies)
+	}
+	if !strings.Contains(replies[0].Text, "STATE_DIR") {
+		t.Error("reply must warn that the change is not persisted without STATE_DIR")
+	}
+
+	router.HandleUpdate(ctx, commandUpdate(testAdminID, 42, "/unblock 900123"))
+	if bl.Blocked("900123") {
+		t.Error("/unblock did not unblock the sender")
+	}
+
+	router.HandleUpdate(ctx, commandUpdate(testAdminID, 42, "/unblock StaticSpam"))
+	last := sender.sentTo(42)[len(sender.sentTo(42))-1]
+	if !strings.Contains(last.Text, "BLOCKED_SENDERS") {
+		t.Errorf("unblocking a static entry reply = %q, want a configuration hint", last.Text)
+	}
+}
+
+func TestCommandRouter_IgnoresNonAdmins(t *testing.T) {
+	router, sender, bl := newTestRouter(t)
+
+	router.HandleUpdate(context.Background(), commandUpdate(999, 42, "/block 900123"))
+	if bl.Blocked("900123") {
+		t.Error("non-admin was able to block a sender")
+	}
+	if len(sender.sent) != 0 {
+		t.Errorf("non-admin got %d replies, want none", len(sender.sent))
+	}
+}
+
+func TestCommandRouter_UsageAndUnknown(t *testing.T) {
+	router, sender, _ := newTestRouter(t)
+	ctx := context.Background()
+
+	router.HandleUpdate(ctx, commandUpdate(testAdminID, 42, "/block"))
+	router.HandleUpdate(ctx, commandUpdate(testAdminID, 42, "/frobnicate"))
+	router.HandleUpdate(ctx, commandUpdate(testAdminID, 42, "just chatting"))
+	router.HandleUpdate(ctx, &models.Update{})
+
+	replies := sender.sentTo(42)
+	if len(replies) != 2 {
+		t.Fatalf("replies = %d, want 2 (usage + unknown; plain text ignored)", len(replies))
+	}
+	if !strings.Contains(replies[0].Text, "Usage") {
+		t.Errorf("reply = %q, want usage", replies[0].Text)
+	}
+	if !strings.Contains(replies[1].Text, "Unknown command") {
+		t.Errorf("reply = %q, want unknown command", replies[1].Text)
+	}
+}
+
+func TestCommandRouter_HelpListsCommands(t *testing.T) {
+	router, sender, _ := newTestRouter(t)
+	router.HandleUpdate(context.Background(), commandUpdate(testAdminID, 42, "/help"))
+
+	replies := sender.sentTo(42)
+	if len(replies) != 1 {
+		t.Fatalf("replies = %d, want 1", len(replies))
+	}
+	for _, name := range []string{"/block", "/unblock", "/blocked", "/help"} {
+		if !strings.Contains(replies[0].Text, name) {
+			t.Errorf("help text missing %s", name)
+		}
+	}
+	if strings.Contains(replies[0].Text, "<sender>") {
+		t.Error("usage placeholders must be HTML-escaped")
+	}
+}
+
+// fakeMenu records setMyCommands calls.
+type fakeMenu struct {
+	calls []*bot.SetMyCommandsParams
+	err   error
+}
+
+func (f *fakeMenu) SetMyCommands(_ context.Context, params *bot.SetMyCommandsParams) (bool, error) {
+	f.calls = append(f.calls, params)
+	return f.err == nil, f.err
+}
+
+func TestCommandRouter_PublishMenu(t *testing.T) {
+	router, _, _ := newTestRouter(t)
+	menu := &fakeMenu{}
+	router.PublishMenu(context.Background(), menu)
+
+	if len(menu.calls) != 1 {
+		t.Fatalf("setMyCommands calls = %d, want one per admin", len(menu.calls))
+	}
+	call := menu.calls[0]
+	if scope, ok := call.Scope.(*models.BotCommandScopeChat); !ok || scope.ChatID != int64(testAdminID) {
+		t.Errorf("scope = %#v, want the admin's private chat", call.Scope)
+	}
+	var names []string
+	for _, cmd := range call.Commands {
+		if cmd.Description == "" {
+			t.Errorf("/%s has no description", cmd.Command)
+		}
+		names = append(names, cmd.Command)
+	}
+	if got := strings.Join(names, ","); got != "block,blocked,help,unblock" {
+		t.Errorf("commands = %s", got)
+	}
+
+	// A failure is logged, not fatal.
+	router.PublishMenu(context.Background(), &fakeMenu{err: errors.New("Forbidden")})
+}
+
+func TestCommandRouter_BlockedList(t *testing.T) {
+	router, sender, _ := newTestRouter(t)
+	ctx := context.Background()
+	router.HandleUpdate(ctx, commandUpdate(testAdminID, 42, "/block Promo"))
+	router.HandleUpdate(ctx, commandUpdate(testAdminID, 42, "/blocked"))
+
+	replies := sender.sentTo(42)
+	list := replies[len(replies)-1].Text
+	if !strings.Contains(list, "promo") || !strings.Contains(list, "staticspam</code> (config)") {
+		t.Errorf("/blocked reply = %q, want runtime and static entries", list)
+	}
+}
+
+func TestParseExportArgs(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 4, 0, 0, time.UTC)
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		args       string
+		from, to   time.Time
+		wantFormat string
+		wantErr    bool
+	}{
+		{"", day(4), day(11), "csv", false},
+		{"JSON", day(4), day(11), "json", false},
+		{"2026-03-01", day(1), day(11), "csv", false},
+		{"2026-03-01 2026-03-02 json", day(1), day(3), "json", false},
+		{"2026-03-02 2026-03-01", time.Time{}, time.Time{}, "", true},
+		{"yesterday", time.Time{}, time.Time{}, "", true},
+		{"2026-03-01 2026-03-02 2026-03-03", time.Time{}, time.Time{}, "", true},
+	}
+	for _, tt := range tests {
+		from, to, format, err := parseExportArgs(strings.Fields(tt.args), now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseExportArgs(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			continue
+		}
+		if !from.Equal(tt.from) || !to.Equal(tt.to) || format != tt.wantFormat {
+			t.Errorf("parseExportArgs(%q) = %v, %v, %q; want %v, %v, %q",
+				tt.args, from, to, format, tt.from, tt.to, tt.wantFormat)
+		}
+	}
+}
+
+func TestCommandRouter_Export(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	router, sender, _ := newTestRouter(t)
+	archive := NewMessageArchive(filepath.Join(t.TempDir(), archiveFileName))
+	docs := &fakeDocSender{}
+	registerExportCommand(router, archive, docs)
+	ctx := context.Background()
+
+	router.HandleUpdate(ctx, commandUpdate(testAdminID, 42, "/export"))
+	if replies := sender.sentTo(42); len(replies) != 1 || !strings.Contains(replies[0].Text, "No archived SMS") {
+		t.Fatalf("replies = %+v, want an empty-range notice", replies)
+	}
+
+	smsTime := clk.Now().Add(-time.Hour)
+	if err := archive.Record(archivedSMS("+100", "code 1234", smsTime, 3), archiveForwarded, nil); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	router.HandleUpdate(ctx, commandUpdate(testAdminID, 42, "/export json"))
+
+	if len(docs.docs) != 1 {
+		t.Fatalf("documents = %d, want 1", len(docs.docs))
+	}
+	doc := docs.docs[0]
+	if doc.ChatID != 42 || doc.Filename != "sms-2025-12-26_2026-01-01.json" {
+		t.Errorf("document = %+v, want sms-2025-12-26_2026-01-01.json to chat 42", doc)
+	}
+	if !strings.Contains(string(doc.Data), "code 1234") || !strings.HasPrefix(doc.Caption, "1 SMS") {
+		t.Errorf("document = %+v, want the archived SMS", doc)
+	}
+	if len(sender.sentTo(42)) != 1 {
+		t.Error("a successful export must not send an extra text reply")
+	}
+
+	docs.err = errors.New("upload failed")
+	router.HandleUpdate(ctx, commandUpdate(testAdminID, 42, "/export"))
+	if replies := sender.sentTo(42); len(replies) != 2 || !strings.Contains(replies[1].Text, "upload failed") {
+		t.Errorf("replies = %+v, want the upload error reported", replies)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSenderFlag(t *testing.T) {
+	tests := []struct {
+		from, country, flag string
+	}{
+		{"+358449480778", "FI", "🇫🇮"},
+		{"+35818123456", "AX", "🇦🇽"},
+		{"+12125550100", "US", "🇺🇸"},
+		{"+14165550100", "CA", "🇨🇦"},
+		{"+18765550100", "JM", "🇯🇲"},
+		{"+79161234567", "RU", "🇷🇺"},
+		{"+77011234567", "KZ", "🇰🇿"},
+		{"+441624123456", "IM", "🇮🇲"},
+		{"+447911123456", "GB", "🇬🇧"},
+		{"+4915112345678", "DE", "🇩🇪"},
+		{"+8001234", "", ""},
+		{"0449480778", "", ""},
+		{"Google", "", ""},
+		{"+", "", ""},
+		{"+358 44 948", "", ""},
+	}
+	for _, tt := range tests {
+		if got := senderCountry(tt.from); got != tt.country {
+			t.Errorf("senderCountry(%q) = %q, want %q", tt.from, got, tt.country)
+		}
+		if got := senderFlag(tt.from); got != tt.flag {
+			t.Errorf("senderFlag(%q) = %q, want %q", tt.from, got, tt.flag)
+		}
+	}
+}
+
+func TestFormatMessageHeader_Flag(t *testing.T) {
+	if got := formatMessageHeader(SMSMessage{From: "+358449480778"}); !strings.Contains(got, "<b>From:</b> 🇫🇮 <code>+358449480778</code>\n") {
+		t.Errorf("header lacks the flag:\n%s", got)
+	}
+	if got := formatMessageHeader(SMSMessage{From: "Bank<1>"}); !strings.Contains(got, "<b>From:</b> <code>Bank&lt;1&gt;</code>\n") {
+		t.Errorf("header of an alphanumeric sender:\n%s", got)
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Web dashboard (DASHBOARD): a static page under /ui/ that reads the JSON
+// endpoints of the HTTP API — the archive inbox, status, signal history and
+// log tail — and, with DASHBOARD_ALLOW_SEND, sends SMS through the Outbox.
+// The page itself holds no data and is served without the token; the
+// browser sends it as a bearer token on every API request.
+
+//go:embed web
+var dashboardFiles embed.FS
+
+const (
+	// logTailSize is the number of log lines the dashboard shows.
+	logTailSize = 200
+	// apiMaxSendBody bounds a POST /api/v1/send body.
+	apiMaxSendBody = 16 << 10
+)
+
+// DashboardOptions are the sources of the dashboard endpoints.
+type DashboardOptions struct {
+	Status StatusSources
+	Logs   *LogTail
+	// Outbox sends the SMS of the send form; nil disables it.
+	Outbox *Outbox
+}
+
+// EnableDashboard serves the dashboard and its endpoints. Call before
+// Serve.
+func (s *APIServer) EnableDashboard(opts DashboardOptions) {
+	s.dashboard = &opts
+	web, _ := fs.Sub(dashboardFiles, "web")
+	files := http.StripPrefix("/ui/", http.FileServerFS(web))
+	s.mux.Handle("GET /ui/", dashboardHeaders(files))
+	s.mux.Handle("GET /{$}", http.RedirectHandler("/ui/", http.StatusFound))
+	s.mux.HandleFunc("GET /api/v1/status", s.handleStatus)
+	s.mux.HandleFunc("GET /api/v1/signal", s.handleSignal)
+	s.mux.HandleFunc("GET /api/v1/cells", s.handleCells)
+	s.mux.HandleFunc("GET /api/v1/logs", s.handleLogs)
+	if opts.Outbox != nil {
+		s.mux.HandleFunc("POST /api/v1/send", s.handleSend)
+	}
+}
+
+// dashboardPublic reports whether p is part of the static page, which is
+// served without the token. p is judged cleaned: "/ui/../api/v1/logs" is
+// the log tail, not the page.
+func dashboardPublic(p string) bool {
+	if p != "/" && !strings.HasPrefix(p, "/ui/") {
+		return false
+	}
+	clean := path.Clean(p)
+	return clean == "/" || clean == "/ui" || strings.HasPrefix(clean, "/ui/")
+}
+
+// dashboardHeaders locks the page down to its own scripts: SMS text is
+// attacker-controlled and only ever inserted as text, this is the second
+// line of defense.
+func dashboardHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", "default-src 'none'; script-src 'self'; style-src 'self'; connect-src 'self'; img-src 'self'; form-action 'none'; frame-ancestors 'none'; base-uri 'none'")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "no-referrer")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiStatus is the body of GET /api/v1/status: what /status shows, as JSON.
+type apiStatus struct {
+	Host          string         `json:"host"`
+	Version       string         `json:"version"`
+	Commit        string         `json:"commit,omitempty"`
+	UptimeSeconds int64          `json:"uptime_seconds"`
+	Modem         string         `json:"modem"` // "healthy" or why it is down
+	Alerts        []string       `json:"alerts"`
+	Operator      string         `json:"operator,omitempty"`
+	Signal        *SignalSample  `json:"signal,omitempty"`
+	Reception     string         `json:"reception,omitempty"`
+	Battery       *BatterySample `json:"battery,omitempty"`
+	SIMUsed       *int           `json:"sim_used,omitempty"`
+	SIMTotal      int            `json:"sim_total,omitempty"`
+	LastSMS       *time.Time     `json:"last_sms,omitempty"`
+	SMSWaiting    int            `json:"sms_waiting"`
+	PartsWaiting  int            `json:"parts_waiting"`
+	Outgoing      int            `json:"outgoing"`
+	// Webhook retry queue (WEBHOOK_RETRY_MAX_AGE); absent without one.
+	WebhookQueued      *int              `json:"webhook_queued,omitempty"`
+	WebhookDeadLetters *int              `json:"webhook_dead_letters,omitempty"`
+	Ready              bool              `json:"ready"`
+	Checks             map[string]string `json:"checks"`
+	// What the page can offer.
+	Inbox bool `json:"inbox"`
+	Send  bool `json:"send"`
+}
+
+func (s *APIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	src := s.dashboard.Status
+	m := src.Notifier.metrics.snapshot()
+	now := clk.Now()
+	st := apiStatus{
+		Host:          src.Notifier.hostname,
+		Version:       src.Build.Version,
+		Commit:        src.Build.ShortCommit(),
+		UptimeSeconds: int64(now.Sub(m.startedAt).Seconds()),
+		Modem:         "healthy",
+		Alerts:        src.Notifier.ActiveAlerts(),
+		Operator:      m.operator,
+		Reception:     m.reception,
+		Battery:       m.battery,
+		SMSWaiting:    m.smsWaiting,
+		PartsWaiting:  m.partsWaiting,
+		Outgoing:      src.Outbox.Queued(),
+		Inbox:         s.archive != nil,
+		Send:          s.dashboard.Outbox != nil,
+	}
+	if m.modemReason != "" {
+		st.Modem = m.modemReason
+	}
+	if src.SelfTest.Failing() {
+		st.Alerts = append(st.Alerts, "Self-test Failing")
+	}
+	if st.Alerts == nil {
+		st.Alerts = []string{}
+	}
+	if history := src.Notifier.metrics.SignalHistory(); len(history) > 0 && m.rssi >= 0 {
+		st.Signal = &history[len(history)-1]
+	}
+	if m.simUsed >= 0 {
+		st.SIMUsed, st.SIMTotal = &m.simUsed, m.simTotal
+	}
+	if !m.lastSMSAt.IsZero() {
+		st.LastSMS = &m.lastSMSAt
+	}
+	if src.Webhooks != nil {
+		queued, dead := src.Webhooks.Stats()
+		st.WebhookQueued, st.WebhookDeadLetters = &queued, &dead
+	}
+	st.Ready, st.Checks = s.health.Ready(r.Context())
+	writeAPIJSON(w, http.StatusOK, st)
+}
+
+// handleCells serves the recent serving-cell changes, oldest first.
+func (s *APIServer) handleCells(w http.ResponseWriter, r *http.Request) {
+	changes := s.dashboard.Status.Notifier.metrics.CellHistory()
+	if changes == nil {
+		changes = []CellChange{}
+	}
+	writeAPIJSON(w, http.StatusOK, map[string][]CellChange{"changes": changes})
+}
+
+// handleSignal serves the recent signal samples, oldest first.
+func (s *APIServer) handleSignal(w http.ResponseWriter, r *http.Request) {
+	samples := s.dashboard.Status.Notifier.metrics.SignalHistory()
+	if samples == nil {
+		samples = []SignalSample{}
+	}
+	writeAPIJSON(w, http.StatusOK, map[string][]SignalSample{"samples": samples})
+}
+
+// handleLogs serves the last log lines at INFO and above.
+func (s *APIServer) handleLogs(w http.ResponseWriter, r *http.Request) {
+	writeAPIJSON(w, http.StatusOK, map[string][]string{"lines": s.dashboard.Logs.Lines()})
+}
+
+// apiSendRequest is the body of POST /api/v1/send.
+type apiSendRequest struct {
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+// handleSend sends one SMS and waits until the modem submitted it.
+func (s *APIServer) handleSend(w http.ResponseWriter, r *http.Request) {
+	var req apiSendRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxSendBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), grpcSendDeadline)
+	defer cancel()
+	res, err := s.dashboard.Outbox.Send(ctx, req.To, req.Text)
+	switch {
+	case errors.Is(err, errInvalidSMS):
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]any{"parts": res.Parts, "references": res.References})
+}
+
+// LogTail keeps the last log lines for the dashboard. It only sees records
+// at INFO and above, which never hold SMS content, formatted like the
+// journal (logfmt, LOG_PRIVACY applied). Nil-safe.
+type LogTail struct {
+	mu    sync.Mutex
+	lines []string
+	text  slog.Handler // formats into Write
+}
+
+func NewLogTail(cfg *Config) *LogTail {
+	t := &LogTail{}
+	opts := &slog.HandlerOptions{Level: max(cfg.LogLevel, slog.LevelInfo)}
+	if cfg.LogPrivacy {
+		opts.ReplaceAttr = redactLogAttr
+	}
+	t.text = traceHandler{slog.NewTextHandler(t, opts)}
+	return t
+}
+
+// Write takes one formatted record.
+func (t *LogTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines = append(t.lines, strings.TrimSuffix(string(p), "\n"))
+	if len(t.lines) > logTailSize {
+		t.lines = t.lines[1:]
+	}
+	return len(p), nil
+}
+
+// Lines returns the kept lines, oldest first.
+func (t *LogTail) Lines() []string {
+	lines := []string{}
+	if t == nil {
+		return lines
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append(lines, t.lines...)
+}
+
+// Wrap returns next teeing its records into the tail.
+func (t *LogTail) Wrap(next slog.Handler) slog.Handler {
+	return teeHandler{next: next, tail: t.text}
+}
+
+type teeHandler struct {
+	next, tail slog.Handler
+}
+
+func (h teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level) || h.tail.Enabled(ctx, level)
+}
+
+func (h teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.tail.Enabled(ctx, r.Level) {
+		h.tail.Handle(ctx, r.Clone())
+	}
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return teeHandler{next: h.next.WithAttrs(attrs), tail: h.tail.WithAttrs(attrs)}
+}
+
+func (h teeHandler) WithGroup(name string) slog.Handler {
+	return teeHandler{next: h.next.WithGroup(name), tail: h.tail.WithGroup(name)}
+}
@@ -0,0 +1,226 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestDashboard serves the dashboard over newTestAPI's archive with the
+// given outbox (nil: no send form).
+func newTestDashboard(t *testing.T, outbox *Outbox) (*APIServer, *ErrorNotifier, *LogTail) {
+	t.Helper()
+	api := newTestAPI(t, "s3cret")
+	notifier := NewErrorNotifier(&fakeSender{}, []int64{1}, false, "gw<1>", time.Second)
+	notifier.metrics = NewMetrics()
+	logs := NewLogTail(&Config{LogLevel: slog.LevelDebug})
+	api.EnableDashboard(DashboardOptions{
+		Status: StatusSources{Notifier: notifier, Outbox: outbox, Build: BuildInfo{Version: "1.2.0"}},
+		Logs:   logs,
+		Outbox: outbox,
+	})
+	return api, notifier, logs
+}
+
+func dashboardRequest(api *APIServer, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDashboard_StaticPage(t *testing.T) {
+	api, _, _ := newTestDashboard(t, nil)
+	tests := []struct {
+		target   string
+		wantCode int
+		wantBody string
+	}{
+		{"/", http.StatusFound, ""},
+		{"/ui/", http.StatusOK, `<script src="app.js"`},
+		{"/ui/app.js", http.StatusOK, "textContent"},
+		{"/ui/style.css", http.StatusOK, "body"},
+		{"/ui/missing.js", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			// The page is served without the token: it holds no data.
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.wantCode || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Fatalf("status = %d, want %d; body:\n%s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if strings.HasPrefix(tt.target, "/ui/") && !strings.Contains(rec.Header().Get("Content-Security-Policy"), "script-src 'self'") {
+				t.Errorf("CSP = %q", rec.Header().Get("Content-Security-Policy"))
+			}
+		})
+	}
+
+	// The data behind it is not.
+	for _, target := range []string{"/api/v1/status", "/api/v1/signal", "/api/v1/cells", "/api/v1/logs"} {
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("anonymous %s: status = %d, want 401", target, rec.Code)
+		}
+	}
+	// Without DASHBOARD there is no page to serve anonymously.
+	rec := httptest.NewRecorder()
+	newTestAPI(t, "s3cret").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("/ui/ without DASHBOARD: status = %d, want 401", rec.Code)
+	}
+}
+
+func TestDashboard_StatusAndSignal(t *testing.T) {
+	api, notifier, _ := newTestDashboard(t, nil)
+	notifier.metrics.SignalSampled(99)
+	notifier.metrics.SignalSampled(20)
+	notifier.metrics.OperatorSampled("Elisa")
+	notifier.metrics.ModemHealthy()
+
+	rec := dashboardRequest(api, http.MethodGet, "/api/v1/status", "")
+	var st apiStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, %v: %s", rec.Code, err, rec.Body)
+	}
+	if st.Host != "gw<1>" || st.Version != "1.2.0" || st.Modem != "healthy" || st.Operator != "Elisa" {
+		t.Errorf("status = %+v", st)
+	}
+	if st.Signal == nil || st.Signal.CSQ != 20 || st.Signal.DBm == nil || *st.Signal.DBm != csqToDBm(20) {
+		t.Errorf("signal = %+v", st.Signal)
+	}
+	if !st.Inbox || st.Send || st.SIMUsed != nil || st.LastSMS != nil || len(st.Alerts) != 0 {
+		t.Errorf("status = %+v", st)
+	}
+
+	rec = dashboardRequest(api, http.MethodGet, "/api/v1/signal", "")
+	var signal struct{ Samples []SignalSample }
+	if err := json.Unmarshal(rec.Body.Bytes(), &signal); err != nil {
+		t.Fatal(err)
+	}
+	if len(signal.Samples) != 2 || signal.Samples[0].DBm != nil || signal.Samples[1].CSQ != 20 {
+		t.Errorf("samples = %s", rec.Body)
+	}
+
+	rec = dashboardRequest(api, http.MethodGet, "/api/v1/cells", "")
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"changes":[]}` {
+		t.Errorf("cells without tracking = %s", body)
+	}
+	notifier.metrics.CellChanged(CellChange{LAC: "4E48", CellID: "1F4E"})
+	rec = dashboardRequest(api, http.MethodGet, "/api/v1/cells", "")
+	var cells struct{ Changes []CellChange }
+	if err := json.Unmarshal(rec.Body.Bytes(), &cells); err != nil {
+		t.Fatal(err)
+	}
+	if len(cells.Changes) != 1 || cells.Changes[0].CellID != "1F4E" {
+		t.Errorf("cells = %s", rec.Body)
+	}
+}
+
+func TestDashboard_Logs(t *testing.T) {
+	api, _, logs := newTestDashboard(t, nil)
+	logger := slog.New(logs.Wrap(slog.DiscardHandler))
+	logger.Debug("SMS content", "text", "123456")
+	for i := range logTailSize + 5 {
+		logger.Info("Polled", "n", i)
+	}
+
+	rec := dashboardRequest(api, http.MethodGet, "/api/v1/logs", "")
+	var body struct{ Lines []string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Lines) != logTailSize {
+		t.Fatalf("got %d lines, want %d", len(body.Lines), logTailSize)
+	}
+	if !strings.Contains(body.Lines[0], "msg=Polled n=5") || !strings.Contains(body.Lines[logTailSize-1], "n=204") {
+		t.Errorf("lines %q ... %q", body.Lines[0], body.Lines[logTailSize-1])
+	}
+	if strings.Contains(rec.Body.String(), "123456") {
+		t.Error("DEBUG record reached the dashboard")
+	}
+}
+
+func TestDashboard_Send(t *testing.T) {
+	submitter := &fakeSubmitter{}
+	outbox := NewOutbox(false)
+	go func() { outbox.submit(submitter, <-outbox.pending()) }()
+	api, _, _ := newTestDashboard(t, outbox)
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{"bad number", `{"to":"call me","text":"hi"}`, http.StatusBadRequest},
+		{"unknown field", `{"to":"+4915550001234","text":"hi","x":1}`, http.StatusBadRequest},
+		{"sent", `{"to":"+4915550001234","text":"hi"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := dashboardRequest(api, http.MethodPost, "/api/v1/send", tt.body)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+	if len(submitter.pdus) != 1 {
+		t.Errorf("modem got %d PDUs, want 1", len(submitter.pdus))
+	}
+
+	// Without DASHBOARD_ALLOW_SEND the form has nowhere to post.
+	api, _, _ = newTestDashboard(t, nil)
+	if rec := dashboardRequest(api, http.MethodPost, "/api/v1/send", tests[2].body); rec.Code != http.StatusMethodNotAllowed && rec.Code != http.StatusNotFound {
+		t.Errorf("send without outbox: status = %d", rec.Code)
+	}
+}
+
+func TestDashboard_Unauthenticated(t *testing.T) {
+	submitter := &fakeSubmitter{}
+	outbox := NewOutbox(false)
+	go func() { outbox.submit(submitter, <-outbox.pending()) }()
+	api, _, logs := newTestDashboard(t, outbox)
+	slog.New(logs.Wrap(slog.DiscardHandler)).Info("Polled")
+
+	tests := []struct {
+		method, target, auth, body string
+		wantCode                   int
+	}{
+		{http.MethodGet, "/api/v1/status", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/logs", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/logs", "Bearer wrong", "", http.StatusUnauthorized},
+		{http.MethodPost, "/api/v1/send", "", `{"to":"+4915550001234","text":"hi"}`, http.StatusUnauthorized},
+		{http.MethodPost, "/api/v1/send", "Bearer wrong", `{"to":"+4915550001234","text":"hi"}`, http.StatusUnauthorized},
+		// The public page is no way around the check.
+		{http.MethodGet, "/ui/../api/v1/logs", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "/ui/%2e%2e/api/v1/status", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target+" "+tt.auth, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if strings.Contains(rec.Body.String(), "Polled") || strings.Contains(rec.Body.String(), "gw&lt;1&gt;") {
+				t.Errorf("body leaks dashboard data: %s", rec.Body)
+			}
+		})
+	}
+	if len(submitter.pdus) != 0 {
+		t.Errorf("modem got %d PDUs from anonymous requests, want 0", len(submitter.pdus))
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// deliveredFileName is the delivered-PDU store inside STATE_DIR.
+const deliveredFileName = "delivered_pdus.json"
+
+// deliveredRetention bounds the store. A duplicate shows up on the next
+// poll (failed AT+CMGD) or the next start (crash before the delete), so a
+// week is plenty.
+const deliveredRetention = 7 * 24 * time.Hour
+
+// DeliveredStore remembers the PDU hash of every forwarded SMS, so an SMS
+// that is still on the SIM after its delivery (AT+CMGD failed, or the
+// process died before deleting it) is deleted instead of forwarded again.
+// It is persisted to STATE_DIR when configured (in-memory only otherwise,
+// which still covers failed deletes).
+//
+// Used by the delivery goroutine only.
+type DeliveredStore struct {
+	path string // empty: not persisted
+	seen map[string]time.Time
+}
+
+// NewDeliveredStore loads the store from stateDir, if set. An unreadable
+// file is logged and replaced: losing it costs duplicates, not SMS.
+func NewDeliveredStore(stateDir string) *DeliveredStore {
+	s := &DeliveredStore{seen: make(map[string]time.Time)}
+	if stateDir == "" {
+		return s
+	}
+	s.path = filepath.Join(stateDir, deliveredFileName)
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &s.seen)
+	}
+	if err != nil {
+		slog.Error("Ignoring delivered-PDU store", "path", s.path, "error", err)
+		s.seen = make(map[string]time.Time)
+	}
+	s.prune()
+	return s
+}
+
+// pduHash identifies an SMS by its raw PDUs, SIM slots aside: a duplicate
+// may sit in another slot. "" when the PDUs are unknown or injected, which
+// are meant to be sent again (never deduplicated).
+// 128 bits: a collision would delete an undelivered SMS.
+func pduHash(pending PendingSMS) string {
+	if len(pending.RawPDUs) == 0 || isInjected(pending) {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.ToUpper(strings.Join(pending.RawPDUs, ","))))
+	return fmt.Sprintf("%x", sum[:16])
+}
+
+// Seen reports whether an SMS with this PDU hash was forwarded before.
+// Nil-safe.
+func (s *DeliveredStore) Seen(hash string) bool {
+	if s == nil || hash == "" {
+		return false
+	}
+	_, ok := s.seen[hash]
+	return ok
+}
+
+// Record remembers a forwarded SMS. Save failures are logged, never block
+// delivery. Nil-safe.
+func (s *DeliveredStore) Record(hash string) {
+	if s == nil || hash == "" {
+		return
+	}
+	s.seen[hash] = clk.Now()
+	s.prune()
+	if s.path == "" {
+		return
+	}
+	data, err := json.Marshal(s.seen)
+	if err == nil {
+		err = writeFileAtomic(s.path, data, 0o600)
+	}
+	if err != nil {
+		slog.Error("Failed to save delivered-PDU store", "error", err)
+	}
+}
+
+// Keep refreshes the entry of an SMS DELETE_POLICY=never leaves on the SIM,
+// so it does not expire while the SMS is there. It is saved at most once a
+// day. Nil-safe.
+func (s *DeliveredStore) Keep(hash string) {
+	if s == nil || hash == "" {
+		return
+	}
+	if at, ok := s.seen[hash]; ok && clk.Now().Sub(at) >= 24*time.Hour {
+		s.Record(hash)
+	}
+}
+
+func (s *DeliveredStore) prune() {
+	cutoff := clk.Now().Add(-deliveredRetention)
+	for hash, at := range s.seen {
+		if at.Before(cutoff) {
+			delete(s.seen, hash)
+		}
+	}
+}
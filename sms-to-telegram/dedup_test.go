@@ -0,0 +1,64 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestProcessMessages_FailedDeleteNotRedelivered: an SMS whose AT+CMGD
+// failed is still listed on the next poll; it is deleted again, not
+// forwarded a second time.
+func TestProcessMessages_FailedDeleteNotRedelivered(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 5,1,,29", testPDUSingle}), nil)
+	modem.on("AT+CMGD=5", nil, errors.New("modem returned ERROR"))
+	modem.on("AT+CMGD=5", nil, nil)
+	cfg := testConfig()
+	deliverer, sender, _ := newTestDeliverer(cfg)
+	deliverer.delivered = NewDeliveredStore("")
+
+	for range 2 {
+		if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+			t.Fatalf("processMessages() error = %v", err)
+		}
+	}
+	if got := len(sender.sentTo(100)); got != 1 {
+		t.Errorf("chat 100 received %d messages, want 1", got)
+	}
+	if n := modem.commandCount("AT+CMGD=5"); n != 2 {
+		t.Errorf("AT+CMGD=5 called %d times, want 2", n)
+	}
+}
+
+func TestDeliveredStore_Persisted(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	dir := t.TempDir()
+	pending := PendingSMS{PartIndices: []int{5}, RawPDUs: []string{testPDUSingle}}
+	hash := pduHash(pending)
+
+	NewDeliveredStore(dir).Record(hash)
+	store := NewDeliveredStore(dir)
+	if !store.Seen(hash) {
+		t.Fatal("recorded PDU not seen after a restart")
+	}
+	// The slot does not matter, the PDU does.
+	pending.PartIndices = []int{7}
+	if !store.Seen(pduHash(pending)) {
+		t.Error("same PDU in another slot not seen")
+	}
+	if store.Seen(pduHash(PendingSMS{PartIndices: []int{5}})) {
+		t.Error("SMS without PDUs deduplicated")
+	}
+
+	clock.Advance(deliveredRetention + time.Hour)
+	if NewDeliveredStore(dir).Seen(hash) {
+		t.Error("expired PDU hash still seen")
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+// Deletion checks. A slot the modem does not free keeps its SMS on the SIM,
+// and a SIM with stuck slots fills up and has new SMS rejected by the
+// network. AT+CMGD answering ERROR is a failed deletion; with DELETE_VERIFY
+// every deleted slot is also read back with AT+CMGR, which catches modems
+// that answer OK and keep the SMS. A slot that fails deleteStuckAfter times
+// in a row is stuck and alerted until it is free again.
+
+// deleteStuckAfter is the number of failed deletions in a row after which a
+// slot counts as stuck.
+const deleteStuckAfter = 3
+
+// readBackSlot reads a deleted slot back with AT+CMGR and reports whether
+// the SMS is still there. An empty answer, an empty record ("+CMGR: 0,,0"
+// on some Quectel modems) and a modem ERROR (+CMS ERROR: 321, invalid
+// index) are a free slot. An unread SMS arrived in the freed slot after
+// the deletion: the slot was freed, and arrived reports the new SMS, which
+// the read has marked read.
+func readBackSlot(modem ATCommander, index int) (occupied, arrived bool, err error) {
+	resp, err := modem.Command(fmt.Sprintf("AT+CMGR=%d", index))
+	if at.IsTimeoutError(err) {
+		return false, false, err
+	}
+	if err != nil {
+		return false, false, nil
+	}
+	for _, line := range resp {
+		rest, ok := strings.CutPrefix(line, "+CMGR:")
+		if !ok {
+			continue
+		}
+		fields := strings.Split(rest, ",")
+		if len(fields) == 3 && strings.TrimSpace(fields[2]) == "0" {
+			return false, false, nil
+		}
+		switch strings.Trim(strings.TrimSpace(fields[0]), `"`) {
+		case "0", "REC UNREAD":
+			return false, true, nil
+		}
+		return true, false, nil
+	}
+	return false, false, nil
+}
+
+// DeletionCheck follows the deletions of SIM slots across modem sessions.
+// Used by the modem goroutine only; nil checks nothing.
+type DeletionCheck struct {
+	// verify reads every deleted slot back (DELETE_VERIFY).
+	verify bool
+	// failures counts the failed deletions in a row per slot.
+	failures map[int]int
+	metrics  *Metrics
+}
+
+func NewDeletionCheck(verify bool, metrics *Metrics) *DeletionCheck {
+	return &DeletionCheck{verify: verify, failures: make(map[int]int), metrics: metrics}
+}
+
+// deleted records the deletion of indices; errored are the slots AT+CMGD
+// answered ERROR for. With verify the read-back decides. It reports
+// whether a new SMS arrived in a freed slot; a timeout is returned.
+// Nil-safe.
+func (c *DeletionCheck) deleted(modem ATCommander, indices, errored []int) (bool, error) {
+	if c == nil {
+		return false, nil
+	}
+	arrived := false
+	for _, index := range indices {
+		failed := slices.Contains(errored, index)
+		if c.verify {
+			occupied, fresh, err := readBackSlot(modem, index)
+			if err != nil {
+				return arrived, fmt.Errorf("reading back deleted slot %d: %w", index, err)
+			}
+			if occupied && !failed {
+				slog.Warn("SMS still on the SIM after AT+CMGD", "index", index)
+			}
+			failed, arrived = occupied, arrived || fresh
+		}
+		if !failed {
+			delete(c.failures, index)
+			continue
+		}
+		c.failures[index]++
+		c.metrics.SIMDeleteFailed()
+	}
+	return arrived, nil
+}
+
+// listed forgets the failures of slots a listing no longer shows, freed by
+// hand or by a later deletion. Nil-safe.
+func (c *DeletionCheck) listed(received []int) {
+	if c == nil {
+		return
+	}
+	for index := range c.failures {
+		if !slices.Contains(received, index) {
+			delete(c.failures, index)
+		}
+	}
+}
+
+// stuck returns the stuck slots, sorted. Nil-safe.
+func (c *DeletionCheck) stuck() []int {
+	if c == nil {
+		return nil
+	}
+	var stuck []int
+	for index, n := range c.failures {
+		if n >= deleteStuckAfter {
+			stuck = append(stuck, index)
+		}
+	}
+	slices.Sort(stuck)
+	return stuck
+}
+
+// CheckDeletions alerts when SIM slots are stuck and once more when none
+// are (after every poll). Like CheckStorage it is a warning outside the
+// error-type state machine.
+func (n *ErrorNotifier) CheckDeletions(ctx context.Context, stuck []int) {
+	n.mu.Lock()
+	alerted := n.stuckSlotsAlerted
+	n.stuckSlotsAlerted = len(stuck) > 0
+	n.mu.Unlock()
+
+	switch {
+	case len(stuck) > 0 && !alerted:
+		slog.Warn("SIM slots cannot be deleted", "indices", stuck, "attempts", deleteStuckAfter)
+		msg := fmt.Sprintf("<b>SMS Gateway Alert</b>\n\n"+
+			"<b>Host:</b> %s\n"+
+			"<b>Warning:</b> SIM slots cannot be deleted (indices %v)\n\n"+
+			"<i>Their SMS were delivered, but %d deletions in a row failed. Stuck slots fill the SIM until new SMS are rejected; check the SIM or delete them by hand (AT+CMGD).</i>",
+			n.hostHTML(), stuck, deleteStuckAfter)
+		if err := n.sendToTelegram(ctx, msg); err != nil {
+			slog.Error("Failed to send stuck slots alert", "error", err)
+			// Re-arm so the alert is retried after the next poll.
+			n.mu.Lock()
+			n.stuckSlotsAlerted = false
+			n.mu.Unlock()
+		}
+	case len(stuck) == 0 && alerted:
+		slog.Info("SIM slots deleted again")
+		msg := fmt.Sprintf("<b>SMS Gateway Recovered</b>\n\n"+
+			"<b>Host:</b> %s\n"+
+			"<b>Status:</b> No stuck SIM slots left",
+			n.hostHTML())
+		if err := n.sendToTelegram(ctx, msg); err != nil {
+			slog.Error("Failed to send stuck slots recovery notification", "error", err)
+		}
+	}
+}
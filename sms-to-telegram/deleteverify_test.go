@@ -0,0 +1,128 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+func TestReadBackSlot(t *testing.T) {
+	tests := []struct {
+		name              string
+		lines             []string
+		err               error
+		occupied, arrived bool
+	}{
+		{"empty answer", nil, nil, false, false},
+		{"invalid index", nil, at.ErrModemError, false, false},
+		{"empty record", []string{"+CMGR: 0,,0"}, nil, false, false},
+		{"still there", []string{"+CMGR: 1,,29", testPDUSingle}, nil, true, false},
+		{"new SMS", []string{"+CMGR: 0,,29", testPDUSingle}, nil, false, true},
+		{"text mode", []string{`+CMGR: "REC READ","+358449480778",,"25/12/11 10:00:00+08"`, "Test"}, nil, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modem := newFakeAT()
+			modem.on("AT+CMGR=5", tt.lines, tt.err)
+			occupied, arrived, err := readBackSlot(modem, 5)
+			if err != nil || occupied != tt.occupied || arrived != tt.arrived {
+				t.Errorf("readBackSlot() = %v, %v, %v; want %v, %v", occupied, arrived, err, tt.occupied, tt.arrived)
+			}
+		})
+	}
+	modem := newFakeAT()
+	modem.on("AT+CMGR=5", nil, at.ErrModemTimeout)
+	if _, _, err := readBackSlot(modem, 5); !at.IsTimeoutError(err) {
+		t.Errorf("readBackSlot() error = %v, want the timeout", err)
+	}
+}
+
+// A slot that fails deleteStuckAfter deletions in a row is alerted, and
+// the alert clears once the listing no longer shows it. Without
+// DELETE_VERIFY only AT+CMGD errors count.
+func TestProcessMessages_StuckSlotAlert(t *testing.T) {
+	tests := []struct {
+		name   string
+		verify bool
+		script func(modem *fakeAT)
+	}{
+		{"read back", true, func(modem *fakeAT) {
+			modem.on("AT+CMGR=5", []string{"+CMGR: 1,,29", testPDUSingle}, nil)
+		}},
+		{"modem ERROR", false, func(modem *fakeAT) {
+			modem.on("AT+CMGD=5", nil, at.ErrModemError)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(swapClock(newFakeClock()))
+			modem := newFakeAT()
+			listing := cmglListing([2]string{"+CMGL: 5,1,,29", testPDUSingle})
+			for range deleteStuckAfter {
+				modem.on("AT+CMGL=4", listing, nil)
+			}
+			modem.on("AT+CMGL=4", nil, nil)
+			tt.script(modem)
+			cfg := testConfig()
+			cfg.ChatIDs = []int64{100}
+			cfg.DeleteVerify = tt.verify
+			deliverer, _, alerts := newTestDeliverer(cfg)
+			deliverer.notifier.metrics = NewMetrics()
+			deliverer.deletions = NewDeletionCheck(cfg.DeleteVerify, deliverer.notifier.metrics)
+			deliverer.slots = newSIMSlots(false)
+			deliverer.slots.check = deliverer.deletions
+
+			poll := func() {
+				t.Helper()
+				if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+					t.Fatalf("processMessages() error = %v", err)
+				}
+				deliverer.notifier.CheckDeletions(context.Background(), deliverer.deletions.stuck())
+			}
+			for range deleteStuckAfter - 1 {
+				poll()
+			}
+			if len(alerts.sent) != 0 {
+				t.Fatalf("alerted after %d failures: %q", deleteStuckAfter-1, alerts.sent[0].Text)
+			}
+			poll()
+			if len(alerts.sent) != 1 || !strings.Contains(alerts.sent[0].Text, "cannot be deleted (indices [5])") {
+				t.Fatalf("alerts = %+v, want one stuck slots alert", alerts.sent)
+			}
+			body := scrapeMetrics(t, deliverer.notifier.metrics)
+			if want := "sms_to_telegram_sim_delete_failures_total 3\n"; !strings.Contains(body, want) {
+				t.Errorf("metrics lack %q", want)
+			}
+
+			poll()
+			if len(alerts.sent) != 2 || !strings.Contains(alerts.sent[1].Text, "No stuck SIM slots left") {
+				t.Errorf("alerts = %+v, want the recovery", alerts.sent)
+			}
+		})
+	}
+}
+
+// A new SMS found by the read-back in a freed slot is not a failure, but
+// the batch delete waits for the next listing: the read marked it read.
+func TestDeletionCheck_NewSMSInFreedSlot(t *testing.T) {
+	modem := newFakeAT()
+	modem.on("AT+CMGR=3", []string{"+CMGR: 0,,29", testPDUSingle}, nil)
+	slots := newSIMSlots(true)
+	slots.check = NewDeletionCheck(true, nil)
+	slots.listed([]int{3, 4})
+
+	if err := slots.deleter(modem, testConfig())([]int{3}, "forwarded SMS"); err != nil {
+		t.Fatal(err)
+	}
+	if len(slots.check.failures) != 0 {
+		t.Errorf("failures %v, want none", slots.check.failures)
+	}
+	if slots.read != nil {
+		t.Errorf("read slots %v after a new SMS, want none until the next listing", slots.read)
+	}
+}
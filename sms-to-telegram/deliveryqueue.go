@@ -0,0 +1,298 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// deliveryQueue decouples the modem goroutine from the sinks. The modem
+// goroutine submits every SMS it lists and goes back to polling; a single
+// delivery goroutine owns the Deliverer and delivers them in order. The SIM
+// stays the durable store: a finished SMS is handed back as a
+// deliveryResult and only the modem goroutine deletes its slots, between
+// polls. One worker keeps the sinks' per-chat state single-threaded and the
+// delivery order the SIM order.
+type deliveryQueue struct {
+	mu sync.Mutex
+	// jobs wait for the worker, in submission order; wake has a token while
+	// jobs is non-empty.
+	jobs []deliveryJob
+	wake chan struct{}
+	// queued holds the keys of every submitted SMS that is not settled yet
+	// (waiting, being delivered or finished but not deleted), so the next
+	// poll does not submit it again.
+	queued map[string]struct{}
+	// rejected keys stay on the SIM; they are not submitted again while
+	// listed (the Deliverer alerted once). So do kept keys
+	// (DELETE_POLICY=never). Both are forgotten once a listing no longer
+	// shows them.
+	rejected map[string]struct{}
+	kept     map[string]struct{}
+	// finished results wait for the modem goroutine; ready has a token
+	// while finished is non-empty.
+	finished []deliveryResult
+	ready    chan struct{}
+	// limit caps queued (DELIVERY_QUEUE_LIMIT); 0 is unbounded. paused
+	// remembers the last full() answer for logging.
+	limit  int
+	paused bool
+	// stopping is closed by drain (SHUTDOWN_TIMEOUT).
+	stopping chan struct{}
+}
+
+type deliveryJob struct {
+	key     string
+	pending PendingSMS
+}
+
+// deliveryResult is a finished SMS whose SIM slots may be freed.
+type deliveryResult struct {
+	Pending PendingSMS
+	Status  deliveryStatus
+}
+
+func newDeliveryQueue(limit int) *deliveryQueue {
+	return &deliveryQueue{
+		limit:    limit,
+		wake:     make(chan struct{}, 1),
+		queued:   make(map[string]struct{}),
+		rejected: make(map[string]struct{}),
+		kept:     make(map[string]struct{}),
+		ready:    make(chan struct{}, 1),
+		stopping: make(chan struct{}),
+	}
+}
+
+// submit queues pending unless it is already queued. It never blocks: the
+// answer is deliveryQueued, deliveryRejected for an SMS a sink refused,
+// deliveryKept for one DELETE_POLICY=never keeps, or deliveryDeferred when
+// the queue is full (the SMS waits on the SIM).
+func (q *deliveryQueue) submit(pending PendingSMS) deliveryStatus {
+	key := messageKey(pending)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.rejected[key]; ok {
+		return deliveryRejected
+	}
+	if _, ok := q.kept[key]; ok {
+		return deliveryKept
+	}
+	if _, ok := q.queued[key]; ok {
+		return deliveryQueued
+	}
+	if q.limit > 0 && len(q.queued) >= q.limit {
+		return deliveryDeferred
+	}
+	q.queued[key] = struct{}{}
+	q.jobs = append(q.jobs, deliveryJob{key: key, pending: pending})
+	poke(q.wake)
+	return deliveryQueued
+}
+
+// next takes the oldest job, if any.
+func (q *deliveryQueue) next() (deliveryJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.jobs) == 0 {
+		return deliveryJob{}, false
+	}
+	job := q.jobs[0]
+	q.jobs = q.jobs[1:]
+	return job, true
+}
+
+// complete records the outcome of job. A deferred SMS would most likely
+// defer the ones behind it too, and delivering those first would reorder
+// them: the rest of the queue is dropped with it and submitted again by the
+// next poll, like the synchronous loop stops at a deferred SMS.
+func (q *deliveryQueue) complete(job deliveryJob, status deliveryStatus) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	switch status {
+	case deliveryRejected:
+		delete(q.queued, job.key)
+		q.rejected[job.key] = struct{}{}
+	case deliveryKept:
+		delete(q.queued, job.key)
+		q.kept[job.key] = struct{}{}
+	case deliveryDeferred:
+		delete(q.queued, job.key)
+		for _, dropped := range q.jobs {
+			delete(q.queued, dropped.key)
+		}
+		if len(q.jobs) > 0 {
+			slog.Info("Delivery deferred - queued messages will be retried next poll", "queued", len(q.jobs))
+		}
+		q.jobs = nil
+	default:
+		q.finished = append(q.finished, deliveryResult{Pending: job.pending, Status: status})
+		poke(q.ready)
+	}
+}
+
+// full reports whether the queue is at its limit, so the next listing would
+// not be taken anyway. Nil-safe.
+func (q *deliveryQueue) full() bool {
+	if q == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	full := q.limit > 0 && len(q.queued) >= q.limit
+	if full != q.paused {
+		q.paused = full
+		if full {
+			slog.Warn("Delivery queue full - pausing SIM polling", "queued", len(q.queued))
+		} else {
+			slog.Info("Delivery queue drained - resuming SIM polling", "queued", len(q.queued))
+		}
+	}
+	return full
+}
+
+// takeFinished hands the finished results to the modem goroutine. Their
+// keys stay queued until settled, so the next poll does not deliver them
+// again.
+func (q *deliveryQueue) takeFinished() []deliveryResult {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	results := q.finished
+	q.finished = nil
+	return results
+}
+
+// putBack returns results the modem goroutine could not settle (the session
+// broke while deleting) for the next session.
+func (q *deliveryQueue) putBack(results []deliveryResult) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.finished = append(results, q.finished...)
+	poke(q.ready)
+}
+
+// settled forgets pending once its slots were deleted (or given up on).
+func (q *deliveryQueue) settled(pending PendingSMS) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.queued, messageKey(pending))
+}
+
+// listed forgets the rejected and kept SMS a listing no longer shows,
+// deleted by hand or gone with the SIM. Nil-safe.
+func (q *deliveryQueue) listed(pending []PendingSMS) {
+	if q == nil {
+		return
+	}
+	keys := make(map[string]struct{}, len(pending))
+	for _, p := range pending {
+		keys[messageKey(p)] = struct{}{}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, m := range []map[string]struct{}{q.rejected, q.kept} {
+		for key := range m {
+			if _, ok := keys[key]; !ok {
+				delete(m, key)
+			}
+		}
+	}
+}
+
+// idle reports whether no SMS is queued, being delivered or waiting for
+// deletion: only then may the SIM change, since the slots of an unsettled
+// SMS would be deleted on the new one. Nil-safe.
+func (q *deliveryQueue) idle() bool {
+	if q == nil {
+		return true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queued) == 0
+}
+
+// finishedReady returns the channel signaled when results wait for the
+// modem goroutine; nil (never ready) for a nil queue.
+func (q *deliveryQueue) finishedReady() <-chan struct{} {
+	if q == nil {
+		return nil
+	}
+	return q.ready
+}
+
+// drain asks the modem goroutine to stop polling and to end its loop once
+// every queued SMS is delivered and deleted. Call once.
+func (q *deliveryQueue) drain() {
+	close(q.stopping)
+}
+
+// draining returns the channel closed by drain; nil (never) for a nil
+// queue.
+func (q *deliveryQueue) draining() <-chan struct{} {
+	if q == nil {
+		return nil
+	}
+	return q.stopping
+}
+
+// drainOnShutdown gives the delivery queue up to timeout to drain once ctx
+// (the shutdown signal) ends, then stops the modem loop and the delivery
+// goroutine by ending loopCtx. SMS still queued at the deadline stay on the
+// SIM for the next start.
+func drainOnShutdown(ctx, loopCtx context.Context, stop context.CancelFunc, q *deliveryQueue, timeout time.Duration) {
+	select {
+	case <-loopCtx.Done():
+		return
+	case <-ctx.Done():
+	}
+	slog.Info("Draining the delivery queue before exit", "timeout", timeout)
+	q.drain()
+	select {
+	case <-loopCtx.Done():
+	case <-clk.After(timeout):
+		slog.Warn("Shutdown timeout reached, queued SMS stay on the SIM", "timeout", timeout)
+		stop()
+	}
+}
+
+// poke leaves a token in a capacity-1 channel unless one is there already.
+func poke(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// StartQueue makes Deliver asynchronous: from now on it only submits, and a
+// goroutine delivers until ctx ends. The goroutine also applies the
+// reloads, as it is the one reading the reloadable settings. Call before
+// the modem loop starts.
+func (d *Deliverer) StartQueue(ctx context.Context, reloader *ConfigReloader) {
+	q := newDeliveryQueue(d.cfg.QueueLimit)
+	d.queue = q
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case next := <-reloader.pending():
+				applyReload(d.cfg, next, d)
+			case <-q.wake:
+				for {
+					job, ok := q.next()
+					if !ok || ctx.Err() != nil {
+						break
+					}
+					q.complete(job, d.deliverNow(ctx, job.pending))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,303 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// gatedSink hands every SMS to the test and blocks until it answers.
+type gatedSink struct {
+	got  chan PendingSMS
+	gate chan error
+}
+
+func (g *gatedSink) Name() string { return "gated" }
+
+func (g *gatedSink) Send(ctx context.Context, pending PendingSMS) error {
+	select {
+	case g.got <- pending:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-g.gate:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TestDeliveryQueue_PollingNotBlocked: with the queue started, a sink that
+// hangs does not hold up the poll; a finished SMS is deleted once collected
+// and an SMS in flight is not submitted twice.
+func TestDeliveryQueue_PollingNotBlocked(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing(
+		[2]string{"+CMGL: 2,1,,24", pduAlphaSender},
+		[2]string{"+CMGL: 5,1,,29", testPDUSingle},
+	), nil)
+	cfg := testConfig()
+	deliverer, _, _ := newTestDeliverer(cfg)
+	sink := &gatedSink{got: make(chan PendingSMS), gate: make(chan error)}
+	deliverer.AddSink(sink)
+	deliverer.StartQueue(ctx, nil)
+
+	for range 2 {
+		if err := processMessages(ctx, modem, deliverer, cfg, 30); err != nil {
+			t.Fatalf("processMessages() error = %v", err)
+		}
+	}
+	first := <-sink.got
+	if first.Message.Index != 2 {
+		t.Fatalf("first delivery = index %d, want 2 (SIM order)", first.Message.Index)
+	}
+	if n := modem.commandCount("AT+CMGD=2"); n != 0 {
+		t.Errorf("AT+CMGD=2 called %d times before delivery finished", n)
+	}
+	sink.gate <- nil
+	if second := <-sink.got; second.Message.Index != 5 {
+		t.Fatalf("second delivery = index %d, want 5", second.Message.Index)
+	}
+
+	collect := func() {
+		t.Helper()
+		select {
+		case <-deliverer.queue.finishedReady():
+		case <-time.After(5 * time.Second):
+			t.Fatal("finished delivery not signaled")
+		}
+		if err := collectDelivered(modem, deliverer, cfg); err != nil {
+			t.Fatalf("collectDelivered() error = %v", err)
+		}
+	}
+	collect()
+	if n := modem.commandCount("AT+CMGD=2"); n != 1 {
+		t.Errorf("AT+CMGD=2 called %d times, want 1", n)
+	}
+	if n := modem.commandCount("AT+CMGD=5"); n != 0 {
+		t.Errorf("AT+CMGD=5 called %d times while still in flight", n)
+	}
+	sink.gate <- nil
+	collect()
+	if n := modem.commandCount("AT+CMGD=5"); n != 1 {
+		t.Errorf("AT+CMGD=5 called %d times, want 1", n)
+	}
+}
+
+// TestDeliveryQueue_DeferredDropsRest: a deferred SMS takes the ones queued
+// behind it out too, so the next poll submits them again in SIM order.
+func TestDeliveryQueue_DeferredDropsRest(t *testing.T) {
+	q := newDeliveryQueue(0)
+	sms := func(index int) PendingSMS {
+		return PendingSMS{Message: SMSMessage{Index: index, From: "+1", Text: "x"}, PartIndices: []int{index}}
+	}
+	for i := 1; i <= 3; i++ {
+		if got := q.submit(sms(i)); got != deliveryQueued {
+			t.Fatalf("submit(%d) = %v, want deliveryQueued", i, got)
+		}
+	}
+	job, _ := q.next()
+	q.complete(job, deliveryDeferred)
+	if _, ok := q.next(); ok || len(q.queued) != 0 {
+		t.Fatalf("queue after deferral: jobs %d, queued %d, want empty", len(q.jobs), len(q.queued))
+	}
+
+	q.submit(sms(1))
+	q.submit(sms(2))
+	job, _ = q.next()
+	q.complete(job, deliveryRejected)
+	if got := q.submit(sms(1)); got != deliveryRejected {
+		t.Errorf("resubmitted rejected SMS = %v, want deliveryRejected", got)
+	}
+	job, _ = q.next()
+	q.complete(job, deliveryDone)
+	if results := q.takeFinished(); len(results) != 1 || results[0].Pending.Message.Index != 2 {
+		t.Fatalf("finished = %+v, want index 2", results)
+	}
+	// Not settled yet: a poll in between must not deliver it again.
+	q.submit(sms(2))
+	if _, ok := q.next(); ok {
+		t.Error("finished but unsettled SMS submitted again")
+	}
+	q.settled(sms(2))
+	q.submit(sms(2))
+	if _, ok := q.next(); !ok {
+		t.Error("settled SMS not accepted again")
+	}
+}
+
+// TestDeliveryQueue_Backpressure: at DELIVERY_QUEUE_LIMIT the rest of the
+// listing stays on the SIM and the next polls skip the listing until the
+// queue drains.
+func TestDeliveryQueue_Backpressure(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing(
+		[2]string{"+CMGL: 2,1,,24", pduAlphaSender},
+		[2]string{"+CMGL: 5,1,,29", testPDUSingle},
+	), nil)
+	cfg := testConfig()
+	deliverer, _, _ := newTestDeliverer(cfg)
+	// No worker: the test plays the delivery goroutine.
+	q := newDeliveryQueue(1)
+	deliverer.queue = q
+	poll := func() {
+		t.Helper()
+		if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+			t.Fatalf("processMessages() error = %v", err)
+		}
+	}
+
+	poll()
+	if len(q.jobs) != 1 || q.jobs[0].pending.Message.Index != 2 {
+		t.Fatalf("queued jobs = %+v, want only index 2", q.jobs)
+	}
+	poll()
+	if n := modem.commandCount("AT+CMGL=4"); n != 1 {
+		t.Errorf("AT+CMGL=4 called %d times while the queue was full, want 1", n)
+	}
+
+	job, _ := q.next()
+	q.complete(job, deliveryDone)
+	poll()
+	if n := modem.commandCount("AT+CMGD=2"); n != 1 {
+		t.Errorf("AT+CMGD=2 called %d times, want 1", n)
+	}
+	if n := modem.commandCount("AT+CMGL=4"); n != 2 {
+		t.Errorf("AT+CMGL=4 called %d times after the queue drained, want 2", n)
+	}
+}
+
+// TestDeliveryQueue_Idle: the SIM may only change once every submitted SMS
+// is settled.
+func TestDeliveryQueue_Idle(t *testing.T) {
+	var none *deliveryQueue
+	if !none.idle() {
+		t.Error("nil queue not idle")
+	}
+	q := newDeliveryQueue(0)
+	pending := PendingSMS{Message: SMSMessage{Index: 3, From: "+4915550001234", Text: "hi"}, PartIndices: []int{3}}
+	q.submit(pending)
+	steps := []struct {
+		name string
+		step func()
+	}{
+		{"queued", func() {}},
+		{"finished", func() { job, _ := q.next(); q.complete(job, deliveryDone) }},
+		{"taken, not deleted", func() { q.takeFinished() }},
+	}
+	for _, s := range steps {
+		s.step()
+		if q.idle() {
+			t.Errorf("%s: idle, want busy", s.name)
+		}
+	}
+	q.settled(pending)
+	if !q.idle() {
+		t.Error("settled: busy, want idle")
+	}
+}
+
+// TestDeliveryQueue_Listed: rejected and kept SMS are remembered while the
+// SIM still lists them, and forgotten once it does not.
+func TestDeliveryQueue_Listed(t *testing.T) {
+	var none *deliveryQueue
+	none.listed(nil)
+	q := newDeliveryQueue(0)
+	sms := func(index int) PendingSMS {
+		return PendingSMS{Message: SMSMessage{Index: index, From: "+4915550001234", Text: "hi"}, PartIndices: []int{index}}
+	}
+	for _, s := range []struct {
+		pending PendingSMS
+		status  deliveryStatus
+	}{{sms(1), deliveryRejected}, {sms(2), deliveryKept}} {
+		q.submit(s.pending)
+		job, _ := q.next()
+		q.complete(job, s.status)
+	}
+
+	q.listed([]PendingSMS{sms(1), sms(2), sms(3)})
+	if got := q.submit(sms(1)); got != deliveryRejected {
+		t.Errorf("listed rejected SMS: submit = %v, want rejected", got)
+	}
+	if got := q.submit(sms(2)); got != deliveryKept {
+		t.Errorf("listed kept SMS: submit = %v, want kept", got)
+	}
+	q.listed([]PendingSMS{sms(2)})
+	if len(q.rejected) != 0 || len(q.kept) != 1 {
+		t.Errorf("after SMS 1 left the SIM: %d rejected, %d kept, want 0, 1", len(q.rejected), len(q.kept))
+	}
+	q.listed(nil)
+	if len(q.kept) != 0 {
+		t.Errorf("after SMS 2 left the SIM: %d kept, want 0", len(q.kept))
+	}
+}
+
+// TestDrainOnShutdown: the signal only starts the drain; the loop context
+// ends when the queue drained (run returned) or at the timeout.
+func TestDrainOnShutdown(t *testing.T) {
+	t.Run("timeout", func(t *testing.T) {
+		t.Cleanup(swapClock(newFakeClock()))
+		q := newDeliveryQueue(0)
+		ctx, cancel := context.WithCancel(context.Background())
+		loopCtx, stop := context.WithCancel(context.Background())
+		defer stop()
+		cancel()
+		drainOnShutdown(ctx, loopCtx, stop, q, 25*time.Second)
+		select {
+		case <-q.draining():
+		default:
+			t.Error("queue not draining after the signal")
+		}
+		if loopCtx.Err() == nil {
+			t.Error("loop context alive after the timeout")
+		}
+	})
+
+	t.Run("drained", func(t *testing.T) {
+		q := newDeliveryQueue(0)
+		ctx, cancel := context.WithCancel(context.Background())
+		loopCtx, stop := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			drainOnShutdown(ctx, loopCtx, stop, q, time.Hour)
+			close(done)
+		}()
+		cancel()
+		select {
+		case <-q.draining():
+		case <-time.After(time.Second):
+			t.Fatal("queue not draining after the signal")
+		}
+		stop() // the modem loop ended, run returned
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("drainOnShutdown still waiting after the loop ended")
+		}
+	})
+
+	t.Run("no signal", func(t *testing.T) {
+		q := newDeliveryQueue(0)
+		loopCtx, stop := context.WithCancel(context.Background())
+		stop()
+		drainOnShutdown(context.Background(), loopCtx, stop, q, time.Hour)
+		select {
+		case <-q.draining():
+			t.Error("queue draining without a signal")
+		default:
+		}
+	})
+
+	var none *deliveryQueue
+	if none.draining() != nil {
+		t.Error("nil queue draining() not nil")
+	}
+}
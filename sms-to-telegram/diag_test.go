@@ -6,26 +6,29 @@ package main
 import (
 	"context"
 	"errors"
+	"slices"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
 )
 
 // diagAT builds a fakeAT preloaded with a healthy baseline; individual tests
 // override the interesting command.
 func diagAT() *fakeAT {
-	at := newFakeAT()
-	at.on("AT+CPIN?", []string{"+CPIN: READY"}, nil)
-	at.on("AT+CSQ", []string{"+CSQ: 20,0"}, nil)
-	at.on("AT+CREG?", []string{"+CREG: 0,1"}, nil)
-	return at
+	modem := newFakeAT()
+	modem.on("AT+CPIN?", []string{"+CPIN: READY"}, nil)
+	modem.on("AT+CSQ", []string{"+CSQ: 20,0"}, nil)
+	modem.on("AT+CREG?", []string{"+CREG: 0,1"}, nil)
+	return modem
 }
 
-func runDiag(t *testing.T, at *fakeAT) error {
+func runDiag(t *testing.T, modem *fakeAT) error {
 	t.Helper()
 	fc := newFakeClock()
 	t.Cleanup(swapClock(fc))
-	return runModemDiagnostics(context.Background(), at, fc.Now(), 90*time.Second)
+	return runModemDiagnostics(context.Background(), modem, fc.Now(), 90*time.Second)
 }
 
 func wantDiagType(t *testing.T, err error, wantType DiagnosticErrorType) {
@@ -49,11 +52,11 @@ func TestDiagnostics_Healthy(t *testing.T) {
 // Regression: "+CPIN: NOT READY" contains the substring "READY" and used to
 // be classified as a ready SIM.
 func TestDiagnostics_NotReadyIsNotReady(t *testing.T) {
-	at := diagAT()
-	at.responses["AT+CPIN?"] = nil
-	at.on("AT+CPIN?", []string{"+CPIN: NOT READY"}, nil)
+	modem := diagAT()
+	modem.responses["AT+CPIN?"] = nil
+	modem.on("AT+CPIN?", []string{"+CPIN: NOT READY"}, nil)
 
-	err := runDiag(t, at)
+	err := runDiag(t, modem)
 	wantDiagType(t, err, ErrTypeSimNotDetected)
 	if !strings.Contains(err.Error(), "not ready") {
 		t.Errorf("message = %q, want a not-ready explanation", err.Error())
@@ -61,66 +64,66 @@ func TestDiagnostics_NotReadyIsNotReady(t *testing.T) {
 }
 
 func TestDiagnostics_PinRequired(t *testing.T) {
-	at := diagAT()
-	at.responses["AT+CPIN?"] = nil
-	at.on("AT+CPIN?", []string{"+CPIN: SIM PIN"}, nil)
-	wantDiagType(t, runDiag(t, at), ErrTypeSimPinRequired)
+	modem := diagAT()
+	modem.responses["AT+CPIN?"] = nil
+	modem.on("AT+CPIN?", []string{"+CPIN: SIM PIN"}, nil)
+	wantDiagType(t, runDiag(t, modem), ErrTypeSimPinRequired)
 }
 
 func TestDiagnostics_RegistrationDenied(t *testing.T) {
-	at := diagAT()
-	at.responses["AT+CREG?"] = nil
-	at.on("AT+CREG?", []string{"+CREG: 0,3"}, nil)
-	wantDiagType(t, runDiag(t, at), ErrTypeNetworkDenied)
+	modem := diagAT()
+	modem.responses["AT+CREG?"] = nil
+	modem.on("AT+CREG?", []string{"+CREG: 0,3"}, nil)
+	wantDiagType(t, runDiag(t, modem), ErrTypeNetworkDenied)
 }
 
 // CSQ=99 within the grace window is tolerated; only after the grace expires
 // does it become a No Signal alert.
 func TestDiagnostics_NoSignalAfterGrace(t *testing.T) {
-	at := diagAT()
-	at.responses["AT+CSQ"] = nil
-	at.on("AT+CSQ", []string{"+CSQ: 99,99"}, nil)
-	wantDiagType(t, runDiag(t, at), ErrTypeNoSignal)
+	modem := diagAT()
+	modem.responses["AT+CSQ"] = nil
+	modem.on("AT+CSQ", []string{"+CSQ: 99,99"}, nil)
+	wantDiagType(t, runDiag(t, modem), ErrTypeNoSignal)
 }
 
 func TestDiagnostics_SignalAppearsWithinGrace(t *testing.T) {
-	at := diagAT()
-	at.responses["AT+CSQ"] = nil
-	at.on("AT+CSQ", []string{"+CSQ: 99,99"}, nil)
-	at.on("AT+CSQ", []string{"+CSQ: 99,99"}, nil)
-	at.on("AT+CSQ", []string{"+CSQ: 21,0"}, nil)
+	modem := diagAT()
+	modem.responses["AT+CSQ"] = nil
+	modem.on("AT+CSQ", []string{"+CSQ: 99,99"}, nil)
+	modem.on("AT+CSQ", []string{"+CSQ: 99,99"}, nil)
+	modem.on("AT+CSQ", []string{"+CSQ: 21,0"}, nil)
 
-	if err := runDiag(t, at); err != nil {
+	if err := runDiag(t, modem); err != nil {
 		t.Fatalf("diagnostics error = %v, want recovery within grace", err)
 	}
 }
 
 func TestDiagnostics_SearchingThenRegistered(t *testing.T) {
-	at := diagAT()
-	at.responses["AT+CREG?"] = nil
-	at.on("AT+CREG?", []string{"+CREG: 0,2"}, nil)
-	at.on("AT+CREG?", []string{"+CREG: 0,1"}, nil)
+	modem := diagAT()
+	modem.responses["AT+CREG?"] = nil
+	modem.on("AT+CREG?", []string{"+CREG: 0,2"}, nil)
+	modem.on("AT+CREG?", []string{"+CREG: 0,1"}, nil)
 
-	if err := runDiag(t, at); err != nil {
+	if err := runDiag(t, modem); err != nil {
 		t.Fatalf("diagnostics error = %v, want success after registration", err)
 	}
 }
 
 func TestDiagnostics_NotRegisteredAfterGrace(t *testing.T) {
-	at := diagAT()
-	at.responses["AT+CREG?"] = nil
-	at.on("AT+CREG?", []string{"+CREG: 0,2"}, nil)
-	wantDiagType(t, runDiag(t, at), ErrTypeNetworkNotRegistered)
+	modem := diagAT()
+	modem.responses["AT+CREG?"] = nil
+	modem.on("AT+CREG?", []string{"+CREG: 0,2"}, nil)
+	wantDiagType(t, runDiag(t, modem), ErrTypeNetworkNotRegistered)
 }
 
 // A transport failure during diagnostics is a session problem, not a SIM
 // problem — it must not trigger a misleading SIM alert or a CFUN reset.
 func TestDiagnostics_TransportErrorIsSessionError(t *testing.T) {
-	at := diagAT()
-	at.responses["AT+CPIN?"] = nil
-	at.on("AT+CPIN?", nil, ErrModemTimeout)
+	modem := diagAT()
+	modem.responses["AT+CPIN?"] = nil
+	modem.on("AT+CPIN?", nil, at.ErrModemTimeout)
 
-	err := runDiag(t, at)
+	err := runDiag(t, modem)
 	var sessErr *SessionError
 	if !errors.As(err, &sessErr) {
 		t.Fatalf("error = %v, want SessionError", err)
@@ -128,31 +131,31 @@ func TestDiagnostics_TransportErrorIsSessionError(t *testing.T) {
 }
 
 func TestDiagnostics_SimErrorWithCCIDPresent(t *testing.T) {
-	at := diagAT()
-	at.responses["AT+CPIN?"] = nil
-	at.on("AT+CPIN?", nil, ErrModemError) // repeats for all 5 attempts
-	at.on("AT+CCID", []string{"898600810906F8048812"}, nil)
+	modem := diagAT()
+	modem.responses["AT+CPIN?"] = nil
+	modem.on("AT+CPIN?", nil, at.ErrModemError) // repeats for all 5 attempts
+	modem.on("AT+CCID", []string{"898600810906F8048812"}, nil)
 
-	err := runDiag(t, at)
+	err := runDiag(t, modem)
 	wantDiagType(t, err, ErrTypeSimNotDetected)
 	if !strings.Contains(err.Error(), "detected but not ready") {
 		t.Errorf("message = %q, want detected-but-not-ready", err.Error())
 	}
-	if at.commandCount("AT+CPIN?") != 5 {
-		t.Errorf("CPIN attempts = %d, want 5", at.commandCount("AT+CPIN?"))
+	if modem.commandCount("AT+CPIN?") != 5 {
+		t.Errorf("CPIN attempts = %d, want 5", modem.commandCount("AT+CPIN?"))
 	}
 }
 
 func TestDiagnostics_CancelDuringGrace(t *testing.T) {
 	fc := newFakeClock()
 	t.Cleanup(swapClock(fc))
-	at := diagAT()
-	at.responses["AT+CREG?"] = nil
-	at.on("AT+CREG?", []string{"+CREG: 0,2"}, nil)
+	modem := diagAT()
+	modem.responses["AT+CREG?"] = nil
+	modem.on("AT+CREG?", []string{"+CREG: 0,2"}, nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
-	err := runModemDiagnostics(ctx, at, fc.Now(), 90*time.Second)
+	err := runModemDiagnostics(ctx, modem, fc.Now(), 90*time.Second)
 	if !errors.Is(err, context.Canceled) {
 		t.Fatalf("error = %v, want context.Canceled (no alert on shutdown)", err)
 	}
@@ -266,6 +269,30 @@ func TestCheckStorage_Hysteresis(t *testing.T) {
 	}
 }
 
+func TestParseCPMSStorages(t *testing.T) {
+	tests := []struct {
+		name string
+		resp []string
+		want []SIMStorage
+	}{
+		{"query", []string{`+CPMS: "SM",3,30,"SM",3,30,"SM",3,30`}, []SIMStorage{{"SM", 3, 30}}},
+		{"mixed", []string{`+CPMS: "ME",0,100,"SM",28,30,"ME",0,100`}, []SIMStorage{{"ME", 0, 100}, {"SM", 28, 30}}},
+		{"set command", []string{"", "+CPMS: 3,30,3,30,3,30"}, []SIMStorage{{"", 3, 30}, {"", 3, 30}, {"", 3, 30}}},
+		{"garbage", []string{"+CPMS: ERROR"}, nil},
+		{"none", []string{"OK"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCPMSStorages(tt.resp); !slices.Equal(got, tt.want) {
+				t.Errorf("parseCPMSStorages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if used, total := parseCPMSCounts([]string{`+CPMS: "ME",0,100,"SM",28,30`}); used != 0 || total != 100 {
+		t.Errorf("parseCPMSCounts() = %d, %d; want the first storage", used, total)
+	}
+}
+
 func TestNeedsModemReset(t *testing.T) {
 	reset := []DiagnosticErrorType{
 		ErrTypeSimNotDetected, ErrTypeSimPinRequired, ErrTypeSimPukLocked,
@@ -352,3 +379,222 @@ func TestResetEscalator(t *testing.T) {
 		t.Error("streak must reset after a healthy session")
 	}
 }
+
+// The reconnect wait doubles up to the cap, keeps at least half of the
+// nominal delay under jitter and starts over after a healthy session.
+func TestReconnectBackoff(t *testing.T) {
+	b := newReconnectBackoff(30*time.Second, 2*time.Minute)
+	b.jitter = func(n int64) int64 { return n - 1 } // maximum jitter
+	for i, want := range []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 2 * time.Minute} {
+		if got := b.Next(); got != want {
+			t.Errorf("failure %d: Next() = %v, want %v", i+1, got, want)
+		}
+	}
+	if b.Failures() != 4 {
+		t.Errorf("Failures() = %d, want 4", b.Failures())
+	}
+
+	b.jitter = func(int64) int64 { return 0 } // minimum jitter
+	if got := b.Next(); got != time.Minute {
+		t.Errorf("capped Next() without jitter = %v, want half the cap", got)
+	}
+	b.Reset()
+	if got := b.Next(); got != 15*time.Second || b.Failures() != 1 {
+		t.Errorf("after Reset: Next() = %v, Failures() = %d; want 15s, 1", got, b.Failures())
+	}
+
+	// Real jitter stays within [d/2, d].
+	b = newReconnectBackoff(time.Second, time.Second)
+	for range 100 {
+		if got := b.Next(); got < 500*time.Millisecond || got > time.Second {
+			t.Fatalf("jittered Next() = %v, want within [500ms, 1s]", got)
+		}
+	}
+}
+
+func TestInitModemSession_HappyPath(t *testing.T) {
+	modem := newFakeAT()
+	modem.on("AT+CMGF?", []string{"+CMGF: 0"}, nil)
+	modem.on(`AT+CPMS="SM","SM","SM"`, []string{`+CPMS: 3,30,3,30,3,30`}, nil)
+
+	storage, err := initModemSession(modem, []string{storageSM, storageME}, "", false)
+	if err != nil {
+		t.Fatalf("initModemSession() error = %v", err)
+	}
+	if storage.SIMStorage != (SIMStorage{Name: storageSM, Used: 3, Total: 30}) {
+		t.Errorf("storage = %+v, want SM 3/30", storage)
+	}
+	for _, cmd := range []string{"ATE0", "AT+CMGF=0", "AT+CNMI=2,0,0,0,0"} {
+		if modem.commandCount(cmd) != 1 {
+			t.Errorf("command %s issued %d times, want 1", cmd, modem.commandCount(cmd))
+		}
+	}
+}
+
+func TestInitModemSession_Charset(t *testing.T) {
+	tests := []struct {
+		name     string
+		cscs     []string
+		setErr   error
+		wantType DiagnosticErrorType // ErrTypeNone: success
+	}{
+		{"verified", []string{`+CSCS: "UCS2"`}, nil, ErrTypeNone},
+		{"answered in UCS2", []string{`+CSCS: "0055004300530032"`}, nil, ErrTypeNone},
+		{"ignored by the firmware", []string{`+CSCS: "IRA"`}, nil, ErrTypeModemInitFailed},
+		{"unsupported", nil, at.ErrModemError, ErrTypeModemInitFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modem := newFakeAT()
+			modem.on("AT+CMGF?", []string{"+CMGF: 0"}, nil)
+			modem.on(`AT+CSCS="UCS2"`, nil, tt.setErr)
+			modem.on("AT+CSCS?", tt.cscs, nil)
+			modem.on("AT+CPIN?", []string{"+CPIN: READY"}, nil)
+
+			_, err := initModemSession(modem, []string{storageSM, storageME}, charsetUCS2, false)
+			var diagErr *DiagnosticError
+			switch {
+			case tt.wantType == ErrTypeNone && err != nil:
+				t.Fatalf("initModemSession() error = %v", err)
+			case tt.wantType != ErrTypeNone && (!errors.As(err, &diagErr) || diagErr.Type != tt.wantType):
+				t.Fatalf("error = %v, want %s", err, errorTypeName(tt.wantType))
+			}
+		})
+	}
+
+	// Without MODEM_CHARSET the modem's setting is left alone.
+	modem := newFakeAT()
+	modem.on("AT+CMGF?", []string{"+CMGF: 0"}, nil)
+	if _, err := initModemSession(modem, []string{storageSM, storageME}, "", false); err != nil {
+		t.Fatal(err)
+	}
+	if n := modem.commandCount("AT+CSCS?"); n != 0 {
+		t.Errorf("AT+CSCS? sent %d times without MODEM_CHARSET", n)
+	}
+}
+
+func TestInitModemSession_TextModeStuck(t *testing.T) {
+	modem := newFakeAT()
+	modem.on("AT+CMGF?", []string{"+CMGF: 1"}, nil) // modem kept text mode
+
+	_, err := initModemSession(modem, []string{storageSM, storageME}, "", false)
+	var diagErr *DiagnosticError
+	if !errors.As(err, &diagErr) || diagErr.Type != ErrTypeModemInitFailed {
+		t.Fatalf("error = %v, want ErrTypeModemInitFailed", err)
+	}
+}
+
+func TestInitModemSession_TextModeFallback(t *testing.T) {
+	tests := []struct {
+		name         string
+		textFallback bool
+		cmgf         string              // AT+CMGF? after AT+CMGF=1
+		failing      string              // command answering ERROR
+		wantType     DiagnosticErrorType // ErrTypeNone: text-mode session
+	}{
+		{"fallback", true, "+CMGF: 1", "", ErrTypeNone},
+		{"no fallback", false, "+CMGF: 1", "", ErrTypeModemInitFailed},
+		{"text mode refused", true, "+CMGF: 1", "AT+CMGF=1", ErrTypeModemInitFailed},
+		{"text mode not active", true, "+CMGF: 0", "", ErrTypeModemInitFailed},
+		{"no CSDH", true, "+CMGF: 1", "AT+CSDH=1", ErrTypeModemInitFailed},
+		{"no UCS2", true, "+CMGF: 1", `AT+CSCS="UCS2"`, ErrTypeModemInitFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modem := newFakeAT()
+			modem.on("AT+CMGF=0", nil, at.ErrModemError)
+			modem.on("AT+CMGF?", []string{tt.cmgf}, nil)
+			modem.on("AT+CSCS?", []string{`+CSCS: "UCS2"`}, nil)
+			modem.on("AT+CPIN?", []string{"+CPIN: READY"}, nil)
+			if tt.failing != "" {
+				modem.on(tt.failing, nil, at.ErrModemError)
+			}
+
+			session, err := initModemSession(modem, []string{storageSM, storageME}, charsetGSM, tt.textFallback)
+			if tt.wantType != ErrTypeNone {
+				var diagErr *DiagnosticError
+				if !errors.As(err, &diagErr) || diagErr.Type != tt.wantType {
+					t.Fatalf("error = %v, want %s", err, errorTypeName(tt.wantType))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("initModemSession() error = %v", err)
+			}
+			// MODEM_CHARSET gives way to the UCS2 text mode needs.
+			if !session.TextMode || session.Charset != charsetUCS2 {
+				t.Errorf("session = %+v, want text mode with UCS2", session)
+			}
+			if modem.commandCount(`AT+CSCS="GSM"`) != 0 || modem.commandCount("AT+CSDH=1") != 1 {
+				t.Errorf("commands = %q", modem.calls)
+			}
+		})
+	}
+}
+
+func TestInitModemSession_CNMIFallback(t *testing.T) {
+	modem := newFakeAT()
+	modem.on("AT+CMGF?", []string{"+CMGF: 0"}, nil)
+	modem.on("AT+CNMI=2,0,0,0,0", nil, at.ErrModemError)
+
+	if _, err := initModemSession(modem, []string{storageSM, storageME}, "", false); err != nil {
+		t.Fatalf("initModemSession() error = %v (fallback CNMI should succeed)", err)
+	}
+	if modem.commandCount("AT+CNMI=0,0,0,0,0") != 1 {
+		t.Error("fallback AT+CNMI=0,0,0,0,0 was not attempted")
+	}
+}
+
+func TestInitModemSession_TransportErrorIsSessionError(t *testing.T) {
+	modem := newFakeAT()
+	modem.on("AT", nil, at.ErrModemTimeout)
+
+	_, err := initModemSession(modem, []string{storageSM, storageME}, "", false)
+	var sessErr *SessionError
+	if !errors.As(err, &sessErr) {
+		t.Fatalf("error = %v, want SessionError", err)
+	}
+}
+
+// A mandatory init command failing with a modem ERROR while the SIM is absent
+// must be reported as SIM Not Detected (not Modem Init Failed), so the whole
+// SIM-out episode keeps one error type (dedup → single alert) and inherits the
+// SIM reset-and-recover path. Regression for the live SIM-pull test.
+func TestInitModemSession_CMGFErrorWithSIMOut(t *testing.T) {
+	modem := newFakeAT()
+	modem.on("AT+CMGF=0", nil, at.ErrModemError)
+	modem.on("AT+CPIN?", nil, at.ErrModemError) // SIM gone: CPIN also errors
+
+	_, err := initModemSession(modem, []string{storageSM, storageME}, "", false)
+	var diagErr *DiagnosticError
+	if !errors.As(err, &diagErr) || diagErr.Type != ErrTypeSimNotDetected {
+		t.Fatalf("error = %v, want ErrTypeSimNotDetected", err)
+	}
+}
+
+// The same failure with the SIM actually READY is a genuine init problem and
+// stays Modem Init Failed.
+func TestInitModemSession_CMGFErrorWithSIMReady(t *testing.T) {
+	modem := newFakeAT()
+	modem.on("AT+CMGF=0", nil, at.ErrModemError)
+	modem.on("AT+CPIN?", []string{"+CPIN: READY"}, nil)
+
+	_, err := initModemSession(modem, []string{storageSM, storageME}, "", false)
+	var diagErr *DiagnosticError
+	if !errors.As(err, &diagErr) || diagErr.Type != ErrTypeModemInitFailed {
+		t.Fatalf("error = %v, want ErrTypeModemInitFailed", err)
+	}
+}
+
+// A transport timeout during the SIM reprobe stays a SessionError (quiet reopen).
+func TestInitModemSession_CMGFErrorProbeTimeout(t *testing.T) {
+	modem := newFakeAT()
+	modem.on("AT+CMGF=0", nil, at.ErrModemError)
+	modem.on("AT+CPIN?", nil, at.ErrModemTimeout)
+
+	_, err := initModemSession(modem, []string{storageSM, storageME}, "", false)
+	var sessErr *SessionError
+	if !errors.As(err, &sessErr) {
+		t.Fatalf("error = %v, want SessionError", err)
+	}
+}
@@ -205,10 +205,13 @@ download_and_verify_binary() {
   fi
 }
 
-# Wait briefly, then verify the unit is active; used for post-restart health check.
+# Wait briefly, then verify the unit is running; used for post-restart health
+# check. A Type=notify unit still waiting for the modem (SubState "start")
+# counts as running; a crash loop shows as "auto-restart".
 service_healthy() {
   sleep "$HEALTH_WAIT_SECONDS"
-  systemctl is-active --quiet "$SERVICE_NAME"
+  systemctl is-active --quiet "$SERVICE_NAME" ||
+    [[ "$(systemctl show -p SubState --value "$SERVICE_NAME")" == "start" ]]
 }
 
 # --- Update-only path --------------------------------------------------------
@@ -226,9 +229,10 @@ if [[ "$UPDATE_ONLY" -eq 1 ]]; then
   fi
 
   install -m 0755 -o root -g root "$TMP_BIN" "$BIN_PATH"
+  ln -sfn sms-to-telegram "${INSTALL_DIR}/modem-diag"
 
   echo "Restarting service ${SERVICE_NAME}..."
-  systemctl restart "$SERVICE_NAME"
+  systemctl restart --no-block "$SERVICE_NAME"
 
   if service_healthy; then
     echo "Update complete. Service status:"
@@ -240,7 +244,7 @@ if [[ "$UPDATE_ONLY" -eq 1 ]]; then
   if [[ -n "$BACKUP_BIN" && -f "$BACKUP_BIN" ]]; then
     echo "Rolling back to previous binary..." >&2
     install -m 0755 -o root -g root "$BACKUP_BIN" "$BIN_PATH"
-    systemctl restart "$SERVICE_NAME" || true
+    systemctl restart --no-block "$SERVICE_NAME" || true
     if service_healthy; then
       echo "Rollback succeeded; service is running the previous binary." >&2
     else
@@ -257,6 +261,7 @@ mkdir -p "$INSTALL_DIR"
 
 download_and_verify_binary
 install -m 0755 -o root -g root "$TMP_BIN" "$BIN_PATH"
+ln -sfn sms-to-telegram "${INSTALL_DIR}/modem-diag"
 
 if ! id -u sms-forwarder >/dev/null 2>&1; then
   echo "Creating service user sms-forwarder..."
@@ -290,6 +295,7 @@ sed -i \
   -e "s|^Description=.*|Description=SMS to Telegram Forwarder (${ESC_NAME})|" \
   -e "s|^EnvironmentFile=.*|EnvironmentFile=${ESC_ENV_FILE}|" \
   -e "s|^ExecStart=.*|ExecStart=${ESC_BIN_PATH}|" \
+  -e "s|^StateDirectory=.*|StateDirectory=${ESC_NAME}|" \
   "$TMP_SERVICE"
 
 if grep -qE '^Environment=.*TELEGRAM_BOT_TOKEN' "$TMP_SERVICE"; then
@@ -302,7 +308,7 @@ install -m 0644 -o root -g root "$TMP_SERVICE" "$SERVICE_PATH"
 echo "Reloading systemd and enabling service ${SERVICE_NAME}..."
 systemctl daemon-reload
 systemctl enable "$SERVICE_NAME"
-systemctl restart "$SERVICE_NAME"
+systemctl restart --no-block "$SERVICE_NAME"
 
 if service_healthy; then
   echo "Installation complete. Service status:"
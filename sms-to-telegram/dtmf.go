@@ -0,0 +1,251 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+// DTMF calls (/dtmf): some operator services only exist as an IVR menu
+// (activating a roaming package, topping up). The modem goroutine calls
+// the number (ATD<number>;), waits until the call is answered (AT+CLCC),
+// plays the tones (AT+VTS) and hangs up. SMS are not polled meanwhile, so
+// a call is bounded by dtmfAnswerTimeout and dtmfMaxTones. The tones may
+// be a PIN: they are only logged at DEBUG and never repeated in replies.
+
+const (
+	// dtmfAnswerTimeout is how long the called service gets to answer.
+	dtmfAnswerTimeout = time.Minute
+	// dtmfPollInterval paces the AT+CLCC checks while the call rings.
+	dtmfPollInterval = time.Second
+	// dtmfPause is the wait of a "," in the tone sequence, for the IVR to
+	// finish its prompt.
+	dtmfPause = 2 * time.Second
+	// dtmfMaxTones caps the sequence, pauses included.
+	dtmfMaxTones = 64
+	// dtmfCommandTimeout bounds an admin command's wait for the call.
+	dtmfCommandTimeout = 5 * time.Minute
+	// dialTimeout bounds ATD: modems answer at once or, with COLP, once
+	// the call is answered.
+	dialTimeout = dtmfAnswerTimeout
+)
+
+var (
+	errDTMFStopped = errors.New("modem did not take the call request in time")
+	errDTMFFormat  = errors.New(`tones are 0-9, *, #, A-D and "," for a 2 second pause, at most 64`)
+)
+
+// DTMFResult describes a finished DTMF call.
+type DTMFResult struct {
+	// Answered is the time from dialing until the call was answered.
+	Answered time.Duration
+	// Tones is the number of tones sent (pauses not counted).
+	Tones int
+}
+
+func validDTMF(s string) bool {
+	if s == "" || len(s) > dtmfMaxTones {
+		return false
+	}
+	return strings.Trim(strings.ToUpper(s), "0123456789*#ABCD,") == ""
+}
+
+// dtmfCall calls number, sends tones once the call is answered and hangs
+// up. Only a transport error ends the session; the call is then left to
+// the session restart.
+func dtmfCall(ctx context.Context, modem ATCommander, number, tones string) (DTMFResult, error) {
+	var res DTMFResult
+	start := clk.Now()
+	if _, err := modem.CommandWithTimeout("ATD"+number+";", dialTimeout); err != nil {
+		if at.IsTimeoutError(err) {
+			return res, err
+		}
+		return res, fmt.Errorf("dialing refused: %w", err)
+	}
+	if err := awaitAnswer(ctx, modem, start); err != nil {
+		return res, hangUp(modem, err)
+	}
+	res.Answered = clk.Now().Sub(start)
+
+	for _, tone := range strings.ToUpper(tones) {
+		if tone == ',' {
+			if !sleepCtx(ctx, dtmfPause) {
+				return res, hangUp(modem, errDTMFStopped)
+			}
+			continue
+		}
+		if _, err := modem.Command("AT+VTS=" + string(tone)); err != nil {
+			if at.IsTimeoutError(err) {
+				return res, err
+			}
+			return res, hangUp(modem, fmt.Errorf("tone %d refused: %w", res.Tones+1, err))
+		}
+		res.Tones++
+	}
+	return res, hangUp(modem, nil)
+}
+
+// awaitAnswer polls AT+CLCC until the outgoing call is active. A call that
+// disappears was rejected, busy or not answered.
+func awaitAnswer(ctx context.Context, modem ATCommander, start time.Time) error {
+	for {
+		resp, err := modem.Command("AT+CLCC")
+		if at.IsTimeoutError(err) {
+			return err
+		}
+		if err == nil {
+			stat, ok := parseCLCC(resp)
+			switch {
+			case !ok:
+				return errors.New("call not answered (busy, rejected or no answer)")
+			case stat == 0:
+				return nil
+			}
+		}
+		if clk.Now().Sub(start) >= dtmfAnswerTimeout {
+			return fmt.Errorf("call not answered within %s", dtmfAnswerTimeout)
+		}
+		if !sleepCtx(ctx, dtmfPollInterval) {
+			return errDTMFStopped
+		}
+	}
+}
+
+// hangUp ends the call and returns err. A transport error of ATH wins: the
+// session must end. A refused ATH is not: the other side may have hung up
+// already.
+func hangUp(modem ATCommander, err error) error {
+	if _, hangErr := modem.Command("ATH"); at.IsTimeoutError(hangErr) {
+		return hangErr
+	}
+	return err
+}
+
+// parseCLCC returns the state of the outgoing voice call in an AT+CLCC
+// answer (`+CLCC: <id>,<dir>,<stat>,<mode>,...`; dir 0 is outgoing, mode 0
+// voice): 0 active, 2 dialing, 3 alerting. ok is false without one.
+func parseCLCC(lines []string) (stat int, ok bool) {
+	for _, line := range lines {
+		rest, found := strings.CutPrefix(line, "+CLCC:")
+		if !found {
+			continue
+		}
+		fields := strings.Split(rest, ",")
+		if len(fields) < 4 || strings.TrimSpace(fields[1]) != "0" || strings.TrimSpace(fields[3]) != "0" {
+			continue
+		}
+		if stat, err := strconv.Atoi(strings.TrimSpace(fields[2])); err == nil {
+			return stat, true
+		}
+	}
+	return 0, false
+}
+
+// DTMFManager hands the calls of /dtmf to the modem goroutine, like the
+// PINManager.
+type DTMFManager struct {
+	requests chan dtmfRequest
+}
+
+type dtmfRequest struct {
+	ctx    context.Context
+	number string
+	tones  string
+	result chan dtmfResult
+}
+
+type dtmfResult struct {
+	res DTMFResult
+	err error
+}
+
+func NewDTMFManager() *DTMFManager {
+	return &DTMFManager{requests: make(chan dtmfRequest, 1)}
+}
+
+// Call calls number, sends tones and hangs up.
+func (m *DTMFManager) Call(ctx context.Context, number, tones string) (DTMFResult, error) {
+	if !validDestination(number) {
+		return DTMFResult{}, fmt.Errorf("%q is not a phone number", number)
+	}
+	if !validDTMF(tones) {
+		return DTMFResult{}, errDTMFFormat
+	}
+	req := dtmfRequest{ctx: ctx, number: number, tones: tones, result: make(chan dtmfResult, 1)}
+	select {
+	case m.requests <- req:
+	case <-ctx.Done():
+		return DTMFResult{}, errDTMFStopped
+	}
+	select {
+	case r := <-req.result:
+		return r.res, r.err
+	case <-ctx.Done():
+		return DTMFResult{}, errDTMFStopped
+	}
+}
+
+// pending returns the request channel for the modem loop's select; nil
+// (never ready) for a nil manager.
+func (m *DTMFManager) pending() <-chan dtmfRequest {
+	if m == nil {
+		return nil
+	}
+	return m.requests
+}
+
+// serve runs on the modem goroutine. A transport error is returned so the
+// caller can end the session.
+func (m *DTMFManager) serve(modem ATCommander, req dtmfRequest) error {
+	if req.ctx.Err() != nil {
+		return nil
+	}
+	slog.Info("Placing DTMF call", "to", req.number, "length", len(req.tones))
+	slog.Debug("DTMF tones", "tones", req.tones)
+	res, err := dtmfCall(req.ctx, modem, req.number, req.tones)
+	req.result <- dtmfResult{res, err}
+	if err != nil {
+		slog.Warn("DTMF call failed", "to", req.number, "tones_sent", res.Tones, "error", err)
+		if at.IsTimeoutError(err) {
+			return err
+		}
+		return nil
+	}
+	slog.Info("DTMF call done", "to", req.number, "answered_after", res.Answered, "tones_sent", res.Tones)
+	return nil
+}
+
+// registerDTMFCommands wires /dtmf.
+func registerDTMFCommands(r *CommandRouter, calls *DTMFManager) {
+	r.Register("dtmf", botCommand{
+		usage:       "/dtmf <number> <tones>",
+		description: "Call a number, send DTMF tones and hang up",
+		handle: func(ctx context.Context, req commandRequest) string {
+			if len(req.Args) != 2 {
+				return "Usage: <code>/dtmf &lt;number&gt; &lt;tones&gt;</code>, e.g. <code>/dtmf +491234567 ,,1,,3#</code> " +
+					"(<code>,</code> waits 2 seconds)"
+			}
+			ctx, cancel := context.WithTimeout(ctx, dtmfCommandTimeout)
+			defer cancel()
+			res, err := calls.Call(ctx, req.Args[0], req.Args[1])
+			if err != nil {
+				reply := fmt.Sprintf("Call to <code>%s</code> failed: %s", escapeHTML(req.Args[0]), escapeHTML(err.Error()))
+				if res.Tones > 0 {
+					reply += fmt.Sprintf(" (after %d tone(s))", res.Tones)
+				}
+				return reply
+			}
+			return fmt.Sprintf("Call to <code>%s</code> answered after %s; sent %d tone(s) and hung up.",
+				escapeHTML(req.Args[0]), res.Answered.Round(time.Second), res.Tones)
+		},
+	})
+}
@@ -0,0 +1,165 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+func TestDTMFCall(t *testing.T) {
+	const dial = "ATD+491234567;"
+	const (
+		alerting = `+CLCC: 1,0,3,0,0,"+491234567",145`
+		active   = `+CLCC: 1,0,0,0,0,"+491234567",145`
+	)
+	tests := []struct {
+		name   string
+		tones  string
+		script func(f *fakeAT)
+		// wantErrIn is matched as a substring; "" for success.
+		wantErrIn string
+		wantErr   error
+		wantTones []string
+		wantHang  bool
+	}{
+		{
+			name:  "answered",
+			tones: "1,#",
+			script: func(f *fakeAT) {
+				f.on("AT+CLCC", []string{alerting}, nil)
+				f.on("AT+CLCC", []string{active}, nil)
+			},
+			wantTones: []string{"AT+VTS=1", "AT+VTS=#"},
+			wantHang:  true,
+		},
+		{
+			name:      "busy",
+			tones:     "1",
+			script:    func(f *fakeAT) { f.on("AT+CLCC", nil, nil) },
+			wantErrIn: "not answered",
+			wantHang:  true,
+		},
+		{
+			name:      "never answered",
+			tones:     "1",
+			script:    func(f *fakeAT) { f.on("AT+CLCC", []string{alerting}, nil) },
+			wantErrIn: "within 1m0s",
+			wantHang:  true,
+		},
+		{
+			name:      "dialing refused",
+			tones:     "1",
+			script:    func(f *fakeAT) { f.on(dial, nil, at.ErrModemError) },
+			wantErrIn: "dialing refused",
+		},
+		{
+			name:  "tone refused",
+			tones: "12",
+			script: func(f *fakeAT) {
+				f.on("AT+CLCC", []string{active}, nil)
+				f.on("AT+VTS=2", nil, at.ErrModemError)
+			},
+			wantErrIn: "tone 2 refused",
+			wantTones: []string{"AT+VTS=1", "AT+VTS=2"},
+			wantHang:  true,
+		},
+		{
+			name:  "transport error",
+			tones: "1",
+			script: func(f *fakeAT) {
+				f.on("AT+CLCC", []string{active}, nil)
+				f.on("AT+VTS=1", nil, at.ErrModemTimeout)
+			},
+			wantErr:   at.ErrModemTimeout,
+			wantTones: []string{"AT+VTS=1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer swapClock(newFakeClock())()
+			f := newFakeAT()
+			tt.script(f)
+			_, err := dtmfCall(context.Background(), f, "+491234567", tt.tones)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("dtmfCall() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantErrIn != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrIn) {
+					t.Fatalf("dtmfCall() error = %v, want one containing %q", err, tt.wantErrIn)
+				}
+			case err != nil:
+				t.Fatalf("dtmfCall() error = %v", err)
+			}
+			var tones []string
+			for _, c := range f.calls {
+				if strings.HasPrefix(c, "AT+VTS=") {
+					tones = append(tones, c)
+				}
+			}
+			if strings.Join(tones, " ") != strings.Join(tt.wantTones, " ") {
+				t.Errorf("tones = %q, want %q", tones, tt.wantTones)
+			}
+			if hung := f.commandCount("ATH") == 1; hung != tt.wantHang {
+				t.Errorf("calls = %q, hung up %v, want %v", f.calls, hung, tt.wantHang)
+			}
+		})
+	}
+}
+
+func TestParseCLCC(t *testing.T) {
+	for _, tt := range []struct {
+		lines  []string
+		want   int
+		wantOK bool
+	}{
+		{[]string{`+CLCC: 1,0,0,0,0,"+491234567",145`}, 0, true},
+		{[]string{`+CLCC: 1,1,4,0,0,"+49555",145`, `+CLCC: 2,0,2,0,0,"+491234567",145`}, 2, true},
+		{[]string{`+CLCC: 1,0,0,1,0,"",129`}, 0, false}, // data call
+		{nil, 0, false},
+	} {
+		if got, ok := parseCLCC(tt.lines); got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseCLCC(%q) = %d, %v; want %d, %v", tt.lines, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestDTMFManagerServe(t *testing.T) {
+	defer swapClock(newFakeClock())()
+	m := NewDTMFManager()
+	f := newFakeAT()
+	f.on("AT+CLCC", []string{`+CLCC: 1,0,0,0,0,"+491234567",145`}, nil)
+
+	done := make(chan error, 1)
+	go func() { done <- m.serve(f, <-m.pending()) }()
+	res, err := m.Call(context.Background(), "+491234567", "1,2")
+	if err != nil || res.Tones != 2 {
+		t.Errorf("Call() = %+v, %v; want 2 tones", res, err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("serve() = %v", err)
+	}
+
+	// Invalid requests never reach the modem goroutine.
+	for _, args := range [][2]string{{"+49x", "1"}, {"+491234567", "1p2"}, {"+491234567", strings.Repeat("1", 65)}} {
+		if _, err := m.Call(context.Background(), args[0], args[1]); err == nil {
+			t.Errorf("Call(%q, %q) accepted", args[0], args[1])
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Call(ctx, "+491234567", "1"); !errors.Is(err, errDTMFStopped) {
+		t.Errorf("Call(cancelled) error = %v, want errDTMFStopped", err)
+	}
+	var none *DTMFManager
+	if none.pending() != nil {
+		t.Error("nil manager has a request channel")
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// emulate-modem: a SIM800 on a pseudo-terminal, for trying the gateway, its
+// configuration and the sinks without hardware. SMS typed on stdin land in
+// its SIM storage, where the gateway lists and deletes them like received
+// ones. The integration test runs the service against the same modem.
+
+// emulatedSlots is the size of the emulated SIM storage.
+const emulatedSlots = 30
+
+func cmdEmulateModem(args []string, stdout, stderr io.Writer) int {
+	fs := newCommandFlags("emulate-modem", stderr)
+	link := fs.String("link", "", "also reach the modem through this symlink, e.g. a fixed SERIAL_PORT")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return emulateModem(ctx, os.Stdin, stdout, stderr, *link)
+}
+
+// emulateModem serves the modem until ctx ends. Each stdin line is an SMS
+// for the SIM: "<sender> <text>" or a hex PDU as a modem lists it.
+func emulateModem(ctx context.Context, in io.Reader, stdout, stderr io.Writer, link string) int {
+	master, port, err := openPTY()
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+	defer master.Close()
+	if link != "" {
+		if err := linkPTY(port, link); err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return 1
+		}
+		defer os.Remove(link)
+		port = link
+	}
+	modem := newPTYModem(master)
+	modem.simInserted, modem.simReady = true, true
+	go modem.serve()
+	fmt.Fprintf(stdout, "Emulated SIM800 on %s: run the gateway with SERIAL_PORT=%s\n", port, port)
+	fmt.Fprintln(stdout, `Type an SMS as "<sender> <text>" or a hex PDU, one per line; Ctrl-C stops.`)
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 4096), 1<<20)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	var ref byte
+	for {
+		select {
+		case <-ctx.Done():
+			return 0
+		case line, ok := <-lines:
+			if !ok {
+				// End of input: keep serving what is stored.
+				lines = nil
+				continue
+			}
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			ref++
+			pdus, err := emulatedSMS(line, ref)
+			if err == nil {
+				var slots []int
+				if slots, err = modem.storeFree(pdus); err == nil {
+					fmt.Fprintf(stdout, "Stored in SIM slots %v\n", slots)
+				}
+			}
+			if err != nil {
+				fmt.Fprintf(stderr, "%v\n", err)
+			}
+		}
+	}
+}
+
+// emulatedSMS returns the PDUs of a stdin line of emulateModem.
+func emulatedSMS(line string, ref byte) ([]string, error) {
+	from, text, ok := strings.Cut(line, " ")
+	if !ok {
+		raw := strings.ToUpper(line)
+		if err := checkListable(raw); err != nil {
+			return nil, fmt.Errorf("invalid PDU: %w", err)
+		}
+		return []string{raw}, nil
+	}
+	return encodeDeliverText(from, strings.TrimSpace(text), ref)
+}
+
+// linkPTY points link at the pty. A symlink left by an earlier run is
+// replaced; anything else at link is left alone.
+func linkPTY(port, link string) error {
+	if fi, err := os.Lstat(link); err == nil {
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("-link %s exists and is not a symlink", link)
+		}
+		if err := os.Remove(link); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(port, link)
+}
+
+// openPTY returns the master side of a new pseudo-terminal and the path of
+// its slave, which the gateway opens as its serial port.
+func openPTY() (*os.File, string, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, "", fmt.Errorf("no pty support: %w", err)
+	}
+	conn, err := master.SyscallConn()
+	if err != nil {
+		master.Close()
+		return nil, "", err
+	}
+	var unlock, n uint32
+	var ioctlErr syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		if _, _, ioctlErr = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); ioctlErr != 0 {
+			return
+		}
+		_, _, ioctlErr = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n)))
+	})
+	if err == nil && ioctlErr != 0 {
+		err = ioctlErr
+	}
+	if err != nil {
+		master.Close()
+		return nil, "", fmt.Errorf("pty setup: %w", err)
+	}
+	return master, fmt.Sprintf("/dev/pts/%d", n), nil
+}
+
+// ptyModem answers AT commands on the pty master like a SIM800 with a SIM
+// storage of emulatedSlots slots. A hot-inserted SIM is only seen after
+// AT+CFUN=1, as on the real modem.
+type ptyModem struct {
+	master *os.File
+
+	mu          sync.Mutex
+	simReady    bool
+	simInserted bool
+	slots       map[int]string // SIM slot → PDU
+	commands    map[string]int // command → times received
+}
+
+func newPTYModem(master *os.File) *ptyModem {
+	return &ptyModem{master: master, slots: make(map[int]string), commands: make(map[string]int)}
+}
+
+// store puts an incoming SMS into a SIM slot.
+func (m *ptyModem) store(index int, pdu string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.slots[index] = pdu
+}
+
+// storeFree puts the PDUs of one SMS into the lowest free SIM slots.
+func (m *ptyModem) storeFree(pdus []string) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var free []int
+	for index := 1; index <= emulatedSlots && len(free) < len(pdus); index++ {
+		if _, used := m.slots[index]; !used {
+			free = append(free, index)
+		}
+	}
+	if len(free) < len(pdus) {
+		return nil, errors.New("SIM storage full: start the gateway to empty it")
+	}
+	for i, index := range free {
+		m.slots[index] = pdus[i]
+	}
+	return free, nil
+}
+
+// serve runs until the master is closed. Reads fail with EIO while the
+// gateway has the slave closed (between sessions); those are waited out.
+func (m *ptyModem) serve() {
+	var line []byte
+	buf := make([]byte, 512)
+	for {
+		n, err := m.master.Read(buf)
+		if errors.Is(err, os.ErrClosed) {
+			return
+		}
+		if err != nil {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		for _, c := range buf[:n] {
+			switch c {
+			case '\r':
+				if cmd := strings.TrimSpace(string(line)); cmd != "" {
+					m.reply(m.respond(cmd))
+				}
+				line = line[:0]
+			case '\n':
+			default:
+				line = append(line, c)
+			}
+		}
+	}
+}
+
+func (m *ptyModem) reply(lines []string, ok bool) {
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString("\r\n" + l + "\r\n")
+	}
+	if ok {
+		b.WriteString("\r\nOK\r\n")
+	} else {
+		b.WriteString("\r\nERROR\r\n")
+	}
+	m.master.WriteString(b.String())
+}
+
+func (m *ptyModem) respond(cmd string) ([]string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands[cmd]++
+	switch {
+	case cmd == "AT", cmd == "ATE0", cmd == "AT+CFUN=0", strings.HasPrefix(cmd, "AT+CNMI="):
+		return nil, true
+	case cmd == "AT+CFUN=1":
+		m.simReady = m.simInserted
+		return nil, true
+	case cmd == "ATI":
+		return []string{"SIM800 R14.18"}, true
+	case cmd == "AT+CPIN?":
+		if !m.simReady {
+			return nil, false
+		}
+		return []string{"+CPIN: READY"}, true
+	case cmd == "AT+CCID":
+		if !m.simReady {
+			return nil, false
+		}
+		return []string{"89440000000000000017"}, true
+	case cmd == "AT+CMGF=0":
+		return nil, m.simReady
+	case cmd == "AT+CMGF?":
+		return []string{"+CMGF: 0"}, true
+	case strings.HasPrefix(cmd, "AT+CPMS"):
+		n := len(m.slots)
+		return []string{fmt.Sprintf(`+CPMS: "SM",%d,%d,"SM",%d,%d,"SM",%d,%d`, n, emulatedSlots, n, emulatedSlots, n, emulatedSlots)}, true
+	case cmd == "AT+CSQ":
+		return []string{"+CSQ: 18,0"}, true
+	case cmd == "AT+CREG?":
+		return []string{"+CREG: 0,1"}, true
+	case cmd == "AT+COPS?":
+		return []string{`+COPS: 0,0,"Test Operator"`}, true
+	case cmd == "AT+CMGL=4":
+		var lines []string
+		for _, index := range slices.Sorted(maps.Keys(m.slots)) {
+			pdu := m.slots[index]
+			smscLen, _ := strconv.ParseUint(pdu[:2], 16, 8)
+			lines = append(lines, fmt.Sprintf("+CMGL: %d,1,,%d", index, len(pdu)/2-int(smscLen)-1), pdu)
+		}
+		return lines, true
+	case strings.HasPrefix(cmd, "AT+CMGD="):
+		index, err := strconv.Atoi(strings.TrimPrefix(cmd, "AT+CMGD="))
+		if err != nil {
+			return nil, false
+		}
+		delete(m.slots, index)
+		return nil, true
+	}
+	return nil, false
+}
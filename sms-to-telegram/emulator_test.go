@@ -0,0 +1,87 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEmulatedSMS(t *testing.T) {
+	tests := []struct {
+		line    string
+		parts   int
+		wantErr string
+	}{
+		{line: "+4915550001234 code 4711", parts: 1},
+		{line: "+4915550001234 " + strings.Repeat("long ", 40), parts: 2},
+		{line: testPDUSingle, parts: 1},
+		{line: strings.ToLower(testPDUSingle), parts: 1},
+		{line: "Bank hello", wantErr: "not a phone number"},
+		{line: "0791", wantErr: "invalid PDU"},
+	}
+	for _, tt := range tests {
+		pdus, err := emulatedSMS(tt.line, 1)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("emulatedSMS(%q) error = %v, want %q", tt.line, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || len(pdus) != tt.parts {
+			t.Errorf("emulatedSMS(%q) = %d PDUs, %v; want %d", tt.line, len(pdus), err, tt.parts)
+		}
+	}
+}
+
+// The emulated modem is reached through -link by a real AT session, which
+// lists the SMS typed on stdin.
+func TestEmulateModem(t *testing.T) {
+	master, _, err := openPTY()
+	if err != nil {
+		t.Skipf("%v", err)
+	}
+	master.Close()
+	link := filepath.Join(t.TempDir(), "ttyEMU")
+	stdin, typed := io.Pipe()
+	out, stdout := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int, 1)
+	go func() { done <- emulateModem(ctx, stdin, stdout, io.Discard, link) }()
+	defer func() {
+		cancel()
+		typed.Close()
+		go io.Copy(io.Discard, out)
+		if code := <-done; code != 0 {
+			t.Errorf("emulateModem() = %d, want 0", code)
+		}
+	}()
+
+	lines := bufio.NewScanner(out)
+	if !lines.Scan() || !strings.Contains(lines.Text(), "SERIAL_PORT="+link) {
+		t.Fatalf("first line = %q, want the port", lines.Text())
+	}
+	lines.Scan()
+	io.WriteString(typed, "+4915550001234 code 4711\n")
+	if !lines.Scan() || lines.Text() != "Stored in SIM slots [1]" {
+		t.Fatalf("reply = %q, want slot 1", lines.Text())
+	}
+
+	modem, port, used, total, err := openModemSession(link, 115200, nil)
+	if err != nil {
+		t.Fatalf("openModemSession() error = %v", err)
+	}
+	defer port.Close()
+	if used != 1 || total != emulatedSlots {
+		t.Errorf("storage = %d/%d, want 1/%d", used, total, emulatedSlots)
+	}
+	listing, err := modem.Command("AT+CMGL=4")
+	if err != nil || len(listing) != 2 || !strings.HasPrefix(listing[0], "+CMGL: 1,") {
+		t.Errorf("listing = %q, %v; want the typed SMS in slot 1", listing, err)
+	}
+}
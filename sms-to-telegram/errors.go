@@ -72,11 +72,51 @@ type ErrorNotifier struct {
 	// others are not re-notified.
 	chatState         map[int64]DiagnosticErrorType
 	storageLowAlerted bool
-	sender            TelegramSender
-	chatIDs           []int64
-	dryRun            bool
-	hostname          string
-	sendTimeout       time.Duration
+	stuckSlotsAlerted bool
+	// storageFailover is the storage SMS are received in instead of
+	// SMS_STORAGE once alerted; "" when on the preferred one.
+	storageFailover string
+	sender          TelegramSender
+	chatIDs         []int64
+	dryRun          bool
+	hostname        string
+	// instance adds the INSTANCE_LABELS to the Host line; nil shows the
+	// host name alone.
+	instance    *Instance
+	sendTimeout time.Duration
+	// reminderInterval re-sends an unchanged alert to a chat whose last
+	// alert is that old (ALERT_REMINDER_INTERVAL); 0 alerts once.
+	reminderInterval time.Duration
+	chatAlertedAt    map[int64]time.Time // last alert delivered per chat
+	errorSince       time.Time           // start of the current condition
+	// policy tunes deduplication (see AlertPolicy); groupAlerted and
+	// recoveredAt are the per-chat times it is checked against.
+	policy       AlertPolicy
+	groupAlerted map[alertKey]time.Time
+	recoveredAt  map[int64]time.Time
+	// ha mirrors the alert state to Home Assistant; nil disables.
+	ha *HomeAssistant
+	// events records diagnostic events in the host log; nil disables.
+	// eventErr is the last logged error type, so recovery is logged once.
+	events   *EventLog
+	eventErr DiagnosticErrorType
+	// pinger reports failures to the dead-man's-switch monitor; nil disables.
+	pinger *HealthPinger
+	// health backs the /healthz and /readyz endpoints; nil disables.
+	health *HealthState
+	// sentry reports diagnostic errors to Sentry; nil disables.
+	sentry *SentryReporter
+	// systemd receives readiness and status updates; nil outside systemd.
+	systemd *SystemdNotifier
+	// metrics backs the /metrics gauges; nil disables.
+	metrics *Metrics
+	// signalAlert enables the weak-signal alert; nil disables.
+	signalAlert *SignalAlertOptions
+	signal      signalState
+	// batteryAlert is the low-battery threshold in percent and enables the
+	// battery alerts; 0 disables.
+	batteryAlert int
+	battery      batteryState
 }
 
 // NewErrorNotifier creates a new error notifier
@@ -85,15 +125,26 @@ func NewErrorNotifier(sender TelegramSender, chatIDs []int64, dryRun bool, hostn
 		sendTimeout = 20 * time.Second
 	}
 	return &ErrorNotifier{
-		chatState:   make(map[int64]DiagnosticErrorType),
-		sender:      sender,
-		chatIDs:     chatIDs,
-		dryRun:      dryRun,
-		hostname:    hostname,
-		sendTimeout: sendTimeout,
+		chatState:     make(map[int64]DiagnosticErrorType),
+		chatAlertedAt: make(map[int64]time.Time),
+		groupAlerted:  make(map[alertKey]time.Time),
+		recoveredAt:   make(map[int64]time.Time),
+		sender:        sender,
+		chatIDs:       chatIDs,
+		dryRun:        dryRun,
+		hostname:      hostname,
+		sendTimeout:   sendTimeout,
 	}
 }
 
+// SetChatIDs replaces the alert recipients (configuration reload). Chats
+// that were removed lose their alert state; new chats start without one.
+func (n *ErrorNotifier) SetChatIDs(chatIDs []int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.chatIDs = chatIDs
+}
+
 // alertGroup maps diagnostic error types onto deduplication groups. No-signal
 // and not-registered are physically one flapping condition (weak/absent
 // coverage): a marginal site alternates between CSQ=99 and CREG=2 across
@@ -108,22 +159,55 @@ func alertGroup(t DiagnosticErrorType) DiagnosticErrorType {
 }
 
 // NotifyError sends error notification to every chat whose last delivered
-// state is in a different dedup group than this error. Returns true if at
-// least one chat was notified. A chat whose send fails keeps its old state
-// and is retried on the next NotifyError call.
+// state is in a different dedup group than this error (or on every
+// occurrence, per the AlertPolicy, unless it holds the alert back), and a
+// reminder to chats whose alert for the same condition is older than the
+// reminder interval. Returns true if at least one chat was notified. A chat whose
+// send fails keeps its old state and is retried on the next NotifyError call.
 func (n *ErrorNotifier) NotifyError(ctx context.Context, diagErr *DiagnosticError) bool {
+	n.ha.PublishProblem(ctx, diagErr.Type)
+	n.events.DiagnosticError(diagErr)
+	n.pinger.Fail()
+	n.ModemDown(errorTypeName(diagErr.Type))
+	n.sentry.ReportDiagnostic(ctx, diagErr)
+
 	n.mu.Lock()
 	defer n.mu.Unlock()
+	now := clk.Now()
+	if n.eventErr == ErrTypeNone || alertGroup(n.eventErr) != alertGroup(diagErr.Type) {
+		n.errorSince = now
+	}
+	n.eventErr = diagErr.Type
 
 	msg := n.formatErrorMessage(diagErr)
 	notified := false
 	for _, chatID := range n.chatIDs {
-		if alertGroup(n.chatState[chatID]) == alertGroup(diagErr.Type) {
+		sameCondition := alertGroup(n.chatState[chatID]) == alertGroup(diagErr.Type)
+		if sameCondition && !n.policy.EveryOccurrence[diagErr.Type] {
 			// Same condition (possibly a refined sibling type): remember the
 			// latest type silently so recovery names the current state.
 			n.chatState[chatID] = diagErr.Type
-			slog.Debug("Skipping duplicate error notification",
-				"chat_id", chatID, "type", errorTypeName(diagErr.Type))
+			if n.reminderInterval <= 0 || now.Sub(n.chatAlertedAt[chatID]) < n.reminderInterval {
+				slog.Debug("Skipping duplicate error notification",
+					"chat_id", chatID, "type", errorTypeName(diagErr.Type))
+				continue
+			}
+			ongoing := now.Sub(n.errorSince)
+			slog.Info("Sending error reminder",
+				"chat_id", chatID, "type", errorTypeName(diagErr.Type), "ongoing", ongoing.Truncate(time.Second))
+			reminder := msg + "\n\n<b>Reminder:</b> ongoing for " + formatDuration(ongoing)
+			if err := n.sendToChat(ctx, chatID, reminder); err != nil {
+				slog.Error("Failed to send error reminder to Telegram",
+					"chat_id", chatID, "error", err)
+				continue
+			}
+			n.chatAlertedAt[chatID] = now
+			notified = true
+			continue
+		}
+		if reason := n.holdAlert(chatID, diagErr.Type, now); reason != "" {
+			slog.Debug("Holding back error notification",
+				"chat_id", chatID, "type", errorTypeName(diagErr.Type), "reason", reason)
 			continue
 		}
 		slog.Info("Sending error notification",
@@ -137,16 +221,53 @@ func (n *ErrorNotifier) NotifyError(ctx context.Context, diagErr *DiagnosticErro
 			continue
 		}
 		n.chatState[chatID] = diagErr.Type
+		n.chatAlertedAt[chatID] = now
+		n.groupAlerted[alertKey{chatID, alertGroup(diagErr.Type)}] = now
 		notified = true
 	}
 	return notified
 }
 
+// Heartbeat records a healthy modem cycle for the liveness reporters
+// (dead-man's-switch pings, readiness endpoint, systemd).
+func (n *ErrorNotifier) Heartbeat() {
+	n.pinger.Beat()
+	n.health.ModemHealthy()
+	n.metrics.ModemHealthy()
+	n.systemd.Ready()
+	n.systemd.Status("Modem healthy, polling SIM")
+}
+
+// ModemDown records why the modem session is not usable for the readiness
+// endpoint, /status and the systemd status line, and drops the stale
+// signal gauge.
+func (n *ErrorNotifier) ModemDown(reason string) {
+	n.health.ModemDown(reason)
+	n.metrics.ModemDown(reason)
+	n.resetSignalRun()
+	n.systemd.Status("Modem down: " + reason)
+}
+
+// NotifyStartup announces a (re)start with the running build to every chat
+// (STARTUP_NOTIFY), so an upgrade or an unexpected restart is visible.
+func (n *ErrorNotifier) NotifyStartup(ctx context.Context, build BuildInfo) {
+	if err := n.sendToTelegram(ctx, startupMessage(n.hostHTML(), build)); err != nil {
+		slog.Error("Failed to send startup notification to Telegram", "error", err)
+	}
+}
+
 // NotifyRecovery sends a recovery notification to every chat that previously
 // received an error. Returns true if at least one chat was notified.
 func (n *ErrorNotifier) NotifyRecovery(ctx context.Context) bool {
+	n.ha.PublishProblem(ctx, ErrTypeNone)
+	n.sentry.Recovered()
+
 	n.mu.Lock()
 	defer n.mu.Unlock()
+	if n.eventErr != ErrTypeNone {
+		n.events.Recovered(n.eventErr)
+		n.eventErr = ErrTypeNone
+	}
 
 	notified := false
 	for _, chatID := range n.chatIDs {
@@ -158,10 +279,10 @@ func (n *ErrorNotifier) NotifyRecovery(ctx context.Context) bool {
 			"chat_id", chatID, "previous_error", errorTypeName(prevError))
 
 		msg := fmt.Sprintf("<b>SMS Gateway Recovered</b>\n\n"+
-			"<b>Host:</b> <code>%s</code>\n"+
+			"<b>Host:</b> %s\n"+
 			"<b>Status:</b> Modem is now operational\n"+
 			"<b>Previous error:</b> %s",
-			escapeHTML(n.hostname),
+			n.hostHTML(),
 			errorTypeName(prevError))
 
 		if err := n.sendToChat(ctx, chatID, msg); err != nil {
@@ -170,6 +291,7 @@ func (n *ErrorNotifier) NotifyRecovery(ctx context.Context) bool {
 			continue
 		}
 		n.chatState[chatID] = ErrTypeNone
+		n.recoveredAt[chatID] = clk.Now()
 		notified = true
 	}
 	if !notified {
@@ -193,7 +315,7 @@ func (n *ErrorNotifier) formatErrorMessage(err *DiagnosticError) string {
 		details = "SIM card is not inserted or not detected. Check SIM card installation."
 	case ErrTypeSimPinRequired:
 		title = "SIM PIN Required"
-		details = "SIM card requires PIN code. Disable PIN or configure PIN entry."
+		details = "SIM card requires PIN code. Disable the PIN check or set SIM_PIN."
 	case ErrTypeSimPukLocked:
 		title = "SIM PUK Locked"
 		details = "SIM card is PUK locked. Use carrier PUK code to unlock."
@@ -224,11 +346,11 @@ func (n *ErrorNotifier) formatErrorMessage(err *DiagnosticError) string {
 	// output, and an unescaped < or & would make Telegram reject the alert
 	// exactly when the operator needs it.
 	return fmt.Sprintf("<b>SMS Gateway Alert</b>\n\n"+
-		"<b>Host:</b> <code>%s</code>\n"+
+		"<b>Host:</b> %s\n"+
 		"<b>Error:</b> %s\n"+
 		"<b>Details:</b> %s\n\n"+
 		"<i>%s</i>",
-		escapeHTML(n.hostname),
+		n.hostHTML(),
 		escapeHTML(title),
 		escapeHTML(details),
 		escapeHTML(err.Message))
@@ -259,6 +381,12 @@ func (n *ErrorNotifier) sendToChat(ctx context.Context, chatID int64, text strin
 	return nil
 }
 
+// hostHTML renders the Host value of the notifications: the host (or
+// instance) name and the instance labels.
+func (n *ErrorNotifier) hostHTML() string {
+	return formatInstance(n.hostname, n.instance)
+}
+
 // sendToTelegram broadcasts a notification to every chat (used for stateless
 // alerts like storage warnings and rejected-message notices).
 func (n *ErrorNotifier) sendToTelegram(ctx context.Context, text string) error {
@@ -312,6 +440,33 @@ func (n *ErrorNotifier) HasError() bool {
 	return false
 }
 
+// ActiveAlerts lists the conditions currently alerted for /status: the
+// diagnostic error and the warnings outside the error-type state machine.
+func (n *ErrorNotifier) ActiveAlerts() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var alerts []string
+	if n.eventErr != ErrTypeNone {
+		alerts = append(alerts, errorTypeName(n.eventErr))
+	}
+	if n.storageLowAlerted {
+		alerts = append(alerts, errorTypeName(ErrTypeStorageLow))
+	}
+	if n.signal.alerted {
+		alerts = append(alerts, "Weak Signal")
+	}
+	if n.battery.onBatteryAlerted {
+		alerts = append(alerts, "On Battery")
+	}
+	if n.battery.lowAlerted {
+		alerts = append(alerts, "Low Battery")
+	}
+	if n.storageFailover != "" {
+		alerts = append(alerts, "Storage Failover")
+	}
+	return alerts
+}
+
 // SIM storage alerting thresholds (percent), with hysteresis so the alert
 // does not flap around the boundary.
 const (
@@ -327,6 +482,7 @@ func (n *ErrorNotifier) CheckStorage(ctx context.Context, used, total int) {
 	if total <= 0 || used < 0 {
 		return
 	}
+	n.metrics.StorageSampled(used, total)
 	percent := used * 100 / total
 
 	n.mu.Lock()
@@ -345,11 +501,12 @@ func (n *ErrorNotifier) CheckStorage(ctx context.Context, used, total int) {
 	}
 
 	slog.Warn("SIM storage almost full", "used", used, "total", total)
+	n.events.StorageLow(used, total)
 	msg := fmt.Sprintf("<b>SMS Gateway Alert</b>\n\n"+
-		"<b>Host:</b> <code>%s</code>\n"+
+		"<b>Host:</b> %s\n"+
 		"<b>Warning:</b> SIM storage almost full (%d/%d slots used)\n\n"+
 		"<i>New SMS may be rejected once the SIM is full. Check for stuck or rejected messages.</i>",
-		escapeHTML(n.hostname), used, total)
+		n.hostHTML(), used, total)
 	if err := n.sendToTelegram(ctx, msg); err != nil {
 		slog.Error("Failed to send storage alert", "error", err)
 		// Re-arm so the alert is retried on the next check.
@@ -185,3 +185,54 @@ func TestErrorNotifier_FormatMessage(t *testing.T) {
 		})
 	}
 }
+
+// TestErrorNotifier_Reminders: a persisting condition is re-alerted once per
+// reminder interval with its age; a new condition or a recovery starts over.
+func TestErrorNotifier_Reminders(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	ctx := context.Background()
+	sender := &fakeSender{}
+	notifier := NewErrorNotifier(sender, []int64{1}, false, "gw1", time.Second)
+	notifier.reminderInterval = 6 * time.Hour
+
+	steps := []struct {
+		advance  time.Duration
+		errType  DiagnosticErrorType
+		wantSent int
+	}{
+		{0, ErrTypeNoSignal, 1},
+		{2 * time.Hour, ErrTypeNoSignal, 1},
+		{4 * time.Hour, ErrTypeNetworkNotRegistered, 2}, // same group, 6h later
+		{time.Hour, ErrTypeNoSignal, 2},
+		{5 * time.Hour, ErrTypeNoSignal, 3},
+		{time.Minute, ErrTypeSimNotDetected, 4}, // new condition alerts at once
+		{time.Hour, ErrTypeSimNotDetected, 4},
+	}
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		notifier.NotifyError(ctx, NewDiagnosticError(step.errType, "x"))
+		if got := len(sender.sentTo(1)); got != step.wantSent {
+			t.Fatalf("step %d: %d messages, want %d", i, got, step.wantSent)
+		}
+	}
+	sent := sender.sentTo(1)
+	if strings.Contains(sent[0].Text, "Reminder") {
+		t.Errorf("first alert marked as reminder: %q", sent[0].Text)
+	}
+	if !strings.Contains(sent[1].Text, "<b>Reminder:</b> ongoing for 6h 0m") ||
+		!strings.Contains(sent[1].Text, "Network Not Registered") {
+		t.Errorf("first reminder = %q", sent[1].Text)
+	}
+	if !strings.Contains(sent[2].Text, "ongoing for 12h 0m") {
+		t.Errorf("second reminder = %q", sent[2].Text)
+	}
+
+	// Without an interval an alert is sent once.
+	notifier.reminderInterval = 0
+	clock.Advance(48 * time.Hour)
+	notifier.NotifyError(ctx, NewDiagnosticError(ErrTypeSimNotDetected, "x"))
+	if got := len(sender.sentTo(1)); got != 4 {
+		t.Errorf("reminders disabled: %d messages, want 4", got)
+	}
+}
@@ -0,0 +1,561 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+// Consumer eSIM profiles (SGP.22) are managed by the eUICC's ISD-R through
+// the ES10c functions. There are no AT commands for them: the ES10c
+// requests are STORE DATA APDUs, sent over a logical channel of the generic
+// UICC access commands (3GPP 27.007 AT+CCHO, AT+CGLA, AT+CCHC) that most
+// LTE modems support.
+
+// isdrAID is the application identifier of the ISD-R.
+const isdrAID = "A0000005591010FFFFFFFF8900000100"
+
+// ES10c request tags.
+const (
+	tagGetProfilesInfo = 0xBF2D
+	tagEnableProfile   = 0xBF31
+)
+
+// maxAPDUChain bounds the GET RESPONSE rounds of one command.
+const maxAPDUChain = 32
+
+// esimCommandTimeout bounds an admin command's wait for the modem
+// goroutine (session down, or busy with a long poll).
+const esimCommandTimeout = 2 * time.Minute
+
+var (
+	// errESIMUnsupported: the modem or card offers no ISD-R channel.
+	errESIMUnsupported = errors.New("modem or SIM has no eSIM (eUICC) access")
+	// errESIMStopped mirrors errOutboxStopped for eSIM requests.
+	errESIMStopped = errors.New("modem did not take the eSIM request in time")
+	// errESIMSwitched ends the session after a profile switch: the modem
+	// reloads the SIM and is initialized again.
+	errESIMSwitched = errors.New("eSIM profile switched: reinitializing the modem")
+	// errSIMBusy refuses a SIM change while SMS of the current SIM are
+	// being delivered.
+	errSIMBusy = errors.New("SMS from the current SIM are still being delivered, try again shortly")
+)
+
+// ESIMProfile is one profile installed on the eUICC.
+type ESIMProfile struct {
+	ICCID    string
+	Enabled  bool
+	Nickname string
+	Provider string // service provider name
+	Name     string // profile name
+	// Class is "test", "provisioning" or "operational".
+	Class string
+}
+
+// Label is the name a user knows the profile by.
+func (p ESIMProfile) Label() string {
+	for _, s := range []string{p.Nickname, p.Name, p.Provider} {
+		if s != "" {
+			return s
+		}
+	}
+	return "(unnamed)"
+}
+
+// enableProfileResults are the EnableProfile result codes (SGP.22 5.7.16).
+var enableProfileResults = map[int]string{
+	1:   "ICCID not found on the eUICC",
+	2:   "profile is not disabled (already active?)",
+	3:   "disallowed by the profile policy rules",
+	4:   "wrong profile re-enabling",
+	5:   "the card is busy (CAT busy)",
+	127: "undefined error",
+}
+
+// esimChannel is an open logical channel to the ISD-R.
+type esimChannel struct {
+	modem   ATCommander
+	session int
+}
+
+// openESIM opens the ISD-R channel; errESIMUnsupported when the modem or
+// the card refuses.
+func openESIM(modem ATCommander) (*esimChannel, error) {
+	resp, err := modem.Command(`AT+CCHO="` + isdrAID + `"`)
+	if at.IsTimeoutError(err) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: AT+CCHO: %v", errESIMUnsupported, err)
+	}
+	// "+CCHO: <sessionid>", or the bare number on some firmwares.
+	for _, line := range resp {
+		if session, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "+CCHO:"))); err == nil {
+			return &esimChannel{modem: modem, session: session}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no session in %q", errESIMUnsupported, strings.Join(resp, " "))
+}
+
+func (c *esimChannel) close() error {
+	_, err := c.modem.Command(fmt.Sprintf("AT+CCHC=%d", c.session))
+	return err
+}
+
+// cla is the class byte of an ES10 command on the channel (ETSI TS 102 221
+// 10.1.1: channels 1-3 and 4-19 are coded differently).
+func (c *esimChannel) cla() byte {
+	switch {
+	case c.session >= 1 && c.session <= 3:
+		return 0x80 | byte(c.session)
+	case c.session >= 4 && c.session <= 19:
+		return 0xC0 | byte(c.session-4)
+	}
+	return 0x80
+}
+
+// storeData sends one ES10c request (a single STORE DATA block: the
+// requests used here are far below 255 bytes) and returns the response.
+func (c *esimChannel) storeData(data []byte) ([]byte, error) {
+	apdu := append([]byte{c.cla(), 0xE2, 0x91, 0x00, byte(len(data))}, data...)
+	apdu = append(apdu, 0x00)
+	var out []byte
+	for range maxAPDUChain {
+		resp, sw, err := c.transmit(apdu)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, resp...)
+		switch {
+		case sw == 0x9000:
+			return out, nil
+		case sw>>8 == 0x61: // more data: GET RESPONSE
+			apdu = []byte{c.cla() &^ 0x80, 0xC0, 0x00, 0x00, byte(sw)}
+		default:
+			return nil, fmt.Errorf("eUICC answered status %04X", sw)
+		}
+	}
+	return nil, fmt.Errorf("eUICC response longer than %d blocks", maxAPDUChain)
+}
+
+// transmit sends one APDU with AT+CGLA and splits the status word off.
+func (c *esimChannel) transmit(apdu []byte) ([]byte, uint16, error) {
+	cmd := strings.ToUpper(hex.EncodeToString(apdu))
+	resp, err := c.modem.Command(fmt.Sprintf(`AT+CGLA=%d,%d,"%s"`, c.session, len(cmd), cmd))
+	if err != nil {
+		return nil, 0, err
+	}
+	// +CGLA: <length>,"<response hex>"
+	for _, line := range resp {
+		rest, ok := strings.CutPrefix(line, "+CGLA:")
+		if !ok {
+			continue
+		}
+		length, body, ok := strings.Cut(rest, ",")
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		body = strings.Trim(strings.TrimSpace(body), `"`)
+		if !ok || err != nil || n != len(body) || n < 4 {
+			break
+		}
+		raw, err := hex.DecodeString(body)
+		if err != nil {
+			break
+		}
+		return raw[:len(raw)-2], uint16(raw[len(raw)-2])<<8 | uint16(raw[len(raw)-1]), nil
+	}
+	return nil, 0, fmt.Errorf("invalid AT+CGLA response %q", strings.Join(resp, " "))
+}
+
+// listESIMProfiles reads the installed profiles (ES10c GetProfilesInfo).
+func listESIMProfiles(modem ATCommander) (profiles []ESIMProfile, err error) {
+	ch, err := openESIM(modem)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := ch.close(); err == nil && at.IsTimeoutError(closeErr) {
+			err = closeErr
+		}
+	}()
+	resp, err := ch.storeData(encodeTLV(tagGetProfilesInfo, nil))
+	if err != nil {
+		return nil, err
+	}
+	return parseProfilesInfo(resp)
+}
+
+// switchESIMProfile enables the profile with the ICCID (ES10c
+// EnableProfile with refresh): the eUICC disables the active one, and the
+// modem reloads the SIM.
+func switchESIMProfile(modem ATCommander, iccid string) (err error) {
+	id, err := encodeICCID(iccid)
+	if err != nil {
+		return err
+	}
+	ch, err := openESIM(modem)
+	if err != nil {
+		return err
+	}
+	// After a successful switch the card refreshes and the channel is
+	// gone: it is only closed after a failure.
+	defer func() {
+		if err == nil {
+			return
+		}
+		if closeErr := ch.close(); !at.IsTimeoutError(err) && at.IsTimeoutError(closeErr) {
+			err = closeErr
+		}
+	}()
+	req := encodeTLV(tagEnableProfile, append(
+		encodeTLV(0xA0, encodeTLV(0x5A, id)),
+		encodeTLV(0x81, []byte{0xFF})...)) // refreshFlag
+	resp, err := ch.storeData(req)
+	if err != nil {
+		return err
+	}
+	result, err := parseEnableResult(resp)
+	if err != nil {
+		return err
+	}
+	if result != 0 {
+		reason, ok := enableProfileResults[result]
+		if !ok {
+			reason = fmt.Sprintf("result %d", result)
+		}
+		return fmt.Errorf("eUICC refused the switch: %s", reason)
+	}
+	return nil
+}
+
+// parseProfilesInfo decodes a ProfileInfoListResponse.
+func parseProfilesInfo(resp []byte) ([]ESIMProfile, error) {
+	top, err := parseTLVs(resp)
+	if err != nil || len(top) != 1 || top[0].tag != tagGetProfilesInfo {
+		return nil, fmt.Errorf("invalid GetProfilesInfo response %X", resp)
+	}
+	body, err := parseTLVs(top[0].value)
+	if err != nil || len(body) != 1 {
+		return nil, fmt.Errorf("invalid GetProfilesInfo response %X", resp)
+	}
+	if body[0].tag != 0xA0 {
+		return nil, fmt.Errorf("eUICC refused to list the profiles (%X)", body[0].value)
+	}
+	entries, err := parseTLVs(body[0].value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profile list: %w", err)
+	}
+	classes := map[string]string{"\x00": "test", "\x01": "provisioning", "\x02": "operational"}
+	var profiles []ESIMProfile
+	for _, e := range entries {
+		if e.tag != 0xE3 {
+			continue
+		}
+		fields, err := parseTLVs(e.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid profile entry: %w", err)
+		}
+		var p ESIMProfile
+		for _, f := range fields {
+			switch f.tag {
+			case 0x5A:
+				p.ICCID = decodeICCID(f.value)
+			case 0x9F70:
+				p.Enabled = len(f.value) == 1 && f.value[0] == 1
+			case 0x90:
+				p.Nickname = string(f.value)
+			case 0x91:
+				p.Provider = string(f.value)
+			case 0x92:
+				p.Name = string(f.value)
+			case 0x95:
+				p.Class = classes[string(f.value)]
+			}
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// parseEnableResult decodes an EnableProfileResponse.
+func parseEnableResult(resp []byte) (int, error) {
+	top, err := parseTLVs(resp)
+	if err == nil && len(top) == 1 && top[0].tag == tagEnableProfile {
+		if fields, err := parseTLVs(top[0].value); err == nil && len(fields) == 1 && fields[0].tag == 0x80 && len(fields[0].value) == 1 {
+			return int(fields[0].value[0]), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid EnableProfile response %X", resp)
+}
+
+// tlv is one BER-TLV data object.
+type tlv struct {
+	tag   uint32
+	value []byte
+}
+
+// parseTLVs splits b into BER-TLV objects (one level).
+func parseTLVs(b []byte) ([]tlv, error) {
+	var out []tlv
+	for len(b) > 0 {
+		i := 1
+		tag := uint32(b[0])
+		if b[0]&0x1F == 0x1F {
+			for {
+				if i >= len(b) || i > 3 {
+					return nil, errors.New("truncated tag")
+				}
+				tag = tag<<8 | uint32(b[i])
+				i++
+				if b[i-1]&0x80 == 0 {
+					break
+				}
+			}
+		}
+		if i >= len(b) {
+			return nil, errors.New("missing length")
+		}
+		length := int(b[i])
+		i++
+		if length&0x80 != 0 {
+			n := length & 0x7F
+			if n == 0 || n > 3 || i+n > len(b) {
+				return nil, errors.New("invalid length")
+			}
+			length = 0
+			for _, c := range b[i : i+n] {
+				length = length<<8 | int(c)
+			}
+			i += n
+		}
+		if i+length > len(b) {
+			return nil, errors.New("truncated value")
+		}
+		out = append(out, tlv{tag: tag, value: b[i : i+length]})
+		b = b[i+length:]
+	}
+	return out, nil
+}
+
+// encodeTLV encodes one BER-TLV object with a one- or two-byte tag.
+func encodeTLV(tag uint32, value []byte) []byte {
+	var out []byte
+	if tag > 0xFF {
+		out = append(out, byte(tag>>8))
+	}
+	out = append(out, byte(tag))
+	switch n := len(value); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xFF:
+		out = append(out, 0x81, byte(n))
+	default:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+	return append(out, value...)
+}
+
+// decodeICCID decodes the swapped-nibble BCD of an ICCID, dropping the F
+// padding.
+func decodeICCID(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		for _, d := range []byte{c & 0x0F, c >> 4} {
+			if d <= 9 {
+				sb.WriteByte('0' + d)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// encodeICCID is the reverse of decodeICCID: 10 bytes, F-padded.
+func encodeICCID(iccid string) ([]byte, error) {
+	if !validICCID(iccid) {
+		return nil, fmt.Errorf("%q is not an ICCID (18 to 20 digits)", iccid)
+	}
+	digits := []byte(iccid + strings.Repeat("F", 20-len(iccid)))
+	out := make([]byte, 10)
+	for i := range out {
+		lo, hi := digits[2*i], digits[2*i+1]
+		out[i] = nibble(hi)<<4 | nibble(lo)
+	}
+	return out, nil
+}
+
+func nibble(c byte) byte {
+	if c == 'F' {
+		return 0x0F
+	}
+	return c - '0'
+}
+
+func validICCID(s string) bool {
+	if len(s) < 18 || len(s) > 20 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ESIMManager hands eSIM requests of the admin commands to the modem
+// goroutine, the only owner of the serial port, like the Outbox.
+type ESIMManager struct {
+	requests chan esimRequest
+}
+
+// esimRequest lists the profiles, or switches to iccid when set.
+type esimRequest struct {
+	ctx    context.Context
+	iccid  string
+	result chan esimResult
+}
+
+type esimResult struct {
+	profiles []ESIMProfile
+	err      error
+}
+
+func NewESIMManager() *ESIMManager {
+	return &ESIMManager{requests: make(chan esimRequest, 1)}
+}
+
+// List returns the installed profiles.
+func (m *ESIMManager) List(ctx context.Context) ([]ESIMProfile, error) {
+	r := m.do(ctx, esimRequest{ctx: ctx})
+	return r.profiles, r.err
+}
+
+// Switch enables the profile with the ICCID. The modem session is
+// reinitialized afterwards.
+func (m *ESIMManager) Switch(ctx context.Context, iccid string) error {
+	if !validICCID(iccid) {
+		return fmt.Errorf("%q is not an ICCID (18 to 20 digits)", iccid)
+	}
+	return m.do(ctx, esimRequest{ctx: ctx, iccid: iccid}).err
+}
+
+func (m *ESIMManager) do(ctx context.Context, req esimRequest) esimResult {
+	req.result = make(chan esimResult, 1)
+	select {
+	case m.requests <- req:
+	case <-ctx.Done():
+		return esimResult{err: errESIMStopped}
+	}
+	select {
+	case r := <-req.result:
+		return r
+	case <-ctx.Done():
+		return esimResult{err: errESIMStopped}
+	}
+}
+
+// pending returns the request channel for the modem loop's select; nil
+// (never ready) for a nil manager.
+func (m *ESIMManager) pending() <-chan esimRequest {
+	if m == nil {
+		return nil
+	}
+	return m.requests
+}
+
+// refuse answers a request without serving it.
+func (m *ESIMManager) refuse(req esimRequest, err error) {
+	if req.ctx.Err() != nil {
+		return
+	}
+	req.result <- esimResult{err: err}
+	slog.Warn("Refused eSIM request", "error", err)
+}
+
+// serve runs on the modem goroutine. A transport error is returned so the
+// caller can end the session; errESIMSwitched asks it to reinitialize.
+func (m *ESIMManager) serve(modem ATCommander, req esimRequest) error {
+	if req.ctx.Err() != nil {
+		return nil
+	}
+	var r esimResult
+	if req.iccid == "" {
+		r.profiles, r.err = listESIMProfiles(modem)
+	} else {
+		r.err = switchESIMProfile(modem, req.iccid)
+	}
+	req.result <- r
+	switch {
+	case r.err != nil:
+		slog.Warn("eSIM request failed", "switch", req.iccid != "", "iccid_masked", maskICCID([]string{req.iccid}), "error", r.err)
+		if at.IsTimeoutError(r.err) {
+			return r.err
+		}
+	case req.iccid != "":
+		slog.Info("eSIM profile switched", "iccid_masked", maskICCID([]string{req.iccid}))
+		return errESIMSwitched
+	}
+	return nil
+}
+
+// registerESIMCommands wires /esim and /esim_switch.
+func registerESIMCommands(r *CommandRouter, esim *ESIMManager) {
+	r.Register("esim", botCommand{
+		usage:       "/esim",
+		description: "List the eSIM profiles",
+		handle: func(ctx context.Context, _ commandRequest) string {
+			ctx, cancel := context.WithTimeout(ctx, esimCommandTimeout)
+			defer cancel()
+			profiles, err := esim.List(ctx)
+			if err != nil {
+				return "Cannot list the eSIM profiles: " + escapeHTML(err.Error())
+			}
+			return formatESIMProfiles(profiles)
+		},
+	})
+	r.Register("esim_switch", botCommand{
+		usage:       "/esim_switch <ICCID>",
+		description: "Switch the active eSIM profile",
+		handle: func(ctx context.Context, req commandRequest) string {
+			if len(req.Args) != 1 {
+				return "Usage: <code>/esim_switch &lt;ICCID&gt;</code> (see /esim)"
+			}
+			ctx, cancel := context.WithTimeout(ctx, esimCommandTimeout)
+			defer cancel()
+			if err := esim.Switch(ctx, req.Args[0]); err != nil {
+				return fmt.Sprintf("Cannot switch to <code>%s</code>: %s", escapeHTML(req.Args[0]), escapeHTML(err.Error()))
+			}
+			return fmt.Sprintf("Switched to <code>%s</code>. The modem is being reinitialized; "+
+				"SMS left on the previous profile stay there.", escapeHTML(req.Args[0]))
+		},
+	})
+}
+
+// formatESIMProfiles renders the profile list for Telegram.
+func formatESIMProfiles(profiles []ESIMProfile) string {
+	if len(profiles) == 0 {
+		return "No eSIM profiles are installed."
+	}
+	var sb strings.Builder
+	sb.WriteString("<b>eSIM profiles</b>\n")
+	for _, p := range profiles {
+		state := ""
+		if p.Enabled {
+			state = " <b>(active)</b>"
+		}
+		sb.WriteString(fmt.Sprintf("\n<code>%s</code> %s%s", escapeHTML(p.ICCID), escapeHTML(p.Label()), state))
+		if p.Class != "" && p.Class != "operational" {
+			sb.WriteString(" [" + p.Class + "]")
+		}
+	}
+	return sb.String()
+}
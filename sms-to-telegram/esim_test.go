@@ -0,0 +1,287 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+const (
+	esimOpen    = `AT+CCHO="A0000005591010FFFFFFFF8900000100"`
+	esimList    = `AT+CGLA=1,18,"81E2910003BF2D0000"`
+	esimSwitch  = `AT+CGLA=1,52,"81E2910014BF3111A00C5A0A988822080000214365878101FF00"`
+	esimClose   = "AT+CCHC=1"
+	esimICCIDA  = "89882280000012345678"
+	esimICCIDB  = "8944476500001234567"
+	esimSuccess = "9000"
+)
+
+// cglaAnswer is the AT+CGLA answer carrying response (hex, status word
+// included).
+func cglaAnswer(response string) []string {
+	return []string{fmt.Sprintf(`+CGLA: %d,"%s"`, len(response), response)}
+}
+
+// profilesInfo is a GetProfilesInfo response with an enabled operational
+// profile A and a disabled provisioning profile B.
+func profilesInfo(t *testing.T) string {
+	t.Helper()
+	idA, err := encodeICCID(esimICCIDA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idB, err := encodeICCID(esimICCIDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a, b []byte
+	a = append(a, encodeTLV(0x5A, idA)...)
+	a = append(a, encodeTLV(0x9F70, []byte{1})...)
+	a = append(a, encodeTLV(0x90, []byte("Work"))...)
+	a = append(a, encodeTLV(0x91, []byte("Acme"))...)
+	a = append(a, encodeTLV(0x95, []byte{2})...)
+	b = append(b, encodeTLV(0x5A, idB)...)
+	b = append(b, encodeTLV(0x9F70, []byte{0})...)
+	b = append(b, encodeTLV(0x92, []byte("Pay"))...)
+	b = append(b, encodeTLV(0x95, []byte{1})...)
+	list := append(encodeTLV(0xE3, a), encodeTLV(0xE3, b)...)
+	return strings.ToUpper(hex.EncodeToString(encodeTLV(tagGetProfilesInfo, encodeTLV(0xA0, list))))
+}
+
+func TestListESIMProfiles(t *testing.T) {
+	info := profilesInfo(t)
+	want := []ESIMProfile{
+		{ICCID: esimICCIDA, Enabled: true, Nickname: "Work", Provider: "Acme", Class: "operational"},
+		{ICCID: esimICCIDB, Name: "Pay", Class: "provisioning"},
+	}
+	tests := []struct {
+		name string
+		// script adds the CCHO and CGLA answers.
+		script func(f *fakeAT)
+		want   []ESIMProfile
+		// wantErr is matched with errors.Is, or as a substring.
+		wantErr   error
+		wantErrIn string
+		wantClose bool
+	}{
+		{
+			name: "single block",
+			script: func(f *fakeAT) {
+				f.on(esimOpen, []string{"+CCHO: 1"}, nil)
+				f.on(esimList, cglaAnswer(info+esimSuccess), nil)
+			},
+			want:      want,
+			wantClose: true,
+		},
+		{
+			name: "chained with GET RESPONSE, bare session id",
+			script: func(f *fakeAT) {
+				f.on(esimOpen, []string{"1"}, nil)
+				f.on(esimList, cglaAnswer(info[:20]+"61"+fmt.Sprintf("%02X", (len(info)-20)/2)), nil)
+				f.on(fmt.Sprintf(`AT+CGLA=1,10,"01C00000%02X"`, (len(info)-20)/2), cglaAnswer(info[20:]+esimSuccess), nil)
+			},
+			want:      want,
+			wantClose: true,
+		},
+		{
+			name: "no eUICC access",
+			script: func(f *fakeAT) {
+				f.on(esimOpen, nil, at.ErrModemError)
+			},
+			wantErr: errESIMUnsupported,
+		},
+		{
+			name: "status word error",
+			script: func(f *fakeAT) {
+				f.on(esimOpen, []string{"+CCHO: 1"}, nil)
+				f.on(esimList, cglaAnswer("6A88"), nil)
+			},
+			wantErrIn: "status 6A88",
+			wantClose: true,
+		},
+		{
+			name: "list refused",
+			script: func(f *fakeAT) {
+				f.on(esimOpen, []string{"+CCHO: 1"}, nil)
+				f.on(esimList, cglaAnswer("BF2D03800101"+esimSuccess), nil)
+			},
+			wantErrIn: "refused",
+			wantClose: true,
+		},
+		{
+			name: "transport timeout",
+			script: func(f *fakeAT) {
+				f.on(esimOpen, []string{"+CCHO: 1"}, nil)
+				f.on(esimList, nil, at.ErrModemTimeout)
+			},
+			wantErr:   at.ErrModemTimeout,
+			wantClose: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeAT()
+			tt.script(f)
+			got, err := listESIMProfiles(f)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantErrIn != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrIn) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErrIn)
+				}
+			case err != nil:
+				t.Fatalf("error = %v", err)
+			case !reflect.DeepEqual(got, tt.want):
+				t.Errorf("profiles = %+v, want %+v", got, tt.want)
+			}
+			if closed := f.commandCount(esimClose) == 1; closed != tt.wantClose {
+				t.Errorf("channel closed = %v, want %v", closed, tt.wantClose)
+			}
+		})
+	}
+}
+
+func TestSwitchESIMProfile(t *testing.T) {
+	tests := []struct {
+		name      string
+		iccid     string
+		answer    string
+		wantErrIn string
+		// wantClose: the channel is closed after a failure only; after a
+		// switch the card refreshes.
+		wantClose bool
+	}{
+		{"switched", esimICCIDA, "BF3103800100" + esimSuccess, "", false},
+		{"already enabled", esimICCIDA, "BF3103800102" + esimSuccess, "not disabled", true},
+		{"unknown result", esimICCIDA, "BF3103800109" + esimSuccess, "result 9", true},
+		{"garbled", esimICCIDA, "BF31" + esimSuccess, "invalid EnableProfile", true},
+		{"not an ICCID", "12345", "", "not an ICCID", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeAT()
+			f.on(esimOpen, []string{"+CCHO: 1"}, nil)
+			f.on(esimSwitch, cglaAnswer(tt.answer), nil)
+			err := switchESIMProfile(f, tt.iccid)
+			if tt.wantErrIn == "" && err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if tt.wantErrIn != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErrIn)) {
+				t.Fatalf("error = %v, want one containing %q", err, tt.wantErrIn)
+			}
+			if closed := f.commandCount(esimClose) == 1; closed != tt.wantClose {
+				t.Errorf("channel closed = %v, want %v", closed, tt.wantClose)
+			}
+		})
+	}
+}
+
+func TestICCIDCoding(t *testing.T) {
+	for _, iccid := range []string{esimICCIDA, esimICCIDB, "894447650000123456"} {
+		b, err := encodeICCID(iccid)
+		if err != nil {
+			t.Fatalf("encodeICCID(%q) error = %v", iccid, err)
+		}
+		if got := decodeICCID(b); got != iccid {
+			t.Errorf("decodeICCID(encodeICCID(%q)) = %q", iccid, got)
+		}
+	}
+	if b, _ := encodeICCID(esimICCIDB); hex.EncodeToString(b) != "984474560000214365f7" {
+		t.Errorf("encodeICCID(%q) = %x, want F-padded swapped nibbles", esimICCIDB, b)
+	}
+	for _, bad := range []string{"", "12345678901234567", "123456789012345678901", "8988228000001234567X"} {
+		if _, err := encodeICCID(bad); err == nil {
+			t.Errorf("encodeICCID(%q) accepted", bad)
+		}
+	}
+}
+
+func TestESIMManagerServe(t *testing.T) {
+	info := profilesInfo(t)
+	m := NewESIMManager()
+	f := newFakeAT()
+	f.on(esimOpen, []string{"+CCHO: 1"}, nil)
+	f.on(esimList, cglaAnswer(info+esimSuccess), nil)
+	f.on(esimSwitch, cglaAnswer("BF3103800100"+esimSuccess), nil)
+	f.on(esimSwitch, cglaAnswer("BF3103800101"+esimSuccess), nil)
+
+	// The modem goroutine: serve one request at a time.
+	serve := func() <-chan error {
+		done := make(chan error, 1)
+		go func() { done <- m.serve(f, <-m.pending()) }()
+		return done
+	}
+
+	done := serve()
+	profiles, err := m.List(context.Background())
+	if err != nil || len(profiles) != 2 {
+		t.Fatalf("List() = %d profiles, %v; want 2", len(profiles), err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("serve(list) = %v, want nil", err)
+	}
+
+	done = serve()
+	if err := m.Switch(context.Background(), esimICCIDA); err != nil {
+		t.Fatalf("Switch() error = %v", err)
+	}
+	if err := <-done; !errors.Is(err, errESIMSwitched) {
+		t.Errorf("serve(switch) = %v, want errESIMSwitched", err)
+	}
+
+	// A refused switch keeps the session.
+	done = serve()
+	if err := m.Switch(context.Background(), esimICCIDA); err == nil {
+		t.Error("Switch() accepted a refused switch")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("serve(refused switch) = %v, want nil", err)
+	}
+
+	// Invalid ICCIDs never reach the modem goroutine.
+	if err := m.Switch(context.Background(), "abc"); err == nil {
+		t.Error("Switch(abc) accepted")
+	}
+
+	// Without a modem goroutine the request times out.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.List(ctx); !errors.Is(err, errESIMStopped) {
+		t.Errorf("List(cancelled) error = %v, want errESIMStopped", err)
+	}
+
+	var none *ESIMManager
+	if none.pending() != nil {
+		t.Error("nil manager has a request channel")
+	}
+}
+
+func TestFormatESIMProfiles(t *testing.T) {
+	got := formatESIMProfiles([]ESIMProfile{
+		{ICCID: esimICCIDA, Enabled: true, Nickname: "<Work>"},
+		{ICCID: esimICCIDB, Provider: "Acme", Class: "test"},
+	})
+	for _, want := range []string{
+		"<code>" + esimICCIDA + "</code> &lt;Work&gt; <b>(active)</b>",
+		"<code>" + esimICCIDB + "</code> Acme [test]",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("formatESIMProfiles() = %q, missing %q", got, want)
+		}
+	}
+	if got := formatESIMProfiles(nil); !strings.Contains(got, "No eSIM profiles") {
+		t.Errorf("formatESIMProfiles(nil) = %q", got)
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"log/syslog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// journaldSocket is systemd-journald's native protocol socket.
+const journaldSocket = "/run/systemd/journal/socket"
+
+// Syslog severities (RFC 5424), also journald's PRIORITY field.
+const (
+	eventPriErr     = 3
+	eventPriWarning = 4
+	eventPriNotice  = 5
+	eventPriInfo    = 6
+)
+
+// MESSAGE_ID values let journalctl select one event kind across restarts
+// (journalctl MESSAGE_ID=...).
+const (
+	eventIDSMSReceived = "6f1bd9a4c3d24cc08a1f2f1b7e0c5d01"
+	eventIDDiagnostic  = "6f1bd9a4c3d24cc08a1f2f1b7e0c5d02"
+	eventIDRecovered   = "6f1bd9a4c3d24cc08a1f2f1b7e0c5d03"
+	eventIDStorageLow  = "6f1bd9a4c3d24cc08a1f2f1b7e0c5d04"
+)
+
+type eventField struct {
+	Key, Value string
+}
+
+// eventWriter is one structured log backend. fields always start with
+// MESSAGE.
+type eventWriter interface {
+	writeEvent(priority int, fields []eventField) error
+}
+
+// EventLog emits SMS and diagnostic events as structured host log entries
+// (EVENT_LOG=journald|syslog), independent of the slog stream. SMS text is
+// only included with EVENT_LOG_TEXT (host logs are usually less protected
+// than the Telegram chat); otherwise a fingerprint identifies the content.
+// With LOG_PRIVACY the sender number is masked as well.
+// Write failures are logged and never affect delivery. Nil-safe.
+type EventLog struct {
+	w           eventWriter
+	includeText bool
+	privacy     bool
+}
+
+// NewEventLog connects to the backend named by EVENT_LOG.
+func NewEventLog(backend string, includeText, privacy bool) (*EventLog, error) {
+	var w eventWriter
+	switch backend {
+	case "journald":
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+		if err != nil {
+			return nil, fmt.Errorf("connecting to journald: %w", err)
+		}
+		w = &journaldWriter{conn: conn}
+	case "syslog":
+		sw, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, "sms-to-telegram")
+		if err != nil {
+			return nil, fmt.Errorf("connecting to syslog: %w", err)
+		}
+		w = &syslogWriter{w: sw}
+	default:
+		return nil, fmt.Errorf("unknown event log backend %q", backend)
+	}
+	return &EventLog{w: w, includeText: includeText, privacy: privacy}, nil
+}
+
+func (e *EventLog) emit(priority int, message, messageID string, fields ...eventField) {
+	if e == nil {
+		return
+	}
+	all := append([]eventField{
+		{"MESSAGE", message},
+		{"MESSAGE_ID", messageID},
+		{"SYSLOG_IDENTIFIER", "sms-to-telegram"},
+	}, fields...)
+	if err := e.w.writeEvent(priority, all); err != nil {
+		slog.Warn("Failed to write event log entry", "message_id", messageID, "error", err)
+	}
+}
+
+// SMSReceived records one received SMS.
+func (e *EventLog) SMSReceived(pending PendingSMS) {
+	if e == nil {
+		return
+	}
+	msg := pending.Message
+	from := msg.From
+	if e.privacy {
+		from = maskNumber(from)
+	}
+	fields := []eventField{
+		{"SMS_FROM", from},
+		{"SMS_PARTS", strconv.Itoa(len(pending.PartIndices))},
+		{"SMS_SIM_INDICES", strings.Trim(fmt.Sprint(pending.PartIndices), "[]")},
+		{"SMS_TEXT_FINGERPRINT", contentFingerprint(msg.Text)},
+	}
+	if !msg.Time.IsZero() {
+		fields = append(fields, eventField{"SMS_TIMESTAMP", msg.Time.Format("2006-01-02T15:04:05Z07:00")})
+	}
+	if pending.RawFallback {
+		fields = append(fields, eventField{"SMS_RAW_REASON", pending.RawReason})
+	}
+	if e.includeText {
+		fields = append(fields, eventField{"SMS_TEXT", msg.Text})
+	}
+	e.emit(eventPriNotice, "SMS received from "+from, eventIDSMSReceived, fields...)
+}
+
+// DiagnosticError records a modem/SIM/network error.
+func (e *EventLog) DiagnosticError(diagErr *DiagnosticError) {
+	e.emit(eventPriErr, "Modem diagnostic error: "+diagErr.Message, eventIDDiagnostic,
+		eventField{"ERROR_TYPE", errorTypeName(diagErr.Type)},
+		eventField{"ERROR_MESSAGE", diagErr.Message})
+}
+
+// Recovered records that the modem is operational again after prev.
+func (e *EventLog) Recovered(prev DiagnosticErrorType) {
+	e.emit(eventPriNotice, "Modem recovered", eventIDRecovered,
+		eventField{"PREVIOUS_ERROR_TYPE", errorTypeName(prev)})
+}
+
+// StorageLow records the SIM storage high-water alert.
+func (e *EventLog) StorageLow(used, total int) {
+	e.emit(eventPriWarning, fmt.Sprintf("SIM storage almost full (%d/%d)", used, total), eventIDStorageLow,
+		eventField{"SIM_USED", strconv.Itoa(used)},
+		eventField{"SIM_TOTAL", strconv.Itoa(total)})
+}
+
+// EventLogSink records every SMS in the event log. It never fails: the event
+// log is observability, not a destination worth keeping an SMS on the SIM for.
+type EventLogSink struct {
+	events *EventLog
+}
+
+func (s *EventLogSink) Name() string { return "eventlog" }
+
+func (s *EventLogSink) Send(_ context.Context, pending PendingSMS) error {
+	s.events.SMSReceived(pending)
+	return nil
+}
+
+// journaldWriter speaks the journald native protocol: one datagram per
+// entry, KEY=value lines, with the length-prefixed binary form for values
+// containing newlines (multi-line SMS).
+type journaldWriter struct {
+	conn *net.UnixConn
+}
+
+func encodeJournalEntry(priority int, fields []eventField) []byte {
+	var b bytes.Buffer
+	fields = append(fields, eventField{"PRIORITY", strconv.Itoa(priority)})
+	for _, f := range fields {
+		b.WriteString(f.Key)
+		if strings.Contains(f.Value, "\n") {
+			b.WriteByte('\n')
+			binary.Write(&b, binary.LittleEndian, uint64(len(f.Value)))
+			b.WriteString(f.Value)
+		} else {
+			b.WriteByte('=')
+			b.WriteString(f.Value)
+		}
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+func (j *journaldWriter) writeEvent(priority int, fields []eventField) error {
+	_, err := j.conn.Write(encodeJournalEntry(priority, fields))
+	return err
+}
+
+// syslogWriter sends "message KEY=value ..." lines to the local syslog
+// daemon; values with spaces or quotes are Go-quoted.
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+func formatSyslogEntry(fields []eventField) string {
+	var b strings.Builder
+	b.WriteString(fields[0].Value)
+	for _, f := range fields[1:] {
+		if f.Key == "SYSLOG_IDENTIFIER" {
+			continue // the syslog tag already carries it
+		}
+		v := f.Value
+		if v == "" || strings.ContainsAny(v, " \t\n\"=\\") {
+			v = strconv.Quote(v)
+		}
+		fmt.Fprintf(&b, " %s=%s", f.Key, v)
+	}
+	return b.String()
+}
+
+func (s *syslogWriter) writeEvent(priority int, fields []eventField) error {
+	line := formatSyslogEntry(fields)
+	switch priority {
+	case eventPriErr:
+		return s.w.Err(line)
+	case eventPriWarning:
+		return s.w.Warning(line)
+	case eventPriNotice:
+		return s.w.Notice(line)
+	default:
+		return s.w.Info(line)
+	}
+}
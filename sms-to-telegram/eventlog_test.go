@@ -0,0 +1,103 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// recordingEventWriter keeps every event as a field map.
+type recordingEventWriter struct {
+	events []map[string]string
+}
+
+func (r *recordingEventWriter) writeEvent(priority int, fields []eventField) error {
+	m := map[string]string{"PRIORITY": strconv.Itoa(priority)}
+	for _, f := range fields {
+		m[f.Key] = f.Value
+	}
+	r.events = append(r.events, m)
+	return nil
+}
+
+func TestEventLog_SMSReceived(t *testing.T) {
+	pending := PendingSMS{
+		Message:     SMSMessage{From: "+100", Text: "code 1234", Time: time.Date(2026, 3, 10, 8, 30, 0, 0, time.UTC)},
+		PartIndices: []int{4, 5},
+	}
+	for _, includeText := range []bool{false, true} {
+		w := &recordingEventWriter{}
+		sink := &EventLogSink{events: &EventLog{w: w, includeText: includeText}}
+		if err := sink.Send(context.Background(), pending); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		ev := w.events[0]
+		if ev["MESSAGE_ID"] != eventIDSMSReceived || ev["SMS_FROM"] != "+100" || ev["SMS_SIM_INDICES"] != "4 5" ||
+			ev["SMS_PARTS"] != "2" || ev["SMS_TIMESTAMP"] != "2026-03-10T08:30:00Z" || ev["PRIORITY"] != "5" {
+			t.Errorf("event = %v", ev)
+		}
+		if text, ok := ev["SMS_TEXT"]; ok != includeText || (ok && text != "code 1234") {
+			t.Errorf("includeText=%v: SMS_TEXT = %q, present %v", includeText, text, ok)
+		}
+		if ev["SMS_TEXT_FINGERPRINT"] != contentFingerprint("code 1234") {
+			t.Errorf("fingerprint = %q", ev["SMS_TEXT_FINGERPRINT"])
+		}
+	}
+}
+
+func TestEventLog_PrivacyMasksSender(t *testing.T) {
+	w := &recordingEventWriter{}
+	events := &EventLog{w: w, privacy: true}
+	events.SMSReceived(PendingSMS{Message: SMSMessage{From: "+4915550001234", Text: "code 1234"}})
+	if ev := w.events[0]; ev["SMS_FROM"] != "+****34" || ev["MESSAGE"] != "SMS received from +****34" {
+		t.Errorf("event = %v", ev)
+	}
+}
+
+func TestEventLog_NotifierEvents(t *testing.T) {
+	w := &recordingEventWriter{}
+	notifier := NewErrorNotifier(nil, []int64{1}, true, "host", time.Second)
+	notifier.events = &EventLog{w: w}
+	ctx := context.Background()
+
+	notifier.NotifyRecovery(ctx) // healthy start: nothing to log
+	notifier.NotifyError(ctx, NewDiagnosticError(ErrTypeNoSignal, "No signal detected (CSQ=99)"))
+	notifier.NotifyRecovery(ctx)
+	notifier.NotifyRecovery(ctx)
+
+	if len(w.events) != 2 {
+		t.Fatalf("events = %v, want error + one recovery", w.events)
+	}
+	if ev := w.events[0]; ev["MESSAGE_ID"] != eventIDDiagnostic || ev["ERROR_TYPE"] != "No Signal" || ev["PRIORITY"] != "3" {
+		t.Errorf("error event = %v", ev)
+	}
+	if ev := w.events[1]; ev["MESSAGE_ID"] != eventIDRecovered || ev["PREVIOUS_ERROR_TYPE"] != "No Signal" {
+		t.Errorf("recovery event = %v", ev)
+	}
+}
+
+func TestEncodeJournalEntry(t *testing.T) {
+	got := string(encodeJournalEntry(5, []eventField{{"MESSAGE", "SMS"}, {"SMS_TEXT", "a\nb"}}))
+	want := "MESSAGE=SMS\nSMS_TEXT\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\nPRIORITY=5\n"
+	if got != want {
+		t.Errorf("encodeJournalEntry() = %q, want %q", got, want)
+	}
+}
+
+func TestFormatSyslogEntry(t *testing.T) {
+	got := formatSyslogEntry([]eventField{
+		{"MESSAGE", "SMS received from Bank"},
+		{"SYSLOG_IDENTIFIER", "sms-to-telegram"},
+		{"SMS_FROM", "Bank"},
+		{"SMS_TEXT", `say "hi"`},
+		{"SMS_RAW_REASON", ""},
+	})
+	want := `SMS received from Bank SMS_FROM=Bank SMS_TEXT="say \"hi\"" SMS_RAW_REASON=""`
+	if got != want {
+		t.Errorf("formatSyslogEntry() = %q, want %q", got, want)
+	}
+}
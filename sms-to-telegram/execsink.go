@@ -0,0 +1,128 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// execExitRejected is the exit status (EX_DATAERR from sysexits.h) with
+// which the command refuses an SMS for good.
+const execExitRejected = 65
+
+// ExecSinkOptions configures the external command sink (EXEC_SINK_*
+// variables).
+type ExecSinkOptions struct {
+	// Command is the absolute path of the executable; it takes no arguments.
+	Command string
+	Timeout time.Duration
+}
+
+// ExecSink runs a command for every SMS: the webhook JSON payload on stdin,
+// the main fields in SMS_* environment variables. The command gets PATH and
+// the SMS_* variables only, never the service environment with its tokens.
+// Exit status 0 accepts the SMS, 65 rejects it permanently; any other status,
+// a crash or the timeout keeps it on the SIM for the next poll, so the command
+// has to tolerate running twice for the same SMS.
+type ExecSink struct {
+	opts   ExecSinkOptions
+	dryRun bool
+}
+
+func NewExecSink(opts ExecSinkOptions, dryRun bool) *ExecSink {
+	return &ExecSink{opts: opts, dryRun: dryRun}
+}
+
+func (s *ExecSink) Name() string { return "exec" }
+
+func (s *ExecSink) Send(ctx context.Context, pending PendingSMS) error {
+	payload := newSMSPayload(pending)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("%w: encoding payload: %v", errSinkRejected, err)
+	}
+	if s.dryRun {
+		slog.InfoContext(ctx, "DRY_RUN: Would run exec sink", "command", s.opts.Command, "bytes", len(body))
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.opts.Command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = execSinkEnv(payload)
+	cmd.Dir = "/"
+	// A child that inherited stdout/stderr must not keep Wait blocked.
+	cmd.WaitDelay = time.Second
+	var stderr bytes.Buffer
+	cmd.Stderr = &limitedWriter{buf: &stderr, limit: 4096}
+
+	err = cmd.Run()
+	if stderr.Len() > 0 {
+		// The command may echo the SMS.
+		slog.DebugContext(ctx, "Exec sink stderr", "command", s.opts.Command, "stderr", strings.TrimSpace(stderr.String()))
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		slog.DebugContext(ctx, "Exec sink accepted SMS", "command", s.opts.Command)
+		return nil
+	case ctx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("exec sink %s: timed out after %s", s.opts.Command, s.opts.Timeout)
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == execExitRejected:
+		return fmt.Errorf("%w: exec sink %s: exit status %d", errSinkRejected, s.opts.Command, execExitRejected)
+	default:
+		return fmt.Errorf("exec sink %s: %w", s.opts.Command, err)
+	}
+}
+
+// execSinkEnv is the complete environment of the command. NUL bytes (a UCS2
+// SMS may carry U+0000) cannot be passed in the environment and are dropped;
+// stdin has the text unaltered.
+func execSinkEnv(p SMSPayload) []string {
+	path := os.Getenv("PATH")
+	if path == "" {
+		path = "/usr/local/bin:/usr/bin:/bin"
+	}
+	env := []string{
+		"PATH=" + path,
+		"SMS_FROM=" + envValue(p.From),
+		"SMS_TEXT=" + envValue(p.Text),
+		"SMS_PARTS=" + strconv.Itoa(p.Parts),
+		"SMS_SMSC=" + envValue(p.SMSC),
+	}
+	if p.Timestamp != nil {
+		env = append(env, "SMS_TIMESTAMP="+p.Timestamp.Format(time.RFC3339))
+	}
+	if p.RawReason != "" {
+		env = append(env, "SMS_RAW_REASON="+p.RawReason)
+	}
+	return env
+}
+
+func envValue(s string) string { return strings.ReplaceAll(s, "\x00", "") }
+
+// limitedWriter keeps the first limit bytes and discards the rest without
+// failing the write, so a chatty command is not killed by EPIPE.
+type limitedWriter struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(b []byte) (int, error) {
+	if room := w.limit - w.buf.Len(); room > 0 {
+		w.buf.Write(b[:min(room, len(b))])
+	}
+	return len(b), nil
+}
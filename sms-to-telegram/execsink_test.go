@@ -0,0 +1,110 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScript creates an executable shell script with the given body.
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no /bin/sh")
+	}
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExecSink_PassesSMS(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "123:secret")
+	out := filepath.Join(t.TempDir(), "out")
+	script := writeScript(t, `cat > "`+out+`.json"
+env > "`+out+`.env"`)
+	sink := NewExecSink(ExecSinkOptions{Command: script, Timeout: 5 * time.Second}, false)
+	pending := PendingSMS{
+		Message:     SMSMessage{From: "+15550001234", Text: "Hello\nworld", Time: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)},
+		PartIndices: []int{3, 4},
+		RawPDUs:     []string{pduGSM7Part1, pduGSM7Part2},
+	}
+	if err := sink.Send(context.Background(), pending); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	raw, err := os.ReadFile(out + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload SMSPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		t.Fatalf("stdin is not JSON: %v", err)
+	}
+	if payload.From != "+15550001234" || payload.Text != "Hello\nworld" || payload.Parts != 2 || len(payload.RawPDUs) != 2 {
+		t.Errorf("stdin payload = %+v", payload)
+	}
+	env, err := os.ReadFile(out + ".env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"SMS_FROM=+15550001234", "SMS_TEXT=Hello\nworld", "SMS_PARTS=2", "SMS_TIMESTAMP=2025-03-01T12:00:00Z"} {
+		if !strings.Contains(string(env), want) {
+			t.Errorf("environment lacks %q:\n%s", want, env)
+		}
+	}
+	if strings.Contains(string(env), "TELEGRAM_BOT_TOKEN") {
+		t.Error("service environment leaked to the command")
+	}
+}
+
+func TestExecSink_ExitStatus(t *testing.T) {
+	pending := PendingSMS{Message: SMSMessage{From: "+1", Text: "x"}, PartIndices: []int{1}}
+	tests := []struct {
+		name     string
+		script   string
+		timeout  time.Duration
+		wantErr  bool
+		rejected bool
+	}{
+		{"accepted", "exit 0", 5 * time.Second, false, false},
+		{"rejected", "echo 'bad input' >&2; exit 65", 5 * time.Second, true, true},
+		{"transient", "exit 75", 5 * time.Second, true, false},
+		{"timeout", "sleep 5", 100 * time.Millisecond, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := NewExecSink(ExecSinkOptions{Command: writeScript(t, tt.script), Timeout: tt.timeout}, false)
+			err := sink.Send(context.Background(), pending)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := errors.Is(err, errSinkRejected); got != tt.rejected {
+				t.Errorf("Send() error = %v, rejected %v, want %v", err, got, tt.rejected)
+			}
+			if err != nil && strings.Contains(err.Error(), "bad input") {
+				t.Errorf("error %q carries the command's stderr", err)
+			}
+		})
+	}
+}
+
+func TestExecSink_DryRun(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	sink := NewExecSink(ExecSinkOptions{Command: writeScript(t, `touch "`+marker+`"`), Timeout: 5 * time.Second}, true)
+	if err := sink.Send(context.Background(), PendingSMS{Message: SMSMessage{From: "+1", Text: "x"}}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("command ran in DRY_RUN")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// FileSinkOptions configures the NDJSON file sink (FILE_SINK_* variables).
+type FileSinkOptions struct {
+	Path string
+	// MaxSize rotates the file before a write would exceed it (bytes).
+	MaxSize int64
+	// Keep is the number of rotated files (path.1 ... path.N) to retain.
+	Keep int
+}
+
+// fileSinkRecord is one line of the sink file: the webhook payload plus the
+// time the gateway received the SMS.
+type fileSinkRecord struct {
+	ReceivedAt time.Time `json:"received_at"`
+	SMSPayload
+}
+
+// FileSink appends every SMS as one JSON line to a size-rotated file, for
+// grep or log shippers (Loki, Filebeat). Unlike the ARCHIVE store it is
+// written at delivery time, never read back, and rotated away. The file holds
+// SMS content and is created 0600. Write errors are transient: the SMS stays
+// on the SIM and the append is retried on the next poll.
+type FileSink struct {
+	opts   FileSinkOptions
+	dryRun bool
+}
+
+func NewFileSink(opts FileSinkOptions, dryRun bool) *FileSink {
+	return &FileSink{opts: opts, dryRun: dryRun}
+}
+
+func (s *FileSink) Name() string { return "file" }
+
+func (s *FileSink) Send(ctx context.Context, pending PendingSMS) error {
+	line, err := json.Marshal(fileSinkRecord{ReceivedAt: clk.Now(), SMSPayload: newSMSPayload(pending)})
+	if err != nil {
+		return fmt.Errorf("%w: encoding record: %v", errSinkRejected, err)
+	}
+	line = append(line, '\n')
+	if s.dryRun {
+		slog.InfoContext(ctx, "DRY_RUN: Would append SMS to file", "path", s.opts.Path, "bytes", len(line))
+		return nil
+	}
+
+	if err := s.rotateIfNeeded(int64(len(line))); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.opts.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening file sink: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("writing file sink: %w", err)
+	}
+	return f.Close()
+}
+
+// rotateIfNeeded shifts path -> path.1 -> ... -> path.Keep (dropping the
+// oldest) when appending n bytes would exceed MaxSize. A single record larger
+// than MaxSize is still written, to a fresh file.
+func (s *FileSink) rotateIfNeeded(n int64) error {
+	info, err := os.Stat(s.opts.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("checking file sink: %w", err)
+	}
+	if info.Size() == 0 || info.Size()+n <= s.opts.MaxSize {
+		return nil
+	}
+
+	if s.opts.Keep == 0 {
+		return os.Remove(s.opts.Path)
+	}
+	os.Remove(fmt.Sprintf("%s.%d", s.opts.Path, s.opts.Keep))
+	for i := s.opts.Keep - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", s.opts.Path, i), fmt.Sprintf("%s.%d", s.opts.Path, i+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("rotating file sink: %w", err)
+		}
+	}
+	if err := os.Rename(s.opts.Path, s.opts.Path+".1"); err != nil {
+		return fmt.Errorf("rotating file sink: %w", err)
+	}
+	slog.Info("Rotated file sink", "path", s.opts.Path, "keep", s.opts.Keep)
+	return nil
+}
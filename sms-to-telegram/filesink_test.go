@@ -0,0 +1,91 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readNDJSON(t *testing.T, path string) []fileSinkRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out []fileSinkRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec fileSinkRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid line %q: %v", sc.Text(), err)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestFileSink_Append(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	path := filepath.Join(t.TempDir(), "sms.ndjson")
+	sink := NewFileSink(FileSinkOptions{Path: path, MaxSize: 1 << 20, Keep: 2}, false)
+
+	for _, text := range []string{"first", "second"} {
+		pending := PendingSMS{Message: SMSMessage{From: "+100", Text: text}, PartIndices: []int{1}}
+		if err := sink.Send(context.Background(), pending); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	recs := readNDJSON(t, path)
+	if len(recs) != 2 || recs[0].Text != "first" || recs[1].Text != "second" || recs[0].From != "+100" {
+		t.Fatalf("records = %+v", recs)
+	}
+	if !recs[0].ReceivedAt.Equal(clk.Now()) || recs[0].Timestamp != nil {
+		t.Errorf("received_at = %v, timestamp = %v", recs[0].ReceivedAt, recs[0].Timestamp)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestFileSink_Rotation(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	path := filepath.Join(t.TempDir(), "sms.ndjson")
+	// Room for one record per file.
+	sink := NewFileSink(FileSinkOptions{Path: path, MaxSize: 200, Keep: 2}, false)
+
+	for i, text := range []string{"one", "two", "three", "four"} {
+		pending := PendingSMS{Message: SMSMessage{From: "+100", Text: text, Time: time.Unix(int64(i), 0)}}
+		if err := sink.Send(context.Background(), pending); err != nil {
+			t.Fatalf("Send(%s) error = %v", text, err)
+		}
+	}
+
+	for suffix, want := range map[string]string{"": "four", ".1": "three", ".2": "two"} {
+		recs := readNDJSON(t, path+suffix)
+		if len(recs) != 1 || recs[0].Text != want {
+			t.Errorf("%s%s = %+v, want only %q", filepath.Base(path), suffix, recs, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists beyond FILE_SINK_KEEP", path)
+	}
+}
+
+func TestFileSink_DryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sms.ndjson")
+	if err := NewFileSink(FileSinkOptions{Path: path, MaxSize: 1 << 20}, true).Send(context.Background(), PendingSMS{}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("DRY_RUN must not write the file")
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// GotifyOptions configures the Gotify sink (GOTIFY_* variables).
+type GotifyOptions struct {
+	URL      string // server base URL, e.g. https://gotify.lan
+	Token    string // application token
+	Priority int    // 0-10
+}
+
+// GotifySink pushes every SMS to a Gotify server. Like the webhook, 400 and
+// 413 mean the server refuses this message for good; everything else
+// (network errors, 5xx, a wrong token) is retried on the next poll.
+type GotifySink struct {
+	opts   GotifyOptions
+	client *http.Client
+	dryRun bool
+}
+
+func NewGotifySink(opts GotifyOptions, cfg *Config) *GotifySink {
+	return &GotifySink{
+		opts:   opts,
+		client: &http.Client{Timeout: cfg.WebhookTimeout},
+		dryRun: cfg.DryRun,
+	}
+}
+
+func (g *GotifySink) Name() string { return "gotify" }
+
+func (g *GotifySink) Send(ctx context.Context, pending PendingSMS) error {
+	body, err := json.Marshal(map[string]any{
+		"title":    "SMS from " + pending.Message.From,
+		"message":  pushMessageText(pending),
+		"priority": g.opts.Priority,
+		"extras":   map[string]any{"sms-to-telegram::sms": newSMSPayload(pending)},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: encoding payload: %v", errSinkRejected, err)
+	}
+	if g.dryRun {
+		slog.InfoContext(ctx, "DRY_RUN: Would push to Gotify",
+			"endpoint", redactURL(g.opts.URL), "priority", g.opts.Priority)
+		return nil
+	}
+
+	endpoint := strings.TrimRight(g.opts.URL, "/") + "/message"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("building Gotify request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.opts.Token)
+
+	status, err := doSinkRequest(g.client, req)
+	if err != nil {
+		return err
+	}
+	switch {
+	case status >= 200 && status < 300:
+		slog.DebugContext(ctx, "Pushed SMS to Gotify", "status", status)
+		return nil
+	case status == http.StatusBadRequest, status == http.StatusRequestEntityTooLarge:
+		return fmt.Errorf("%w: Gotify %s: HTTP %d", errSinkRejected, redactURL(g.opts.URL), status)
+	default:
+		return fmt.Errorf("Gotify %s: HTTP %d", redactURL(g.opts.URL), status)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGotifySink_Send(t *testing.T) {
+	var path, key string
+	var got struct {
+		Title    string
+		Message  string
+		Priority int
+		Extras   map[string]SMSPayload
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, key = r.URL.Path, r.Header.Get("X-Gotify-Key")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("invalid JSON body: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.WebhookTimeout = time.Second
+	sink := NewGotifySink(GotifyOptions{URL: srv.URL + "/", Token: "apptoken", Priority: 8}, cfg)
+	pending := PendingSMS{Message: SMSMessage{From: "+100", Text: "code 1234"}, PartIndices: []int{3}}
+	if err := sink.Send(context.Background(), pending); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if path != "/message" || key != "apptoken" {
+		t.Errorf("request = %s with key %q, want /message with the app token", path, key)
+	}
+	if got.Title != "SMS from +100" || got.Message != "code 1234" || got.Priority != 8 ||
+		got.Extras["sms-to-telegram::sms"].Parts != 1 {
+		t.Errorf("body = %+v", got)
+	}
+}
+
+func TestGotifySink_StatusClassification(t *testing.T) {
+	for _, tt := range []struct {
+		status       int
+		wantErr      bool
+		wantRejected bool
+	}{
+		{http.StatusOK, false, false},
+		{http.StatusBadRequest, true, true},
+		{http.StatusUnauthorized, true, false},
+		{http.StatusInternalServerError, true, false},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		cfg := testConfig()
+		cfg.WebhookTimeout = time.Second
+		err := NewGotifySink(GotifyOptions{URL: srv.URL, Token: "secret-token"}, cfg).Send(context.Background(), PendingSMS{})
+		srv.Close()
+
+		if (err != nil) != tt.wantErr || errors.Is(err, errSinkRejected) != tt.wantRejected {
+			t.Errorf("HTTP %d: Send() error = %v, wantErr %v, wantRejected %v", tt.status, err, tt.wantErr, tt.wantRejected)
+		}
+		if err != nil && strings.Contains(err.Error(), "secret-token") {
+			t.Errorf("HTTP %d: error %q leaks the token", tt.status, err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Sender grouping (GROUP_WINDOW): banks and 2FA providers often split one
+// notice across several SMS that are not concatenated. SMS from one sender
+// whose timestamps are at most GROUP_WINDOW apart become one message, each
+// part's text under its own time, and one PendingSMS that owns every slot of
+// the group, so they are forwarded and deleted together like the parts of a
+// multipart SMS. A later SMS may still join, so every SMS waits until
+// GROUP_WINDOW has passed since the newest one of its group was listed.
+
+// groupPartTime is the per-part timestamp of a grouped message.
+const groupPartTime = "15:04:05"
+
+// senderGrouping merges rapid-fire SMS of one listing. Created in run();
+// used by the modem goroutine only. Nil groups nothing.
+type senderGrouping struct {
+	window time.Duration
+	// firstListed is when each SMS, by message key, was first listed.
+	firstListed map[string]time.Time
+	// released are the groups handed out, as the message keys of their
+	// members, by the key of the first one: a released group is delivered,
+	// retried and deleted as it was, never joined by later SMS.
+	released map[string][]string
+	// holdUntil is when the earliest held group is due; zero when none is.
+	holdUntil time.Time
+}
+
+func newSenderGrouping(window time.Duration) *senderGrouping {
+	return &senderGrouping{
+		window:      window,
+		firstListed: make(map[string]time.Time),
+		released:    make(map[string][]string),
+	}
+}
+
+// groupable reports whether pending may be merged with other SMS.
+func groupable(pending PendingSMS) bool {
+	return !pending.RawFallback && !isInjected(pending) && pending.Message.From != "" && !pending.Message.Time.IsZero()
+}
+
+// apply returns the SMS of a listing to deliver now: ungroupable ones as
+// they are, groups merged, in listing order, without the groups still
+// waiting for the window to pass. Nil-safe.
+func (g *senderGrouping) apply(listed []PendingSMS) []PendingSMS {
+	if g == nil {
+		return listed
+	}
+	now := clk.Now()
+	byKey := make(map[string]PendingSMS, len(listed))
+	for _, pending := range listed {
+		key := messageKey(pending)
+		byKey[key] = pending
+		if _, ok := g.firstListed[key]; !ok {
+			g.firstListed[key] = now
+		}
+	}
+	for key := range g.firstListed {
+		if _, ok := byKey[key]; !ok {
+			delete(g.firstListed, key)
+		}
+	}
+
+	// Released groups stay as they were while all their members are listed.
+	member := make(map[string]string) // member key -> first member key
+	for first, keys := range g.released {
+		complete := true
+		for _, key := range keys {
+			if _, ok := byKey[key]; !ok {
+				complete = false
+			}
+		}
+		if !complete {
+			delete(g.released, first)
+			continue
+		}
+		for _, key := range keys {
+			member[key] = first
+		}
+	}
+
+	// New SMS: by sender, chained while the gap is at most the window.
+	bySender := make(map[string][]PendingSMS)
+	for _, pending := range listed {
+		if _, ok := member[messageKey(pending)]; ok || !groupable(pending) {
+			continue
+		}
+		bySender[pending.Message.From] = append(bySender[pending.Message.From], pending)
+	}
+	g.holdUntil = time.Time{}
+	held := make(map[string]bool)
+	for _, msgs := range bySender {
+		slices.SortStableFunc(msgs, func(a, b PendingSMS) int { return a.Message.Time.Compare(b.Message.Time) })
+		for start := 0; start < len(msgs); {
+			end := start + 1
+			for end < len(msgs) && msgs[end].Message.Time.Sub(msgs[end-1].Message.Time) <= g.window {
+				end++
+			}
+			group := msgs[start:end]
+			keys := make([]string, len(group))
+			due := time.Time{}
+			for i, pending := range group {
+				keys[i] = messageKey(pending)
+				if until := g.firstListed[keys[i]].Add(g.window); until.After(due) {
+					due = until
+				}
+			}
+			if now.Before(due) {
+				for _, key := range keys {
+					held[key] = true
+				}
+				if g.holdUntil.IsZero() || due.Before(g.holdUntil) {
+					g.holdUntil = due
+				}
+			} else {
+				g.released[keys[0]] = keys
+				for _, key := range keys {
+					member[key] = keys[0]
+				}
+			}
+			start = end
+		}
+	}
+
+	var deliver []PendingSMS
+	emitted := make(map[string]bool)
+	for _, pending := range listed {
+		key := messageKey(pending)
+		first, grouped := member[key]
+		switch {
+		case held[key]:
+			slog.Debug("Holding SMS for GROUP_WINDOW", "trace", pending.TraceID, "index", pending.Message.Index)
+		case !grouped:
+			deliver = append(deliver, pending)
+		case !emitted[first]:
+			emitted[first] = true
+			deliver = append(deliver, mergeGroup(byKey, g.released[first]))
+		}
+	}
+	return deliver
+}
+
+// due reports whether a held group's window has passed, so a listing would
+// release it. Nil-safe.
+func (g *senderGrouping) due(now time.Time) bool {
+	return g != nil && !g.holdUntil.IsZero() && !now.Before(g.holdUntil)
+}
+
+// mergeGroup builds the PendingSMS of a group, oldest first. A single SMS
+// is left as it is.
+func mergeGroup(byKey map[string]PendingSMS, keys []string) PendingSMS {
+	if len(keys) == 1 {
+		return byKey[keys[0]]
+	}
+	merged := byKey[keys[0]]
+	merged.PartIndices = nil
+	merged.RawPDUs = nil
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		part := byKey[key]
+		merged.PartIndices = append(merged.PartIndices, part.PartIndices...)
+		merged.RawPDUs = append(merged.RawPDUs, part.RawPDUs...)
+		lines = append(lines, "["+part.Message.Time.Format(groupPartTime)+"] "+part.Message.Text)
+	}
+	merged.Message.Text = strings.Join(lines, "\n")
+	merged.Message.IsMultipart = false
+	merged.Message.TotalParts = 0
+	slog.Debug("Grouped SMS from one sender", "trace", merged.TraceID, "from", merged.Message.From, "count", len(keys), "indices", merged.PartIndices)
+	return merged
+}
@@ -0,0 +1,105 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSenderGrouping(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	base := time.Date(2025, 12, 11, 10, 0, 0, 0, time.UTC)
+	sms := func(index int, from string, offset time.Duration, text string) PendingSMS {
+		return PendingSMS{
+			Message:     SMSMessage{Index: index, From: from, Text: text, Time: base.Add(offset)},
+			PartIndices: []int{index},
+		}
+	}
+	listing := []PendingSMS{
+		sms(1, "Bank", 0, "Card *1234 charged"),
+		sms(2, "+358449480778", 10*time.Second, "hi"),
+		sms(3, "Bank", 20*time.Second, "EUR 12.50 at SHOP"),
+		sms(4, "Bank", 90*time.Second, "Balance EUR 100"),
+		{Message: SMSMessage{Index: 5, Text: "00"}, PartIndices: []int{5}, RawFallback: true},
+	}
+	g := newSenderGrouping(30 * time.Second)
+
+	if got := g.apply(listing); len(got) != 1 || !got[0].RawFallback {
+		t.Fatalf("first listing delivers %+v, want only the ungroupable SMS", got)
+	}
+	if g.due(clock.Now()) {
+		t.Error("due() right after the listing")
+	}
+	clock.Advance(30 * time.Second)
+	if !g.due(clock.Now()) {
+		t.Error("due() false after the window")
+	}
+
+	got := g.apply(listing)
+	var texts []string
+	for _, pending := range got {
+		texts = append(texts, pending.Message.Text)
+	}
+	want := []string{"[10:00:00] Card *1234 charged\n[10:00:20] EUR 12.50 at SHOP", "hi", "Balance EUR 100", "00"}
+	if !slices.Equal(texts, want) {
+		t.Fatalf("texts = %q, want %q", texts, want)
+	}
+	if !slices.Equal(got[0].PartIndices, []int{1, 3}) || got[0].Message.Index != 1 {
+		t.Errorf("group owns %v (index %d), want [1 3]", got[0].PartIndices, got[0].Message.Index)
+	}
+
+	// A released group is not joined by a later SMS, which waits on its own.
+	late := append(slices.Clone(listing), sms(6, "Bank", 25*time.Second, "Ref 42"))
+	got = g.apply(late)
+	if len(got) != 4 || !slices.Equal(got[0].PartIndices, []int{1, 3}) {
+		t.Fatalf("after a late SMS: %+v", got)
+	}
+	clock.Advance(30 * time.Second)
+	if got = g.apply(late); len(got) != 5 || got[4].Message.Text != "Ref 42" {
+		t.Errorf("late SMS delivered as %+v, want on its own", got)
+	}
+}
+
+// A group is forwarded as one Telegram message and its slots are deleted
+// together.
+func TestProcessMessages_GroupedSMS(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing(
+		[2]string{"+CMGL: 3,1,,30", pduGSM7Part1},
+		[2]string{"+CMGL: 4,1,,30", pduGSM7Part2},
+		[2]string{"+CMGL: 5,1,,29", testPDUSingle},
+	), nil)
+	cfg := testConfig()
+	cfg.ChatIDs = []int64{100}
+	cfg.GroupWindow = time.Minute
+	deliverer, sender, _ := newTestDeliverer(cfg)
+	deliverer.grouping = newSenderGrouping(cfg.GroupWindow)
+
+	for range 2 {
+		if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+			t.Fatalf("processMessages() error = %v", err)
+		}
+		if len(sender.sent) != 0 || modem.commandCount("AT+CMGD=5") != 0 {
+			t.Fatalf("SMS forwarded or deleted inside the window")
+		}
+	}
+	clock.Advance(time.Minute)
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+		t.Fatalf("processMessages() error = %v", err)
+	}
+	// The multipart SMS and the single one share sender and time.
+	if len(sender.sent) != 1 || !strings.Contains(sender.sent[0].Text, "] HelloWorld\n[") || !strings.Contains(sender.sent[0].Text, "Тест1") {
+		t.Fatalf("sent %+v, want one message with both SMS", sender.sent)
+	}
+	if got := cmgdCalls(modem); !slices.Equal(got, []string{"AT+CMGD=3", "AT+CMGD=4", "AT+CMGD=5"}) {
+		t.Errorf("deletions %v, want every slot of the group", got)
+	}
+}
@@ -0,0 +1,355 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimal gRPC server for the smsgateway.v1.SMSGateway service
+// (docs/smsgateway.proto): cleartext HTTP/2 from net/http, hand-encoded
+// protobuf for the four small messages. No compression, no reflection;
+// clients generate stubs from the .proto file.
+
+const (
+	grpcServicePath  = "/smsgateway.v1.SMSGateway/"
+	grpcMaxMessage   = 64 * 1024
+	grpcSendDeadline = 3 * cmgsTimeout
+)
+
+// gRPC status codes used here.
+const (
+	grpcOK               = 0
+	grpcInvalidArgument  = 3
+	grpcPermissionDenied = 7
+	grpcUnimplemented    = 12
+	grpcInternal         = 13
+	grpcUnavailable      = 14
+	grpcUnauthenticated  = 16
+)
+
+// --- protobuf wire format ---------------------------------------------------
+
+func pbAppendTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func pbAppendString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = pbAppendTag(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func pbAppendInt(b []byte, field int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = pbAppendTag(b, field, 0)
+	return binary.AppendUvarint(b, uint64(v))
+}
+
+// pbAppendPackedInts encodes a packed repeated int32 field.
+func pbAppendPackedInts(b []byte, field int, vs []int) []byte {
+	if len(vs) == 0 {
+		return b
+	}
+	var packed []byte
+	for _, v := range vs {
+		packed = binary.AppendUvarint(packed, uint64(int64(v)))
+	}
+	b = pbAppendTag(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(packed)))
+	return append(b, packed...)
+}
+
+// pbDecodeStrings returns the length-delimited fields of a message by field
+// number (last occurrence wins), skipping every other wire type.
+func pbDecodeStrings(b []byte) (map[int]string, error) {
+	out := make(map[int]string)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("malformed field key")
+		}
+		b = b[n:]
+		field, wireType := int(key>>3), int(key&7)
+		switch wireType {
+		case 0:
+			if _, n = binary.Uvarint(b); n <= 0 {
+				return nil, errors.New("malformed varint")
+			}
+			b = b[n:]
+		case 1, 5:
+			size := map[int]int{1: 8, 5: 4}[wireType]
+			if len(b) < size {
+				return nil, errors.New("truncated fixed field")
+			}
+			b = b[size:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, errors.New("truncated length-delimited field")
+			}
+			out[field] = string(b[n : n+int(l)])
+			b = b[n+int(l):]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", wireType)
+		}
+	}
+	return out, nil
+}
+
+// encodeSMSMessage renders smsgateway.v1.SMS.
+func encodeSMSMessage(p SMSPayload) []byte {
+	var b []byte
+	b = pbAppendString(b, 1, p.From)
+	b = pbAppendString(b, 2, p.Text)
+	if p.Timestamp != nil {
+		b = pbAppendInt(b, 3, p.Timestamp.Unix())
+	}
+	b = pbAppendString(b, 4, p.SMSC)
+	b = pbAppendPackedInts(b, 5, p.SIMIndices)
+	for _, pdu := range p.RawPDUs {
+		b = pbAppendTag(b, 6, 2)
+		b = binary.AppendUvarint(b, uint64(len(pdu)))
+		b = append(b, pdu...)
+	}
+	b = pbAppendString(b, 7, p.RawReason)
+	b = pbAppendInt(b, 8, int64(p.Parts))
+	// map<string, string>: one entry message per key, sorted for stable
+	// output.
+	for _, key := range slices.Sorted(maps.Keys(p.Fields)) {
+		entry := pbAppendString(nil, 1, key)
+		entry = pbAppendString(entry, 2, p.Fields[key])
+		b = pbAppendTag(b, 9, 2)
+		b = binary.AppendUvarint(b, uint64(len(entry)))
+		b = append(b, entry...)
+	}
+	return b
+}
+
+// encodeSendResponse renders smsgateway.v1.SendResponse.
+func encodeSendResponse(res SendResult) []byte {
+	b := pbAppendInt(nil, 1, int64(res.Parts))
+	return pbAppendPackedInts(b, 2, res.References)
+}
+
+// --- subscriber fan-out -----------------------------------------------------
+
+// SMSBroadcaster is the sink behind Subscribe: every SMS goes to all
+// connected subscribers. It never fails — a stream is live data, not a
+// destination to hold SMS on the SIM for — and a subscriber that does not
+// keep up loses messages rather than stalling the modem goroutine.
+type SMSBroadcaster struct {
+	mu   sync.Mutex
+	subs map[chan SMSPayload]struct{}
+}
+
+func NewSMSBroadcaster() *SMSBroadcaster {
+	return &SMSBroadcaster{subs: make(map[chan SMSPayload]struct{})}
+}
+
+func (b *SMSBroadcaster) Name() string { return "grpc" }
+
+func (b *SMSBroadcaster) Send(ctx context.Context, pending PendingSMS) error {
+	payload := newSMSPayload(pending)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- payload:
+		default:
+			slog.WarnContext(ctx, "gRPC subscriber too slow, SMS not streamed to it")
+		}
+	}
+	return nil
+}
+
+func (b *SMSBroadcaster) subscribe() chan SMSPayload {
+	ch := make(chan SMSPayload, 16)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *SMSBroadcaster) unsubscribe(ch chan SMSPayload) {
+	b.mu.Lock()
+	delete(b.subs, ch)
+	b.mu.Unlock()
+}
+
+// --- HTTP/2 handler -----------------------------------------------------------
+
+// GRPCServer serves Subscribe (server streaming) and Send. Send needs an
+// outbox; with a nil outbox (GRPC_ALLOW_SEND unset) it is refused. With
+// credentials configured, calls carry them as metadata like HTTP API
+// requests ("authorization: Bearer ..." or "x-api-key"): Subscribe needs
+// the read scope, Send the send scope.
+type GRPCServer struct {
+	broadcaster *SMSBroadcaster
+	outbox      *Outbox
+	auth        *APIAuth
+}
+
+func NewGRPCServer(broadcaster *SMSBroadcaster, outbox *Outbox, auth *APIAuth) *GRPCServer {
+	return &GRPCServer{broadcaster: broadcaster, outbox: outbox, auth: auth}
+}
+
+// Serve serves on ln until ctx ends.
+func (g *GRPCServer) Serve(ctx context.Context, ln net.Listener) error {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	srv := &http.Server{
+		Handler:           g,
+		Protocols:         &protocols,
+		ReadHeaderTimeout: 10 * time.Second,
+		// Request contexts derive from ctx, so streams end on shutdown.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	slog.Info("gRPC API listening", "addr", ln.Addr().String(), "send_enabled", g.outbox != nil, "auth", g.auth.Enabled())
+	return serveUntilDone(ctx, srv, ln)
+}
+
+func (g *GRPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC only", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+
+	var code int
+	var msg string
+	switch strings.TrimPrefix(r.URL.Path, grpcServicePath) {
+	case "Subscribe":
+		if code, msg = g.authorize(r, scopeRead); code == grpcOK {
+			code, msg = g.subscribe(w, r)
+		}
+	case "Send":
+		if code, msg = g.authorize(r, scopeSend); code == grpcOK {
+			code, msg = g.send(w, r)
+		}
+	default:
+		code, msg = grpcUnimplemented, "unknown method "+r.URL.Path
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", url.PathEscape(msg))
+	}
+}
+
+// authorize checks the credentials of a call against need, like the HTTP
+// API does for its requests.
+func (g *GRPCServer) authorize(r *http.Request, need apiScope) (int, string) {
+	user, scopes, err := g.auth.Authenticate(r)
+	if err != nil {
+		slog.Debug("gRPC authentication failed", "remote", r.RemoteAddr, "path", r.URL.Path, "error", err)
+		return grpcUnauthenticated, "missing or invalid credentials"
+	}
+	if scopes&need != need {
+		slog.Warn("gRPC call denied", "user", user, "scopes", scopes.String(), "path", r.URL.Path, "remote", r.RemoteAddr)
+		return grpcPermissionDenied, need.String() + " scope required"
+	}
+	if need != scopeRead {
+		slog.Info("gRPC "+need.String()+" call", "user", user, "path", r.URL.Path, "remote", r.RemoteAddr)
+	}
+	return grpcOK, ""
+}
+
+// readGRPCMessage reads one length-prefixed request message.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("reading message header: %w", err)
+	}
+	if hdr[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > grpcMaxMessage {
+		return nil, fmt.Errorf("message of %d bytes exceeds %d", n, grpcMaxMessage)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("reading message: %w", err)
+	}
+	return msg, nil
+}
+
+func writeGRPCMessage(w http.ResponseWriter, msg []byte) error {
+	frame := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(msg)))
+	if _, err := w.Write(append(frame, msg...)); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+func (g *GRPCServer) subscribe(w http.ResponseWriter, r *http.Request) (int, string) {
+	if _, err := readGRPCMessage(r.Body); err != nil {
+		return grpcInvalidArgument, err.Error()
+	}
+	ch := g.broadcaster.subscribe()
+	defer g.broadcaster.unsubscribe(ch)
+	slog.Info("gRPC subscriber connected", "remote", r.RemoteAddr)
+	// Send headers now so the client sees the stream is open.
+	if err := http.NewResponseController(w).Flush(); err != nil {
+		return grpcInternal, err.Error()
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			slog.Info("gRPC subscriber disconnected", "remote", r.RemoteAddr)
+			return grpcUnavailable, "server shutting down"
+		case p := <-ch:
+			if err := writeGRPCMessage(w, encodeSMSMessage(p)); err != nil {
+				return grpcUnavailable, err.Error()
+			}
+		}
+	}
+}
+
+func (g *GRPCServer) send(w http.ResponseWriter, r *http.Request) (int, string) {
+	if g.outbox == nil {
+		return grpcPermissionDenied, "sending is disabled (set GRPC_ALLOW_SEND=true)"
+	}
+	body, err := readGRPCMessage(r.Body)
+	if err != nil {
+		return grpcInvalidArgument, err.Error()
+	}
+	fields, err := pbDecodeStrings(body)
+	if err != nil {
+		return grpcInvalidArgument, err.Error()
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), grpcSendDeadline)
+	defer cancel()
+	res, err := g.outbox.Send(ctx, fields[1], fields[2])
+	switch {
+	case errors.Is(err, errInvalidSMS):
+		return grpcInvalidArgument, err.Error()
+	case err != nil:
+		return grpcUnavailable, err.Error()
+	}
+	if err := writeGRPCMessage(w, encodeSendResponse(res)); err != nil {
+		return grpcInternal, err.Error()
+	}
+	return grpcOK, ""
+}
@@ -0,0 +1,227 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSubmitter answers every AT+CMGS dialog with an increasing reference.
+type fakeSubmitter struct {
+	cmds []string
+	pdus []string
+	err  error
+}
+
+func (f *fakeSubmitter) CommandWithPrompt(cmd, payload string, _ time.Duration) ([]string, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.cmds = append(f.cmds, cmd)
+	f.pdus = append(f.pdus, payload)
+	return []string{fmt.Sprintf("+CMGS: %d", 40+len(f.cmds))}, nil
+}
+
+// startGRPC serves g on a loopback port and returns an h2c client and base URL.
+func startGRPC(t *testing.T, g *GRPCServer) (*http.Client, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go g.Serve(ctx, ln)
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+	return client, "http://" + ln.Addr().String() + grpcServicePath
+}
+
+func grpcFrame(msg []byte) io.Reader {
+	return bytes.NewReader(append(binary.BigEndian.AppendUint32([]byte{0}, uint32(len(msg))), msg...))
+}
+
+func grpcCall(t *testing.T, client *http.Client, url string, msg []byte, metadata ...string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, grpcFrame(msg))
+	req.Header.Set("Content-Type", "application/grpc")
+	for i := 0; i+1 < len(metadata); i += 2 {
+		req.Header.Set(metadata[i], metadata[i+1])
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	return resp
+}
+
+func TestGRPCServer_Subscribe(t *testing.T) {
+	broadcaster := NewSMSBroadcaster()
+	client, base := startGRPC(t, NewGRPCServer(broadcaster, nil, nil))
+
+	resp := grpcCall(t, client, base+"Subscribe", nil)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/grpc" {
+		t.Fatalf("response = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// Headers were flushed after registration: the subscriber is live.
+	pending := PendingSMS{Message: SMSMessage{From: "+100", Text: "code 1234"}, PartIndices: []int{3, 4}}
+	if err := broadcaster.Send(context.Background(), pending); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := readGRPCMessage(resp.Body)
+	if err != nil {
+		t.Fatalf("reading streamed SMS: %v", err)
+	}
+	fields, err := pbDecodeStrings(msg)
+	if err != nil || fields[1] != "+100" || fields[2] != "code 1234" || fields[5] != "\x03\x04" {
+		t.Errorf("streamed SMS fields = %q, %v", fields, err)
+	}
+}
+
+// Extracted fields are a map<string, string>: entry messages in key order.
+func TestEncodeSMSMessage_Fields(t *testing.T) {
+	msg := encodeSMSMessage(SMSPayload{Fields: map[string]string{"otp": "4711", "bank": "X"}})
+	want := "\x4a\x09\x0a\x04bank\x12\x01X" + "\x4a\x0b\x0a\x03otp\x12\x044711"
+	if string(msg) != want {
+		t.Errorf("encodeSMSMessage() = % x, want % x", msg, want)
+	}
+}
+
+func TestGRPCServer_Send(t *testing.T) {
+	outbox := NewOutbox(false)
+	submitter := &fakeSubmitter{}
+	go func() {
+		for req := range outbox.pending() {
+			outbox.submit(submitter, req)
+		}
+	}()
+	client, base := startGRPC(t, NewGRPCServer(NewSMSBroadcaster(), outbox, nil))
+
+	req := pbAppendString(pbAppendString(nil, 1, "+4915550001234"), 2, strings.Repeat("a", 200))
+	resp := grpcCall(t, client, base+"Send", req)
+	msg, err := readGRPCMessage(resp.Body)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("reading SendResponse: %v", err)
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Fatalf("grpc-status = %q (%s)", got, resp.Trailer.Get("Grpc-Message"))
+	}
+	// parts = 2, references packed [41, 42]
+	if want := "\x08\x02\x12\x02\x29\x2a"; string(msg) != want {
+		t.Errorf("SendResponse = % x, want % x", msg, want)
+	}
+	if len(submitter.cmds) != 2 || !strings.HasPrefix(submitter.cmds[0], "AT+CMGS=") {
+		t.Errorf("modem commands = %v, want two AT+CMGS parts", submitter.cmds)
+	}
+
+	resp = grpcCall(t, client, base+"Send", pbAppendString(nil, 1, "not-a-number"))
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if got := resp.Trailer.Get("Grpc-Status"); got != "3" {
+		t.Errorf("invalid destination: grpc-status = %q, want 3", got)
+	}
+}
+
+func TestGRPCServer_SendDisabled(t *testing.T) {
+	client, base := startGRPC(t, NewGRPCServer(NewSMSBroadcaster(), nil, nil))
+	resp := grpcCall(t, client, base+"Send", nil)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if got := resp.Trailer.Get("Grpc-Status"); got != "7" {
+		t.Errorf("grpc-status = %q, want 7 (permission denied)", got)
+	}
+
+	resp = grpcCall(t, client, base+"Nope", nil)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if got := resp.Trailer.Get("Grpc-Status"); got != "12" {
+		t.Errorf("unknown method: grpc-status = %q, want 12", got)
+	}
+}
+
+func TestGRPCServer_Auth(t *testing.T) {
+	auth := NewAPIAuth("admin-token", nil, nil)
+	auth.SetKeys([]APIKey{{Name: "nas", Scopes: scopeRead, Hash: sha256.Sum256([]byte("nas-key"))}})
+	client, base := startGRPC(t, NewGRPCServer(NewSMSBroadcaster(), nil, auth))
+
+	tests := []struct {
+		name     string
+		method   string
+		metadata []string
+		want     string
+	}{
+		{name: "no credentials", method: "Subscribe", want: "16"},
+		{name: "wrong token", method: "Subscribe", metadata: []string{"authorization", "Bearer nope"}, want: "16"},
+		{name: "wrong key", method: "Send", metadata: []string{"x-api-key", "nope"}, want: "16"},
+		{name: "read key sends", method: "Send", metadata: []string{"x-api-key", "nas-key"}, want: "7"},
+		// Authenticated: on to the disabled Send.
+		{name: "admin token sends", method: "Send", metadata: []string{"authorization", "Bearer admin-token"}, want: "7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := grpcCall(t, client, base+tt.method, nil, tt.metadata...)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if got := resp.Trailer.Get("Grpc-Status"); got != tt.want {
+				t.Errorf("grpc-status = %q (%s), want %s", got, resp.Trailer.Get("Grpc-Message"), tt.want)
+			}
+		})
+	}
+
+	// The read key subscribes: the stream opens without a status.
+	resp := grpcCall(t, client, base+"Subscribe", nil, "x-api-key", "nas-key")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Grpc-Status") != "" {
+		t.Errorf("Subscribe with the read key = %d, grpc-status %q", resp.StatusCode, resp.Header.Get("Grpc-Status"))
+	}
+}
+
+func TestOutbox_DryRunAndConcat(t *testing.T) {
+	submitter := &fakeSubmitter{}
+	outbox := NewOutbox(true)
+	go func() { outbox.submit(submitter, <-outbox.pending()) }()
+	res, err := outbox.Send(context.Background(), "+4915550001234", "hello")
+	if err != nil || res.Parts != 1 || len(submitter.cmds) != 0 {
+		t.Errorf("DRY_RUN Send() = %+v, %v; modem saw %v", res, err, submitter.cmds)
+	}
+
+	outbox = NewOutbox(false)
+	go func() { outbox.submit(submitter, <-outbox.pending()) }()
+	if _, err := outbox.Send(context.Background(), "015550001234", strings.Repeat("Ж", 100)); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := hex.DecodeString(submitter.pdus[0])
+	// National number: TOA 0x81; UDHI set for a concatenated UCS2 message.
+	if first[1]&0x40 == 0 || first[4] != 0x81 {
+		t.Errorf("first part PDU % x: want UDHI and national TOA", first)
+	}
+}
+
+// A text-mode session refuses outgoing SMS without touching the modem.
+func TestOutbox_Refuse(t *testing.T) {
+	outbox := NewOutbox(false)
+	go func() { outbox.refuse(<-outbox.pending(), errTextModeSend) }()
+	if _, err := outbox.Send(context.Background(), "+4915550001234", "hello"); !errors.Is(err, errTextModeSend) {
+		t.Errorf("Send() error = %v, want errTextModeSend", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// livenessStallAfter is how long the modem goroutine may go without any
+	// progress before /healthz fails. Session init, diagnostics with the
+	// registration grace and a modem reset together stay well below it.
+	livenessStallAfter = 5 * time.Minute
+	// readinessStaleAfter is how old the last healthy modem cycle may be;
+	// every poll is a healthy cycle, and POLL_INTERVAL is at most 1m.
+	readinessStaleAfter = 3 * time.Minute
+	// telegramProbeTTL caches the Telegram reachability check so frequent
+	// probes do not turn into a getMe call each.
+	telegramProbeTTL     = 30 * time.Second
+	telegramProbeTimeout = 5 * time.Second
+)
+
+// HealthState backs /healthz and /readyz. The modem goroutine records
+// progress; probes only read the recorded state and never touch the serial
+// port. All methods are nil-safe (HTTP API disabled).
+type HealthState struct {
+	telegram TelegramProber // nil skips the Telegram check (DRY_RUN)
+	// modemOnly reports Telegram in /readyz without failing it
+	// (KUBERNETES): SMS wait on the SIM during an outage, and the pod
+	// serves its modem all the same.
+	modemOnly bool
+
+	mu          sync.Mutex
+	progressAt  time.Time
+	modemOKAt   time.Time
+	modemReason string // why the modem is not ready; empty while healthy
+
+	probeMu  sync.Mutex
+	probeAt  time.Time
+	probeErr error
+}
+
+func NewHealthState(telegram TelegramProber) *HealthState {
+	return &HealthState{telegram: telegram, progressAt: clk.Now(), modemReason: "starting"}
+}
+
+// Progress records that the modem goroutine is alive (a new session
+// attempt, a poll, a health check).
+func (h *HealthState) Progress() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.progressAt = clk.Now()
+	h.mu.Unlock()
+}
+
+// ModemHealthy records a healthy modem cycle: port open, session
+// initialized and diagnosed, last command answered.
+func (h *HealthState) ModemHealthy() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	now := clk.Now()
+	h.progressAt, h.modemOKAt, h.modemReason = now, now, ""
+	h.mu.Unlock()
+}
+
+// ModemDown records that the modem session ended; reason is shown by /readyz.
+func (h *HealthState) ModemDown(reason string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.progressAt, h.modemReason = clk.Now(), reason
+	h.mu.Unlock()
+}
+
+// Live reports whether the modem goroutine made progress recently.
+func (h *HealthState) Live() (bool, string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if since := clk.Now().Sub(h.progressAt); since > livenessStallAfter {
+		return false, "modem loop stalled for " + since.Truncate(time.Second).String()
+	}
+	return true, "ok"
+}
+
+// Ready reports per-check readiness: the modem and, unless disabled or
+// modemOnly, Telegram reachability.
+func (h *HealthState) Ready(ctx context.Context) (bool, map[string]string) {
+	checks := map[string]string{}
+	ready := true
+
+	h.mu.Lock()
+	switch {
+	case h.modemReason != "":
+		checks["modem"], ready = h.modemReason, false
+	case clk.Now().Sub(h.modemOKAt) > readinessStaleAfter:
+		checks["modem"], ready = "no healthy modem cycle since "+h.modemOKAt.Format(time.RFC3339), false
+	default:
+		checks["modem"] = "ok"
+	}
+	h.mu.Unlock()
+
+	if h.telegram == nil {
+		checks["telegram"] = "skipped (dry run)"
+	} else if err := h.telegramReachable(ctx); err != nil {
+		checks["telegram"] = err.Error()
+		ready = ready && h.modemOnly
+	} else {
+		checks["telegram"] = "ok"
+	}
+	return ready, checks
+}
+
+// telegramReachable returns the cached getMe result, refreshing it when
+// older than telegramProbeTTL.
+func (h *HealthState) telegramReachable(ctx context.Context) error {
+	h.probeMu.Lock()
+	defer h.probeMu.Unlock()
+	if !h.probeAt.IsZero() && clk.Now().Sub(h.probeAt) < telegramProbeTTL {
+		return h.probeErr
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, telegramProbeTimeout)
+	defer cancel()
+	_, err := h.telegram.GetMe(probeCtx)
+	h.probeAt, h.probeErr = clk.Now(), err
+	return err
+}
@@ -0,0 +1,128 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+type fakeProber struct {
+	calls int
+	err   error
+}
+
+func (f *fakeProber) GetMe(context.Context) (*models.User, error) {
+	f.calls++
+	return &models.User{}, f.err
+}
+
+func probe(t *testing.T, api *APIServer, path string) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s: invalid JSON %s", path, rec.Body)
+	}
+	return rec.Code, body
+}
+
+func TestHealthState_Readiness(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	prober := &fakeProber{}
+	health := NewHealthState(prober)
+	// Probes bypass the bearer token; the archive endpoint is absent.
+	api := NewAPIServer(nil, health, NewAPIAuth("s3cret", nil, nil))
+
+	if code, body := probe(t, api, "/readyz"); code != http.StatusServiceUnavailable ||
+		body["checks"].(map[string]any)["modem"] != "starting" {
+		t.Errorf("before the first session: %d %v, want 503 starting", code, body)
+	}
+
+	health.ModemHealthy()
+	if code, body := probe(t, api, "/readyz"); code != http.StatusOK {
+		t.Errorf("healthy: %d %v, want 200", code, body)
+	}
+
+	// The Telegram result is cached for telegramProbeTTL.
+	prober.err = errors.New("connection refused")
+	if code, _ := probe(t, api, "/readyz"); code != http.StatusOK || prober.calls != 1 {
+		t.Errorf("cached probe: status %d after %d getMe calls", code, prober.calls)
+	}
+	clock.Advance(telegramProbeTTL)
+	health.ModemHealthy()
+	if code, body := probe(t, api, "/readyz"); code != http.StatusServiceUnavailable ||
+		body["checks"].(map[string]any)["telegram"] != "connection refused" {
+		t.Errorf("Telegram down: %d %v, want 503", code, body)
+	}
+	prober.err = nil
+	clock.Advance(telegramProbeTTL)
+
+	health.ModemDown("SIM Not Inserted")
+	if code, body := probe(t, api, "/readyz"); code != http.StatusServiceUnavailable ||
+		body["checks"].(map[string]any)["modem"] != "SIM Not Inserted" {
+		t.Errorf("modem down: %d %v, want 503 with the reason", code, body)
+	}
+
+	// A modem loop that stops reporting goes unready, then not live.
+	health.ModemHealthy()
+	clock.Advance(readinessStaleAfter + time.Second)
+	if code, _ := probe(t, api, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("stale modem cycle: status %d, want 503", code)
+	}
+	if code, _ := probe(t, api, "/healthz"); code != http.StatusOK {
+		t.Errorf("healthz within the stall limit: status %d, want 200", code)
+	}
+	clock.Advance(livenessStallAfter)
+	if code, body := probe(t, api, "/healthz"); code != http.StatusServiceUnavailable || body["status"] != "stalled" {
+		t.Errorf("stalled loop: %d %v, want 503", code, body)
+	}
+
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/messages", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("non-probe path without token: status %d, want 401", rec.Code)
+	}
+}
+
+func TestHealthState_DryRunSkipsTelegram(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	health := NewHealthState(nil)
+	health.ModemHealthy()
+	ready, checks := health.Ready(context.Background())
+	if !ready || checks["telegram"] != "skipped (dry run)" {
+		t.Errorf("Ready() = %v, %v", ready, checks)
+	}
+
+	var disabled *HealthState
+	disabled.Progress()
+	disabled.ModemHealthy()
+	disabled.ModemDown("x")
+}
+
+// TestHealthState_ModemOnly: with KUBERNETES an unreachable Telegram is
+// reported but the pod stays ready as long as its modem is.
+func TestHealthState_ModemOnly(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	health := NewHealthState(&fakeProber{err: errors.New("connection refused")})
+	health.modemOnly = true
+	health.ModemHealthy()
+	ready, checks := health.Ready(context.Background())
+	if !ready || checks["telegram"] != "connection refused" {
+		t.Errorf("Telegram down: Ready() = %v, %v, want ready with the error", ready, checks)
+	}
+	health.ModemDown("SIM Not Inserted")
+	if ready, checks := health.Ready(context.Background()); ready {
+		t.Errorf("modem down: Ready() = %v, %v, want not ready", ready, checks)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// healthPingTimeout bounds one ping request.
+const healthPingTimeout = 10 * time.Second
+
+// HealthPinger reports to a dead-man's-switch monitor (healthchecks.io and
+// compatible: GET <url>, <url>/start, <url>/fail). The modem goroutine only
+// records heartbeats and failures; pings run on their own goroutine, so a
+// slow monitor never stalls polling and a hung modem loop simply stops the
+// pings — the monitor's grace period notices, without relying on Telegram.
+type HealthPinger struct {
+	url      string
+	interval time.Duration
+	dryRun   bool
+	client   *http.Client
+	// trigger wakes Run for an immediate /fail ping.
+	trigger chan struct{}
+
+	mu          sync.Mutex
+	beat        bool // heartbeat since the last success ping
+	failPending bool
+}
+
+func NewHealthPinger(url string, interval time.Duration, dryRun bool) *HealthPinger {
+	return &HealthPinger{
+		url:      strings.TrimSuffix(url, "/"),
+		interval: interval,
+		dryRun:   dryRun,
+		client:   &http.Client{Timeout: healthPingTimeout},
+		trigger:  make(chan struct{}, 1),
+	}
+}
+
+// Beat records that the modem loop completed a healthy cycle. Nil-safe.
+func (p *HealthPinger) Beat() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.beat = true
+	p.mu.Unlock()
+}
+
+// Fail reports a diagnostic failure; the /fail ping is sent right away.
+// Nil-safe.
+func (p *HealthPinger) Fail() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.beat = false
+	p.failPending = true
+	p.mu.Unlock()
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends /start, then one success ping per interval in which the modem
+// loop was healthy, until ctx ends.
+func (p *HealthPinger) Run(ctx context.Context) {
+	slog.Info("Health pings enabled", "endpoint", redactURL(p.url), "interval", p.interval)
+	p.ping(ctx, "/start")
+	tick := clk.After(p.interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.trigger:
+		case <-tick:
+			tick = clk.After(p.interval)
+		}
+		p.flush(ctx)
+	}
+}
+
+// flush sends whatever the recorded state calls for: a pending failure, else
+// a success ping if the loop beat since the last one, else nothing.
+func (p *HealthPinger) flush(ctx context.Context) {
+	p.mu.Lock()
+	suffix, send := "", p.beat
+	if p.failPending {
+		suffix, send = "/fail", true
+	}
+	p.beat, p.failPending = false, false
+	p.mu.Unlock()
+	if send {
+		p.ping(ctx, suffix)
+	}
+}
+
+// ping is best effort: a missed ping is what the monitor's grace period is
+// for, so failures are only logged.
+func (p *HealthPinger) ping(ctx context.Context, suffix string) {
+	if p.dryRun {
+		slog.Info("DRY_RUN: Would send health ping", "endpoint", redactURL(p.url), "kind", strings.TrimPrefix(suffix, "/"))
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+suffix, nil)
+	if err != nil {
+		slog.Warn("Health ping failed", "error", err)
+		return
+	}
+	status, err := doSinkRequest(p.client, req)
+	switch {
+	case err != nil:
+		if ctx.Err() == nil {
+			slog.Warn("Health ping failed", "error", err)
+		}
+	case status/100 != 2:
+		slog.Warn("Health ping rejected", "endpoint", redactURL(p.url), "status", status)
+	default:
+		slog.Debug("Health ping sent", "kind", strings.TrimPrefix(suffix, "/"))
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// pingRecorder serves a healthchecks-style endpoint and reports each path.
+func pingRecorder(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	paths := make(chan string, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("ping method = %s, want GET", r.Method)
+		}
+		paths <- r.URL.Path
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/ping/abc", paths
+}
+
+func TestHealthPinger_Flush(t *testing.T) {
+	url, paths := pingRecorder(t)
+	p := NewHealthPinger(url+"/", time.Minute, false)
+	ctx := context.Background()
+
+	// No heartbeat since the last ping: stay silent, let the grace expire.
+	p.flush(ctx)
+	p.Beat()
+	p.flush(ctx)
+	p.flush(ctx)
+	p.Beat()
+	p.Fail()
+	p.flush(ctx)
+
+	var got []string
+	for len(paths) > 0 {
+		got = append(got, <-paths)
+	}
+	want := []string{"/ping/abc", "/ping/abc/fail"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("pings = %v, want %v", got, want)
+	}
+}
+
+func TestHealthPinger_RunStartAndImmediateFail(t *testing.T) {
+	url, paths := pingRecorder(t)
+	p := NewHealthPinger(url, time.Hour, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	if got := <-paths; got != "/ping/abc/start" {
+		t.Errorf("first ping = %s, want /start", got)
+	}
+	p.Fail()
+	select {
+	case got := <-paths:
+		if got != "/ping/abc/fail" {
+			t.Errorf("ping after Fail = %s, want /fail", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Fail did not ping before the next interval")
+	}
+}
+
+func TestHealthPinger_NilAndDryRun(t *testing.T) {
+	var p *HealthPinger
+	p.Beat()
+	p.Fail()
+
+	url, paths := pingRecorder(t)
+	dry := NewHealthPinger(url, time.Minute, true)
+	dry.Beat()
+	dry.flush(context.Background())
+	select {
+	case got := <-paths:
+		t.Errorf("DRY_RUN pinged %s", got)
+	default:
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// HomeAssistant announces the gateway to Home Assistant through MQTT
+// discovery (retained config topics) and keeps the entity states retained on
+// the broker:
+//
+//   - "Last SMS" sensor: reads the MQTT sink topic directly (state = sender,
+//     attributes = the SMSPayload), so no extra publish per SMS is needed;
+//   - signal strength sensor (dBm), refreshed on every health check;
+//   - problem binary sensor, ON while a modem/SIM/network alert is active.
+//
+// Publishing happens on the modem goroutine with the same connect-per-message
+// session as MQTTSink. Failures are logged and retried on the next change;
+// they never affect SMS delivery.
+type HomeAssistant struct {
+	opts   MQTTOptions
+	prefix string
+	nodeID string
+	host   string
+	dryRun bool
+
+	mu sync.Mutex
+	// discovered is set once the discovery configs reached the broker.
+	discovered bool
+	// last retained state per topic, to publish changes only.
+	states map[string]string
+}
+
+func NewHomeAssistant(opts MQTTOptions, hostname string, dryRun bool) *HomeAssistant {
+	return &HomeAssistant{
+		opts:   opts,
+		prefix: opts.DiscoveryPrefix,
+		nodeID: haNodeID(opts.ClientID),
+		host:   hostname,
+		dryRun: dryRun,
+		states: make(map[string]string),
+	}
+}
+
+// haNodeID maps the client ID onto the [a-zA-Z0-9_-] alphabet discovery
+// topics allow.
+func haNodeID(clientID string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, clientID)
+}
+
+func (h *HomeAssistant) stateTopic(entity string) string {
+	return "sms-to-telegram/" + h.nodeID + "/" + entity
+}
+
+// discoveryConfigs returns the retained discovery documents by topic.
+func (h *HomeAssistant) discoveryConfigs() map[string]map[string]any {
+	device := map[string]any{
+		"identifiers":  []string{"sms-to-telegram_" + h.nodeID},
+		"name":         "SMS gateway " + h.host,
+		"model":        "sms-to-telegram",
+		"manufacturer": "kogeler",
+	}
+	entity := func(component, object string, fields map[string]any) (string, map[string]any) {
+		fields["unique_id"] = h.nodeID + "_" + object
+		fields["object_id"] = h.nodeID + "_" + object
+		fields["device"] = device
+		return fmt.Sprintf("%s/%s/%s/%s/config", h.prefix, component, h.nodeID, object), fields
+	}
+
+	configs := make(map[string]map[string]any)
+	add := func(topic string, cfg map[string]any) { configs[topic] = cfg }
+	add(entity("sensor", "last_sms", map[string]any{
+		"name":                  "Last SMS",
+		"icon":                  "mdi:message-text",
+		"state_topic":           h.opts.Topic,
+		"value_template":        "{{ value_json.from }}",
+		"json_attributes_topic": h.opts.Topic,
+	}))
+	add(entity("sensor", "signal", map[string]any{
+		"name":                "Signal strength",
+		"device_class":        "signal_strength",
+		"unit_of_measurement": "dBm",
+		"state_class":         "measurement",
+		"entity_category":     "diagnostic",
+		"state_topic":         h.stateTopic("signal"),
+	}))
+	add(entity("binary_sensor", "problem", map[string]any{
+		"name":                  "Problem",
+		"device_class":          "problem",
+		"entity_category":       "diagnostic",
+		"state_topic":           h.stateTopic("problem"),
+		"value_template":        "{{ value_json.state }}",
+		"json_attributes_topic": h.stateTopic("problem"),
+	}))
+	return configs
+}
+
+// publishRetained sends retained messages in one session, announcing the
+// device first if that has not succeeded yet. The caller holds h.mu.
+func (h *HomeAssistant) publishRetained(ctx context.Context, msgs map[string]string) error {
+	if !h.discovered {
+		for topic, cfg := range h.discoveryConfigs() {
+			payload, err := json.Marshal(cfg)
+			if err != nil {
+				return err
+			}
+			msgs[topic] = string(payload)
+		}
+	}
+	if h.dryRun {
+		for topic := range msgs {
+			slog.Info("DRY_RUN: Would publish Home Assistant state", "topic", topic)
+		}
+		h.discovered = true
+		return nil
+	}
+
+	conn, err := dialMQTT(ctx, h.opts)
+	if err != nil {
+		return fmt.Errorf("MQTT connect: %w", err)
+	}
+	defer conn.close()
+	for topic, payload := range msgs {
+		if err := conn.publish(topic, []byte(payload), h.opts.QoS, true); err != nil {
+			return fmt.Errorf("MQTT publish %s: %w", topic, err)
+		}
+	}
+	h.discovered = true
+	return nil
+}
+
+// setState publishes payload to the entity's state topic unless it is
+// already the retained value.
+func (h *HomeAssistant) setState(ctx context.Context, entity, payload string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	topic := h.stateTopic(entity)
+	if h.discovered && h.states[topic] == payload {
+		return
+	}
+	if err := h.publishRetained(ctx, map[string]string{topic: payload}); err != nil {
+		slog.Warn("Home Assistant update failed", "entity", entity, "error", err)
+		return
+	}
+	h.states[topic] = payload
+}
+
+// Announce publishes the discovery configs (at startup).
+func (h *HomeAssistant) Announce(ctx context.Context) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.publishRetained(ctx, map[string]string{}); err != nil {
+		slog.Warn("Home Assistant discovery failed, will retry on the next update", "error", err)
+		return
+	}
+	slog.Info("Home Assistant discovery published", "prefix", h.prefix, "node_id", h.nodeID)
+}
+
+// PublishSignal reports the CSQ RSSI as dBm; 99 (unknown) clears the value.
+func (h *HomeAssistant) PublishSignal(ctx context.Context, rssi int) {
+	payload := "None" // Home Assistant's "unknown" for numeric sensors
+	if rssi >= 0 && rssi <= 31 {
+		payload = fmt.Sprint(csqToDBm(rssi))
+	}
+	h.setState(ctx, "signal", payload)
+}
+
+// PublishProblem mirrors the alert state: ErrTypeNone clears it.
+func (h *HomeAssistant) PublishProblem(ctx context.Context, errType DiagnosticErrorType) {
+	state := map[string]string{"state": "OFF"}
+	if errType != ErrTypeNone {
+		state = map[string]string{"state": "ON", "error": errorTypeName(errType)}
+	}
+	payload, _ := json.Marshal(state)
+	h.setState(ctx, "problem", string(payload))
+}
+
+// csqToDBm converts a +CSQ RSSI (0-31) to dBm per 3GPP TS 27.007.
+func csqToDBm(rssi int) int {
+	return -113 + 2*rssi
+}
@@ -0,0 +1,83 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHomeAssistant_FirstUpdateAnnounces(t *testing.T) {
+	broker := newFakeBroker(t, 0)
+	ha := NewHomeAssistant(MQTTOptions{
+		URL: broker.url(), ClientID: "sms-to-telegram-gw.lan", Topic: "sms/in", QoS: 1,
+		Timeout: 2 * time.Second, DiscoveryPrefix: "homeassistant",
+	}, "gw", false)
+
+	ha.PublishSignal(context.Background(), 20)
+
+	retained := make(map[string]string)
+	for _, p := range broker.received(t) {
+		if p.header&0xF0 != mqttPublish {
+			continue
+		}
+		if p.header&0x01 == 0 {
+			t.Errorf("PUBLISH %q is not retained", p.body)
+		}
+		topicLen := int(binary.BigEndian.Uint16(p.body))
+		retained[string(p.body[2:2+topicLen])] = string(p.body[4+topicLen:])
+	}
+
+	if got := retained["sms-to-telegram/sms-to-telegram-gw_lan/signal"]; got != "-73" {
+		t.Errorf("signal state = %q, want -73", got)
+	}
+	var lastSMS map[string]any
+	if err := json.Unmarshal([]byte(retained["homeassistant/sensor/sms-to-telegram-gw_lan/last_sms/config"]), &lastSMS); err != nil {
+		t.Fatalf("last_sms discovery config: %v (published: %v)", err, retained)
+	}
+	if lastSMS["state_topic"] != "sms/in" || lastSMS["unique_id"] != "sms-to-telegram-gw_lan_last_sms" {
+		t.Errorf("last_sms config = %v", lastSMS)
+	}
+	for _, topic := range []string{
+		"homeassistant/sensor/sms-to-telegram-gw_lan/signal/config",
+		"homeassistant/binary_sensor/sms-to-telegram-gw_lan/problem/config",
+	} {
+		if _, ok := retained[topic]; !ok {
+			t.Errorf("missing discovery config %s", topic)
+		}
+	}
+}
+
+func TestHomeAssistant_States(t *testing.T) {
+	ha := NewHomeAssistant(MQTTOptions{ClientID: "gw", DiscoveryPrefix: "homeassistant"}, "gw", true)
+	ctx := context.Background()
+
+	ha.PublishSignal(ctx, 99)
+	if got := ha.states["sms-to-telegram/gw/signal"]; got != "None" {
+		t.Errorf("CSQ 99 state = %q, want None", got)
+	}
+
+	ha.PublishProblem(ctx, ErrTypeNoSignal)
+	if got := ha.states["sms-to-telegram/gw/problem"]; got != `{"error":"No Signal","state":"ON"}` {
+		t.Errorf("problem state = %q", got)
+	}
+	ha.PublishProblem(ctx, ErrTypeNone)
+	if got := ha.states["sms-to-telegram/gw/problem"]; got != `{"state":"OFF"}` {
+		t.Errorf("recovered state = %q", got)
+	}
+
+	var nilHA *HomeAssistant
+	nilHA.PublishSignal(ctx, 10) // must not panic
+}
+
+func TestCSQToDBm(t *testing.T) {
+	for rssi, want := range map[int]int{0: -113, 1: -111, 31: -51} {
+		if got := csqToDBm(rssi); got != want {
+			t.Errorf("csqToDBm(%d) = %d, want %d", rssi, got, want)
+		}
+	}
+}
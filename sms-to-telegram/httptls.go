@@ -0,0 +1,242 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// TLS for the HTTP API listener: a certificate and key from files
+// (HTTP_TLS_CERT, HTTP_TLS_KEY), re-read when they change so certbot or
+// cert-manager renewals need no restart, or a self-signed certificate
+// (HTTP_TLS_SELF_SIGNED) kept in STATE_DIR so its fingerprint stays the same
+// across restarts and can be pinned.
+
+const (
+	selfSignedCertFileName = "http_tls_cert.pem"
+	selfSignedKeyFileName  = "http_tls_key.pem"
+	selfSignedValidity     = 365 * 24 * time.Hour
+	// selfSignedRenewBefore replaces a stored certificate this close to
+	// its expiry at startup.
+	selfSignedRenewBefore = 30 * 24 * time.Hour
+	// certCheckInterval bounds how often the certificate files are checked
+	// for changes.
+	certCheckInterval = time.Minute
+)
+
+// HTTPTLSOptions configures TLS on HTTP_LISTEN (HTTP_TLS_* variables).
+type HTTPTLSOptions struct {
+	CertFile, KeyFile string
+	// SelfSigned generates a certificate instead of reading one.
+	SelfSigned bool
+}
+
+// newHTTPTLSConfig returns the server TLS configuration for opts. stateDir
+// keeps the self-signed certificate (empty: a new one every start); listen
+// adds its host to the self-signed certificate's names.
+func newHTTPTLSConfig(opts HTTPTLSOptions, stateDir, listen string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if !opts.SelfSigned {
+		reloader, err := newCertReloader(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GetCertificate = reloader.GetCertificate
+		return cfg, nil
+	}
+	cert, err := selfSignedCertificate(stateDir, selfSignedHosts(listen))
+	if err != nil {
+		return nil, fmt.Errorf("self-signed certificate: %w", err)
+	}
+	sum := sha256.Sum256(cert.Leaf.Raw)
+	slog.Info("HTTP API uses a self-signed certificate",
+		"sha256", hex.EncodeToString(sum[:]), "expires", cert.Leaf.NotAfter.Format(time.DateOnly))
+	cfg.Certificates = []tls.Certificate{cert}
+	return cfg, nil
+}
+
+// certReloader serves a certificate from files and reloads it when their
+// modification time changes. A broken replacement keeps the old one.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	cert, modTime, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	c.cert, c.modTime, c.checked = cert, modTime, clk.Now()
+	return c, nil
+}
+
+func (c *certReloader) load() (*tls.Certificate, time.Time, error) {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("loading HTTP_TLS_CERT/HTTP_TLS_KEY: %w", err)
+	}
+	return &cert, modTime, nil
+}
+
+func (c *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// GetCertificate is the tls.Config hook.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := clk.Now()
+	if now.Sub(c.checked) < certCheckInterval {
+		return c.cert, nil
+	}
+	c.checked = now
+	if modTime, err := c.latestModTime(); err != nil || modTime.Equal(c.modTime) {
+		return c.cert, nil
+	}
+	cert, modTime, err := c.load()
+	if err != nil {
+		// Often a half-finished renewal; the next check retries.
+		slog.Warn("HTTP API certificate reload failed, keeping the old one", "error", err)
+		return c.cert, nil
+	}
+	c.cert, c.modTime = cert, modTime
+	slog.Info("HTTP API certificate reloaded", "expires", cert.Leaf.NotAfter.Format(time.DateOnly))
+	return c.cert, nil
+}
+
+// selfSignedHosts are the names a self-signed certificate is issued for.
+func selfSignedHosts(listen string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if name, err := os.Hostname(); err == nil && name != "" {
+		hosts = append(hosts, name)
+	}
+	if host, _, err := net.SplitHostPort(listen); err == nil && host != "" && host != "0.0.0.0" && host != "::" {
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// selfSignedCertificate loads the certificate kept in stateDir or creates
+// (and keeps) a new one when there is none or it is about to expire.
+func selfSignedCertificate(stateDir string, hosts []string) (tls.Certificate, error) {
+	certPath := filepath.Join(stateDir, selfSignedCertFileName)
+	keyPath := filepath.Join(stateDir, selfSignedKeyFileName)
+	if stateDir != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		switch {
+		case err == nil && clk.Now().Add(selfSignedRenewBefore).Before(cert.Leaf.NotAfter):
+			return cert, nil
+		case err == nil:
+			slog.Info("Self-signed HTTP API certificate expires soon, replacing it", "expires", cert.Leaf.NotAfter.Format(time.DateOnly))
+		case !errors.Is(err, os.ErrNotExist):
+			slog.Warn("Stored self-signed HTTP API certificate unusable, replacing it", "error", err)
+		}
+	}
+
+	certPEM, keyPEM, err := generateSelfSigned(hosts)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if stateDir != "" {
+		if err := writeFileAtomic(keyPath, keyPEM, 0o600); err != nil {
+			return tls.Certificate{}, err
+		}
+		if err := writeFileAtomic(certPath, certPEM, 0o644); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// generateSelfSigned returns a PEM certificate and key (ECDSA P-256) valid
+// for hosts.
+func generateSelfSigned(hosts []string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := clk.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "sms-to-telegram"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// loopbackListen reports whether addr only accepts local connections.
+func loopbackListen(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,164 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSelfSignedCertificate(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	dir := t.TempDir()
+	hosts := []string{"localhost", "127.0.0.1", "gw.lan"}
+
+	first, err := selfSignedCertificate(dir, hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := first.Leaf
+	if len(leaf.IPAddresses) != 1 || len(leaf.DNSNames) != 2 || leaf.VerifyHostname("gw.lan") != nil {
+		t.Errorf("names: %v %v", leaf.DNSNames, leaf.IPAddresses)
+	}
+	info, err := os.Stat(filepath.Join(dir, selfSignedKeyFileName))
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("key file: %v, %v", info, err)
+	}
+
+	// Kept across restarts, so the fingerprint can be pinned ...
+	again, err := selfSignedCertificate(dir, hosts)
+	if err != nil || !bytes.Equal(again.Leaf.Raw, leaf.Raw) {
+		t.Fatalf("restart made a new certificate (%v)", err)
+	}
+	// ... until it is about to expire.
+	clock.Advance(selfSignedValidity - selfSignedRenewBefore + time.Hour)
+	renewed, err := selfSignedCertificate(dir, hosts)
+	if err != nil || bytes.Equal(renewed.Leaf.Raw, leaf.Raw) {
+		t.Fatalf("certificate not renewed (%v)", err)
+	}
+	// Without STATE_DIR nothing is written.
+	if _, err := selfSignedCertificate("", hosts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	install := func(modTime time.Time) []byte {
+		certPEM, keyPEM, err := generateSelfSigned([]string{"localhost"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for path, data := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+			if err := os.WriteFile(path, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			os.Chtimes(path, modTime, modTime)
+		}
+		block, _ := tls.X509KeyPair(certPEM, keyPEM)
+		return block.Leaf.Raw
+	}
+	served := func(r *certReloader) []byte {
+		cert, err := r.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.Leaf.Raw
+	}
+
+	base := time.Now()
+	first := install(base)
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := install(base.Add(time.Hour))
+	if !bytes.Equal(served(reloader), first) {
+		t.Error("files checked again before certCheckInterval")
+	}
+	clock.Advance(certCheckInterval)
+	if !bytes.Equal(served(reloader), second) {
+		t.Error("renewed certificate not picked up")
+	}
+
+	// A half-written renewal keeps the working certificate.
+	os.WriteFile(certFile, []byte("garbage"), 0o600)
+	os.Chtimes(certFile, base.Add(2*time.Hour), base.Add(2*time.Hour))
+	clock.Advance(certCheckInterval)
+	if !bytes.Equal(served(reloader), second) {
+		t.Error("broken certificate replaced the working one")
+	}
+
+	if _, err := newCertReloader(certFile, keyFile); err == nil {
+		t.Error("newCertReloader() accepted a broken certificate")
+	}
+}
+
+func TestAPIServer_TLS(t *testing.T) {
+	tlsConfig, err := newHTTPTLSConfig(HTTPTLSOptions{SelfSigned: true}, "", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewAPIServer(nil, NewHealthState(nil), nil)
+	api.tls = tlsConfig
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- api.Serve(ctx, ln) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(tlsConfig.Certificates[0].Leaf)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	resp, err := client.Get("https://" + ln.Addr().String() + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+		t.Errorf("status = %d, TLS = %v", resp.StatusCode, resp.TLS != nil)
+	}
+
+	// Plain HTTP gets no answer from the API.
+	if resp, err := http.Get("http://" + ln.Addr().String() + "/healthz"); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Error("plain HTTP served")
+		}
+	}
+}
+
+func TestLoopbackListen(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:8080":     true,
+		"[::1]:8080":         true,
+		"localhost:8080":     true,
+		":8080":              false,
+		"0.0.0.0:8080":       false,
+		"192.168.1.10:8080":  false,
+		"gw.example.com:443": false,
+	} {
+		if got := loopbackListen(addr); got != want {
+			t.Errorf("loopbackListen(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
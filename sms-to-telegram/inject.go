@@ -0,0 +1,233 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
+)
+
+// Synthetic SMS for staging (INJECT_API): POST /api/v1/inject stores PDUs in
+// virtual SIM slots that the next listing shows after the real ones. From
+// there they take the path of a received SMS — decoding, multipart
+// assembly, rules, routing, every sink, retries — and deleting their slot
+// removes them, in DRY_RUN too.
+
+const (
+	// injectBaseIndex is the first virtual slot, far above any SIM or modem
+	// storage index.
+	injectBaseIndex = 10000
+	// injectMaxWaiting caps the injected PDUs not yet delivered.
+	injectMaxWaiting = 100
+)
+
+// errInjectFull is returned while injectMaxWaiting PDUs wait.
+var errInjectFull = errors.New("too many injected SMS waiting")
+
+// errInjectTextMode refuses injection in a text-mode session: its listing
+// shows no PDUs, so injected SMS would never be listed.
+var errInjectTextMode = errors.New("modem is in text mode: injected SMS would not be listed")
+
+// Injector holds the injected PDUs by virtual slot. The HTTP API adds them,
+// the modem goroutine lists and releases them.
+type Injector struct {
+	mu    sync.Mutex
+	next  int
+	ref   byte // concatenation reference of the next multipart text
+	slots map[int]string
+	// textMode: the modem session lists in text mode (errInjectTextMode).
+	textMode bool
+}
+
+func NewInjector() *Injector {
+	return &Injector{next: injectBaseIndex, slots: make(map[int]string)}
+}
+
+// isInjected reports whether pending came from the Injector.
+func isInjected(pending PendingSMS) bool {
+	return len(pending.PartIndices) > 0 && pending.PartIndices[0] >= injectBaseIndex
+}
+
+// InjectPDUs stores hex PDUs as listed by the modem (with the SMSC prefix),
+// one slot each; the parts of a multipart SMS are assembled once all are
+// there. Undecodable content is accepted, so the raw-hex fallback can be
+// exercised too; only framing that would fail the whole listing is
+// rejected.
+func (inj *Injector) InjectPDUs(pdus []string) ([]int, error) {
+	if len(pdus) == 0 {
+		return nil, errors.New("no PDUs")
+	}
+	lines := make([]string, len(pdus))
+	for i, raw := range pdus {
+		raw = strings.ToUpper(strings.TrimSpace(raw))
+		if err := checkListable(raw); err != nil {
+			return nil, fmt.Errorf("PDU %d: %w", i+1, err)
+		}
+		lines[i] = raw
+	}
+	return inj.store(lines)
+}
+
+// InjectText encodes text from a phone number as SMS-DELIVER PDUs, split
+// into a multipart SMS when it does not fit one.
+func (inj *Injector) InjectText(from, text string) ([]int, error) {
+	inj.mu.Lock()
+	inj.ref++
+	ref := inj.ref
+	inj.mu.Unlock()
+	pdus, err := encodeDeliverText(from, text, ref)
+	if err != nil {
+		return nil, err
+	}
+	return inj.store(pdus)
+}
+
+// encodeDeliverText encodes text from a phone number as the SMS-DELIVER
+// PDUs a modem would list, with ref as the concatenation reference of a
+// multipart SMS.
+func encodeDeliverText(from, text string, ref byte) ([]string, error) {
+	if !validDestination(from) {
+		return nil, fmt.Errorf("sender %q is not a phone number (inject an alphanumeric sender as a PDU)", from)
+	}
+	parts, ucs2, err := pdu.SplitForSubmit(text)
+	if err != nil {
+		return nil, err
+	}
+	pdus := make([]string, len(parts))
+	for i, part := range parts {
+		var concat *pdu.Concat
+		if len(parts) > 1 {
+			concat = &pdu.Concat{Ref: int(ref), Total: len(parts), Part: i + 1}
+		}
+		if pdus[i], err = pdu.EncodeDeliver(from, part, ucs2, concat); err != nil {
+			return nil, err
+		}
+	}
+	return pdus, nil
+}
+
+func (inj *Injector) store(pdus []string) ([]int, error) {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	if inj.textMode {
+		return nil, errInjectTextMode
+	}
+	if len(inj.slots)+len(pdus) > injectMaxWaiting {
+		return nil, errInjectFull
+	}
+	slots := make([]int, len(pdus))
+	for i, raw := range pdus {
+		slots[i] = inj.next
+		inj.slots[inj.next] = raw
+		inj.next++
+	}
+	slog.Info("Injected synthetic SMS", "slots", slots)
+	return slots, nil
+}
+
+// checkListable reports whether raw can stand in a PDU-mode listing: a
+// framing error there would fail the listing of every other SMS.
+func checkListable(raw string) error {
+	header, err := cmglHeader(0, raw)
+	if err == nil {
+		_, err = pdu.ParseListing([]string{header, raw})
+	}
+	return err
+}
+
+// cmglHeader is the +CMGL line a modem would print before raw.
+func cmglHeader(index int, raw string) (string, error) {
+	if len(raw) < 2 {
+		return "", errors.New("too short")
+	}
+	smscLen, err := strconv.ParseUint(raw[:2], 16, 8)
+	if err != nil {
+		return "", errors.New("not hex")
+	}
+	tpduLen := len(raw)/2 - int(smscLen) - 1
+	if tpduLen <= 0 {
+		return "", errors.New("no TPDU after the SMSC")
+	}
+	return fmt.Sprintf("+CMGL: %d,0,,%d", index, tpduLen), nil
+}
+
+// setTextMode records whether the modem session lists in text mode. SMS
+// injected before wait for the next PDU-mode session. Nil-safe.
+func (inj *Injector) setTextMode(on bool) {
+	if inj == nil {
+		return
+	}
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	inj.textMode = on
+	if on && len(inj.slots) > 0 {
+		slog.Warn("Modem is in text mode: injected SMS wait for a PDU-mode session", "waiting", len(inj.slots))
+	}
+}
+
+// listing returns the +CMGL lines of the waiting injected PDUs. Nil-safe.
+func (inj *Injector) listing() []string {
+	if inj == nil {
+		return nil
+	}
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	var lines []string
+	for _, index := range slices.Sorted(maps.Keys(inj.slots)) {
+		raw := inj.slots[index]
+		header, _ := cmglHeader(index, raw) // validated when stored
+		lines = append(lines, header, raw)
+	}
+	return lines
+}
+
+// release removes the virtual slots among indices and returns the real
+// ones, which are left to AT+CMGD. Nil-safe.
+func (inj *Injector) release(indices []int) []int {
+	if inj == nil {
+		return indices
+	}
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	var real []int
+	for _, index := range indices {
+		if index < injectBaseIndex {
+			real = append(real, index)
+			continue
+		}
+		delete(inj.slots, index)
+	}
+	return real
+}
+
+// commander wraps modem so that its SIM listing includes the injected SMS.
+// Nil-safe: without an Injector it returns modem itself.
+func (inj *Injector) commander(modem ATCommander) ATCommander {
+	if inj == nil {
+		return modem
+	}
+	return injectingCommander{ATCommander: modem, inj: inj}
+}
+
+type injectingCommander struct {
+	ATCommander
+	inj *Injector
+}
+
+func (c injectingCommander) CommandWithTimeout(cmd string, timeout time.Duration) ([]string, error) {
+	resp, err := c.ATCommander.CommandWithTimeout(cmd, timeout)
+	if err != nil || cmd != "AT+CMGL=4" {
+		return resp, err
+	}
+	return append(resp, c.inj.listing()...), nil
+}
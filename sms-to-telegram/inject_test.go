@@ -0,0 +1,181 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestInjector_Delivery: injected PDUs are listed after the real SMS, go
+// through the pipeline like them and leave with their slot, without AT+CMGD —
+// in DRY_RUN too.
+func TestInjector_Delivery(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	for _, dryRun := range []bool{false, true} {
+		modem := newFakeAT()
+		modem.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 5,1,,29", testPDUSingle}), nil)
+		cfg := testConfig()
+		cfg.DryRun = dryRun
+		deliverer, sender, _ := newTestDeliverer(cfg)
+		deliverer.injector = NewInjector()
+		slots, err := deliverer.injector.InjectPDUs([]string{pduAlphaSender, pduGSM7Part1, pduGSM7Part2})
+		if err != nil || !slices.Equal(slots, []int{injectBaseIndex, injectBaseIndex + 1, injectBaseIndex + 2}) {
+			t.Fatalf("InjectPDUs() = %v, %v", slots, err)
+		}
+
+		if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+			t.Fatalf("processMessages() error = %v", err)
+		}
+		// DRY_RUN only logs what Telegram would get.
+		if got := sender.sentTo(100); !dryRun && (len(got) != 3 || !strings.Contains(got[1].Text, "Google") || !strings.Contains(got[2].Text, "HelloWorld")) {
+			t.Fatalf("chat 100 got %+v, want the SIM SMS then Google and HelloWorld", got)
+		}
+		if lines := deliverer.injector.listing(); len(lines) != 0 {
+			t.Errorf("DRY_RUN=%v: injected SMS still listed: %v", dryRun, lines)
+		}
+		for _, cmd := range []string{"AT+CMGD=10000", "AT+CMGD=10001", "AT+CMGD=10002"} {
+			if n := modem.commandCount(cmd); n != 0 {
+				t.Errorf("%s sent to the modem", cmd)
+			}
+		}
+		wantDeletes := 1
+		if dryRun {
+			wantDeletes = 0
+		}
+		if n := modem.commandCount("AT+CMGD=5"); n != wantDeletes {
+			t.Errorf("DRY_RUN=%v: AT+CMGD=5 sent %d times, want %d", dryRun, n, wantDeletes)
+		}
+	}
+}
+
+// TestInjector_Text: a long text becomes a multipart SMS that is
+// reassembled, and the same text can be injected again.
+func TestInjector_Text(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	cfg := testConfig()
+	deliverer, sender, _ := newTestDeliverer(cfg)
+	deliverer.delivered = NewDeliveredStore(t.TempDir())
+	deliverer.injector = NewInjector()
+	text := strings.Repeat("staging ", 30)
+
+	for round := 1; round <= 2; round++ {
+		slots, err := deliverer.injector.InjectText("+15550001234", text)
+		if err != nil || len(slots) != 2 {
+			t.Fatalf("InjectText() = %v, %v; want two parts", slots, err)
+		}
+		if err := processMessages(context.Background(), newFakeAT(), deliverer, cfg, 30); err != nil {
+			t.Fatalf("processMessages() error = %v", err)
+		}
+		got := sender.sentTo(100)
+		if len(got) != round || !strings.Contains(got[round-1].Text, strings.TrimSpace(text)) {
+			t.Fatalf("round %d: chat 100 got %d messages, want the assembled text", round, len(got))
+		}
+	}
+}
+
+func TestInjector_Rejects(t *testing.T) {
+	inj := NewInjector()
+	for _, pdus := range [][]string{nil, {"zz"}, {"07915348748943"}, {testPDUSingle, "00"}} {
+		if _, err := inj.InjectPDUs(pdus); err == nil {
+			t.Errorf("InjectPDUs(%q) accepted", pdus)
+		}
+	}
+	if _, err := inj.InjectText("Bank", "hi"); err == nil {
+		t.Error("InjectText() accepted an alphanumeric sender")
+	}
+	if lines := inj.listing(); len(lines) != 0 {
+		t.Errorf("rejected PDUs listed: %v", lines)
+	}
+
+	for range injectMaxWaiting {
+		if _, err := inj.InjectPDUs([]string{testPDUSingle}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := inj.InjectPDUs([]string{testPDUSingle}); err != errInjectFull {
+		t.Errorf("InjectPDUs() past the cap = %v, want errInjectFull", err)
+	}
+}
+
+// A text-mode listing shows no PDUs: injection is refused until the next
+// PDU-mode session.
+func TestInjector_TextMode(t *testing.T) {
+	inj := NewInjector()
+	if _, err := inj.InjectText("+15550001234", "before"); err != nil {
+		t.Fatal(err)
+	}
+	inj.setTextMode(true)
+	if _, err := inj.InjectText("+15550001234", "hello"); err != errInjectTextMode {
+		t.Errorf("InjectText() in text mode = %v, want errInjectTextMode", err)
+	}
+	if _, err := inj.InjectPDUs([]string{testPDUSingle}); err != errInjectTextMode {
+		t.Errorf("InjectPDUs() in text mode = %v, want errInjectTextMode", err)
+	}
+	if lines := inj.listing(); len(lines) != 2 {
+		t.Errorf("listing = %q, want only the SMS injected before", lines)
+	}
+
+	api := NewAPIServer(nil, NewHealthState(nil), NewAPIAuth("", nil, nil))
+	api.EnableInject(inj)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/inject", strings.NewReader(`{"from":"+15550001234","text":"hello"}`)))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("POST in text mode = %d %s, want 409", rec.Code, rec.Body)
+	}
+
+	inj.setTextMode(false)
+	if _, err := inj.InjectText("+15550001234", "after"); err != nil {
+		t.Errorf("InjectText() after text mode = %v", err)
+	}
+}
+
+func TestAPIServer_Inject(t *testing.T) {
+	api := NewAPIServer(nil, NewHealthState(nil), NewAPIAuth("s3cret", nil, nil))
+	api.EnableInject(NewInjector())
+	tests := []struct {
+		body  string
+		token string
+		want  int
+	}{
+		{`{"pdus":["` + testPDUSingle + `"]}`, "s3cret", http.StatusAccepted},
+		{`{"from":"+15550001234","text":"hello"}`, "s3cret", http.StatusAccepted},
+		{`{"from":"+15550001234","text":"hello"}`, "", http.StatusUnauthorized},
+		{`{"pdus":["00"]}`, "s3cret", http.StatusBadRequest},
+		{`{"pdus":["` + testPDUSingle + `"],"text":"x"}`, "s3cret", http.StatusBadRequest},
+		{`{"text":"no sender"}`, "s3cret", http.StatusBadRequest},
+		{`{"pdu":"typo"}`, "s3cret", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/inject", strings.NewReader(tt.body))
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("POST %s = %d %s, want %d", tt.body, rec.Code, rec.Body, tt.want)
+			continue
+		}
+		if rec.Code == http.StatusAccepted {
+			var resp struct{ Slots []int }
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Slots) != 1 {
+				t.Errorf("POST %s body = %s", tt.body, rec.Body)
+			}
+		}
+	}
+
+	// Without INJECT_API the endpoint does not exist.
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/inject", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	NewAPIServer(nil, NewHealthState(nil), nil).ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("POST without INJECT_API = %d, want 404", rec.Code)
+	}
+}
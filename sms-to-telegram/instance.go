@@ -0,0 +1,139 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Instance identity: fleets of gateways reporting into shared chats and
+// dashboards tell each other apart by more than the host name.
+// INSTANCE_NAME replaces the host name in every notification and payload;
+// INSTANCE_LABELS (site=hel1,rack=r2,sim=work) are shown after it in
+// Telegram, sent in the sink payloads and added to every metric.
+
+// Instance is the INSTANCE_NAME and INSTANCE_LABELS of this gateway.
+type Instance struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// instanceNamePattern keeps INSTANCE_NAME usable where the host name goes:
+// CloudEvents sources, Sentry server names.
+var instanceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// instanceLabelName is a Prometheus label name; "__" names are reserved.
+var instanceLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedInstanceLabels are the label names the metrics use themselves,
+// and the target labels Prometheus adds to every scraped series.
+var reservedInstanceLabels = []string{"command", "kind", "le", "storage", "version", "commit", "build_date", "goversion", "instance", "job"}
+
+// loadInstanceConfig reads INSTANCE_NAME and INSTANCE_LABELS; nil when both
+// are unset. Labels without a name take the host name.
+func loadInstanceConfig() (*Instance, error) {
+	name := strings.TrimSpace(os.Getenv("INSTANCE_NAME"))
+	labelsStr := os.Getenv("INSTANCE_LABELS")
+	if name == "" && labelsStr == "" {
+		return nil, nil
+	}
+	if name != "" && !instanceNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid INSTANCE_NAME %q: must be up to 64 letters, digits, '.', '_' or '-'", name)
+	}
+	labels, err := parseInstanceLabels(labelsStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid INSTANCE_LABELS: %w", err)
+	}
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	if name == "" {
+		name = "unknown"
+	}
+	return &Instance{Name: name, Labels: labels}, nil
+}
+
+// parseInstanceLabels reads a comma-separated key=value list.
+func parseInstanceLabels(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch {
+		case !ok || value == "":
+			return nil, fmt.Errorf("%q: want key=value", item)
+		case !instanceLabelName.MatchString(key) || strings.HasPrefix(key, "__"):
+			return nil, fmt.Errorf("%q: not a valid label name", key)
+		case slices.Contains(reservedInstanceLabels, key):
+			return nil, fmt.Errorf("%q: reserved label name", key)
+		case strings.ContainsFunc(value, func(r rune) bool { return r < ' ' }):
+			return nil, fmt.Errorf("%q: control character in the value", key)
+		}
+		if _, dup := labels[key]; dup {
+			return nil, fmt.Errorf("%q: duplicate label", key)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// String is the name and labels for the startup log; "" for a nil
+// instance.
+func (i *Instance) String() string {
+	if i == nil {
+		return ""
+	}
+	pairs := i.labelPairs()
+	var labels []string
+	for j := 0; j+1 < len(pairs); j += 2 {
+		labels = append(labels, pairs[j]+"="+pairs[j+1])
+	}
+	return strings.TrimSpace(i.Name + " " + strings.Join(labels, ","))
+}
+
+// labelPairs returns the labels as name, value pairs sorted by name, the
+// form the metrics take; nil for a nil instance.
+func (i *Instance) labelPairs() []string {
+	if i == nil {
+		return nil
+	}
+	var pairs []string
+	for _, key := range slices.Sorted(maps.Keys(i.Labels)) {
+		pairs = append(pairs, key, i.Labels[key])
+	}
+	return pairs
+}
+
+// formatInstance renders a host or instance name and its labels for
+// Telegram: "<code>gw-hel1</code> rack=r2 · site=hel1".
+func formatInstance(name string, instance *Instance) string {
+	s := "<code>" + escapeHTML(name) + "</code>"
+	pairs := instance.labelPairs()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i == 0 {
+			s += " "
+		} else {
+			s += " · "
+		}
+		s += escapeHTML(pairs[i] + "=" + pairs[i+1])
+	}
+	return s
+}
+
+// formatInstanceLine renders the Instance line of a forwarded SMS; "" when
+// INSTANCE_* is unset.
+func formatInstanceLine(instance *Instance) string {
+	if instance == nil {
+		return ""
+	}
+	return "<b>Instance:</b> " + formatInstance(instance.Name, instance) + "\n"
+}
@@ -0,0 +1,99 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoadInstanceConfig(t *testing.T) {
+	hostname, _ := os.Hostname()
+	tests := []struct {
+		name, labels string
+		want         string // Instance.String(); "" for nil
+		wantErr      bool
+	}{
+		{want: ""},
+		{name: "gw-hel1", want: "gw-hel1"},
+		{name: "gw-hel1", labels: "site=hel1, sim=work", want: "gw-hel1 sim=work,site=hel1"},
+		{labels: "rack=r2", want: hostname + " rack=r2"},
+		{name: "gw hel1", wantErr: true},
+		{name: strings.Repeat("g", 65), wantErr: true},
+		{labels: "site", wantErr: true},
+		{labels: "site=", wantErr: true},
+		{labels: "2site=hel1", wantErr: true},
+		{labels: "__name__=x", wantErr: true},
+		{labels: "instance=gw", wantErr: true},
+		{labels: "storage=SM", wantErr: true},
+		{labels: "site=hel1,site=hel2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv("INSTANCE_NAME", tt.name)
+		t.Setenv("INSTANCE_LABELS", tt.labels)
+		got, err := loadInstanceConfig()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("INSTANCE_NAME=%q INSTANCE_LABELS=%q: error %v, want error %v", tt.name, tt.labels, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.String() != tt.want {
+			t.Errorf("INSTANCE_NAME=%q INSTANCE_LABELS=%q: %q, want %q", tt.name, tt.labels, got.String(), tt.want)
+		}
+	}
+}
+
+// TestInstance_Everywhere: alerts, forwarded SMS, sink payloads and
+// metrics all carry the instance.
+func TestInstance_Everywhere(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	instance := &Instance{Name: "gw-hel1", Labels: map[string]string{"site": "hel1", "sim": "work<1>"}}
+	const shown = "<code>gw-hel1</code> sim=work&lt;1&gt; · site=hel1"
+
+	cfg := testConfig()
+	cfg.Instance = instance
+	deliverer, sender, _ := newTestDeliverer(cfg)
+	sink := &fakeSink{name: "webhook"}
+	deliverer.AddSink(sink)
+	pending := PendingSMS{Message: SMSMessage{Index: 1, From: "+358401234567", Text: "hi"}, PartIndices: []int{1}}
+	if got := deliverer.Deliver(context.Background(), pending); got != deliveryDone {
+		t.Fatalf("Deliver() = %v, want deliveryDone", got)
+	}
+	if len(sender.sent) == 0 || !strings.Contains(sender.sent[0].Text, "<b>Instance:</b> "+shown+"\n") {
+		t.Errorf("SMS messages %+v, want the instance line", sender.sent)
+	}
+	body, err := json.Marshal(newSMSPayload(sink.sent[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"instance":{"name":"gw-hel1","labels":{"sim":"work\u003c1\u003e","site":"hel1"}}`; !strings.Contains(string(body), want) {
+		t.Errorf("payload %s, want %s", body, want)
+	}
+
+	notifier := NewErrorNotifier(sender, []int64{1}, false, instance.Name, 0)
+	notifier.instance = instance
+	notifier.CheckStorage(context.Background(), 19, 20)
+	if last := sender.sent[len(sender.sent)-1].Text; !strings.Contains(last, "<b>Host:</b> "+shown+"\n") {
+		t.Errorf("alert %q, want the instance on the Host line", last)
+	}
+
+	metrics := NewMetrics()
+	metrics.labels = instance.labelPairs()
+	metrics.StoragesSampled([]SIMStorage{{Name: "SM", Used: 3, Total: 20}})
+	out := scrapeMetrics(t, metrics)
+	for _, want := range []string{
+		`sms_to_telegram_sim_storage_used{storage="SM",sim="work<1>",site="hel1"} 3`,
+		`sms_to_telegram_seconds_since_last_sms{sim="work<1>",site="hel1"} `,
+		`sms_to_telegram_build_info{version="`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("/metrics lacks %s:\n%s", want, out)
+		}
+	}
+	if !strings.Contains(out, `goversion="`+currentBuildInfo().GoVersion+`",sim="work<1>",site="hel1"} 1`) {
+		t.Errorf("build_info without the instance labels:\n%s", out)
+	}
+}
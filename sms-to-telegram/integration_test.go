@@ -0,0 +1,170 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+// The integration test runs the whole service (run) against a scripted modem
+// behind a pty and a mock Bot API: the serial port, the AT transcript and the
+// HTTP requests are real, only the hardware and Telegram are not.
+
+// openTestPTY opens a pty (see openPTY) closed with the test.
+func openTestPTY(t *testing.T) (*os.File, string) {
+	t.Helper()
+	master, slave, err := openPTY()
+	if err != nil {
+		t.Skipf("%v", err)
+	}
+	t.Cleanup(func() { master.Close() })
+	return master, slave
+}
+
+func (m *ptyModem) slotCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.slots)
+}
+
+func (m *ptyModem) commandCount(cmd string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.commands[cmd]
+}
+
+// mockBotAPI records the messages sent through the Bot API and accepts
+// every other method.
+type mockBotAPI struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (a *mockBotAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if path.Base(r.URL.Path) == "sendMessage" {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.mu.Lock()
+		a.sent = append(a.sent, r.FormValue("text"))
+		a.mu.Unlock()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":100,"type":"private"},"id":100,"type":"private"}}`)
+}
+
+// indexOf returns the position of the first sent message containing s, or -1.
+func (a *mockBotAPI) indexOf(s string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return slices.IndexFunc(a.sent, func(text string) bool { return strings.Contains(text, s) })
+}
+
+// fastClock runs the service's waits (modem reset, retry backoff) a hundred
+// times faster; AT deadlines keep real time.
+type fastClock struct{}
+
+func (fastClock) Now() time.Time                         { return time.Now() }
+func (fastClock) After(d time.Duration) <-chan time.Time { return time.After(d / 100) }
+func (fastClock) Sleep(d time.Duration)                  { time.Sleep(d / 100) }
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// TestIntegration_RunLoop: the service starts while the modem has not read a
+// hot-inserted SIM yet, alerts, resets the modem and recovers, then forwards
+// the single and multipart SMS waiting on the SIM and deletes them, and keeps
+// polling for new ones.
+func TestIntegration_RunLoop(t *testing.T) {
+	if testing.Short() {
+		t.Skip("integration test")
+	}
+	master, slave := openTestPTY(t)
+	modem := newPTYModem(master)
+	modem.simInserted = true
+	modem.store(1, testPDUSingle)
+	modem.store(3, pduGSM7Part1)
+	modem.store(4, pduGSM7Part2)
+	go modem.serve()
+
+	api := &mockBotAPI{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	oldBot := newTelegramBot
+	newTelegramBot = func(token string, opts ...bot.Option) (*bot.Bot, error) {
+		return oldBot(token, append(opts, bot.WithServerURL(srv.URL))...)
+	}
+	defer func() { newTelegramBot = oldBot }()
+
+	clearConfigEnv(t)
+	t.Setenv("TELEGRAM_BOT_TOKEN", "123:abc")
+	t.Setenv("TELEGRAM_CHAT_IDS", "100")
+	t.Setenv("SERIAL_PORT", slave)
+	t.Setenv("STATE_DIR", t.TempDir())
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	cfg.PollInterval = 50 * time.Millisecond
+
+	restoreClock := swapClock(fastClock{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- run(ctx, cfg, nil) }()
+	defer func() {
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("run() error = %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Error("run() did not return after cancellation")
+		}
+		restoreClock()
+	}()
+
+	waitFor(t, "the SIM to be emptied", func() bool { return modem.slotCount() == 0 })
+	waitFor(t, "the multipart SMS", func() bool { return api.indexOf("HelloWorld") >= 0 })
+	alert, recovered := api.indexOf("SIM Not Detected"), api.indexOf("SMS Gateway Recovered")
+	single, multi := api.indexOf("Тест1"), api.indexOf("HelloWorld")
+	if alert < 0 || alert > recovered || recovered > single || single > multi {
+		t.Errorf("message order: alert %d, recovery %d, single %d, multipart %d; want increasing",
+			alert, recovered, single, multi)
+	}
+	if modem.commandCount("AT+CFUN=1") == 0 {
+		t.Error("modem not reset after the SIM alert")
+	}
+	for _, cmd := range []string{"AT+CMGD=1", "AT+CMGD=3", "AT+CMGD=4"} {
+		if n := modem.commandCount(cmd); n != 1 {
+			t.Errorf("%s called %d times, want 1", cmd, n)
+		}
+	}
+
+	modem.store(2, pduAlphaSender)
+	waitFor(t, "the new SMS", func() bool { return api.indexOf("Google") >= 0 && modem.slotCount() == 0 })
+}
@@ -0,0 +1,118 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// KafkaOptions configures the Kafka sink (KAFKA_* variables). The native
+// Kafka protocol needs a full client library (metadata, leader discovery,
+// record batches); the gateway instead produces through a Kafka REST Proxy
+// (Confluent v2 API, also served by Redpanda's HTTP proxy).
+type KafkaOptions struct {
+	RESTURL string // proxy base URL, e.g. http://kafka-rest:8082
+	Topic   string
+	// KeyBySender sets the record key to the SMS sender, so all SMS from one
+	// sender land in the same partition (ordered).
+	KeyBySender bool
+}
+
+type kafkaRecord struct {
+	Key   *string    `json:"key"`
+	Value SMSPayload `json:"value"`
+}
+
+// kafkaProduceResponse reports per-record errors next to a 200 status.
+type kafkaProduceResponse struct {
+	Offsets []struct {
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+// KafkaSink produces every SMS as one JSON record. 400, 413, 415 and 422 are
+// permanent rejections, like the webhook; everything else is retried.
+type KafkaSink struct {
+	opts   KafkaOptions
+	client *http.Client
+	dryRun bool
+}
+
+func NewKafkaSink(opts KafkaOptions, cfg *Config) *KafkaSink {
+	return &KafkaSink{
+		opts:   opts,
+		client: &http.Client{Timeout: cfg.WebhookTimeout},
+		dryRun: cfg.DryRun,
+	}
+}
+
+func (k *KafkaSink) Name() string { return "kafka" }
+
+func (k *KafkaSink) Send(ctx context.Context, pending PendingSMS) error {
+	rec := kafkaRecord{Value: newSMSPayload(pending)}
+	if k.opts.KeyBySender {
+		from := pending.Message.From
+		rec.Key = &from
+	}
+	body, err := json.Marshal(map[string][]kafkaRecord{"records": {rec}})
+	if err != nil {
+		return fmt.Errorf("%w: encoding payload: %v", errSinkRejected, err)
+	}
+	if k.dryRun {
+		slog.InfoContext(ctx, "DRY_RUN: Would produce to Kafka", "topic", k.opts.Topic, "bytes", len(body))
+		return nil
+	}
+
+	endpoint := strings.TrimRight(k.opts.RESTURL, "/") + "/topics/" + url.PathEscape(k.opts.Topic)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("building Kafka request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("Kafka %s: %w", redactURL(k.opts.RESTURL), err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	switch status := resp.StatusCode; {
+	case status >= 200 && status < 300:
+	case status == http.StatusBadRequest, status == http.StatusRequestEntityTooLarge,
+		status == http.StatusUnsupportedMediaType, status == http.StatusUnprocessableEntity:
+		return fmt.Errorf("%w: Kafka %s: HTTP %d", errSinkRejected, redactURL(k.opts.RESTURL), status)
+	default:
+		return fmt.Errorf("Kafka %s: HTTP %d", redactURL(k.opts.RESTURL), status)
+	}
+
+	var produced kafkaProduceResponse
+	if err := json.Unmarshal(respBody, &produced); err != nil {
+		return fmt.Errorf("Kafka: parsing produce response: %w", err)
+	}
+	for _, o := range produced.Offsets {
+		if o.ErrorCode != nil {
+			// Per-record failures (leader not available, timeouts) are
+			// broker-side and retryable.
+			return fmt.Errorf("Kafka: record not produced: error %d: %s", *o.ErrorCode, o.Error)
+		}
+	}
+	slog.DebugContext(ctx, "Produced SMS to Kafka", "topic", k.opts.Topic)
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKafkaSink_Produce(t *testing.T) {
+	var path, contentType string
+	var body struct {
+		Records []struct {
+			Key   *string
+			Value SMSPayload
+		}
+	}
+	response := `{"offsets":[{"partition":0,"offset":7,"error_code":null,"error":null}]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(response))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.WebhookTimeout = time.Second
+	pending := PendingSMS{Message: SMSMessage{From: "+100", Text: "code 1234"}, PartIndices: []int{1}}
+
+	sink := NewKafkaSink(KafkaOptions{RESTURL: srv.URL + "/", Topic: "sms", KeyBySender: true}, cfg)
+	if err := sink.Send(context.Background(), pending); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if path != "/topics/sms" || contentType != "application/vnd.kafka.json.v2+json" {
+		t.Errorf("request = %s (%s)", path, contentType)
+	}
+	if len(body.Records) != 1 || body.Records[0].Key == nil || *body.Records[0].Key != "+100" ||
+		body.Records[0].Value.Text != "code 1234" {
+		t.Errorf("records = %+v", body.Records)
+	}
+
+	sink.opts.KeyBySender = false
+	if err := sink.Send(context.Background(), pending); err != nil || body.Records[0].Key != nil {
+		t.Errorf("KAFKA_KEY=none: error %v, key %v; want a null key", err, body.Records[0].Key)
+	}
+
+	// A 200 can still carry per-record failures: retry.
+	response = `{"offsets":[{"partition":null,"offset":null,"error_code":50003,"error":"leader not available"}]}`
+	if err := sink.Send(context.Background(), pending); err == nil || errors.Is(err, errSinkRejected) {
+		t.Errorf("record error: Send() error = %v, want transient", err)
+	}
+}
+
+func TestKafkaSink_StatusClassification(t *testing.T) {
+	for _, tt := range []struct {
+		status       int
+		wantRejected bool
+	}{
+		{http.StatusUnprocessableEntity, true},
+		{http.StatusNotFound, false},
+		{http.StatusServiceUnavailable, false},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		cfg := testConfig()
+		cfg.WebhookTimeout = time.Second
+		err := NewKafkaSink(KafkaOptions{RESTURL: srv.URL, Topic: "sms"}, cfg).Send(context.Background(), PendingSMS{})
+		srv.Close()
+		if err == nil || errors.Is(err, errSinkRejected) != tt.wantRejected {
+			t.Errorf("HTTP %d: Send() error = %v, wantRejected %v", tt.status, err, tt.wantRejected)
+		}
+	}
+}
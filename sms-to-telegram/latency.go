@@ -0,0 +1,201 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Latency phases (LATENCY_REPORT), in the order an SMS goes through them;
+// each sink adds a "sink_<name>" phase after queue. "network" runs from the
+// SMSC timestamp to the listing that first showed the SMS: it includes the
+// delivery to the modem and the wait for the next poll, and is skewed by any
+// difference between the SMSC and host clocks. "wait" is the delivery time
+// not spent in a sink: retry delays, deferrals until the next poll and the
+// hand-back from the delivery queue.
+const (
+	phaseNetwork = "network"
+	phaseList    = "list"
+	phaseQueue   = "queue"
+	phaseWait    = "wait"
+	phaseDelete  = "delete"
+	phaseTotal   = "total"
+)
+
+// latencySamples bounds the samples kept per phase for the summary.
+const latencySamples = 1000
+
+// latencyTraceTTL drops traces of SMS that never finish (rejected, removed
+// from the SIM by hand).
+const latencyTraceTTL = 24 * time.Hour
+
+// latencyTrace is the timing of one SMS still on the SIM.
+type latencyTrace struct {
+	smsc     time.Time // SCTS; zero when invalid
+	detected time.Time // end of the listing that first showed the SMS
+	list     time.Duration
+	started  time.Time // first delivery attempt; zero until then
+	sinks    []sinkLatency
+}
+
+// sinkLatency is the time one sink spent in Send, summed over attempts.
+type sinkLatency struct {
+	name string
+	d    time.Duration
+}
+
+// LatencyTracker measures where the time between the SMSC and the deletion
+// from the SIM goes, per SMS and phase, to tune POLL_INTERVAL and the retry
+// settings. The modem goroutine reports detection and deletion, the delivery
+// goroutine the sink calls. Every finished SMS is logged with its phases and
+// a percentile summary is logged at shutdown. Nil-safe (LATENCY_REPORT off).
+type LatencyTracker struct {
+	mu      sync.Mutex
+	traces  map[string]*latencyTrace
+	samples map[string][]time.Duration
+}
+
+func NewLatencyTracker() *LatencyTracker {
+	return &LatencyTracker{traces: make(map[string]*latencyTrace), samples: make(map[string][]time.Duration)}
+}
+
+// Detected records that the listing which took list showed the SMS with key
+// at now. Only the first listing counts: later polls of a deferred SMS are
+// retries, not new arrivals.
+func (l *LatencyTracker) Detected(key string, smsc, now time.Time, list time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.traces[key]; ok {
+		return
+	}
+	for k, tr := range l.traces {
+		if now.Sub(tr.detected) > latencyTraceTTL {
+			delete(l.traces, k)
+		}
+	}
+	l.traces[key] = &latencyTrace{smsc: smsc, detected: now, list: list}
+}
+
+// SinkCalled records one Send of sink for the SMS with key, which began at
+// start and took d.
+func (l *LatencyTracker) SinkCalled(key, sink string, start time.Time, d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tr, ok := l.traces[key]
+	if !ok {
+		return
+	}
+	if tr.started.IsZero() {
+		tr.started = start
+	}
+	for i := range tr.sinks {
+		if tr.sinks[i].name == sink {
+			tr.sinks[i].d += d
+			return
+		}
+	}
+	tr.sinks = append(tr.sinks, sinkLatency{name: sink, d: d})
+}
+
+// Forget drops the trace of an SMS that will not be forwarded.
+func (l *LatencyTracker) Forget(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.traces, key)
+}
+
+// Deleted finishes the trace of a forwarded SMS whose SIM slots were freed
+// at now, the deletion having taken del, and logs its phases.
+func (l *LatencyTracker) Deleted(key string, indices []int, now time.Time, del time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tr, ok := l.traces[key]
+	if !ok {
+		return
+	}
+	delete(l.traces, key)
+
+	attrs := []any{"indices", indices}
+	add := func(phase string, d time.Duration) {
+		attrs = append(attrs, phase, d)
+		s := append(l.samples[phase], d)
+		if len(s) > latencySamples {
+			s = s[1:]
+		}
+		l.samples[phase] = s
+	}
+	if !tr.smsc.IsZero() && !tr.detected.Before(tr.smsc) {
+		add(phaseNetwork, tr.detected.Sub(tr.smsc))
+	}
+	add(phaseList, tr.list)
+	if !tr.started.IsZero() {
+		add(phaseQueue, tr.started.Sub(tr.detected))
+		// Sinks run one after another; the rest of the delivery time was
+		// spent waiting.
+		waiting := now.Sub(tr.started) - del
+		for _, s := range tr.sinks {
+			add("sink_"+s.name, s.d)
+			waiting -= s.d
+		}
+		add(phaseWait, max(waiting, 0))
+	}
+	add(phaseDelete, del)
+	add(phaseTotal, now.Sub(tr.detected))
+	slog.Info("SMS latency", attrs...)
+}
+
+// LogSummary logs the median, 95th percentile and maximum of every phase
+// over the last latencySamples SMS.
+func (l *LatencyTracker) LogSummary() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var sinks []string
+	for phase := range l.samples {
+		if strings.HasPrefix(phase, "sink_") {
+			sinks = append(sinks, phase)
+		}
+	}
+	slices.Sort(sinks)
+	phases := append(append([]string{phaseNetwork, phaseList, phaseQueue}, sinks...), phaseWait, phaseDelete, phaseTotal)
+	for _, phase := range phases {
+		if len(l.samples[phase]) == 0 {
+			continue
+		}
+		s := slices.Clone(l.samples[phase])
+		slices.Sort(s)
+		slog.Info("Latency summary",
+			"phase", phase,
+			"count", len(s),
+			"p50", percentile(s, 0.50),
+			"p95", percentile(s, 0.95),
+			"max", s[len(s)-1],
+		)
+	}
+}
+
+// percentile returns the nearest-rank percentile p of sorted, non-empty s.
+func percentile(s []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(s)))) - 1
+	return s[max(rank, 0)]
+}
@@ -0,0 +1,101 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// clockSink takes d of fake time per Send and fails the first failures
+// calls.
+type clockSink struct {
+	clock    *fakeClock
+	d        time.Duration
+	failures int
+}
+
+func (s *clockSink) Name() string { return "slow" }
+
+func (s *clockSink) Send(context.Context, PendingSMS) error {
+	s.clock.Advance(s.d)
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+	return nil
+}
+
+// TestLatencyTracker_Phases: a deferred SMS is timed from the first listing
+// that showed it; the sink time sums both attempts and the poll in between
+// counts as waiting.
+func TestLatencyTracker_Phases(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 5,1,,29", testPDUSingle}), nil)
+	cfg := testConfig()
+	deliverer, _, _ := newTestDeliverer(cfg)
+	tracker := NewLatencyTracker()
+	deliverer.latency = tracker
+	deliverer.AddSink(&clockSink{clock: clock, d: 2 * time.Second, failures: 1})
+
+	for range 2 {
+		if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+			t.Fatalf("processMessages() error = %v", err)
+		}
+		clock.Advance(10 * time.Second)
+	}
+	if n := modem.commandCount("AT+CMGD=5"); n != 1 {
+		t.Fatalf("AT+CMGD=5 called %d times, want 1", n)
+	}
+	want := map[string]time.Duration{
+		phaseQueue:  0,
+		"sink_slow": 4 * time.Second,
+		phaseWait:   10 * time.Second,
+		phaseTotal:  14 * time.Second,
+	}
+	for phase, d := range want {
+		if got := tracker.samples[phase]; len(got) != 1 || got[0] != d {
+			t.Errorf("%s samples = %v, want [%v]", phase, got, d)
+		}
+	}
+	if len(tracker.traces) != 0 {
+		t.Errorf("%d traces left after deletion", len(tracker.traces))
+	}
+	// The SMSC timestamp of the fixture is long before the fake clock.
+	if got := tracker.samples[phaseNetwork]; len(got) != 1 || got[0] <= 0 {
+		t.Errorf("network samples = %v, want one positive", got)
+	}
+}
+
+func TestLatencyTracker_NilSafe(t *testing.T) {
+	var tracker *LatencyTracker
+	tracker.Detected("k", time.Time{}, time.Now(), 0)
+	tracker.SinkCalled("k", "telegram", time.Now(), time.Second)
+	tracker.Deleted("k", nil, time.Now(), 0)
+	tracker.Forget("k")
+	tracker.LogSummary()
+}
+
+func TestPercentile(t *testing.T) {
+	s := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0.50, 5},
+		{0.95, 10},
+		{0.10, 1},
+		{0, 1},
+		{1, 10},
+	}
+	for _, tt := range tests {
+		if got := percentile(s, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
@@ -39,6 +39,9 @@ import (
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"github.com/tarm/serial"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
 )
 
 const (
@@ -67,7 +70,7 @@ func (r *recordingSender) SendMessage(ctx context.Context, params *bot.SendMessa
 
 type liveHarness struct {
 	t          *testing.T
-	modem      *SimpleAT
+	modem      *at.SimpleAT
 	cfg        *Config
 	deliverer  *Deliverer
 	recorder   *recordingSender
@@ -107,8 +110,8 @@ func setupLive(t *testing.T) *liveHarness {
 	}
 	t.Cleanup(func() { p.Close() })
 
-	modem := NewSimpleAT(p, 5*time.Second)
-	if _, _, err := initModemSession(modem); err != nil {
+	modem := at.NewSimpleAT(p, 5*time.Second)
+	if _, err := initModemSession(modem, []string{storageSM, storageME}, "", false); err != nil {
 		t.Fatalf("initModemSession: %v", err)
 	}
 	if err := runModemDiagnostics(context.Background(), modem, clk.Now(), 90*time.Second); err != nil {
@@ -120,7 +123,8 @@ func setupLive(t *testing.T) *liveHarness {
 		t.Fatalf("bot.New: %v", err)
 	}
 	recorder := &recordingSender{real: tgBot}
-	cfg := &Config{ChatIDs: []int64{chatID}, TelegramSendTimeout: 30 * time.Second}
+	cfg := &Config{ChatIDs: []int64{chatID}, TelegramSendTimeout: 30 * time.Second,
+		TelegramRetries: 2, TelegramRetryDelay: 5 * time.Second}
 	// Notifier in dry-run: harness failures go to the test log, not the chat.
 	notifier := NewErrorNotifier(nil, cfg.ChatIDs, true, "live-test", 30*time.Second)
 
@@ -139,11 +143,11 @@ func setupLive(t *testing.T) *liveHarness {
 
 // sendSelfSMS submits one PDU to the modem's own number and asserts the
 // network accepted it.
-func (h *liveHarness) sendSelfSMS(body string, ucs2 bool, concat *concatRef) {
+func (h *liveHarness) sendSelfSMS(body string, ucs2 bool, concat *pdu.Concat) {
 	h.t.Helper()
-	pduHex, tpduLen, err := encodeSubmitPDU(h.selfNumber, body, ucs2, concat)
+	pduHex, tpduLen, err := pdu.EncodeSubmit(h.selfNumber, body, ucs2, concat)
 	if err != nil {
-		h.t.Fatalf("encodeSubmitPDU: %v", err)
+		h.t.Fatalf("EncodeSubmit: %v", err)
 	}
 	resp, err := h.modem.CommandWithPrompt(fmt.Sprintf("AT+CMGS=%d", tpduLen), pduHex, liveSendTimeout)
 	if err != nil {
@@ -226,19 +230,19 @@ func (h *liveHarness) cleanup() {
 		h.t.Logf("cleanup: CMGL failed: %v", err)
 		return
 	}
-	records, err := parseCMGLTranscript(resp)
+	entries, err := pdu.ParseListing(resp)
 	if err != nil {
 		h.t.Logf("cleanup: %v", err)
 		return
 	}
-	for _, rec := range records {
-		pdu, parseErr := ParsePDU(rec.pduHex)
-		if parseErr != nil || !strings.Contains(pdu.Text, h.nonce) {
+	for _, entry := range entries {
+		msg, parseErr := pdu.Parse(entry.PDU)
+		if parseErr != nil || !strings.Contains(msg.Text, h.nonce) {
 			continue
 		}
-		h.t.Logf("cleanup: deleting leftover nonce slot %d", rec.index)
-		if err := deleteSMS(h.modem, rec.index); err != nil {
-			h.t.Logf("cleanup: delete %d failed: %v", rec.index, err)
+		h.t.Logf("cleanup: deleting leftover nonce slot %d", entry.Index)
+		if err := deleteSMS(h.modem, entry.Index); err != nil {
+			h.t.Logf("cleanup: delete %d failed: %v", entry.Index, err)
 		}
 	}
 }
@@ -291,7 +295,7 @@ func TestLive_MultipartAssembly(t *testing.T) {
 	}
 
 	for i, part := range parts {
-		h.sendSelfSMS(part, false, &concatRef{ref: ref, total: len(parts), part: i + 1})
+		h.sendSelfSMS(part, false, &pdu.Concat{Ref: ref, Total: len(parts), Part: i + 1})
 	}
 
 	pending := h.waitForNonce()
@@ -325,7 +329,7 @@ func TestLive_GSM7FinnishChars(t *testing.T) {
 
 // setupLiveModem is the lightweight variant of setupLive for tests that only
 // need the modem (no Telegram, no SMS cost): it requires just LIVE_SERIAL_PORT.
-func setupLiveModem(t *testing.T) *SimpleAT {
+func setupLiveModem(t *testing.T) *at.SimpleAT {
 	t.Helper()
 
 	portPath := os.Getenv("LIVE_SERIAL_PORT")
@@ -346,8 +350,8 @@ func setupLiveModem(t *testing.T) *SimpleAT {
 	}
 	t.Cleanup(func() { p.Close() })
 
-	modem := NewSimpleAT(p, 5*time.Second)
-	if _, _, err := initModemSession(modem); err != nil {
+	modem := at.NewSimpleAT(p, 5*time.Second)
+	if _, err := initModemSession(modem, []string{storageSM, storageME}, "", false); err != nil {
 		t.Fatalf("initModemSession: %v", err)
 	}
 	return modem
@@ -0,0 +1,194 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+// Low-power modes (LOW_POWER), after the SIM800 AT+CSCLK values: with dtr
+// the modem sleeps while DTR is released, with auto after a few idle
+// seconds on the UART.
+const (
+	lowPowerOff  = "off"
+	lowPowerDTR  = "dtr"
+	lowPowerAuto = "auto"
+)
+
+// The modem needs dtrWakeDelay after DTR is asserted before it takes
+// commands; autoWakeWait absorbs the answer to the dummy AT that wakes it.
+const (
+	dtrWakeDelay = 60 * time.Millisecond
+	autoWakeWait = 200 * time.Millisecond
+)
+
+// dtrLine drives the DTR line of a serial device through a descriptor of
+// its own: tarm/serial does not expose the port's, and the modem control
+// lines belong to the device.
+type dtrLine struct {
+	f *os.File
+}
+
+func openDTRLine(name string) (*dtrLine, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &dtrLine{f: f}, nil
+}
+
+// set asserts (on) or releases DTR.
+func (d *dtrLine) set(on bool) error {
+	req := uintptr(syscall.TIOCMBIC)
+	if on {
+		req = syscall.TIOCMBIS
+	}
+	bits := syscall.TIOCM_DTR
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, d.f.Fd(), req, uintptr(unsafe.Pointer(&bits))); errno != 0 {
+		return fmt.Errorf("setting DTR: %w", errno)
+	}
+	return nil
+}
+
+func (d *dtrLine) Close() error {
+	return d.f.Close()
+}
+
+// lowPowerAT is the modem session with LOW_POWER: once enabled, the modem
+// may sleep whenever the modem loop rests, and the first command after
+// that wakes it (DTR, or a dummy AT). Reading URCs does not wake it.
+type lowPowerAT struct {
+	*at.SimpleAT
+	mode    string
+	enabled bool
+	dtr     *dtrLine
+	// awake: woken since the last rest.
+	awake bool
+}
+
+// newLowPowerAT wraps a new session. The modem keeps AT+CSCLK across
+// sessions: with auto it may be asleep already, so the session starts with
+// a wake. Opening the port asserts DTR.
+func newLowPowerAT(modem *at.SimpleAT, mode string) *lowPowerAT {
+	return &lowPowerAT{SimpleAT: modem, mode: mode, awake: mode != lowPowerAuto}
+}
+
+// enable lets the modem sleep (AT+CSCLK). Only a transport error is
+// returned: a modem or port without sleep support keeps running awake.
+func (m *lowPowerAT) enable(port string) error {
+	if m.mode == lowPowerOff {
+		return nil
+	}
+	var dtr *dtrLine
+	cmd := "AT+CSCLK=2"
+	if m.mode == lowPowerDTR {
+		var err error
+		if dtr, err = openDTRLine(port); err != nil {
+			slog.Warn("Low-power mode unavailable: cannot drive DTR", "port", port, "error", err)
+			return nil
+		}
+		if err := dtr.set(true); err != nil {
+			dtr.Close()
+			slog.Warn("Low-power mode unavailable: cannot drive DTR", "port", port, "error", err)
+			return nil
+		}
+		cmd = "AT+CSCLK=1"
+	}
+	if _, err := m.Command(cmd); err != nil {
+		if dtr != nil {
+			dtr.Close()
+		}
+		if at.IsTimeoutError(err) {
+			return err
+		}
+		slog.Warn("Low-power mode unavailable: modem refused "+cmd, "error", err)
+		return nil
+	}
+	m.enabled, m.dtr = true, dtr
+	slog.Info("Low-power mode enabled", "mode", m.mode)
+	return nil
+}
+
+// rest lets the modem sleep until the next command.
+func (m *lowPowerAT) rest() error {
+	if !m.enabled || !m.awake {
+		return nil
+	}
+	m.awake = false
+	if m.mode == lowPowerDTR {
+		return m.dtr.set(false)
+	}
+	return nil
+}
+
+// wake wakes a resting modem.
+func (m *lowPowerAT) wake() error {
+	if m.awake {
+		return nil
+	}
+	switch m.mode {
+	case lowPowerDTR:
+		if err := m.dtr.set(true); err != nil {
+			// Without DTR the session cannot reach the modem.
+			return fmt.Errorf("%w: %v", at.ErrModemDisconnect, err)
+		}
+		clk.Sleep(dtrWakeDelay)
+	case lowPowerAuto:
+		if err := m.SimpleAT.Wake(autoWakeWait); err != nil {
+			return err
+		}
+	}
+	m.awake = true
+	return nil
+}
+
+// Close releases the DTR descriptor.
+func (m *lowPowerAT) Close() error {
+	if m.dtr == nil {
+		return nil
+	}
+	return m.dtr.Close()
+}
+
+func (m *lowPowerAT) Command(cmd string) ([]string, error) {
+	if err := m.wake(); err != nil {
+		return nil, err
+	}
+	return m.SimpleAT.Command(cmd)
+}
+
+func (m *lowPowerAT) CommandWithTimeout(cmd string, timeout time.Duration) ([]string, error) {
+	if err := m.wake(); err != nil {
+		return nil, err
+	}
+	return m.SimpleAT.CommandWithTimeout(cmd, timeout)
+}
+
+func (m *lowPowerAT) CommandSecret(cmd []byte, timeout time.Duration) ([]string, error) {
+	if err := m.wake(); err != nil {
+		return nil, err
+	}
+	return m.SimpleAT.CommandSecret(cmd, timeout)
+}
+
+func (m *lowPowerAT) CommandWithPrompt(cmd, payload string, timeout time.Duration) ([]string, error) {
+	if err := m.wake(); err != nil {
+		return nil, err
+	}
+	return m.SimpleAT.CommandWithPrompt(cmd, payload, timeout)
+}
+
+func (m *lowPowerAT) Ping() error {
+	if err := m.wake(); err != nil {
+		return err
+	}
+	return m.SimpleAT.Ping()
+}
@@ -0,0 +1,103 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+// answeringPort answers every command line with OK, or ERROR for the
+// refused ones, and records what was written.
+type answeringPort struct {
+	refused map[string]bool
+	writes  []string
+	pending []byte
+}
+
+func (p *answeringPort) Write(b []byte) (int, error) {
+	cmd := strings.TrimSpace(string(b))
+	p.writes = append(p.writes, cmd)
+	if p.refused[cmd] {
+		p.pending = append(p.pending, "ERROR\r\n"...)
+	} else {
+		p.pending = append(p.pending, "OK\r\n"...)
+	}
+	return len(b), nil
+}
+
+func (p *answeringPort) Read(b []byte) (int, error) {
+	if len(p.pending) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+func TestLowPowerAT(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	tests := []struct {
+		name    string
+		mode    string
+		refused string
+		// writes of: first command, enable, rest + command, ReadURCs,
+		// rest + command
+		want []string
+	}{
+		{"off", lowPowerOff, "", []string{"AT+CMGF=0", "AT+CMGL=4", "AT+CPMS?"}},
+		{"auto", lowPowerAuto, "", []string{"AT", "AT+CMGF=0", "AT+CSCLK=2", "AT", "AT+CMGL=4", "AT", "AT+CPMS?"}},
+		// The setting may survive from an earlier run: still woken once.
+		{"auto refused", lowPowerAuto, "AT+CSCLK=2", []string{"AT", "AT+CMGF=0", "AT+CSCLK=2", "AT+CMGL=4", "AT+CPMS?"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := &answeringPort{refused: map[string]bool{tt.refused: true}}
+			raw := at.NewSimpleAT(port, 5*time.Second)
+			raw.Clock = clk
+			modem := newLowPowerAT(raw, tt.mode)
+			defer modem.Close()
+
+			if _, err := modem.Command("AT+CMGF=0"); err != nil {
+				t.Fatalf("Command() error = %v", err)
+			}
+			if err := modem.enable("/dev/ttyUSB0"); err != nil {
+				t.Fatalf("enable() error = %v", err)
+			}
+			for _, cmd := range []string{"AT+CMGL=4", "AT+CPMS?"} {
+				if err := modem.rest(); err != nil {
+					t.Fatalf("rest() error = %v", err)
+				}
+				if err := modem.ReadURCs(urcWait); err != nil {
+					t.Fatalf("ReadURCs() error = %v", err)
+				}
+				if _, err := modem.Command(cmd); err != nil {
+					t.Fatalf("Command(%q) error = %v", cmd, err)
+				}
+			}
+			if strings.Join(port.writes, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("writes = %q, want %q", port.writes, tt.want)
+			}
+		})
+	}
+
+	// A port whose DTR cannot be driven keeps the modem awake.
+	name := filepath.Join(t.TempDir(), "ttyUSB0")
+	if err := os.WriteFile(name, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	port := &answeringPort{}
+	raw := at.NewSimpleAT(port, 5*time.Second)
+	raw.Clock = clk
+	modem := newLowPowerAT(raw, lowPowerDTR)
+	if err := modem.enable(name); err != nil || modem.enabled || len(port.writes) != 0 {
+		t.Errorf("enable() = %v, enabled %v, writes %q; want awake without AT+CSCLK", err, modem.enabled, port.writes)
+	}
+}
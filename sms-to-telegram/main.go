@@ -6,19 +6,28 @@ package main
 import (
 	"context"
 	"crypto/sha256"
-	"encoding/hex"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-telegram/bot"
-	"github.com/tarm/serial"
+	"github.com/go-telegram/bot/models"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
 )
 
 // contentFingerprint returns a short non-reversible identifier for sensitive
@@ -45,37 +54,333 @@ func maskICCID(lines []string) string {
 }
 
 type Config struct {
+	// PROFILES_FILE profile applied to the environment before loading, set
+	// by the commands; empty without one.
+	Profile string
+
 	TelegramToken string
 	ChatIDs       []int64
 	SerialPort    string
 	BaudRate      int
-	LogLevel      slog.Level
-	DryRun        bool // for testing without telegram
+	// Preferred SMS storage, "SM" or "ME"; the other one is the failover.
+	SMSStorage string
+	// TE character set set at init (AT+CSCS); "" leaves the modem's.
+	ModemCharset string
+	LogLevel     slog.Level
+	// Log output format: "text" (logfmt) or "json".
+	LogFormat string
+	// Add source file:line to every log record.
+	LogSource bool
+	// Mask SMS content and phone numbers in all log output (LOG_PRIVACY).
+	LogPrivacy bool
+	DryRun     bool // for testing without telegram
 	// Max age for stale multipart SMS parts before deletion. 0 disables cleanup.
 	MultipartMaxAge time.Duration
+	// SMS from one sender at most this far apart are forwarded as one
+	// (group.go); 0 disables.
+	GroupWindow time.Duration
+	// Read every deleted SIM slot back (AT+CMGR) to check it is free.
+	DeleteVerify bool
+	// When a forwarded SMS is deleted from the SIM (DELETE_POLICY):
+	// deletePolicyAll, deletePolicyAny or deletePolicyNever.
+	DeletePolicy string
 	// Timeout for a single Telegram API call.
 	TelegramSendTimeout time.Duration
 	// Grace period to wait for network registration before alerting. 0 disables grace.
 	NetworkRegGrace time.Duration
+	// SIM poll and modem health check periods.
+	PollInterval        time.Duration
+	HealthCheckInterval time.Duration
+	// "poll", or "hybrid": new SMS indications with PushPollInterval as the
+	// safety-net poll.
+	ReceptionMode    string
+	PushPollInterval time.Duration
+	// Modem sleep between loop events: "off", "dtr" or "auto" (AT+CSCLK).
+	LowPower string
+	// Serving-cell tracking on the health tick: "off", "serving" or
+	// "neighbors" (also logs the neighbor cells).
+	CellTracking string
+	// OPERATOR_NAMES_FILE names of numeric operator codes (MCC+MNC), over
+	// the built-in table; nil when unset.
+	OperatorNames map[string]string
+	// Incoming calls: "off", "hangup" (ATH) or "busy" (AT+GSMBUSY=1).
+	CallReject string
+	// Reconnect backoff after a failed modem session: the first wait and
+	// the cap it doubles up to.
+	ModemRetryInterval time.Duration
+	ModemRetryMax      time.Duration
+	// Re-send an unchanged modem alert this often while it persists; 0 alerts once.
+	AlertReminder time.Duration
+	// Per-type cooldowns, every-occurrence types and flap interval for
+	// modem alerts; the zero value alerts once per condition.
+	AlertPolicy AlertPolicy
+	// In-place retries of a transient Telegram failure before deferring to
+	// the next poll; the delay doubles after each retry.
+	TelegramRetries    int
+	TelegramRetryDelay time.Duration
+	// Characters of SMS text a Telegram message shows before it is cut
+	// short; 0 shows all of it.
+	TelegramMaxText int
+	// SMS handed to the delivery goroutine and not yet settled; at the
+	// limit SIM polling pauses.
+	QueueLimit int
+	// Telegram user IDs allowed to run bot commands. Empty disables commands.
+	AdminIDs []int64
+	// Senders whose SMS are dropped and deleted without forwarding.
+	BlockedSenders []string
+	// Directory for runtime state (blocklist, archive). Empty keeps state in memory.
+	StateDir string
+	// Kubernetes deployment: /readyz gated on the modem alone, state only
+	// in STATE_DIR.
+	Kubernetes bool
+	// How long a shutdown signal waits for the delivery queue to drain; 0
+	// exits at once.
+	ShutdownTimeout time.Duration
+	// Archive every finished SMS to STATE_DIR for /export.
+	Archive bool
+	// Archive records older than this are removed by the storage
+	// maintenance. 0 keeps them forever.
+	ArchiveRetention time.Duration
+	// When the storage maintenance runs. Nil disables it.
+	MaintenanceSchedule *MaintenanceSchedule
+	// SIMs to rotate through on SIMRotationSchedule to keep them alive.
+	// Empty disables the rotation.
+	SIMRotation         []simTarget
+	SIMRotationSchedule *MaintenanceSchedule
+	// PIN entered when the SIM asks for it. Nil disables.
+	SIMPIN *simPIN
+	// Daily window in which SMS are delivered silently. Nil disables.
+	QuietHours *TimeWindow
+	// Senders always delivered with sound, even during quiet hours.
+	PrioritySenders []string
+	// Time-conditioned recipients; the first matching rule wins, no match
+	// falls back to ChatIDs.
+	RoutingRules []RoutingRule
+	// RULES_FILE rules, in file order.
+	Rules []Rule
+	// Number the SMS selected by a relay rule are re-sent to. Empty
+	// disables relaying.
+	RelayNumber string
+	// TRANSACTION_TEMPLATES_FILE templates, in file order.
+	TransactionTemplates []TransactionTemplate
+	// Transliteration of Cyrillic and Greek text: "append", "replace" or
+	// empty (off).
+	Transliterate string
+	// Translation of the SMS text; nil when TRANSLATE_PROVIDER is unset.
+	Translate *TranslateOptions
+	// Endpoints receiving every SMS as a JSON POST, in addition to Telegram.
+	WebhookURLs []string
+	// Timeout for one webhook POST.
+	WebhookTimeout time.Duration
+	// Webhook payload format: "json" (SMSPayload) or "cloudevents"; with a
+	// template "json" or "form".
+	WebhookFormat string
+	// Body template of every webhook POST (WEBHOOK_TEMPLATE_FILE); nil
+	// sends the WebhookFormat payload.
+	WebhookTemplate *WebhookTemplate
+	// HMAC key signing every webhook POST; empty sends them unsigned.
+	WebhookSecret string
+	// How long failed webhook POSTs are retried from STATE_DIR before they
+	// are dead-lettered; 0 leaves retries to the SIM.
+	WebhookRetryMaxAge time.Duration
+	// MQTT publish sink; nil when MQTT_URL is unset.
+	MQTT *MQTTOptions
+	// Push notification sinks; nil when not configured.
+	Pushover *PushoverOptions
+	Gotify   *GotifyOptions
+	// NDJSON file sink; nil when FILE_SINK_PATH is unset.
+	FileSink *FileSinkOptions
+	// Event bus sinks; nil when not configured.
+	NATS  *NATSOptions
+	Kafka *KafkaOptions
+	// External command sink; nil when EXEC_SINK_COMMAND is unset.
+	ExecSink *ExecSinkOptions
+	// gRPC API listen address; empty disables the API.
+	GRPCListen string
+	// Allow the gRPC Send RPC to send SMS through the modem.
+	GRPCAllowSend bool
+	// HTTP API listen address (health endpoints, archive); empty disables.
+	HTTPListen string
+	// TLS for HTTPListen; nil serves plain HTTP.
+	HTTPTLS *HTTPTLSOptions
+	// Bearer token of the HTTP API (admin role); empty allows anonymous
+	// access unless APIUsers or OIDC are set.
+	APIToken string
+	// Basic auth users of the HTTP API.
+	APIUsers []APIUser
+	// OIDC bearer token verification for the HTTP API; nil disables.
+	OIDC *OIDCOptions
+	// API keys of the HTTP API, each with its scopes.
+	APIKeys []APIKey
+	// Requests per minute per HTTP API caller; 0 is unlimited.
+	APIRateLimit int
+	// Accept synthetic SMS on POST /api/v1/inject (staging).
+	InjectAPI bool
+	// Serve the web dashboard under /ui/ on the HTTP API.
+	Dashboard bool
+	// Offer the dashboard's send form (POST /api/v1/send).
+	DashboardAllowSend bool
+	// Dead-man's-switch ping URL (healthchecks.io style); empty disables.
+	HealthcheckURL string
+	// Interval between success pings.
+	HealthcheckInterval time.Duration
+	// StatsD push of the metrics; nil when STATSD_ADDR is unset.
+	StatsD *StatsDOptions
+	// Instance name and labels for notifications, payloads and metrics;
+	// nil when INSTANCE_NAME and INSTANCE_LABELS are unset.
+	Instance *Instance
+	// Sentry DSN for error reports; empty disables.
+	SentryDSN         string
+	SentryEnvironment string
+	// Structured host log backend ("journald", "syslog"); empty disables.
+	EventLog string
+	// Include SMS text in event log entries.
+	EventLogText bool
+	// Announce every start, with the build, to the chats.
+	StartupNotify bool
+	// Append-only audit log of SMS outcomes; empty disables.
+	AuditLog string
+	// File collecting anonymized undecodable PDUs for bug reports; empty
+	// disables.
+	PDUSampleFile string
+	// Log the per-phase latency of every forwarded SMS and a summary at
+	// shutdown.
+	LatencyReport bool
+	// Weak-signal alert; nil when SIGNAL_ALERT_DBM is unset.
+	SignalAlert *SignalAlertOptions
+	// Low-battery threshold in percent; 0 disables the battery alerts.
+	BatteryAlertPercent int
+	// Loopback self-test; nil when SELFTEST_NUMBER is unset.
+	SelfTest *SelfTestOptions
+	// SMS to the admin when Telegram is unreachable; nil when
+	// OUTAGE_SMS_NUMBER is unset.
+	OutageSMS *OutageSMSOptions
 }
 
 func main() {
-	cfg, err := loadConfig()
+	os.Exit(runCLI(commandLine(os.Args), os.Stdout, os.Stderr))
+}
+
+// cmdRun runs the gateway until SIGINT/SIGTERM.
+func cmdRun(args []string, stderr io.Writer) int {
+	fs := newCommandFlags("run", stderr)
+	profileName := profileFlag(fs)
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+
+	// The profile goes first: RELOAD_FILE overrides its recipients.
+	profile, err := applyProfile(*profileName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(stderr, "Configuration error: %v\n", err)
+		return 1
 	}
+	// Snapshot before RELOAD_FILE is overlaid on the environment.
+	reloadBase := reloadableEnv()
+	vault, vaultKeys, err := startupVault()
+	var cfg *Config
+	if err == nil {
+		cfg, err = loadConfigWithReloadFile(reloadBase)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Configuration error: %v\n", err)
+		return 1
+	}
+	cfg.Profile = profile
 
-	setupLogging(cfg.LogLevel)
+	setupLogging(cfg)
 
+	build := currentBuildInfo()
 	slog.Info("Starting SMS to Telegram forwarder",
+		"version", build.Version,
+		"commit", build.ShortCommit(),
+		"build_date", build.Date,
+		"profile", cfg.Profile,
 		"serial_port", cfg.SerialPort,
 		"baud_rate", cfg.BaudRate,
+		"sms_storage", cfg.SMSStorage,
+		"modem_charset", cfg.ModemCharset,
 		"chat_ids", cfg.ChatIDs,
 		"dry_run", cfg.DryRun,
 		"multipart_max_age", cfg.MultipartMaxAge,
+		"group_window", cfg.GroupWindow,
+		"delete_verify", cfg.DeleteVerify,
+		"delete_policy", cfg.DeletePolicy,
 		"telegram_send_timeout", cfg.TelegramSendTimeout,
 		"network_reg_grace", cfg.NetworkRegGrace,
+		"poll_interval", cfg.PollInterval,
+		"health_check_interval", cfg.HealthCheckInterval,
+		"reception_mode", cfg.ReceptionMode,
+		"push_poll_interval", cfg.PushPollInterval,
+		"low_power", cfg.LowPower,
+		"cell_tracking", cfg.CellTracking,
+		"operator_names", len(cfg.OperatorNames),
+		"call_reject", cfg.CallReject,
+		"modem_retry_interval", cfg.ModemRetryInterval,
+		"modem_retry_max", cfg.ModemRetryMax,
+		"alert_reminder_interval", cfg.AlertReminder,
+		"alert_cooldowns", len(cfg.AlertPolicy.Cooldowns),
+		"alert_every_occurrence", len(cfg.AlertPolicy.EveryOccurrence),
+		"alert_flap_interval", cfg.AlertPolicy.FlapInterval,
+		"telegram_retries", cfg.TelegramRetries,
+		"telegram_retry_delay", cfg.TelegramRetryDelay,
+		"telegram_max_text_length", cfg.TelegramMaxText,
+		"delivery_queue_limit", cfg.QueueLimit,
+		"state_dir", cfg.StateDir,
+		"kubernetes", cfg.Kubernetes,
+		"shutdown_timeout", cfg.ShutdownTimeout,
+		"blocked_senders", len(cfg.BlockedSenders),
+		"archive", cfg.Archive,
+		"archive_retention", cfg.ArchiveRetention,
+		"maintenance_schedule", cfg.MaintenanceSchedule.String(),
+		"sim_rotation", len(cfg.SIMRotation),
+		"sim_rotation_schedule", cfg.SIMRotationSchedule.String(),
+		"sim_pin", cfg.SIMPIN.set(),
+		"audit_log", cfg.AuditLog,
+		"pdu_sample_file", cfg.PDUSampleFile,
+		"latency_report", cfg.LatencyReport,
+		"signal_alert", cfg.SignalAlert != nil,
+		"battery_alert_percent", cfg.BatteryAlertPercent,
+		"selftest", cfg.SelfTest != nil,
+		"outage_sms", cfg.OutageSMS != nil,
+		"quiet_hours", cfg.QuietHours.String(),
+		"priority_senders", len(cfg.PrioritySenders),
+		"routing_rules", len(cfg.RoutingRules),
+		"rules", len(cfg.Rules),
+		"relay", cfg.RelayNumber != "",
+		"transaction_templates", len(cfg.TransactionTemplates),
+		"translate", cfg.Translate != nil,
+		"transliterate", cfg.Transliterate,
+		"webhooks", len(cfg.WebhookURLs),
+		"webhook_format", cfg.WebhookFormat,
+		"webhook_template", cfg.WebhookTemplate != nil,
+		"webhook_signed", cfg.WebhookSecret != "",
+		"webhook_retry_max_age", cfg.WebhookRetryMaxAge,
+		"mqtt", cfg.MQTT != nil,
+		"ha_discovery", cfg.MQTT != nil && cfg.MQTT.DiscoveryPrefix != "",
+		"pushover", cfg.Pushover != nil,
+		"gotify", cfg.Gotify != nil,
+		"file_sink", cfg.FileSink != nil,
+		"nats", cfg.NATS != nil,
+		"kafka", cfg.Kafka != nil,
+		"exec_sink", cfg.ExecSink != nil,
+		"event_log", cfg.EventLog,
+		"grpc_listen", cfg.GRPCListen,
+		"http_listen", cfg.HTTPListen,
+		"http_tls", cfg.HTTPTLS != nil,
+		"api_users", len(cfg.APIUsers),
+		"oidc", cfg.OIDC != nil,
+		"api_keys", len(cfg.APIKeys),
+		"api_rate_limit", cfg.APIRateLimit,
+		"inject_api", cfg.InjectAPI,
+		"dashboard", cfg.Dashboard,
+		"dashboard_allow_send", cfg.DashboardAllowSend,
+		"healthcheck", cfg.HealthcheckURL != "",
+		"statsd", cfg.StatsD != nil,
+		"instance", cfg.Instance,
+		"sentry", cfg.SentryDSN != "",
+		"log_privacy", cfg.LogPrivacy,
+		"startup_notify", cfg.StartupNotify,
 	)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -90,141 +395,1399 @@ func main() {
 		cancel()
 	}()
 
-	if err := run(ctx, cfg); err != nil {
+	if vault != nil {
+		slog.Info("Loaded secrets from Vault", "addr", redactURL(vault.addr), "keys", vaultKeys)
+		go vault.RunRenewal(ctx)
+	}
+
+	// SIGHUP reloads RELOAD_FILE; the delivery goroutine applies the result.
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	reloader := NewConfigReloader(reloadBase)
+	go reloader.Run(ctx, hupChan)
+
+	if err := run(ctx, cfg, reloader); err != nil {
 		slog.Error("Fatal error", "error", err)
-		os.Exit(1)
+		return 1
 	}
+	return 0
 }
 
 func loadConfig() (*Config, error) {
 	dryRunStr := os.Getenv("DRY_RUN")
 	dryRun := strings.EqualFold(dryRunStr, "true") || strings.EqualFold(dryRunStr, "yes") || dryRunStr == "1"
 
-	token := os.Getenv("TELEGRAM_BOT_TOKEN")
+	token, err := secretEnv("TELEGRAM_BOT_TOKEN")
+	if err != nil {
+		return nil, err
+	}
 	if token == "" && !dryRun {
 		return nil, fmt.Errorf("TELEGRAM_BOT_TOKEN environment variable is required")
 	}
 
-	chatIDsStr := os.Getenv("TELEGRAM_CHAT_IDS")
-	if chatIDsStr == "" && !dryRun {
-		return nil, fmt.Errorf("TELEGRAM_CHAT_IDS environment variable is required (comma-separated list)")
+	chatIDsStr := os.Getenv("TELEGRAM_CHAT_IDS")
+	if chatIDsStr == "" && !dryRun {
+		return nil, fmt.Errorf("TELEGRAM_CHAT_IDS environment variable is required (comma-separated list)")
+	}
+
+	chatIDs, err := parseIDList(chatIDsStr, "chat ID")
+	if err != nil {
+		return nil, err
+	}
+	if len(chatIDs) == 0 && !dryRun {
+		return nil, fmt.Errorf("at least one chat ID is required")
+	}
+
+	// Admin user IDs enable the bot command interface (/block, /unblock, ...).
+	adminIDs, err := parseIDList(os.Getenv("TELEGRAM_ADMIN_IDS"), "admin user ID")
+	if err != nil {
+		return nil, err
+	}
+
+	blockedSenders := splitList(os.Getenv("BLOCKED_SENDERS"))
+	prioritySenders := splitList(os.Getenv("PRIORITY_SENDERS"))
+
+	var quietHours *TimeWindow
+	if quietStr := os.Getenv("QUIET_HOURS"); quietStr != "" {
+		quietHours, err = ParseTimeWindow(quietStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid QUIET_HOURS: %w", err)
+		}
+	}
+
+	// systemd's StateDirectory= exports STATE_DIRECTORY; an explicit
+	// STATE_DIR wins. Empty means no state on disk.
+	stateDir := os.Getenv("STATE_DIR")
+	if stateDir == "" {
+		stateDir = os.Getenv("STATE_DIRECTORY")
+	}
+	if stateDir != "" {
+		info, err := os.Stat(stateDir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid STATE_DIR %q: %w", stateDir, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("invalid STATE_DIR %q: not a directory", stateDir)
+		}
+	}
+
+	routingRules, err := parseRoutingRules(os.Getenv("ROUTING_RULES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ROUTING_RULES: %w", err)
+	}
+	rules, err := loadRulesFile(os.Getenv("RULES_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	transactionTemplates, err := loadTransactionTemplates(os.Getenv("TRANSACTION_TEMPLATES_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	relayNumber := strings.TrimSpace(os.Getenv("RELAY_NUMBER"))
+	if relayNumber != "" && !validDestination(relayNumber) {
+		return nil, fmt.Errorf("invalid RELAY_NUMBER %q: must be a phone number", relayNumber)
+	}
+
+	webhookURLs := splitList(os.Getenv("WEBHOOK_URLS"))
+	for i, u := range webhookURLs {
+		if err := validateWebhookURL(u); err != nil {
+			return nil, fmt.Errorf("invalid WEBHOOK_URLS entry %d: %w", i+1, err)
+		}
+	}
+	if err := checkRules(rules, relayNumber, len(webhookURLs)); err != nil {
+		return nil, err
+	}
+
+	transliterate := strings.ToLower(os.Getenv("TRANSLITERATE"))
+	switch transliterate {
+	case "", transliterateAppend, transliterateReplace:
+	default:
+		return nil, fmt.Errorf("invalid TRANSLITERATE %q (use append or replace)", transliterate)
+	}
+
+	webhookFormat := strings.ToLower(os.Getenv("WEBHOOK_FORMAT"))
+	switch webhookFormat {
+	case "":
+		webhookFormat = webhookFormatJSON
+	case webhookFormatJSON, webhookFormatCloudEvents, webhookFormatForm:
+	default:
+		return nil, fmt.Errorf("invalid WEBHOOK_FORMAT %q (use json, cloudevents or form)", webhookFormat)
+	}
+	var webhookTemplate *WebhookTemplate
+	if path := os.Getenv("WEBHOOK_TEMPLATE_FILE"); path != "" {
+		if len(webhookURLs) == 0 {
+			return nil, fmt.Errorf("WEBHOOK_TEMPLATE_FILE requires WEBHOOK_URLS")
+		}
+		if webhookFormat == webhookFormatCloudEvents {
+			return nil, fmt.Errorf("WEBHOOK_TEMPLATE_FILE renders json or form bodies, not cloudevents")
+		}
+		if webhookTemplate, err = loadWebhookTemplate(path, webhookFormat); err != nil {
+			return nil, err
+		}
+	} else if webhookFormat == webhookFormatForm {
+		return nil, fmt.Errorf("WEBHOOK_FORMAT=form requires WEBHOOK_TEMPLATE_FILE")
+	}
+
+	webhookSecret, err := secretEnv("WEBHOOK_SECRET")
+	if err != nil {
+		return nil, err
+	}
+	if webhookSecret != "" {
+		if len(webhookURLs) == 0 {
+			return nil, fmt.Errorf("WEBHOOK_SECRET requires WEBHOOK_URLS")
+		}
+		if len(webhookSecret) < minWebhookSecretLen {
+			return nil, fmt.Errorf("WEBHOOK_SECRET must be at least %d characters", minWebhookSecretLen)
+		}
+	}
+
+	var webhookRetryMaxAge time.Duration
+	if ageStr := os.Getenv("WEBHOOK_RETRY_MAX_AGE"); ageStr != "" {
+		webhookRetryMaxAge, err = time.ParseDuration(ageStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WEBHOOK_RETRY_MAX_AGE %q: %w", ageStr, err)
+		}
+		if webhookRetryMaxAge < time.Minute {
+			return nil, fmt.Errorf("invalid WEBHOOK_RETRY_MAX_AGE %q: must be >= 1m", ageStr)
+		}
+		if len(webhookURLs) == 0 {
+			return nil, fmt.Errorf("WEBHOOK_RETRY_MAX_AGE requires WEBHOOK_URLS")
+		}
+		if stateDir == "" {
+			return nil, fmt.Errorf("WEBHOOK_RETRY_MAX_AGE requires STATE_DIR")
+		}
+	}
+
+	webhookTimeout := 10 * time.Second
+	if timeoutStr := os.Getenv("WEBHOOK_TIMEOUT"); timeoutStr != "" {
+		webhookTimeout, err = time.ParseDuration(timeoutStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WEBHOOK_TIMEOUT %q: %w", timeoutStr, err)
+		}
+		if webhookTimeout <= 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_TIMEOUT %q: must be > 0", timeoutStr)
+		}
+	}
+
+	healthcheckURL := os.Getenv("HEALTHCHECK_URL")
+	if healthcheckURL != "" {
+		if err := validateWebhookURL(healthcheckURL); err != nil {
+			return nil, fmt.Errorf("invalid HEALTHCHECK_URL: %w", err)
+		}
+	}
+	healthcheckInterval := 60 * time.Second
+	if intervalStr := os.Getenv("HEALTHCHECK_INTERVAL"); intervalStr != "" {
+		healthcheckInterval, err = time.ParseDuration(intervalStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HEALTHCHECK_INTERVAL %q: %w", intervalStr, err)
+		}
+		if healthcheckInterval <= 0 {
+			return nil, fmt.Errorf("invalid HEALTHCHECK_INTERVAL %q: must be > 0", intervalStr)
+		}
+	}
+
+	statsdOpts, err := loadStatsDConfig()
+	if err != nil {
+		return nil, err
+	}
+	instance, err := loadInstanceConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	sentryDSN, err := secretEnv("SENTRY_DSN")
+	if err != nil {
+		return nil, err
+	}
+	if sentryDSN != "" {
+		if _, _, err := parseSentryDSN(sentryDSN); err != nil {
+			return nil, fmt.Errorf("invalid SENTRY_DSN: %w", err)
+		}
+	}
+
+	mqttOpts, err := loadMQTTConfig()
+	if err != nil {
+		return nil, err
+	}
+	pushoverOpts, err := loadPushoverConfig()
+	if err != nil {
+		return nil, err
+	}
+	gotifyOpts, err := loadGotifyConfig()
+	if err != nil {
+		return nil, err
+	}
+	translateOpts, err := loadTranslateConfig()
+	if err != nil {
+		return nil, err
+	}
+	signalAlertOpts, err := loadSignalAlertConfig()
+	if err != nil {
+		return nil, err
+	}
+	var batteryAlertPercent int
+	if percentStr := os.Getenv("BATTERY_ALERT_PERCENT"); percentStr != "" {
+		batteryAlertPercent, err = strconv.Atoi(percentStr)
+		if err != nil || batteryAlertPercent < 1 || batteryAlertPercent > 99 {
+			return nil, fmt.Errorf("invalid BATTERY_ALERT_PERCENT %q (use 1 to 99, e.g. 20)", percentStr)
+		}
+	}
+	selfTestOpts, err := loadSelfTestConfig()
+	if err != nil {
+		return nil, err
+	}
+	outageSMSOpts, err := loadOutageSMSConfig()
+	if err != nil {
+		return nil, err
+	}
+	fileSinkOpts, err := loadFileSinkConfig()
+	if err != nil {
+		return nil, err
+	}
+	natsOpts, err := loadNATSConfig()
+	if err != nil {
+		return nil, err
+	}
+	kafkaOpts, err := loadKafkaConfig()
+	if err != nil {
+		return nil, err
+	}
+	execSinkOpts, err := loadExecSinkConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	eventLog := strings.ToLower(os.Getenv("EVENT_LOG"))
+	if eventLog != "" && eventLog != "journald" && eventLog != "syslog" {
+		return nil, fmt.Errorf("invalid EVENT_LOG %q (use journald or syslog)", eventLog)
+	}
+	eventLogTextStr := os.Getenv("EVENT_LOG_TEXT")
+	eventLogText := strings.EqualFold(eventLogTextStr, "true") || strings.EqualFold(eventLogTextStr, "yes") || eventLogTextStr == "1"
+
+	grpcListen := os.Getenv("GRPC_LISTEN")
+	if grpcListen != "" {
+		if _, _, err := net.SplitHostPort(grpcListen); err != nil {
+			return nil, fmt.Errorf("invalid GRPC_LISTEN %q: %w", grpcListen, err)
+		}
+	}
+	grpcSendStr := os.Getenv("GRPC_ALLOW_SEND")
+	grpcAllowSend := strings.EqualFold(grpcSendStr, "true") || strings.EqualFold(grpcSendStr, "yes") || grpcSendStr == "1"
+	if grpcAllowSend && grpcListen == "" {
+		return nil, fmt.Errorf("GRPC_ALLOW_SEND requires GRPC_LISTEN")
+	}
+
+	latencyStr := os.Getenv("LATENCY_REPORT")
+	latencyReport := strings.EqualFold(latencyStr, "true") || strings.EqualFold(latencyStr, "yes") || latencyStr == "1"
+
+	archiveStr := os.Getenv("ARCHIVE")
+	archive := strings.EqualFold(archiveStr, "true") || strings.EqualFold(archiveStr, "yes") || archiveStr == "1"
+	if archive && stateDir == "" {
+		return nil, fmt.Errorf("ARCHIVE requires STATE_DIR")
+	}
+
+	var maintenanceSchedule *MaintenanceSchedule
+	if scheduleStr := os.Getenv("MAINTENANCE_SCHEDULE"); scheduleStr != "" {
+		maintenanceSchedule, err = ParseMaintenanceSchedule(scheduleStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MAINTENANCE_SCHEDULE: %w", err)
+		}
+	}
+	var simRotation []simTarget
+	if rotationStr := os.Getenv("SIM_ROTATION"); rotationStr != "" {
+		simRotation, err = parseSIMTargets(rotationStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SIM_ROTATION: %w", err)
+		}
+	}
+	var simRotationSchedule *MaintenanceSchedule
+	if scheduleStr := os.Getenv("SIM_ROTATION_SCHEDULE"); scheduleStr != "" {
+		simRotationSchedule, err = ParseMaintenanceSchedule(scheduleStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SIM_ROTATION_SCHEDULE: %w", err)
+		}
+	}
+	if (simRotation == nil) != (simRotationSchedule == nil) {
+		return nil, fmt.Errorf("SIM_ROTATION and SIM_ROTATION_SCHEDULE must be set together")
+	}
+	pinStr, err := secretEnv("SIM_PIN")
+	if err != nil {
+		return nil, err
+	}
+	if pinStr != "" && !validPIN(pinStr) {
+		return nil, fmt.Errorf("SIM_PIN must have 4 to 8 digits")
+	}
+	var archiveRetention time.Duration
+	if retentionStr := os.Getenv("ARCHIVE_RETENTION"); retentionStr != "" {
+		archiveRetention, err = time.ParseDuration(retentionStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ARCHIVE_RETENTION %q: %w", retentionStr, err)
+		}
+		if archiveRetention < 0 {
+			return nil, fmt.Errorf("invalid ARCHIVE_RETENTION %q: must be >= 0", retentionStr)
+		}
+		if archiveRetention > 0 && !archive {
+			return nil, fmt.Errorf("ARCHIVE_RETENTION requires ARCHIVE")
+		}
+		if archiveRetention > 0 && maintenanceSchedule == nil {
+			return nil, fmt.Errorf("ARCHIVE_RETENTION requires MAINTENANCE_SCHEDULE")
+		}
+	}
+
+	httpListen := os.Getenv("HTTP_LISTEN")
+	if httpListen != "" {
+		if _, _, err := net.SplitHostPort(httpListen); err != nil {
+			return nil, fmt.Errorf("invalid HTTP_LISTEN %q: %w", httpListen, err)
+		}
+	}
+	httpTLS, err := loadHTTPTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if httpTLS != nil && httpListen == "" {
+		return nil, fmt.Errorf("HTTP_TLS_CERT or HTTP_TLS_SELF_SIGNED requires HTTP_LISTEN")
+	}
+	apiToken, err := secretEnv("API_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	apiUsersStr, err := secretEnv("API_USERS")
+	if err != nil {
+		return nil, err
+	}
+	apiUsers, err := parseAPIUsers(apiUsersStr)
+	if err != nil {
+		return nil, err
+	}
+	oidcOpts, err := loadOIDCConfig()
+	if err != nil {
+		return nil, err
+	}
+	if len(apiUsers) > 0 && httpListen == "" {
+		return nil, fmt.Errorf("API_USERS requires HTTP_LISTEN")
+	}
+	if oidcOpts != nil && httpListen == "" {
+		return nil, fmt.Errorf("OIDC_ISSUER requires HTTP_LISTEN")
+	}
+	apiKeysStr, err := secretEnv("API_KEYS")
+	if err != nil {
+		return nil, err
+	}
+	apiKeys, err := parseAPIKeys(apiKeysStr)
+	if err != nil {
+		return nil, err
+	}
+	if len(apiKeys) > 0 && httpListen == "" && grpcListen == "" {
+		return nil, fmt.Errorf("API_KEYS requires HTTP_LISTEN or GRPC_LISTEN")
+	}
+	apiAuth := apiToken != "" || len(apiUsers) > 0 || oidcOpts != nil || len(apiKeys) > 0
+	// Subscribe streams every SMS and Send speaks for the SIM: beyond
+	// localhost, never anonymously.
+	if grpcListen != "" && !loopbackListen(grpcListen) && !apiAuth {
+		return nil, fmt.Errorf("GRPC_LISTEN beyond localhost requires API_TOKEN, API_KEYS, API_USERS or OIDC_ISSUER")
+	}
+	// The same for the archive, the injector and the dashboard.
+	if httpListen != "" && !loopbackListen(httpListen) && !apiAuth {
+		return nil, fmt.Errorf("HTTP_LISTEN beyond localhost requires API_TOKEN, API_KEYS, API_USERS or OIDC_ISSUER")
+	}
+	apiRateLimit := 0
+	if limitStr := os.Getenv("API_RATE_LIMIT"); limitStr != "" {
+		apiRateLimit, err = strconv.Atoi(limitStr)
+		if err != nil || apiRateLimit < 0 {
+			return nil, fmt.Errorf("invalid API_RATE_LIMIT %q: must be a number of requests per minute", limitStr)
+		}
+		if httpListen == "" {
+			return nil, fmt.Errorf("API_RATE_LIMIT requires HTTP_LISTEN")
+		}
+	}
+	injectStr := os.Getenv("INJECT_API")
+	injectAPI := strings.EqualFold(injectStr, "true") || strings.EqualFold(injectStr, "yes") || injectStr == "1"
+	if injectAPI && httpListen == "" {
+		return nil, fmt.Errorf("INJECT_API requires HTTP_LISTEN")
+	}
+	// Injected SMS reach the real chats outside DRY_RUN: never anonymously.
+	if injectAPI && !dryRun && !apiAuth {
+		return nil, fmt.Errorf("INJECT_API requires API_TOKEN, API_KEYS, API_USERS or OIDC_ISSUER unless DRY_RUN is set")
+	}
+	dashboardStr := os.Getenv("DASHBOARD")
+	dashboard := strings.EqualFold(dashboardStr, "true") || strings.EqualFold(dashboardStr, "yes") || dashboardStr == "1"
+	if dashboard && httpListen == "" {
+		return nil, fmt.Errorf("DASHBOARD requires HTTP_LISTEN")
+	}
+	dashboardSendStr := os.Getenv("DASHBOARD_ALLOW_SEND")
+	dashboardAllowSend := strings.EqualFold(dashboardSendStr, "true") || strings.EqualFold(dashboardSendStr, "yes") || dashboardSendStr == "1"
+	if dashboardAllowSend && !dashboard {
+		return nil, fmt.Errorf("DASHBOARD_ALLOW_SEND requires DASHBOARD")
+	}
+	// The send form spends money and speaks for the SIM: never anonymously.
+	if dashboardAllowSend && !apiAuth {
+		return nil, fmt.Errorf("DASHBOARD_ALLOW_SEND requires API_TOKEN, API_KEYS, API_USERS or OIDC_ISSUER")
+	}
+
+	serialPort := os.Getenv("SERIAL_PORT")
+	if serialPort == "" {
+		serialPort = "/dev/ttyUSB0"
+	}
+	if _, err := filepath.Match(serialPort, ""); err != nil {
+		return nil, fmt.Errorf("invalid SERIAL_PORT %q: %w", serialPort, err)
+	}
+
+	baudRate := 115200
+	if baudStr := os.Getenv("BAUD_RATE"); baudStr != "" {
+		var err error
+		baudRate, err = strconv.Atoi(baudStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BAUD_RATE %q: %w", baudStr, err)
+		}
+		if baudRate <= 0 {
+			return nil, fmt.Errorf("invalid BAUD_RATE %q: must be > 0", baudStr)
+		}
+	}
+
+	smsStorage := storageSM
+	if storageStr := os.Getenv("SMS_STORAGE"); storageStr != "" {
+		smsStorage = strings.ToUpper(storageStr)
+		if smsStorage != storageSM && smsStorage != storageME {
+			return nil, fmt.Errorf("invalid SMS_STORAGE %q: must be SM or ME", storageStr)
+		}
+	}
+
+	modemCharset := strings.ToUpper(os.Getenv("MODEM_CHARSET"))
+	switch modemCharset {
+	case "", charsetGSM, charsetIRA, charsetUCS2:
+	default:
+		return nil, fmt.Errorf("invalid MODEM_CHARSET %q: must be GSM, IRA or UCS2", os.Getenv("MODEM_CHARSET"))
+	}
+
+	logLevel := slog.LevelInfo
+	if logLevelStr := os.Getenv("LOG_LEVEL"); logLevelStr != "" {
+		switch strings.ToUpper(logLevelStr) {
+		case "DEBUG":
+			logLevel = slog.LevelDebug
+		case "INFO":
+			logLevel = slog.LevelInfo
+		case "WARN", "WARNING":
+			logLevel = slog.LevelWarn
+		case "ERROR":
+			logLevel = slog.LevelError
+		default:
+			return nil, fmt.Errorf("invalid LOG_LEVEL %q (use DEBUG, INFO, WARN, ERROR)", logLevelStr)
+		}
+	}
+	logFormat := strings.ToLower(os.Getenv("LOG_FORMAT"))
+	switch logFormat {
+	case "":
+		logFormat = "text"
+	case "text", "json":
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q (use text or json)", logFormat)
+	}
+	logSourceStr := os.Getenv("LOG_SOURCE")
+	logSource := strings.EqualFold(logSourceStr, "true") || strings.EqualFold(logSourceStr, "yes") || logSourceStr == "1"
+	logPrivacyStr := os.Getenv("LOG_PRIVACY")
+	logPrivacy := strings.EqualFold(logPrivacyStr, "true") || strings.EqualFold(logPrivacyStr, "yes") || logPrivacyStr == "1"
+	if eventLogText && logPrivacy {
+		return nil, fmt.Errorf("EVENT_LOG_TEXT cannot be combined with LOG_PRIVACY")
+	}
+
+	auditLog := os.Getenv("AUDIT_LOG")
+	if auditLog != "" && !filepath.IsAbs(auditLog) {
+		return nil, fmt.Errorf("invalid AUDIT_LOG %q: must be absolute", auditLog)
+	}
+	pduSampleFile := os.Getenv("PDU_SAMPLE_FILE")
+	if pduSampleFile != "" && !filepath.IsAbs(pduSampleFile) {
+		return nil, fmt.Errorf("invalid PDU_SAMPLE_FILE %q: must be absolute", pduSampleFile)
+	}
+
+	// KUBERNETES: the pod's filesystem is lost with it, so everything the
+	// gateway keeps lives in the STATE_DIR volume, and the probes need the
+	// HTTP API.
+	kubernetesStr := os.Getenv("KUBERNETES")
+	kubernetes := strings.EqualFold(kubernetesStr, "true") || strings.EqualFold(kubernetesStr, "yes") || kubernetesStr == "1"
+	if kubernetes {
+		if stateDir == "" {
+			return nil, fmt.Errorf("KUBERNETES requires STATE_DIR")
+		}
+		if err := probeWritableDir(stateDir); err != nil {
+			return nil, fmt.Errorf("invalid STATE_DIR %q: not writable: %w", stateDir, err)
+		}
+		if httpListen == "" {
+			return nil, fmt.Errorf("KUBERNETES requires HTTP_LISTEN")
+		}
+		for _, file := range []struct{ name, path string }{{"AUDIT_LOG", auditLog}, {"PDU_SAMPLE_FILE", pduSampleFile}} {
+			if file.path != "" && !inDir(stateDir, file.path) {
+				return nil, fmt.Errorf("invalid %s %q: must be inside STATE_DIR with KUBERNETES", file.name, file.path)
+			}
+		}
+	}
+	// The default stays below the 30s grace period of a pod.
+	var shutdownTimeout time.Duration
+	if kubernetes {
+		shutdownTimeout = 25 * time.Second
+	}
+	if timeoutStr := os.Getenv("SHUTDOWN_TIMEOUT"); timeoutStr != "" {
+		shutdownTimeout, err = time.ParseDuration(timeoutStr)
+		if err != nil || shutdownTimeout < 0 || shutdownTimeout > 10*time.Minute {
+			return nil, fmt.Errorf("invalid SHUTDOWN_TIMEOUT %q: must be between 0 and 10m", timeoutStr)
+		}
+	}
+
+	deleteVerifyStr := os.Getenv("DELETE_VERIFY")
+	deleteVerify := strings.EqualFold(deleteVerifyStr, "true") || strings.EqualFold(deleteVerifyStr, "yes") || deleteVerifyStr == "1"
+
+	deletePolicy := deletePolicyAll
+	if policyStr := os.Getenv("DELETE_POLICY"); policyStr != "" {
+		deletePolicy = strings.ToLower(policyStr)
+		if deletePolicy != deletePolicyAll && deletePolicy != deletePolicyAny && deletePolicy != deletePolicyNever {
+			return nil, fmt.Errorf("invalid DELETE_POLICY %q: must be all, any or never", policyStr)
+		}
+	}
+
+	startupNotifyStr := os.Getenv("STARTUP_NOTIFY")
+	startupNotify := strings.EqualFold(startupNotifyStr, "true") || strings.EqualFold(startupNotifyStr, "yes") || startupNotifyStr == "1"
+
+	var multipartMaxAge time.Duration
+	if maxAgeStr := os.Getenv("MULTIPART_MAX_AGE"); maxAgeStr != "" {
+		var err error
+		multipartMaxAge, err = time.ParseDuration(maxAgeStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MULTIPART_MAX_AGE %q: %w", maxAgeStr, err)
+		}
+		if multipartMaxAge < 0 {
+			return nil, fmt.Errorf("invalid MULTIPART_MAX_AGE %q: must be >= 0", maxAgeStr)
+		}
+	}
+
+	var groupWindow time.Duration
+	if windowStr := os.Getenv("GROUP_WINDOW"); windowStr != "" {
+		var err error
+		groupWindow, err = time.ParseDuration(windowStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GROUP_WINDOW %q: %w", windowStr, err)
+		}
+		if groupWindow != 0 && (groupWindow < time.Second || groupWindow > 10*time.Minute) {
+			return nil, fmt.Errorf("invalid GROUP_WINDOW %q: must be 0 or between 1s and 10m", windowStr)
+		}
+	}
+
+	telegramSendTimeout := 20 * time.Second
+	if timeoutStr := os.Getenv("TELEGRAM_SEND_TIMEOUT"); timeoutStr != "" {
+		var err error
+		telegramSendTimeout, err = time.ParseDuration(timeoutStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TELEGRAM_SEND_TIMEOUT %q: %w", timeoutStr, err)
+		}
+		if telegramSendTimeout <= 0 {
+			return nil, fmt.Errorf("invalid TELEGRAM_SEND_TIMEOUT %q: must be > 0", timeoutStr)
+		}
+	}
+
+	networkRegGrace := 90 * time.Second
+	if graceStr := os.Getenv("NETWORK_REG_GRACE"); graceStr != "" {
+		var err error
+		networkRegGrace, err = time.ParseDuration(graceStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NETWORK_REG_GRACE %q: %w", graceStr, err)
+		}
+		if networkRegGrace < 0 {
+			return nil, fmt.Errorf("invalid NETWORK_REG_GRACE %q: must be >= 0", graceStr)
+		}
+	}
+
+	// The bounds keep /readyz and the systemd watchdog fed: every poll is a
+	// heartbeat, and the retry wait must stay well below the liveness stall.
+	pollInterval := 10 * time.Second
+	if intervalStr := os.Getenv("POLL_INTERVAL"); intervalStr != "" {
+		var err error
+		pollInterval, err = time.ParseDuration(intervalStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid POLL_INTERVAL %q: %w", intervalStr, err)
+		}
+		if pollInterval < time.Second || pollInterval > time.Minute {
+			return nil, fmt.Errorf("invalid POLL_INTERVAL %q: must be between 1s and 1m", intervalStr)
+		}
+	}
+
+	receptionMode := receptionPoll
+	if modeStr := os.Getenv("RECEPTION_MODE"); modeStr != "" {
+		receptionMode = strings.ToLower(modeStr)
+		if receptionMode != receptionPoll && receptionMode != receptionHybrid {
+			return nil, fmt.Errorf("invalid RECEPTION_MODE %q: must be poll or hybrid", modeStr)
+		}
+	}
+
+	pushPollInterval := 5 * time.Minute
+	if intervalStr := os.Getenv("PUSH_POLL_INTERVAL"); intervalStr != "" {
+		var err error
+		pushPollInterval, err = time.ParseDuration(intervalStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PUSH_POLL_INTERVAL %q: %w", intervalStr, err)
+		}
+		if pushPollInterval < pollInterval || pushPollInterval > time.Hour {
+			return nil, fmt.Errorf("invalid PUSH_POLL_INTERVAL %q: must be between POLL_INTERVAL and 1h", intervalStr)
+		}
+	}
+
+	lowPower := lowPowerOff
+	if modeStr := os.Getenv("LOW_POWER"); modeStr != "" {
+		lowPower = strings.ToLower(modeStr)
+		if lowPower != lowPowerOff && lowPower != lowPowerDTR && lowPower != lowPowerAuto {
+			return nil, fmt.Errorf("invalid LOW_POWER %q: must be off, dtr or auto", modeStr)
+		}
+	}
+
+	cellTracking := cellTrackingOff
+	if modeStr := os.Getenv("CELL_TRACKING"); modeStr != "" {
+		cellTracking = strings.ToLower(modeStr)
+		if cellTracking != cellTrackingOff && cellTracking != cellTrackingServing && cellTracking != cellTrackingNeighbors {
+			return nil, fmt.Errorf("invalid CELL_TRACKING %q: must be off, serving or neighbors", modeStr)
+		}
+	}
+
+	operatorNames, err := loadOperatorNames(os.Getenv("OPERATOR_NAMES_FILE"))
+	if err != nil {
+		return nil, err
+	}
+
+	callReject := callRejectOff
+	if modeStr := os.Getenv("CALL_REJECT"); modeStr != "" {
+		callReject = strings.ToLower(modeStr)
+		if callReject != callRejectOff && callReject != callRejectHangup && callReject != callRejectBusy {
+			return nil, fmt.Errorf("invalid CALL_REJECT %q: must be off, hangup or busy", modeStr)
+		}
+	}
+
+	healthCheckInterval := 60 * time.Second
+	if intervalStr := os.Getenv("HEALTH_CHECK_INTERVAL"); intervalStr != "" {
+		var err error
+		healthCheckInterval, err = time.ParseDuration(intervalStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HEALTH_CHECK_INTERVAL %q: %w", intervalStr, err)
+		}
+		if healthCheckInterval < 10*time.Second || healthCheckInterval > 10*time.Minute {
+			return nil, fmt.Errorf("invalid HEALTH_CHECK_INTERVAL %q: must be between 10s and 10m", intervalStr)
+		}
+	}
+
+	modemRetryInterval := 30 * time.Second
+	if intervalStr := os.Getenv("MODEM_RETRY_INTERVAL"); intervalStr != "" {
+		var err error
+		modemRetryInterval, err = time.ParseDuration(intervalStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MODEM_RETRY_INTERVAL %q: %w", intervalStr, err)
+		}
+		if modemRetryInterval < time.Second || modemRetryInterval > 2*time.Minute {
+			return nil, fmt.Errorf("invalid MODEM_RETRY_INTERVAL %q: must be between 1s and 2m", intervalStr)
+		}
+	}
+	modemRetryMax := max(2*time.Minute, modemRetryInterval)
+	if maxStr := os.Getenv("MODEM_RETRY_MAX"); maxStr != "" {
+		var err error
+		modemRetryMax, err = time.ParseDuration(maxStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MODEM_RETRY_MAX %q: %w", maxStr, err)
+		}
+		if modemRetryMax < modemRetryInterval || modemRetryMax > 4*time.Minute {
+			return nil, fmt.Errorf("invalid MODEM_RETRY_MAX %q: must be between MODEM_RETRY_INTERVAL (%s) and 4m",
+				maxStr, modemRetryInterval)
+		}
+	}
+
+	var alertReminderInterval time.Duration
+	if intervalStr := os.Getenv("ALERT_REMINDER_INTERVAL"); intervalStr != "" {
+		var err error
+		alertReminderInterval, err = time.ParseDuration(intervalStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ALERT_REMINDER_INTERVAL %q: %w", intervalStr, err)
+		}
+		if alertReminderInterval != 0 && alertReminderInterval < 10*time.Minute {
+			return nil, fmt.Errorf("invalid ALERT_REMINDER_INTERVAL %q: must be 0 (off) or >= 10m", intervalStr)
+		}
+	}
+
+	alertPolicy, err := loadAlertPolicyConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	telegramRetries := 2
+	if retriesStr := os.Getenv("TELEGRAM_RETRIES"); retriesStr != "" {
+		var err error
+		telegramRetries, err = strconv.Atoi(retriesStr)
+		if err != nil || telegramRetries < 0 || telegramRetries > 5 {
+			return nil, fmt.Errorf("invalid TELEGRAM_RETRIES %q: must be 0-5", retriesStr)
+		}
+	}
+	telegramRetryDelay := 5 * time.Second
+	if delayStr := os.Getenv("TELEGRAM_RETRY_DELAY"); delayStr != "" {
+		var err error
+		telegramRetryDelay, err = time.ParseDuration(delayStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TELEGRAM_RETRY_DELAY %q: %w", delayStr, err)
+		}
+		if telegramRetryDelay <= 0 {
+			return nil, fmt.Errorf("invalid TELEGRAM_RETRY_DELAY %q: must be > 0", delayStr)
+		}
+	}
+	// Retries hold up the delivery queue; the SIM is the real retry queue.
+	if total := telegramRetryDelay * time.Duration(1<<telegramRetries-1); total > time.Minute {
+		return nil, fmt.Errorf("TELEGRAM_RETRIES=%d with TELEGRAM_RETRY_DELAY=%s waits %s per message, more than 1m",
+			telegramRetries, telegramRetryDelay, total)
+	}
+
+	telegramMaxText := 0
+	if maxStr := os.Getenv("TELEGRAM_MAX_TEXT_LENGTH"); maxStr != "" {
+		var err error
+		telegramMaxText, err = strconv.Atoi(maxStr)
+		if err != nil || telegramMaxText < 100 {
+			return nil, fmt.Errorf("invalid TELEGRAM_MAX_TEXT_LENGTH %q: must be >= 100", maxStr)
+		}
+	}
+
+	queueLimit := 20
+	if limitStr := os.Getenv("DELIVERY_QUEUE_LIMIT"); limitStr != "" {
+		var err error
+		queueLimit, err = strconv.Atoi(limitStr)
+		if err != nil || queueLimit < 1 || queueLimit > 1000 {
+			return nil, fmt.Errorf("invalid DELIVERY_QUEUE_LIMIT %q: must be 1-1000", limitStr)
+		}
+	}
+
+	return &Config{
+		TelegramToken:       token,
+		ChatIDs:             chatIDs,
+		SerialPort:          serialPort,
+		BaudRate:            baudRate,
+		SMSStorage:          smsStorage,
+		ModemCharset:        modemCharset,
+		LogLevel:            logLevel,
+		LogFormat:           logFormat,
+		LogSource:           logSource,
+		LogPrivacy:          logPrivacy,
+		DryRun:              dryRun,
+		MultipartMaxAge:     multipartMaxAge,
+		GroupWindow:         groupWindow,
+		DeleteVerify:        deleteVerify,
+		DeletePolicy:        deletePolicy,
+		TelegramSendTimeout: telegramSendTimeout,
+		NetworkRegGrace:     networkRegGrace,
+		PollInterval:        pollInterval,
+		HealthCheckInterval: healthCheckInterval,
+		ReceptionMode:       receptionMode,
+		PushPollInterval:    pushPollInterval,
+		LowPower:            lowPower,
+		CellTracking:        cellTracking,
+		OperatorNames:       operatorNames,
+		CallReject:          callReject,
+		ModemRetryInterval:  modemRetryInterval,
+		ModemRetryMax:       modemRetryMax,
+		AlertReminder:       alertReminderInterval,
+		AlertPolicy:         alertPolicy,
+		TelegramRetries:     telegramRetries,
+		TelegramRetryDelay:  telegramRetryDelay,
+		TelegramMaxText:     telegramMaxText,
+		QueueLimit:          queueLimit,
+		AdminIDs:            adminIDs,
+		BlockedSenders:      blockedSenders,
+		StateDir:            stateDir,
+		Kubernetes:          kubernetes,
+		ShutdownTimeout:     shutdownTimeout,
+		Archive:             archive,
+		ArchiveRetention:    archiveRetention,
+		MaintenanceSchedule: maintenanceSchedule,
+		SIMRotation:         simRotation,
+		SIMRotationSchedule: simRotationSchedule,
+		SIMPIN:              newSIMPIN(pinStr),
+		QuietHours:          quietHours,
+		PrioritySenders:     prioritySenders,
+		RoutingRules:        routingRules,
+		Rules:               rules,
+		RelayNumber:         relayNumber,
+		WebhookURLs:         webhookURLs,
+		WebhookTimeout:      webhookTimeout,
+		WebhookFormat:       webhookFormat,
+		WebhookTemplate:     webhookTemplate,
+		WebhookSecret:       webhookSecret,
+		WebhookRetryMaxAge:  webhookRetryMaxAge,
+		MQTT:                mqttOpts,
+		Pushover:            pushoverOpts,
+		Gotify:              gotifyOpts,
+		FileSink:            fileSinkOpts,
+		NATS:                natsOpts,
+		Kafka:               kafkaOpts,
+		ExecSink:            execSinkOpts,
+		EventLog:            eventLog,
+		GRPCListen:          grpcListen,
+		GRPCAllowSend:       grpcAllowSend,
+		HTTPListen:          httpListen,
+		HTTPTLS:             httpTLS,
+		APIToken:            apiToken,
+		APIUsers:            apiUsers,
+		OIDC:                oidcOpts,
+		APIKeys:             apiKeys,
+		APIRateLimit:        apiRateLimit,
+		InjectAPI:           injectAPI,
+		Dashboard:           dashboard,
+		DashboardAllowSend:  dashboardAllowSend,
+		HealthcheckURL:      healthcheckURL,
+		HealthcheckInterval: healthcheckInterval,
+		SentryDSN:           sentryDSN,
+		SentryEnvironment:   os.Getenv("SENTRY_ENVIRONMENT"),
+		EventLogText:        eventLogText,
+		LatencyReport:       latencyReport,
+		StartupNotify:       startupNotify,
+		AuditLog:            auditLog,
+		PDUSampleFile:       pduSampleFile,
+		SignalAlert:         signalAlertOpts,
+		BatteryAlertPercent: batteryAlertPercent,
+		SelfTest:            selfTestOpts,
+		OutageSMS:           outageSMSOpts,
+		StatsD:              statsdOpts,
+		Instance:            instance,
+		Translate:           translateOpts,
+		Transliterate:       transliterate,
+
+		TransactionTemplates: transactionTemplates,
+	}, nil
+}
+
+// inDir reports whether path lies inside dir (both absolute).
+func inDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// loadMQTTConfig reads the MQTT_* variables; MQTT_URL enables the sink.
+func loadMQTTConfig() (*MQTTOptions, error) {
+	haStr := os.Getenv("HA_DISCOVERY")
+	haDiscovery := strings.EqualFold(haStr, "true") || strings.EqualFold(haStr, "yes") || haStr == "1"
+	rawURL := os.Getenv("MQTT_URL")
+	if rawURL == "" {
+		if haDiscovery {
+			return nil, fmt.Errorf("HA_DISCOVERY requires MQTT_URL")
+		}
+		return nil, nil
+	}
+	if _, _, err := parseMQTTURL(rawURL); err != nil {
+		return nil, fmt.Errorf("invalid MQTT_URL: %w", err)
+	}
+	password, err := secretEnv("MQTT_PASSWORD")
+	if err != nil {
+		return nil, err
+	}
+	opts := &MQTTOptions{
+		URL:      rawURL,
+		Username: os.Getenv("MQTT_USERNAME"),
+		Password: password,
+		ClientID: os.Getenv("MQTT_CLIENT_ID"),
+		Topic:    os.Getenv("MQTT_TOPIC"),
+		QoS:      1,
+		CAFile:   os.Getenv("MQTT_CA_FILE"),
+		Timeout:  10 * time.Second,
+	}
+	if opts.ClientID == "" {
+		hostname, _ := os.Hostname()
+		opts.ClientID = "sms-to-telegram-" + hostname
+	}
+	if opts.Topic == "" {
+		opts.Topic = "sms-to-telegram/sms"
+	}
+	if strings.ContainsAny(opts.Topic, "+#") {
+		return nil, fmt.Errorf("invalid MQTT_TOPIC %q: wildcards are not allowed when publishing", opts.Topic)
+	}
+	if qosStr := os.Getenv("MQTT_QOS"); qosStr != "" {
+		qos, err := strconv.Atoi(qosStr)
+		if err != nil || qos < 0 || qos > 2 {
+			return nil, fmt.Errorf("invalid MQTT_QOS %q (use 0, 1 or 2)", qosStr)
+		}
+		opts.QoS = byte(qos)
+	}
+	if timeoutStr := os.Getenv("MQTT_TIMEOUT"); timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MQTT_TIMEOUT %q: %w", timeoutStr, err)
+		}
+		if timeout <= 0 {
+			return nil, fmt.Errorf("invalid MQTT_TIMEOUT %q: must be > 0", timeoutStr)
+		}
+		opts.Timeout = timeout
+	}
+	if haDiscovery {
+		opts.DiscoveryPrefix = os.Getenv("HA_DISCOVERY_PREFIX")
+		if opts.DiscoveryPrefix == "" {
+			opts.DiscoveryPrefix = "homeassistant"
+		}
+		if strings.ContainsAny(opts.DiscoveryPrefix, "+#") {
+			return nil, fmt.Errorf("invalid HA_DISCOVERY_PREFIX %q: wildcards are not allowed", opts.DiscoveryPrefix)
+		}
+	}
+	return opts, nil
+}
+
+// loadPushoverConfig reads PUSHOVER_*; the token and user key enable the
+// sink together.
+func loadPushoverConfig() (*PushoverOptions, error) {
+	token, err := secretEnv("PUSHOVER_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	user, err := secretEnv("PUSHOVER_USER")
+	if err != nil {
+		return nil, err
+	}
+	if token == "" && user == "" {
+		return nil, nil
+	}
+	if token == "" || user == "" {
+		return nil, fmt.Errorf("PUSHOVER_TOKEN and PUSHOVER_USER must be set together")
+	}
+	opts := &PushoverOptions{Token: token, User: user}
+	if prioStr := os.Getenv("PUSHOVER_PRIORITY"); prioStr != "" {
+		prio, err := strconv.Atoi(prioStr)
+		if err != nil || prio < -2 || prio > 1 {
+			return nil, fmt.Errorf("invalid PUSHOVER_PRIORITY %q (use -2 to 1)", prioStr)
+		}
+		opts.Priority = prio
+	}
+	return opts, nil
+}
+
+// loadGotifyConfig reads GOTIFY_*; GOTIFY_URL enables the sink.
+func loadGotifyConfig() (*GotifyOptions, error) {
+	rawURL := os.Getenv("GOTIFY_URL")
+	if rawURL == "" {
+		return nil, nil
+	}
+	if err := validateWebhookURL(rawURL); err != nil {
+		return nil, fmt.Errorf("invalid GOTIFY_URL: %w", err)
+	}
+	token, err := secretEnv("GOTIFY_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	opts := &GotifyOptions{URL: rawURL, Token: token, Priority: 5}
+	if opts.Token == "" {
+		return nil, fmt.Errorf("GOTIFY_TOKEN is required with GOTIFY_URL")
+	}
+	if prioStr := os.Getenv("GOTIFY_PRIORITY"); prioStr != "" {
+		prio, err := strconv.Atoi(prioStr)
+		if err != nil || prio < 0 || prio > 10 {
+			return nil, fmt.Errorf("invalid GOTIFY_PRIORITY %q (use 0 to 10)", prioStr)
+		}
+		opts.Priority = prio
+	}
+	return opts, nil
+}
+
+// loadSignalAlertConfig reads SIGNAL_ALERT_*; SIGNAL_ALERT_DBM enables the
+// alert.
+func loadSignalAlertConfig() (*SignalAlertOptions, error) {
+	thresholdStr := os.Getenv("SIGNAL_ALERT_DBM")
+	if thresholdStr == "" {
+		return nil, nil
+	}
+	threshold, err := strconv.Atoi(thresholdStr)
+	// CSQ reports -113 to -51 dBm; a threshold outside can never trigger.
+	if err != nil || threshold <= -113 || threshold > -51 {
+		return nil, fmt.Errorf("invalid SIGNAL_ALERT_DBM %q (use -112 to -51, e.g. -100)", thresholdStr)
+	}
+	opts := &SignalAlertOptions{ThresholdDBm: threshold, After: 10 * time.Minute, HysteresisDB: 6}
+	if afterStr := os.Getenv("SIGNAL_ALERT_AFTER"); afterStr != "" {
+		opts.After, err = time.ParseDuration(afterStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SIGNAL_ALERT_AFTER %q: %w", afterStr, err)
+		}
+		if opts.After < 0 {
+			return nil, fmt.Errorf("invalid SIGNAL_ALERT_AFTER %q: must be >= 0", afterStr)
+		}
+	}
+	if hystStr := os.Getenv("SIGNAL_ALERT_HYSTERESIS"); hystStr != "" {
+		opts.HysteresisDB, err = strconv.Atoi(hystStr)
+		if err != nil || opts.HysteresisDB < 0 {
+			return nil, fmt.Errorf("invalid SIGNAL_ALERT_HYSTERESIS %q: must be >= 0 dB", hystStr)
+		}
+	}
+	return opts, nil
+}
+
+// loadAlertPolicyConfig reads ALERT_COOLDOWNS, ALERT_EVERY_OCCURRENCE and
+// ALERT_FLAP_INTERVAL.
+func loadAlertPolicyConfig() (AlertPolicy, error) {
+	var policy AlertPolicy
+	var err error
+	if policy.Cooldowns, err = parseAlertCooldowns(os.Getenv("ALERT_COOLDOWNS")); err != nil {
+		return AlertPolicy{}, fmt.Errorf("invalid ALERT_COOLDOWNS: %w", err)
+	}
+	if policy.EveryOccurrence, err = parseAlertTypes(os.Getenv("ALERT_EVERY_OCCURRENCE")); err != nil {
+		return AlertPolicy{}, fmt.Errorf("invalid ALERT_EVERY_OCCURRENCE: %w", err)
+	}
+	if flapStr := os.Getenv("ALERT_FLAP_INTERVAL"); flapStr != "" {
+		policy.FlapInterval, err = time.ParseDuration(flapStr)
+		if err != nil {
+			return AlertPolicy{}, fmt.Errorf("invalid ALERT_FLAP_INTERVAL %q: %w", flapStr, err)
+		}
+		if policy.FlapInterval < 0 {
+			return AlertPolicy{}, fmt.Errorf("invalid ALERT_FLAP_INTERVAL %q: must be >= 0", flapStr)
+		}
+	}
+	return policy, nil
+}
+
+// loadSelfTestConfig reads SELFTEST_*; SELFTEST_NUMBER enables the
+// loopback self-test.
+func loadSelfTestConfig() (*SelfTestOptions, error) {
+	number := strings.ReplaceAll(os.Getenv("SELFTEST_NUMBER"), " ", "")
+	if number == "" {
+		return nil, nil
 	}
-
-	var chatIDs []int64
-	if chatIDsStr != "" {
-		seen := make(map[int64]struct{})
-		for _, idStr := range strings.Split(chatIDsStr, ",") {
-			idStr = strings.TrimSpace(idStr)
-			if idStr == "" {
-				continue
-			}
-			id, err := strconv.ParseInt(idStr, 10, 64)
-			if err != nil {
-				return nil, fmt.Errorf("invalid chat ID %q: %w", idStr, err)
-			}
-			if id == 0 {
-				return nil, fmt.Errorf("invalid chat ID %q: 0 is not a valid Telegram chat", idStr)
-			}
-			// Duplicate destinations would double-send every SMS.
-			if _, dup := seen[id]; dup {
-				continue
-			}
-			seen[id] = struct{}{}
-			chatIDs = append(chatIDs, id)
+	if !validDestination(number) {
+		return nil, fmt.Errorf("invalid SELFTEST_NUMBER: not a phone number")
+	}
+	opts := &SelfTestOptions{Number: number, Interval: 24 * time.Hour, Timeout: 10 * time.Minute}
+	var err error
+	if intervalStr := os.Getenv("SELFTEST_INTERVAL"); intervalStr != "" {
+		opts.Interval, err = time.ParseDuration(intervalStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SELFTEST_INTERVAL %q: %w", intervalStr, err)
+		}
+		// Every round costs an SMS.
+		if opts.Interval < 10*time.Minute {
+			return nil, fmt.Errorf("invalid SELFTEST_INTERVAL %q: must be >= 10m", intervalStr)
 		}
 	}
-	if len(chatIDs) == 0 && !dryRun {
-		return nil, fmt.Errorf("at least one chat ID is required")
+	if timeoutStr := os.Getenv("SELFTEST_TIMEOUT"); timeoutStr != "" {
+		opts.Timeout, err = time.ParseDuration(timeoutStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SELFTEST_TIMEOUT %q: %w", timeoutStr, err)
+		}
+		if opts.Timeout <= 0 {
+			return nil, fmt.Errorf("invalid SELFTEST_TIMEOUT %q: must be > 0", timeoutStr)
+		}
 	}
+	if opts.Timeout >= opts.Interval {
+		return nil, fmt.Errorf("SELFTEST_TIMEOUT (%s) must be shorter than SELFTEST_INTERVAL (%s)", opts.Timeout, opts.Interval)
+	}
+	return opts, nil
+}
 
-	serialPort := os.Getenv("SERIAL_PORT")
-	if serialPort == "" {
-		serialPort = "/dev/ttyUSB0"
+// loadOutageSMSConfig reads OUTAGE_SMS_*; OUTAGE_SMS_NUMBER enables the
+// outage SMS.
+func loadOutageSMSConfig() (*OutageSMSOptions, error) {
+	number := strings.ReplaceAll(os.Getenv("OUTAGE_SMS_NUMBER"), " ", "")
+	if number == "" {
+		return nil, nil
+	}
+	if !validDestination(number) {
+		return nil, fmt.Errorf("invalid OUTAGE_SMS_NUMBER: not a phone number")
+	}
+	opts := &OutageSMSOptions{Number: number, After: 30 * time.Minute}
+	if afterStr := os.Getenv("OUTAGE_SMS_AFTER"); afterStr != "" {
+		after, err := time.ParseDuration(afterStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OUTAGE_SMS_AFTER %q: %w", afterStr, err)
+		}
+		// Shorter outages are usually a blip of the network, not worth an SMS.
+		if after < 5*time.Minute || after > 24*time.Hour {
+			return nil, fmt.Errorf("invalid OUTAGE_SMS_AFTER %q: must be between 5m and 24h", afterStr)
+		}
+		opts.After = after
 	}
+	return opts, nil
+}
 
-	baudRate := 115200
-	if baudStr := os.Getenv("BAUD_RATE"); baudStr != "" {
-		var err error
-		baudRate, err = strconv.Atoi(baudStr)
+// loadStatsDConfig reads STATSD_*; STATSD_ADDR enables the push.
+func loadStatsDConfig() (*StatsDOptions, error) {
+	addr := os.Getenv("STATSD_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return nil, fmt.Errorf("invalid STATSD_ADDR %q: must be host:port", addr)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return nil, fmt.Errorf("invalid STATSD_ADDR %q: must be host:port", addr)
+	}
+	opts := &StatsDOptions{Addr: addr, Interval: 10 * time.Second, Format: statsdFormatPlain}
+	if intervalStr := os.Getenv("STATSD_INTERVAL"); intervalStr != "" {
+		opts.Interval, err = time.ParseDuration(intervalStr)
 		if err != nil {
-			return nil, fmt.Errorf("invalid BAUD_RATE %q: %w", baudStr, err)
+			return nil, fmt.Errorf("invalid STATSD_INTERVAL %q: %w", intervalStr, err)
 		}
-		if baudRate <= 0 {
-			return nil, fmt.Errorf("invalid BAUD_RATE %q: must be > 0", baudStr)
+		if opts.Interval < time.Second || opts.Interval > 10*time.Minute {
+			return nil, fmt.Errorf("invalid STATSD_INTERVAL %q: must be between 1s and 10m", intervalStr)
+		}
+	}
+	if format := strings.ToLower(os.Getenv("STATSD_FORMAT")); format != "" {
+		if format != statsdFormatPlain && format != statsdFormatDog {
+			return nil, fmt.Errorf("invalid STATSD_FORMAT %q: must be statsd or dogstatsd", format)
 		}
+		opts.Format = format
 	}
+	return opts, nil
+}
 
-	logLevel := slog.LevelInfo
-	if logLevelStr := os.Getenv("LOG_LEVEL"); logLevelStr != "" {
-		switch strings.ToUpper(logLevelStr) {
-		case "DEBUG":
-			logLevel = slog.LevelDebug
-		case "INFO":
-			logLevel = slog.LevelInfo
-		case "WARN", "WARNING":
-			logLevel = slog.LevelWarn
-		case "ERROR":
-			logLevel = slog.LevelError
-		default:
-			return nil, fmt.Errorf("invalid LOG_LEVEL %q (use DEBUG, INFO, WARN, ERROR)", logLevelStr)
+// loadFileSinkConfig reads FILE_SINK_*; FILE_SINK_PATH enables the sink.
+func loadFileSinkConfig() (*FileSinkOptions, error) {
+	path := os.Getenv("FILE_SINK_PATH")
+	if path == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("invalid FILE_SINK_PATH %q: must be absolute", path)
+	}
+	opts := &FileSinkOptions{Path: path, MaxSize: 10 << 20, Keep: 5}
+	if sizeStr := os.Getenv("FILE_SINK_MAX_MB"); sizeStr != "" {
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid FILE_SINK_MAX_MB %q: must be > 0", sizeStr)
+		}
+		opts.MaxSize = int64(size) << 20
+	}
+	if keepStr := os.Getenv("FILE_SINK_KEEP"); keepStr != "" {
+		keep, err := strconv.Atoi(keepStr)
+		if err != nil || keep < 0 {
+			return nil, fmt.Errorf("invalid FILE_SINK_KEEP %q: must be >= 0", keepStr)
 		}
+		opts.Keep = keep
 	}
+	return opts, nil
+}
 
-	var multipartMaxAge time.Duration
-	if maxAgeStr := os.Getenv("MULTIPART_MAX_AGE"); maxAgeStr != "" {
-		var err error
-		multipartMaxAge, err = time.ParseDuration(maxAgeStr)
+// loadNATSConfig reads NATS_*; NATS_URL enables the sink.
+func loadNATSConfig() (*NATSOptions, error) {
+	rawURL := os.Getenv("NATS_URL")
+	if rawURL == "" {
+		return nil, nil
+	}
+	if _, _, _, err := parseNATSURL(rawURL); err != nil {
+		return nil, fmt.Errorf("invalid NATS_URL: %w", err)
+	}
+	password, err := secretEnv("NATS_PASSWORD")
+	if err != nil {
+		return nil, err
+	}
+	token, err := secretEnv("NATS_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	opts := &NATSOptions{
+		URL:      rawURL,
+		Subject:  os.Getenv("NATS_SUBJECT"),
+		User:     os.Getenv("NATS_USER"),
+		Password: password,
+		Token:    token,
+		Timeout:  10 * time.Second,
+	}
+	if opts.Subject == "" {
+		opts.Subject = "sms.received"
+	}
+	if !validNATSSubject(opts.Subject) {
+		return nil, fmt.Errorf("invalid NATS_SUBJECT %q: wildcards, spaces and empty tokens are not allowed", opts.Subject)
+	}
+	if timeoutStr := os.Getenv("NATS_TIMEOUT"); timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
 		if err != nil {
-			return nil, fmt.Errorf("invalid MULTIPART_MAX_AGE %q: %w", maxAgeStr, err)
+			return nil, fmt.Errorf("invalid NATS_TIMEOUT %q: %w", timeoutStr, err)
 		}
-		if multipartMaxAge < 0 {
-			return nil, fmt.Errorf("invalid MULTIPART_MAX_AGE %q: must be >= 0", maxAgeStr)
+		if timeout <= 0 {
+			return nil, fmt.Errorf("invalid NATS_TIMEOUT %q: must be > 0", timeoutStr)
 		}
+		opts.Timeout = timeout
 	}
+	return opts, nil
+}
 
-	telegramSendTimeout := 20 * time.Second
-	if timeoutStr := os.Getenv("TELEGRAM_SEND_TIMEOUT"); timeoutStr != "" {
-		var err error
-		telegramSendTimeout, err = time.ParseDuration(timeoutStr)
+// loadKafkaConfig reads KAFKA_*; KAFKA_REST_URL enables the sink.
+func loadKafkaConfig() (*KafkaOptions, error) {
+	rawURL := os.Getenv("KAFKA_REST_URL")
+	if rawURL == "" {
+		return nil, nil
+	}
+	if err := validateWebhookURL(rawURL); err != nil {
+		return nil, fmt.Errorf("invalid KAFKA_REST_URL: %w", err)
+	}
+	opts := &KafkaOptions{RESTURL: rawURL, Topic: os.Getenv("KAFKA_TOPIC"), KeyBySender: true}
+	if opts.Topic == "" {
+		opts.Topic = "sms"
+	}
+	switch key := strings.ToLower(os.Getenv("KAFKA_KEY")); key {
+	case "", "sender":
+	case "none":
+		opts.KeyBySender = false
+	default:
+		return nil, fmt.Errorf("invalid KAFKA_KEY %q (use sender or none)", key)
+	}
+	return opts, nil
+}
+
+// loadHTTPTLSConfig reads HTTP_TLS_*: a certificate and key, or a
+// self-signed certificate.
+func loadHTTPTLSConfig() (*HTTPTLSOptions, error) {
+	certFile, keyFile := os.Getenv("HTTP_TLS_CERT"), os.Getenv("HTTP_TLS_KEY")
+	selfStr := os.Getenv("HTTP_TLS_SELF_SIGNED")
+	selfSigned := strings.EqualFold(selfStr, "true") || strings.EqualFold(selfStr, "yes") || selfStr == "1"
+	switch {
+	case selfSigned && (certFile != "" || keyFile != ""):
+		return nil, fmt.Errorf("set either HTTP_TLS_SELF_SIGNED or HTTP_TLS_CERT and HTTP_TLS_KEY, not both")
+	case selfSigned:
+		return &HTTPTLSOptions{SelfSigned: true}, nil
+	case certFile == "" && keyFile == "":
+		return nil, nil
+	case certFile == "" || keyFile == "":
+		return nil, fmt.Errorf("HTTP_TLS_CERT and HTTP_TLS_KEY must be set together")
+	}
+	// Fail at startup, not at the first handshake.
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		return nil, fmt.Errorf("invalid HTTP_TLS_CERT/HTTP_TLS_KEY: %w", err)
+	}
+	return &HTTPTLSOptions{CertFile: certFile, KeyFile: keyFile}, nil
+}
+
+// loadOIDCConfig reads OIDC_*; OIDC_ISSUER enables bearer JWTs.
+func loadOIDCConfig() (*OIDCOptions, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(issuer)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid OIDC_ISSUER %q: must be an https URL", issuer)
+	}
+	opts := &OIDCOptions{
+		Issuer:      issuer,
+		Audience:    os.Getenv("OIDC_AUDIENCE"),
+		GroupsClaim: os.Getenv("OIDC_GROUPS_CLAIM"),
+		AdminGroups: splitList(os.Getenv("OIDC_ADMIN_GROUPS")),
+		ReadGroups:  splitList(os.Getenv("OIDC_READ_GROUPS")),
+	}
+	// Without an audience any token of the provider, issued to any of its
+	// clients, would do.
+	if opts.Audience == "" {
+		return nil, fmt.Errorf("OIDC_ISSUER requires OIDC_AUDIENCE")
+	}
+	if opts.GroupsClaim == "" {
+		opts.GroupsClaim = "groups"
+	}
+	return opts, nil
+}
+
+// loadExecSinkConfig reads EXEC_SINK_*; EXEC_SINK_COMMAND enables the sink.
+func loadExecSinkConfig() (*ExecSinkOptions, error) {
+	command := os.Getenv("EXEC_SINK_COMMAND")
+	if command == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(command) {
+		return nil, fmt.Errorf("invalid EXEC_SINK_COMMAND %q: must be an absolute path (arguments are not supported)", command)
+	}
+	info, err := os.Stat(command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EXEC_SINK_COMMAND: %w", err)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+		return nil, fmt.Errorf("invalid EXEC_SINK_COMMAND %q: not an executable file", command)
+	}
+	opts := &ExecSinkOptions{Command: command, Timeout: 30 * time.Second}
+	if timeoutStr := os.Getenv("EXEC_SINK_TIMEOUT"); timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
 		if err != nil {
-			return nil, fmt.Errorf("invalid TELEGRAM_SEND_TIMEOUT %q: %w", timeoutStr, err)
+			return nil, fmt.Errorf("invalid EXEC_SINK_TIMEOUT %q: %w", timeoutStr, err)
 		}
-		if telegramSendTimeout <= 0 {
-			return nil, fmt.Errorf("invalid TELEGRAM_SEND_TIMEOUT %q: must be > 0", timeoutStr)
+		if timeout <= 0 {
+			return nil, fmt.Errorf("invalid EXEC_SINK_TIMEOUT %q: must be > 0", timeoutStr)
 		}
+		opts.Timeout = timeout
 	}
+	return opts, nil
+}
 
-	networkRegGrace := 90 * time.Second
-	if graceStr := os.Getenv("NETWORK_REG_GRACE"); graceStr != "" {
-		var err error
-		networkRegGrace, err = time.ParseDuration(graceStr)
+// splitList splits a comma-separated list, trimming entries and dropping
+// empty ones.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// secretKeys are the settings read through secretEnv (and the ones Vault
+// may supply).
+var secretKeys = []string{
+	"TELEGRAM_BOT_TOKEN", "API_TOKEN", "API_KEYS", "API_USERS", "MQTT_PASSWORD", "PUSHOVER_TOKEN", "PUSHOVER_USER",
+	"GOTIFY_TOKEN", "NATS_PASSWORD", "NATS_TOKEN", "SENTRY_DSN", "WEBHOOK_SECRET", "SIM_PIN", "TRANSLATE_API_KEY",
+}
+
+// secretEnv reads a secret from key or, for Docker/Kubernetes secret mounts,
+// from the file named by key_FILE (trailing newline stripped), so the value
+// never has to be in the environment. Setting both is an error.
+func secretEnv(key string) (string, error) {
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return os.Getenv(key), nil
+	}
+	if os.Getenv(key) != "" {
+		return "", fmt.Errorf("set either %s or %s_FILE, not both", key, key)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading %s_FILE: %w", key, err)
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("%s_FILE %s is empty", key, path)
+	}
+	return value, nil
+}
+
+// parseIDList parses a comma-separated list of non-zero Telegram IDs,
+// dropping duplicates while keeping order (a duplicate chat would
+// double-send every SMS).
+func parseIDList(s, what string) ([]int64, error) {
+	var ids []int64
+	seen := make(map[int64]struct{})
+	for _, idStr := range strings.Split(s, ",") {
+		idStr = strings.TrimSpace(idStr)
+		if idStr == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(idStr, 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("invalid NETWORK_REG_GRACE %q: %w", graceStr, err)
+			return nil, fmt.Errorf("invalid %s %q: %w", what, idStr, err)
 		}
-		if networkRegGrace < 0 {
-			return nil, fmt.Errorf("invalid NETWORK_REG_GRACE %q: must be >= 0", graceStr)
+		if id == 0 {
+			return nil, fmt.Errorf("invalid %s %q: 0 is not a valid Telegram ID", what, idStr)
 		}
+		if _, dup := seen[id]; dup {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
 	}
+	return ids, nil
+}
 
-	return &Config{
-		TelegramToken:       token,
-		ChatIDs:             chatIDs,
-		SerialPort:          serialPort,
-		BaudRate:            baudRate,
-		LogLevel:            logLevel,
-		DryRun:              dryRun,
-		MultipartMaxAge:     multipartMaxAge,
-		TelegramSendTimeout: telegramSendTimeout,
-		NetworkRegGrace:     networkRegGrace,
-	}, nil
+func setupLogging(cfg *Config) {
+	slog.SetDefault(slog.New(newLogHandler(os.Stderr, cfg)))
 }
 
-func setupLogging(level slog.Level) {
+// newLogHandler builds the handler for LOG_FORMAT: logfmt text for the
+// journal, or one JSON object per line for Loki/ELK shippers. Entries about
+// one SMS carry its trace ID.
+func newLogHandler(w io.Writer, cfg *Config) slog.Handler {
 	opts := &slog.HandlerOptions{
-		Level: level,
+		Level:     cfg.LogLevel,
+		AddSource: cfg.LogSource,
+	}
+	if cfg.LogPrivacy {
+		opts.ReplaceAttr = redactLogAttr
+	}
+	if cfg.LogFormat == "json" {
+		return traceHandler{slog.NewJSONHandler(w, opts)}
 	}
-	handler := slog.NewTextHandler(os.Stderr, opts)
-	slog.SetDefault(slog.New(handler))
+	return traceHandler{slog.NewTextHandler(w, opts)}
 }
 
 // parseCPIN extracts the exact +CPIN status value.
@@ -252,6 +1815,21 @@ func parseCSQ(lines []string) (int, bool) {
 	return 0, false
 }
 
+// parseCOPS extracts the operator name of a +COPS? response; empty when
+// the modem is not registered.
+func parseCOPS(lines []string) string {
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "+COPS:") {
+			continue
+		}
+		first, last := strings.IndexByte(line, '"'), strings.LastIndexByte(line, '"')
+		if first >= 0 && last > first {
+			return line[first+1 : last]
+		}
+	}
+	return ""
+}
+
 // parseCREG extracts the registration status field of a +CREG response.
 func parseCREG(lines []string) (int, bool) {
 	for _, line := range lines {
@@ -277,7 +1855,7 @@ func runModemDiagnostics(ctx context.Context, modem ATCommander, sessionStart ti
 	slog.Info("Testing modem connection...")
 
 	if resp, cmdErr := modem.Command("AT"); cmdErr != nil {
-		if IsTimeoutError(cmdErr) {
+		if at.IsTimeoutError(cmdErr) {
 			return NewSessionError(cmdErr)
 		}
 		slog.Error("Modem not responding to AT command", "error", cmdErr)
@@ -290,6 +1868,7 @@ func runModemDiagnostics(ctx context.Context, modem ATCommander, sessionStart ti
 	// Modem info is best-effort.
 	if resp, err := modem.Command("ATI"); err == nil {
 		slog.Info("Modem info", "model", strings.Join(resp, " "))
+		setModemIdentity(parseATI(resp))
 	}
 
 	// SIM status. The SIM may take a few seconds to initialize after
@@ -308,14 +1887,14 @@ func runModemDiagnostics(ctx context.Context, modem ATCommander, sessionStart ti
 			cpinStatus = status
 			break
 		}
-		if IsTimeoutError(err) {
+		if at.IsTimeoutError(err) {
 			return NewSessionError(err)
 		}
 		if attempt >= 5 {
 			// AT+CPIN? still returns ERROR - check physical presence.
 			ccidResp, ccidErr := modem.Command("AT+CCID")
 			if ccidErr != nil {
-				if IsTimeoutError(ccidErr) {
+				if at.IsTimeoutError(ccidErr) {
 					return NewSessionError(ccidErr)
 				}
 				slog.Error("SIM card not detected", "cpin_error", err, "ccid_error", ccidErr)
@@ -355,7 +1934,7 @@ func runModemDiagnostics(ctx context.Context, modem ATCommander, sessionStart ti
 	checkRadio := func() (rssi, cregStat int, err error) {
 		resp, e := modem.Command("AT+CSQ")
 		if e != nil {
-			if IsTimeoutError(e) {
+			if at.IsTimeoutError(e) {
 				return 0, 0, NewSessionError(e)
 			}
 			return 0, 0, NewDiagnosticError(ErrTypeModemNotResponding, "AT+CSQ failed: %v", e)
@@ -368,7 +1947,7 @@ func runModemDiagnostics(ctx context.Context, modem ATCommander, sessionStart ti
 
 		resp, e = modem.Command("AT+CREG?")
 		if e != nil {
-			if IsTimeoutError(e) {
+			if at.IsTimeoutError(e) {
 				return 0, 0, NewSessionError(e)
 			}
 			return 0, 0, NewDiagnosticError(ErrTypeModemNotResponding, "AT+CREG? failed: %v", e)
@@ -423,57 +2002,381 @@ func runModemDiagnostics(ctx context.Context, modem ATCommander, sessionStart ti
 			slog.Info("Waiting for network registration/signal", "grace", networkGrace, "elapsed", elapsed)
 			waitedForNetwork = true
 		}
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-clk.After(wait):
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clk.After(wait):
+		}
+	}
+
+	return nil
+}
+
+func run(ctx context.Context, cfg *Config, reloader *ConfigReloader) error {
+	// The dashboard's log tail sees everything logged from here on.
+	var logTail *LogTail
+	if cfg.Dashboard {
+		logTail = NewLogTail(cfg)
+		slog.SetDefault(slog.New(logTail.Wrap(slog.Default().Handler())))
+	}
+
+	// Get hostname for error notifications; INSTANCE_NAME replaces it.
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "unknown"
+	}
+	if cfg.Instance != nil {
+		hostname = cfg.Instance.Name
+	}
+
+	// Initialize Telegram bot (unless dry run).
+	// The sender is a nil interface in dry-run so nil checks work; a typed-nil
+	// *bot.Bot inside the interface would defeat them.
+	var sender TelegramSender
+	var tgBot *bot.Bot
+	if !cfg.DryRun {
+		var err error
+		tgBot, err = newTelegramBot(cfg.TelegramToken, bot.WithSkipGetMe(),
+			bot.WithErrorsHandler(func(err error) {
+				// Transport errors embed the request URL, which carries the token.
+				slog.Warn("Telegram update polling error",
+					"error", strings.ReplaceAll(err.Error(), cfg.TelegramToken, "<token>"))
+			}))
+		if err != nil {
+			return fmt.Errorf("failed to create telegram bot: %w", err)
+		}
+		sender = tgBot
+		slog.Info("Telegram bot initialized")
+	} else {
+		slog.Warn("Running in DRY_RUN mode - messages will not be sent to Telegram")
+	}
+	// Every Telegram send is watched for an outage, alerts and bot replies
+	// included. DRY_RUN sends nothing to watch.
+	var outage *TelegramOutage
+	if cfg.OutageSMS != nil && tgBot != nil {
+		outage = NewTelegramOutage(tgBot, tgBot, *cfg.OutageSMS)
+		sender = outage
+	} else if cfg.OutageSMS != nil {
+		slog.Warn("DRY_RUN: outage SMS disabled")
+	}
+
+	blocklist, err := NewSenderBlocklist(cfg.BlockedSenders, cfg.StateDir)
+	if err != nil {
+		return err
+	}
+
+	// Create error notifier for sending diagnostic errors to Telegram
+	notifier := NewErrorNotifier(sender, cfg.ChatIDs, cfg.DryRun, hostname, cfg.TelegramSendTimeout)
+	notifier.instance = cfg.Instance
+	if cfg.EventLog != "" {
+		events, err := NewEventLog(cfg.EventLog, cfg.EventLogText, cfg.LogPrivacy)
+		if err != nil {
+			return err
+		}
+		notifier.events = events
+	}
+	if cfg.MQTT != nil && cfg.MQTT.DiscoveryPrefix != "" {
+		notifier.ha = NewHomeAssistant(*cfg.MQTT, hostname, cfg.DryRun)
+		notifier.ha.Announce(ctx)
+	}
+	if cfg.HealthcheckURL != "" {
+		notifier.pinger = NewHealthPinger(cfg.HealthcheckURL, cfg.HealthcheckInterval, cfg.DryRun)
+		go notifier.pinger.Run(ctx)
+	}
+	if cfg.SentryDSN != "" {
+		notifier.sentry, err = NewSentryReporter(cfg.SentryDSN, cfg.SentryEnvironment, hostname, cfg.DryRun)
+		if err != nil {
+			return err
+		}
+		// Covers the modem goroutine: run drives the modem loop itself.
+		defer notifier.sentry.RecoverPanic()
+	}
+	notifier.systemd, err = NewSystemdNotifier()
+	if err != nil {
+		return err
+	}
+	defer notifier.systemd.Stopping()
+	// The watchdog shares the liveness check of /healthz.
+	if cfg.HTTPListen != "" || notifier.systemd.watchdogEnabled() {
+		var prober TelegramProber
+		if tgBot != nil {
+			prober = tgBot
+		}
+		notifier.health = NewHealthState(prober)
+		notifier.health.modemOnly = cfg.Kubernetes
+		if notifier.systemd.watchdogEnabled() {
+			go notifier.systemd.RunWatchdog(ctx, notifier.health.Live)
+		}
+	}
+	if cfg.HTTPListen != "" || len(cfg.AdminIDs) > 0 || cfg.StatsD != nil {
+		notifier.metrics = NewMetrics()
+		notifier.metrics.labels = cfg.Instance.labelPairs()
+	}
+	if cfg.StatsD != nil {
+		go NewStatsDPusher(*cfg.StatsD, notifier.metrics).Run(ctx)
+	}
+	notifier.signalAlert = cfg.SignalAlert
+	notifier.batteryAlert = cfg.BatteryAlertPercent
+	notifier.reminderInterval = cfg.AlertReminder
+	notifier.policy = cfg.AlertPolicy
+
+	// The deliverer keeps per-chat cooldowns and the rejected-message set
+	// across modem session reopens.
+	deliverer := NewDeliverer(sender, notifier, cfg)
+	deliverer.blocklist = blocklist
+	if tgBot != nil {
+		deliverer.telegram.docs = tgBot
+	}
+	if notifier.events != nil {
+		deliverer.AddSink(&EventLogSink{events: notifier.events})
+	}
+	// DRY_RUN posts nothing, so nothing fails and needs a retry.
+	var webhookQueue *WebhookQueue
+	if cfg.WebhookRetryMaxAge > 0 && !cfg.DryRun {
+		webhookQueue = NewWebhookQueue(cfg.StateDir, cfg.WebhookRetryMaxAge, notifier)
+	}
+	for i, u := range cfg.WebhookURLs {
+		sink := NewWebhookSink(fmt.Sprintf("webhook%d", i+1), u, cfg)
+		webhookQueue.Attach(sink)
+		deliverer.AddSink(sink)
+	}
+	if webhookQueue != nil {
+		if err := webhookQueue.Load(); err != nil {
+			return err
+		}
+		go webhookQueue.Run(ctx)
+	}
+	if cfg.MQTT != nil {
+		deliverer.AddSink(NewMQTTSink(*cfg.MQTT, cfg.DryRun))
+	}
+	if cfg.Pushover != nil {
+		deliverer.AddSink(NewPushoverSink(*cfg.Pushover, cfg))
+	}
+	if cfg.Gotify != nil {
+		deliverer.AddSink(NewGotifySink(*cfg.Gotify, cfg))
+	}
+	if cfg.FileSink != nil {
+		deliverer.AddSink(NewFileSink(*cfg.FileSink, cfg.DryRun))
+	}
+	if cfg.NATS != nil {
+		deliverer.AddSink(NewNATSSink(*cfg.NATS, cfg.DryRun))
+	}
+	if cfg.Kafka != nil {
+		deliverer.AddSink(NewKafkaSink(*cfg.Kafka, cfg))
+	}
+	if cfg.ExecSink != nil {
+		deliverer.AddSink(NewExecSink(*cfg.ExecSink, cfg.DryRun))
+	}
+
+	// Outgoing SMS are only accepted when an API allows sending or the
+	// self-test, the relay or the outage SMS needs them.
+	var outbox *Outbox
+	if cfg.GRPCAllowSend || cfg.DashboardAllowSend || cfg.SelfTest != nil || cfg.RelayNumber != "" || outage != nil {
+		outbox = NewOutbox(cfg.DryRun)
+	}
+	if outage != nil {
+		outage.outbox, outage.notifier = outbox, notifier
+		go outage.Run(ctx)
+	}
+	if cfg.RelayNumber != "" {
+		deliverer.AddSink(NewRelaySink(cfg.RelayNumber, outbox))
+	}
+	// The HTTP and the gRPC API share the credentials.
+	var oidc *OIDCVerifier
+	if cfg.OIDC != nil {
+		oidc = NewOIDCVerifier(*cfg.OIDC)
+	}
+	auth := NewAPIAuth(cfg.APIToken, cfg.APIUsers, oidc)
+	auth.SetKeys(cfg.APIKeys)
+	if cfg.GRPCListen != "" {
+		if !loopbackListen(cfg.GRPCListen) {
+			slog.Warn("gRPC API serves cleartext HTTP/2 beyond localhost: credentials and SMS cross the network unencrypted",
+				"addr", cfg.GRPCListen)
+		}
+		broadcaster := NewSMSBroadcaster()
+		deliverer.AddSink(broadcaster)
+		ln, err := net.Listen("tcp", cfg.GRPCListen)
+		if err != nil {
+			return fmt.Errorf("gRPC listen: %w", err)
+		}
+		var grpcOutbox *Outbox
+		if cfg.GRPCAllowSend {
+			grpcOutbox = outbox
+		}
+		grpcServer := NewGRPCServer(broadcaster, grpcOutbox, auth)
+		go func() {
+			if err := grpcServer.Serve(ctx, ln); err != nil {
+				slog.Error("gRPC API stopped", "error", err)
+			}
+		}()
+	}
+
+	var archive *MessageArchive
+	if cfg.Archive {
+		archive = NewMessageArchive(filepath.Join(cfg.StateDir, archiveFileName))
+		deliverer.archive = archive
+	}
+	if cfg.AuditLog != "" {
+		deliverer.audit = NewAuditLog(cfg.AuditLog, hostname, cfg.LogPrivacy)
+	}
+	if cfg.PDUSampleFile != "" {
+		deliverer.samples = NewPDUSampleFile(cfg.PDUSampleFile)
+	}
+	deliverer.deletions = NewDeletionCheck(cfg.DeleteVerify, notifier.metrics)
+	if cfg.LatencyReport {
+		deliverer.latency = NewLatencyTracker()
+		defer deliverer.latency.LogSummary()
+	}
+	// DRY_RUN keeps every SMS on the SIM and forgets it after each poll:
+	// nothing worth persisting, and nothing was really forwarded.
+	if !cfg.DryRun {
+		if cfg.StateDir != "" {
+			deliverer.restoreProgress(NewDeliveryProgress(cfg.StateDir))
+		}
+		deliverer.delivered = NewDeliveredStore(cfg.StateDir)
+		if cfg.StateDir != "" {
+			deliverer.quarantine = NewPDUQuarantine(filepath.Join(cfg.StateDir, quarantineDirName))
+		}
+	}
+	if cfg.SelfTest != nil {
+		if cfg.DryRun {
+			// The test SMS would never be deleted and nothing really sent.
+			slog.Warn("DRY_RUN: loopback self-test disabled")
+		} else {
+			deliverer.selfTest = NewSelfTest(*cfg.SelfTest, outbox, notifier)
+			go deliverer.selfTest.Run(ctx)
+		}
+	}
+	if cfg.HTTPListen != "" {
+		ln, err := net.Listen("tcp", cfg.HTTPListen)
+		if err != nil {
+			return fmt.Errorf("HTTP API listen: %w", err)
+		}
+		auth.limiter = newRateLimiter(cfg.APIRateLimit)
+		apiServer := NewAPIServer(archive, notifier.health, auth)
+		if cfg.HTTPTLS != nil {
+			if apiServer.tls, err = newHTTPTLSConfig(*cfg.HTTPTLS, cfg.StateDir, cfg.HTTPListen); err != nil {
+				ln.Close()
+				return fmt.Errorf("HTTP API TLS: %w", err)
+			}
+		} else if !loopbackListen(cfg.HTTPListen) {
+			slog.Warn("HTTP API serves plain HTTP beyond localhost: credentials and SMS cross the network unencrypted; set HTTP_TLS_CERT or HTTP_TLS_SELF_SIGNED",
+				"addr", cfg.HTTPListen)
+		}
+		apiServer.metrics = notifier.metrics
+		if cfg.InjectAPI {
+			if !cfg.DryRun {
+				slog.Warn("INJECT_API without DRY_RUN: injected SMS are forwarded to every configured sink")
+			}
+			deliverer.injector = NewInjector()
+			apiServer.EnableInject(deliverer.injector)
+		}
+		if cfg.Dashboard {
+			opts := DashboardOptions{
+				Status: StatusSources{
+					Notifier: notifier,
+					Outbox:   outbox,
+					SelfTest: deliverer.selfTest,
+					Webhooks: webhookQueue,
+					Build:    currentBuildInfo(),
+				},
+				Logs: logTail,
+			}
+			if cfg.DashboardAllowSend {
+				opts.Outbox = outbox
+			}
+			apiServer.EnableDashboard(opts)
+		}
+		go func() {
+			if err := apiServer.Serve(ctx, ln); err != nil {
+				slog.Error("HTTP API stopped", "error", err)
+			}
+		}()
+	}
+
+	// Bot commands are served from the bot's own update goroutines; they
+	// never touch the serial port (eSIM, PIN and DTMF requests go to the
+	// modem goroutine).
+	var esim *ESIMManager
+	var pins *PINManager
+	var dtmf *DTMFManager
+	if tgBot != nil && len(cfg.AdminIDs) > 0 {
+		router := NewCommandRouter(sender, cfg.AdminIDs, cfg.TelegramSendTimeout)
+		registerBlocklistCommands(router, blocklist)
+		esim = NewESIMManager()
+		registerESIMCommands(router, esim)
+		pins = NewPINManager()
+		registerPINCommands(router, pins)
+		dtmf = NewDTMFManager()
+		registerDTMFCommands(router, dtmf)
+		registerStatusCommand(router, StatusSources{
+			Notifier: notifier,
+			Outbox:   outbox,
+			SelfTest: deliverer.selfTest,
+			Webhooks: webhookQueue,
+			Build:    currentBuildInfo(),
+		})
+		registerDiagCommand(router, notifier.metrics, tgBot)
+		if archive != nil {
+			registerExportCommand(router, archive, tgBot)
 		}
+		tgBot.RegisterHandlerMatchFunc(func(*models.Update) bool { return true },
+			func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+				router.HandleUpdate(ctx, update)
+			})
+		go tgBot.Start(ctx)
+		go router.PublishMenu(ctx, tgBot)
+		slog.Info("Bot commands enabled", "admins", len(cfg.AdminIDs))
+	} else if len(cfg.AdminIDs) > 0 {
+		slog.Warn("TELEGRAM_ADMIN_IDS ignored in DRY_RUN mode - bot commands disabled")
 	}
 
-	// Operator info is best-effort.
-	if resp, err := modem.Command("AT+COPS?"); err == nil {
-		slog.Info("Operator", "response", strings.Join(resp, " "))
+	if cfg.StartupNotify {
+		notifier.NotifyStartup(ctx, currentBuildInfo())
 	}
-
-	return nil
-}
-
-func run(ctx context.Context, cfg *Config) error {
-	// Get hostname for error notifications
-	hostname, _ := os.Hostname()
-	if hostname == "" {
-		hostname = "unknown"
+	// In the background: a slow Bot API must not delay the first poll.
+	if tgBot != nil {
+		go validateChats(ctx, cfg, tgBot, notifier)
 	}
 
-	// Initialize Telegram bot (unless dry run).
-	// The sender is a nil interface in dry-run so nil checks work; a typed-nil
-	// *bot.Bot inside the interface would defeat them.
-	var sender TelegramSender
-	if !cfg.DryRun {
-		tgBot, err := bot.New(cfg.TelegramToken, bot.WithSkipGetMe())
-		if err != nil {
-			return fmt.Errorf("failed to create telegram bot: %w", err)
-		}
-		sender = tgBot
-		slog.Info("Telegram bot initialized")
-	} else {
-		slog.Warn("Running in DRY_RUN mode - messages will not be sent to Telegram")
+	// With SHUTDOWN_TIMEOUT the modem loop and the delivery goroutine run on
+	// loopCtx, which outlives the shutdown signal until the queue drained.
+	loopCtx := ctx
+	var stopLoop context.CancelFunc
+	if cfg.ShutdownTimeout > 0 {
+		loopCtx, stopLoop = context.WithCancel(context.WithoutCancel(ctx))
+		defer stopLoop()
 	}
 
-	// Create error notifier for sending diagnostic errors to Telegram
-	notifier := NewErrorNotifier(sender, cfg.ChatIDs, cfg.DryRun, hostname, cfg.TelegramSendTimeout)
-
-	// The deliverer keeps per-chat cooldowns and the rejected-message set
-	// across modem session reopens.
-	deliverer := NewDeliverer(sender, notifier, cfg)
+	// Telegram and the other sinks are served from their own goroutine: a
+	// slow or unreachable destination must not stop the SIM polling.
+	deliverer.StartQueue(loopCtx, reloader)
+	if cfg.ShutdownTimeout > 0 {
+		go drainOnShutdown(ctx, loopCtx, stopLoop, deliverer.queue, cfg.ShutdownTimeout)
+	}
 
-	// Retry interval for modem connection issues
-	retryInterval := 30 * time.Second
+	// Failed sessions back off exponentially: a dead USB device must not be
+	// reopened (and logged) every few seconds for hours.
+	backoff := newReconnectBackoff(cfg.ModemRetryInterval, cfg.ModemRetryMax)
 	// Transient session failures retry faster until the alert threshold.
-	sessionRetryInterval := 5 * time.Second
+	sessionRetryInterval := min(5*time.Second, cfg.ModemRetryInterval)
 
 	// Track if we need to reset modem on next attempt
 	needReset := false
+	// The SMS storage outlives the sessions: one that failed is not retried
+	// first on every reopen.
+	storage := newSMSStorage(cfg.SMSStorage, deliverer.queue)
+	// So does the reception strategy: firmware that ignored the new SMS
+	// indications once is polled for the rest of the run.
+	deliverer.reception = newReception(cfg.ReceptionMode)
+	deliverer.cells = newCellTracker(cfg.CellTracking, notifier.metrics)
+	if cfg.GroupWindow > 0 {
+		deliverer.grouping = newSenderGrouping(cfg.GroupWindow)
+	}
+	deliverer.rotation = newSIMRotation(cfg.SIMRotation, cfg.SIMRotationSchedule)
+	deliverer.calls = newCallRejecter(cfg.CallReject, cfg.DryRun)
+	// Every session may need SIM_PIN; it is zeroed when the run ends.
+	defer cfg.SIMPIN.wipe()
 
 	// A single failed session (timeout, poisoned stream) is reopened quietly;
 	// only several consecutive failures mean the modem is really gone.
@@ -483,15 +2386,7 @@ func run(ctx context.Context, cfg *Config) error {
 	onHealthy := func() {
 		consecutiveSessionFailures = 0
 		escalator.Healthy()
-	}
-
-	wait := func(d time.Duration) bool {
-		select {
-		case <-ctx.Done():
-			return false
-		case <-clk.After(d):
-			return true
-		}
+		backoff.Reset()
 	}
 
 	// Main loop with retry logic
@@ -504,10 +2399,12 @@ func run(ctx context.Context, cfg *Config) error {
 		}
 
 		// Try to run the modem polling loop
-		err := runModemLoop(ctx, cfg, deliverer, notifier, needReset, onHealthy)
+		notifier.health.Progress()
+		notifier.systemd.Status("Opening modem session")
+		err := runModemLoop(loopCtx, cfg, deliverer, notifier, outbox, esim, pins, dtmf, storage, needReset, onHealthy)
 
 		if err == nil {
-			// Normal exit (context cancelled)
+			// Normal exit (context cancelled, queue drained)
 			return nil
 		}
 
@@ -530,8 +2427,21 @@ func run(ctx context.Context, cfg *Config) error {
 			}
 
 			// Wait before retry
-			slog.Info("Will retry modem connection", "retry_in", retryInterval)
-			if !wait(retryInterval) {
+			retryIn := backoff.Next()
+			slog.Info("Will retry modem connection", "retry_in", retryIn, "consecutive_failures", backoff.Failures())
+			if !sleepCtx(ctx, retryIn) {
+				return nil
+			}
+			continue
+		}
+
+		// An eSIM profile switch or a SIM rotation ends the session on
+		// purpose: the modem reloads the SIM, then the session is opened
+		// again. A new slot is only read after the AT+CFUN cycle.
+		if errors.Is(err, errESIMSwitched) || errors.Is(err, errSIMRotated) {
+			slog.Info("Reopening the modem session after the SIM change")
+			needReset = errors.Is(err, errSIMRotated)
+			if !sleepCtx(ctx, sessionRetryInterval) {
 				return nil
 			}
 			continue
@@ -541,6 +2451,7 @@ func run(ctx context.Context, cfg *Config) error {
 		var sessErr *SessionError
 		if errors.As(err, &sessErr) {
 			consecutiveSessionFailures++
+			notifier.ModemDown("modem session lost, reopening")
 			slog.Error("Modem session error",
 				"error", sessErr.Err,
 				"consecutive", consecutiveSessionFailures,
@@ -550,10 +2461,12 @@ func run(ctx context.Context, cfg *Config) error {
 			if consecutiveSessionFailures >= sessionFailureAlertThreshold {
 				notifier.NotifyError(ctx, NewDiagnosticError(ErrTypeModemNotResponding,
 					"Modem session failed %d times in a row: %v", consecutiveSessionFailures, sessErr.Err))
-				if !wait(retryInterval) {
+				retryIn := backoff.Next()
+				slog.Info("Will retry modem connection", "retry_in", retryIn, "consecutive_failures", backoff.Failures())
+				if !sleepCtx(ctx, retryIn) {
 					return nil
 				}
-			} else if !wait(sessionRetryInterval) {
+			} else if !sleepCtx(ctx, sessionRetryInterval) {
 				return nil
 			}
 			continue
@@ -561,8 +2474,11 @@ func run(ctx context.Context, cfg *Config) error {
 
 		// Non-diagnostic error - log and retry (no reset needed)
 		slog.Error("Modem loop error", "error", err)
+		notifier.ModemDown("modem loop error")
 		needReset = false
-		if !wait(retryInterval) {
+		retryIn := backoff.Next()
+		slog.Info("Will retry modem connection", "retry_in", retryIn, "consecutive_failures", backoff.Failures())
+		if !sleepCtx(ctx, retryIn) {
 			return nil
 		}
 	}
@@ -573,30 +2489,29 @@ func run(ctx context.Context, cfg *Config) error {
 // CMGL transcript would be misparsed, with the wrong storage selected the tool
 // would inspect (and delete from) the wrong message store, and with delivery
 // URCs enabled the modem could interleave +CMT frames into responses.
-// Returns the SIM storage usage reported by CPMS (used, total; -1 if unknown).
-func initModemSession(modem ATCommander) (simUsed, simTotal int, err error) {
+// Returns the first usable storage of storages with its usage reported by
+// CPMS (Used and Total -1 if unknown). With textFallback a modem that
+// refuses PDU mode gets a text-mode session (see enableTextMode).
+func initModemSession(modem ATCommander, storages []string, charset string, textFallback bool) (modemSession, error) {
 	// Synchronize: absorb boot banners/garbage until the modem answers AT.
 	var lastErr error
 	for i := 0; i < 3; i++ {
 		if _, lastErr = modem.Command("AT"); lastErr == nil {
 			break
 		}
-		if IsTimeoutError(lastErr) {
-			return -1, -1, NewSessionError(lastErr)
+		if at.IsTimeoutError(lastErr) {
+			return modemSession{}, NewSessionError(lastErr)
 		}
 	}
 	if lastErr != nil {
-		return -1, -1, NewDiagnosticError(ErrTypeModemNotResponding,
+		return modemSession{}, NewDiagnosticError(ErrTypeModemNotResponding,
 			"Modem not responding during session init: %v", lastErr)
 	}
 
-	required := func(cmd string) ([]string, error) {
-		resp, cmdErr := modem.Command(cmd)
-		if cmdErr == nil {
-			return resp, nil
-		}
-		if IsTimeoutError(cmdErr) {
-			return nil, NewSessionError(cmdErr)
+	// initFailure classifies a failed mandatory command.
+	initFailure := func(cmd string, cmdErr error) error {
+		if at.IsTimeoutError(cmdErr) {
+			return NewSessionError(cmdErr)
 		}
 		// A modem ERROR on a mandatory SMS command is most often a missing or
 		// not-ready SIM (on SIM800 firmware AT+CMGF=0 returns ERROR with no
@@ -605,51 +2520,123 @@ func initModemSession(modem ATCommander) (simUsed, simTotal int, err error) {
 		// Failed, and so it inherits the SIM reset-and-recover path.
 		ready, probeErr := simReadyProbe(modem)
 		if probeErr != nil {
-			return nil, probeErr // transport failure → SessionError
+			return probeErr // transport failure → SessionError
 		}
 		if !ready {
-			return nil, NewDiagnosticError(ErrTypeSimNotDetected,
+			return NewDiagnosticError(ErrTypeSimNotDetected,
 				"SIM not ready (mandatory init command %s returned ERROR)", cmd)
 		}
-		return nil, NewDiagnosticError(ErrTypeModemInitFailed,
+		return NewDiagnosticError(ErrTypeModemInitFailed,
 			"Mandatory init command %s failed: %v", cmd, cmdErr)
 	}
+	required := func(cmd string) ([]string, error) {
+		resp, cmdErr := modem.Command(cmd)
+		if cmdErr != nil {
+			return nil, initFailure(cmd, cmdErr)
+		}
+		return resp, nil
+	}
 
 	if _, err := required("ATE0"); err != nil {
-		return -1, -1, err
+		return modemSession{}, err
 	}
 
-	if _, err := required("AT+CMGF=0"); err != nil {
-		return -1, -1, err
-	}
-	// Query the mode back: a modem that silently kept text mode would make the
-	// pipeline parse text output as PDUs.
-	if resp, err := required("AT+CMGF?"); err != nil {
-		return -1, -1, err
+	textMode := false
+	if _, pduErr := modem.Command("AT+CMGF=0"); pduErr != nil {
+		if !textFallback || !at.IsModemError(pduErr) {
+			return modemSession{}, initFailure("AT+CMGF=0", pduErr)
+		}
+		var err error
+		if textMode, err = enableTextMode(modem); err != nil {
+			return modemSession{}, err
+		}
+		if !textMode {
+			return modemSession{}, initFailure("AT+CMGF=0", pduErr)
+		}
+	} else if resp, err := required("AT+CMGF?"); err != nil {
+		// Query the mode back: a modem that silently kept text mode would
+		// make the pipeline parse text output as PDUs.
+		return modemSession{}, err
 	} else if joined := strings.Join(resp, " "); !strings.Contains(joined, "+CMGF: 0") {
-		return -1, -1, NewDiagnosticError(ErrTypeModemInitFailed,
+		return modemSession{}, NewDiagnosticError(ErrTypeModemInitFailed,
 			"PDU mode not active after AT+CMGF=0 (got %q)", joined)
 	}
 
-	cpmsResp, err := required(`AT+CPMS="SM","SM","SM"`)
+	storage, err := selectStorage(modem, storages, initFailure)
 	if err != nil {
-		return -1, -1, err
+		return modemSession{}, err
 	}
-	simUsed, simTotal = parseCPMSCounts(cpmsResp)
 
 	// Suppress SMS delivery indications while polling; +CMT/+CMTI frames
 	// interleaved into a CMGL transcript are a data-loss hazard.
 	if _, cnmiErr := modem.Command("AT+CNMI=2,0,0,0,0"); cnmiErr != nil {
-		if IsTimeoutError(cnmiErr) {
-			return simUsed, simTotal, NewSessionError(cnmiErr)
+		if at.IsTimeoutError(cnmiErr) {
+			return modemSession{}, NewSessionError(cnmiErr)
 		}
 		if _, fallbackErr := required("AT+CNMI=0,0,0,0,0"); fallbackErr != nil {
-			return simUsed, simTotal, fallbackErr
+			return modemSession{}, fallbackErr
+		}
+	}
+
+	// TE character set (MODEM_CHARSET), set after the commands with string
+	// parameters, which are sent plain. Verified: a firmware that ignores
+	// it would garble the text fields of its responses. Text mode needs
+	// UCS2 for a checkable listing.
+	if textMode && charset != charsetUCS2 {
+		if charset != "" {
+			slog.Warn("MODEM_CHARSET ignored: text mode needs UCS2", "charset", charset)
+		}
+		charset = charsetUCS2
+	}
+	if charset != "" {
+		if _, err := required(fmt.Sprintf(`AT+CSCS="%s"`, charset)); err != nil {
+			return modemSession{}, err
+		}
+		resp, err := required("AT+CSCS?")
+		if err != nil {
+			return modemSession{}, err
+		}
+		if got := decodeTEString(parseCSCS(resp), charset); got != charset {
+			return modemSession{}, NewDiagnosticError(ErrTypeModemInitFailed,
+				"Character set %s not active after AT+CSCS (got %q)", charset, got)
 		}
 	}
 
-	slog.Info("Modem session initialized", "sim_used", simUsed, "sim_total", simTotal)
-	return simUsed, simTotal, nil
+	slog.Info("Modem session initialized", "storage", storage.Name, "sim_used", storage.Used, "sim_total", storage.Total, "text_mode", textMode)
+	return modemSession{SIMStorage: storage, Charset: charset, TextMode: textMode}, nil
+}
+
+// modemSession is what initModemSession set up.
+type modemSession struct {
+	SIMStorage
+	Charset string // TE character set; "" if left as the modem had it
+	// TextMode: the modem refused PDU mode; SMS are listed in text mode
+	// and cannot be sent.
+	TextMode bool
+}
+
+// enableTextMode switches a modem that refused AT+CMGF=0 to text mode, with
+// the header parameters (AT+CSDH=1) that ParseTextListing needs; UCS2 is
+// set with the character set. It reports false when the modem refuses that
+// too: the refused PDU mode is then the session's init failure. Only a
+// transport error is returned.
+func enableTextMode(modem ATCommander) (bool, error) {
+	for _, cmd := range []string{"AT+CMGF=1", "AT+CMGF?", "AT+CSDH=1"} {
+		resp, err := modem.Command(cmd)
+		if at.IsTimeoutError(err) {
+			return false, NewSessionError(err)
+		}
+		if err != nil {
+			slog.Debug("Text mode unavailable", "command", cmd, "error", err)
+			return false, nil
+		}
+		if joined := strings.Join(resp, " "); cmd == "AT+CMGF?" && !strings.Contains(joined, "+CMGF: 1") {
+			slog.Warn("Text mode not active after AT+CMGF=1", "got", joined)
+			return false, nil
+		}
+	}
+	slog.Warn("Modem refused PDU mode - listing SMS in text mode (no multipart reassembly, no outgoing SMS)")
+	return true, nil
 }
 
 // resetEscalator forces a last-resort AT+CFUN reset when the same diagnostic
@@ -683,6 +2670,43 @@ func (e *resetEscalator) Healthy() {
 	e.streak = 0
 }
 
+// reconnectBackoff spaces out modem session retries: the wait doubles from
+// base up to limit with every consecutive failure, with equal jitter (half
+// fixed, half random) so a flapping device does not reconnect in lockstep.
+// A healthy session resets it.
+type reconnectBackoff struct {
+	base, limit time.Duration
+	failures    int
+	// jitter returns a random duration in [0, n); swapped by tests.
+	jitter func(n int64) int64
+}
+
+func newReconnectBackoff(base, limit time.Duration) *reconnectBackoff {
+	return &reconnectBackoff{base: base, limit: limit, jitter: rand.Int64N}
+}
+
+// Next records a failure and returns how long to wait before retrying.
+func (b *reconnectBackoff) Next() time.Duration {
+	d := b.base
+	for i := 0; i < b.failures && d < b.limit; i++ {
+		d *= 2
+	}
+	d = min(d, b.limit)
+	b.failures++
+	half := d / 2
+	return half + time.Duration(b.jitter(int64(d-half)+1))
+}
+
+// Failures returns the number of consecutive failures since the last
+// healthy session.
+func (b *reconnectBackoff) Failures() int {
+	return b.failures
+}
+
+func (b *reconnectBackoff) Reset() {
+	b.failures = 0
+}
+
 // needsModemReset reports whether a diagnostic error type warrants a full
 // AT+CFUN reset before the next attempt. SIM-class errors benefit from a
 // reset; so does a mandatory-init failure, since a wedged modem (or a
@@ -704,7 +2728,7 @@ func needsModemReset(t DiagnosticErrorType) bool {
 func simReadyProbe(modem ATCommander) (bool, error) {
 	resp, err := modem.Command("AT+CPIN?")
 	if err != nil {
-		if IsTimeoutError(err) {
+		if at.IsTimeoutError(err) {
 			return false, NewSessionError(err)
 		}
 		return false, nil
@@ -716,37 +2740,59 @@ func simReadyProbe(modem ATCommander) (bool, error) {
 // parseCPMSCounts extracts (used, total) of the first storage from a +CPMS
 // response line; returns (-1, -1) when the response is unparseable.
 func parseCPMSCounts(resp []string) (int, int) {
+	if storages := parseCPMSStorages(resp); len(storages) > 0 {
+		return storages[0].Used, storages[0].Total
+	}
+	return -1, -1
+}
+
+// SIMStorage is the usage of one message storage (SM, ME, ...).
+type SIMStorage struct {
+	Name        string
+	Used, Total int
+}
+
+// parseCPMSStorages returns the storages of a +CPMS line in order, each
+// name once: the query answers `+CPMS: "SM",3,30,"ME",0,100,...`, the set
+// command only the counts, which leaves Name empty.
+func parseCPMSStorages(resp []string) []SIMStorage {
 	for _, line := range resp {
-		if !strings.HasPrefix(line, "+CPMS:") {
+		rest, ok := strings.CutPrefix(line, "+CPMS:")
+		if !ok {
 			continue
 		}
-		rest := strings.TrimPrefix(line, "+CPMS:")
+		var storages []SIMStorage
+		var name string
 		var nums []int
 		for _, field := range strings.Split(rest, ",") {
-			field = strings.TrimSpace(strings.Trim(strings.TrimSpace(field), `"`))
-			if n, err := strconv.Atoi(field); err == nil {
-				nums = append(nums, n)
+			field = strings.TrimSpace(field)
+			if n, err := strconv.Atoi(strings.Trim(field, `"`)); err == nil {
+				if nums = append(nums, n); len(nums) == 2 {
+					if !slices.ContainsFunc(storages, func(s SIMStorage) bool { return name != "" && s.Name == name }) {
+						storages = append(storages, SIMStorage{Name: name, Used: nums[0], Total: nums[1]})
+					}
+					name, nums = "", nil
+				}
+				continue
 			}
+			name, nums = strings.Trim(field, `"`), nil
 		}
-		if len(nums) >= 2 {
-			return nums[0], nums[1]
+		if len(storages) > 0 {
+			return storages
 		}
 	}
-	return -1, -1
+	return nil
 }
 
-// runModemLoop handles serial port connection and SMS polling.
+// runModemLoop handles serial port connection, SMS polling and outgoing SMS.
 // needReset indicates if modem should be reset (e.g., after SIM error);
 // onHealthy is called once the session is fully initialized and diagnosed.
-func runModemLoop(ctx context.Context, cfg *Config, deliverer *Deliverer, notifier *ErrorNotifier, needReset bool, onHealthy func()) error {
+// outbox may be nil (no outgoing SMS), so may esim and pins (no admin
+// commands); storage picks the SMS storage.
+func runModemLoop(ctx context.Context, cfg *Config, deliverer *Deliverer, notifier *ErrorNotifier, outbox *Outbox, esim *ESIMManager, pins *PINManager, dtmf *DTMFManager, storage *smsStorage, needReset bool, onHealthy func()) error {
 	// Open serial port
 	slog.Debug("Opening serial port", "port", cfg.SerialPort, "baud", cfg.BaudRate)
-	serialCfg := &serial.Config{
-		Name:        cfg.SerialPort,
-		Baud:        cfg.BaudRate,
-		ReadTimeout: time.Millisecond * 500,
-	}
-	p, err := serial.OpenPort(serialCfg)
+	p, err := openModemPort(cfg.SerialPort, cfg.BaudRate)
 	if err != nil {
 		return NewDiagnosticError(ErrTypeSerialPort,
 			"Failed to open serial port %s: %v", cfg.SerialPort, err)
@@ -754,8 +2800,17 @@ func runModemLoop(ctx context.Context, cfg *Config, deliverer *Deliverer, notifi
 	defer p.Close()
 	slog.Info("Serial port opened successfully")
 
-	// Create simple AT modem interface
-	modem := NewSimpleAT(p, 5*time.Second)
+	// Create simple AT modem interface; with LOW_POWER every command
+	// wakes the modem first.
+	raw := at.NewSimpleAT(p, 5*time.Second)
+	raw.Clock = clk
+	raw.Observe = notifier.metrics.ATCommandDone
+	raw.OnURC = func(line string) {
+		deliverer.reception.urc(line)
+		deliverer.calls.urc(line)
+	}
+	modem := newLowPowerAT(raw, cfg.LowPower)
+	defer modem.Close()
 
 	// Reset modem if requested (e.g., after SIM error)
 	// Use AT+CFUN to do a full modem reset which re-initializes SIM
@@ -772,14 +2827,37 @@ func runModemLoop(ctx context.Context, cfg *Config, deliverer *Deliverer, notifi
 		slog.Info("Modem reset complete")
 	}
 
+	// A rotated SIM that does not come up is switched back.
+	if err := deliverer.rotation.sessionStarting(ctx, modem, notifier); err != nil {
+		return NewSessionError(err)
+	}
+
+	// A SIM asking for its PIN gets SIM_PIN before the SMS commands.
+	if err := unlockSIM(ctx, modem, cfg.SIMPIN); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
 	sessionStart := clk.Now()
 
 	// Mandatory session initialization (sync, echo off, PDU mode, SIM storage, CNMI)
-	simUsed, simTotal, err := initModemSession(modem)
+	session, err := initModemSession(modem, storage.order(), cfg.ModemCharset, true)
 	if err != nil {
 		return err
 	}
-	notifier.CheckStorage(ctx, simUsed, simTotal)
+	storage.selected(session.Name)
+	notifier.StorageSelected(ctx, cfg.SMSStorage, session.Name)
+	simTotal := session.Total
+	notifier.CheckStorage(ctx, session.Used, simTotal)
+	// initModemSession selects one storage for all three.
+	notifier.metrics.StoragesSampled([]SIMStorage{session.SIMStorage})
+	deliverer.slots = newSIMSlots(probeDeleteFlags(modem))
+	deliverer.slots.text = session.TextMode
+	deliverer.injector.setTextMode(session.TextMode)
+	deliverer.slots.check = deliverer.deletions
+	slog.Debug("Probed AT+CMGD delete flags", "supported", deliverer.slots.deleteRead)
 
 	// Run detailed modem diagnostics
 	slog.Info("Running modem diagnostics...")
@@ -798,20 +2876,57 @@ func runModemLoop(ctx context.Context, cfg *Config, deliverer *Deliverer, notifi
 	// Session is fully initialized and diagnosed.
 	onHealthy()
 	notifier.NotifyRecovery(ctx)
-
-	// Main loop: poll for SMS messages
-	pollInterval := 10 * time.Second
+	notifier.Heartbeat()
+	reportOperator(modem, notifier, session.Charset, cfg.OperatorNames)
+	deliverer.rotation.sessionUp(ctx, modem, notifier, session.Charset, cfg.OperatorNames)
+	reportSignal(ctx, modem, notifier)
+	reportBattery(ctx, modem, notifier)
+	deliverer.cells.sample(modem)
+
+	// Let the modem sleep between loop events (LOW_POWER).
+	if err := modem.enable(cfg.SerialPort); err != nil {
+		return NewSessionError(err)
+	}
+
+	// Main loop: poll for SMS messages; with working new SMS indications
+	// they trigger the listing and the poll is only the safety net.
+	recv := deliverer.reception
+	if err := recv.start(modem); err != nil {
+		return NewSessionError(err)
+	}
+	calls := deliverer.calls
+	if err := calls.start(modem, session.Charset); err != nil {
+		return NewSessionError(err)
+	}
+	pollInterval := cfg.PollInterval
+	pushing := recv.pushing()
+	if pushing {
+		pollInterval = cfg.PushPollInterval
+	}
+	// A ringing call is noticed between polls too.
+	var urcTick <-chan time.Time // nil (never) while polling
+	if pushing || calls != nil {
+		urcTicker := time.NewTicker(urcEvery)
+		defer urcTicker.Stop()
+		urcTick = urcTicker.C
+	}
+	notifier.metrics.ReceptionSampled(recv.describe(cfg))
 	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
 
 	// Periodic modem health check
-	healthCheckInterval := 60 * time.Second
-	healthTicker := time.NewTicker(healthCheckInterval)
+	healthTicker := time.NewTicker(cfg.HealthCheckInterval)
 	defer healthTicker.Stop()
 
+	// Scheduled storage maintenance; nil (never) without a schedule
+	maintenance := nextMaintenance(cfg.MaintenanceSchedule)
+	// Scheduled SIM rotation; nil (never) without SIM_ROTATION
+	rotation := deliverer.rotation.next()
+
 	slog.Info("Starting SMS polling loop",
 		"poll_interval", pollInterval,
-		"health_check_interval", healthCheckInterval,
+		"push", recv.pushing(),
+		"health_check_interval", cfg.HealthCheckInterval,
 	)
 
 	// handleError decides whether an error ends the session. Transport errors
@@ -821,13 +2936,13 @@ func runModemLoop(ctx context.Context, cfg *Config, deliverer *Deliverer, notifi
 	handleError := func(err error) error {
 		slog.Error("Error processing messages", "error", err)
 
-		if IsTimeoutError(err) {
+		if at.IsTimeoutError(err) {
 			return NewSessionError(err)
 		}
 
 		// Check if it's a modem ERROR response (modem responds but command fails)
 		// This often indicates SIM/network issues - run diagnostics immediately
-		if IsModemError(err) {
+		if at.IsModemError(err) {
 			slog.Warn("Modem returned ERROR - running diagnostics to determine cause")
 			// Run diagnostics to get specific error
 			if diagErr := runModemDiagnostics(ctx, modem, sessionStart, cfg.NetworkRegGrace); diagErr != nil {
@@ -836,7 +2951,10 @@ func runModemLoop(ctx context.Context, cfg *Config, deliverer *Deliverer, notifi
 				}
 				return diagErr
 			}
-			// Diagnostics passed but we still got ERROR - generic modem error
+			// Diagnostics passed but we still got ERROR - generic modem error.
+			// The only command answering ERROR here is the listing: the
+			// storage cannot be read, the next session tries the other one.
+			storage.failed(session.Name)
 			return NewDiagnosticError(ErrTypeModemNotResponding,
 				"Modem command failed: %v", err)
 		}
@@ -845,23 +2963,65 @@ func runModemLoop(ctx context.Context, cfg *Config, deliverer *Deliverer, notifi
 		return nil
 	}
 
-	// Process immediately on start
-	if err := processMessages(ctx, modem, deliverer, cfg, simTotal); err != nil {
-		if loopErr := handleError(err); loopErr != nil {
-			return loopErr
+	// poll lists the SIM and falls back to plain polling when the listing
+	// showed that the indications do not work.
+	poll := func() error {
+		if err := processMessages(ctx, modem, deliverer, cfg, simTotal); err != nil {
+			if loopErr := handleError(err); loopErr != nil {
+				return loopErr
+			}
 		}
+		notifier.CheckDeletions(ctx, deliverer.deletions.stuck())
+		if pushing && !recv.pushing() {
+			pushing = false
+			if calls == nil {
+				urcTick = nil
+			}
+			ticker.Reset(cfg.PollInterval)
+			notifier.metrics.ReceptionSampled(recv.describe(cfg))
+			if err := recv.stop(modem); err != nil {
+				return NewSessionError(err)
+			}
+		}
+		return nil
 	}
 
+	// Process immediately on start
+	if err := poll(); err != nil {
+		return err
+	}
+
+	// A drain (SHUTDOWN_TIMEOUT) stops everything that lists or submits
+	// SMS; the loop ends once the last queued one is deleted.
+	stopping := deliverer.queue.draining()
+	draining := false
+
 	for {
+		// Calls the last event's commands saw ringing are hung up first.
+		if err := calls.handle(ctx, modem, notifier); err != nil {
+			return NewSessionError(err)
+		}
+		if err := modem.rest(); err != nil {
+			return NewSessionError(err)
+		}
+		if draining && deliverer.queue.idle() {
+			slog.Info("Delivery queue drained, exiting polling loop")
+			return nil
+		}
 		select {
 		case <-ctx.Done():
 			slog.Info("Context cancelled, exiting polling loop")
 			return nil
 
+		case <-stopping:
+			stopping, draining = nil, true
+			ticker.Stop()
+			urcTick, maintenance, rotation = nil, nil, nil
+
 		case <-healthTicker.C:
 			slog.Debug("Running modem health check")
 			if err := modem.Ping(); err != nil {
-				if IsTimeoutError(err) {
+				if at.IsTimeoutError(err) {
 					slog.Error("Modem health check failed - not responding", "error", err)
 					return NewSessionError(err)
 				}
@@ -880,10 +3040,77 @@ func runModemLoop(ctx context.Context, cfg *Config, deliverer *Deliverer, notifi
 			if resp, cpmsErr := modem.Command("AT+CPMS?"); cpmsErr == nil {
 				used, total := parseCPMSCounts(resp)
 				notifier.CheckStorage(ctx, used, total)
+				storages := parseCPMSStorages(resp)
+				for i := range storages {
+					storages[i].Name = decodeTEString(storages[i].Name, session.Charset)
+				}
+				notifier.metrics.StoragesSampled(storages)
 			}
+			reportSignal(ctx, modem, notifier)
+			reportBattery(ctx, modem, notifier)
+			deliverer.cells.sample(modem)
+			notifier.Heartbeat()
 
 		case <-ticker.C:
-			if err := processMessages(ctx, modem, deliverer, cfg, simTotal); err != nil {
+			if err := poll(); err != nil {
+				return err
+			}
+			notifier.Heartbeat()
+
+		case <-urcTick:
+			if err := modem.ReadURCs(urcWait); err != nil {
+				return NewSessionError(err)
+			}
+			if recv.takeWake() || deliverer.grouping.due(clk.Now()) {
+				if err := poll(); err != nil {
+					return err
+				}
+			}
+			notifier.Heartbeat()
+
+		case <-maintenance:
+			if err := runMaintenance(modem, deliverer, cfg); err != nil {
+				return NewSessionError(err)
+			}
+			maintenance = nextMaintenance(cfg.MaintenanceSchedule)
+
+		case <-rotation:
+			retry, err := deliverer.rotation.rotate(ctx, modem, deliverer.queue, notifier)
+			if err != nil {
+				return NewSessionError(err)
+			}
+			if retry {
+				rotation = clk.After(rotationRetry)
+			} else {
+				rotation = deliverer.rotation.next()
+			}
+
+		case req := <-esim.pending():
+			if req.iccid != "" && !deliverer.queue.idle() {
+				esim.refuse(req, errSIMBusy)
+			} else if err := esim.serve(modem, req); err != nil {
+				return NewSessionError(err)
+			}
+
+		case req := <-pins.pending():
+			if err := pins.serve(modem, req); err != nil {
+				return NewSessionError(err)
+			}
+
+		case req := <-dtmf.pending():
+			if err := dtmf.serve(modem, req); err != nil {
+				return NewSessionError(err)
+			}
+
+		case req := <-outbox.pending():
+			if session.TextMode {
+				outbox.refuse(req, errTextModeSend)
+			} else if err := outbox.submit(modem, req); err != nil {
+				return NewSessionError(err)
+			}
+
+		case <-deliverer.queue.finishedReady():
+			if err := collectDelivered(modem, deliverer, cfg); err != nil {
 				if loopErr := handleError(err); loopErr != nil {
 					return loopErr
 				}
@@ -892,6 +3119,56 @@ func runModemLoop(ctx context.Context, cfg *Config, deliverer *Deliverer, notifi
 	}
 }
 
+// reportSignal samples AT+CSQ for Home Assistant, the metrics and the
+// weak-signal alert (best effort; without any of them the extra command is
+// skipped).
+func reportSignal(ctx context.Context, modem ATCommander, notifier *ErrorNotifier) {
+	if notifier.ha == nil && notifier.metrics == nil && notifier.signalAlert == nil {
+		return
+	}
+	resp, err := modem.Command("AT+CSQ")
+	if err != nil {
+		return
+	}
+	if rssi, ok := parseCSQ(resp); ok {
+		notifier.ha.PublishSignal(ctx, rssi)
+		notifier.metrics.SignalSampled(rssi)
+		notifier.CheckSignal(ctx, rssi)
+	}
+}
+
+// reportBattery samples AT+CBC for the metrics and the battery alerts (best
+// effort, skipped without either). A modem that answers ERROR has no
+// battery to report and is not asked again.
+func reportBattery(ctx context.Context, modem ATCommander, notifier *ErrorNotifier) {
+	if notifier.metrics == nil && notifier.batteryAlert <= 0 || !notifier.batterySupported() {
+		return
+	}
+	resp, err := modem.Command("AT+CBC")
+	if at.IsModemError(err) {
+		notifier.batteryUnsupported()
+		return
+	}
+	if err != nil {
+		return
+	}
+	if b, ok := parseCBC(resp); ok {
+		notifier.metrics.BatterySampled(b)
+		notifier.CheckBattery(ctx, b)
+	}
+}
+
+// reportOperator logs the network operator once per session and keeps it
+// for /status (best effort), numeric codes resolved by names.
+func reportOperator(modem ATCommander, notifier *ErrorNotifier, charset string, names map[string]string) {
+	resp, err := modem.Command("AT+COPS?")
+	if err != nil {
+		return
+	}
+	slog.Info("Operator", "response", strings.Join(resp, " "))
+	notifier.metrics.OperatorSampled(operatorName(decodeTEString(parseCOPS(resp), charset), names))
+}
+
 // sleepCtx waits for d unless the context ends first; returns false on cancellation.
 func sleepCtx(ctx context.Context, d time.Duration) bool {
 	select {
@@ -910,6 +3187,9 @@ type SMSMessage struct {
 	SMSC        string // Service center number
 	IsMultipart bool
 	TotalParts  int
+	// Class is the TP-DCS message class (Class0 for a flash SMS); NoClass in
+	// text mode.
+	Class pdu.MessageClass
 }
 
 // PendingSMS is one deliverable message together with every SIM slot it owns.
@@ -922,11 +3202,47 @@ type PendingSMS struct {
 	// raw hex (Message.Text holds the PDU, RawReason the parse problem).
 	RawFallback bool
 	RawReason   string
+	// RawKind classifies the parse problem (parsefailure.go).
+	RawKind string
+	// RawPDUs holds the hex PDU of every SIM slot, aligned with PartIndices
+	// (exported by sinks; never logged above DEBUG).
+	RawPDUs []string
+	// ChatIDs, set by a RULES_FILE route action, replace ROUTING_RULES for
+	// this SMS.
+	ChatIDs []int64
+	// Relay, set by a RULES_FILE relay action, re-sends this SMS to RelayTo,
+	// or RELAY_NUMBER when empty (relay.go).
+	Relay   bool
+	RelayTo string
+	// Webhooks, set by a RULES_FILE webhook action, name the webhook sinks
+	// that get this SMS; nil means all of them.
+	Webhooks []string
+	// Tags, added by RULES_FILE tag actions, label the SMS in Telegram and
+	// the sink payloads.
+	Tags []string
+	// Fields, set by RULES_FILE extract actions, are the named groups of the
+	// rules' regular expressions, for the sink payloads.
+	Fields map[string]string
+	// Transaction holds the values of a TRANSACTION_TEMPLATES_FILE template
+	// that matched; nil when none did.
+	Transaction *Transaction
+	// Translation of Message.Text (TRANSLATE_PROVIDER); nil when disabled,
+	// failed or not needed.
+	Translation *Translation
+	// Transliteration is Message.Text in Latin letters with
+	// TRANSLITERATE=append; empty when off or not needed.
+	Transliteration string
+	// TraceID correlates the log entries about this SMS (trace.go).
+	TraceID string
+	// Instance is INSTANCE_NAME and INSTANCE_LABELS for the sinks; nil when
+	// unset.
+	Instance *Instance
 }
 
 // ListResult is the typed outcome of one CMGL listing.
 type ListResult struct {
 	Pending              []PendingSMS
+	Received             []int    // every received SMS slot of the listing, ascending
 	StatusReports        []int    // recognized status reports: deleted without forwarding
 	Stale                []int    // multipart parts past MULTIPART_MAX_AGE
 	Conflicts            []string // multipart groups with conflicting duplicate parts
@@ -934,11 +3250,6 @@ type ListResult struct {
 	MaxPendingTotalParts int
 }
 
-// ErrCMGLCorrupted marks a listing whose header/PDU framing failed
-// validation. Nothing from such a transcript may be forwarded or deleted, and
-// the session is reopened.
-var ErrCMGLCorrupted = errors.New("CMGL transcript corrupted")
-
 // cmglTimeout: a full SIM produces a far larger response than any other
 // command we send, so the listing gets its own bounded timeout.
 const cmglTimeout = 20 * time.Second
@@ -946,10 +3257,37 @@ const cmglTimeout = 20 * time.Second
 func processMessages(ctx context.Context, modem ATCommander, deliverer *Deliverer, cfg *Config, simTotal int) error {
 	slog.Debug("Checking for new SMS messages")
 
-	result, err := listSMSMessages(modem, cfg.MultipartMaxAge)
+	// Free what the delivery queue finished first: the listing then shows
+	// only what still waits.
+	if err := collectDelivered(modem, deliverer, cfg); err != nil {
+		return err
+	}
+	// Backpressure: while the queue is full the SMS stay on the SIM, in
+	// order; the health tick keeps watching the storage meanwhile.
+	if deliverer.queue.full() {
+		return nil
+	}
+
+	listStart := clk.Now()
+	var result *ListResult
+	var err error
+	if deliverer.slots.textMode() {
+		result, err = listTextMessages(modem)
+	} else {
+		result, err = listSMSMessages(deliverer.injector.commander(modem), cfg.MultipartMaxAge)
+	}
 	if err != nil {
+		// The listing may have marked new arrivals read: no batch deletion
+		// until the next good one.
+		deliverer.slots.listed(nil)
 		return fmt.Errorf("failed to list SMS messages: %w", err)
 	}
+	if deliverer.latency != nil {
+		listed := clk.Now()
+		for _, pending := range result.Pending {
+			deliverer.latency.Detected(messageKey(pending), pending.Message.Time, listed, listed.Sub(listStart))
+		}
+	}
 
 	for _, conflict := range result.Conflicts {
 		slog.Warn("Multipart group with conflicting duplicate parts - not assembling", "group", conflict)
@@ -962,16 +3300,28 @@ func processMessages(ctx context.Context, modem ATCommander, deliverer *Delivere
 			"total_parts", result.MaxPendingTotalParts, "sim_capacity", simTotal)
 	}
 
+	deliverer.slots.listed(result.Received)
+	deliverer.reception.listed(result.Received)
+	del := deliverer.slots.deleter(modem, cfg)
+
 	// Status reports are modem delivery receipts, not user content: delete
 	// them without forwarding (documented policy).
-	if err := deleteBatch(modem, cfg, result.StatusReports, "status report"); err != nil {
+	if err := del(deliverer.injector.release(result.StatusReports), "status report"); err != nil {
 		return err
 	}
 	// Stale multipart cleanup is independent of delivery success.
-	if err := deleteBatch(modem, cfg, result.Stale, "stale multipart part"); err != nil {
+	if err := del(deliverer.injector.release(result.Stale), "stale multipart part"); err != nil {
 		return err
 	}
 
+	// SMS from one sender in quick succession become one (GROUP_WINDOW).
+	result.Pending = deliverer.grouping.apply(result.Pending)
+	deliverer.queue.listed(result.Pending)
+
+	// Whatever is not deleted below stays on the SIM for the next poll.
+	waiting := len(result.Pending)
+	defer func() { deliverer.notifier.metrics.QueueSampled(waiting, result.PendingParts) }()
+
 	if len(result.Pending) == 0 {
 		slog.Debug("No deliverable messages")
 		return nil
@@ -984,29 +3334,37 @@ func processMessages(ctx context.Context, modem ATCommander, deliverer *Delivere
 		}
 
 		slog.Debug("Processing SMS",
+			"trace", pending.TraceID,
 			"index", pending.Message.Index,
 			"from", pending.Message.From,
 			"time", pending.Message.Time,
 			"text_length", len(pending.Message.Text),
 			"raw_fallback", pending.RawFallback,
 		)
-
-		switch deliverer.Deliver(ctx, pending) {
-		case deliveryDone:
+		switch status := deliverer.Deliver(ctx, pending); status {
+		case deliveryDone, deliveryDropped, deliveryConsumed:
 			// Delete exactly this message's slots, immediately after its own
 			// successful delivery, so an unrelated later failure can never
 			// cause a duplicate of this message.
-			if err := deleteBatch(modem, cfg, pending.PartIndices, "forwarded SMS"); err != nil {
+			if err := settleDelivery(del, deliverer, pending, status); err != nil {
 				return err
 			}
-			slog.Info("SMS forwarded successfully",
-				"from", pending.Message.From, "indices", pending.PartIndices)
+			waiting--
+
+		case deliveryQueued:
+			// The delivery goroutine has it; collectDelivered frees the
+			// slots once it is done.
+			continue
 
 		case deliveryRejected:
 			// Permanently rejected: retained on SIM, alerted once, skip it
 			// and keep going - one poisoned message must not block the rest.
 			continue
 
+		case deliveryKept:
+			// Forwarded before; DELETE_POLICY=never leaves it on the SIM.
+			waiting--
+
 		case deliveryDeferred:
 			// Transient/rate-limit/config problem: it would hit the next
 			// messages too. Stop here; the next poll retries everything
@@ -1019,34 +3377,111 @@ func processMessages(ctx context.Context, modem ATCommander, deliverer *Delivere
 	return nil
 }
 
+// settleDelivery frees the SIM slots of an SMS that reached a final outcome
+// (done, dropped or consumed), archiving it first.
+func settleDelivery(del slotDeleter, deliverer *Deliverer, pending PendingSMS, status deliveryStatus) error {
+	indices := deliverer.injector.release(pending.PartIndices)
+	switch status {
+	case deliveryDone:
+		deliverer.archiveOutcome(pending, archiveForwarded)
+		if deliverer.cfg.DeletePolicy == deletePolicyNever {
+			deliverer.latency.Forget(messageKey(pending))
+			slog.Info("SMS forwarded successfully, kept on the SIM (DELETE_POLICY=never)",
+				"trace", pending.TraceID, "from", pending.Message.From, "indices", pending.PartIndices)
+			return nil
+		}
+		start := clk.Now()
+		if err := del(indices, "forwarded SMS"); err != nil {
+			return err
+		}
+		now := clk.Now()
+		deliverer.latency.Deleted(messageKey(pending), pending.PartIndices, now, now.Sub(start))
+		slog.Info("SMS forwarded successfully",
+			"trace", pending.TraceID, "from", pending.Message.From, "indices", pending.PartIndices)
+	case deliveryDropped:
+		deliverer.latency.Forget(messageKey(pending))
+		deliverer.archiveOutcome(pending, archiveBlocked)
+		return del(indices, "blocked sender")
+	case deliveryConsumed:
+		deliverer.latency.Forget(messageKey(pending))
+		return del(indices, "self-test SMS")
+	}
+	return nil
+}
+
+// freesSlots reports whether settleDelivery deletes an SMS that finished
+// with status.
+func freesSlots(status deliveryStatus, policy string) bool {
+	switch status {
+	case deliveryDone:
+		return policy != deletePolicyNever
+	case deliveryDropped, deliveryConsumed:
+		return true
+	}
+	return false
+}
+
+// collectDelivered settles the SMS the delivery queue finished. On a
+// transport error the unsettled rest goes back to the queue for the next
+// session.
+func collectDelivered(modem ATCommander, deliverer *Deliverer, cfg *Config) error {
+	results := deliverer.queue.takeFinished()
+	del := deliverer.slots.deleter(modem, cfg)
+	// SMS finished together that own every read slot: one command frees
+	// them all. Only the slots settleDelivery frees count: under
+	// DELETE_POLICY=never a forwarded SMS stays.
+	var indices []int
+	for _, r := range results {
+		if freesSlots(r.Status, cfg.DeletePolicy) {
+			indices = append(indices, r.Pending.PartIndices...)
+		}
+	}
+	if batched, err := deliverer.slots.deleteAllRead(modem, cfg, indices); err != nil {
+		deliverer.queue.putBack(results)
+		return err
+	} else if batched {
+		del = func([]int, string) error { return nil }
+	}
+	for i, r := range results {
+		if err := settleDelivery(del, deliverer, r.Pending, r.Status); err != nil {
+			deliverer.queue.putBack(results[i:])
+			return err
+		}
+		deliverer.queue.settled(r.Pending)
+	}
+	return nil
+}
+
 // deleteBatch deletes the given SIM slots. A transport/session error aborts
 // immediately (an unacknowledged delete on a desynced stream must not be
 // followed by more deletes); a synchronized modem ERROR is logged and skipped.
 func deleteBatch(modem ATCommander, cfg *Config, indices []int, kind string) error {
+	_, err := deleteSlots(modem, cfg, indices, kind)
+	return err
+}
+
+// deleteSlots is deleteBatch returning the slots the modem answered ERROR
+// for.
+func deleteSlots(modem ATCommander, cfg *Config, indices []int, kind string) ([]int, error) {
 	if len(indices) == 0 {
-		return nil
+		return nil, nil
 	}
 	if cfg.DryRun {
 		slog.Info("DRY_RUN: Skipping SMS deletion", "kind", kind, "indices", indices)
-		return nil
+		return nil, nil
 	}
+	var errored []int
 	for _, idx := range indices {
 		slog.Debug("Deleting SMS from SIM", "kind", kind, "index", idx)
 		if err := deleteSMS(modem, idx); err != nil {
-			if IsTimeoutError(err) {
-				return fmt.Errorf("deleting %s at index %d: %w", kind, idx, err)
+			if at.IsTimeoutError(err) {
+				return errored, fmt.Errorf("deleting %s at index %d: %w", kind, idx, err)
 			}
 			slog.Error("Failed to delete SMS (modem ERROR)", "kind", kind, "index", idx, "error", err)
+			errored = append(errored, idx)
 		}
 	}
-	return nil
-}
-
-// cmglRecord is one strictly validated header+PDU pair from a listing.
-type cmglRecord struct {
-	index  int
-	stat   int
-	pduHex string
+	return errored, nil
 }
 
 func listSMSMessages(modem ATCommander, maxAge time.Duration) (*ListResult, error) {
@@ -1058,82 +3493,107 @@ func listSMSMessages(modem ATCommander, maxAge time.Duration) (*ListResult, erro
 
 	slog.Debug("CMGL response", "lines", resp)
 
-	records, err := parseCMGLTranscript(resp)
+	entries, err := pdu.ParseListing(resp)
 	if err != nil {
 		return nil, err
 	}
 
-	collector := NewMultipartCollector()
+	collector := pdu.NewMultipartCollector()
 	result := &ListResult{}
+	rawPDUs := make(map[int]string, len(entries))
+	traces := make(map[int]string, len(entries))
 
-	for _, rec := range records {
+	for _, rec := range entries {
 		// Storage status: 0/1 = received unread/read (ours to forward),
 		// 2/3 = stored unsent/sent (not inbound traffic - leave untouched).
-		if rec.stat == 2 || rec.stat == 3 {
-			slog.Debug("Skipping stored outgoing message", "index", rec.index, "stat", rec.stat)
+		if rec.Stat == 2 || rec.Stat == 3 {
+			slog.Debug("Skipping stored outgoing message", "index", rec.Index, "stat", rec.Stat)
 			continue
 		}
 
-		pdu, parseErr := ParsePDU(rec.pduHex)
+		rawPDUs[rec.Index] = rec.PDU
+		result.Received = append(result.Received, rec.Index)
+		trace := traceID(rec.PDU)
+		traces[rec.Index] = trace
+		part, parseErr := pdu.Parse(rec.PDU)
 		if parseErr != nil {
-			var notDeliver *NotDeliverError
-			var unsupported *UnsupportedEncodingError
+			var notDeliver *pdu.NotDeliverError
+			var unsupported *pdu.UnsupportedEncodingError
 
 			switch {
 			case errors.As(parseErr, &notDeliver):
 				if notDeliver.MTI == 2 {
-					slog.Debug("Status report found", "index", rec.index)
-					result.StatusReports = append(result.StatusReports, rec.index)
+					slog.Debug("Status report found", "trace", trace, "index", rec.Index)
+					result.StatusReports = append(result.StatusReports, rec.Index)
 				} else {
 					// A stored SUBMIT under stat 0/1 is not ours to touch.
 					slog.Warn("Non-DELIVER PDU in received storage - leaving in place",
-						"index", rec.index, "mti", notDeliver.MTI)
+						"trace", trace, "index", rec.Index, "mti", notDeliver.MTI)
 				}
 
 			case errors.As(parseErr, &unsupported):
-				msg := SMSMessage{Index: rec.index, Text: rec.pduHex}
+				msg := SMSMessage{Index: rec.Index, Text: rec.PDU}
 				if unsupported.Msg != nil {
 					msg.From = unsupported.Msg.Sender
 					msg.Time = unsupported.Msg.Timestamp
+					msg.Class = unsupported.Msg.Class
 				}
+				slog.Debug("Undecodable PDU, forwarding as raw hex", "trace", trace, "index", rec.Index, "error", parseErr)
 				result.Pending = append(result.Pending, PendingSMS{
 					Message:     msg,
-					PartIndices: []int{rec.index},
+					PartIndices: []int{rec.Index},
 					RawFallback: true,
 					RawReason:   parseErr.Error(),
+					RawKind:     parseFailureKind(parseErr),
+					RawPDUs:     []string{rec.PDU},
+					TraceID:     trace,
 				})
 
 			default: // malformed PDU
 				slog.Warn("Failed to parse PDU",
-					"index", rec.index,
-					"pdu_len", len(rec.pduHex),
-					"pdu_fingerprint", contentFingerprint(rec.pduHex),
+					"trace", trace,
+					"index", rec.Index,
+					"pdu_len", len(rec.PDU),
+					"pdu_fingerprint", contentFingerprint(rec.PDU),
 					"error", parseErr,
 				)
-				slog.Debug("Unparseable PDU content", "pdu", rec.pduHex)
+				slog.Debug("Unparseable PDU content", "trace", trace, "pdu", rec.PDU)
 				result.Pending = append(result.Pending, PendingSMS{
-					Message:     SMSMessage{Index: rec.index, Text: rec.pduHex},
-					PartIndices: []int{rec.index},
+					Message:     SMSMessage{Index: rec.Index, Text: rec.PDU},
+					PartIndices: []int{rec.Index},
 					RawFallback: true,
 					RawReason:   parseErr.Error(),
+					RawKind:     parseFailureKind(parseErr),
+					RawPDUs:     []string{rec.PDU},
+					TraceID:     trace,
 				})
 			}
 			continue
 		}
 
-		if pdu.IsMultipart {
+		if part.IsMultipart {
 			slog.Debug("Multipart SMS part",
-				"index", rec.index,
-				"ref", pdu.MultipartRef,
-				"part", pdu.PartNumber,
-				"total", pdu.TotalParts,
+				"trace", trace,
+				"index", rec.Index,
+				"ref", part.MultipartRef,
+				"part", part.PartNumber,
+				"total", part.TotalParts,
 			)
 		}
 
-		assembled, partIndices := collector.Add(rec.index, pdu)
+		assembled, partIndices := collector.Add(rec.Index, part)
 		if assembled == nil {
 			continue // incomplete or conflicted multipart
 		}
+		partPDUs := make([]string, len(partIndices))
+		partTraces := make([]string, len(partIndices))
+		for i, idx := range partIndices {
+			partPDUs[i] = rawPDUs[idx]
+			partTraces[i] = traces[idx]
+		}
+		if len(partIndices) > 1 {
+			slog.Debug("Multipart SMS assembled", "trace", partTraces[0], "parts", partTraces, "indices", partIndices)
+		}
 		result.Pending = append(result.Pending, PendingSMS{
 			Message: SMSMessage{
 				Index:       partIndices[0],
@@ -1143,8 +3603,11 @@ func listSMSMessages(modem ATCommander, maxAge time.Duration) (*ListResult, erro
 				SMSC:        assembled.SMSC,
 				IsMultipart: assembled.IsMultipart,
 				TotalParts:  assembled.TotalParts,
+				Class:       assembled.Class,
 			},
 			PartIndices: partIndices,
+			RawPDUs:     partPDUs,
+			TraceID:     partTraces[0],
 		})
 	}
 
@@ -1161,109 +3624,44 @@ func listSMSMessages(modem ATCommander, maxAge time.Duration) (*ListResult, erro
 	return result, nil
 }
 
-// parseCMGLTranscript validates the header/PDU framing of a CMGL response.
-// Any inconsistency fails the whole listing: after at.go's URC filtering a
-// stray or short line means the transcript cannot be trusted, and forwarding
-// or deleting based on it risks losing a real SMS.
-func parseCMGLTranscript(lines []string) ([]cmglRecord, error) {
-	var records []cmglRecord
-
-	for i := 0; i < len(lines); i++ {
-		line := lines[i]
-		if !strings.HasPrefix(line, "+CMGL:") {
-			return nil, fmt.Errorf("%w: unexpected line %q", ErrCMGLCorrupted, line)
-		}
-
-		index, stat, tpduLen, err := parseCMGLHeader(line)
-		if err != nil {
-			return nil, fmt.Errorf("%w: %v", ErrCMGLCorrupted, err)
-		}
-
-		if i+1 >= len(lines) {
-			return nil, fmt.Errorf("%w: header %q without PDU line", ErrCMGLCorrupted, line)
-		}
-		i++
-		pduStr := strings.TrimSpace(lines[i])
-
-		if err := validatePDULine(pduStr, tpduLen); err != nil {
-			return nil, fmt.Errorf("%w: index %d: %v", ErrCMGLCorrupted, index, err)
-		}
+// cmglTextAll lists all messages in text mode: "ALL" in UCS2, the TE
+// character set of a text-mode session.
+const cmglTextAll = `AT+CMGL="0041004C004C"`
 
-		records = append(records, cmglRecord{index: index, stat: stat, pduHex: pduStr})
+// listTextMessages is listSMSMessages for a text-mode session. Text mode
+// hides the user data header, so every part of a multipart SMS is forwarded
+// on its own, and there are no PDUs to deduplicate or archive.
+func listTextMessages(modem ATCommander) (*ListResult, error) {
+	resp, err := modem.CommandWithTimeout(cmglTextAll, cmglTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("AT+CMGL command failed: %w", err)
 	}
 
-	return records, nil
-}
-
-// parseCMGLHeader parses "+CMGL: <index>,<stat>,<alpha>,<length>" honoring
-// quoted alpha fields that may contain commas.
-func parseCMGLHeader(line string) (index, stat, tpduLen int, err error) {
-	rest := strings.TrimSpace(strings.TrimPrefix(line, "+CMGL:"))
-	fields := splitQuoted(rest)
-	if len(fields) < 3 {
-		return 0, 0, 0, fmt.Errorf("header %q has %d fields, want >= 3", line, len(fields))
-	}
+	slog.Debug("CMGL response", "lines", resp)
 
-	index, err = strconv.Atoi(strings.TrimSpace(fields[0]))
-	if err != nil {
-		return 0, 0, 0, fmt.Errorf("bad index in header %q: %v", line, err)
-	}
-	// Text-mode listings quote the status ("REC UNREAD"); seeing one means
-	// PDU mode is not active and nothing in the transcript can be trusted.
-	stat, err = strconv.Atoi(strings.TrimSpace(fields[1]))
-	if err != nil {
-		return 0, 0, 0, fmt.Errorf("bad stat in header %q: %v", line, err)
-	}
-	tpduLen, err = strconv.Atoi(strings.TrimSpace(fields[len(fields)-1]))
+	entries, err := pdu.ParseTextListing(resp)
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("bad length in header %q: %v", line, err)
+		return nil, err
 	}
-	return index, stat, tpduLen, nil
-}
 
-// splitQuoted splits a comma-separated field list, keeping quoted fields
-// (which may contain commas) intact.
-func splitQuoted(s string) []string {
-	var fields []string
-	var cur strings.Builder
-	inQuotes := false
-	for _, r := range s {
-		switch {
-		case r == '"':
-			inQuotes = !inQuotes
-		case r == ',' && !inQuotes:
-			fields = append(fields, cur.String())
-			cur.Reset()
-		default:
-			cur.WriteRune(r)
+	result := &ListResult{}
+	for _, e := range entries {
+		if e.Stat == 2 || e.Stat == 3 {
+			slog.Debug("Skipping stored outgoing message", "index", e.Index, "stat", e.Stat)
+			continue
 		}
+		result.Received = append(result.Received, e.Index)
+		if e.StatusReport {
+			slog.Debug("Status report found", "index", e.Index)
+			result.StatusReports = append(result.StatusReports, e.Index)
+			continue
+		}
+		result.Pending = append(result.Pending, PendingSMS{
+			Message:     SMSMessage{Index: e.Index, From: e.Sender, Text: e.Text, Time: e.Timestamp},
+			PartIndices: []int{e.Index},
+		})
 	}
-	fields = append(fields, cur.String())
-	return fields
-}
-
-// validatePDULine checks that the candidate PDU line is pure hex and its
-// byte count matches the header: total = 1 (SMSC length octet) + SMSC bytes
-// + <length> TPDU bytes. This is what proves the line really is the PDU
-// belonging to the preceding header.
-func validatePDULine(pduStr string, tpduLen int) error {
-	if pduStr == "" {
-		return fmt.Errorf("empty PDU line")
-	}
-	if len(pduStr)%2 != 0 {
-		return fmt.Errorf("odd hex length %d", len(pduStr))
-	}
-	data, err := hex.DecodeString(pduStr)
-	if err != nil {
-		return fmt.Errorf("not hex: %v", err)
-	}
-	smscLen := int(data[0])
-	expected := 1 + smscLen + tpduLen
-	if len(data) != expected {
-		return fmt.Errorf("PDU is %d bytes, header requires %d (SMSC %d + TPDU %d)",
-			len(data), expected, smscLen, tpduLen)
-	}
-	return nil
+	return result, nil
 }
 
 func deleteSMS(modem ATCommander, index int) error {
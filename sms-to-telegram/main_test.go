@@ -4,6 +4,9 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
 	"strings"
 	"testing"
 	"time"
@@ -101,3 +104,24 @@ func TestEscapeHTML(t *testing.T) {
 		})
 	}
 }
+
+func TestNewLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(newLogHandler(&buf, &Config{LogLevel: slog.LevelInfo, LogFormat: "json", LogSource: true}))
+	logger.Debug("hidden")
+	logger.Info("SMS forwarded", "index", 3)
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("JSON handler wrote %q: %v", buf.String(), err)
+	}
+	if rec["msg"] != "SMS forwarded" || rec["index"] != float64(3) || rec["source"] == nil {
+		t.Errorf("record = %v, want msg, index and source", rec)
+	}
+
+	buf.Reset()
+	slog.New(newLogHandler(&buf, &Config{LogLevel: slog.LevelInfo, LogFormat: "text"})).Info("SMS forwarded")
+	if got := buf.String(); !strings.Contains(got, `msg="SMS forwarded"`) || strings.Contains(got, "source=") {
+		t.Errorf("text handler wrote %q", got)
+	}
+}
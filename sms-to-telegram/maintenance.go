@@ -0,0 +1,178 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
+)
+
+// Scheduled storage maintenance (MAINTENANCE_SCHEDULE). At every scheduled
+// time the modem goroutine deletes the sent SMS stored on the SIM and
+// compacts the archive to ARCHIVE_RETENTION. Received SMS are left alone:
+// one still on the SIM has not been delivered (a delivered one is deleted
+// by the poll that sees it again), and only delivery may free it.
+
+// MaintenanceSchedule is a list of weekly times in the host's local time,
+// e.g. "Sun 03:30" or "Mon-Fri 04:00; Sat,Sun 06:00". Without days a time
+// applies every day.
+type MaintenanceSchedule struct {
+	times []maintenanceTime
+	spec  string
+}
+
+type maintenanceTime struct {
+	days   [7]bool // indexed by time.Weekday
+	minute int     // minutes since midnight
+}
+
+// ParseMaintenanceSchedule parses "[days] HH:MM" entries separated by ";".
+func ParseMaintenanceSchedule(s string) (*MaintenanceSchedule, error) {
+	sched := &MaintenanceSchedule{}
+	var specs []string
+	for _, entry := range strings.Split(s, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("invalid schedule entry %q (use [Mon-Fri] HH:MM)", strings.TrimSpace(entry))
+		}
+		t := maintenanceTime{}
+		for i := range t.days {
+			t.days[i] = true
+		}
+		if len(fields) == 2 {
+			days, err := parseDays(fields[0])
+			if err != nil {
+				return nil, err
+			}
+			t.days = days
+		}
+		minute, err := parseClock(fields[len(fields)-1])
+		if err != nil {
+			return nil, err
+		}
+		t.minute = minute
+		sched.times = append(sched.times, t)
+		specs = append(specs, strings.Join(fields, " "))
+	}
+	if len(sched.times) == 0 {
+		return nil, fmt.Errorf("invalid schedule %q (use [Mon-Fri] HH:MM)", s)
+	}
+	sched.spec = strings.Join(specs, "; ")
+	return sched, nil
+}
+
+// Next returns the first scheduled time after now, in now's location.
+func (s *MaintenanceSchedule) Next(now time.Time) time.Time {
+	var next time.Time
+	// The same weekday a week later is the furthest a time can be.
+	for day := 0; day <= 7; day++ {
+		date := now.AddDate(0, 0, day)
+		for _, t := range s.times {
+			if !t.days[date.Weekday()] {
+				continue
+			}
+			at := time.Date(date.Year(), date.Month(), date.Day(), t.minute/60, t.minute%60, 0, 0, now.Location())
+			if at.After(now) && (next.IsZero() || at.Before(next)) {
+				next = at
+			}
+		}
+		if !next.IsZero() {
+			return next
+		}
+	}
+	return next
+}
+
+// String returns the normalized schedule; "" when nil.
+func (s *MaintenanceSchedule) String() string {
+	if s == nil {
+		return ""
+	}
+	return s.spec
+}
+
+// nextMaintenance returns a channel that fires at the next scheduled
+// maintenance; nil (never) without a schedule.
+func nextMaintenance(sched *MaintenanceSchedule) <-chan time.Time {
+	if sched == nil {
+		return nil
+	}
+	now := clk.Now()
+	next := sched.Next(now)
+	slog.Debug("Next storage maintenance", "at", next)
+	return clk.After(next.Sub(now))
+}
+
+// runMaintenance deletes the sent SMS stored on the SIM and compacts the
+// archive. Only a transport error is returned (it ends the session); the
+// rest is logged and done again at the next scheduled time.
+func runMaintenance(modem ATCommander, deliverer *Deliverer, cfg *Config) error {
+	slog.Info("Running storage maintenance")
+	stats, err := listStats(modem, deliverer.slots.textMode())
+	if at.IsTimeoutError(err) {
+		return fmt.Errorf("maintenance listing: %w", err)
+	}
+	if err != nil {
+		// Nothing from a corrupted listing is deleted.
+		slog.Error("Storage maintenance skipped the SIM", "error", err)
+		stats = nil
+	}
+	var received, sent []int
+	for _, e := range stats {
+		switch e.Stat {
+		case 0, 1:
+			received = append(received, e.Index)
+		case 3:
+			sent = append(sent, e.Index)
+		}
+	}
+	// The listing marked new arrivals read: batch deletion must know them.
+	deliverer.slots.listed(received)
+	if err := deleteBatch(modem, cfg, sent, "stored sent SMS"); err != nil {
+		return err
+	}
+
+	removed := 0
+	if cfg.ArchiveRetention > 0 {
+		removed, err = deliverer.archive.Compact(clk.Now().Add(-cfg.ArchiveRetention))
+		if err != nil {
+			slog.Error("Archive compaction failed", "error", err)
+		}
+	}
+	slog.Info("Storage maintenance done", "sent_sms_deleted", len(sent), "archive_records_removed", removed)
+	return nil
+}
+
+// listStats lists the storage status of every SIM slot, in PDU or text
+// mode.
+func listStats(modem ATCommander, text bool) ([]pdu.ListEntry, error) {
+	if !text {
+		resp, err := modem.CommandWithTimeout("AT+CMGL=4", cmglTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return pdu.ParseListing(resp)
+	}
+	resp, err := modem.CommandWithTimeout(cmglTextAll, cmglTimeout)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := pdu.ParseTextListing(resp)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]pdu.ListEntry, len(entries))
+	for i, e := range entries {
+		stats[i] = pdu.ListEntry{Index: e.Index, Stat: e.Stat}
+	}
+	return stats, nil
+}
@@ -0,0 +1,122 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+func TestParseMaintenanceSchedule(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"03:30", "03:30", false},
+		{" Sun  03:30 ", "Sun 03:30", false},
+		{"Mon-Fri 04:00; Sat,Sun 06:00;", "Mon-Fri 04:00; Sat,Sun 06:00", false},
+		{"", "", true},
+		{";", "", true},
+		{"Sun", "", true},
+		{"Someday 03:30", "", true},
+		{"Sun 03:30 weekly", "", true},
+		{"24:00", "", true},
+	}
+	for _, tt := range tests {
+		s, err := ParseMaintenanceSchedule(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMaintenanceSchedule(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got := s.String(); got != tt.want {
+			t.Errorf("ParseMaintenanceSchedule(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMaintenanceSchedule_Next(t *testing.T) {
+	// 2026-03-11 is a Wednesday.
+	wed := func(hour, minute int) time.Time { return time.Date(2026, 3, 11, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		spec string
+		now  time.Time
+		want time.Time
+	}{
+		{"03:30", wed(1, 0), wed(3, 30)},
+		{"03:30", wed(3, 30), wed(3, 30).AddDate(0, 0, 1)},
+		{"Sun 03:30", wed(12, 0), time.Date(2026, 3, 15, 3, 30, 0, 0, time.UTC)},
+		{"Wed 03:30", wed(4, 0), wed(3, 30).AddDate(0, 0, 7)},
+		{"Mon-Fri 04:00; Sat,Sun 06:00", time.Date(2026, 3, 13, 5, 0, 0, 0, time.UTC), time.Date(2026, 3, 14, 6, 0, 0, 0, time.UTC)},
+		{"23:00; 02:00", wed(22, 0), wed(23, 0)},
+		{"23:00; 02:00", wed(23, 0), wed(2, 0).AddDate(0, 0, 1)},
+	}
+	for _, tt := range tests {
+		s, err := ParseMaintenanceSchedule(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Next(tt.now); !got.Equal(tt.want) {
+			t.Errorf("%q.Next(%v) = %v, want %v", tt.spec, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestRunMaintenance(t *testing.T) {
+	listing := cmglListing(
+		[2]string{"+CMGL: 2,1,,29", testPDUSingle},  // received, not delivered yet
+		[2]string{"+CMGL: 4,3,,29", testPDUSingle},  // stored sent
+		[2]string{"+CMGL: 6,2,,29", testPDUSingle},  // stored unsent
+		[2]string{"+CMGL: 7,3,,24", pduAlphaSender}, // stored sent
+	)
+	tests := []struct {
+		name    string
+		listing []string
+		err     error
+		dryRun  bool
+		want    []string
+		wantErr bool
+	}{
+		{"sent SMS deleted", listing, nil, false, []string{"AT+CMGD=4", "AT+CMGD=7"}, false},
+		{"dry run", listing, nil, true, nil, false},
+		{"corrupted listing", []string{"+CMGL: 4,3,,24", testPDUSingle}, nil, false, nil, false},
+		{"modem ERROR", nil, at.ErrModemError, false, nil, false},
+		{"timeout", nil, at.ErrModemTimeout, false, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			t.Cleanup(swapClock(clock))
+			modem := newFakeAT()
+			modem.on("AT+CMGL=4", tt.listing, tt.err)
+			cfg := testConfig()
+			cfg.DryRun = tt.dryRun
+			cfg.ArchiveRetention = time.Hour
+			deliverer, _, _ := newTestDeliverer(cfg)
+			deliverer.slots = newSIMSlots(true)
+			deliverer.archive = NewMessageArchive(filepath.Join(t.TempDir(), archiveFileName))
+			deliverer.archive.Record(smsFrom("+1"), archiveForwarded, nil)
+			clock.Advance(2 * time.Hour)
+			deliverer.archive.Record(smsFrom("+2"), archiveForwarded, nil)
+
+			err := runMaintenance(modem, deliverer, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runMaintenance() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := cmgdCalls(modem); !slices.Equal(got, tt.want) {
+				t.Errorf("deletions = %q, want %q", got, tt.want)
+			}
+			if tt.wantErr {
+				return
+			}
+			if recs, _ := deliverer.archive.Query(time.Time{}, clk.Now().Add(time.Second)); len(recs) != 1 || recs[0].From != "+2" {
+				t.Errorf("archive = %+v, want only the recent record", recs)
+			}
+		})
+	}
+}
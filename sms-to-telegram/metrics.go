@@ -0,0 +1,515 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+// Prometheus metrics (GET /metrics on the HTTP API), written in the text
+// exposition format by hand: a handful of gauges and one histogram do not
+// justify the client library.
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// labelEscaper escapes label values as the text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricsOutput receives the samples of Metrics.write: a scrape
+// (metricsWriter) or a StatsD push (statsdWriter).
+type metricsOutput interface {
+	gauge(name, help string, value float64, labels ...string)
+	family(name, help, kind string)
+	sample(name string, value float64, labels ...string)
+}
+
+// metricsWriter writes one exposition. Write errors are kept and reported
+// by flush, so callers write unconditionally.
+type metricsWriter struct {
+	w *bufio.Writer
+}
+
+func newMetricsWriter(w io.Writer) *metricsWriter {
+	return &metricsWriter{w: bufio.NewWriter(w)}
+}
+
+// gauge writes a single-sample gauge; labels are name, value pairs.
+func (m *metricsWriter) gauge(name, help string, value float64, labels ...string) {
+	m.family(name, help, "gauge")
+	m.sample(name, value, labels...)
+}
+
+// family writes the HELP and TYPE lines of a metric with several samples.
+func (m *metricsWriter) family(name, help, kind string) {
+	m.w.WriteString("# HELP " + name + " " + help + "\n# TYPE " + name + " " + kind + "\n")
+}
+
+// sample writes one sample line; labels are name, value pairs.
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	m.w.WriteString(name)
+	if len(labels) > 0 {
+		m.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.w.WriteByte(',')
+			}
+			m.w.WriteString(labels[i] + `="` + labelEscaper.Replace(labels[i+1]) + `"`)
+		}
+		m.w.WriteByte('}')
+	}
+	m.w.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+func (m *metricsWriter) flush() error {
+	return m.w.Flush()
+}
+
+// labeledOutput adds constant labels to every sample of a metricsOutput.
+type labeledOutput struct {
+	metricsOutput
+	labels []string
+}
+
+func (l labeledOutput) gauge(name, help string, value float64, labels ...string) {
+	l.metricsOutput.gauge(name, help, value, slices.Concat(labels, l.labels)...)
+}
+
+func (l labeledOutput) sample(name string, value float64, labels ...string) {
+	l.metricsOutput.sample(name, value, slices.Concat(labels, l.labels)...)
+}
+
+// labeled returns w adding the instance labels; w itself without labels or
+// for nil Metrics.
+func (m *Metrics) labeled(w metricsOutput) metricsOutput {
+	if m == nil || len(m.labels) == 0 {
+		return w
+	}
+	return labeledOutput{metricsOutput: w, labels: m.labels}
+}
+
+// Metrics holds what the modem goroutine last observed: signal, operator,
+// SIM storage, queue depths and the time of the last SMS. Scrapes and
+// /status only read it. Nil-safe (neither HTTP API nor bot commands).
+type Metrics struct {
+	startedAt time.Time
+	// labels are the INSTANCE_LABELS pairs added to every sample; set
+	// before the first scrape.
+	labels []string
+
+	mu          sync.Mutex
+	rssi        int // +CSQ RSSI; -1 until the first sample
+	lastSMSAt   time.Time
+	modemReason string // why the modem is down; empty while healthy
+	operator    string
+	reception   string         // the reception strategy, for /status
+	battery     *BatterySample // nil until the first +CBC sample
+	// cellHistory holds the last cellHistorySize serving-cell changes,
+	// oldest first; cellChanges counts all of them (CELL_TRACKING).
+	cellHistory  []CellChange
+	cellChanges  int
+	simUsed      int // -1 until the first +CPMS sample
+	simTotal     int
+	storages     []SIMStorage
+	smsWaiting   int // SMS left on the SIM after the last poll
+	partsWaiting int // parts of incomplete multipart SMS
+	// signalHistory holds the last signalHistorySize samples, oldest first,
+	// for the dashboard graph.
+	signalHistory []SignalSample
+	// atCommands are the AT command latencies and errors by command class.
+	atCommands map[string]*atCommandStats
+	// atWindows are the AT command totals of the last atReportWindows
+	// hours, oldest first, for the AT report.
+	atWindows []atWindow
+	// parseFailures counts undecodable SMS by parse failure kind.
+	parseFailures map[string]uint64
+	// deleteFailures counts SIM slots a deletion did not free.
+	deleteFailures uint64
+}
+
+// atLatencyBuckets are the upper bounds of the AT command latency
+// histogram, in seconds: a healthy modem answers in well under a second,
+// a full SIM listing takes a few, the default deadline is 5.
+var atLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// atCommandStats is one command class: a histogram (counts per bucket, not
+// cumulative) and the failures by kind.
+type atCommandStats struct {
+	buckets  []uint64
+	count    uint64
+	sum      float64
+	max      float64
+	timeouts uint64
+	errors   uint64
+}
+
+// signalHistorySize keeps 12 hours at the default HEALTH_CHECK_INTERVAL.
+const signalHistorySize = 720
+
+// SignalSample is one +CSQ sample.
+type SignalSample struct {
+	Time time.Time `json:"time"`
+	CSQ  int       `json:"csq"`
+	// DBm is nil while the signal is unknown (CSQ 99).
+	DBm *int `json:"dbm"`
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{startedAt: clk.Now(), rssi: -1, modemReason: "starting", simUsed: -1}
+}
+
+// metricsSnapshot is a consistent copy of Metrics for /status.
+type metricsSnapshot struct {
+	startedAt, lastSMSAt     time.Time
+	rssi                     int
+	modemReason, operator    string
+	reception                string
+	battery                  *BatterySample
+	cell                     *CellChange // the current serving cell
+	cellChanges              int
+	simUsed, simTotal        int
+	smsWaiting, partsWaiting int
+}
+
+func (m *Metrics) snapshot() metricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snap := metricsSnapshot{
+		startedAt: m.startedAt, lastSMSAt: m.lastSMSAt, rssi: m.rssi,
+		modemReason: m.modemReason, operator: m.operator, reception: m.reception,
+		battery: m.battery, cellChanges: m.cellChanges,
+		simUsed: m.simUsed, simTotal: m.simTotal,
+		smsWaiting: m.smsWaiting, partsWaiting: m.partsWaiting,
+	}
+	if n := len(m.cellHistory); n > 0 {
+		cell := m.cellHistory[n-1]
+		snap.cell = &cell
+	}
+	return snap
+}
+
+// SignalSampled records a +CSQ RSSI (0-31, 99 unknown).
+func (m *Metrics) SignalSampled(rssi int) {
+	if m == nil {
+		return
+	}
+	sample := SignalSample{Time: clk.Now(), CSQ: rssi}
+	if rssi >= 0 && rssi <= 31 {
+		dbm := csqToDBm(rssi)
+		sample.DBm = &dbm
+	}
+	m.mu.Lock()
+	m.rssi = rssi
+	m.signalHistory = append(m.signalHistory, sample)
+	if len(m.signalHistory) > signalHistorySize {
+		m.signalHistory = m.signalHistory[1:]
+	}
+	m.mu.Unlock()
+}
+
+// SignalHistory returns the recent signal samples, oldest first.
+func (m *Metrics) SignalHistory() []SignalSample {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.signalHistory)
+}
+
+// ModemHealthy records a healthy modem cycle.
+func (m *Metrics) ModemHealthy() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.modemReason = ""
+	m.mu.Unlock()
+}
+
+// ModemDown records why the session ended and forgets the signal, operator
+// and battery samples: they describe a session that ended.
+func (m *Metrics) ModemDown(reason string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.modemReason, m.rssi, m.operator, m.battery = reason, -1, "", nil
+	m.mu.Unlock()
+}
+
+// OperatorSampled records the network operator from +COPS.
+func (m *Metrics) OperatorSampled(operator string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.operator = operator
+	m.mu.Unlock()
+}
+
+// CellChanged records a serving-cell change (CELL_TRACKING).
+func (m *Metrics) CellChanged(change CellChange) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	if change.From != "" {
+		m.cellChanges++
+	}
+	m.cellHistory = append(m.cellHistory, change)
+	if len(m.cellHistory) > cellHistorySize {
+		m.cellHistory = m.cellHistory[1:]
+	}
+	m.mu.Unlock()
+}
+
+// CellHistory returns the recent serving-cell changes, oldest first.
+func (m *Metrics) CellHistory() []CellChange {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.cellHistory)
+}
+
+// BatterySampled records a +CBC sample.
+func (m *Metrics) BatterySampled(b BatterySample) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.battery = &b
+	m.mu.Unlock()
+}
+
+// ReceptionSampled records how the session receives SMS.
+func (m *Metrics) ReceptionSampled(strategy string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.reception = strategy
+	m.mu.Unlock()
+}
+
+// StorageSampled records the SIM storage usage from +CPMS.
+func (m *Metrics) StorageSampled(used, total int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.simUsed, m.simTotal = used, total
+	m.mu.Unlock()
+}
+
+// StoragesSampled records the usage of every message storage from +CPMS.
+// Unnamed storages (a set command's answer) are left out.
+func (m *Metrics) StoragesSampled(storages []SIMStorage) {
+	if m == nil {
+		return
+	}
+	storages = slices.DeleteFunc(slices.Clone(storages), func(s SIMStorage) bool { return s.Name == "" || s.Total <= 0 })
+	if len(storages) == 0 {
+		return
+	}
+	m.mu.Lock()
+	m.storages = storages
+	m.mu.Unlock()
+}
+
+// QueueSampled records what the last poll left on the SIM: undelivered SMS
+// (deferred or rejected) and parts of incomplete multipart SMS.
+func (m *Metrics) QueueSampled(sms, parts int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.smsWaiting, m.partsWaiting = sms, parts
+	m.mu.Unlock()
+}
+
+// ATCommandDone records a finished AT command; it is the session's
+// Observe hook. Failures count as timeouts (no or incomplete answer, lost
+// port) or errors (ERROR, +CME/+CMS ERROR).
+func (m *Metrics) ATCommandDone(cmd string, elapsed time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	class := at.CommandClass(cmd)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.atCommands == nil {
+		m.atCommands = make(map[string]*atCommandStats)
+	}
+	st := m.atCommands[class]
+	if st == nil {
+		st = &atCommandStats{buckets: make([]uint64, len(atLatencyBuckets))}
+		m.atCommands[class] = st
+	}
+	seconds := elapsed.Seconds()
+	if i, _ := slices.BinarySearch(atLatencyBuckets, seconds); i < len(st.buckets) {
+		st.buckets[i]++
+	}
+	st.count++
+	st.sum += seconds
+	st.max = max(st.max, seconds)
+
+	start := clk.Now().Truncate(atReportWindow)
+	if n := len(m.atWindows); n == 0 || !m.atWindows[n-1].start.Equal(start) {
+		m.atWindows = append(m.atWindows, atWindow{start: start})
+		if len(m.atWindows) > atReportWindows {
+			m.atWindows = m.atWindows[1:]
+		}
+	}
+	window := &m.atWindows[len(m.atWindows)-1]
+	window.commands++
+	switch {
+	case at.IsTimeoutError(err):
+		st.timeouts++
+		window.timeouts++
+	case err != nil:
+		st.errors++
+		window.errors++
+	}
+}
+
+// SMSReceived records that an SMS reached a final outcome (forwarded,
+// blocked or rejected). SMS retried on every poll do not count, so a stuck
+// message cannot mask a silent SIM.
+func (m *Metrics) SMSReceived() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.lastSMSAt = clk.Now()
+	m.mu.Unlock()
+}
+
+// PDUParseFailed records an undecodable SMS (parsefailure.go).
+func (m *Metrics) PDUParseFailed(kind string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.parseFailures == nil {
+		m.parseFailures = make(map[string]uint64)
+	}
+	m.parseFailures[kind]++
+}
+
+// SIMDeleteFailed records a SIM slot a deletion did not free
+// (deleteverify.go).
+func (m *Metrics) SIMDeleteFailed() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.deleteFailures++
+	m.mu.Unlock()
+}
+
+// write adds the gauges to a scrape or push. The dBm gauge is omitted while the
+// signal is unknown, so absent() alerts cover both a dead antenna and a
+// modem that cannot be queried.
+func (m *Metrics) write(w metricsOutput) {
+	if m == nil {
+		return
+	}
+	w = m.labeled(w)
+	m.mu.Lock()
+	rssi, last, storages, battery := m.rssi, m.lastSMSAt, m.storages, m.battery
+	tracked, cellChanges := len(m.cellHistory) > 0, m.cellChanges
+	parseFailures, deleteFailures := maps.Clone(m.parseFailures), m.deleteFailures
+	m.mu.Unlock()
+
+	if rssi >= 0 {
+		w.gauge("sms_to_telegram_signal_csq", "Last +CSQ RSSI index (0-31, 99 = unknown).", float64(rssi))
+	}
+	if rssi >= 0 && rssi <= 31 {
+		w.gauge("sms_to_telegram_signal_dbm", "Last received signal strength in dBm.", float64(csqToDBm(rssi)))
+	}
+	if battery != nil {
+		w.gauge("sms_to_telegram_battery_percent", "Last +CBC battery charge in percent.", float64(battery.Percent))
+		onBattery := 0.0
+		if battery.OnBattery {
+			onBattery = 1
+		}
+		w.gauge("sms_to_telegram_on_battery", "1 while the modem runs on its battery (+CBC charge status 0).", onBattery)
+		if battery.Millivolts > 0 {
+			w.gauge("sms_to_telegram_battery_volts", "Last +CBC battery voltage.", float64(battery.Millivolts)/1000)
+		}
+	}
+	if tracked {
+		w.family("sms_to_telegram_cell_changes_total", "Serving-cell changes seen on the health tick (CELL_TRACKING).", "counter")
+		w.sample("sms_to_telegram_cell_changes_total", float64(cellChanges))
+	}
+	// Until the first SMS the age counts from the process start.
+	if last.IsZero() {
+		last = m.startedAt
+	}
+	w.gauge("sms_to_telegram_seconds_since_last_sms",
+		"Seconds since the last SMS was received (since process start before the first one).",
+		clk.Now().Sub(last).Truncate(time.Second).Seconds())
+	w.family("sms_to_telegram_pdu_parse_failures_total", "SMS forwarded as raw PDUs because they could not be decoded, by kind.", "counter")
+	for _, kind := range parseFailureKinds {
+		w.sample("sms_to_telegram_pdu_parse_failures_total", float64(parseFailures[kind]), "kind", kind)
+	}
+	w.family("sms_to_telegram_sim_delete_failures_total", "SIM slot deletions that did not free the slot (AT+CMGD ERROR or, with DELETE_VERIFY, still occupied).", "counter")
+	w.sample("sms_to_telegram_sim_delete_failures_total", float64(deleteFailures))
+	if len(storages) > 0 {
+		w.family("sms_to_telegram_sim_storage_used", "SMS slots in use by message storage, from the last +CPMS sample.", "gauge")
+		for _, s := range storages {
+			w.sample("sms_to_telegram_sim_storage_used", float64(s.Used), "storage", s.Name)
+		}
+		w.family("sms_to_telegram_sim_storage_total", "SMS slots by message storage, from the last +CPMS sample.", "gauge")
+		for _, s := range storages {
+			w.sample("sms_to_telegram_sim_storage_total", float64(s.Total), "storage", s.Name)
+		}
+	}
+	m.writeATCommands(w)
+}
+
+// writeATCommands adds the AT command latency histogram and error counter,
+// by command class. Both are left out until the first command.
+func (m *Metrics) writeATCommands(w metricsOutput) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.atCommands) == 0 {
+		return
+	}
+	classes := slices.Sorted(maps.Keys(m.atCommands))
+
+	const latency = "sms_to_telegram_at_command_duration_seconds"
+	w.family(latency, "Time from sending an AT command to its final result, by command class.", "histogram")
+	for _, class := range classes {
+		st := m.atCommands[class]
+		var cumulative uint64
+		for i, le := range atLatencyBuckets {
+			cumulative += st.buckets[i]
+			w.sample(latency+"_bucket", float64(cumulative), "command", class, "le", strconv.FormatFloat(le, 'g', -1, 64))
+		}
+		w.sample(latency+"_bucket", float64(st.count), "command", class, "le", "+Inf")
+		w.sample(latency+"_sum", st.sum, "command", class)
+		w.sample(latency+"_count", float64(st.count), "command", class)
+	}
+
+	const failures = "sms_to_telegram_at_command_errors_total"
+	w.family(failures, "Failed AT commands by command class and kind (timeout: no or incomplete answer; error: ERROR, +CME or +CMS ERROR).", "counter")
+	for _, class := range classes {
+		st := m.atCommands[class]
+		w.sample(failures, float64(st.timeouts), "command", class, "kind", "timeout")
+		w.sample(failures, float64(st.errors), "command", class, "kind", "error")
+	}
+}
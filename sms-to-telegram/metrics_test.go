@@ -0,0 +1,158 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+func scrapeMetrics(t *testing.T, metrics *Metrics) string {
+	t.Helper()
+	api := NewAPIServer(nil, NewHealthState(nil), nil)
+	api.metrics = metrics
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/metrics status = %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestMetrics_SignalAndFreshness(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	metrics := NewMetrics()
+
+	clock.Advance(90 * time.Second)
+	body := scrapeMetrics(t, metrics)
+	if strings.Contains(body, "signal_") {
+		t.Errorf("signal gauges before the first sample:\n%s", body)
+	}
+	if !strings.Contains(body, "sms_to_telegram_seconds_since_last_sms 90\n") {
+		t.Errorf("age before the first SMS should count from start:\n%s", body)
+	}
+
+	notifier := NewErrorNotifier(nil, nil, true, "test-host", time.Second)
+	notifier.metrics = metrics
+	modem := newFakeAT()
+	modem.on("AT+CSQ", []string{"+CSQ: 12,99", "OK"}, nil)
+	reportSignal(context.Background(), modem, notifier)
+	metrics.SMSReceived()
+	clock.Advance(5 * time.Second)
+
+	body = scrapeMetrics(t, metrics)
+	for _, want := range []string{
+		"# TYPE sms_to_telegram_signal_csq gauge\nsms_to_telegram_signal_csq 12\n",
+		"sms_to_telegram_signal_dbm -89\n",
+		"sms_to_telegram_seconds_since_last_sms 5\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+
+	// Unknown signal keeps the raw index but no dBm value.
+	metrics.SignalSampled(99)
+	body = scrapeMetrics(t, metrics)
+	if !strings.Contains(body, "sms_to_telegram_signal_csq 99\n") || strings.Contains(body, "signal_dbm") {
+		t.Errorf("CSQ=99 metrics:\n%s", body)
+	}
+
+	notifier.ModemDown("port closed")
+	if body = scrapeMetrics(t, metrics); strings.Contains(body, "signal_") {
+		t.Errorf("signal gauges after the modem went down:\n%s", body)
+	}
+}
+
+// TestDeliverer_LastSMSOnlyOnFinalOutcome: a deferred SMS is retried every
+// poll and must not refresh the last-SMS time.
+func TestMetrics_SIMStorage(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	metrics := NewMetrics()
+	metrics.StoragesSampled(parseCPMSStorages([]string{"+CPMS: 3,30,3,30,3,30"}))
+	if body := scrapeMetrics(t, metrics); strings.Contains(body, "sim_storage") {
+		t.Errorf("unnamed storages exported:\n%s", body)
+	}
+
+	metrics.StoragesSampled(parseCPMSStorages([]string{`+CPMS: "SM",28,30,"ME",0,100,"SM",28,30`}))
+	body := scrapeMetrics(t, metrics)
+	for _, want := range []string{
+		"# TYPE sms_to_telegram_sim_storage_used gauge\n" +
+			`sms_to_telegram_sim_storage_used{storage="SM"} 28` + "\n" +
+			`sms_to_telegram_sim_storage_used{storage="ME"} 0` + "\n",
+		`sms_to_telegram_sim_storage_total{storage="SM"} 30` + "\n",
+		`sms_to_telegram_sim_storage_total{storage="ME"} 100` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetrics_ATCommands(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	metrics := NewMetrics()
+	if body := scrapeMetrics(t, metrics); strings.Contains(body, "at_command") {
+		t.Errorf("AT metrics before the first command:\n%s", body)
+	}
+
+	metrics.ATCommandDone("AT+CMGL=4", 80*time.Millisecond, nil)
+	metrics.ATCommandDone("AT+CMGL=4", time.Second, nil)
+	metrics.ATCommandDone("AT+CMGL=4", 5*time.Second, at.ErrModemTimeout)
+	metrics.ATCommandDone("AT+CMGD=3", 2*time.Minute, fmt.Errorf("%w: +CMS ERROR: 321", at.ErrModemError))
+	body := scrapeMetrics(t, metrics)
+	for _, want := range []string{
+		"# TYPE sms_to_telegram_at_command_duration_seconds histogram\n",
+		`sms_to_telegram_at_command_duration_seconds_bucket{command="CMGL",le="0.05"} 0` + "\n",
+		`sms_to_telegram_at_command_duration_seconds_bucket{command="CMGL",le="0.1"} 1` + "\n",
+		`sms_to_telegram_at_command_duration_seconds_bucket{command="CMGL",le="1"} 2` + "\n",
+		`sms_to_telegram_at_command_duration_seconds_bucket{command="CMGL",le="+Inf"} 3` + "\n",
+		`sms_to_telegram_at_command_duration_seconds_sum{command="CMGL"} 6.08` + "\n",
+		`sms_to_telegram_at_command_duration_seconds_count{command="CMGL"} 3` + "\n",
+		// Slower than the last bucket: only in +Inf.
+		`sms_to_telegram_at_command_duration_seconds_bucket{command="CMGD",le="60"} 0` + "\n",
+		`sms_to_telegram_at_command_duration_seconds_bucket{command="CMGD",le="+Inf"} 1` + "\n",
+		`sms_to_telegram_at_command_errors_total{command="CMGL",kind="timeout"} 1` + "\n",
+		`sms_to_telegram_at_command_errors_total{command="CMGL",kind="error"} 0` + "\n",
+		`sms_to_telegram_at_command_errors_total{command="CMGD",kind="error"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+	// One HELP/TYPE per family, classes sorted.
+	if strings.Count(body, "# TYPE sms_to_telegram_at_command_errors_total") != 1 ||
+		strings.Index(body, `{command="CMGD"`) > strings.Index(body, `{command="CMGL"`) {
+		t.Errorf("families:\n%s", body)
+	}
+}
+
+func TestDeliverer_LastSMSOnlyOnFinalOutcome(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	deliverer, _, _ := newTestDeliverer(testConfig())
+	deliverer.notifier.metrics = NewMetrics()
+	deliverer.AddSink(&fakeSink{name: "hook", errs: []error{errors.New("timeout")}})
+
+	pending := PendingSMS{Message: SMSMessage{Index: 1, From: "+100", Text: "hi"}, PartIndices: []int{1}}
+	clock.Advance(time.Minute)
+	deliverer.Deliver(context.Background(), pending)
+	if last := deliverer.notifier.metrics.lastSMSAt; !last.IsZero() {
+		t.Errorf("lastSMSAt = %v after a deferred delivery, want unset", last)
+	}
+	clock.Advance(time.Minute)
+	deliverer.Deliver(context.Background(), pending)
+	if last := deliverer.notifier.metrics.lastSMSAt; !last.Equal(clock.Now()) {
+		t.Errorf("lastSMSAt = %v, want %v", last, clock.Now())
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Minimal MQTT 3.1.1 publisher (CONNECT, PUBLISH QoS 0/1/2, DISCONNECT).
+// SMS arrive a few times a day, so the sink connects per message instead of
+// keeping a session alive: no keepalive goroutine, no half-dead TCP
+// connections swallowing QoS 0 publishes, and a broker restart needs no
+// reconnect logic.
+
+const (
+	mqttConnect    = 0x10
+	mqttConnack    = 0x20
+	mqttPublish    = 0x30
+	mqttPuback     = 0x40
+	mqttPubrec     = 0x50
+	mqttPubrel     = 0x62 // includes the mandatory 0b0010 flags
+	mqttPubcomp    = 0x70
+	mqttDisconnect = 0xE0
+)
+
+// MQTTOptions configures the broker connection (MQTT_* variables).
+type MQTTOptions struct {
+	// URL is mqtt://host[:1883] or mqtts://host[:8883] (TLS).
+	URL      string
+	Username string
+	Password string
+	ClientID string
+	Topic    string
+	QoS      byte
+	// CAFile optionally replaces the system roots for mqtts.
+	CAFile  string
+	Timeout time.Duration
+	// DiscoveryPrefix enables Home Assistant discovery (HA_DISCOVERY); empty
+	// disables it.
+	DiscoveryPrefix string
+}
+
+// parseMQTTURL validates MQTT_URL and returns the dial address and whether
+// TLS is used.
+func parseMQTTURL(rawURL string) (addr string, useTLS bool, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false, fmt.Errorf("unparseable URL")
+	}
+	port := "1883"
+	switch u.Scheme {
+	case "mqtt", "tcp":
+	case "mqtts", "ssl", "tls":
+		useTLS, port = true, "8883"
+	default:
+		return "", false, fmt.Errorf("unsupported scheme %q (use mqtt:// or mqtts://)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", false, fmt.Errorf("missing host")
+	}
+	if u.User != nil {
+		return "", false, fmt.Errorf("credentials in the URL are not supported; use MQTT_USERNAME/MQTT_PASSWORD")
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port), useTLS, nil
+}
+
+// mqttConn is one short-lived broker session.
+type mqttConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	nextID uint16
+}
+
+// dialMQTT connects and completes the CONNECT/CONNACK handshake with a
+// clean session. The whole session is bounded by opts.Timeout.
+func dialMQTT(ctx context.Context, opts MQTTOptions) (*mqttConn, error) {
+	addr, useTLS, err := parseMQTTURL(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	var conn net.Conn
+	if useTLS {
+		tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+		if opts.CAFile != "" {
+			pem, err := os.ReadFile(opts.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("reading MQTT CA file: %w", err)
+			}
+			tlsCfg.RootCAs = x509.NewCertPool()
+			if !tlsCfg.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("MQTT CA file %s contains no PEM certificates", opts.CAFile)
+			}
+		}
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsCfg}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(opts.Timeout)) // socket deadlines need wall time, not clk
+	c := &mqttConn{conn: conn, r: bufio.NewReader(conn), nextID: 1}
+
+	if err := c.writePacket(mqttConnect, encodeConnect(opts)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	typ, body, err := c.readPacket()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading CONNACK: %w", err)
+	}
+	if typ != mqttConnack || len(body) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected packet 0x%02x instead of CONNACK", typ)
+	}
+	if code := body[1]; code != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("broker refused connection: %s", connackReason(code))
+	}
+	return c, nil
+}
+
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("return code %d", code)
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func encodeConnect(opts MQTTOptions) []byte {
+	flags := byte(0x02) // clean session
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+	b := appendMQTTString(nil, "MQTT")
+	b = append(b, 4, flags)                 // protocol level 3.1.1
+	b = binary.BigEndian.AppendUint16(b, 0) // keepalive disabled: short sessions
+	b = appendMQTTString(b, opts.ClientID)
+	if opts.Username != "" {
+		b = appendMQTTString(b, opts.Username)
+		if opts.Password != "" {
+			b = appendMQTTString(b, opts.Password)
+		}
+	}
+	return b
+}
+
+// appendRemainingLength encodes the MQTT variable-length integer.
+func appendRemainingLength(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func (c *mqttConn) writePacket(header byte, body []byte) error {
+	pkt := appendRemainingLength([]byte{header}, len(body))
+	_, err := c.conn.Write(append(pkt, body...))
+	return err
+}
+
+func (c *mqttConn) readPacket() (byte, []byte, error) {
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+		digit, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&0x7F) * multiplier
+		if digit&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// expectAck reads the next packet and checks its type and packet id.
+func (c *mqttConn) expectAck(typ byte, id uint16) error {
+	got, body, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if got&0xF0 != typ&0xF0 || len(body) < 2 || binary.BigEndian.Uint16(body) != id {
+		return fmt.Errorf("unexpected packet 0x%02x while waiting for 0x%02x id %d", got, typ, id)
+	}
+	return nil
+}
+
+// publish sends one message and completes the QoS handshake.
+func (c *mqttConn) publish(topic string, payload []byte, qos byte, retain bool) error {
+	header := byte(mqttPublish) | qos<<1
+	if retain {
+		header |= 0x01
+	}
+	body := appendMQTTString(nil, topic)
+	id := c.nextID
+	if qos > 0 {
+		c.nextID++
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, payload...)
+	if err := c.writePacket(header, body); err != nil {
+		return err
+	}
+
+	switch qos {
+	case 1:
+		return c.expectAck(mqttPuback, id)
+	case 2:
+		if err := c.expectAck(mqttPubrec, id); err != nil {
+			return err
+		}
+		if err := c.writePacket(mqttPubrel, binary.BigEndian.AppendUint16(nil, id)); err != nil {
+			return err
+		}
+		return c.expectAck(mqttPubcomp, id)
+	}
+	return nil
+}
+
+// close sends DISCONNECT (best effort) and closes the connection.
+func (c *mqttConn) close() {
+	c.writePacket(mqttDisconnect, nil)
+	c.conn.Close()
+}
+
+// MQTTSink publishes every SMS as a JSON SMSPayload to MQTT_TOPIC. All
+// failures are transient: the SMS stays on the SIM and is retried.
+type MQTTSink struct {
+	opts   MQTTOptions
+	dryRun bool
+}
+
+func NewMQTTSink(opts MQTTOptions, dryRun bool) *MQTTSink {
+	return &MQTTSink{opts: opts, dryRun: dryRun}
+}
+
+func (m *MQTTSink) Name() string { return "mqtt" }
+
+func (m *MQTTSink) Send(ctx context.Context, pending PendingSMS) error {
+	payload, err := json.Marshal(newSMSPayload(pending))
+	if err != nil {
+		return fmt.Errorf("%w: encoding payload: %v", errSinkRejected, err)
+	}
+	if m.dryRun {
+		slog.InfoContext(ctx, "DRY_RUN: Would publish to MQTT", "topic", m.opts.Topic, "bytes", len(payload))
+		return nil
+	}
+	conn, err := dialMQTT(ctx, m.opts)
+	if err != nil {
+		return fmt.Errorf("MQTT connect: %w", err)
+	}
+	defer conn.close()
+	if err := conn.publish(m.opts.Topic, payload, m.opts.QoS, false); err != nil {
+		return fmt.Errorf("MQTT publish: %w", err)
+	}
+	slog.DebugContext(ctx, "Published SMS to MQTT", "topic", m.opts.Topic, "qos", m.opts.QoS)
+	return nil
+}
@@ -0,0 +1,202 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Minimal NATS publisher (core protocol: INFO, CONNECT, PUB/HPUB, PING).
+// Like the MQTT sink it opens one short session per SMS; the PING/PONG round
+// trip after the publish confirms the server processed it (protocol errors
+// arrive as -ERR before the PONG).
+
+// NATSOptions configures the NATS sink (NATS_* variables).
+type NATSOptions struct {
+	// URL is nats://host[:4222] or tls://host[:4222].
+	URL      string
+	Subject  string
+	User     string
+	Password string
+	Token    string
+	Timeout  time.Duration
+}
+
+// parseNATSURL validates NATS_URL and returns the dial address, the host
+// name for TLS verification and whether the URL demands TLS.
+func parseNATSURL(rawURL string) (addr, host string, useTLS bool, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", false, fmt.Errorf("unparseable URL")
+	}
+	switch u.Scheme {
+	case "nats":
+	case "tls":
+		useTLS = true
+	default:
+		return "", "", false, fmt.Errorf("unsupported scheme %q (use nats:// or tls://)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", "", false, fmt.Errorf("missing host")
+	}
+	if u.User != nil {
+		return "", "", false, fmt.Errorf("credentials in the URL are not supported; use NATS_USER/NATS_PASSWORD or NATS_TOKEN")
+	}
+	port := u.Port()
+	if port == "" {
+		port = "4222"
+	}
+	return net.JoinHostPort(u.Hostname(), port), u.Hostname(), useTLS, nil
+}
+
+// validNATSSubject rejects wildcards and whitespace, which are not allowed
+// when publishing.
+func validNATSSubject(s string) bool {
+	if s == "" || strings.ContainsAny(s, "*> \t\r\n") {
+		return false
+	}
+	for _, token := range strings.Split(s, ".") {
+		if token == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// natsInfo is the subset of the server INFO we act on.
+type natsInfo struct {
+	Headers     bool `json:"headers"`
+	TLSRequired bool `json:"tls_required"`
+}
+
+// natsConnect is the CONNECT options document (verbose off: no +OK per
+// command).
+type natsConnect struct {
+	Verbose   bool   `json:"verbose"`
+	Pedantic  bool   `json:"pedantic"`
+	Name      string `json:"name"`
+	Lang      string `json:"lang"`
+	Version   string `json:"version"`
+	Protocol  int    `json:"protocol"`
+	Headers   bool   `json:"headers"`
+	User      string `json:"user,omitempty"`
+	Pass      string `json:"pass,omitempty"`
+	AuthToken string `json:"auth_token,omitempty"`
+}
+
+// NATSSink publishes every SMS as a JSON SMSPayload to NATS_SUBJECT. The
+// sender is carried in the SMS-Sender header and the message key in
+// Nats-Msg-Id, so a JetStream stream deduplicates a publish retried after a
+// lost acknowledgement. All failures are transient.
+type NATSSink struct {
+	opts   NATSOptions
+	dryRun bool
+}
+
+func NewNATSSink(opts NATSOptions, dryRun bool) *NATSSink {
+	return &NATSSink{opts: opts, dryRun: dryRun}
+}
+
+func (n *NATSSink) Name() string { return "nats" }
+
+func (n *NATSSink) Send(ctx context.Context, pending PendingSMS) error {
+	payload, err := json.Marshal(newSMSPayload(pending))
+	if err != nil {
+		return fmt.Errorf("%w: encoding payload: %v", errSinkRejected, err)
+	}
+	if n.dryRun {
+		slog.InfoContext(ctx, "DRY_RUN: Would publish to NATS", "subject", n.opts.Subject, "bytes", len(payload))
+		return nil
+	}
+	if err := n.publish(ctx, pending, payload); err != nil {
+		return fmt.Errorf("NATS publish: %w", err)
+	}
+	slog.DebugContext(ctx, "Published SMS to NATS", "subject", n.opts.Subject)
+	return nil
+}
+
+func (n *NATSSink) publish(ctx context.Context, pending PendingSMS, payload []byte) error {
+	addr, host, useTLS, err := parseNATSURL(n.opts.URL)
+	if err != nil {
+		return err
+	}
+	conn, err := (&net.Dialer{Timeout: n.opts.Timeout}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer func() { conn.Close() }()
+	conn.SetDeadline(time.Now().Add(n.opts.Timeout)) // socket deadlines need wall time, not clk
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("reading INFO: %w", err)
+	}
+	infoJSON, ok := strings.CutPrefix(strings.TrimRight(line, "\r\n"), "INFO ")
+	if !ok {
+		return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(infoJSON), &info); err != nil {
+		return fmt.Errorf("parsing INFO: %w", err)
+	}
+
+	if useTLS || info.TLSRequired {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("TLS handshake: %w", err)
+		}
+		conn = tlsConn
+		r = bufio.NewReader(conn)
+	}
+
+	connect, err := json.Marshal(natsConnect{
+		Name: "sms-to-telegram", Lang: "go", Version: "1", Protocol: 1,
+		Headers: info.Headers, User: n.opts.User, Pass: n.opts.Password, AuthToken: n.opts.Token,
+	})
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CONNECT %s\r\n", connect)
+	if info.Headers {
+		headers := "NATS/1.0\r\n" +
+			"Nats-Msg-Id: " + messageKey(pending) + "\r\n" +
+			"SMS-Sender: " + strings.NewReplacer("\r", "", "\n", "").Replace(pending.Message.From) + "\r\n\r\n"
+		fmt.Fprintf(&b, "HPUB %s %d %d\r\n%s", n.opts.Subject, len(headers), len(headers)+len(payload), headers)
+	} else {
+		fmt.Fprintf(&b, "PUB %s %d\r\n", n.opts.Subject, len(payload))
+	}
+	b.Write(payload)
+	b.WriteString("\r\nPING\r\n")
+	if _, err := conn.Write([]byte(b.String())); err != nil {
+		return err
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("waiting for PONG: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			conn.Write([]byte("PONG\r\n"))
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
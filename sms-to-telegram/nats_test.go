@@ -0,0 +1,114 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeNATSServer accepts one client, greets it with info, answers PING with
+// reply and returns everything the client sent.
+func fakeNATSServer(t *testing.T, info, reply string) (url string, received <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	out := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("INFO " + info + "\r\n"))
+		var got strings.Builder
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			got.WriteString(line)
+			if err != nil {
+				break
+			}
+			if fields := strings.Fields(line); len(fields) > 0 && (fields[0] == "HPUB" || fields[0] == "PUB") {
+				n, _ := strconv.Atoi(fields[len(fields)-1])
+				buf := make([]byte, n+2)
+				io.ReadFull(r, buf)
+				got.Write(buf)
+			}
+			if line == "PING\r\n" {
+				conn.Write([]byte(reply))
+				break
+			}
+		}
+		out <- got.String()
+	}()
+	return "nats://" + ln.Addr().String(), out
+}
+
+func TestNATSSink_Publish(t *testing.T) {
+	url, received := fakeNATSServer(t, `{"headers":true}`, "PONG\r\n")
+	sink := NewNATSSink(NATSOptions{URL: url, Subject: "sms.in", Token: "s3cret", Timeout: 2 * time.Second}, false)
+	pending := PendingSMS{Message: SMSMessage{From: "+100", Text: "code 1234"}, PartIndices: []int{2}}
+	if err := sink.Send(context.Background(), pending); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	got := <-received
+	for _, want := range []string{
+		`"auth_token":"s3cret"`,
+		"HPUB sms.in ",
+		"Nats-Msg-Id: " + messageKey(pending) + "\r\n",
+		"SMS-Sender: +100\r\n",
+		`"text":"code 1234"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("client sent %q, missing %q", got, want)
+		}
+	}
+	if strings.Contains(got, `"user"`) {
+		t.Errorf("CONNECT carries an empty user: %q", got)
+	}
+}
+
+func TestNATSSink_NoHeadersAndErrors(t *testing.T) {
+	url, received := fakeNATSServer(t, `{}`, "PONG\r\n")
+	sink := NewNATSSink(NATSOptions{URL: url, Subject: "sms", Timeout: 2 * time.Second}, false)
+	if err := sink.Send(context.Background(), PendingSMS{}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got := <-received; !strings.Contains(got, "\r\nPUB sms ") || strings.Contains(got, "HPUB") {
+		t.Errorf("server without headers got %q, want plain PUB", got)
+	}
+
+	url, _ = fakeNATSServer(t, `{}`, "-ERR 'Permissions Violation for Publish to sms'\r\n")
+	sink = NewNATSSink(NATSOptions{URL: url, Subject: "sms", Timeout: 2 * time.Second}, false)
+	if err := sink.Send(context.Background(), PendingSMS{}); err == nil || !strings.Contains(err.Error(), "Permissions Violation") {
+		t.Errorf("Send() error = %v, want the server error", err)
+	}
+}
+
+func TestValidNATSSubject(t *testing.T) {
+	for subject, want := range map[string]bool{
+		"sms.received": true,
+		"sms":          true,
+		"sms.*":        false,
+		"sms.>":        false,
+		"sms..in":      false,
+		"sms in":       false,
+		"":             false,
+	} {
+		if got := validNATSSubject(subject); got != want {
+			t.Errorf("validNATSSubject(%q) = %v, want %v", subject, got, want)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // SHA-256 for RS256/ES256/PS256
+	_ "crypto/sha512" // SHA-384/512 for the 384/512 variants
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDC bearer tokens (OIDC_ISSUER): the API is a resource server. It does
+// not log anybody in; callers (or a proxy such as oauth2-proxy in front of
+// the dashboard) bring an ID or access token in JWT form. The issuer's
+// signing keys are found through its discovery document and cached.
+
+const (
+	oidcFetchTimeout = 10 * time.Second
+	// oidcKeysMaxAge is how long the JWKS is used before it is fetched again.
+	oidcKeysMaxAge = time.Hour
+	// oidcRefetchInterval bounds the fetches an unknown key ID triggers.
+	oidcRefetchInterval = time.Minute
+	// oidcLeeway tolerates clock skew on exp and nbf.
+	oidcLeeway = time.Minute
+	// oidcMaxDocument bounds the discovery document and the JWKS.
+	oidcMaxDocument = 1 << 20
+)
+
+// OIDCOptions configures the verification of OIDC tokens (OIDC_*
+// variables).
+type OIDCOptions struct {
+	Issuer   string
+	Audience string
+	// GroupsClaim names the claim holding the caller's groups.
+	GroupsClaim string
+	// AdminGroups grant the admin role. ReadGroups grant the read role; when
+	// empty, every valid token may read.
+	AdminGroups, ReadGroups []string
+}
+
+// OIDCVerifier checks bearer JWTs against the issuer's keys.
+type OIDCVerifier struct {
+	opts   OIDCOptions
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey // by key ID
+	fetchedAt time.Time
+	// fetching is closed when the JWKS fetch in flight ends, nil when none
+	// is; fetchErr is how the last one failed.
+	fetching chan struct{}
+	fetchErr error
+}
+
+func NewOIDCVerifier(opts OIDCOptions) *OIDCVerifier {
+	return &OIDCVerifier{opts: opts, client: &http.Client{Timeout: oidcFetchTimeout}}
+}
+
+// jwtClaims are the claims the verifier looks at; the groups claim is
+// read separately since its name is configured.
+type jwtClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	Expires   *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+	Username  string          `json:"preferred_username"`
+	Email     string          `json:"email"`
+}
+
+// Verify checks token and returns the caller's name and role. A valid
+// token of a caller in none of the groups gets roleNone.
+func (v *OIDCVerifier) Verify(ctx context.Context, token string) (string, apiRole, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", roleNone, errors.New("bearer token is neither API_TOKEN nor a JWT")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return "", roleNone, fmt.Errorf("JWT header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", roleNone, errors.New("JWT signature is not base64url")
+	}
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return "", roleNone, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return "", roleNone, err
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return "", roleNone, fmt.Errorf("JWT claims: %w", err)
+	}
+	now := clk.Now()
+	switch {
+	case claims.Issuer != v.opts.Issuer:
+		return "", roleNone, fmt.Errorf("JWT issuer %q is not OIDC_ISSUER", claims.Issuer)
+	case !jwtAudienceHas(claims.Audience, v.opts.Audience):
+		return "", roleNone, errors.New("JWT audience does not include OIDC_AUDIENCE")
+	case claims.Expires == nil:
+		return "", roleNone, errors.New("JWT has no expiry")
+	case now.After(time.Unix(int64(*claims.Expires), 0).Add(oidcLeeway)):
+		return "", roleNone, errors.New("JWT expired")
+	case claims.NotBefore != nil && now.Add(oidcLeeway).Before(time.Unix(int64(*claims.NotBefore), 0)):
+		return "", roleNone, errors.New("JWT not valid yet")
+	}
+
+	name := claims.Username
+	if name == "" {
+		name = claims.Email
+	}
+	if name == "" {
+		name = claims.Subject
+	}
+	var all map[string]json.RawMessage
+	decodeJWTPart(parts[1], &all)
+	groups := jwtStrings(all[v.opts.GroupsClaim])
+	switch {
+	case slices.ContainsFunc(groups, func(g string) bool { return slices.Contains(v.opts.AdminGroups, g) }):
+		return name, roleAdmin, nil
+	case len(v.opts.ReadGroups) == 0,
+		slices.ContainsFunc(groups, func(g string) bool { return slices.Contains(v.opts.ReadGroups, g) }):
+		return name, roleRead, nil
+	}
+	return name, roleNone, nil
+}
+
+// key returns the issuer key kid names, fetching the JWKS when it is old
+// or does not have it. One fetch runs at a time, without the lock: while
+// it does, known keys are served as they are and unknown ones wait for it.
+// An empty kid matches a JWKS of one key.
+func (v *OIDCVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := clk.Now()
+	stale := now.Sub(v.fetchedAt) > oidcKeysMaxAge
+	if _, known := v.keys[kid]; stale || (!known && now.Sub(v.fetchedAt) > oidcRefetchInterval) {
+		if fetching := v.fetching; fetching == nil {
+			v.fetching = make(chan struct{})
+			v.mu.Unlock()
+			keys, err := v.fetchKeys(ctx)
+			v.mu.Lock()
+			// On error keep using the old keys until a later fetch works.
+			if err == nil {
+				v.keys, v.fetchedAt = keys, now
+			}
+			v.fetchErr = err
+			close(v.fetching)
+			v.fetching = nil
+		} else if !known {
+			v.mu.Unlock()
+			select {
+			case <-fetching:
+			case <-ctx.Done():
+				v.mu.Lock()
+				return nil, ctx.Err()
+			}
+			v.mu.Lock()
+		}
+		if v.keys == nil && v.fetchErr != nil {
+			return nil, fmt.Errorf("OIDC keys: %w", v.fetchErr)
+		}
+	}
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("JWT signed with unknown key %q", kid)
+}
+
+// fetchKeys reads the discovery document and the JWKS it names.
+func (v *OIDCVerifier) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := v.getJSON(ctx, strings.TrimSuffix(v.opts.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if discovery.Issuer != v.opts.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q", discovery.Issuer)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document has no jwks_uri")
+	}
+	var jwks struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := v.getJSON(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, raw := range jwks.Keys {
+		kid, key, err := parseJWK(raw)
+		if err != nil {
+			// Keys of other types or uses are not for us.
+			continue
+		}
+		keys[kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no usable signing key")
+	}
+	return keys, nil
+}
+
+func (v *OIDCVerifier) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching %s: %w", redactURL(url), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: HTTP %d", redactURL(url), resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxDocument)).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s: %w", redactURL(url), err)
+	}
+	return nil
+}
+
+// parseJWK parses an RSA or EC signing key.
+func parseJWK(raw json.RawMessage) (string, crypto.PublicKey, error) {
+	var jwk struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", nil, err
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return "", nil, fmt.Errorf("key use %q", jwk.Use)
+	}
+	b64 := base64.RawURLEncoding
+	switch jwk.Kty {
+	case "RSA":
+		n, err1 := b64.DecodeString(jwk.N)
+		e, err2 := b64.DecodeString(jwk.E)
+		if err1 != nil || err2 != nil || len(e) == 0 || len(e) > 4 {
+			return "", nil, errors.New("invalid RSA key")
+		}
+		exp := int(new(big.Int).SetBytes(e).Int64())
+		return jwk.Kid, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}, nil
+	case "EC":
+		x, err1 := b64.DecodeString(jwk.X)
+		y, err2 := b64.DecodeString(jwk.Y)
+		if err1 != nil || err2 != nil {
+			return "", nil, errors.New("invalid EC key")
+		}
+		curve, size, ok := ecdsaCurve(jwk.Crv)
+		if !ok || len(x) != size || len(y) != size {
+			return "", nil, fmt.Errorf("unsupported EC key on %q", jwk.Crv)
+		}
+		key, err := ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return "", nil, err
+		}
+		return jwk.Kid, key, nil
+	}
+	return "", nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// ecdsaCurve returns the curve of a JWK "crv" and its coordinate size.
+func ecdsaCurve(crv string) (elliptic.Curve, int, bool) {
+	switch crv {
+	case "P-256":
+		return elliptic.P256(), 32, true
+	case "P-384":
+		return elliptic.P384(), 48, true
+	case "P-521":
+		return elliptic.P521(), 66, true
+	}
+	return nil, 0, false
+}
+
+// verifyJWTSignature checks sig over signed with key for the JWS algorithm
+// alg. Symmetric algorithms and "none" are refused.
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	var hash crypto.Hash
+	switch alg[min(len(alg), 2):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported JWT algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		var err error
+		switch alg[:2] {
+		case "RS":
+			err = rsa.VerifyPKCS1v15(k, hash, digest, sig)
+		case "PS":
+			err = rsa.VerifyPSS(k, hash, digest, sig, nil)
+		default:
+			return fmt.Errorf("JWT algorithm %q does not match the RSA key", alg)
+		}
+		if err != nil {
+			return errors.New("invalid JWT signature")
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || len(sig) != 2*size {
+			return fmt.Errorf("JWT algorithm %q does not match the EC key", alg)
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid JWT signature")
+		}
+	default:
+		return errors.New("unsupported key")
+	}
+	return nil
+}
+
+func decodeJWTPart(part string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("not base64url")
+	}
+	return json.Unmarshal(data, out)
+}
+
+// jwtAudienceHas reports whether the aud claim (a string or an array of
+// them) contains audience.
+func jwtAudienceHas(aud json.RawMessage, audience string) bool {
+	return slices.Contains(jwtStrings(aud), audience)
+}
+
+// jwtStrings reads a claim that is a string or an array of strings.
+func jwtStrings(raw json.RawMessage) []string {
+	var one string
+	if json.Unmarshal(raw, &one) == nil {
+		return []string{one}
+	}
+	var many []string
+	json.Unmarshal(raw, &many)
+	return many
+}
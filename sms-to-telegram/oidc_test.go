@@ -0,0 +1,244 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testIssuer is an OIDC provider serving discovery and a JWKS with one RSA
+// and one EC key.
+type testIssuer struct {
+	*httptest.Server
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	fetches atomic.Int32
+	// keysGate, while held, stalls the JWKS responses.
+	keysGate sync.Mutex
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	iss := &testIssuer{}
+	var err error
+	if iss.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if iss.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding
+	ecPoint, err := iss.ecKey.PublicKey.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa1", "use": "sig", "n": b64.EncodeToString(iss.rsaKey.N.Bytes()),
+			"e": b64.EncodeToString(big.NewInt(int64(iss.rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": b64.EncodeToString(ecPoint[1:33]), "y": b64.EncodeToString(ecPoint[33:])},
+		{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+	}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": iss.URL, "jwks_uri": iss.URL + "/keys"})
+	})
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		iss.fetches.Add(1)
+		iss.keysGate.Lock()
+		iss.keysGate.Unlock()
+		json.NewEncoder(w).Encode(jwks)
+	})
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+// sign returns a JWT of claims signed with the issuer's key of kid.
+func (iss *testIssuer) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	b64 := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	var err error
+	switch alg {
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, iss.rsaKey, crypto.SHA256, digest[:])
+	case "PS256":
+		sig, err = rsa.SignPSS(rand.Reader, iss.rsaKey, crypto.SHA256, digest[:], nil)
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, iss.ecKey, digest[:])
+		if err == nil {
+			sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	case "none":
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func TestOIDCVerifier(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	iss := newTestIssuer(t)
+	v := NewOIDCVerifier(OIDCOptions{
+		Issuer:      iss.URL,
+		Audience:    "sms-gateway",
+		GroupsClaim: "roles",
+		AdminGroups: []string{"sms-admin"},
+		ReadGroups:  []string{"sms-read"},
+	})
+	now := clock.Now().Unix()
+	claims := func(edit func(map[string]any)) map[string]any {
+		c := map[string]any{
+			"iss": iss.URL, "aud": []string{"other", "sms-gateway"}, "sub": "u-1",
+			"preferred_username": "alice", "exp": now + 300, "roles": []string{"sms-read"},
+		}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantRole apiRole
+		wantErr  bool
+	}{
+		{"reader RS256", iss.sign(t, "RS256", "rsa1", claims(nil)), roleRead, false},
+		{"admin ES256", iss.sign(t, "ES256", "ec1", claims(func(c map[string]any) { c["roles"] = "sms-admin" })), roleAdmin, false},
+		{"reader PS256, string aud", iss.sign(t, "PS256", "rsa1", claims(func(c map[string]any) { c["aud"] = "sms-gateway" })), roleRead, false},
+		{"no group", iss.sign(t, "RS256", "rsa1", claims(func(c map[string]any) { delete(c, "roles") })), roleNone, false},
+		{"wrong audience", iss.sign(t, "RS256", "rsa1", claims(func(c map[string]any) { c["aud"] = "other" })), roleNone, true},
+		{"wrong issuer", iss.sign(t, "RS256", "rsa1", claims(func(c map[string]any) { c["iss"] = "https://evil.example" })), roleNone, true},
+		{"expired", iss.sign(t, "RS256", "rsa1", claims(func(c map[string]any) { c["exp"] = now - 120 })), roleNone, true},
+		{"skew tolerated", iss.sign(t, "RS256", "rsa1", claims(func(c map[string]any) { c["exp"] = now - 30 })), roleRead, false},
+		{"not yet valid", iss.sign(t, "RS256", "rsa1", claims(func(c map[string]any) { c["nbf"] = now + 600 })), roleNone, true},
+		{"no expiry", iss.sign(t, "RS256", "rsa1", claims(func(c map[string]any) { delete(c, "exp") })), roleNone, true},
+		{"alg none", iss.sign(t, "none", "rsa1", claims(nil)), roleNone, true},
+		{"HMAC key", iss.sign(t, "RS256", "hmac", claims(nil)), roleNone, true},
+		{"algorithm mismatch", iss.sign(t, "RS256", "ec1", claims(nil)), roleNone, true},
+		{"unknown key", iss.sign(t, "RS256", "rsa2", claims(nil)), roleNone, true},
+		{"not a JWT", "s3cret", roleNone, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, role, err := v.Verify(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr || role != tt.wantRole {
+				t.Fatalf("Verify() = %q, %v, %v; want role %v, error %v", name, role, err, tt.wantRole, tt.wantErr)
+			}
+			if err == nil && name != "alice" {
+				t.Errorf("name = %q, want alice", name)
+			}
+		})
+	}
+
+	// Keys are cached; an unknown key ID refetches at most once a minute.
+	if got := iss.fetches.Load(); got != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", got)
+	}
+	clock.Advance(2 * time.Minute)
+	v.Verify(context.Background(), iss.sign(t, "RS256", "rsa2", claims(nil)))
+	if got := iss.fetches.Load(); got != 2 {
+		t.Errorf("JWKS fetched %d times after an unknown key, want 2", got)
+	}
+}
+
+// TestOIDCVerifier_SlowIssuer: a JWKS fetch holds up neither the callers
+// with a known key nor, by another fetch, the ones with an unknown key.
+func TestOIDCVerifier_SlowIssuer(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	iss := newTestIssuer(t)
+	v := NewOIDCVerifier(OIDCOptions{Issuer: iss.URL, Audience: "sms-gateway", GroupsClaim: "roles"})
+	claims := map[string]any{"iss": iss.URL, "aud": "sms-gateway", "sub": "u-1", "exp": clock.Now().Unix() + 300}
+	known, unknown := iss.sign(t, "RS256", "rsa1", claims), iss.sign(t, "RS256", "rsa2", claims)
+	if _, _, err := v.Verify(context.Background(), known); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	clock.Advance(2 * time.Minute)
+	iss.keysGate.Lock()
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := v.Verify(context.Background(), unknown); err == nil {
+				t.Error("Verify() with an unknown key succeeded")
+			}
+		}()
+	}
+	for iss.fetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, role, err := v.Verify(context.Background(), known); err != nil || role != roleRead {
+		t.Errorf("Verify() during a fetch = %v, %v; want read", role, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := v.Verify(ctx, unknown); err == nil {
+		t.Error("Verify() with a canceled context succeeded")
+	}
+	iss.keysGate.Unlock()
+	wg.Wait()
+	if got := iss.fetches.Load(); got != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", got)
+	}
+}
+
+func TestAPIServer_OIDC(t *testing.T) {
+	iss := newTestIssuer(t)
+	api := newTestAPI(t, "")
+	api.auth = NewAPIAuth("", nil, NewOIDCVerifier(OIDCOptions{
+		Issuer: iss.URL, Audience: "sms-gateway", GroupsClaim: "groups", AdminGroups: []string{"ops"},
+	}))
+	exp := clk.Now().Add(time.Hour).Unix()
+	reader := iss.sign(t, "RS256", "rsa1", map[string]any{"iss": iss.URL, "aud": "sms-gateway", "sub": "u-2", "exp": exp})
+	admin := iss.sign(t, "ES256", "ec1", map[string]any{"iss": iss.URL, "aud": "sms-gateway", "sub": "u-3", "exp": exp, "groups": []string{"ops"}})
+
+	tests := []struct {
+		name     string
+		method   string
+		token    string
+		wantCode int
+	}{
+		{"read without groups", http.MethodGet, reader, http.StatusOK},
+		{"write without groups", http.MethodPost, reader, http.StatusForbidden},
+		{"write as ops", http.MethodPost, admin, http.StatusMethodNotAllowed},
+		{"garbage", http.MethodGet, "a.b.c", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/messages", nil)
+			bearer(tt.token)(req)
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+}
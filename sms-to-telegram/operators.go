@@ -0,0 +1,127 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Operator names: a modem without the network's name in its tables answers
+// AT+COPS? with the numeric PLMN code, MCC and MNC ("24405"). Known codes
+// are shown by name with the code kept, "Elisa (24405)", in /status, the
+// dashboard, the SIM rotation notice and `diag`. OPERATOR_NAMES_FILE adds
+// codes and overrides the built-in names.
+
+// builtinOperatorNames maps MCC+MNC to the brand name of the larger
+// networks; OPERATOR_NAMES_FILE covers the rest.
+var builtinOperatorNames = map[string]string{
+	// Nordic and Baltic countries
+	"24405": "Elisa", "24412": "DNA", "24491": "Telia",
+	"24001": "Telia", "24002": "3", "24007": "Tele2", "24008": "Telenor",
+	"24201": "Telenor", "24202": "Telia",
+	"23801": "TDC", "23802": "Telenor", "23806": "3", "23820": "Telia",
+	"24801": "Telia", "24802": "Elisa", "24803": "Tele2",
+	"24701": "LMT", "24702": "Tele2", "24705": "Bite",
+	"24601": "Telia", "24602": "Bite", "24603": "Tele2",
+	// Western Europe
+	"26201": "Telekom", "26202": "Vodafone", "26203": "O2", "26207": "O2",
+	"23410": "O2", "23415": "Vodafone", "23420": "Three", "23430": "EE", "23433": "EE",
+	"20801": "Orange", "20810": "SFR", "20815": "Free", "20820": "Bouygues",
+	"21401": "Vodafone", "21403": "Orange", "21404": "Yoigo", "21407": "Movistar",
+	"22201": "TIM", "22210": "Vodafone", "22250": "Iliad", "22288": "WindTre",
+	"20404": "Vodafone", "20408": "KPN", "20416": "Odido",
+	"20601": "Proximus", "20610": "Orange", "20620": "Base",
+	"23201": "A1", "23203": "Magenta", "23210": "3",
+	"22801": "Swisscom", "22802": "Sunrise", "22803": "Salt",
+	"26801": "Vodafone", "26803": "NOS", "26806": "MEO",
+	"27201": "Vodafone", "27202": "Three", "27205": "Three",
+	// Central, Eastern and Southern Europe
+	"26001": "Plus", "26002": "T-Mobile", "26003": "Orange", "26006": "Play",
+	"23001": "T-Mobile", "23002": "O2", "23003": "Vodafone",
+	"21601": "Yettel", "21630": "Telekom", "21670": "One",
+	"22601": "Vodafone", "22603": "Telekom", "22610": "Orange",
+	"22001": "Yettel", "22003": "mts", "22005": "A1",
+	"21901": "HT", "21902": "Telemach", "21910": "A1",
+	"20201": "Cosmote", "20205": "Vodafone", "20209": "Nova",
+	"28601": "Turkcell", "28602": "Vodafone", "28603": "Türk Telekom",
+	// CIS and the Caucasus
+	"25001": "MTS", "25002": "MegaFon", "25011": "Yota", "25020": "Tele2", "25099": "Beeline",
+	"25501": "Vodafone", "25503": "Kyivstar", "25506": "lifecell",
+	"25701": "A1", "25702": "MTS", "25704": "life:)",
+	"25901": "Orange", "25902": "Moldcell",
+	"40101": "Beeline", "40102": "Kcell", "40177": "Tele2",
+	"28201": "Silknet", "28202": "Magti",
+	"28301": "Team", "28310": "Ucom",
+	// Americas, Asia and Oceania
+	"310260": "T-Mobile", "310410": "AT&T", "311480": "Verizon",
+	"302220": "Telus", "302610": "Bell", "302720": "Rogers",
+	"46000": "China Mobile", "46001": "China Unicom", "46011": "China Telecom",
+	"44010": "docomo", "44020": "SoftBank", "44050": "au",
+	"50501": "Telstra", "50502": "Optus", "50503": "Vodafone",
+}
+
+// isPLMN reports whether s is a numeric operator code: a 3-digit MCC and a
+// 2- or 3-digit MNC.
+func isPLMN(s string) bool {
+	return (len(s) == 5 || len(s) == 6) && strings.Trim(s, "0123456789") == ""
+}
+
+// operatorName resolves a numeric operator from +COPS by names, then by the
+// built-in table; names and unknown codes are returned as they are.
+func operatorName(operator string, names map[string]string) string {
+	if !isPLMN(operator) {
+		return operator
+	}
+	name, ok := names[operator]
+	if !ok {
+		name, ok = builtinOperatorNames[operator]
+	}
+	if !ok {
+		return operator
+	}
+	return fmt.Sprintf("%s (%s)", name, operator)
+}
+
+func loadOperatorNames(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("invalid OPERATOR_NAMES_FILE %q: must be absolute", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading OPERATOR_NAMES_FILE: %w", err)
+	}
+	names, err := parseOperatorNames(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("OPERATOR_NAMES_FILE %w", err)
+	}
+	return names, nil
+}
+
+// parseOperatorNames reads "<MCC+MNC> <name>" lines; blank lines and
+// #-comments are skipped.
+func parseOperatorNames(s string) (map[string]string, error) {
+	names := make(map[string]string)
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		code, name, _ := strings.Cut(line, " ")
+		name = strings.TrimSpace(name)
+		switch {
+		case !isPLMN(code):
+			return nil, fmt.Errorf("line %d: %q is not an MCC+MNC code", i+1, code)
+		case name == "":
+			return nil, fmt.Errorf("line %d: want a code and a name", i+1)
+		}
+		names[code] = name
+	}
+	return names, nil
+}
@@ -0,0 +1,68 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOperatorName(t *testing.T) {
+	names, err := parseOperatorNames("# local names\n24405 Elisa Oyj\n\n99901  Test Network \n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		operator, want string
+	}{
+		{"24491", "Telia (24491)"},
+		{"310260", "T-Mobile (310260)"},
+		{"24405", "Elisa Oyj (24405)"},
+		{"99901", "Test Network (99901)"},
+		{"99999", "99999"},
+		{"Vodafone.de", "Vodafone.de"},
+		{"2440", "2440"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := operatorName(tt.operator, names); got != tt.want {
+			t.Errorf("operatorName(%q) = %q, want %q", tt.operator, got, tt.want)
+		}
+	}
+	if got := operatorName("25001", nil); got != "MTS (25001)" {
+		t.Errorf("operatorName() without names = %q", got)
+	}
+}
+
+func TestParseOperatorNames_Errors(t *testing.T) {
+	tests := []struct {
+		name, line, want string
+	}{
+		{"no name", "24405", "want a code and a name"},
+		{"short code", "2440 Elisa", `"2440" is not an MCC+MNC code`},
+		{"not numeric", "Elisa 24405", `"Elisa" is not an MCC+MNC code`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseOperatorNames("# names\n" + tt.line)
+			if err == nil || !strings.Contains(err.Error(), tt.want) || !strings.HasPrefix(err.Error(), "line 2: ") {
+				t.Errorf("parseOperatorNames(%q) error = %v, want line 2 and %q", tt.line, err, tt.want)
+			}
+		})
+	}
+}
+
+// A numeric +COPS answer reaches /status by name.
+func TestReportOperator_Numeric(t *testing.T) {
+	modem := newFakeAT()
+	modem.on("AT+COPS?", []string{`+COPS: 0,2,"24405"`}, nil)
+	notifier := NewErrorNotifier(&fakeSender{}, []int64{1}, false, "gw1", time.Second)
+	notifier.metrics = NewMetrics()
+
+	reportOperator(modem, notifier, "", nil)
+	if got := notifier.metrics.operator; got != "Elisa (24405)" {
+		t.Errorf("operator = %q, want the resolved name", got)
+	}
+}
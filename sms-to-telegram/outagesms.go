@@ -0,0 +1,167 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// outageCheckInterval is how often the outage watch looks at the Telegram
+// sends.
+const outageCheckInterval = time.Minute
+
+// OutageSMSOptions configures the outage SMS (OUTAGE_SMS_*).
+type OutageSMSOptions struct {
+	// Number is the admin's phone number.
+	Number string
+	// After is how long Telegram sends must fail before the SMS is sent.
+	After time.Duration
+}
+
+// TelegramOutage sends an SMS to the admin when Telegram has been
+// unreachable for OUTAGE_SMS_AFTER: every alert about it would go to
+// Telegram too, while the modem is a channel of its own. It wraps the
+// TelegramSender and watches every send; only transport failures count,
+// since any answer from Telegram (429, 400, 403) shows it is reachable.
+// Before the SMS a getMe probe confirms the outage, so a single failed
+// send followed by silence does not page anyone. One SMS per outage; once
+// Telegram answers again the chats are told an SMS was sent.
+type TelegramOutage struct {
+	sender   TelegramSender
+	prober   TelegramProber
+	opts     OutageSMSOptions
+	outbox   *Outbox
+	notifier *ErrorNotifier
+
+	mu sync.Mutex
+	// failingSince is the first failed send since the last one that got
+	// through; zero while Telegram works.
+	failingSince time.Time
+	// smsSent is set once the outage SMS went out, until recovered is
+	// reported; recovered is when Telegram answered again.
+	smsSent   bool
+	recovered time.Time
+	// outage is the start of the outage the SMS was sent for.
+	outage time.Time
+}
+
+func NewTelegramOutage(sender TelegramSender, prober TelegramProber, opts OutageSMSOptions) *TelegramOutage {
+	return &TelegramOutage{sender: sender, prober: prober, opts: opts}
+}
+
+// SendMessage sends through the wrapped sender and records the outcome.
+func (o *TelegramOutage) SendMessage(ctx context.Context, params *bot.SendMessageParams) (*models.Message, error) {
+	msg, err := o.sender.SendMessage(ctx, params)
+	o.record(err)
+	return msg, err
+}
+
+// record notes a send result; shutdown cancellations are no verdict.
+func (o *TelegramOutage) record(err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	class, _ := classifySendError(err)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if class != sendTransient {
+		if o.smsSent && o.recovered.IsZero() {
+			o.recovered = clk.Now()
+		}
+		o.failingSince = time.Time{}
+		return
+	}
+	if o.failingSince.IsZero() {
+		o.failingSince = clk.Now()
+	}
+}
+
+// Run checks the outage every outageCheckInterval until ctx ends.
+func (o *TelegramOutage) Run(ctx context.Context) {
+	slog.Info("Outage SMS enabled", "to", o.opts.Number, "after", o.opts.After)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-clk.After(outageCheckInterval):
+		}
+		o.check(ctx)
+	}
+}
+
+// check sends the outage SMS once Telegram has failed for opts.After and
+// reports the recovery once it answers again.
+func (o *TelegramOutage) check(ctx context.Context) {
+	o.mu.Lock()
+	since, sent, recovered, outage := o.failingSince, o.smsSent, o.recovered, o.outage
+	o.mu.Unlock()
+
+	if sent {
+		if !recovered.IsZero() {
+			o.reportRecovery(ctx, outage, recovered)
+		}
+		return
+	}
+	if since.IsZero() || clk.Now().Sub(since) < o.opts.After {
+		return
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, telegramProbeTimeout)
+	_, err := o.prober.GetMe(probeCtx)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+	o.record(err)
+	if class, _ := classifySendError(err); class != sendTransient {
+		slog.Info("Telegram reachable again before the outage SMS", "failing_since", since)
+		return
+	}
+
+	slog.Error("Telegram unreachable, sending outage SMS", "since", since, "to", o.opts.Number, "error", err)
+	sendCtx, cancel := context.WithTimeout(ctx, 3*cmgsTimeout)
+	_, err = o.outbox.Send(sendCtx, o.opts.Number, o.smsText(since))
+	cancel()
+	if err != nil {
+		// Retried on the next check.
+		slog.Error("Failed to send outage SMS", "error", err)
+		return
+	}
+	o.mu.Lock()
+	o.smsSent, o.recovered, o.outage = true, time.Time{}, since
+	o.mu.Unlock()
+}
+
+// smsText describes the outage in plain ASCII, so it fits one GSM 7-bit SMS
+// for ordinary host names. The send error is left out: transport errors
+// embed the request URL, which carries the bot token.
+func (o *TelegramOutage) smsText(since time.Time) string {
+	return fmt.Sprintf("sms-to-telegram %s: Telegram unreachable since %s (%s). SMS stay on the SIM until it is back.",
+		o.notifier.hostname, since.Format("2006-01-02 15:04 MST"), clk.Now().Sub(since).Round(time.Minute))
+}
+
+// reportRecovery tells the chats that the admin got an outage SMS.
+func (o *TelegramOutage) reportRecovery(ctx context.Context, outage, recovered time.Time) {
+	slog.Info("Telegram reachable again after outage", "since", outage, "duration", recovered.Sub(outage).Round(time.Second))
+	msg := fmt.Sprintf("<b>SMS Gateway Recovered</b>\n\n"+
+		"<b>Host:</b> %s\n"+
+		"<b>Status:</b> Telegram reachable again after %s\n\n"+
+		"<i>It was unreachable since %s; an outage SMS was sent to the admin number.</i>",
+		o.notifier.hostHTML(), recovered.Sub(outage).Round(time.Second),
+		outage.Format("2006-01-02 15:04:05"))
+	if err := o.notifier.sendToTelegram(ctx, msg); err != nil {
+		slog.Error("Failed to send outage recovery notification", "error", err)
+		return
+	}
+	o.mu.Lock()
+	o.smsSent, o.recovered = false, time.Time{}
+	o.mu.Unlock()
+}
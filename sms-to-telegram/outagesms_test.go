@@ -0,0 +1,102 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+// TestTelegramOutage: transport failures for OUTAGE_SMS_AFTER, confirmed by
+// getMe, send one SMS; the first send that gets through again is reported
+// to the chats.
+func TestTelegramOutage(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	down := true
+	inner := &fakeSender{script: func(int, int64, string) error {
+		if down {
+			return errors.New("dial tcp: i/o timeout")
+		}
+		return nil
+	}}
+	prober := &fakeProber{err: errors.New("dial tcp: i/o timeout")}
+	outage := NewTelegramOutage(inner, prober, OutageSMSOptions{Number: "+4915550009999", After: 30 * time.Minute})
+	outage.outbox = NewOutbox(false)
+	outage.notifier = NewErrorNotifier(outage, []int64{1}, false, "gw1", time.Second)
+	ctx := context.Background()
+
+	outage.notifier.sendToTelegram(ctx, "alert")
+	clock.Advance(29 * time.Minute)
+	outage.check(ctx)
+	if prober.calls != 0 || outage.outbox.Queued() != 0 {
+		t.Fatal("outage SMS before OUTAGE_SMS_AFTER")
+	}
+
+	clock.Advance(time.Minute)
+	sms := make(chan outgoingSMS, 1)
+	go func() {
+		req := <-outage.outbox.pending()
+		sms <- req
+		req.result <- outgoingResult{SendResult{Parts: 1}, nil}
+	}()
+	outage.check(ctx)
+	req := <-sms
+	if text := strings.Join(req.parts, ""); req.to != "+4915550009999" || !strings.Contains(text, "gw1: Telegram unreachable since") || !strings.Contains(text, "(30m0s)") {
+		t.Errorf("outage SMS to %s: %q", req.to, text)
+	}
+	// One SMS per outage.
+	clock.Advance(time.Hour)
+	outage.check(ctx)
+	if outage.outbox.Queued() != 0 || prober.calls != 1 {
+		t.Errorf("outage SMS repeated (%d probes)", prober.calls)
+	}
+
+	down = false
+	inner.sent = nil
+	outage.notifier.sendToTelegram(ctx, "alert")
+	outage.check(ctx)
+	if len(inner.sent) != 2 || !strings.Contains(inner.sent[1].Text, "Telegram reachable again after 1h30m0s") {
+		t.Errorf("sent %+v, want the recovery", inner.sent)
+	}
+	outage.check(ctx)
+	if len(inner.sent) != 2 {
+		t.Errorf("recovery repeated: %+v", inner.sent)
+	}
+}
+
+// Answers from Telegram are not an outage, and a probe that gets through
+// cancels the SMS.
+func TestTelegramOutage_Reachable(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	inner := &fakeSender{script: func(int, int64, string) error { return bot.ErrorForbidden }}
+	prober := &fakeProber{}
+	outage := NewTelegramOutage(inner, prober, OutageSMSOptions{Number: "+4915550009999", After: 5 * time.Minute})
+	outage.outbox = NewOutbox(false)
+	ctx := context.Background()
+
+	outage.SendMessage(ctx, &bot.SendMessageParams{ChatID: int64(1), Text: "x"})
+	clock.Advance(time.Hour)
+	outage.check(ctx)
+	if prober.calls != 0 {
+		t.Errorf("403 counted as an outage")
+	}
+
+	inner.script = func(int, int64, string) error { return errors.New("connection reset") }
+	outage.SendMessage(ctx, &bot.SendMessageParams{ChatID: int64(1), Text: "x"})
+	clock.Advance(time.Hour)
+	outage.check(ctx)
+	if prober.calls != 1 || outage.outbox.Queued() != 0 {
+		t.Errorf("probes %d, queued %d; want a probe and no SMS", prober.calls, outage.outbox.Queued())
+	}
+	if !outage.failingSince.IsZero() {
+		t.Error("successful probe did not end the outage")
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
+)
+
+// cmgsTimeout bounds one AT+CMGS dialog; network submission can take many
+// seconds on a weak signal.
+const cmgsTimeout = 60 * time.Second
+
+// SendResult describes a submitted SMS.
+type SendResult struct {
+	Parts int
+	// References are the TP-MR values the modem reported, one per part.
+	References []int
+}
+
+type outgoingSMS struct {
+	ctx    context.Context
+	to     string
+	parts  []string
+	ucs2   bool
+	result chan outgoingResult
+}
+
+type outgoingResult struct {
+	res SendResult
+	err error
+}
+
+// errInvalidSMS marks requests rejected before reaching the modem.
+var errInvalidSMS = errors.New("invalid SMS")
+
+// errOutboxStopped is returned when the request was not picked up before
+// its context ended (modem session down or busy).
+var errOutboxStopped = errors.New("modem did not accept the SMS in time")
+
+// errTextModeSend refuses outgoing SMS in a text-mode session: AT+CMGS
+// takes the destination there, not the PDU length.
+var errTextModeSend = errors.New("modem is in text mode: sending SMS is not supported")
+
+// Outbox hands outgoing SMS to the modem goroutine, the only owner of the
+// serial port. Requests are served between SIM polls; a caller waits until
+// its SMS was submitted or its context ends.
+type Outbox struct {
+	requests chan outgoingSMS
+	dryRun   bool
+	nextRef  byte
+}
+
+func NewOutbox(dryRun bool) *Outbox {
+	return &Outbox{requests: make(chan outgoingSMS, 8), dryRun: dryRun}
+}
+
+// Send validates, queues and waits for one outgoing SMS.
+func (o *Outbox) Send(ctx context.Context, to, text string) (SendResult, error) {
+	if !validDestination(to) {
+		return SendResult{}, fmt.Errorf("%w: destination %q is not a phone number", errInvalidSMS, to)
+	}
+	parts, ucs2, err := pdu.SplitForSubmit(text)
+	if err != nil {
+		return SendResult{}, fmt.Errorf("%w: %v", errInvalidSMS, err)
+	}
+	req := outgoingSMS{ctx: ctx, to: to, parts: parts, ucs2: ucs2, result: make(chan outgoingResult, 1)}
+	select {
+	case o.requests <- req:
+	case <-ctx.Done():
+		return SendResult{}, errOutboxStopped
+	}
+	select {
+	case r := <-req.result:
+		return r.res, r.err
+	case <-ctx.Done():
+		// The modem goroutine skips requests whose context ended before it
+		// got to them; one already in progress still completes.
+		return SendResult{}, errOutboxStopped
+	}
+}
+
+// pending returns the request channel for the modem loop's select; nil
+// (never ready) for a nil Outbox.
+func (o *Outbox) pending() <-chan outgoingSMS {
+	if o == nil {
+		return nil
+	}
+	return o.requests
+}
+
+// Queued returns the number of SMS waiting for the modem goroutine.
+func (o *Outbox) Queued() int {
+	if o == nil {
+		return 0
+	}
+	return len(o.requests)
+}
+
+// submit runs on the modem goroutine. A transport error is returned so the
+// caller can end the (now poisoned) session; the requester gets it too.
+func (o *Outbox) submit(modem SMSSubmitter, req outgoingSMS) error {
+	if req.ctx.Err() != nil {
+		return nil
+	}
+	res, err := o.submitParts(modem, req)
+	req.result <- outgoingResult{res, err}
+	if err != nil {
+		slog.Error("Failed to send SMS", "to", req.to, "parts", len(req.parts), "error", err)
+		if at.IsTimeoutError(err) {
+			return err
+		}
+		return nil
+	}
+	slog.Info("SMS sent", "to", req.to, "parts", res.Parts, "references", res.References)
+	return nil
+}
+
+// refuse answers a request without submitting it.
+func (o *Outbox) refuse(req outgoingSMS, err error) {
+	if req.ctx.Err() != nil {
+		return
+	}
+	req.result <- outgoingResult{err: err}
+	slog.Warn("Refused to send SMS", "to", req.to, "error", err)
+}
+
+func (o *Outbox) submitParts(modem SMSSubmitter, req outgoingSMS) (SendResult, error) {
+	res := SendResult{Parts: len(req.parts)}
+	var concat *pdu.Concat
+	if len(req.parts) > 1 {
+		o.nextRef++
+		concat = &pdu.Concat{Ref: int(o.nextRef), Total: len(req.parts)}
+	}
+	for i, part := range req.parts {
+		if concat != nil {
+			concat.Part = i + 1
+		}
+		pduHex, tpduLen, err := pdu.EncodeSubmit(req.to, part, req.ucs2, concat)
+		if err != nil {
+			return res, err
+		}
+		if o.dryRun {
+			slog.Info("DRY_RUN: Would send SMS part", "to", req.to, "part", i+1, "of", len(req.parts), "tpdu_bytes", tpduLen)
+			slog.Debug("DRY_RUN SMS part content", "text", part)
+			continue
+		}
+		resp, err := modem.CommandWithPrompt(fmt.Sprintf("AT+CMGS=%d", tpduLen), pduHex, cmgsTimeout)
+		if err != nil {
+			return res, fmt.Errorf("part %d/%d: %w", i+1, len(req.parts), err)
+		}
+		if mr, ok := parseCMGSReference(resp); ok {
+			res.References = append(res.References, mr)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,135 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
+)
+
+// Parse-failure telemetry: every undecodable SMS counts in
+// sms_to_telegram_pdu_parse_failures_total by kind, and with PDU_SAMPLE_FILE
+// its PDUs are appended to a file the user can attach to a bug report. The
+// sample keeps what the parser failed on, the structure and the user data,
+// but not the numbers: the sender's and the SMSC's digits are masked.
+
+// Parse failure kinds, the "kind" label of the metric.
+const (
+	parseFailureMalformed   = "malformed"
+	parseFailureUnsupported = "unsupported_encoding"
+)
+
+// parseFailureKinds are all kinds, so every one is exported from the start.
+var parseFailureKinds = []string{parseFailureMalformed, parseFailureUnsupported}
+
+// parseFailureKind classifies a pdu.Parse error.
+func parseFailureKind(err error) string {
+	var unsupported *pdu.UnsupportedEncodingError
+	if errors.As(err, &unsupported) {
+		return parseFailureUnsupported
+	}
+	return parseFailureMalformed
+}
+
+// anonymizePDU masks the digits of the SMSC and sender addresses of an
+// SMS-DELIVER PDU with 0 (an alphanumeric sender with zero octets), keeping
+// every length, so the sample still fails the same way. Input that is not
+// hex is not kept at all.
+func anonymizePDU(pduHex string) string {
+	b, err := hex.DecodeString(pduHex)
+	if err != nil {
+		return ""
+	}
+	at := func(i int) int {
+		if i < len(b) {
+			return int(b[i])
+		}
+		return 0
+	}
+	// mask zeroes the digits of n address octets from i; F fillers stay.
+	mask := func(i, n int, alphanumeric bool) {
+		for ; n > 0 && i < len(b); i, n = i+1, n-1 {
+			switch {
+			case alphanumeric:
+				b[i] = 0
+			case b[i]&0xF0 == 0xF0:
+				b[i] = 0xF0
+			default:
+				b[i] = 0
+			}
+		}
+	}
+
+	smscLen := at(0)
+	mask(2, smscLen-1, false)
+	i := 1 + smscLen
+	digits, addrType := at(i+1), at(i+2)
+	mask(i+3, (digits+1)/2, addrType&0x70 == 0x50)
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+// PDUSampleFile appends anonymized undecodable PDUs to PDU_SAMPLE_FILE, in
+// the replay corpus format (quarantine.go).
+type PDUSampleFile struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewPDUSampleFile(path string) *PDUSampleFile {
+	return &PDUSampleFile{path: path}
+}
+
+// Add appends the sample of one undecodable SMS.
+func (f *PDUSampleFile) Add(pending PendingSMS) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n# %s: %s\n", pending.RawKind, strings.ReplaceAll(pending.RawReason, "\n", " "))
+	for _, raw := range pending.RawPDUs {
+		if sample := anonymizePDU(raw); sample != "" {
+			sb.WriteString(sample + "\n")
+		} else {
+			fmt.Fprintf(&sb, "# <%d chars, not hex>\n", len(raw))
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening PDU_SAMPLE_FILE: %w", err)
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err == nil && info.Size() == 0 {
+		header := "# sms-to-telegram PDU parse failures; sender and SMSC digits masked, message text kept\n"
+		if _, err := file.WriteString(header); err != nil {
+			return fmt.Errorf("writing PDU_SAMPLE_FILE: %w", err)
+		}
+	}
+	if _, err := file.WriteString(sb.String()); err != nil {
+		return fmt.Errorf("writing PDU_SAMPLE_FILE: %w", err)
+	}
+	return nil
+}
+
+// recordParseFailure counts a finished undecodable SMS and captures its
+// sample. It runs once per SMS, when its slots are freed, not on every poll
+// that sees it. Sample failures are logged only.
+func (d *Deliverer) recordParseFailure(pending PendingSMS) {
+	if !pending.RawFallback {
+		return
+	}
+	d.notifier.metrics.PDUParseFailed(pending.RawKind)
+	if d.samples == nil || d.cfg.DryRun {
+		return
+	}
+	if err := d.samples.Add(pending); err != nil {
+		slog.Warn("Failed to capture PDU sample", "error", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
+)
+
+func TestAnonymizePDU(t *testing.T) {
+	tests := []struct {
+		name, pdu, sender, text string
+	}{
+		{"international", testPDUSingle, "+000000000000", "Тест1"},
+		{"alphanumeric", pduAlphaSender, "@@@@@@", "Hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sample := anonymizePDU(tt.pdu)
+			if len(sample) != len(tt.pdu) {
+				t.Fatalf("anonymizePDU() = %s, length changed", sample)
+			}
+			msg, err := pdu.Parse(sample)
+			if err != nil {
+				t.Fatalf("anonymized PDU no longer parses: %v", err)
+			}
+			if msg.Sender != tt.sender || strings.Trim(msg.SMSC, "+0") != "" || msg.Text != tt.text {
+				t.Errorf("anonymized PDU: sender %q, SMSC %q, text %q", msg.Sender, msg.SMSC, msg.Text)
+			}
+		})
+	}
+	if got := anonymizePDU("0791534874894370ZZ"); got != "" {
+		t.Errorf("anonymizePDU(not hex) = %q, want nothing", got)
+	}
+	// Truncated input is masked as far as it goes.
+	if got := anonymizePDU("07915348748943700009915348"); got != "07910000000000000009910000" {
+		t.Errorf("anonymizePDU(truncated) = %s", got)
+	}
+}
+
+// Each undecodable SMS counts once by kind when it is finished, and its
+// anonymized sample is appended to PDU_SAMPLE_FILE.
+func TestProcessMessages_ParseFailureTelemetry(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	malformed := "000401AA110000FF22"
+	compressed := strings.Replace(testPDUSingle, "0008522111", "0028522111", 1)
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing(
+		[2]string{"+CMGL: 6,1,,8", malformed},
+		[2]string{"+CMGL: 7,1,,29", compressed},
+	), nil)
+	cfg := testConfig()
+	cfg.ChatIDs = []int64{100}
+	deliverer, _, _ := newTestDeliverer(cfg)
+	deliverer.notifier.metrics = NewMetrics()
+	path := filepath.Join(t.TempDir(), "samples.txt")
+	deliverer.samples = NewPDUSampleFile(path)
+
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+		t.Fatalf("processMessages() error = %v", err)
+	}
+	body := scrapeMetrics(t, deliverer.notifier.metrics)
+	for _, want := range []string{
+		`sms_to_telegram_pdu_parse_failures_total{kind="malformed"} 1` + "\n",
+		`sms_to_telegram_pdu_parse_failures_total{kind="unsupported_encoding"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "534894847087") || !strings.Contains(string(data), "# unsupported_encoding: unsupported encoding: compressed text") {
+		t.Errorf("sample file:\n%s", data)
+	}
+	pdus, err := readPDUCorpus(path)
+	if err != nil || len(pdus) != 2 || pdus[0].raw != "000401AA000000FF22" {
+		t.Errorf("replay reads %+v, %v; want both samples, sender masked", pdus, err)
+	}
+}
@@ -0,0 +1,499 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+// SIM PIN management (/pin_status, /pin_enable, /pin_disable, /pin_change):
+// AT+CLCK="SC" switches the PIN check of the SIM on and off and AT+CPWD="SC"
+// changes the PIN. Three wrong PINs block the SIM until its PUK is entered,
+// which needs a phone: a command is refused when the SIM has fewer than
+// minPINAttempts attempts left. PINs are never put into replies, errors or
+// log entries.
+//
+// SIM_PIN (or SIM_PIN_FILE, or Vault) unlocks a SIM that asks for its PIN at
+// session start; see unlockSIM.
+
+// minPINAttempts is the attempt count a PIN command needs: one wrong PIN
+// must not block the SIM.
+const minPINAttempts = 2
+
+// pinEntryTimeout bounds AT+CPIN: the SIM checks the PIN before answering.
+const pinEntryTimeout = 10 * time.Second
+
+// pinReadyChecks is how often AT+CPIN? is asked, pinReadyInterval apart,
+// for the SIM to finish initializing after the PIN was entered.
+const (
+	pinReadyChecks   = 5
+	pinReadyInterval = 2 * time.Second
+)
+
+// pinCommandTimeout bounds an admin command's wait for the modem goroutine.
+const pinCommandTimeout = 2 * time.Minute
+
+// pinAttemptCommands query the remaining PIN attempts; there is no 3GPP
+// command, so the vendor ones are tried in turn: Quectel, SIMCom, u-blox.
+var pinAttemptCommands = []string{`AT+QPINC="SC"`, "AT+SPIC", "AT+UPINCNT"}
+
+var (
+	errPINStopped = errors.New("modem did not take the PIN request in time")
+	errPINFormat  = errors.New("a PIN has 4 to 8 digits")
+)
+
+// PINStatus is the PIN state of the SIM.
+type PINStatus struct {
+	Enabled bool
+	// Attempts left before the SIM is blocked; -1 if the modem does not
+	// tell.
+	Attempts int
+}
+
+func validPIN(s string) bool {
+	if len(s) < 4 || len(s) > 8 {
+		return false
+	}
+	return strings.Trim(s, "0123456789") == ""
+}
+
+// simPIN holds the SIM_PIN secret. It only exists as bytes: the AT+CPIN
+// command is built in a buffer that is zeroed after the write, and the PIN
+// itself is zeroed when the SIM refuses it and at shutdown. It is kept in
+// between because every modem restart asks for it again. Printed or logged
+// it shows as "[redacted]". Nil-safe: a nil PIN is never entered.
+type simPIN struct {
+	b []byte
+}
+
+func newSIMPIN(pin string) *simPIN {
+	if pin == "" {
+		return nil
+	}
+	return &simPIN{b: []byte(pin)}
+}
+
+// set reports whether there is a PIN to enter.
+func (p *simPIN) set() bool {
+	return p != nil && len(p.b) > 0
+}
+
+// wipe zeroes the PIN; it is not entered again.
+func (p *simPIN) wipe() {
+	if p != nil {
+		clear(p.b)
+		p.b = nil
+	}
+}
+
+func (p *simPIN) String() string { return "[redacted]" }
+
+func (p *simPIN) LogValue() slog.Value { return slog.StringValue("[redacted]") }
+
+// command builds AT+CPIN="<pin>"; the caller zeroes it after use.
+func (p *simPIN) command() []byte {
+	cmd := make([]byte, 0, len(`AT+CPIN=""`)+len(p.b))
+	cmd = append(cmd, `AT+CPIN="`...)
+	cmd = append(cmd, p.b...)
+	return append(cmd, '"')
+}
+
+// pinModem is the modem surface of unlockSIM.
+type pinModem interface {
+	ATCommander
+	SecretCommander
+}
+
+// unlockSIM enters SIM_PIN when the SIM asks for it. It runs before the
+// session init, whose SMS commands fail on a locked SIM, and turns the echo
+// off first so the modem does not repeat the PIN. A PIN the SIM refuses is
+// wiped and never entered again: the next wrong one could block the SIM.
+// A SIM still locked afterwards is reported by runModemDiagnostics; only
+// SIM PIN errors and transport errors are returned here.
+func unlockSIM(ctx context.Context, modem pinModem, pin *simPIN) error {
+	if !pin.set() {
+		return nil
+	}
+	if _, err := modem.Command("ATE0"); at.IsTimeoutError(err) {
+		return NewSessionError(err)
+	}
+	resp, err := modem.Command("AT+CPIN?")
+	if at.IsTimeoutError(err) {
+		return NewSessionError(err)
+	}
+	if status, ok := parseCPIN(resp); err != nil || !ok || status != "SIM PIN" {
+		return nil
+	}
+	if err := checkPINAttempts(modem); err != nil {
+		if at.IsTimeoutError(err) {
+			return NewSessionError(err)
+		}
+		return NewDiagnosticError(ErrTypeSimPinRequired, "SIM_PIN not entered: %v", err)
+	}
+
+	cmd := pin.command()
+	_, err = modem.CommandSecret(cmd, pinEntryTimeout)
+	clear(cmd)
+	if at.IsTimeoutError(err) {
+		return NewSessionError(err)
+	}
+	if err != nil {
+		pin.wipe()
+		failure := pinFailure(modem, err)
+		slog.Error("SIM refused SIM_PIN, it is not entered again until restart", "error", failure)
+		return NewDiagnosticError(ErrTypeSimPinRequired, "SIM refused SIM_PIN: %v", failure)
+	}
+	slog.Info("SIM PIN entered")
+
+	// The SMS commands of the session init fail while the SIM initializes.
+	for range pinReadyChecks {
+		if !sleepCtx(ctx, pinReadyInterval) {
+			return ctx.Err()
+		}
+		resp, err := modem.Command("AT+CPIN?")
+		if at.IsTimeoutError(err) {
+			return NewSessionError(err)
+		}
+		if status, ok := parseCPIN(resp); err == nil && ok && status == "READY" {
+			return nil
+		}
+	}
+	return nil
+}
+
+// queryPINStatus reads the PIN check state (AT+CLCK="SC",2) and the
+// remaining attempts.
+func queryPINStatus(modem ATCommander) (PINStatus, error) {
+	resp, err := modem.Command(`AT+CLCK="SC",2`)
+	if err != nil {
+		return PINStatus{}, err
+	}
+	st := PINStatus{Attempts: -1}
+	for _, line := range resp {
+		if rest, ok := strings.CutPrefix(line, "+CLCK:"); ok {
+			st.Enabled = strings.TrimSpace(rest) == "1"
+		}
+	}
+	st.Attempts, err = pinAttempts(modem)
+	return st, err
+}
+
+// pinAttempts returns the remaining PIN attempts, -1 if no vendor command
+// answers. Only a transport error is returned.
+func pinAttempts(modem ATCommander) (int, error) {
+	for _, cmd := range pinAttemptCommands {
+		resp, err := modem.Command(cmd)
+		if at.IsTimeoutError(err) {
+			return -1, err
+		}
+		if err != nil {
+			continue
+		}
+		if n, ok := parsePINAttempts(resp); ok {
+			return n, nil
+		}
+	}
+	return -1, nil
+}
+
+// parsePINAttempts extracts the PIN1 count of `+QPINC: "SC",<pin>,<puk>`,
+// `+SPIC: <pin1>,...` or `+UPINCNT: <pin1>,...`.
+func parsePINAttempts(lines []string) (int, bool) {
+	for _, line := range lines {
+		prefix, rest, ok := strings.Cut(line, ":")
+		if !ok || (prefix != "+QPINC" && prefix != "+SPIC" && prefix != "+UPINCNT") {
+			continue
+		}
+		fields := strings.Split(rest, ",")
+		if prefix == "+QPINC" {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			return 0, false
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		return n, err == nil && n >= 0 && n <= 10
+	}
+	return 0, false
+}
+
+// checkPINAttempts refuses a PIN command that could block the SIM.
+func checkPINAttempts(modem ATCommander) error {
+	n, err := pinAttempts(modem)
+	if err != nil {
+		return err
+	}
+	return attemptsLeft(n)
+}
+
+// attemptsLeft refuses n remaining attempts (-1: unknown) when a wrong PIN
+// would block the SIM.
+func attemptsLeft(n int) error {
+	if n >= 0 && n < minPINAttempts {
+		return fmt.Errorf("only %d PIN attempt(s) left: a wrong PIN would block the SIM, enter it in a phone instead", n)
+	}
+	return nil
+}
+
+// pinFailure explains a refused PIN command with the attempts left.
+func pinFailure(modem ATCommander, cmdErr error) error {
+	if at.IsTimeoutError(cmdErr) {
+		return cmdErr
+	}
+	n, err := pinAttempts(modem)
+	if err != nil {
+		return err
+	}
+	if n >= 0 {
+		return fmt.Errorf("SIM refused the PIN (%v), %d attempt(s) left", cmdErr, n)
+	}
+	return fmt.Errorf("SIM refused the PIN: %v", cmdErr)
+}
+
+// setPINLock switches the PIN check on or off. Like the SIM_PIN entry, the
+// command is sent as a secret from a buffer zeroed afterwards.
+func setPINLock(modem pinModem, enable bool, pin string) error {
+	if !validPIN(pin) {
+		return errPINFormat
+	}
+	if err := checkPINAttempts(modem); err != nil {
+		return err
+	}
+	mode := byte('0')
+	if enable {
+		mode = '1'
+	}
+	cmd := make([]byte, 0, len(`AT+CLCK="SC",0,""`)+len(pin))
+	cmd = append(cmd, `AT+CLCK="SC",`...)
+	cmd = append(cmd, mode, ',', '"')
+	cmd = append(cmd, pin...)
+	cmd = append(cmd, '"')
+	_, err := modem.CommandSecret(cmd, pinEntryTimeout)
+	clear(cmd)
+	if err != nil {
+		return pinFailure(modem, err)
+	}
+	return nil
+}
+
+// changePIN changes the PIN; the SIM only takes it with the PIN check on.
+// The command is sent like setPINLock's.
+func changePIN(modem pinModem, oldPIN, newPIN string) error {
+	if !validPIN(oldPIN) || !validPIN(newPIN) {
+		return errPINFormat
+	}
+	st, err := queryPINStatus(modem)
+	if err != nil {
+		return err
+	}
+	if !st.Enabled {
+		return errors.New("the PIN check is off: enable it first with /pin_enable")
+	}
+	if err := attemptsLeft(st.Attempts); err != nil {
+		return err
+	}
+	cmd := make([]byte, 0, len(`AT+CPWD="SC","",""`)+len(oldPIN)+len(newPIN))
+	cmd = append(cmd, `AT+CPWD="SC","`...)
+	cmd = append(cmd, oldPIN...)
+	cmd = append(cmd, `","`...)
+	cmd = append(cmd, newPIN...)
+	cmd = append(cmd, '"')
+	_, err = modem.CommandSecret(cmd, pinEntryTimeout)
+	clear(cmd)
+	if err != nil {
+		return pinFailure(modem, err)
+	}
+	return nil
+}
+
+// PIN operations of a pinRequest.
+const (
+	pinOpStatus  = "status"
+	pinOpEnable  = "enable"
+	pinOpDisable = "disable"
+	pinOpChange  = "change"
+)
+
+// PINManager hands the PIN requests of the admin commands to the modem
+// goroutine, like the ESIMManager.
+type PINManager struct {
+	requests chan pinRequest
+}
+
+type pinRequest struct {
+	ctx    context.Context
+	op     string
+	pin    string
+	newPIN string
+	result chan pinResult
+}
+
+type pinResult struct {
+	status PINStatus
+	err    error
+}
+
+func NewPINManager() *PINManager {
+	return &PINManager{requests: make(chan pinRequest, 1)}
+}
+
+// Status returns the PIN state of the SIM.
+func (m *PINManager) Status(ctx context.Context) (PINStatus, error) {
+	r := m.do(ctx, pinRequest{ctx: ctx, op: pinOpStatus})
+	return r.status, r.err
+}
+
+// SetLock switches the PIN check on or off.
+func (m *PINManager) SetLock(ctx context.Context, enable bool, pin string) error {
+	op := pinOpDisable
+	if enable {
+		op = pinOpEnable
+	}
+	return m.do(ctx, pinRequest{ctx: ctx, op: op, pin: pin}).err
+}
+
+// Change changes the PIN.
+func (m *PINManager) Change(ctx context.Context, oldPIN, newPIN string) error {
+	return m.do(ctx, pinRequest{ctx: ctx, op: pinOpChange, pin: oldPIN, newPIN: newPIN}).err
+}
+
+func (m *PINManager) do(ctx context.Context, req pinRequest) pinResult {
+	if req.op != pinOpStatus && (!validPIN(req.pin) || req.op == pinOpChange && !validPIN(req.newPIN)) {
+		return pinResult{err: errPINFormat}
+	}
+	req.result = make(chan pinResult, 1)
+	select {
+	case m.requests <- req:
+	case <-ctx.Done():
+		return pinResult{err: errPINStopped}
+	}
+	select {
+	case r := <-req.result:
+		return r
+	case <-ctx.Done():
+		return pinResult{err: errPINStopped}
+	}
+}
+
+// pending returns the request channel for the modem loop's select; nil
+// (never ready) for a nil manager.
+func (m *PINManager) pending() <-chan pinRequest {
+	if m == nil {
+		return nil
+	}
+	return m.requests
+}
+
+// serve runs on the modem goroutine. A transport error is returned so the
+// caller can end the session.
+func (m *PINManager) serve(modem pinModem, req pinRequest) error {
+	if req.ctx.Err() != nil {
+		return nil
+	}
+	var r pinResult
+	switch req.op {
+	case pinOpStatus:
+		r.status, r.err = queryPINStatus(modem)
+	case pinOpEnable, pinOpDisable:
+		r.err = setPINLock(modem, req.op == pinOpEnable, req.pin)
+	case pinOpChange:
+		r.err = changePIN(modem, req.pin, req.newPIN)
+	}
+	req.result <- r
+	if r.err != nil {
+		slog.Warn("SIM PIN request failed", "op", req.op, "error", r.err)
+		if at.IsTimeoutError(r.err) {
+			return r.err
+		}
+	} else if req.op != pinOpStatus {
+		slog.Info("SIM PIN request done", "op", req.op)
+	}
+	return nil
+}
+
+// registerPINCommands wires /pin_status, /pin_enable, /pin_disable and
+// /pin_change.
+func registerPINCommands(r *CommandRouter, pins *PINManager) {
+	withTimeout := func(ctx context.Context, fn func(ctx context.Context) string) string {
+		ctx, cancel := context.WithTimeout(ctx, pinCommandTimeout)
+		defer cancel()
+		return fn(ctx)
+	}
+	r.Register("pin_status", botCommand{
+		usage:       "/pin_status",
+		description: "Show the SIM PIN check and the attempts left",
+		handle: func(ctx context.Context, _ commandRequest) string {
+			return withTimeout(ctx, func(ctx context.Context) string {
+				st, err := pins.Status(ctx)
+				if err != nil {
+					return "Cannot read the PIN state: " + escapeHTML(err.Error())
+				}
+				return formatPINStatus(st)
+			})
+		},
+	})
+	for _, enable := range []bool{true, false} {
+		name, verb, done := "pin_disable", "Disable", "off"
+		if enable {
+			name, verb, done = "pin_enable", "Enable", "on"
+		}
+		r.Register(name, botCommand{
+			usage:       "/" + name + " <PIN>",
+			description: verb + " the SIM PIN check",
+			handle: func(ctx context.Context, req commandRequest) string {
+				if len(req.Args) != 1 {
+					return fmt.Sprintf("Usage: <code>/%s &lt;PIN&gt;</code>", name)
+				}
+				return withTimeout(ctx, func(ctx context.Context) string {
+					if err := pins.SetLock(ctx, enable, req.Args[0]); err != nil {
+						return "PIN check unchanged: " + escapeHTML(err.Error())
+					}
+					reply := "SIM PIN check is " + done + "."
+					if enable {
+						reply += " The SIM asks for the PIN after every modem restart."
+					}
+					return reply + pinMessageNote
+				})
+			},
+		})
+	}
+	r.Register("pin_change", botCommand{
+		usage:       "/pin_change <old PIN> <new PIN>",
+		description: "Change the SIM PIN",
+		handle: func(ctx context.Context, req commandRequest) string {
+			if len(req.Args) != 2 {
+				return "Usage: <code>/pin_change &lt;old PIN&gt; &lt;new PIN&gt;</code>"
+			}
+			return withTimeout(ctx, func(ctx context.Context) string {
+				if err := pins.Change(ctx, req.Args[0], req.Args[1]); err != nil {
+					return "PIN unchanged: " + escapeHTML(err.Error())
+				}
+				return "SIM PIN changed." + pinMessageNote
+			})
+		},
+	})
+}
+
+// pinMessageNote reminds the admin that the command stays in the chat.
+const pinMessageNote = "\n\n<i>Delete your command message: it contains the PIN.</i>"
+
+func formatPINStatus(st PINStatus) string {
+	state := "off"
+	if st.Enabled {
+		state = "on"
+	}
+	attempts := "unknown"
+	if st.Attempts >= 0 {
+		attempts = strconv.Itoa(st.Attempts)
+	}
+	return fmt.Sprintf("<b>SIM PIN</b>\n\nPIN check: %s\nAttempts left: %s", state, attempts)
+}
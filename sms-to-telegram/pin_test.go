@@ -0,0 +1,312 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+func TestParsePINAttempts(t *testing.T) {
+	for _, tt := range []struct {
+		lines  []string
+		want   int
+		wantOK bool
+	}{
+		{[]string{`+QPINC: "SC",3,10`}, 3, true},
+		{[]string{"+SPIC: 2,3,10,10"}, 2, true},
+		{[]string{"+UPINCNT: 1,3,10,10"}, 1, true},
+		{[]string{`+QPINC: "SC"`}, 0, false},
+		{[]string{"+SPIC: x"}, 0, false},
+		{[]string{"+CPIN: READY"}, 0, false},
+	} {
+		if got, ok := parsePINAttempts(tt.lines); got != tt.want || ok != tt.wantOK {
+			t.Errorf("parsePINAttempts(%q) = %d, %v; want %d, %v", tt.lines, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestSetPINLock(t *testing.T) {
+	const lockOn = `AT+CLCK="SC",1,"1234"`
+	tests := []struct {
+		name   string
+		pin    string
+		script func(f *fakeAT)
+		// wantErrIn is matched as a substring; "" for success.
+		wantErrIn string
+		wantSent  bool
+	}{
+		{
+			name:     "enabled",
+			pin:      "1234",
+			script:   func(f *fakeAT) { f.on(`AT+QPINC="SC"`, []string{`+QPINC: "SC",3,10`}, nil) },
+			wantSent: true,
+		},
+		{
+			name: "vendor command of another modem",
+			pin:  "1234",
+			script: func(f *fakeAT) {
+				f.on(`AT+QPINC="SC"`, nil, at.ErrModemError)
+				f.on("AT+SPIC", []string{"+SPIC: 3,3,10,10"}, nil)
+			},
+			wantSent: true,
+		},
+		{
+			name: "attempts unknown",
+			pin:  "1234",
+			script: func(f *fakeAT) {
+				for _, cmd := range pinAttemptCommands {
+					f.on(cmd, nil, at.ErrModemError)
+				}
+			},
+			wantSent: true,
+		},
+		{
+			name:      "one attempt left",
+			pin:       "1234",
+			script:    func(f *fakeAT) { f.on(`AT+QPINC="SC"`, []string{`+QPINC: "SC",1,10`}, nil) },
+			wantErrIn: "only 1 PIN attempt(s) left",
+		},
+		{
+			name: "wrong PIN",
+			pin:  "1234",
+			script: func(f *fakeAT) {
+				f.on(`AT+QPINC="SC"`, []string{`+QPINC: "SC",3,10`}, nil)
+				f.on(`AT+QPINC="SC"`, []string{`+QPINC: "SC",2,10`}, nil)
+				f.on(lockOn, nil, errors.Join(at.ErrModemError, errors.New("+CME ERROR: 16")))
+			},
+			wantErrIn: "2 attempt(s) left",
+			wantSent:  true,
+		},
+		{
+			name:      "not a PIN",
+			pin:       "12a4",
+			script:    func(f *fakeAT) {},
+			wantErrIn: "4 to 8 digits",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeAT()
+			tt.script(f)
+			err := setPINLock(f, true, tt.pin)
+			if tt.wantErrIn == "" && err != nil {
+				t.Fatalf("setPINLock() error = %v", err)
+			}
+			if tt.wantErrIn != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErrIn)) {
+				t.Fatalf("setPINLock() error = %v, want one containing %q", err, tt.wantErrIn)
+			}
+			if err != nil && strings.Contains(err.Error(), tt.pin) {
+				t.Errorf("error %q reveals the PIN", err)
+			}
+			if sent := f.commandCount(lockOn) == 1; sent != tt.wantSent {
+				t.Errorf("calls = %q, lock command sent %v, want %v", f.calls, sent, tt.wantSent)
+			}
+			if tt.wantSent && !slices.Contains(f.secrets, lockOn) {
+				t.Errorf("lock command not sent as a secret: %q", f.secrets)
+			}
+		})
+	}
+}
+
+func TestChangePIN(t *testing.T) {
+	const change = `AT+CPWD="SC","1234","5678"`
+	for _, tt := range []struct {
+		name      string
+		clck      string
+		attempts  string
+		wantErrIn string
+	}{
+		{"changed", "+CLCK: 1", `+QPINC: "SC",3,10`, ""},
+		{"PIN check off", "+CLCK: 0", `+QPINC: "SC",3,10`, "enable it first"},
+		{"one attempt left", "+CLCK: 1", `+QPINC: "SC",1,10`, "only 1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeAT()
+			f.on(`AT+CLCK="SC",2`, []string{tt.clck}, nil)
+			f.on(`AT+QPINC="SC"`, []string{tt.attempts}, nil)
+			err := changePIN(f, "1234", "5678")
+			if tt.wantErrIn == "" && err != nil {
+				t.Fatalf("changePIN() error = %v", err)
+			}
+			if tt.wantErrIn != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErrIn)) {
+				t.Fatalf("changePIN() error = %v, want one containing %q", err, tt.wantErrIn)
+			}
+			if sent := f.commandCount(change) == 1; sent != (tt.wantErrIn == "") {
+				t.Errorf("calls = %q, change sent %v", f.calls, sent)
+			}
+			if sent := slices.Contains(f.secrets, change); sent != (tt.wantErrIn == "") {
+				t.Errorf("secrets = %q, change sent as a secret %v", f.secrets, sent)
+			}
+		})
+	}
+}
+
+func TestPINManagerServe(t *testing.T) {
+	m := NewPINManager()
+	f := newFakeAT()
+	f.on(`AT+CLCK="SC",2`, []string{"+CLCK: 1"}, nil)
+	f.on(`AT+QPINC="SC"`, []string{`+QPINC: "SC",3,10`}, nil)
+
+	done := make(chan error, 1)
+	go func() { done <- m.serve(f, <-m.pending()) }()
+	st, err := m.Status(context.Background())
+	if err != nil || st != (PINStatus{Enabled: true, Attempts: 3}) {
+		t.Errorf("Status() = %+v, %v; want enabled with 3 attempts", st, err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("serve() = %v", err)
+	}
+	if got := formatPINStatus(st); !strings.Contains(got, "PIN check: on") || !strings.Contains(got, "Attempts left: 3") {
+		t.Errorf("formatPINStatus() = %q", got)
+	}
+
+	// A transport error ends the session.
+	f.on(`AT+CLCK="SC",0,"1234"`, nil, at.ErrModemTimeout)
+	go func() { done <- m.serve(f, <-m.pending()) }()
+	if err := m.SetLock(context.Background(), false, "1234"); !errors.Is(err, at.ErrModemTimeout) {
+		t.Errorf("SetLock() error = %v, want timeout", err)
+	}
+	if err := <-done; !errors.Is(err, at.ErrModemTimeout) {
+		t.Errorf("serve() = %v, want timeout", err)
+	}
+
+	// Malformed PINs never reach the modem goroutine.
+	if err := m.Change(context.Background(), "1234", "12"); !errors.Is(err, errPINFormat) {
+		t.Errorf("Change() error = %v, want errPINFormat", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Status(ctx); !errors.Is(err, errPINStopped) {
+		t.Errorf("Status(cancelled) error = %v, want errPINStopped", err)
+	}
+	var none *PINManager
+	if none.pending() != nil {
+		t.Error("nil manager has a request channel")
+	}
+}
+
+func TestUnlockSIM(t *testing.T) {
+	defer swapClock(newFakeClock())()
+	const enter = `AT+CPIN="1234"`
+	tests := []struct {
+		name   string
+		pin    string
+		script func(f *fakeAT)
+		// wantType is the diagnostic error type, -1 for none.
+		wantType    DiagnosticErrorType
+		wantSession bool
+		wantSent    bool
+		wantWiped   bool
+	}{
+		{
+			name:     "no PIN configured",
+			script:   func(f *fakeAT) { f.on("AT+CPIN?", []string{"+CPIN: SIM PIN"}, nil) },
+			wantType: -1,
+		},
+		{
+			name:     "SIM ready",
+			pin:      "1234",
+			script:   func(f *fakeAT) { f.on("AT+CPIN?", []string{"+CPIN: READY"}, nil) },
+			wantType: -1,
+		},
+		{
+			name: "entered",
+			pin:  "1234",
+			script: func(f *fakeAT) {
+				f.on("AT+CPIN?", []string{"+CPIN: SIM PIN"}, nil)
+				f.on("AT+CPIN?", []string{"+CPIN: NOT READY"}, nil)
+				f.on("AT+CPIN?", []string{"+CPIN: READY"}, nil)
+				f.on(`AT+QPINC="SC"`, []string{`+QPINC: "SC",3,10`}, nil)
+			},
+			wantType: -1,
+			wantSent: true,
+		},
+		{
+			name: "one attempt left",
+			pin:  "1234",
+			script: func(f *fakeAT) {
+				f.on("AT+CPIN?", []string{"+CPIN: SIM PIN"}, nil)
+				f.on(`AT+QPINC="SC"`, []string{`+QPINC: "SC",1,10`}, nil)
+			},
+			wantType: ErrTypeSimPinRequired,
+		},
+		{
+			name: "refused",
+			pin:  "1234",
+			script: func(f *fakeAT) {
+				f.on("AT+CPIN?", []string{"+CPIN: SIM PIN"}, nil)
+				f.on(`AT+QPINC="SC"`, []string{`+QPINC: "SC",3,10`}, nil)
+				f.on(`AT+QPINC="SC"`, []string{`+QPINC: "SC",2,10`}, nil)
+				f.on(enter, nil, errors.Join(at.ErrModemError, errors.New("+CME ERROR: 16")))
+			},
+			wantType:  ErrTypeSimPinRequired,
+			wantSent:  true,
+			wantWiped: true,
+		},
+		{
+			name: "timeout",
+			pin:  "1234",
+			script: func(f *fakeAT) {
+				f.on("AT+CPIN?", []string{"+CPIN: SIM PIN"}, nil)
+				f.on(`AT+QPINC="SC"`, []string{`+QPINC: "SC",3,10`}, nil)
+				f.on(enter, nil, at.ErrModemTimeout)
+			},
+			wantType:    -1,
+			wantSession: true,
+			wantSent:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeAT()
+			tt.script(f)
+			pin := newSIMPIN(tt.pin)
+			var held []byte
+			if pin != nil {
+				held = pin.b
+			}
+
+			err := unlockSIM(context.Background(), f, pin)
+			var diag *DiagnosticError
+			var session *SessionError
+			switch {
+			case tt.wantType >= 0:
+				if !errors.As(err, &diag) || diag.Type != tt.wantType {
+					t.Fatalf("unlockSIM() error = %v, want diagnostic type %v", err, tt.wantType)
+				}
+			case tt.wantSession:
+				if !errors.As(err, &session) {
+					t.Fatalf("unlockSIM() error = %v, want a session error", err)
+				}
+			case err != nil:
+				t.Fatalf("unlockSIM() error = %v", err)
+			}
+			if err != nil && strings.Contains(err.Error(), "1234") {
+				t.Errorf("error %q reveals the PIN", err)
+			}
+			if sent := f.commandCount(enter) == 1; sent != tt.wantSent {
+				t.Errorf("calls = %q, PIN entered %v, want %v", f.calls, sent, tt.wantSent)
+			}
+			if pin.set() == tt.wantWiped && tt.pin != "" {
+				t.Errorf("PIN set = %v after unlockSIM, want wiped %v", pin.set(), tt.wantWiped)
+			}
+			if tt.wantWiped && strings.Trim(string(held), "\x00") != "" {
+				t.Errorf("wiped PIN left %q in memory", held)
+			}
+
+			// A refused PIN is never entered again.
+			if tt.wantWiped {
+				if err := unlockSIM(context.Background(), f, pin); err != nil || f.commandCount(enter) != 1 {
+					t.Errorf("second unlockSIM() = %v, PIN entered %d times", err, f.commandCount(enter))
+				}
+			}
+		})
+	}
+}
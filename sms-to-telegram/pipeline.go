@@ -0,0 +1,99 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// The receive pipeline: the poll loop decodes and assembles SMS from the SIM
+// (source, decoders), Deliver runs each one through the middleware chain
+// (filters and transforms) and finally fans it out to the sinks, which
+// route it themselves. The returned deliveryStatus decides what happens to
+// the SIM slots: only deliveryDone, deliveryDropped and deliveryConsumed
+// free them, so a step that fails must defer, never drop.
+
+// SMSHandler processes one decoded SMS and reports what to do with its SIM
+// slots. Handlers run on the delivery goroutine (the modem goroutine without
+// a queue), one message at a time.
+type SMSHandler func(ctx context.Context, pending PendingSMS) deliveryStatus
+
+// Middleware is one pipeline step. It may pass the SMS on to next, changed
+// or not (redaction, templating), or stop the chain with its own status
+// (filters). A step that changes the SMS must do so deterministically:
+// an SMS that is deferred is processed again on the next poll.
+type Middleware func(next SMSHandler) SMSHandler
+
+// Use appends a pipeline step. Steps run in the order added, after the
+// built-in ones (duplicate check, undecodable-PDU report and quarantine,
+// self-test, blocklist, transaction templates, RULES_FILE, translation,
+// transliteration) and before the sinks.
+func (d *Deliverer) Use(m Middleware) {
+	d.middleware = append(d.middleware, m)
+}
+
+// builtinMiddleware are the steps every Deliverer has; each is inert while
+// its subsystem is nil.
+func (d *Deliverer) builtinMiddleware() []Middleware {
+	return []Middleware{d.skipDelivered, d.reportUndecodable, d.quarantineUndecodable, d.consumeSelfTest, d.dropBlocked, d.parseTransaction, d.applyRules, d.translate, d.transliterate}
+}
+
+// skipDelivered takes SMS that were already forwarded out of the pipeline,
+// so their slots are freed without a second delivery, or with
+// DELETE_POLICY=never are left alone.
+func (d *Deliverer) skipDelivered(next SMSHandler) SMSHandler {
+	return func(ctx context.Context, pending PendingSMS) deliveryStatus {
+		hash := pduHash(pending)
+		if d.cfg.DeletePolicy == deletePolicyNever {
+			if _, kept := d.kept[messageKey(pending)]; kept || d.delivered.Seen(hash) {
+				d.delivered.Keep(hash)
+				return deliveryKept
+			}
+		}
+		if !d.delivered.Seen(hash) {
+			return next(ctx, pending)
+		}
+		slog.WarnContext(ctx, "SMS was already forwarded, deleting the duplicate",
+			"from", pending.Message.From,
+			"indices", pending.PartIndices,
+			"text_fingerprint", contentFingerprint(pending.Message.Text),
+		)
+		return deliveryConsumed
+	}
+}
+
+// reportUndecodable reports SMS forwarded as raw hex to Sentry.
+func (d *Deliverer) reportUndecodable(next SMSHandler) SMSHandler {
+	return func(ctx context.Context, pending PendingSMS) deliveryStatus {
+		d.notifier.sentry.ReportUndecodablePDU(ctx, pending)
+		return next(ctx, pending)
+	}
+}
+
+// consumeSelfTest takes loopback self-test SMS out of the pipeline.
+func (d *Deliverer) consumeSelfTest(next SMSHandler) SMSHandler {
+	return func(ctx context.Context, pending PendingSMS) deliveryStatus {
+		if d.selfTest.Received(pending) {
+			return deliveryConsumed
+		}
+		return next(ctx, pending)
+	}
+}
+
+// dropBlocked drops SMS from blocklisted senders.
+func (d *Deliverer) dropBlocked(next SMSHandler) SMSHandler {
+	return func(ctx context.Context, pending PendingSMS) deliveryStatus {
+		if !d.blocklist.Blocked(pending.Message.From) {
+			return next(ctx, pending)
+		}
+		slog.InfoContext(ctx, "Dropping SMS from blocked sender",
+			"from", pending.Message.From,
+			"indices", pending.PartIndices,
+			"text_fingerprint", contentFingerprint(pending.Message.Text),
+		)
+		d.finish(messageKey(pending), pending, archiveBlocked, "")
+		return deliveryDropped
+	}
+}
@@ -7,20 +7,38 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-telegram/bot"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
 )
 
 // Real captured single-part UCS2 PDU decoding to "Тест1" (37 bytes → TPDU 29).
 const testPDUSingle = "0791534874894370000C915348948470870008522111218305800A04220435044104420031"
 
+// Hand-built PDUs shared with pkg/pdu's tests.
+const (
+	// Alphanumeric sender "Google", GSM7 body "Hello".
+	pduAlphaSender = "07915348748943700" + "40BD0C7F7FBCC2E03" + "0000" + "52211121830580" + "05" + "C8329BFD06"
+	// GSM7 multipart (8-bit ref 42, 2 parts): "Hello" + "World".
+	pduGSM7Part1 = "0791534874894370" + "44" + "0C91534894847087" + "0000" + "52211121830580" + "0C" + "0500032A0201" + "906536FB0D"
+	pduGSM7Part2 = "0791534874894370" + "44" + "0C91534894847087" + "0000" + "52211131830580" + "0C" + "0500032A0202" + "AE6F399B0C"
+	// Status report: MTI=2 in the first TPDU octet, no SMSC.
+	pduStatusReport = "0006AA0B9153489484708700005211112183058052111121830580"
+)
+
 func testConfig() *Config {
 	return &Config{
 		ChatIDs:             []int64{100, 200},
 		TelegramSendTimeout: time.Second,
+		TelegramRetries:     2,
+		TelegramRetryDelay:  5 * time.Second,
 	}
 }
 
@@ -45,12 +63,12 @@ func cmglListing(entries ...[2]string) []string {
 // chats and its SIM slot is deleted afterwards.
 func TestProcessMessages_SuccessDeletes(t *testing.T) {
 	t.Cleanup(swapClock(newFakeClock()))
-	at := newFakeAT()
-	at.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 5,1,,29", testPDUSingle}), nil)
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 5,1,,29", testPDUSingle}), nil)
 	cfg := testConfig()
 	deliverer, sender, _ := newTestDeliverer(cfg)
 
-	if err := processMessages(context.Background(), at, deliverer, cfg, 30); err != nil {
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
 		t.Fatalf("processMessages() error = %v", err)
 	}
 
@@ -60,7 +78,7 @@ func TestProcessMessages_SuccessDeletes(t *testing.T) {
 	if got := len(sender.sentTo(200)); got != 1 {
 		t.Errorf("chat 200 received %d messages, want 1", got)
 	}
-	if n := at.commandCount("AT+CMGD=5"); n != 1 {
+	if n := modem.commandCount("AT+CMGD=5"); n != 1 {
 		t.Errorf("AT+CMGD=5 called %d times, want 1", n)
 	}
 }
@@ -69,18 +87,18 @@ func TestProcessMessages_SuccessDeletes(t *testing.T) {
 // if delivery fails, the SIM slot must NOT be deleted; the poll cycle retries.
 func TestProcessMessages_TransientFailureRetains(t *testing.T) {
 	t.Cleanup(swapClock(newFakeClock()))
-	at := newFakeAT()
-	at.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 5,1,,29", testPDUSingle}), nil)
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 5,1,,29", testPDUSingle}), nil)
 	cfg := testConfig()
 	deliverer, sender, _ := newTestDeliverer(cfg)
 	sender.script = func(_ int, _ int64, _ string) error {
 		return errors.New("network down")
 	}
 
-	if err := processMessages(context.Background(), at, deliverer, cfg, 30); err != nil {
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
 		t.Fatalf("processMessages() error = %v (deferred delivery is not a loop error)", err)
 	}
-	if n := at.commandCount("AT+CMGD=5"); n != 0 {
+	if n := modem.commandCount("AT+CMGD=5"); n != 0 {
 		t.Errorf("AT+CMGD=5 called %d times after failed delivery, want 0", n)
 	}
 }
@@ -88,19 +106,19 @@ func TestProcessMessages_TransientFailureRetains(t *testing.T) {
 // TestProcessMessages_DryRun: DRY_RUN must neither send nor delete.
 func TestProcessMessages_DryRun(t *testing.T) {
 	t.Cleanup(swapClock(newFakeClock()))
-	at := newFakeAT()
-	at.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 5,1,,29", testPDUSingle}), nil)
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 5,1,,29", testPDUSingle}), nil)
 	cfg := testConfig()
 	cfg.DryRun = true
 	deliverer, sender, _ := newTestDeliverer(cfg)
 
-	if err := processMessages(context.Background(), at, deliverer, cfg, 30); err != nil {
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
 		t.Fatalf("processMessages() error = %v", err)
 	}
 	if len(sender.sent) != 0 {
 		t.Errorf("DRY_RUN sent %d messages", len(sender.sent))
 	}
-	for _, call := range at.calls {
+	for _, call := range modem.calls {
 		if strings.HasPrefix(call, "AT+CMGD=") {
 			t.Errorf("DRY_RUN issued deletion command %q", call)
 		}
@@ -111,16 +129,17 @@ func TestProcessMessages_DryRun(t *testing.T) {
 // message is retained and alerted once, while other messages still flow.
 func TestProcessMessages_MidBatchRejectionContinues(t *testing.T) {
 	t.Cleanup(swapClock(newFakeClock()))
-	at := newFakeAT()
+	modem := newFakeAT()
 	listing := cmglListing(
 		[2]string{"+CMGL: 1,1,,29", testPDUSingle},
 		[2]string{"+CMGL: 2,1,,24", pduAlphaSender},
 	)
-	at.on("AT+CMGL=4", listing, nil)
-	at.on("AT+CMGL=4", listing, nil) // second poll sees the retained message
+	modem.on("AT+CMGL=4", listing, nil)
+	modem.on("AT+CMGL=4", listing, nil) // second poll sees the retained message
 	cfg := testConfig()
 	cfg.ChatIDs = []int64{100}
 	deliverer, sender, alertSender := newTestDeliverer(cfg)
+	deliverer.notifier.metrics = NewMetrics()
 	// Reject everything containing "Тест1" (message at index 1), including
 	// its plain-text fallback; deliver the rest.
 	sender.script = func(_ int, _ int64, text string) error {
@@ -130,24 +149,27 @@ func TestProcessMessages_MidBatchRejectionContinues(t *testing.T) {
 		return nil
 	}
 
-	if err := processMessages(context.Background(), at, deliverer, cfg, 30); err != nil {
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
 		t.Fatalf("processMessages() error = %v", err)
 	}
 
-	if n := at.commandCount("AT+CMGD=1"); n != 0 {
+	if n := modem.commandCount("AT+CMGD=1"); n != 0 {
 		t.Error("rejected message must not be deleted")
 	}
-	if n := at.commandCount("AT+CMGD=2"); n != 1 {
+	if n := modem.commandCount("AT+CMGD=2"); n != 1 {
 		t.Errorf("later message deleted %d times, want 1 (rejection must not block it)", n)
 	}
 	if len(alertSender.sent) != 1 {
 		t.Errorf("rejection alerts = %d, want exactly 1", len(alertSender.sent))
 	}
+	if waiting := deliverer.notifier.metrics.snapshot().smsWaiting; waiting != 1 {
+		t.Errorf("SMS waiting on SIM = %d, want 1 (the rejected one)", waiting)
+	}
 
 	// Second poll: the rejected message is skipped silently (no resend, no
 	// duplicate alert), the already-forwarded one is gone from the SIM.
 	sentBefore := len(sender.sent)
-	if err := processMessages(context.Background(), at, deliverer, cfg, 30); err != nil {
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
 		t.Fatalf("second poll error = %v", err)
 	}
 	rejectedResends := 0
@@ -168,8 +190,8 @@ func TestProcessMessages_MidBatchRejectionContinues(t *testing.T) {
 // whole rest of the batch (it would fail too); nothing is deleted.
 func TestProcessMessages_TransientStopsBatch(t *testing.T) {
 	t.Cleanup(swapClock(newFakeClock()))
-	at := newFakeAT()
-	at.on("AT+CMGL=4", cmglListing(
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing(
 		[2]string{"+CMGL: 1,1,,29", testPDUSingle},
 		[2]string{"+CMGL: 2,1,,24", pduAlphaSender},
 	), nil)
@@ -180,10 +202,10 @@ func TestProcessMessages_TransientStopsBatch(t *testing.T) {
 		return errors.New("network down")
 	}
 
-	if err := processMessages(context.Background(), at, deliverer, cfg, 30); err != nil {
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
 		t.Fatalf("processMessages() error = %v", err)
 	}
-	for _, call := range at.calls {
+	for _, call := range modem.calls {
 		if strings.HasPrefix(call, "AT+CMGD=") {
 			t.Errorf("deletion %q issued despite transient failure", call)
 		}
@@ -201,11 +223,11 @@ func TestProcessMessages_TransientStopsBatch(t *testing.T) {
 func TestProcessMessages_RateLimitCooldown(t *testing.T) {
 	fc := newFakeClock()
 	t.Cleanup(swapClock(fc))
-	at := newFakeAT()
+	modem := newFakeAT()
 	listing := cmglListing([2]string{"+CMGL: 5,1,,29", testPDUSingle})
-	at.on("AT+CMGL=4", listing, nil)
-	at.on("AT+CMGL=4", listing, nil)
-	at.on("AT+CMGL=4", listing, nil)
+	modem.on("AT+CMGL=4", listing, nil)
+	modem.on("AT+CMGL=4", listing, nil)
+	modem.on("AT+CMGL=4", listing, nil)
 	cfg := testConfig()
 	cfg.ChatIDs = []int64{100}
 	deliverer, sender, _ := newTestDeliverer(cfg)
@@ -219,16 +241,16 @@ func TestProcessMessages_RateLimitCooldown(t *testing.T) {
 	}
 
 	// First poll: hit the rate limit → retained.
-	if err := processMessages(context.Background(), at, deliverer, cfg, 30); err != nil {
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
 		t.Fatalf("poll 1 error = %v", err)
 	}
-	if at.commandCount("AT+CMGD=5") != 0 {
+	if modem.commandCount("AT+CMGD=5") != 0 {
 		t.Fatal("deleted while rate-limited")
 	}
 
 	// Second poll while still cooling down: no send attempt at all.
 	sentBefore := len(sender.sent)
-	if err := processMessages(context.Background(), at, deliverer, cfg, 30); err != nil {
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
 		t.Fatalf("poll 2 error = %v", err)
 	}
 	if len(sender.sent) != sentBefore {
@@ -237,10 +259,10 @@ func TestProcessMessages_RateLimitCooldown(t *testing.T) {
 
 	// After the cooldown expires the message goes through and is deleted.
 	fc.Advance(31 * time.Second)
-	if err := processMessages(context.Background(), at, deliverer, cfg, 30); err != nil {
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
 		t.Fatalf("poll 3 error = %v", err)
 	}
-	if at.commandCount("AT+CMGD=5") != 1 {
+	if modem.commandCount("AT+CMGD=5") != 1 {
 		t.Error("message not delivered/deleted after cooldown expired")
 	}
 }
@@ -249,18 +271,18 @@ func TestProcessMessages_RateLimitCooldown(t *testing.T) {
 // are deleted without forwarding.
 func TestProcessMessages_StatusReportDeletedSilently(t *testing.T) {
 	t.Cleanup(swapClock(newFakeClock()))
-	at := newFakeAT()
-	at.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 9,1,,26", pduStatusReport}), nil)
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 9,1,,26", pduStatusReport}), nil)
 	cfg := testConfig()
 	deliverer, sender, _ := newTestDeliverer(cfg)
 
-	if err := processMessages(context.Background(), at, deliverer, cfg, 30); err != nil {
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
 		t.Fatalf("processMessages() error = %v", err)
 	}
 	if len(sender.sent) != 0 {
 		t.Errorf("status report was forwarded (%d sends)", len(sender.sent))
 	}
-	if at.commandCount("AT+CMGD=9") != 1 {
+	if modem.commandCount("AT+CMGD=9") != 1 {
 		t.Error("status report slot not deleted")
 	}
 }
@@ -269,22 +291,61 @@ func TestProcessMessages_StatusReportDeletedSilently(t *testing.T) {
 // entries are not inbound traffic — never forwarded, never deleted.
 func TestProcessMessages_StoredOutgoingRetained(t *testing.T) {
 	t.Cleanup(swapClock(newFakeClock()))
-	at := newFakeAT()
-	at.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 7,3,,29", testPDUSingle}), nil)
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 7,3,,29", testPDUSingle}), nil)
 	cfg := testConfig()
 	deliverer, sender, _ := newTestDeliverer(cfg)
 
-	if err := processMessages(context.Background(), at, deliverer, cfg, 30); err != nil {
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
 		t.Fatalf("processMessages() error = %v", err)
 	}
 	if len(sender.sent) != 0 {
 		t.Error("stored outgoing message was forwarded")
 	}
-	if at.commandCount("AT+CMGD=7") != 0 {
+	if modem.commandCount("AT+CMGD=7") != 0 {
 		t.Error("stored outgoing message was deleted")
 	}
 }
 
+// TestProcessMessages_TextMode: a text-mode session lists with AT+CMGL in
+// UCS2 and settles per message like PDU mode; a corrupted text listing
+// forwards and deletes nothing.
+func TestProcessMessages_TextMode(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	modem := newFakeAT()
+	modem.on(cmglTextAll, []string{
+		`+CMGL: 5,"REC UNREAD","+4912345",,"26/03/10,08:30:00+04",145,8`, "0422043504410442",
+		`+CMGL: 6,"REC READ",6,42,"+4912345",145,"26/03/10,08:30:00+04","26/03/10,08:30:05+04",0`,
+		`+CMGL: 7,"STO SENT","+4912345",,,145,2`, "00480069",
+	}, nil)
+	modem.on(cmglTextAll, []string{`+CMGL: 8,"REC UNREAD","+4912345",,,145,3`, "00480069"}, nil)
+	cfg := testConfig()
+	deliverer, sender, _ := newTestDeliverer(cfg)
+	deliverer.slots = newSIMSlots(false)
+	deliverer.slots.text = true
+
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+		t.Fatalf("processMessages() error = %v", err)
+	}
+	if got := sender.sentTo(100); len(got) != 1 || !strings.Contains(got[0].Text, "Тест") {
+		t.Errorf("chat 100 received %+v, want the text-mode SMS", got)
+	}
+	if got := cmgdCalls(modem); !slices.Equal(got, []string{"AT+CMGD=6", "AT+CMGD=5"}) {
+		t.Errorf("deletions = %q, want the status report and the delivered SMS", got)
+	}
+	if modem.commandCount("AT+CMGL=4") != 0 {
+		t.Error("PDU listing sent in a text-mode session")
+	}
+
+	err := processMessages(context.Background(), modem, deliverer, cfg, 30)
+	if !errors.Is(err, pdu.ErrListingCorrupted) {
+		t.Errorf("error = %v, want ErrListingCorrupted", err)
+	}
+	if len(sender.sentTo(100)) != 1 || len(cmgdCalls(modem)) != 2 {
+		t.Error("corrupted text listing forwarded or deleted")
+	}
+}
+
 // TestProcessMessages_CorruptedTranscript: framing violations abort the whole
 // listing with no sends and no deletes.
 func TestProcessMessages_CorruptedTranscript(t *testing.T) {
@@ -298,19 +359,19 @@ func TestProcessMessages_CorruptedTranscript(t *testing.T) {
 		{"+CMGL: 5,\"REC UNREAD\",,29", testPDUSingle},           // text-mode listing
 	}
 	for i, lines := range corrupt {
-		at := newFakeAT()
-		at.on("AT+CMGL=4", lines, nil)
+		modem := newFakeAT()
+		modem.on("AT+CMGL=4", lines, nil)
 		cfg := testConfig()
 		deliverer, sender, _ := newTestDeliverer(cfg)
 
-		err := processMessages(context.Background(), at, deliverer, cfg, 30)
-		if !errors.Is(err, ErrCMGLCorrupted) {
-			t.Errorf("case %d: error = %v, want ErrCMGLCorrupted", i, err)
+		err := processMessages(context.Background(), modem, deliverer, cfg, 30)
+		if !errors.Is(err, pdu.ErrListingCorrupted) {
+			t.Errorf("case %d: error = %v, want ErrListingCorrupted", i, err)
 		}
 		if len(sender.sent) != 0 {
 			t.Errorf("case %d: sent %d messages from corrupted transcript", i, len(sender.sent))
 		}
-		for _, call := range at.calls {
+		for _, call := range modem.calls {
 			if strings.HasPrefix(call, "AT+CMGD=") {
 				t.Errorf("case %d: deletion %q from corrupted transcript", i, call)
 			}
@@ -322,25 +383,30 @@ func TestProcessMessages_CorruptedTranscript(t *testing.T) {
 // all and only its own part slots after delivery.
 func TestProcessMessages_MultipartOwnsAllSlots(t *testing.T) {
 	t.Cleanup(swapClock(newFakeClock()))
-	at := newFakeAT()
-	at.on("AT+CMGL=4", cmglListing(
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing(
 		[2]string{"+CMGL: 3,1,,30", pduGSM7Part1},
 		[2]string{"+CMGL: 4,1,,30", pduGSM7Part2},
 	), nil)
 	cfg := testConfig()
 	cfg.ChatIDs = []int64{100}
 	deliverer, sender, _ := newTestDeliverer(cfg)
+	extra := &fakeSink{name: "extra"}
+	deliverer.AddSink(extra)
 
-	if err := processMessages(context.Background(), at, deliverer, cfg, 30); err != nil {
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
 		t.Fatalf("processMessages() error = %v", err)
 	}
 	sent := sender.sentTo(100)
 	if len(sent) != 1 || !strings.Contains(sent[0].Text, "HelloWorld") {
 		t.Fatalf("sent = %+v, want one assembled HelloWorld message", sent)
 	}
-	if at.commandCount("AT+CMGD=3") != 1 || at.commandCount("AT+CMGD=4") != 1 {
+	if modem.commandCount("AT+CMGD=3") != 1 || modem.commandCount("AT+CMGD=4") != 1 {
 		t.Error("both multipart slots must be deleted after delivery")
 	}
+	if len(extra.sent) != 1 || fmt.Sprint(extra.sent[0].RawPDUs) != fmt.Sprint([]string{pduGSM7Part1, pduGSM7Part2}) {
+		t.Errorf("sink got %+v, want the raw PDUs of both parts in order", extra.sent)
+	}
 }
 
 // TestProcessMessages_UndecodablePDUForwardedAsRaw: a strictly framed but
@@ -350,13 +416,13 @@ func TestProcessMessages_UndecodablePDUForwardedAsRaw(t *testing.T) {
 	// Structurally invalid TPDU (too short), but framed correctly:
 	// 9 bytes total, SMSC len 0 → TPDU length 8.
 	rawPDU := "000401AA110000FF22"
-	at := newFakeAT()
-	at.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 6,1,,8", rawPDU}), nil)
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 6,1,,8", rawPDU}), nil)
 	cfg := testConfig()
 	cfg.ChatIDs = []int64{100}
 	deliverer, sender, _ := newTestDeliverer(cfg)
 
-	if err := processMessages(context.Background(), at, deliverer, cfg, 30); err != nil {
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
 		t.Fatalf("processMessages() error = %v", err)
 	}
 	sent := sender.sentTo(100)
@@ -366,7 +432,7 @@ func TestProcessMessages_UndecodablePDUForwardedAsRaw(t *testing.T) {
 	if !strings.Contains(sent[0].Text, "undecodable") {
 		t.Error("raw fallback must be clearly marked")
 	}
-	if at.commandCount("AT+CMGD=6") != 1 {
+	if modem.commandCount("AT+CMGD=6") != 1 {
 		t.Error("raw-forwarded slot must be deleted after delivery")
 	}
 }
@@ -375,21 +441,21 @@ func TestProcessMessages_UndecodablePDUForwardedAsRaw(t *testing.T) {
 // a dead session must abort further modem commands.
 func TestProcessMessages_DeleteTransportErrorAborts(t *testing.T) {
 	t.Cleanup(swapClock(newFakeClock()))
-	at := newFakeAT()
-	at.on("AT+CMGL=4", cmglListing(
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing(
 		[2]string{"+CMGL: 1,1,,29", testPDUSingle},
 		[2]string{"+CMGL: 2,1,,24", pduAlphaSender},
 	), nil)
-	at.on("AT+CMGD=1", nil, ErrModemTimeout)
+	modem.on("AT+CMGD=1", nil, at.ErrModemTimeout)
 	cfg := testConfig()
 	cfg.ChatIDs = []int64{100}
 	deliverer, _, _ := newTestDeliverer(cfg)
 
-	err := processMessages(context.Background(), at, deliverer, cfg, 30)
-	if err == nil || !IsTimeoutError(err) {
+	err := processMessages(context.Background(), modem, deliverer, cfg, 30)
+	if err == nil || !at.IsTimeoutError(err) {
 		t.Fatalf("error = %v, want propagated transport error", err)
 	}
-	if at.commandCount("AT+CMGD=2") != 0 {
+	if modem.commandCount("AT+CMGD=2") != 0 {
 		t.Error("no further deletes may run after an unacknowledged delete")
 	}
 }
@@ -453,6 +519,43 @@ func TestBuildTelegramMessages_ShortSingle(t *testing.T) {
 	if strings.Contains(chunks[0], "Chunk:") {
 		t.Error("single message must not carry a chunk marker")
 	}
+
+	pending.Tags = []string{"otp", "bank"}
+	if chunks := buildTelegramMessages(pending); !strings.Contains(chunks[0], "<b>Tags:</b> #otp #bank\n") {
+		t.Errorf("tags missing from %q", chunks[0])
+	}
+}
+
+// TELEGRAM_MAX_TEXT_LENGTH cuts only what the chats see; the other sinks
+// (and the archive) get the full text.
+func TestDeliverer_TelegramMaxText(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	cfg := testConfig()
+	cfg.TelegramMaxText = 100
+	cfg.Archive = true
+	deliverer, sender, _ := newTestDeliverer(cfg)
+	sink := &fakeSink{name: "webhook"}
+	deliverer.AddSink(sink)
+
+	text := strings.Repeat("Спам ", 100)
+	pending := PendingSMS{Message: SMSMessage{Index: 1, From: "Spam", Text: text}, PartIndices: []int{1}}
+	if got := deliverer.Deliver(context.Background(), pending); got != deliveryDone {
+		t.Fatalf("Deliver() = %v, want deliveryDone", got)
+	}
+	want := "\n" + text[:len("Спам ")*20] + "… (truncated, 400 more chars, full text in archive)"
+	if got := sender.sent[0].Text; !strings.HasSuffix(got, want) {
+		t.Errorf("Telegram message %q, want it to end in %q", got, want)
+	}
+	if sink.sent[0].Message.Text != text {
+		t.Error("the webhook got the truncated text")
+	}
+
+	if got := truncateText("short", 100, false); got != "short" {
+		t.Errorf("truncateText(short) = %q", got)
+	}
+	if got := truncateText(text, 100, false); !strings.HasSuffix(got, "… (truncated, 400 more chars)") {
+		t.Errorf("truncateText() without archive = %q", got)
+	}
 }
 
 // TestClassifySendError covers the mapping from library errors to policy.
@@ -487,6 +590,34 @@ func TestClassifySendError(t *testing.T) {
 	}
 }
 
+// TestDeliverer_TransientRetryBackoff: TELEGRAM_RETRIES in-place retries
+// with a doubling delay, then the message is deferred to the next poll.
+func TestDeliverer_TransientRetryBackoff(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	cfg := testConfig()
+	cfg.ChatIDs = []int64{100}
+	cfg.TelegramRetries = 3
+	cfg.TelegramRetryDelay = 2 * time.Second
+	deliverer, sender, _ := newTestDeliverer(cfg)
+	sender.script = func(int, int64, string) error { return errors.New("connection reset") }
+
+	status := deliverer.Deliver(context.Background(), PendingSMS{
+		Message:     SMSMessage{From: "+1", Text: "body"},
+		PartIndices: []int{1},
+	})
+	if status != deliveryDeferred {
+		t.Fatalf("Deliver() = %v, want deliveryDeferred", status)
+	}
+	if n := len(sender.sent); n != 4 {
+		t.Errorf("send attempts = %d, want 4", n)
+	}
+	want := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second}
+	if !slices.Equal(clock.slept, want) {
+		t.Errorf("retry delays = %v, want %v", clock.slept, want)
+	}
+}
+
 // TestDeliverer_PlainFallbackOn400: HTML rejected but plain text accepted —
 // the message is delivered (and would be deleted), not stuck.
 func TestDeliverer_PlainFallbackOn400(t *testing.T) {
@@ -587,3 +718,206 @@ func TestDeliverer_DestinationFailureStateless(t *testing.T) {
 		t.Fatalf("re-break alert = %d sends total, want 4", got)
 	}
 }
+
+// TestProcessMessages_BlockedSenderDropped: SMS from a blocked sender are
+// deleted without being forwarded, while other messages flow normally.
+func TestProcessMessages_BlockedSenderDropped(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing(
+		[2]string{"+CMGL: 1,1,,29", testPDUSingle},
+		[2]string{"+CMGL: 2,1,,24", pduAlphaSender},
+	), nil)
+	cfg := testConfig()
+	deliverer, sender, _ := newTestDeliverer(cfg)
+	bl, err := NewSenderBlocklist([]string{"google"}, "")
+	if err != nil {
+		t.Fatalf("NewSenderBlocklist() error = %v", err)
+	}
+	deliverer.blocklist = bl
+
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+		t.Fatalf("processMessages() error = %v", err)
+	}
+	for _, m := range sender.sent {
+		if strings.Contains(m.Text, "Google") {
+			t.Error("SMS from blocked sender was forwarded")
+		}
+	}
+	if modem.commandCount("AT+CMGD=2") != 1 {
+		t.Error("blocked SMS not deleted")
+	}
+	if modem.commandCount("AT+CMGD=1") != 1 {
+		t.Error("unrelated SMS not forwarded/deleted")
+	}
+}
+
+// TestProcessMessages_BlockedSenderDryRun: DRY_RUN never deletes, not even
+// blocked SMS.
+func TestProcessMessages_BlockedSenderDryRun(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 2,1,,24", pduAlphaSender}), nil)
+	cfg := testConfig()
+	cfg.DryRun = true
+	deliverer, _, _ := newTestDeliverer(cfg)
+	deliverer.blocklist, _ = NewSenderBlocklist([]string{"Google"}, "")
+
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+		t.Fatalf("processMessages() error = %v", err)
+	}
+	if modem.commandCount("AT+CMGD=2") != 0 {
+		t.Error("DRY_RUN deleted a blocked SMS")
+	}
+}
+
+// TestProcessMessages_Archive: forwarded and blocked SMS are archived before
+// their slots are freed; DRY_RUN archives nothing.
+func TestProcessMessages_Archive(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		t.Cleanup(swapClock(newFakeClock()))
+		modem := newFakeAT()
+		modem.on("AT+CMGL=4", cmglListing(
+			[2]string{"+CMGL: 1,1,,29", testPDUSingle},
+			[2]string{"+CMGL: 2,1,,24", pduAlphaSender},
+		), nil)
+		cfg := testConfig()
+		cfg.DryRun = dryRun
+		deliverer, _, _ := newTestDeliverer(cfg)
+		deliverer.blocklist, _ = NewSenderBlocklist([]string{"Google"}, "")
+		archive := NewMessageArchive(filepath.Join(t.TempDir(), archiveFileName))
+		deliverer.archive = archive
+
+		if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+			t.Fatalf("processMessages() error = %v", err)
+		}
+		recs, err := archive.Query(time.Time{}, time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+		if dryRun {
+			if len(recs) != 0 {
+				t.Errorf("DRY_RUN archived %d records, want 0", len(recs))
+			}
+			continue
+		}
+		if len(recs) != 2 || recs[0].Outcome != archiveForwarded || recs[0].Text != "Тест1" ||
+			recs[1].Outcome != archiveBlocked || recs[1].From != "Google" {
+			t.Errorf("archive = %+v, want forwarded Тест1 then blocked Google", recs)
+		}
+	}
+}
+
+// TestDeliverer_QuietHoursPriority: inside QUIET_HOURS SMS are delivered
+// silently, except from priority senders; outside, everything has sound.
+func TestDeliverer_QuietHoursPriority(t *testing.T) {
+	clock := newFakeClock()
+	clock.now = time.Date(2026, 3, 10, 23, 0, 0, 0, time.Local)
+	t.Cleanup(swapClock(clock))
+	cfg := testConfig()
+	cfg.QuietHours, _ = ParseTimeWindow("22:00-07:00")
+	cfg.PrioritySenders = []string{"google"}
+	deliverer, sender, _ := newTestDeliverer(cfg)
+
+	plain := PendingSMS{Message: SMSMessage{Index: 1, From: "+100", Text: "night"}, PartIndices: []int{1}}
+	priority := PendingSMS{Message: SMSMessage{Index: 2, From: "Google", Text: "alarm"}, PartIndices: []int{2}}
+	for _, p := range []PendingSMS{plain, priority} {
+		if got := deliverer.Deliver(context.Background(), p); got != deliveryDone {
+			t.Fatalf("Deliver(%s) = %v, want deliveryDone", p.Message.From, got)
+		}
+	}
+	clock.Advance(9 * time.Hour) // 08:00
+	if got := deliverer.Deliver(context.Background(), plain); got != deliveryDone {
+		t.Fatalf("Deliver() = %v, want deliveryDone", got)
+	}
+
+	want := []bool{true, false, false} // per SMS, for each chat
+	got := sender.sentTo(100)
+	if len(got) != len(want) {
+		t.Fatalf("sent = %+v, want %d messages", got, len(want))
+	}
+	for i, m := range got {
+		if m.Silent != want[i] {
+			t.Errorf("message %d silent = %v, want %v", i, m.Silent, want[i])
+		}
+	}
+}
+
+// TestDeliverer_RoutingRules: the rule matching the receive time picks the
+// recipients instead of TELEGRAM_CHAT_IDS.
+func TestDeliverer_RoutingRules(t *testing.T) {
+	clock := newFakeClock()
+	clock.now = time.Date(2026, 3, 10, 23, 0, 0, 0, time.Local) // Tuesday night
+	t.Cleanup(swapClock(clock))
+	cfg := testConfig()
+	cfg.RoutingRules, _ = parseRoutingRules("Mon-Fri 09:00-18:00=100,200; *=300")
+	deliverer, sender, _ := newTestDeliverer(cfg)
+
+	pending := PendingSMS{Message: SMSMessage{Index: 1, From: "+100", Text: "night"}, PartIndices: []int{1}}
+	if got := deliverer.Deliver(context.Background(), pending); got != deliveryDone {
+		t.Fatalf("Deliver() = %v, want deliveryDone", got)
+	}
+	if len(sender.sentTo(300)) != 1 || len(sender.sentTo(100)) != 0 || len(sender.sentTo(200)) != 0 {
+		t.Errorf("sent = %+v, want only the on-call chat 300", sender.sent)
+	}
+}
+
+// TestDeliverer_Middleware: steps run in order after the built-ins, may
+// rewrite the SMS before the sinks see it, or stop the chain themselves.
+func TestDeliverer_Middleware(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing(
+		[2]string{"+CMGL: 1,1,,29", testPDUSingle},
+		[2]string{"+CMGL: 2,1,,24", pduAlphaSender},
+	), nil)
+	cfg := testConfig()
+	deliverer, sender, _ := newTestDeliverer(cfg)
+	var order []string
+	deliverer.Use(func(next SMSHandler) SMSHandler {
+		return func(ctx context.Context, pending PendingSMS) deliveryStatus {
+			order = append(order, "filter")
+			if strings.EqualFold(pending.Message.From, "Google") {
+				return deliveryDropped
+			}
+			return next(ctx, pending)
+		}
+	})
+	deliverer.Use(func(next SMSHandler) SMSHandler {
+		return func(ctx context.Context, pending PendingSMS) deliveryStatus {
+			order = append(order, "redact")
+			pending.Message.Text = "[redacted]"
+			return next(ctx, pending)
+		}
+	})
+
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+		t.Fatalf("processMessages() error = %v", err)
+	}
+	if got := strings.Join(order, ","); got != "filter,redact,filter" {
+		t.Errorf("steps = %s, want filter,redact for the first SMS and only filter for the second", got)
+	}
+	sent := sender.sentTo(100)
+	if len(sent) != 1 || !strings.Contains(sent[0].Text, "[redacted]") || strings.Contains(sent[0].Text, "Тест1") {
+		t.Errorf("sinks must see the rewritten SMS only: %+v", sent)
+	}
+	if modem.commandCount("AT+CMGD=1") != 1 || modem.commandCount("AT+CMGD=2") != 1 {
+		t.Error("forwarded and filtered SMS must both be deleted")
+	}
+}
+
+// TestDeliverer_SelfTestConsumed: a loopback self-test SMS never reaches a
+// sink, and its slot is freed.
+func TestDeliverer_SelfTestConsumed(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	deliverer, sender, _ := newTestDeliverer(testConfig())
+	deliverer.selfTest = NewSelfTest(SelfTestOptions{}, nil, nil)
+	pending := PendingSMS{Message: SMSMessage{From: "+4915550001234", Text: selfTestPrefix + "cafe"}, PartIndices: []int{3}}
+
+	if got := deliverer.Deliver(context.Background(), pending); got != deliveryConsumed {
+		t.Errorf("status = %v, want deliveryConsumed", got)
+	}
+	if len(sender.sent) != 0 {
+		t.Error("self-test SMS forwarded")
+	}
+}
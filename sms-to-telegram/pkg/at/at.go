@@ -1,7 +1,12 @@
 // Copyright © 2025 kogeler
 // SPDX-License-Identifier: Apache-2.0
 
-package main
+// Package at is a synchronous AT command session for serial GSM modems
+// (SIM800 and compatibles): line framing across idle read timeouts, echo and
+// URC skipping, the AT+CMGS prompt dialog and the error classification the
+// callers base their recovery on. It knows nothing about SMS decoding or
+// Telegram; the gateway and other tools in this repository share it.
+package at
 
 import (
 	"bufio"
@@ -25,6 +30,32 @@ var (
 	ErrSessionPoisoned = errors.New("modem session poisoned: reopen required")
 )
 
+// Transport is the byte stream to the modem, normally an opened serial port
+// whose reads return io.EOF (or 0 bytes) when the VTIME interval expires.
+type Transport interface {
+	io.Reader
+	io.Writer
+}
+
+// CommandRunner is the command surface of a session. *SimpleAT satisfies
+// it; callers accept it so tests can substitute a fake modem.
+type CommandRunner interface {
+	Command(cmd string) ([]string, error)
+	CommandWithTimeout(cmd string, timeout time.Duration) ([]string, error)
+	Ping() error
+}
+
+// Clock is the time source of a session's deadlines and idle waits.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time        { return time.Now() }
+func (systemClock) Sleep(d time.Duration) { time.Sleep(d) }
+
 // idleReadDelay paces the read loop when the port reports no data. A real
 // serial read already blocks for the VTIME interval; the extra sleep keeps a
 // tight EOF loop (mock port, dead file descriptor) from spinning and gives the
@@ -78,16 +109,28 @@ func classifyURC(line string) (int, bool) {
 // Not safe for concurrent use; the whole application talks to the modem from
 // a single goroutine.
 type SimpleAT struct {
-	port     io.ReadWriter
+	// Clock replaces the system clock, so tests can expire deadlines
+	// without waiting. Set it before the first command.
+	Clock Clock
+	// Observe, when set, is called after every command with how long it
+	// took and its error (latency metrics).
+	Observe func(cmd string, elapsed time.Duration, err error)
+	// OnURC, when set, is called with every URC line the session reads,
+	// during a command or in ReadURCs (not with their payload lines).
+	OnURC func(line string)
+
+	port     Transport
 	reader   *bufio.Reader
 	timeout  time.Duration
 	partial  string
 	poisoned bool
 }
 
-// NewSimpleAT creates a new AT command session for an opened port.
-func NewSimpleAT(port io.ReadWriter, timeout time.Duration) *SimpleAT {
+// NewSimpleAT creates a new AT command session for an opened port; timeout
+// is the deadline of Command.
+func NewSimpleAT(port Transport, timeout time.Duration) *SimpleAT {
 	return &SimpleAT{
+		Clock:   systemClock{},
 		port:    port,
 		reader:  bufio.NewReader(port),
 		timeout: timeout,
@@ -120,7 +163,7 @@ func (s *SimpleAT) readLine(deadline time.Time) (string, error) {
 			return line, nil
 		}
 
-		if !clk.Now().Before(deadline) {
+		if !s.Clock.Now().Before(deadline) {
 			// Deliberate exception: a dangling OK/ERROR fragment is a valid
 			// terminal even without its newline.
 			if frag := strings.TrimSpace(s.partial); terminalFragment(frag) {
@@ -143,7 +186,7 @@ func (s *SimpleAT) readLine(deadline time.Time) (string, error) {
 				s.partial = ""
 				return frag, nil
 			}
-			clk.Sleep(idleReadDelay)
+			s.Clock.Sleep(idleReadDelay)
 			continue
 		}
 		// Hard transport error: the port is gone.
@@ -160,6 +203,13 @@ func (s *SimpleAT) Command(cmd string) ([]string, error) {
 
 // CommandWithTimeout sends an AT command with a custom timeout.
 func (s *SimpleAT) CommandWithTimeout(cmd string, timeout time.Duration) ([]string, error) {
+	start := s.Clock.Now()
+	lines, err := s.commandWithTimeout(cmd, timeout)
+	s.observe(cmd, start, err)
+	return lines, err
+}
+
+func (s *SimpleAT) commandWithTimeout(cmd string, timeout time.Duration) ([]string, error) {
 	if s.poisoned {
 		return nil, ErrSessionPoisoned
 	}
@@ -169,7 +219,35 @@ func (s *SimpleAT) CommandWithTimeout(cmd string, timeout time.Duration) ([]stri
 		return nil, fmt.Errorf("%w: %v", ErrWriteFailed, err)
 	}
 
-	return s.collectResponse(cmd, clk.Now().Add(timeout))
+	return s.collectResponse(cmd, s.Clock.Now().Add(timeout))
+}
+
+// CommandSecret sends a command carrying a secret (a SIM PIN). The command
+// is only ever written from byte slices, which are zeroed afterwards; the
+// caller zeroes cmd. Logs, errors and Observe see RedactCommand's form.
+func (s *SimpleAT) CommandSecret(cmd []byte, timeout time.Duration) ([]string, error) {
+	redacted := RedactCommand(string(cmd))
+	start := s.Clock.Now()
+	lines, err := s.commandSecret(cmd, redacted, timeout)
+	s.observe(redacted, start, err)
+	return lines, err
+}
+
+func (s *SimpleAT) commandSecret(cmd []byte, redacted string, timeout time.Duration) ([]string, error) {
+	if s.poisoned {
+		return nil, ErrSessionPoisoned
+	}
+
+	line := append(append(make([]byte, 0, len(cmd)+2), cmd...), '\r', '\n')
+	_, err := s.port.Write(line)
+	clear(line)
+	if err != nil {
+		s.poisoned = true
+		return nil, fmt.Errorf("%w: %v", ErrWriteFailed, err)
+	}
+
+	// An echo of the command matches its redacted form.
+	return s.collectResponse(redacted, s.Clock.Now().Add(timeout))
 }
 
 // collectResponse reads response lines until a terminal result (OK / ERROR /
@@ -201,18 +279,19 @@ func (s *SimpleAT) collectResponse(echo string, deadline time.Time) ([]string, e
 		// Payload line(s) of a multi-line URC (e.g. the PDU after +CMT:).
 		if urcPayloadLeft > 0 {
 			urcPayloadLeft--
-			slog.Debug("Skipping URC payload line during command", "cmd", echo)
+			slog.Debug("Skipping URC payload line during command", "cmd", RedactCommand(echo))
 			continue
 		}
 
 		// Echo (before ATE0 takes effect).
-		if line == echo {
+		if line == echo || RedactCommand(line) == echo {
 			continue
 		}
 
 		if payload, isURC := classifyURC(line); isURC {
-			slog.Debug("Skipping URC during command", "cmd", echo, "urc", line)
+			slog.Debug("Skipping URC during command", "cmd", RedactCommand(echo), "urc", line)
 			urcPayloadLeft = payload
+			s.urc(line)
 			continue
 		}
 
@@ -233,10 +312,15 @@ func (s *SimpleAT) collectResponse(echo string, deadline time.Time) ([]string, e
 
 // CommandWithPrompt drives the two-phase prompt dialog used by AT+CMGS (and
 // similar commands): it sends cmd, waits for the "> " prompt, writes payload
-// terminated by Ctrl+Z, and collects the final response. Used by the live
-// loopback test suite to send SMS through the modem; production forwarding
-// never sends SMS.
+// terminated by Ctrl+Z, and collects the final response (outgoing SMS).
 func (s *SimpleAT) CommandWithPrompt(cmd, payload string, timeout time.Duration) ([]string, error) {
+	start := s.Clock.Now()
+	lines, err := s.commandWithPrompt(cmd, payload, timeout)
+	s.observe(cmd, start, err)
+	return lines, err
+}
+
+func (s *SimpleAT) commandWithPrompt(cmd, payload string, timeout time.Duration) ([]string, error) {
 	if s.poisoned {
 		return nil, ErrSessionPoisoned
 	}
@@ -246,7 +330,7 @@ func (s *SimpleAT) CommandWithPrompt(cmd, payload string, timeout time.Duration)
 		return nil, fmt.Errorf("%w: %v", ErrWriteFailed, err)
 	}
 
-	deadline := clk.Now().Add(timeout)
+	deadline := s.Clock.Now().Add(timeout)
 
 	// Phase 1: wait for the prompt. The "> " prompt has no trailing newline,
 	// so it is detected in the partial buffer once the port goes idle.
@@ -274,7 +358,7 @@ func (s *SimpleAT) CommandWithPrompt(cmd, payload string, timeout time.Duration)
 			break
 		}
 
-		if !clk.Now().Before(deadline) {
+		if !s.Clock.Now().Before(deadline) {
 			s.poisoned = true
 			return nil, fmt.Errorf("%w: no prompt for %s", ErrModemTimeout, cmd)
 		}
@@ -283,7 +367,7 @@ func (s *SimpleAT) CommandWithPrompt(cmd, payload string, timeout time.Duration)
 		s.partial += data
 		if err == nil || err == io.EOF || err == io.ErrNoProgress {
 			if err != nil && !strings.HasPrefix(strings.TrimSpace(s.partial), ">") {
-				clk.Sleep(idleReadDelay)
+				s.Clock.Sleep(idleReadDelay)
 			}
 			continue
 		}
@@ -301,6 +385,123 @@ func (s *SimpleAT) CommandWithPrompt(cmd, payload string, timeout time.Duration)
 	return s.collectResponse(payload, deadline)
 }
 
+// observe reports a finished command to Observe. Commands refused on a
+// poisoned session never reached the modem and are not reported.
+func (s *SimpleAT) observe(cmd string, start time.Time, err error) {
+	if s.Observe != nil && !errors.Is(err, ErrSessionPoisoned) {
+		s.Observe(cmd, s.Clock.Now().Sub(start), err)
+	}
+}
+
+// pinArgs are the argument positions of the PIN commands that hold a PIN
+// or PUK: AT+CPIN=<pin>[,<newpin>], AT+CLCK=<fac>,<mode>,<passwd> and
+// AT+CPWD=<fac>,<oldpwd>,<newpwd>.
+var pinArgs = map[string][]int{
+	"CPIN": {0, 1},
+	"CLCK": {2},
+	"CPWD": {1, 2},
+}
+
+// RedactCommand masks the PINs of a PIN command (AT+CPIN, AT+CLCK,
+// AT+CPWD) for logs and traces: `AT+CPIN="1234"` becomes `AT+CPIN="****"`.
+// Other commands, and lines that are not commands, are returned unchanged.
+func RedactCommand(cmd string) string {
+	positions, ok := pinArgs[CommandClass(cmd)]
+	if !ok {
+		return cmd
+	}
+	name, args, ok := strings.Cut(cmd, "=")
+	if !ok || strings.HasSuffix(args, "?") {
+		return cmd
+	}
+	fields := strings.Split(args, ",")
+	for _, i := range positions {
+		if i < len(fields) {
+			fields[i] = `"****"`
+		}
+	}
+	return name + "=" + strings.Join(fields, ",")
+}
+
+// CommandClass is the command name without arguments, for grouping:
+// "AT+CMGL=4" and "AT+CMGL?" are "CMGL", "ATE0" is "ATE", "AT" is "AT".
+func CommandClass(cmd string) string {
+	name, ok := strings.CutPrefix(strings.ToUpper(strings.TrimSpace(cmd)), "AT")
+	if !ok {
+		return "other"
+	}
+	if name == "" {
+		return "AT"
+	}
+	if name[0] == '+' || name[0] == '^' {
+		name = name[1:]
+		if end := strings.IndexFunc(name, func(r rune) bool { return !('A' <= r && r <= 'Z' || '0' <= r && r <= '9') }); end >= 0 {
+			name = name[:end]
+		}
+		if name == "" {
+			return "other"
+		}
+		return name
+	}
+	// Basic commands: a letter and its number (ATE0, ATI, AT&F).
+	if name[0] == '&' && len(name) > 1 {
+		return "AT" + name[:2]
+	}
+	return "AT" + name[:1]
+}
+
+// ReadURCs reads what the modem sends while no command runs, for up to
+// wait, and hands the URCs to OnURC. Other lines are discarded: a complete
+// command never leaves any behind. A fragment still arriving at the end
+// stays buffered for the next read; only a transport failure is returned.
+func (s *SimpleAT) ReadURCs(wait time.Duration) error {
+	if s.poisoned {
+		return ErrSessionPoisoned
+	}
+	deadline := s.Clock.Now().Add(wait)
+	urcPayloadLeft := 0
+	for {
+		line, err := s.readLine(deadline)
+		if errors.Is(err, errReadDeadline) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch payload, isURC := classifyURC(line); {
+		case line == "":
+		case urcPayloadLeft > 0:
+			urcPayloadLeft--
+		case isURC:
+			slog.Debug("URC while idle", "urc", line)
+			urcPayloadLeft = payload
+			s.urc(line)
+		default:
+			slog.Debug("Discarding unsolicited line while idle", "line", RedactCommand(line))
+		}
+	}
+}
+
+// Wake wakes a modem from UART sleep (SIM800 AT+CSCLK=2): a dummy AT, whose
+// first characters the sleeping modem loses, then ReadURCs for wait to
+// absorb its answer, if any. Only a transport failure is returned.
+func (s *SimpleAT) Wake(wait time.Duration) error {
+	if s.poisoned {
+		return ErrSessionPoisoned
+	}
+	if _, err := s.port.Write([]byte("AT\r\n")); err != nil {
+		s.poisoned = true
+		return fmt.Errorf("%w: %v", ErrWriteFailed, err)
+	}
+	return s.ReadURCs(wait)
+}
+
+func (s *SimpleAT) urc(line string) {
+	if s.OnURC != nil {
+		s.OnURC(line)
+	}
+}
+
 // Ping sends a simple AT command to check if modem is responsive.
 func (s *SimpleAT) Ping() error {
 	_, err := s.CommandWithTimeout("AT", 2*time.Second)
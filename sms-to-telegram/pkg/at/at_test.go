@@ -1,7 +1,7 @@
 // Copyright © 2025 kogeler
 // SPDX-License-Identifier: Apache-2.0
 
-package main
+package at
 
 import (
 	"bytes"
@@ -258,3 +258,91 @@ func TestSimpleAT_WritesCorrectCommand(t *testing.T) {
 		t.Errorf("Written = %q, want %q", written, expected)
 	}
 }
+
+// A secret command is written as given, its echo is skipped and only the
+// redacted form reaches Observe.
+func TestSimpleAT_CommandSecret(t *testing.T) {
+	port := newMockPort("AT+CPIN=\"1234\"\r\nOK\r\n")
+	at := NewSimpleAT(port, time.Second)
+	var observed []string
+	at.Observe = func(cmd string, _ time.Duration, _ error) { observed = append(observed, cmd) }
+
+	lines, err := at.CommandSecret([]byte(`AT+CPIN="1234"`), time.Second)
+	if err != nil || len(lines) != 0 {
+		t.Fatalf("CommandSecret() = %q, %v; want no lines", lines, err)
+	}
+	if got := port.writeData.String(); got != "AT+CPIN=\"1234\"\r\n" {
+		t.Errorf("Written = %q", got)
+	}
+	if len(observed) != 1 || observed[0] != `AT+CPIN="****"` {
+		t.Errorf("observed = %q, want the redacted command", observed)
+	}
+}
+
+func TestRedactCommand(t *testing.T) {
+	for cmd, want := range map[string]string{
+		`AT+CPIN="1234"`:             `AT+CPIN="****"`,
+		`AT+CPIN=12345678,"1234"`:    `AT+CPIN="****","****"`,
+		`AT+CLCK="SC",1,"1234"`:      `AT+CLCK="SC",1,"****"`,
+		`AT+CLCK="SC",0,"1234",7`:    `AT+CLCK="SC",0,"****",7`,
+		`AT+CPWD="SC","1234","5678"`: `AT+CPWD="SC","****","****"`,
+		`at+cpin="1234"`:             `at+cpin="****"`,
+		`AT+CLCK="SC",2`:             `AT+CLCK="SC",2`,
+		"AT+CPIN?":                   "AT+CPIN?",
+		"AT+CPIN=?":                  "AT+CPIN=?",
+		"AT+CMGL=4":                  "AT+CMGL=4",
+		"+CPIN: SIM PIN":             "+CPIN: SIM PIN",
+	} {
+		if got := RedactCommand(cmd); got != want {
+			t.Errorf("RedactCommand(%q) = %q, want %q", cmd, got, want)
+		}
+	}
+}
+
+func TestSimpleAT_Observe(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	type call struct {
+		cmd     string
+		elapsed time.Duration
+		err     error
+	}
+	var calls []call
+	at := NewSimpleAT(&mockPort{readData: []byte("AT+CSQ\r\n+CSQ: 20,0\r\nOK\r\n")}, 300*time.Millisecond)
+	at.Clock = clock
+	at.Observe = func(cmd string, elapsed time.Duration, err error) { calls = append(calls, call{cmd, elapsed, err}) }
+
+	at.Command("AT+CSQ")
+	at.Command("AT+CMGL=4") // times out after idle reads, poisoning the session
+	at.Command("AT")        // refused without reaching the modem
+
+	if len(calls) != 2 {
+		t.Fatalf("calls = %+v, want 2", calls)
+	}
+	if calls[0].cmd != "AT+CSQ" || calls[0].err != nil {
+		t.Errorf("first call = %+v", calls[0])
+	}
+	if calls[1].cmd != "AT+CMGL=4" || !IsTimeoutError(calls[1].err) || calls[1].elapsed < 300*time.Millisecond {
+		t.Errorf("second call = %+v", calls[1])
+	}
+}
+
+func TestCommandClass(t *testing.T) {
+	for cmd, want := range map[string]string{
+		"AT":                  "AT",
+		"ATE0":                "ATE",
+		"ATI":                 "ATI",
+		"AT&F":                "AT&F",
+		"AT+CMGL=4":           "CMGL",
+		"AT+CPMS?":            "CPMS",
+		`AT+CPMS="SM","SM"`:   "CPMS",
+		"at+csq":              "CSQ",
+		"AT+CMGD=1,4":         "CMGD",
+		"AT^SYSINFO":          "SYSINFO",
+		"AT+":                 "other",
+		"0791448720003023...": "other",
+	} {
+		if got := CommandClass(cmd); got != want {
+			t.Errorf("CommandClass(%q) = %q, want %q", cmd, got, want)
+		}
+	}
+}
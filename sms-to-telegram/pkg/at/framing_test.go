@@ -1,7 +1,7 @@
 // Copyright © 2025 kogeler
 // SPDX-License-Identifier: Apache-2.0
 
-package main
+package at
 
 import (
 	"errors"
@@ -10,14 +10,15 @@ import (
 	"time"
 )
 
-// newScriptedAT builds a SimpleAT over a scriptedPort with a fake clock
-// installed, so idle reads advance time instantly.
+// newScriptedAT builds a SimpleAT over a scriptedPort with a fake clock, so
+// idle reads advance time instantly.
 func newScriptedAT(t *testing.T, timeout time.Duration) (*SimpleAT, *scriptedPort, *fakeClock) {
 	t.Helper()
-	fc := newFakeClock()
-	t.Cleanup(swapClock(fc))
+	fc := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
 	port := &scriptedPort{}
-	return NewSimpleAT(port, timeout), port, fc
+	s := NewSimpleAT(port, timeout)
+	s.Clock = fc
+	return s, port, fc
 }
 
 // A PDU line split across two reads with an idle timeout between them must be
@@ -190,103 +191,6 @@ func TestSimpleAT_EchoSkipped(t *testing.T) {
 	}
 }
 
-func TestInitModemSession_HappyPath(t *testing.T) {
-	at := newFakeAT()
-	at.on("AT+CMGF?", []string{"+CMGF: 0"}, nil)
-	at.on(`AT+CPMS="SM","SM","SM"`, []string{`+CPMS: 3,30,3,30,3,30`}, nil)
-
-	used, total, err := initModemSession(at)
-	if err != nil {
-		t.Fatalf("initModemSession() error = %v", err)
-	}
-	if used != 3 || total != 30 {
-		t.Errorf("capacity = %d/%d, want 3/30", used, total)
-	}
-	for _, cmd := range []string{"ATE0", "AT+CMGF=0", "AT+CNMI=2,0,0,0,0"} {
-		if at.commandCount(cmd) != 1 {
-			t.Errorf("command %s issued %d times, want 1", cmd, at.commandCount(cmd))
-		}
-	}
-}
-
-func TestInitModemSession_TextModeStuck(t *testing.T) {
-	at := newFakeAT()
-	at.on("AT+CMGF?", []string{"+CMGF: 1"}, nil) // modem kept text mode
-
-	_, _, err := initModemSession(at)
-	var diagErr *DiagnosticError
-	if !errors.As(err, &diagErr) || diagErr.Type != ErrTypeModemInitFailed {
-		t.Fatalf("error = %v, want ErrTypeModemInitFailed", err)
-	}
-}
-
-func TestInitModemSession_CNMIFallback(t *testing.T) {
-	at := newFakeAT()
-	at.on("AT+CMGF?", []string{"+CMGF: 0"}, nil)
-	at.on("AT+CNMI=2,0,0,0,0", nil, ErrModemError)
-
-	if _, _, err := initModemSession(at); err != nil {
-		t.Fatalf("initModemSession() error = %v (fallback CNMI should succeed)", err)
-	}
-	if at.commandCount("AT+CNMI=0,0,0,0,0") != 1 {
-		t.Error("fallback AT+CNMI=0,0,0,0,0 was not attempted")
-	}
-}
-
-func TestInitModemSession_TransportErrorIsSessionError(t *testing.T) {
-	at := newFakeAT()
-	at.on("AT", nil, ErrModemTimeout)
-
-	_, _, err := initModemSession(at)
-	var sessErr *SessionError
-	if !errors.As(err, &sessErr) {
-		t.Fatalf("error = %v, want SessionError", err)
-	}
-}
-
-// A mandatory init command failing with a modem ERROR while the SIM is absent
-// must be reported as SIM Not Detected (not Modem Init Failed), so the whole
-// SIM-out episode keeps one error type (dedup → single alert) and inherits the
-// SIM reset-and-recover path. Regression for the live SIM-pull test.
-func TestInitModemSession_CMGFErrorWithSIMOut(t *testing.T) {
-	at := newFakeAT()
-	at.on("AT+CMGF=0", nil, ErrModemError)
-	at.on("AT+CPIN?", nil, ErrModemError) // SIM gone: CPIN also errors
-
-	_, _, err := initModemSession(at)
-	var diagErr *DiagnosticError
-	if !errors.As(err, &diagErr) || diagErr.Type != ErrTypeSimNotDetected {
-		t.Fatalf("error = %v, want ErrTypeSimNotDetected", err)
-	}
-}
-
-// The same failure with the SIM actually READY is a genuine init problem and
-// stays Modem Init Failed.
-func TestInitModemSession_CMGFErrorWithSIMReady(t *testing.T) {
-	at := newFakeAT()
-	at.on("AT+CMGF=0", nil, ErrModemError)
-	at.on("AT+CPIN?", []string{"+CPIN: READY"}, nil)
-
-	_, _, err := initModemSession(at)
-	var diagErr *DiagnosticError
-	if !errors.As(err, &diagErr) || diagErr.Type != ErrTypeModemInitFailed {
-		t.Fatalf("error = %v, want ErrTypeModemInitFailed", err)
-	}
-}
-
-// A transport timeout during the SIM reprobe stays a SessionError (quiet reopen).
-func TestInitModemSession_CMGFErrorProbeTimeout(t *testing.T) {
-	at := newFakeAT()
-	at.on("AT+CMGF=0", nil, ErrModemError)
-	at.on("AT+CPIN?", nil, ErrModemTimeout)
-
-	_, _, err := initModemSession(at)
-	var sessErr *SessionError
-	if !errors.As(err, &sessErr) {
-		t.Fatalf("error = %v, want SessionError", err)
-	}
-}
-
 // CommandWithPrompt happy path: prompt, payload with Ctrl+Z, +CMGS result.
 func TestSimpleAT_CommandWithPrompt(t *testing.T) {
 	at, port, _ := newScriptedAT(t, 5*time.Second)
@@ -348,3 +252,55 @@ func TestSimpleAT_CommandWithPrompt_NoPromptPoisons(t *testing.T) {
 		t.Errorf("writes = %d, want 1", len(port.writes))
 	}
 }
+
+// ReadURCs hands idle URCs (not their payload lines) to OnURC, keeps a
+// fragment still arriving for the next read and leaves the session usable;
+// URCs skipped during a command reach OnURC too.
+func TestSimpleAT_ReadURCs(t *testing.T) {
+	at, port, _ := newScriptedAT(t, 5*time.Second)
+	var urcs []string
+	at.OnURC = func(line string) { urcs = append(urcs, line) }
+	port.enqueue(
+		chunk("+CMTI: \"SM\",3\r\n"),
+		chunk("+CMT: ,24\r\n"),
+		chunk("07915348DEADBEEF\r\n"),
+		chunk("stray\r\n"),
+		chunk("+CMTI: \"SM\","), // cut off by the deadline
+	)
+	if err := at.ReadURCs(200 * time.Millisecond); err != nil {
+		t.Fatalf("ReadURCs() error = %v", err)
+	}
+	if len(urcs) != 2 || urcs[0] != `+CMTI: "SM",3` || urcs[1] != "+CMT: ,24" {
+		t.Fatalf("URCs = %q", urcs)
+	}
+
+	port.enqueue(chunk("4\r\n"), chunk("OK\r\n"))
+	if _, err := at.Command("AT"); err != nil || at.Poisoned() {
+		t.Fatalf("Command() after ReadURCs error = %v", err)
+	}
+	if len(urcs) != 3 || urcs[2] != `+CMTI: "SM",4` {
+		t.Errorf("URCs = %q, want the completed fragment", urcs)
+	}
+}
+
+// Wake's dummy AT answer, complete or a bare OK fragment, never reaches the
+// next command.
+func TestSimpleAT_Wake(t *testing.T) {
+	for _, answer := range []string{"OK\r\n", "OK", ""} {
+		at, port, _ := newScriptedAT(t, 5*time.Second)
+		if answer != "" {
+			port.enqueue(chunk(answer))
+		}
+		if err := at.Wake(200 * time.Millisecond); err != nil {
+			t.Fatalf("Wake() error = %v", err)
+		}
+		port.enqueue(chunk("+CSQ: 20,0\r\n"), chunk("OK\r\n"))
+		lines, err := at.Command("AT+CSQ")
+		if err != nil || len(lines) != 1 || lines[0] != "+CSQ: 20,0" {
+			t.Errorf("answer %q: Command() = %q, %v", answer, lines, err)
+		}
+		if len(port.writes) != 2 || string(port.writes[0]) != "AT\r\n" {
+			t.Errorf("answer %q: writes = %q", answer, port.writes)
+		}
+	}
+}
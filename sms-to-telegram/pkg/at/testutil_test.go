@@ -0,0 +1,89 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package at
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// fakeClock advances time instantly on Sleep, so deadlines expire after a
+// few idle reads instead of seconds.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// --- scriptedPort --------------------------------------------------------------
+//
+// Byte-level serial port fake. Each Read consumes one scripted chunk; an empty
+// queue behaves like a VTIME timeout (0 bytes, io.EOF), matching tarm/serial
+// over os.File. Writes are recorded and can enqueue response chunks.
+
+type readChunk struct {
+	data []byte
+	err  error
+}
+
+type scriptedPort struct {
+	mu      sync.Mutex
+	chunks  []readChunk
+	writes  []string
+	onWrite func(written string) []readChunk
+}
+
+// chunk builds a data chunk; use eofChunk() to simulate an idle read timeout.
+func chunk(s string) readChunk   { return readChunk{data: []byte(s)} }
+func eofChunk() readChunk        { return readChunk{err: io.EOF} }
+func errChunk(e error) readChunk { return readChunk{err: e} }
+
+func (p *scriptedPort) enqueue(chunks ...readChunk) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.chunks = append(p.chunks, chunks...)
+}
+
+func (p *scriptedPort) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.chunks) == 0 {
+		return 0, io.EOF // idle: VTIME expired with no data
+	}
+	ch := p.chunks[0]
+	p.chunks = p.chunks[1:]
+	n := copy(b, ch.data)
+	if n < len(ch.data) {
+		// Remainder stays queued for the next read.
+		p.chunks = append([]readChunk{{data: ch.data[n:], err: ch.err}}, p.chunks...)
+		return n, nil
+	}
+	return n, ch.err
+}
+
+func (p *scriptedPort) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	written := string(b)
+	p.writes = append(p.writes, written)
+	hook := p.onWrite
+	p.mu.Unlock()
+	if hook != nil {
+		if resp := hook(written); resp != nil {
+			p.enqueue(resp...)
+		}
+	}
+	return len(b), nil
+}
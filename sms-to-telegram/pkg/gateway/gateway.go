@@ -0,0 +1,295 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+// Package gateway embeds SMS reception in another Go program: it keeps an AT
+// session with a serial GSM modem (SIM800 and compatibles) open, polls the
+// SIM, assembles multipart SMS and hands every message to a callback,
+// deleting it from the SIM once the callback accepted it. The sms-to-telegram
+// binary adds diagnostics, alerting and its delivery pipeline on top of the
+// same building blocks (packages at and pdu); this is the bare reception
+// loop.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/tarm/serial"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
+)
+
+const (
+	commandTimeout = 5 * time.Second
+	// A full SIM produces a far larger response than any other command.
+	listTimeout = 20 * time.Second
+)
+
+// Config configures a Gateway. Zero durations take the defaults of the
+// sms-to-telegram binary.
+type Config struct {
+	// Port is the serial device, e.g. /dev/ttyUSB0. Ignored when Open is set.
+	Port string
+	// BaudRate defaults to 115200.
+	BaudRate int
+	// Open replaces opening Port, e.g. for a serial-over-TCP bridge.
+	Open func() (io.ReadWriteCloser, error)
+
+	// PollInterval between SIM listings, default 10s.
+	PollInterval time.Duration
+	// RetryInterval before reopening a failed session, default 30s.
+	RetryInterval time.Duration
+	// MultipartMaxAge deletes the parts of a multipart SMS that did not
+	// complete within it; 0 keeps them until they do.
+	MultipartMaxAge time.Duration
+
+	// OnMessage receives every complete SMS, one at a time, in SIM order.
+	// A nil error deletes the SMS from the SIM; an error keeps it and the
+	// SMS after it for the next poll. Delivery is at least once: an SMS
+	// whose deletion fails is handed over again.
+	OnMessage func(ctx context.Context, msg Message) error
+
+	// Logger defaults to slog.Default(). SMS content is never logged.
+	Logger *slog.Logger
+}
+
+// Message is one received SMS, multipart messages already assembled.
+type Message struct {
+	Sender string
+	Text   string
+	Time   time.Time // zero when the modem reported an invalid timestamp
+	SMSC   string
+	Parts  int
+	// Slots are the SIM indices the SMS occupies.
+	Slots []int
+	// PDUs are the raw hex PDUs in part order.
+	PDUs []string
+	// Err is set for an SMS that could not be decoded
+	// (*pdu.MalformedError, *pdu.UnsupportedEncodingError): Text is empty,
+	// Sender and Time are filled in when the header was readable, and PDUs
+	// carries the message for the caller to keep or drop.
+	Err error
+}
+
+// Gateway is the reception loop. Create it with New.
+type Gateway struct {
+	cfg Config
+	log *slog.Logger
+}
+
+// New validates cfg and applies its defaults.
+func New(cfg Config) (*Gateway, error) {
+	if cfg.Port == "" && cfg.Open == nil {
+		return nil, errors.New("gateway: Port or Open is required")
+	}
+	if cfg.OnMessage == nil {
+		return nil, errors.New("gateway: OnMessage is required")
+	}
+	if cfg.BaudRate == 0 {
+		cfg.BaudRate = 115200
+	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = 10 * time.Second
+	}
+	if cfg.RetryInterval == 0 {
+		cfg.RetryInterval = 30 * time.Second
+	}
+	if cfg.PollInterval < 0 || cfg.RetryInterval < 0 || cfg.MultipartMaxAge < 0 {
+		return nil, errors.New("gateway: intervals must not be negative")
+	}
+	log := cfg.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	return &Gateway{cfg: cfg, log: log}, nil
+}
+
+// Run receives SMS until ctx ends, reopening the session after every
+// failure. It returns nil on cancellation.
+func (g *Gateway) Run(ctx context.Context) error {
+	for {
+		err := g.session(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		g.log.Error("Modem session failed", "error", err, "retry_in", g.cfg.RetryInterval)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(g.cfg.RetryInterval):
+		}
+	}
+}
+
+func (g *Gateway) open() (io.ReadWriteCloser, error) {
+	if g.cfg.Open != nil {
+		return g.cfg.Open()
+	}
+	return serial.OpenPort(&serial.Config{Name: g.cfg.Port, Baud: g.cfg.BaudRate, ReadTimeout: 500 * time.Millisecond})
+}
+
+// session runs one modem session; it only returns nil on cancellation.
+func (g *Gateway) session(ctx context.Context) error {
+	port, err := g.open()
+	if err != nil {
+		return fmt.Errorf("opening modem: %w", err)
+	}
+	defer port.Close()
+	modem := at.NewSimpleAT(port, commandTimeout)
+	if err := initSession(modem); err != nil {
+		return err
+	}
+	g.log.Info("Modem session initialized", "poll_interval", g.cfg.PollInterval)
+
+	ticker := time.NewTicker(g.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := g.poll(ctx, modem); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// initSession is the mandatory setup before the SIM may be listed: PDU mode
+// (verified), SIM storage and no delivery indications in the transcripts.
+func initSession(modem *at.SimpleAT) error {
+	var err error
+	for range 3 {
+		if _, err = modem.Command("AT"); err == nil || at.IsTimeoutError(err) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("modem not responding: %w", err)
+	}
+	for _, cmd := range []string{"ATE0", "AT+CMGF=0"} {
+		if _, err := modem.Command(cmd); err != nil {
+			return fmt.Errorf("%s: %w", cmd, err)
+		}
+	}
+	resp, err := modem.Command("AT+CMGF?")
+	if err != nil {
+		return fmt.Errorf("AT+CMGF?: %w", err)
+	}
+	if joined := strings.Join(resp, " "); !strings.Contains(joined, "+CMGF: 0") {
+		return fmt.Errorf("PDU mode not active after AT+CMGF=0 (got %q)", joined)
+	}
+	if _, err := modem.Command(`AT+CPMS="SM","SM","SM"`); err != nil {
+		return fmt.Errorf("selecting SIM storage: %w", err)
+	}
+	if _, err := modem.Command("AT+CNMI=2,0,0,0,0"); err != nil {
+		if at.IsTimeoutError(err) {
+			return fmt.Errorf("AT+CNMI: %w", err)
+		}
+		if _, err := modem.Command("AT+CNMI=0,0,0,0,0"); err != nil {
+			return fmt.Errorf("AT+CNMI: %w", err)
+		}
+	}
+	return nil
+}
+
+// poll lists the SIM once and hands the complete SMS over. Errors end the
+// session: a failed listing or delete leaves the transcript untrustworthy.
+func (g *Gateway) poll(ctx context.Context, modem *at.SimpleAT) error {
+	resp, err := modem.CommandWithTimeout("AT+CMGL=4", listTimeout)
+	if err != nil {
+		return fmt.Errorf("listing SMS: %w", err)
+	}
+	entries, err := pdu.ParseListing(resp)
+	if err != nil {
+		return err
+	}
+
+	collector := pdu.NewMultipartCollector()
+	raw := make(map[int]string, len(entries))
+	var messages []Message
+	var reports []int
+	for _, entry := range entries {
+		// 2/3 are stored outgoing messages, not ours.
+		if entry.Stat == 2 || entry.Stat == 3 {
+			continue
+		}
+		raw[entry.Index] = entry.PDU
+		part, err := pdu.Parse(entry.PDU)
+		var notDeliver *pdu.NotDeliverError
+		var unsupported *pdu.UnsupportedEncodingError
+		switch {
+		case errors.As(err, &notDeliver):
+			// Delivery receipts are deleted; a stored SUBMIT is left alone.
+			if notDeliver.MTI == 2 {
+				reports = append(reports, entry.Index)
+			}
+			continue
+		case err != nil:
+			msg := Message{Parts: 1, Slots: []int{entry.Index}, PDUs: []string{entry.PDU}, Err: err}
+			if errors.As(err, &unsupported) && unsupported.Msg != nil {
+				msg.Sender, msg.Time = unsupported.Msg.Sender, unsupported.Msg.Timestamp
+			}
+			messages = append(messages, msg)
+			continue
+		}
+		assembled, slots := collector.Add(entry.Index, part)
+		if assembled == nil {
+			continue
+		}
+		msg := Message{
+			Sender: assembled.Sender,
+			Text:   assembled.Text,
+			Time:   assembled.Timestamp,
+			SMSC:   assembled.SMSC,
+			Parts:  len(slots),
+			Slots:  slots,
+		}
+		for _, slot := range slots {
+			msg.PDUs = append(msg.PDUs, raw[slot])
+		}
+		messages = append(messages, msg)
+	}
+
+	if err := g.delete(modem, reports, "status report"); err != nil {
+		return err
+	}
+	if g.cfg.MultipartMaxAge > 0 {
+		if err := g.delete(modem, collector.StaleIndices(g.cfg.MultipartMaxAge, time.Now()), "stale multipart part"); err != nil {
+			return err
+		}
+	}
+	for _, msg := range messages {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := g.cfg.OnMessage(ctx, msg); err != nil {
+			g.log.Warn("SMS not accepted, retrying next poll", "slots", msg.Slots, "error", err)
+			return nil
+		}
+		if err := g.delete(modem, msg.Slots, "received SMS"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delete frees SIM slots. A modem ERROR is logged and skipped; a transport
+// error ends the session before any further delete.
+func (g *Gateway) delete(modem *at.SimpleAT, slots []int, kind string) error {
+	for _, slot := range slots {
+		if _, err := modem.Command(fmt.Sprintf("AT+CMGD=%d", slot)); err != nil {
+			if at.IsTimeoutError(err) {
+				return fmt.Errorf("deleting %s at index %d: %w", kind, slot, err)
+			}
+			g.log.Error("Failed to delete SMS", "kind", kind, "index", slot, "error", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
+)
+
+// fakeModem answers AT commands like a SIM800 with SMS in its SIM storage.
+// Reads with nothing pending behave like a serial read timeout.
+type fakeModem struct {
+	mu    sync.Mutex
+	out   bytes.Buffer
+	line  []byte
+	slots map[int]string
+}
+
+func newFakeModem(slots map[int]string) *fakeModem {
+	return &fakeModem{slots: slots}
+}
+
+func (m *fakeModem) Read(b []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.out.Len() == 0 {
+		return 0, io.EOF
+	}
+	return m.out.Read(b)
+}
+
+func (m *fakeModem) Write(b []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range b {
+		if c != '\r' {
+			m.line = append(m.line, c)
+			continue
+		}
+		lines, ok := m.respond(strings.TrimSpace(string(m.line)))
+		m.line = m.line[:0]
+		for _, l := range lines {
+			m.out.WriteString("\r\n" + l + "\r\n")
+		}
+		if ok {
+			m.out.WriteString("\r\nOK\r\n")
+		} else {
+			m.out.WriteString("\r\nERROR\r\n")
+		}
+	}
+	return len(b), nil
+}
+
+func (m *fakeModem) Close() error { return nil }
+
+func (m *fakeModem) respond(cmd string) ([]string, bool) {
+	switch {
+	case cmd == "AT+CMGF?":
+		return []string{"+CMGF: 0"}, true
+	case cmd == "AT+CMGL=4":
+		var lines []string
+		for _, index := range slices.Sorted(maps.Keys(m.slots)) {
+			raw := m.slots[index]
+			smscLen, _ := strconv.ParseUint(raw[:2], 16, 8)
+			lines = append(lines, fmt.Sprintf("+CMGL: %d,1,,%d", index, len(raw)/2-int(smscLen)-1), raw)
+		}
+		return lines, true
+	case strings.HasPrefix(cmd, "AT+CMGD="):
+		index, err := strconv.Atoi(strings.TrimPrefix(cmd, "AT+CMGD="))
+		delete(m.slots, index)
+		return nil, err == nil
+	}
+	return nil, true
+}
+
+func (m *fakeModem) slotCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.slots)
+}
+
+func encode(t *testing.T, body string, concat *pdu.Concat) string {
+	t.Helper()
+	raw, err := pdu.EncodeDeliver("+15550001234", body, false, concat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// runGateway runs a Gateway on modem until stop reports true.
+func runGateway(t *testing.T, modem *fakeModem, onMessage func(context.Context, Message) error, stop func() bool) {
+	t.Helper()
+	gw, err := New(Config{
+		Open:          func() (io.ReadWriteCloser, error) { return modem, nil },
+		PollInterval:  10 * time.Millisecond,
+		RetryInterval: 10 * time.Millisecond,
+		OnMessage:     onMessage,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- gw.Run(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for !stop() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+}
+
+func TestGateway_DeliversAndDeletes(t *testing.T) {
+	modem := newFakeModem(map[int]string{
+		1: encode(t, "single", nil),
+		3: encode(t, "Hello", &pdu.Concat{Ref: 7, Total: 2, Part: 1}),
+		4: encode(t, "World", &pdu.Concat{Ref: 7, Total: 2, Part: 2}),
+		5: "0006AA0B9153489484708700005211112183058052111121830580", // status report
+		6: encode(t, "half", &pdu.Concat{Ref: 8, Total: 2, Part: 1}),
+	})
+	var mu sync.Mutex
+	var got []Message
+	runGateway(t, modem, func(_ context.Context, msg Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, msg)
+		return nil
+	}, func() bool { return modem.slotCount() == 1 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 {
+		t.Fatalf("OnMessage called %d times, want 2: %+v", len(got), got)
+	}
+	if got[0].Text != "single" || got[0].Sender != "+15550001234" || got[0].Parts != 1 {
+		t.Errorf("first message = %+v", got[0])
+	}
+	if got[1].Text != "HelloWorld" || got[1].Parts != 2 || !slices.Equal(got[1].Slots, []int{3, 4}) || len(got[1].PDUs) != 2 {
+		t.Errorf("multipart message = %+v", got[1])
+	}
+	if _, ok := modem.slots[6]; !ok {
+		t.Error("incomplete multipart part deleted")
+	}
+}
+
+// TestGateway_RejectedKeptForNextPoll: an SMS the callback refuses stays on
+// the SIM, and so does the one behind it, until a later poll hands them over
+// again.
+func TestGateway_RejectedKeptForNextPoll(t *testing.T) {
+	modem := newFakeModem(map[int]string{1: encode(t, "first", nil), 2: encode(t, "second", nil)})
+	var mu sync.Mutex
+	var calls []string
+	runGateway(t, modem, func(_ context.Context, msg Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, msg.Text)
+		if len(calls) == 1 {
+			return errors.New("downstream unavailable")
+		}
+		return nil
+	}, func() bool { return modem.slotCount() == 0 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"first", "first", "second"}; !slices.Equal(calls, want) {
+		t.Errorf("OnMessage calls = %q, want %q", calls, want)
+	}
+}
+
+func TestGateway_UndecodableHandedOver(t *testing.T) {
+	malformed := "0004"
+	modem := newFakeModem(map[int]string{9: malformed})
+	var got Message
+	runGateway(t, modem, func(_ context.Context, msg Message) error {
+		got = msg
+		return nil
+	}, func() bool { return modem.slotCount() == 0 })
+
+	var malformedErr *pdu.MalformedError
+	if !errors.As(got.Err, &malformedErr) || got.Text != "" || !slices.Equal(got.PDUs, []string{malformed}) {
+		t.Errorf("undecodable message = %+v, want Err *pdu.MalformedError and the raw PDU", got)
+	}
+}
+
+func TestNew_Validation(t *testing.T) {
+	onMessage := func(context.Context, Message) error { return nil }
+	if _, err := New(Config{OnMessage: onMessage}); err == nil {
+		t.Error("New() without Port or Open succeeded")
+	}
+	if _, err := New(Config{Port: "/dev/ttyUSB0"}); err == nil {
+		t.Error("New() without OnMessage succeeded")
+	}
+	if _, err := New(Config{Port: "/dev/ttyUSB0", OnMessage: onMessage, PollInterval: -time.Second}); err == nil {
+		t.Error("New() with a negative interval succeeded")
+	}
+	gw, err := New(Config{Port: "/dev/ttyUSB0", OnMessage: onMessage})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if gw.cfg.BaudRate != 115200 || gw.cfg.PollInterval != 10*time.Second || gw.cfg.RetryInterval != 30*time.Second {
+		t.Errorf("defaults = %+v", gw.cfg)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package pdu
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrListingCorrupted marks a listing whose header/PDU framing failed
+// validation. Nothing from such a transcript may be forwarded or deleted, and
+// the session must be reopened.
+var ErrListingCorrupted = errors.New("CMGL transcript corrupted")
+
+// ListEntry is one strictly validated header+PDU pair from a listing.
+type ListEntry struct {
+	Index int
+	// Stat is the storage status: 0/1 received unread/read, 2/3 stored
+	// unsent/sent.
+	Stat int
+	PDU  string // hex, as listed
+}
+
+// ParseListing validates the header/PDU framing of an AT+CMGL response in PDU
+// mode. Any inconsistency fails the whole listing: after the AT session's URC
+// filtering a stray or short line means the transcript cannot be trusted, and
+// forwarding or deleting based on it risks losing a real SMS.
+func ParseListing(lines []string) ([]ListEntry, error) {
+	var entries []ListEntry
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if !strings.HasPrefix(line, "+CMGL:") {
+			return nil, fmt.Errorf("%w: unexpected line %q", ErrListingCorrupted, line)
+		}
+
+		index, stat, tpduLen, err := parseCMGLHeader(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrListingCorrupted, err)
+		}
+
+		if i+1 >= len(lines) {
+			return nil, fmt.Errorf("%w: header %q without PDU line", ErrListingCorrupted, line)
+		}
+		i++
+		pduStr := strings.TrimSpace(lines[i])
+
+		if err := validatePDULine(pduStr, tpduLen); err != nil {
+			return nil, fmt.Errorf("%w: index %d: %v", ErrListingCorrupted, index, err)
+		}
+
+		entries = append(entries, ListEntry{Index: index, Stat: stat, PDU: pduStr})
+	}
+
+	return entries, nil
+}
+
+// parseCMGLHeader parses "+CMGL: <index>,<stat>,<alpha>,<length>" honoring
+// quoted alpha fields that may contain commas.
+func parseCMGLHeader(line string) (index, stat, tpduLen int, err error) {
+	rest := strings.TrimSpace(strings.TrimPrefix(line, "+CMGL:"))
+	fields := splitQuoted(rest)
+	if len(fields) < 3 {
+		return 0, 0, 0, fmt.Errorf("header %q has %d fields, want >= 3", line, len(fields))
+	}
+
+	index, err = strconv.Atoi(strings.TrimSpace(fields[0]))
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("bad index in header %q: %v", line, err)
+	}
+	// Text-mode listings quote the status ("REC UNREAD"); seeing one means
+	// PDU mode is not active and nothing in the transcript can be trusted.
+	stat, err = strconv.Atoi(strings.TrimSpace(fields[1]))
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("bad stat in header %q: %v", line, err)
+	}
+	tpduLen, err = strconv.Atoi(strings.TrimSpace(fields[len(fields)-1]))
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("bad length in header %q: %v", line, err)
+	}
+	return index, stat, tpduLen, nil
+}
+
+// splitQuoted splits a comma-separated field list, keeping quoted fields
+// (which may contain commas) intact.
+func splitQuoted(s string) []string {
+	var fields []string
+	var cur strings.Builder
+	inQuotes := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == ',' && !inQuotes:
+			fields = append(fields, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	fields = append(fields, cur.String())
+	return fields
+}
+
+// validatePDULine checks that the candidate PDU line is pure hex and its
+// byte count matches the header: total = 1 (SMSC length octet) + SMSC bytes
+// + <length> TPDU bytes. This is what proves the line really is the PDU
+// belonging to the preceding header.
+func validatePDULine(pduStr string, tpduLen int) error {
+	if pduStr == "" {
+		return fmt.Errorf("empty PDU line")
+	}
+	if len(pduStr)%2 != 0 {
+		return fmt.Errorf("odd hex length %d", len(pduStr))
+	}
+	data, err := hex.DecodeString(pduStr)
+	if err != nil {
+		return fmt.Errorf("not hex: %v", err)
+	}
+	smscLen := int(data[0])
+	expected := 1 + smscLen + tpduLen
+	if len(data) != expected {
+		return fmt.Errorf("PDU is %d bytes, header requires %d (SMSC %d + TPDU %d)",
+			len(data), expected, smscLen, tpduLen)
+	}
+	return nil
+}
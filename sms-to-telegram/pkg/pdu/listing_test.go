@@ -0,0 +1,37 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package pdu
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseListing(t *testing.T) {
+	entries, err := ParseListing([]string{
+		`+CMGL: 2,1,"",24`, pduAlphaSender,
+		`+CMGL: 7,3,"a,b",24`, pduAlphaSender,
+	})
+	if err != nil {
+		t.Fatalf("ParseListing() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Index != 2 || entries[0].Stat != 1 ||
+		entries[1].Index != 7 || entries[1].Stat != 3 || entries[1].PDU != pduAlphaSender {
+		t.Errorf("ParseListing() = %+v", entries)
+	}
+	if entries, err := ParseListing(nil); err != nil || len(entries) != 0 {
+		t.Errorf("empty listing = %v, %v; want no entries", entries, err)
+	}
+
+	for i, lines := range [][]string{
+		{"+CMGL: 2,1,,25", pduAlphaSender}, // length mismatch
+		{"+CMGL: 2,1,,24"},                 // header without PDU
+		{"+CMTI: \"SM\",3"},                // URC instead of a header
+		{"+CMGL: 2,\"REC READ\",,24", pduAlphaSender},
+	} {
+		if _, err := ParseListing(lines); !errors.Is(err, ErrListingCorrupted) {
+			t.Errorf("case %d: error = %v, want ErrListingCorrupted", i, err)
+		}
+	}
+}
@@ -1,13 +1,18 @@
 // Copyright © 2025 kogeler
 // SPDX-License-Identifier: Apache-2.0
 
-package main
+// Package pdu is the SMS codec of the gateway: it validates AT+CMGL listings
+// in PDU mode, decodes SMS-DELIVER PDUs (GSM 7-bit, 8-bit, UCS2, concatenated
+// parts), assembles multipart messages and encodes SMS-SUBMIT PDUs for
+// AT+CMGS. It knows nothing about the serial session or Telegram.
+package pdu
 
 import (
 	"encoding/hex"
 	"fmt"
 	"strings"
 	"time"
+	"unicode"
 	"unicode/utf16"
 )
 
@@ -24,15 +29,15 @@ func (e *NotDeliverError) Error() string {
 	return fmt.Sprintf("not an SMS-DELIVER message (MTI=%d)", e.MTI)
 }
 
-// MalformedPDUError: the PDU violates structural bounds and cannot be trusted.
-type MalformedPDUError struct {
+// MalformedError: the PDU violates structural bounds and cannot be trusted.
+type MalformedError struct {
 	Reason string
 }
 
-func (e *MalformedPDUError) Error() string { return "malformed PDU: " + e.Reason }
+func (e *MalformedError) Error() string { return "malformed PDU: " + e.Reason }
 
-func malformed(format string, args ...any) *MalformedPDUError {
-	return &MalformedPDUError{Reason: fmt.Sprintf(format, args...)}
+func malformed(format string, args ...any) *MalformedError {
+	return &MalformedError{Reason: fmt.Sprintf(format, args...)}
 }
 
 // UnsupportedEncodingError: a structurally valid SMS-DELIVER whose text cannot
@@ -40,18 +45,19 @@ func malformed(format string, args ...any) *MalformedPDUError {
 // decoded metadata (sender, timestamp) for a marked raw-PDU fallback.
 type UnsupportedEncodingError struct {
 	Reason string
-	Msg    *PDUMessage
+	Msg    *Message
 }
 
 func (e *UnsupportedEncodingError) Error() string { return "unsupported encoding: " + e.Reason }
 
-// PDUMessage represents a parsed SMS PDU
-type PDUMessage struct {
+// Message represents a parsed SMS PDU
+type Message struct {
 	SMSC      string    // Service center number
 	Sender    string    // Sender phone number or alphanumeric ID
 	Timestamp time.Time // Message timestamp (zero when SCTS was invalid)
 	Text      string    // Decoded message text
 	Alphabet  int       // 0 = GSM7, 1 = 8-bit, 2 = UCS2
+	Class     MessageClass
 	// Multipart info
 	IsMultipart  bool
 	RefKind      int // 8 or 16 (bit reference width), 0 when not multipart
@@ -60,6 +66,27 @@ type PDUMessage struct {
 	TotalParts   int // Total number of parts
 }
 
+// MessageClass is the message class a TP-DCS octet may set (3GPP TS 23.038).
+// The zero value is no class.
+type MessageClass int
+
+const (
+	NoClass MessageClass = iota
+	Class0               // flash SMS: displayed, not stored
+	Class1               // ME-specific
+	Class2               // SIM-specific
+	Class3               // TE-specific
+)
+
+// dcsClass maps a TP-DCS octet to its message class: the general and
+// auto-deletion groups with bit 4 set, and the data coding group.
+func dcsClass(dcs byte) MessageClass {
+	if dcs&0x80 == 0 && dcs&0x10 != 0 || dcs&0xF0 == 0xF0 {
+		return Class0 + MessageClass(dcs&0x03)
+	}
+	return NoClass
+}
+
 // dcsAlphabet maps a TP-DCS octet to an alphabet per 3GPP TS 23.038 coding
 // groups. Returns an error for compressed and reserved schemes.
 func dcsAlphabet(dcs byte) (int, error) {
@@ -89,10 +116,10 @@ func dcsAlphabet(dcs byte) (int, error) {
 	}
 }
 
-// ParsePDU parses a hex-encoded PDU string into a PDUMessage.
-// Non-nil errors are typed: *NotDeliverError, *MalformedPDUError,
+// Parse parses a hex-encoded PDU string into a Message.
+// Non-nil errors are typed: *NotDeliverError, *MalformedError,
 // *UnsupportedEncodingError.
-func ParsePDU(pduHex string) (*PDUMessage, error) {
+func Parse(pduHex string) (*Message, error) {
 	data, err := hex.DecodeString(strings.TrimSpace(pduHex))
 	if err != nil {
 		return nil, malformed("invalid hex: %v", err)
@@ -103,7 +130,7 @@ func ParsePDU(pduHex string) (*PDUMessage, error) {
 	}
 
 	pos := 0
-	msg := &PDUMessage{}
+	msg := &Message{}
 
 	// 1. Parse SMSC (Service Center Address)
 	smscLen := int(data[pos])
@@ -173,6 +200,7 @@ func ParsePDU(pduHex string) (*PDUMessage, error) {
 	}
 	dcs := data[pos]
 	pos++
+	msg.Class = dcsClass(dcs)
 
 	// 6. Service Centre Time Stamp (SCTS) - 7 bytes
 	if pos+7 > len(data) {
@@ -351,11 +379,13 @@ func decodeAddress(addrLen int, addrType byte, data []byte) string {
 		septets := addrLen * 4 / 7
 		return decodeGSM7Bit(data, septets, 0)
 	}
-	num := decodeBCDDigits(data, addrLen)
+	var b strings.Builder
 	if ton == 0x01 { // international
-		return "+" + num
+		b.Grow(1 + addrLen)
+		b.WriteByte('+')
 	}
-	return num
+	appendBCDDigits(&b, data, addrLen)
+	return b.String()
 }
 
 // bcdDigits maps BCD nibbles to characters per TS 23.040 (0xA-0xE are the
@@ -365,6 +395,15 @@ const bcdDigits = "0123456789*#abc"
 // decodeBCDDigits decodes up to digitCount swapped-nibble BCD digits.
 func decodeBCDDigits(data []byte, digitCount int) string {
 	var b strings.Builder
+	appendBCDDigits(&b, data, digitCount)
+	return b.String()
+}
+
+// appendBCDDigits writes up to digitCount swapped-nibble BCD digits to b.
+func appendBCDDigits(b *strings.Builder, data []byte, digitCount int) {
+	if n := min(digitCount, len(data)*2); n > 0 {
+		b.Grow(n)
+	}
 	count := 0
 	for _, octet := range data {
 		for _, nib := range [2]byte{octet & 0x0F, octet >> 4} {
@@ -378,17 +417,18 @@ func decodeBCDDigits(data []byte, digitCount int) string {
 			b.WriteByte(bcdDigits[nib])
 		}
 	}
-	return b.String()
 }
 
 // decodePhoneNumber decodes a phone number from swapped nibbles format
 // (used for the SMSC address, whose length is given in octets).
 func decodePhoneNumber(data []byte, international bool) string {
-	num := decodeBCDDigits(data, len(data)*2)
+	var b strings.Builder
 	if international {
-		return "+" + num
+		b.Grow(1 + len(data)*2)
+		b.WriteByte('+')
 	}
-	return num
+	appendBCDDigits(&b, data, len(data)*2)
+	return b.String()
 }
 
 // decodeSCTS decodes a Service Centre Time Stamp. Invalid BCD or out-of-range
@@ -466,80 +506,66 @@ var gsm7BitExtension = map[byte]rune{
 	0x65: '€',
 }
 
-// decodeGSM7Bit decodes GSM 7-bit packed data
+// decodeGSM7Bit decodes GSM 7-bit packed data: numChars septets after
+// fillBits padding bits (the UDH alignment). Septets are unpacked straight
+// into the output, which is sized for the common all-ASCII case.
 func decodeGSM7Bit(data []byte, numChars int, fillBits int) string {
 	if len(data) == 0 || numChars <= 0 {
 		return ""
 	}
 
-	// Unpack 7-bit characters from 8-bit bytes
-	var septets []byte
-	var currentByte int
-	var bitsInBuffer int
-
-	// Skip fill bits at start
-	bitPos := fillBits
-
-	for len(septets) < numChars && (bitPos/8) < len(data) {
-		byteIdx := bitPos / 8
-		bitOffset := bitPos % 8
-
-		// Get 7 bits starting at bitPos
-		currentByte = int(data[byteIdx]) >> bitOffset
-		bitsInBuffer = 8 - bitOffset
-
-		if bitsInBuffer < 7 && byteIdx+1 < len(data) {
-			currentByte |= int(data[byteIdx+1]) << bitsInBuffer
-		}
-
-		septet := byte(currentByte & 0x7F)
-		septets = append(septets, septet)
-		bitPos += 7
-	}
-
-	// Convert septets to string
-	var result []rune
+	var b strings.Builder
+	b.Grow(numChars)
 	escape := false
-	for _, s := range septets {
-		if s == 0x1B {
-			escape = true
-			continue
+	for n, bitPos := 0, fillBits; n < numChars && bitPos/8 < len(data); n, bitPos = n+1, bitPos+7 {
+		byteIdx, bitOffset := bitPos/8, bitPos%8
+		bits := int(data[byteIdx]) >> bitOffset
+		if bitOffset > 1 && byteIdx+1 < len(data) {
+			bits |= int(data[byteIdx+1]) << (8 - bitOffset)
 		}
+		septet := byte(bits & 0x7F)
 
-		if escape {
-			if r, ok := gsm7BitExtension[s]; ok {
-				result = append(result, r)
+		switch {
+		case septet == 0x1B:
+			escape = true
+		case escape:
+			if r, ok := gsm7BitExtension[septet]; ok {
+				b.WriteRune(r)
 			} else {
-				result = append(result, ' ')
+				b.WriteByte(' ')
 			}
 			escape = false
-		} else {
-			if int(s) < len(gsm7BitDefault) {
-				result = append(result, gsm7BitDefault[s])
-			} else {
-				result = append(result, '?')
-			}
+		default:
+			b.WriteRune(gsm7BitDefault[septet])
 		}
 	}
-
-	return string(result)
+	return b.String()
 }
 
-// decodeUCS2 decodes UCS-2 (UTF-16BE) encoded data
+// decodeUCS2 decodes UCS-2 (UTF-16BE) encoded data; surrogate pairs are
+// joined and lone surrogates become U+FFFD, as utf16.Decode does.
 func decodeUCS2(data []byte) string {
 	if len(data) < 2 {
 		return ""
 	}
 
-	// Convert bytes to uint16 (big-endian)
-	var u16 []uint16
+	var b strings.Builder
+	b.Grow(len(data)) // 2 bytes per code unit, at most 3 per rune in UTF-8
 	for i := 0; i+1 < len(data); i += 2 {
-		u16 = append(u16, uint16(data[i])<<8|uint16(data[i+1]))
+		r := rune(data[i])<<8 | rune(data[i+1])
+		if utf16.IsSurrogate(r) {
+			if i+3 < len(data) {
+				if pair := utf16.DecodeRune(r, rune(data[i+2])<<8|rune(data[i+3])); pair != unicode.ReplacementChar {
+					b.WriteRune(pair)
+					i += 2
+					continue
+				}
+			}
+			r = unicode.ReplacementChar
+		}
+		b.WriteRune(r)
 	}
-
-	// Decode UTF-16 to runes
-	runes := utf16.Decode(u16)
-	return string(runes)
+	return b.String()
 }
 
 // multipartKey identifies one logical concatenated message. Reference width,
@@ -556,7 +582,7 @@ type multipartKey struct {
 
 type multipartPart struct {
 	index int
-	msg   *PDUMessage
+	msg   *Message
 }
 
 type multipartGroup struct {
@@ -578,7 +604,7 @@ func NewMultipartCollector() *MultipartCollector {
 	}
 }
 
-func keyFor(msg *PDUMessage) multipartKey {
+func keyFor(msg *Message) multipartKey {
 	return multipartKey{
 		sender:   msg.Sender,
 		refKind:  msg.RefKind,
@@ -591,7 +617,7 @@ func keyFor(msg *PDUMessage) multipartKey {
 // Add adds a message part and returns the complete message plus all part SIM
 // indices once every part is present. Groups with conflicting duplicate parts
 // are never assembled (and never deleted here); stale cleanup resolves them.
-func (c *MultipartCollector) Add(index int, msg *PDUMessage) (*PDUMessage, []int) {
+func (c *MultipartCollector) Add(index int, msg *Message) (*Message, []int) {
 	if !msg.IsMultipart {
 		return msg, []int{index}
 	}
@@ -640,12 +666,13 @@ func (c *MultipartCollector) Add(index int, msg *PDUMessage) (*PDUMessage, []int
 
 	delete(c.groups, key)
 
-	return &PDUMessage{
+	return &Message{
 		Sender:       firstPart.msg.Sender,
 		Timestamp:    firstPart.msg.Timestamp,
 		Text:         fullText.String(),
 		SMSC:         firstPart.msg.SMSC,
 		Alphabet:     firstPart.msg.Alphabet,
+		Class:        firstPart.msg.Class,
 		IsMultipart:  true,
 		RefKind:      msg.RefKind,
 		MultipartRef: msg.MultipartRef,
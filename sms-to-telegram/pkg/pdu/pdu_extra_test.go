@@ -1,7 +1,7 @@
 // Copyright © 2025 kogeler
 // SPDX-License-Identifier: Apache-2.0
 
-package main
+package pdu
 
 import (
 	"errors"
@@ -25,10 +25,10 @@ const (
 	pduBadDCS     = "0791534874894370000C91534894847087" + "0088" + "52211121830580" + "0A" + "04220435044104420031"
 )
 
-func TestParsePDU_AlphanumericSender(t *testing.T) {
-	msg, err := ParsePDU(pduAlphaSender)
+func TestParse_AlphanumericSender(t *testing.T) {
+	msg, err := Parse(pduAlphaSender)
 	if err != nil {
-		t.Fatalf("ParsePDU() error = %v", err)
+		t.Fatalf("Parse() error = %v", err)
 	}
 	if msg.Sender != "Google" {
 		t.Errorf("Sender = %q, want Google", msg.Sender)
@@ -38,8 +38,8 @@ func TestParsePDU_AlphanumericSender(t *testing.T) {
 	}
 }
 
-func TestParsePDU_GSM7MultipartWithUDH(t *testing.T) {
-	part1, err := ParsePDU(pduGSM7Part1)
+func TestParse_GSM7MultipartWithUDH(t *testing.T) {
+	part1, err := Parse(pduGSM7Part1)
 	if err != nil {
 		t.Fatalf("part1 error = %v", err)
 	}
@@ -51,7 +51,7 @@ func TestParsePDU_GSM7MultipartWithUDH(t *testing.T) {
 		t.Errorf("part1 text = %q, want Hello (fill-bit decode)", part1.Text)
 	}
 
-	part2, err := ParsePDU(pduGSM7Part2)
+	part2, err := Parse(pduGSM7Part2)
 	if err != nil {
 		t.Fatalf("part2 error = %v", err)
 	}
@@ -75,9 +75,9 @@ func TestParsePDU_GSM7MultipartWithUDH(t *testing.T) {
 	}
 }
 
-func TestParsePDU_TypedErrors(t *testing.T) {
+func TestParse_TypedErrors(t *testing.T) {
 	t.Run("status report", func(t *testing.T) {
-		_, err := ParsePDU(pduStatusReport)
+		_, err := Parse(pduStatusReport)
 		var nd *NotDeliverError
 		if !errors.As(err, &nd) || nd.MTI != 2 {
 			t.Fatalf("error = %v, want NotDeliverError MTI=2", err)
@@ -85,23 +85,23 @@ func TestParsePDU_TypedErrors(t *testing.T) {
 	})
 
 	t.Run("odd UCS2 UDL", func(t *testing.T) {
-		_, err := ParsePDU(pduUCS2OddUDL)
-		var mf *MalformedPDUError
+		_, err := Parse(pduUCS2OddUDL)
+		var mf *MalformedError
 		if !errors.As(err, &mf) {
-			t.Fatalf("error = %v, want MalformedPDUError", err)
+			t.Fatalf("error = %v, want MalformedError", err)
 		}
 	})
 
 	t.Run("UDL beyond data", func(t *testing.T) {
-		_, err := ParsePDU(pduUCS2BigUDL)
-		var mf *MalformedPDUError
+		_, err := Parse(pduUCS2BigUDL)
+		var mf *MalformedError
 		if !errors.As(err, &mf) {
-			t.Fatalf("error = %v, want MalformedPDUError", err)
+			t.Fatalf("error = %v, want MalformedError", err)
 		}
 	})
 
 	t.Run("reserved DCS", func(t *testing.T) {
-		_, err := ParsePDU(pduBadDCS)
+		_, err := Parse(pduBadDCS)
 		var ue *UnsupportedEncodingError
 		if !errors.As(err, &ue) {
 			t.Fatalf("error = %v, want UnsupportedEncodingError", err)
@@ -112,10 +112,10 @@ func TestParsePDU_TypedErrors(t *testing.T) {
 	})
 
 	t.Run("invalid hex", func(t *testing.T) {
-		_, err := ParsePDU("ZZZZZZZZZZZZZZZZZZZZZZ")
-		var mf *MalformedPDUError
+		_, err := Parse("ZZZZZZZZZZZZZZZZZZZZZZ")
+		var mf *MalformedError
 		if !errors.As(err, &mf) {
-			t.Fatalf("error = %v, want MalformedPDUError", err)
+			t.Fatalf("error = %v, want MalformedError", err)
 		}
 	})
 }
@@ -150,6 +150,27 @@ func TestDCSAlphabet(t *testing.T) {
 	}
 }
 
+func TestDCSClass(t *testing.T) {
+	tests := []struct {
+		dcs  byte
+		want MessageClass
+	}{
+		{0x00, NoClass}, // GSM7, no class
+		{0x10, Class0},  // flash
+		{0x18, Class0},  // flash UCS2
+		{0x12, Class2},
+		{0x51, Class1}, // auto-deletion group
+		{0xC0, NoClass},
+		{0xF0, Class0}, // data coding group always has a class
+		{0xF7, Class3},
+	}
+	for _, tt := range tests {
+		if got := dcsClass(tt.dcs); got != tt.want {
+			t.Errorf("dcsClass(0x%02X) = %d, want %d", tt.dcs, got, tt.want)
+		}
+	}
+}
+
 func TestDecodeSCTSInvalid(t *testing.T) {
 	tests := []struct {
 		name string
@@ -196,8 +217,8 @@ func TestDecodeBCDDigitsExtension(t *testing.T) {
 
 func TestMultipartCollectorRefCollision(t *testing.T) {
 	collector := NewMultipartCollector()
-	base := func(total, part int) *PDUMessage {
-		return &PDUMessage{
+	base := func(total, part int) *Message {
+		return &Message{
 			Sender: "+111", IsMultipart: true, RefKind: 8,
 			MultipartRef: 5, TotalParts: total, PartNumber: part,
 			Text: "x", Timestamp: time.Now(),
@@ -222,8 +243,8 @@ func TestMultipartCollectorRefCollision(t *testing.T) {
 
 func TestMultipartCollectorIdenticalDuplicate(t *testing.T) {
 	collector := NewMultipartCollector()
-	part := func(idx, num int, text string) (int, *PDUMessage) {
-		return idx, &PDUMessage{
+	part := func(idx, num int, text string) (int, *Message) {
+		return idx, &Message{
 			Sender: "+111", IsMultipart: true, RefKind: 8,
 			MultipartRef: 7, TotalParts: 2, PartNumber: num, Text: text,
 		}
@@ -245,8 +266,8 @@ func TestMultipartCollectorIdenticalDuplicate(t *testing.T) {
 
 func TestMultipartCollectorConflictingDuplicate(t *testing.T) {
 	collector := NewMultipartCollector()
-	part := func(idx, num int, text string) (int, *PDUMessage) {
-		return idx, &PDUMessage{
+	part := func(idx, num int, text string) (int, *Message) {
+		return idx, &Message{
 			Sender: "+111", IsMultipart: true, RefKind: 8,
 			MultipartRef: 7, TotalParts: 2, PartNumber: num, Text: text,
 			Timestamp: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
@@ -271,7 +292,7 @@ func TestMultipartCollectorConflictingDuplicate(t *testing.T) {
 
 func TestMultipartCollectorRelistedSlot(t *testing.T) {
 	collector := NewMultipartCollector()
-	msg := &PDUMessage{
+	msg := &Message{
 		Sender: "+111", IsMultipart: true, RefKind: 8,
 		MultipartRef: 7, TotalParts: 2, PartNumber: 1, Text: "A",
 	}
@@ -285,7 +306,7 @@ func TestMultipartCollectorRelistedSlot(t *testing.T) {
 	}
 }
 
-func FuzzParsePDU(f *testing.F) {
+func FuzzParse(f *testing.F) {
 	f.Add(pduUCS2)
 	f.Add(pduAlphaSender)
 	f.Add(pduGSM7Part1)
@@ -296,7 +317,7 @@ func FuzzParsePDU(f *testing.F) {
 	f.Add("ZZ")
 
 	f.Fuzz(func(t *testing.T, pduHex string) {
-		msg, err := ParsePDU(pduHex) // must never panic
+		msg, err := Parse(pduHex) // must never panic
 		if err == nil {
 			if msg == nil {
 				t.Fatal("nil message without error")
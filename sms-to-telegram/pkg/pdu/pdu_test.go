@@ -1,9 +1,10 @@
 // Copyright © 2025 kogeler
 // SPDX-License-Identifier: Apache-2.0
 
-package main
+package pdu
 
 import (
+	"strings"
 	"testing"
 	"time"
 )
@@ -162,6 +163,14 @@ func TestDecodeUCS2(t *testing.T) {
 			},
 			want: "😀",
 		},
+		{
+			name: "lone surrogates",
+			data: []byte{
+				0xD8, 0x3D, 0x00, 0x41, // high surrogate, then A
+				0xDE, 0x00, // low surrogate
+			},
+			want: "\uFFFDA\uFFFD",
+		},
 	}
 
 	for _, tt := range tests {
@@ -174,7 +183,7 @@ func TestDecodeUCS2(t *testing.T) {
 	}
 }
 
-func TestParsePDU(t *testing.T) {
+func TestParse(t *testing.T) {
 	tests := []struct {
 		name        string
 		pduHex      string
@@ -210,25 +219,25 @@ func TestParsePDU(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			msg, err := ParsePDU(tt.pduHex)
+			msg, err := Parse(tt.pduHex)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("ParsePDU() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if err != nil {
 				return
 			}
 			if tt.wantSender != "" && msg.Sender != tt.wantSender {
-				t.Errorf("ParsePDU() sender = %q, want %q", msg.Sender, tt.wantSender)
+				t.Errorf("Parse() sender = %q, want %q", msg.Sender, tt.wantSender)
 			}
 			if tt.wantSMSC != "" && msg.SMSC != tt.wantSMSC {
-				t.Errorf("ParsePDU() SMSC = %q, want %q", msg.SMSC, tt.wantSMSC)
+				t.Errorf("Parse() SMSC = %q, want %q", msg.SMSC, tt.wantSMSC)
 			}
 			if tt.wantText != "" && msg.Text != tt.wantText {
-				t.Errorf("ParsePDU() text = %q, want %q", msg.Text, tt.wantText)
+				t.Errorf("Parse() text = %q, want %q", msg.Text, tt.wantText)
 			}
 			if tt.isMultipart && !msg.IsMultipart {
-				t.Errorf("ParsePDU() IsMultipart = false, want true")
+				t.Errorf("Parse() IsMultipart = false, want true")
 			}
 		})
 	}
@@ -240,7 +249,7 @@ func TestMultipartCollector(t *testing.T) {
 	testTime := time.Date(2025, 12, 11, 18, 21, 49, 0, time.UTC)
 
 	// Simulate 3-part message with SMSC
-	part1 := &PDUMessage{
+	part1 := &Message{
 		Sender:       "+1234567890",
 		Timestamp:    testTime,
 		Text:         "Part 1 text. ",
@@ -251,7 +260,7 @@ func TestMultipartCollector(t *testing.T) {
 		TotalParts:   3,
 	}
 
-	part2 := &PDUMessage{
+	part2 := &Message{
 		Sender:       "+1234567890",
 		Timestamp:    testTime,
 		Text:         "Part 2 text. ",
@@ -262,7 +271,7 @@ func TestMultipartCollector(t *testing.T) {
 		TotalParts:   3,
 	}
 
-	part3 := &PDUMessage{
+	part3 := &Message{
 		Sender:       "+1234567890",
 		Timestamp:    testTime,
 		Text:         "Part 3 text.",
@@ -333,7 +342,7 @@ func TestMultipartCollectorDifferentSenders(t *testing.T) {
 	collector := NewMultipartCollector()
 
 	// Two different senders with same ref number
-	msg1 := &PDUMessage{
+	msg1 := &Message{
 		Sender:       "+1111111111",
 		Text:         "From sender 1 part 1",
 		IsMultipart:  true,
@@ -342,7 +351,7 @@ func TestMultipartCollectorDifferentSenders(t *testing.T) {
 		TotalParts:   2,
 	}
 
-	msg2 := &PDUMessage{
+	msg2 := &Message{
 		Sender:       "+2222222222",
 		Text:         "From sender 2 part 1",
 		IsMultipart:  true,
@@ -364,7 +373,7 @@ func TestMultipartCollectorSinglePart(t *testing.T) {
 	collector := NewMultipartCollector()
 
 	// Non-multipart message should be returned immediately
-	msg := &PDUMessage{
+	msg := &Message{
 		Sender:      "+1234567890",
 		Text:        "Single message",
 		IsMultipart: false,
@@ -386,7 +395,7 @@ func TestMultipartCollectorStaleIndices(t *testing.T) {
 	collector := NewMultipartCollector()
 	now := time.Now()
 
-	oldPart := &PDUMessage{
+	oldPart := &Message{
 		Sender:       "+1234567890",
 		Timestamp:    now.Add(-2 * time.Hour),
 		Text:         "Old part",
@@ -395,7 +404,7 @@ func TestMultipartCollectorStaleIndices(t *testing.T) {
 		PartNumber:   1,
 		TotalParts:   2,
 	}
-	newPart := &PDUMessage{
+	newPart := &Message{
 		Sender:       "+0987654321",
 		Timestamp:    now.Add(-30 * time.Minute),
 		Text:         "New part",
@@ -551,3 +560,37 @@ func TestGSM7BitExtension(t *testing.T) {
 		}
 	}
 }
+
+// Benchmarks for bulk re-decoding (archives of thousands of PDUs):
+// go test -run '^$' -bench 'Decode|Parse' -benchmem
+
+func BenchmarkDecodeGSM7Bit(b *testing.B) {
+	// 160 septets, the longest single-part GSM 7-bit SMS.
+	septets, err := gsm7Septets(strings.Repeat("Hello, world! ", 12)[:160])
+	if err != nil {
+		b.Fatal(err)
+	}
+	ud := packGSM7(septets, 0)
+	b.ReportAllocs()
+	for b.Loop() {
+		decodeGSM7Bit(ud, len(septets), 0)
+	}
+}
+
+func BenchmarkDecodeUCS2(b *testing.B) {
+	// 70 UCS2 code units, the longest single-part UCS2 SMS.
+	ud := encodeUCS2(strings.Repeat("Привет, мир! ", 6))[:140]
+	b.ReportAllocs()
+	for b.Loop() {
+		decodeUCS2(ud)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := Parse(pduGSM7Part1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package pdu
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// SMS-SUBMIT PDU encoding for outgoing SMS (AT+CMGS in PDU mode), the
+// inverse of the SMS-DELIVER parser in pdu.go.
+
+// gsm7Reverse maps runes back to GSM 7-bit default-alphabet septets.
+var gsm7Reverse = func() map[rune]byte {
+	m := make(map[rune]byte, len(gsm7BitDefault))
+	for i, r := range gsm7BitDefault {
+		if r == '\x1b' {
+			continue
+		}
+		m[r] = byte(i)
+	}
+	return m
+}()
+
+// gsm7ReverseExt maps extension-table runes to their escaped septet code.
+var gsm7ReverseExt = func() map[rune]byte {
+	m := make(map[rune]byte, len(gsm7BitExtension))
+	for code, r := range gsm7BitExtension {
+		m[r] = code
+	}
+	return m
+}()
+
+// gsm7Septets converts text to septet values; extension-table characters
+// (€ [ ] { } ~ \ | ^ \f) become 0x1B escape pairs and count as two septets.
+func gsm7Septets(s string) ([]byte, error) {
+	septets := make([]byte, 0, len(s))
+	for _, r := range s {
+		if v, ok := gsm7Reverse[r]; ok {
+			septets = append(septets, v)
+			continue
+		}
+		if code, ok := gsm7ReverseExt[r]; ok {
+			septets = append(septets, 0x1B, code)
+			continue
+		}
+		return nil, fmt.Errorf("rune %q not in GSM 7-bit alphabet", r)
+	}
+	return septets, nil
+}
+
+// packGSM7 packs septets LSB-first with the given number of leading fill bits
+// (the exact inverse of decodeGSM7Bit).
+func packGSM7(septets []byte, fillBits int) []byte {
+	totalBits := fillBits + 7*len(septets)
+	out := make([]byte, (totalBits+7)/8)
+	bitPos := fillBits
+	for _, s := range septets {
+		idx, off := bitPos/8, bitPos%8
+		v := uint16(s) << off
+		out[idx] |= byte(v)
+		if off > 1 && idx+1 < len(out) {
+			out[idx+1] |= byte(v >> 8)
+		}
+		bitPos += 7
+	}
+	return out
+}
+
+// encodeUCS2 renders text as UTF-16BE bytes.
+func encodeUCS2(s string) []byte {
+	u16 := utf16.Encode([]rune(s))
+	out := make([]byte, 0, len(u16)*2)
+	for _, u := range u16 {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return out
+}
+
+// encodeBCDNumber renders digits as swapped-nibble BCD with F padding.
+func encodeBCDNumber(digits string) ([]byte, error) {
+	out := make([]byte, 0, (len(digits)+1)/2)
+	for i := 0; i < len(digits); i += 2 {
+		lo := digits[i]
+		if lo < '0' || lo > '9' {
+			return nil, fmt.Errorf("non-digit %q in number", lo)
+		}
+		hi := byte(0x0F)
+		if i+1 < len(digits) {
+			c := digits[i+1]
+			if c < '0' || c > '9' {
+				return nil, fmt.Errorf("non-digit %q in number", c)
+			}
+			hi = c - '0'
+		}
+		out = append(out, hi<<4|(lo-'0'))
+	}
+	return out, nil
+}
+
+// Concat describes one part of a concatenated message (8-bit reference).
+type Concat struct {
+	Ref, Total, Part int
+}
+
+// EncodeSubmit builds a complete SMS-SUBMIT PDU (with a zero-length SMSC
+// field: the SIM's default SMSC is used) and returns the hex string plus the
+// TPDU length for AT+CMGS=<n>. A leading "+" marks an international number.
+func EncodeSubmit(dest, body string, ucs2 bool, concat *Concat) (string, int, error) {
+	digits := strings.TrimPrefix(dest, "+")
+	if digits == "" {
+		return "", 0, fmt.Errorf("empty destination")
+	}
+	daBytes, err := encodeBCDNumber(digits)
+	if err != nil {
+		return "", 0, err
+	}
+
+	firstOctet := byte(0x01) // SMS-SUBMIT, no validity period
+	var udh []byte
+	if concat != nil {
+		firstOctet |= 0x40 // TP-UDHI
+		udh = []byte{0x05, 0x00, 0x03, byte(concat.Ref), byte(concat.Total), byte(concat.Part)}
+	}
+
+	var udl byte
+	var ud []byte
+	if ucs2 {
+		payload := encodeUCS2(body)
+		udl = byte(len(udh) + len(payload))
+		ud = append(udh, payload...)
+	} else {
+		septets, err := gsm7Septets(body)
+		if err != nil {
+			return "", 0, err
+		}
+		fillBits := 0
+		udhSeptets := 0
+		if len(udh) > 0 {
+			udhSeptets = (len(udh)*8 + 6) / 7
+			fillBits = (7 - (len(udh)*8)%7) % 7
+		}
+		udl = byte(udhSeptets + len(septets))
+		ud = append(udh, packGSM7(septets, fillBits)...)
+	}
+
+	toa := byte(0x81) // national / unknown
+	if strings.HasPrefix(dest, "+") {
+		toa = 0x91 // international
+	}
+	tpdu := []byte{firstOctet, 0x00 /* TP-MR: modem assigns */}
+	tpdu = append(tpdu, byte(len(digits)), toa)
+	tpdu = append(tpdu, daBytes...)
+	tpdu = append(tpdu, 0x00 /* PID */)
+	if ucs2 {
+		tpdu = append(tpdu, 0x08)
+	} else {
+		tpdu = append(tpdu, 0x00)
+	}
+	tpdu = append(tpdu, udl)
+	tpdu = append(tpdu, ud...)
+
+	return "00" + strings.ToUpper(hex.EncodeToString(tpdu)), len(tpdu), nil
+}
+
+// EncodeDeliver builds an SMS-DELIVER PDU exactly as a modem would list it
+// (zero-length SMSC, fixed SCTS), for tests and replays that must go through
+// Parse like a received SMS.
+func EncodeDeliver(sender, body string, ucs2 bool, concat *Concat) (string, error) {
+	digits := strings.TrimPrefix(sender, "+")
+	oaBytes, err := encodeBCDNumber(digits)
+	if err != nil {
+		return "", err
+	}
+
+	firstOctet := byte(0x04) // SMS-DELIVER, no more messages
+	var udh []byte
+	if concat != nil {
+		firstOctet |= 0x40
+		udh = []byte{0x05, 0x00, 0x03, byte(concat.Ref), byte(concat.Total), byte(concat.Part)}
+	}
+
+	var udl byte
+	var ud []byte
+	if ucs2 {
+		payload := encodeUCS2(body)
+		udl = byte(len(udh) + len(payload))
+		ud = append(udh, payload...)
+	} else {
+		septets, err := gsm7Septets(body)
+		if err != nil {
+			return "", err
+		}
+		fillBits, udhSeptets := 0, 0
+		if len(udh) > 0 {
+			udhSeptets = (len(udh)*8 + 6) / 7
+			fillBits = (7 - (len(udh)*8)%7) % 7
+		}
+		udl = byte(udhSeptets + len(septets))
+		ud = append(udh, packGSM7(septets, fillBits)...)
+	}
+
+	tpdu := []byte{firstOctet, byte(len(digits)), 0x91}
+	tpdu = append(tpdu, oaBytes...)
+	tpdu = append(tpdu, 0x00) // PID
+	if ucs2 {
+		tpdu = append(tpdu, 0x08)
+	} else {
+		tpdu = append(tpdu, 0x00)
+	}
+	tpdu = append(tpdu, 0x52, 0x21, 0x11, 0x21, 0x83, 0x05, 0x80) // SCTS
+	tpdu = append(tpdu, udl)
+	tpdu = append(tpdu, ud...)
+
+	return "00" + strings.ToUpper(hex.EncodeToString(tpdu)), nil
+}
+
+// Single-part and per-part (with the 6-byte concatenation UDH) capacities.
+const (
+	gsm7SingleSeptets = 160
+	gsm7PartSeptets   = 153
+	ucs2SingleUnits   = 70
+	ucs2PartUnits     = 67
+	maxSubmitParts    = 255
+)
+
+// SplitForSubmit picks the encoding (GSM 7-bit when every rune is in the
+// default alphabet or its extension table, UCS2 otherwise) and splits text
+// into parts that fit one PDU each. Escape pairs and UTF-16 surrogate pairs
+// are never split across parts.
+func SplitForSubmit(text string) (parts []string, ucs2 bool, err error) {
+	if text == "" {
+		return nil, false, fmt.Errorf("empty text")
+	}
+	_, gsmErr := gsm7Septets(text)
+	ucs2 = gsmErr != nil
+
+	runeSize := func(r rune) int {
+		if ucs2 {
+			return len(utf16.Encode([]rune{r}))
+		}
+		if _, ext := gsm7ReverseExt[r]; ext {
+			return 2
+		}
+		return 1
+	}
+	total := 0
+	for _, r := range text {
+		total += runeSize(r)
+	}
+	single, perPart := gsm7SingleSeptets, gsm7PartSeptets
+	if ucs2 {
+		single, perPart = ucs2SingleUnits, ucs2PartUnits
+	}
+	if total <= single {
+		return []string{text}, ucs2, nil
+	}
+
+	var cur strings.Builder
+	size := 0
+	for _, r := range text {
+		n := runeSize(r)
+		if size+n > perPart {
+			parts = append(parts, cur.String())
+			cur.Reset()
+			size = 0
+		}
+		cur.WriteRune(r)
+		size += n
+	}
+	parts = append(parts, cur.String())
+	if len(parts) > maxSubmitParts {
+		return nil, false, fmt.Errorf("text needs %d parts, more than %d", len(parts), maxSubmitParts)
+	}
+	return parts, ucs2, nil
+}
@@ -0,0 +1,283 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package pdu
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestPackGSM7_KnownVectors(t *testing.T) {
+	septets, err := gsm7Septets("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(packGSM7(septets, 0)); got != "c8329bfd06" {
+		t.Errorf("packGSM7(Hello, 0) = %s, want c8329bfd06", got)
+	}
+	// One fill bit — the layout produced by a 6-byte concat UDH.
+	if got := hex.EncodeToString(packGSM7(septets, 1)); got != "906536fb0d" {
+		t.Errorf("packGSM7(Hello, 1) = %s, want 906536fb0d", got)
+	}
+}
+
+func TestPackGSM7_RoundTrip(t *testing.T) {
+	texts := []string{"Hello", "LIVE-12345 test body", "a", "0123456789 :;<=>?"}
+	for _, text := range texts {
+		for fill := 0; fill < 7; fill++ {
+			septets, err := gsm7Septets(text)
+			if err != nil {
+				t.Fatalf("gsm7Septets(%q): %v", text, err)
+			}
+			packed := packGSM7(septets, fill)
+			if got := decodeGSM7Bit(packed, len(septets), fill); got != text {
+				t.Errorf("round trip %q fill=%d → %q", text, fill, got)
+			}
+		}
+	}
+}
+
+func TestEncodeUCS2_RoundTrip(t *testing.T) {
+	for _, text := range []string{"Привет", "Тест 123", "emoji 😀 ok"} {
+		if got := decodeUCS2(encodeUCS2(text)); got != text {
+			t.Errorf("UCS2 round trip %q → %q", text, got)
+		}
+	}
+}
+
+func TestEncodeBCDNumber_RoundTrip(t *testing.T) {
+	for _, num := range []string{"79991234567", "1234567890", "123"} {
+		encoded, err := encodeBCDNumber(num)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := decodeBCDDigits(encoded, len(num)); got != num {
+			t.Errorf("BCD round trip %q → %q", num, got)
+		}
+	}
+	if _, err := encodeBCDNumber("12a4"); err == nil {
+		t.Error("non-digit must be rejected")
+	}
+}
+
+func TestEncodeSubmit_Structure(t *testing.T) {
+	pduHex, tpduLen, err := EncodeSubmit("+79991234567", "Hello", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := hex.DecodeString(pduHex)
+	if err != nil {
+		t.Fatalf("not hex: %v", err)
+	}
+	if data[0] != 0x00 {
+		t.Error("SMSC length must be 0 (SIM default)")
+	}
+	if tpduLen != len(data)-1 {
+		t.Errorf("tpduLen = %d, want %d", tpduLen, len(data)-1)
+	}
+	if data[1] != 0x01 {
+		t.Errorf("first octet = 0x%02X, want 0x01 (SUBMIT)", data[1])
+	}
+	if data[3] != 11 || data[4] != 0x91 {
+		t.Errorf("DA header = %d/0x%02X, want 11/0x91", data[3], data[4])
+	}
+	// UD: last 5 bytes are packed "Hello".
+	if got := hex.EncodeToString(data[len(data)-5:]); got != "c8329bfd06" {
+		t.Errorf("UD = %s, want packed Hello", got)
+	}
+}
+
+func TestEncodeSubmit_MultipartUDH(t *testing.T) {
+	pduHex, _, err := EncodeSubmit("+79991234567", "Hello", false, &Concat{Ref: 42, Total: 3, Part: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := hex.DecodeString(pduHex)
+	if data[1]&0x40 == 0 {
+		t.Fatal("TP-UDHI must be set for multipart")
+	}
+	// Locate the UDH: it follows firstOctet, MR, DA len, DA type, 6 DA bytes,
+	// PID, DCS, UDL → offset 1+2+2+6+2+1 = 14.
+	udh := data[15 : 15+5]
+	info := parseUDHInfo(udh)
+	if info.malformed || !info.multipart || info.ref != 42 || info.total != 3 || info.part != 2 {
+		t.Errorf("UDH round trip failed: %+v (udh=%x)", info, udh)
+	}
+	// And the text after the UDH still decodes with one fill bit.
+	if got := decodeGSM7Bit(data[20:], 5, 1); got != "Hello" {
+		t.Errorf("body after UDH = %q, want Hello", got)
+	}
+}
+
+func TestEncodeSubmit_UCS2(t *testing.T) {
+	body := "Тест1"
+	pduHex, _, err := EncodeSubmit("+79991234567", body, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := hex.DecodeString(pduHex)
+	// DCS at offset 12 (after SMSC len, first octet, MR, DA hdr+6, PID).
+	if data[12] != 0x08 {
+		t.Errorf("DCS = 0x%02X, want 0x08 (UCS2)", data[12])
+	}
+	udl := int(data[13])
+	if got := decodeUCS2(data[14 : 14+udl]); got != body {
+		t.Errorf("UCS2 body round trip → %q", got)
+	}
+}
+
+func TestSplitForSubmit(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		wantParts int
+		wantUCS2  bool
+	}{
+		{"gsm7 single max", strings.Repeat("a", 160), 1, false},
+		{"gsm7 split", strings.Repeat("a", 161), 2, false},
+		{"gsm7 escapes count double", strings.Repeat("€", 80), 1, false},
+		{"gsm7 escapes split", strings.Repeat("€", 81), 2, false},
+		{"ucs2 single max", strings.Repeat("Ж", 70), 1, true},
+		{"ucs2 split", strings.Repeat("Ж", 71), 2, true},
+		{"ucs2 surrogates", strings.Repeat("😀", 35), 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, ucs2, err := SplitForSubmit(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(parts) != tt.wantParts || ucs2 != tt.wantUCS2 {
+				t.Errorf("SplitForSubmit() = %d parts, ucs2 %v; want %d, %v", len(parts), ucs2, tt.wantParts, tt.wantUCS2)
+			}
+			if strings.Join(parts, "") != tt.text {
+				t.Error("parts do not reassemble into the text")
+			}
+		})
+	}
+
+	// An escape pair straddling the 153-septet boundary moves whole.
+	parts, _, _ := SplitForSubmit(strings.Repeat("a", 152) + "€" + strings.Repeat("a", 10))
+	if len(parts) != 2 || len(parts[0]) != 152 {
+		t.Errorf("escape pair split: first part has %d bytes, want 152", len(parts[0]))
+	}
+	if _, _, err := SplitForSubmit(""); err == nil {
+		t.Error("empty text should fail")
+	}
+}
+
+// deliverRoundTrip encodes a DELIVER PDU and parses it back with the
+// production parser, asserting byte-exact text.
+func deliverRoundTrip(t *testing.T, body string, ucs2 bool, concat *Concat) *Message {
+	t.Helper()
+	// Documentation-range number (RFC-style, never assigned to a subscriber).
+	pduHex, err := EncodeDeliver("+15550001234", body, ucs2, concat)
+	if err != nil {
+		t.Fatalf("EncodeDeliver(%q): %v", body, err)
+	}
+	msg, err := Parse(pduHex)
+	if err != nil {
+		t.Fatalf("Parse(%q body): %v", body, err)
+	}
+	if msg.Text != body {
+		t.Errorf("round trip %q -> %q", body, msg.Text)
+	}
+	return msg
+}
+
+// GSM7 escape sequences (0x1B pairs) through the full parser - previously the
+// only untested decoder path.
+func TestParse_GSM7EscapeSequences(t *testing.T) {
+	bodies := []string{
+		"price is 100€",
+		"a[b]c{d}e~f|g\\h^i",
+		"€",
+		"[[[]]]",
+	}
+	for _, body := range bodies {
+		deliverRoundTrip(t, body, false, nil)
+	}
+}
+
+// '@' is septet 0x00 and must survive anywhere, including the very end
+// (where naive decoders confuse it with padding).
+func TestParse_GSM7AtSign(t *testing.T) {
+	for _, body := range []string{"@", "user@host", "ends with @", "@@@@@@@"} {
+		deliverRoundTrip(t, body, false, nil)
+	}
+}
+
+// National characters of the GSM7 default alphabet (no escapes involved).
+func TestParse_GSM7NationalChars(t *testing.T) {
+	deliverRoundTrip(t, "ä ö å Ä Ö Å é ü ñ ß à è", false, nil)
+}
+
+// Boundary lengths: 160 septets in a single part, 153 + 7-septet UDH in a
+// concat part (both give UDL=160), 70 UCS2 chars.
+func TestParse_BoundaryLengths(t *testing.T) {
+	body160 := strings.Repeat("A", 160)
+	msg := deliverRoundTrip(t, body160, false, nil)
+	if len(msg.Text) != 160 {
+		t.Errorf("single-part length = %d, want 160", len(msg.Text))
+	}
+
+	body153 := strings.Repeat("B", 153)
+	msg = deliverRoundTrip(t, body153, false, &Concat{Ref: 1, Total: 2, Part: 1})
+	if !msg.IsMultipart || len(msg.Text) != 153 {
+		t.Errorf("concat part: multipart=%v len=%d, want true/153", msg.IsMultipart, len(msg.Text))
+	}
+
+	body70 := strings.Repeat("ЖА", 35) // 70 UCS2 code units
+	deliverRoundTrip(t, body70, true, nil)
+}
+
+// Empty user data (UDL=0) must parse to an empty text, not an error.
+func TestParse_EmptyBody(t *testing.T) {
+	deliverRoundTrip(t, "", false, nil)
+	deliverRoundTrip(t, "", true, nil)
+}
+
+// A dangling escape septet at the end of the stream is dropped silently -
+// documented current behavior (the spec suggests rendering a space; losing
+// the lone escape is acceptable, corrupting the preceding text is not).
+func TestDecodeGSM7Bit_TrailingEscape(t *testing.T) {
+	septets, err := gsm7Septets("ab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed := packGSM7(append(septets, 0x1B), 0)
+	if got := decodeGSM7Bit(packed, 3, 0); got != "ab" {
+		t.Errorf("trailing escape decode = %q, want %q (escape dropped)", got, "ab")
+	}
+}
+
+// Escape pairs survive packing at every fill-bit offset.
+func TestPackGSM7_EscapeRoundTrip(t *testing.T) {
+	for _, text := range []string{"€uro", "x[y]z", "a|b~c", "^start", "end€"} {
+		septets, err := gsm7Septets(text)
+		if err != nil {
+			t.Fatalf("gsm7Septets(%q): %v", text, err)
+		}
+		for fill := 0; fill < 7; fill++ {
+			if got := decodeGSM7Bit(packGSM7(septets, fill), len(septets), fill); got != text {
+				t.Errorf("escape round trip %q fill=%d -> %q", text, fill, got)
+			}
+		}
+	}
+}
+
+// Non-Latin scripts through UCS2: RTL (Arabic, Hebrew), CJK, mixed.
+func TestParse_UCS2Scripts(t *testing.T) {
+	bodies := []string{
+		"مرحبا بالعالم",
+		"שלום עולם",
+		"你好，世界",
+		"日本語テスト",
+		"mixed: кириллица مرحبا 你好 äöå",
+	}
+	for _, body := range bodies {
+		deliverRoundTrip(t, body, true, nil)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package pdu
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TextEntry is one strictly validated entry of a text-mode listing.
+type TextEntry struct {
+	Index int
+	// Stat is the storage status, numbered as in ListEntry.
+	Stat int
+	// StatusReport: the entry is a delivery receipt; it has no sender or
+	// text.
+	StatusReport bool
+	Sender       string
+	Timestamp    time.Time // zero if the modem sent none or garbage
+	Text         string
+}
+
+// textStats maps the text-mode storage status to the PDU-mode number.
+var textStats = map[string]int{
+	"REC UNREAD": 0,
+	"REC READ":   1,
+	"STO UNSENT": 2,
+	"STO SENT":   3,
+}
+
+// ParseTextListing validates an AT+CMGL response in text mode. It only
+// accepts what makes the framing checkable: the UCS2 TE character set, so
+// every body is one line of hex, and AT+CSDH=1, so every header carries the
+// body length the line must match. As with ParseListing any inconsistency
+// fails the whole listing.
+//
+// Text mode hides the user data header: multipart parts are listed as
+// separate messages, and 8-bit data is decoded as if it were UCS2.
+func ParseTextListing(lines []string) ([]TextEntry, error) {
+	var entries []TextEntry
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		rest, ok := strings.CutPrefix(line, "+CMGL:")
+		if !ok {
+			return nil, fmt.Errorf("%w: unexpected line %q", ErrListingCorrupted, line)
+		}
+		fields := splitQuoted(strings.TrimSpace(rest))
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%w: header %q has %d fields, want >= 3", ErrListingCorrupted, line, len(fields))
+		}
+		index, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad index in header %q: %v", ErrListingCorrupted, line, err)
+		}
+		stat, ok := textStats[DecodeUCS2Hex(strings.TrimSpace(fields[1]))]
+		if !ok {
+			return nil, fmt.Errorf("%w: bad stat in header %q", ErrListingCorrupted, line)
+		}
+
+		// A status report lists <fo>,<mr>,[<ra>],[<tora>],<scts>,<dt>,<st>
+		// and no body line.
+		if _, err := strconv.Atoi(strings.TrimSpace(fields[2])); err == nil && len(fields) == 9 {
+			entries = append(entries, TextEntry{Index: index, Stat: stat, StatusReport: true})
+			continue
+		}
+
+		// <index>,<stat>,<oa/da>,[<alpha>],[<scts>],<tooa/toda>,<length>
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("%w: header %q has %d fields, want 7 (AT+CSDH=1)", ErrListingCorrupted, line, len(fields))
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(fields[6]))
+		if err != nil || length < 0 {
+			return nil, fmt.Errorf("%w: bad length in header %q", ErrListingCorrupted, line)
+		}
+		entry := TextEntry{
+			Index:     index,
+			Stat:      stat,
+			Sender:    DecodeUCS2Hex(fields[2]),
+			Timestamp: parseTextTimestamp(DecodeUCS2Hex(fields[4])),
+		}
+
+		// The AT session drops empty lines: an empty message has none.
+		if length > 0 {
+			if i+1 >= len(lines) {
+				return nil, fmt.Errorf("%w: header %q without text line", ErrListingCorrupted, line)
+			}
+			i++
+			body := strings.TrimSpace(lines[i])
+			if err := validateTextLine(body, length); err != nil {
+				return nil, fmt.Errorf("%w: index %d: %v", ErrListingCorrupted, index, err)
+			}
+			entry.Text = DecodeUCS2Hex(body)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// validateTextLine checks that the candidate text line is UCS2 hex of the
+// length in the header, which counts characters for GSM 7-bit messages and
+// octets for UCS2 ones.
+func validateTextLine(body string, length int) error {
+	if len(body)%4 != 0 {
+		return fmt.Errorf("hex length %d is not whole UCS2 characters", len(body))
+	}
+	if _, err := hex.DecodeString(body); err != nil {
+		return fmt.Errorf("not hex: %v", err)
+	}
+	if chars := len(body) / 4; chars != length && 2*chars != length {
+		return fmt.Errorf("text is %d characters, header length %d", chars, length)
+	}
+	return nil
+}
+
+// parseTextTimestamp parses a text-mode "yy/MM/dd,hh:mm:ss±zz" timestamp
+// (zone in quarter hours); the zero time if it is not one.
+func parseTextTimestamp(s string) time.Time {
+	if len(s) != 20 || (s[17] != '+' && s[17] != '-') {
+		return time.Time{}
+	}
+	quarters, err := strconv.Atoi(s[18:])
+	if err != nil {
+		return time.Time{}
+	}
+	offset := quarters * 15 * 60
+	if s[17] == '-' {
+		offset = -offset
+	}
+	t, err := time.ParseInLocation("06/01/02,15:04:05", s[:17], time.FixedZone("", offset))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// DecodeUCS2Hex decodes a string field a modem sent in the UCS2 TE
+// character set ("004F0032" for "O2"). A field that is not whole hex UCS2
+// characters is returned as is: some firmwares leave short fields such as
+// storage names unencoded.
+func DecodeUCS2Hex(s string) string {
+	if s == "" || len(s)%4 != 0 {
+		return s
+	}
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return s
+	}
+	return decodeUCS2(data)
+}
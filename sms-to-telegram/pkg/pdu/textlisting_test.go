@@ -0,0 +1,83 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package pdu
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseTextListing(t *testing.T) {
+	entries, err := ParseTextListing([]string{
+		// GSM 7-bit "Hi" from +4912345: length counts characters.
+		`+CMGL: 1,"00520045004300200052004500410044","002B0034003900310032003300340035",,"00320036002F00300033002F00310030002C00300038003A00330030003A00300030002B00300034",145,2`,
+		"00480069",
+		// UCS2 "Тест" with a plain stat: length counts octets.
+		`+CMGL: 2,"REC UNREAD","+4912345",,"26/03/10,08:30:00+04",145,8`,
+		"0422043504410442",
+		// Status report: no body line.
+		`+CMGL: 3,"REC READ",6,42,"+4912345",145,"26/03/10,08:30:00+04","26/03/10,08:30:05+04",0`,
+		// Empty message: the AT session dropped its empty body line.
+		`+CMGL: 4,"REC READ","+4912345",,"26/03/10,08:30:00+04",145,0`,
+		`+CMGL: 5,"STO SENT","+4912345",,,145,2`,
+		"00480069",
+	})
+	if err != nil {
+		t.Fatalf("ParseTextListing() error = %v", err)
+	}
+	want := []TextEntry{
+		{Index: 1, Stat: 1, Sender: "+4912345", Text: "Hi"},
+		{Index: 2, Stat: 0, Sender: "+4912345", Text: "Тест"},
+		{Index: 3, Stat: 1, StatusReport: true},
+		{Index: 4, Stat: 1, Sender: "+4912345"},
+		{Index: 5, Stat: 3, Sender: "+4912345", Text: "Hi"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("ParseTextListing() = %+v", entries)
+	}
+	for i, e := range entries {
+		ts := e.Timestamp
+		e.Timestamp = time.Time{}
+		if e != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, e, want[i])
+		}
+		if wantTS := (i != 2 && i != 4); ts.IsZero() == wantTS {
+			t.Errorf("entry %d timestamp = %v", i, ts)
+		}
+	}
+	if _, offset := entries[1].Timestamp.Zone(); offset != 3600 {
+		t.Errorf("timestamp zone offset = %d, want 3600", offset)
+	}
+
+	for i, lines := range [][]string{
+		{`+CMGL: 1,"REC READ","+4912345",,"26/03/10,08:30:00+04",145,3`, "00480069"}, // length mismatch
+		{`+CMGL: 1,"REC READ","+4912345",,"26/03/10,08:30:00+04",145,2`},             // header without text
+		{`+CMGL: 1,"REC READ","+4912345",,"26/03/10,08:30:00+04",145,2`, "Hi"},       // not UCS2 hex
+		{`+CMGL: 1,"REC READ","+4912345",,"26/03/10,08:30:00+04"`, "00480069"},       // no AT+CSDH=1
+		{`+CMGL: 1,"REC SEEN","+4912345",,"26/03/10,08:30:00+04",145,2`, "00480069"}, // unknown stat
+		{`+CMGL: 1,1,,22`, "00480069"},                                               // PDU-mode header
+		{"+CMTI: \"SM\",3"},                                                          // URC instead of a header
+	} {
+		if _, err := ParseTextListing(lines); !errors.Is(err, ErrListingCorrupted) {
+			t.Errorf("case %d: error = %v, want ErrListingCorrupted", i, err)
+		}
+	}
+}
+
+func TestDecodeUCS2Hex(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"004F0032", "O2"},
+		{"D83DDE00", "😀"},
+		{"SM", "SM"},
+		{"+4912345", "+4912345"},
+		{"00ZZ", "00ZZ"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := DecodeUCS2Hex(tt.in); got != tt.want {
+			t.Errorf("DecodeUCS2Hex(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
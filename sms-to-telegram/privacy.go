@@ -0,0 +1,109 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Log privacy mode (LOG_PRIVACY): SMS content and phone numbers are rewritten
+// by the log handler itself, so every call site and every level — DEBUG
+// included — is covered without touching the log calls.
+
+// privateContentKeys carry SMS bodies, raw PDUs, raw AT lines (which hold
+// PDUs and +CMT headers), values parsed from SMS, the stderr of the exec
+// sink (which may echo the SMS) or DTMF tones (IVR PINs). Their values are
+// replaced by length and fingerprint.
+var privateContentKeys = map[string]bool{
+	"text":        true,
+	"pdu":         true,
+	"pdus":        true,
+	"lines":       true,
+	"line":        true,
+	"urc":         true,
+	"stderr":      true,
+	"transaction": true,
+	"tones":       true,
+}
+
+// privateNumberKeys carry sender or destination numbers.
+var privateNumberKeys = map[string]bool{
+	"from":   true,
+	"to":     true,
+	"sender": true,
+}
+
+// embeddedPrivate matches hex PDUs (modems print them uppercase) and phone
+// numbers inside other values, in one pass so a masked PDU is not rescanned.
+var embeddedPrivate = regexp.MustCompile(`[0-9A-F]{24,}|\+?\d[\d ]{5,}\d`)
+
+// redactLogAttr is the ReplaceAttr hook of the privacy mode.
+func redactLogAttr(_ []string, a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch {
+	case privateContentKeys[a.Key]:
+		return slog.String(a.Key, redactContent(logValueString(v)))
+	case privateNumberKeys[a.Key]:
+		return slog.String(a.Key, maskNumber(logValueString(v)))
+	case v.Kind() == slog.KindString:
+		return slog.String(a.Key, scrubLogString(v.String()))
+	case v.Kind() == slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			return slog.String(a.Key, scrubLogString(x.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, scrubLogString(x.String()))
+		}
+	}
+	return a
+}
+
+func logValueString(v slog.Value) string {
+	if lines, ok := v.Any().([]string); ok {
+		return strings.Join(lines, "\n")
+	}
+	return v.String()
+}
+
+// redactContent keeps only what is needed to correlate log lines.
+func redactContent(s string) string {
+	if s == "" {
+		return ""
+	}
+	return fmt.Sprintf("[redacted %d chars %s]", len([]rune(s)), contentFingerprint(s))
+}
+
+// maskNumber keeps the last 2 digits of a phone number. Short codes and
+// alphanumeric senders ("DHL", "12345") identify a service, not a person,
+// and stay readable.
+func maskNumber(s string) string {
+	var digits []rune
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+	if len(digits) <= 5 {
+		return s
+	}
+	prefix := ""
+	if strings.HasPrefix(s, "+") {
+		prefix = "+"
+	}
+	return prefix + "****" + string(digits[len(digits)-2:])
+}
+
+// scrubLogString masks numbers and PDUs inside free-form values such as
+// errors that quote a modem response.
+func scrubLogString(s string) string {
+	return embeddedPrivate.ReplaceAllStringFunc(s, func(m string) string {
+		if len(m) >= 24 && strings.Trim(m, "0123456789ABCDEF") == "" {
+			return redactContent(m)
+		}
+		return maskNumber(m)
+	})
+}
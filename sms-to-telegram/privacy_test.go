@@ -0,0 +1,72 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestMaskNumber(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"+4915550001234", "+****34"},
+		{"015550001234", "****34"},
+		{"DHL", "DHL"},
+		{"72345", "72345"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := maskNumber(tt.in); got != tt.want {
+			t.Errorf("maskNumber(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestScrubLogString(t *testing.T) {
+	pdu := "07919471000000F0040C91947155001032000052" + "30118141410006C834"
+	got := scrubLogString("send to +49 155 500 01234 failed: +CMT: ," + pdu)
+	if strings.Contains(got, "500") || strings.Contains(got, pdu) {
+		t.Errorf("scrubLogString() = %q, number or PDU left", got)
+	}
+	if !strings.Contains(got, "+****34") || !strings.Contains(got, contentFingerprint(pdu)) {
+		t.Errorf("scrubLogString() = %q, want masked number and PDU fingerprint", got)
+	}
+	// Lowercase hex (event IDs, fingerprints) and short numbers stay.
+	for _, s := range []string{"event 3f9a0c1e2d4b5a6978a0b1c2d3e4f5a6", "AT+CMGS=23", "index 12 of 50"} {
+		if got := scrubLogString(s); got != s {
+			t.Errorf("scrubLogString(%q) = %q", s, got)
+		}
+	}
+}
+
+func TestPrivacyLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(newLogHandler(&buf, &Config{LogLevel: slog.LevelDebug, LogFormat: "text", LogPrivacy: true}))
+	logger.Debug("CMGL response", "lines", []string{"+CMGL: 1,0,,24", "07919471000000F0040C9194715500"})
+	logger.Debug("DRY_RUN message content", "text", "Your code is 481516")
+	logger.Debug("Transaction values", "transaction", Transaction{Amount: "1234.56", Currency: "EUR", Merchant: "Coffee Shop", Card: "4321"})
+	logger.Debug("DTMF tones", "tones", "1,8805#")
+	logger.Debug("Exec sink stderr", "command", "/usr/local/bin/notify", "stderr", "cannot parse: Your code is 481516")
+	logger.Info("SMS forwarded successfully", "from", "+4915550001234", "indices", []int{1, 2})
+	logger.Error("Failed to send SMS", "to", "+4915550001234", "error", errors.New(`destination "+4915550001234" refused`))
+
+	out := buf.String()
+	for _, leak := range []string{"481516", "4915550001234", "07919471", "+CMGL", "1234.56", "Coffee", "4321", "8805#"} {
+		if strings.Contains(out, leak) {
+			t.Errorf("log output leaks %q:\n%s", leak, out)
+		}
+	}
+	for _, want := range []string{"from=+****34", "to=+****34", "indices=\"[1 2]\"", contentFingerprint("Your code is 481516"),
+		contentFingerprint("cannot parse: Your code is 481516"), contentFingerprint("1,8805#"),
+		contentFingerprint(`amount="1234.56" currency="EUR" merchant="Coffee Shop" card="4321"`)} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output lacks %q:\n%s", want, out)
+		}
+	}
+}
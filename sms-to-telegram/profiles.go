@@ -0,0 +1,193 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Modem profiles: PROFILES_FILE holds named sets of the modem-specific
+// settings, so swapping the modem (or the SIM's chats with it) is picking
+// another profile instead of editing the environment. A profile is chosen
+// by -profile or PROFILE, or else by the USB VID:PID of a connected modem
+// (USB_ID). Its values are applied to the environment before loadConfig and
+// RELOAD_FILE, so they get the usual validation and RELOAD_FILE still
+// overrides the recipients. One profile per process: with several modems,
+// run one gateway per modem, each with its -profile.
+
+// profileKeys are the settings a profile may hold: the modem and its port,
+// and who gets its SMS.
+var profileKeys = []string{
+	"SERIAL_PORT", "BAUD_RATE", "SMS_STORAGE", "MODEM_CHARSET", "RECEPTION_MODE", "PUSH_POLL_INTERVAL",
+	"LOW_POWER", "CELL_TRACKING", "CALL_REJECT", "NETWORK_REG_GRACE",
+	"TELEGRAM_CHAT_IDS", "ROUTING_RULES", "RULES_FILE",
+}
+
+// profileUSBKey matches a profile to a connected modem; it is not a
+// setting.
+const profileUSBKey = "USB_ID"
+
+// sysTTYDir lists the tty devices with their sysfs device links.
+const sysTTYDir = "/sys/class/tty"
+
+var (
+	profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	usbIDPattern       = regexp.MustCompile(`^[0-9a-f]{4}:[0-9a-f]{4}$`)
+)
+
+// modemProfile is one [name] section of PROFILES_FILE.
+type modemProfile struct {
+	Name string
+	// USBID is the lowercase VID:PID the profile is picked for; "" only
+	// applies it by name.
+	USBID string
+	Vars  map[string]string
+}
+
+// profileFlag registers -profile, defaulting to PROFILE.
+func profileFlag(fs *flag.FlagSet) *string {
+	return fs.String("profile", os.Getenv("PROFILE"), "PROFILES_FILE profile to apply (PROFILE; default: matched by USB_ID)")
+}
+
+// parseProfiles reads "[name]" sections of KEY=value lines in the
+// RELOAD_FILE syntax.
+func parseProfiles(s string) ([]modemProfile, error) {
+	var profiles []modemProfile
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if name, ok := strings.CutPrefix(line, "["); ok {
+			name, ok = strings.CutSuffix(name, "]")
+			name = strings.TrimSpace(name)
+			if !ok || !profileNamePattern.MatchString(name) {
+				return nil, fmt.Errorf("line %d: want [name] (letters, digits, '.', '_', '-')", i+1)
+			}
+			if slices.ContainsFunc(profiles, func(p modemProfile) bool { return p.Name == name }) {
+				return nil, fmt.Errorf("line %d: duplicate profile %q", i+1, name)
+			}
+			profiles = append(profiles, modemProfile{Name: name, Vars: make(map[string]string)})
+			continue
+		}
+		if len(profiles) == 0 {
+			return nil, fmt.Errorf("line %d: setting outside a [name] section", i+1)
+		}
+		p := &profiles[len(profiles)-1]
+		key, value, ok := strings.Cut(line, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok {
+			return nil, fmt.Errorf("line %d: want KEY=value", i+1)
+		}
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		switch {
+		case key == profileUSBKey:
+			p.USBID = strings.ToLower(value)
+			if !usbIDPattern.MatchString(p.USBID) {
+				return nil, fmt.Errorf("line %d: invalid USB_ID %q: want VID:PID in hex (1e0e:9001)", i+1, value)
+			}
+		case slices.Contains(profileKeys, key):
+			p.Vars[key] = value
+		default:
+			return nil, fmt.Errorf("line %d: %s cannot be set in a profile (allowed: %s, %s)",
+				i+1, key, profileUSBKey, strings.Join(profileKeys, ", "))
+		}
+	}
+	return profiles, nil
+}
+
+// connectedUSBIDs returns the VID:PID of the USB devices behind the serial
+// ttys under dir (sysTTYDir). A tty's device link points at the USB
+// interface; the idVendor and idProduct files are on the device above it.
+func connectedUSBIDs(dir string) map[string]bool {
+	ids := make(map[string]bool)
+	ttys, err := filepath.Glob(filepath.Join(dir, "tty*", "device"))
+	if err != nil {
+		return ids
+	}
+	for _, link := range ttys {
+		path, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			continue
+		}
+		for ; path != "/" && path != "."; path = filepath.Dir(path) {
+			vendor, errV := os.ReadFile(filepath.Join(path, "idVendor"))
+			product, errP := os.ReadFile(filepath.Join(path, "idProduct"))
+			if errV == nil && errP == nil {
+				ids[strings.TrimSpace(string(vendor))+":"+strings.TrimSpace(string(product))] = true
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// chooseProfile picks the requested profile, or the only one whose USB_ID
+// is connected; nil when nothing was requested and nothing matches.
+func chooseProfile(profiles []modemProfile, requested string, connected map[string]bool) (*modemProfile, error) {
+	var names, matched []string
+	var match *modemProfile
+	for i, p := range profiles {
+		names = append(names, p.Name)
+		if requested == "" && p.USBID != "" && connected[p.USBID] {
+			matched = append(matched, p.Name)
+			match = &profiles[i]
+		}
+		if requested != "" && p.Name == requested {
+			return &profiles[i], nil
+		}
+	}
+	switch {
+	case requested != "":
+		return nil, fmt.Errorf("unknown profile %q (PROFILES_FILE has: %s)", requested, strings.Join(names, ", "))
+	case len(matched) > 1:
+		return nil, fmt.Errorf("connected USB devices match several profiles (%s): pick one with -profile or PROFILE",
+			strings.Join(matched, ", "))
+	}
+	return match, nil
+}
+
+// applyProfile sets the environment from the PROFILES_FILE profile chosen
+// by requested or USB_ID, and returns its name; "" without PROFILES_FILE or
+// a match.
+func applyProfile(requested string) (string, error) {
+	path := os.Getenv("PROFILES_FILE")
+	if path == "" {
+		if requested != "" {
+			return "", fmt.Errorf("profile %q requested but PROFILES_FILE is not set", requested)
+		}
+		return "", nil
+	}
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("invalid PROFILES_FILE %q: must be absolute", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading PROFILES_FILE: %w", err)
+	}
+	profiles, err := parseProfiles(string(data))
+	if err != nil {
+		return "", fmt.Errorf("PROFILES_FILE %w", err)
+	}
+	var connected map[string]bool
+	if requested == "" {
+		connected = connectedUSBIDs(sysTTYDir)
+	}
+	p, err := chooseProfile(profiles, requested, connected)
+	if err != nil || p == nil {
+		return "", err
+	}
+	for key, value := range p.Vars {
+		os.Setenv(key, value)
+	}
+	return p.Name, nil
+}
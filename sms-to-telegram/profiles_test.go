@@ -0,0 +1,163 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testProfiles = `# modems of the office gateway
+[sim7600]
+USB_ID=1E0E:9001
+SERIAL_PORT=/dev/serial/by-id/usb-SimTech*-if02-port0
+MODEM_CHARSET=UCS2
+
+[e3531]
+USB_ID = 12d1:1001
+SERIAL_PORT = "/dev/ttyUSB0"
+TELEGRAM_CHAT_IDS=-100111
+
+[spare]
+BAUD_RATE=9600
+`
+
+func TestParseProfiles(t *testing.T) {
+	profiles, err := parseProfiles(testProfiles)
+	if err != nil {
+		t.Fatalf("parseProfiles() error = %v", err)
+	}
+	want := []modemProfile{
+		{Name: "sim7600", USBID: "1e0e:9001", Vars: map[string]string{
+			"SERIAL_PORT": "/dev/serial/by-id/usb-SimTech*-if02-port0", "MODEM_CHARSET": "UCS2"}},
+		{Name: "e3531", USBID: "12d1:1001", Vars: map[string]string{
+			"SERIAL_PORT": "/dev/ttyUSB0", "TELEGRAM_CHAT_IDS": "-100111"}},
+		{Name: "spare", Vars: map[string]string{"BAUD_RATE": "9600"}},
+	}
+	if !reflect.DeepEqual(profiles, want) {
+		t.Errorf("parseProfiles() = %+v, want %+v", profiles, want)
+	}
+
+	for _, bad := range []string{
+		"SERIAL_PORT=/dev/ttyUSB0",
+		"[a b]",
+		"[sim7600",
+		"[a]\n[a]",
+		"[a]\nSERIAL_PORT",
+		"[a]\nUSB_ID=1e0e",
+		"[a]\nTELEGRAM_BOT_TOKEN=123:abc",
+	} {
+		if _, err := parseProfiles(bad); err == nil {
+			t.Errorf("parseProfiles(%q) should fail", bad)
+		}
+	}
+}
+
+func TestConnectedUSBIDs(t *testing.T) {
+	root := t.TempDir()
+	// A USB modem with two serial interfaces, and a tty without a device.
+	device := filepath.Join(root, "devices", "usb1", "1-1")
+	for name, content := range map[string]string{"idVendor": "1e0e\n", "idProduct": "9001\n"} {
+		if err := os.MkdirAll(device, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(device, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tty := range []string{"ttyUSB0", "ttyUSB2"} {
+		iface := filepath.Join(device, "1-1:1."+tty[len(tty)-1:])
+		if err := os.MkdirAll(filepath.Join(root, "class", tty), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(iface, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(iface, filepath.Join(root, "class", tty, "device")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(root, "class", "tty0"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got := connectedUSBIDs(filepath.Join(root, "class"))
+	if want := map[string]bool{"1e0e:9001": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("connectedUSBIDs() = %v, want %v", got, want)
+	}
+	if got := connectedUSBIDs(filepath.Join(root, "missing")); len(got) != 0 {
+		t.Errorf("connectedUSBIDs(missing) = %v, want none", got)
+	}
+}
+
+func TestChooseProfile(t *testing.T) {
+	profiles, err := parseProfiles(testProfiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		requested string
+		connected map[string]bool
+		want      string
+		wantErr   string
+	}{
+		{requested: "spare", connected: map[string]bool{"1e0e:9001": true}, want: "spare"},
+		{requested: "sim800", wantErr: "unknown profile"},
+		{connected: map[string]bool{"1e0e:9001": true, "0403:6001": true}, want: "sim7600"},
+		{connected: map[string]bool{"0403:6001": true}, want: ""},
+		{connected: map[string]bool{"1e0e:9001": true, "12d1:1001": true}, wantErr: "several profiles (sim7600, e3531)"},
+	}
+	for _, tt := range tests {
+		p, err := chooseProfile(profiles, tt.requested, tt.connected)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("chooseProfile(%q, %v) error = %v, want %q", tt.requested, tt.connected, err, tt.wantErr)
+			}
+			continue
+		}
+		got := ""
+		if p != nil {
+			got = p.Name
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("chooseProfile(%q, %v) = %q, %v; want %q", tt.requested, tt.connected, got, err, tt.want)
+		}
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.conf")
+	if err := os.WriteFile(path, []byte(testProfiles), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SERIAL_PORT", "/dev/ttyACM0")
+	t.Setenv("TELEGRAM_CHAT_IDS", "42")
+
+	t.Setenv("PROFILES_FILE", "")
+	if name, err := applyProfile(""); name != "" || err != nil {
+		t.Errorf("without PROFILES_FILE: %q, %v", name, err)
+	}
+	if _, err := applyProfile("e3531"); err == nil {
+		t.Error("profile requested without PROFILES_FILE should fail")
+	}
+	t.Setenv("PROFILES_FILE", "profiles.conf")
+	if _, err := applyProfile("e3531"); err == nil {
+		t.Error("relative PROFILES_FILE should fail")
+	}
+
+	t.Setenv("PROFILES_FILE", path)
+	name, err := applyProfile("e3531")
+	if err != nil || name != "e3531" {
+		t.Fatalf("applyProfile(e3531) = %q, %v", name, err)
+	}
+	if got := os.Getenv("SERIAL_PORT"); got != "/dev/ttyUSB0" {
+		t.Errorf("SERIAL_PORT = %q, want the profile's", got)
+	}
+	if got := os.Getenv("TELEGRAM_CHAT_IDS"); got != "-100111" {
+		t.Errorf("TELEGRAM_CHAT_IDS = %q, want the profile's", got)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// progressFileName is the delivery progress inside STATE_DIR.
+const progressFileName = "delivery_progress.json"
+
+// progressMaxAge drops entries of SMS that were removed from the SIM by
+// other means (AT+CMGD by hand, SIM swapped) while the service was down.
+const progressMaxAge = 30 * 24 * time.Hour
+
+// DeliveryProgress persists what the Deliverer knows about the SMS still on
+// the SIM: which sinks already accepted each one and which were rejected.
+// The SMS themselves need no copy, the SIM keeps them until they are
+// delivered; without this file a restart in the middle of a fan-out would
+// re-send to every sink and re-alert every rejected SMS. Entries are keyed
+// by messageKey and carry no SMS content.
+//
+// Written by the delivery goroutine only.
+type DeliveryProgress struct {
+	path  string
+	saved []byte // last written content, to skip no-op writes
+}
+
+type progressEntry struct {
+	// Since is when delivery of the SMS began (or the first acceptance).
+	Since    time.Time          `json:"since"`
+	Sinks    []AuditDestination `json:"sinks,omitempty"`
+	Rejected bool               `json:"rejected,omitempty"`
+}
+
+func NewDeliveryProgress(stateDir string) *DeliveryProgress {
+	return &DeliveryProgress{path: filepath.Join(stateDir, progressFileName)}
+}
+
+// Load reads the saved progress; a missing file is an empty one.
+func (p *DeliveryProgress) Load() (map[string]progressEntry, error) {
+	entries := map[string]progressEntry{}
+	data, err := os.ReadFile(p.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading delivery progress: %w", err)
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parsing delivery progress %s: %w", p.path, err)
+	}
+	p.saved = data
+	cutoff := clk.Now().Add(-progressMaxAge)
+	for key, e := range entries {
+		if e.Since.Before(cutoff) {
+			delete(entries, key)
+		}
+	}
+	return entries, nil
+}
+
+// Save replaces the file with entries (atomically, 0600).
+func (p *DeliveryProgress) Save(entries map[string]progressEntry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data, p.saved) {
+		return nil
+	}
+	if err := writeFileAtomic(p.path, data, 0o600); err != nil {
+		return fmt.Errorf("writing delivery progress: %w", err)
+	}
+	p.saved = data
+	return nil
+}
+
+// restoreProgress loads p into the Deliverer and keeps it updated from now
+// on. Call before the first delivery. An unreadable file is logged and
+// replaced: losing it costs duplicates, not SMS.
+func (d *Deliverer) restoreProgress(p *DeliveryProgress) {
+	d.progress = p
+	entries, err := p.Load()
+	if err != nil {
+		slog.Error("Ignoring saved delivery progress", "error", err)
+		return
+	}
+	for key, e := range entries {
+		if e.Rejected {
+			d.rejected[key] = e.Since
+			continue
+		}
+		done := make(map[string]AuditDestination, len(e.Sinks))
+		for _, dest := range e.Sinks {
+			done[dest.Sink] = dest
+		}
+		d.sinkDone[key] = done
+		if d.auditing() {
+			d.firstSeen[key] = e.Since
+		}
+	}
+	if len(entries) > 0 {
+		slog.Info("Restored delivery progress", "messages", len(entries))
+	}
+}
+
+// saveProgress persists the current progress. Failures are logged: the
+// worst outcome of a lost update is a duplicate after a restart.
+func (d *Deliverer) saveProgress() {
+	if d.progress == nil {
+		return
+	}
+	entries := make(map[string]progressEntry, len(d.sinkDone)+len(d.rejected))
+	for key, done := range d.sinkDone {
+		e := progressEntry{Since: d.firstSeen[key]}
+		for _, sink := range d.sinks {
+			dest, ok := done[sink.Name()]
+			if !ok {
+				continue
+			}
+			e.Sinks = append(e.Sinks, dest)
+			if e.Since.IsZero() || dest.At.Before(e.Since) {
+				e.Since = dest.At
+			}
+		}
+		entries[key] = e
+	}
+	for key, since := range d.rejected {
+		entries[key] = progressEntry{Since: since, Rejected: true}
+	}
+	if err := d.progress.Save(entries); err != nil {
+		slog.Error("Failed to save delivery progress", "error", err)
+	}
+}
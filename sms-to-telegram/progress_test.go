@@ -0,0 +1,97 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDeliveryProgress_SurvivesRestart: after a restart in the middle of a
+// fan-out only the sinks that did not accept the SMS yet get it, and a
+// rejected SMS is neither re-sent nor re-alerted.
+func TestDeliveryProgress_SurvivesRestart(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	dir := t.TempDir()
+	cfg := testConfig()
+	ctx := context.Background()
+	// start is one process lifetime: a fresh Deliverer on the same STATE_DIR.
+	start := func(sink *fakeSink) (*Deliverer, *fakeSender, *fakeSender) {
+		deliverer, sender, alerts := newTestDeliverer(cfg)
+		deliverer.AddSink(sink)
+		deliverer.restoreProgress(NewDeliveryProgress(dir))
+		return deliverer, sender, alerts
+	}
+	pending := PendingSMS{Message: SMSMessage{Index: 1, From: "+100", Text: "secret 4711"}, PartIndices: []int{1}}
+	poisoned := PendingSMS{Message: SMSMessage{Index: 2, From: "+100", Text: "bad"}, PartIndices: []int{2}}
+
+	hook := &fakeSink{name: "hook", errs: []error{
+		errors.New("connection refused"),
+		fmt.Errorf("%w: HTTP 400", errSinkRejected),
+	}}
+	deliverer, _, _ := start(hook)
+	if got := deliverer.Deliver(ctx, pending); got != deliveryDeferred {
+		t.Fatalf("Deliver() = %v, want deliveryDeferred", got)
+	}
+	if got := deliverer.Deliver(ctx, poisoned); got != deliveryRejected {
+		t.Fatalf("Deliver(poisoned) = %v, want deliveryRejected", got)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, progressFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "4711") {
+		t.Errorf("progress file holds SMS content: %s", data)
+	}
+
+	hook = &fakeSink{name: "hook"}
+	deliverer, sender, alerts := start(hook)
+	if got := deliverer.Deliver(ctx, pending); got != deliveryDone {
+		t.Fatalf("Deliver() after restart = %v, want deliveryDone", got)
+	}
+	if got := deliverer.Deliver(ctx, poisoned); got != deliveryRejected {
+		t.Errorf("Deliver(poisoned) after restart = %v, want deliveryRejected", got)
+	}
+	if len(sender.sent) != 0 {
+		t.Errorf("telegram sends after restart = %d, want 0 (accepted before)", len(sender.sent))
+	}
+	if len(hook.sent) != 1 || len(alerts.sent) != 0 {
+		t.Errorf("hook sends = %d, alerts = %d, want 1 and 0", len(hook.sent), len(alerts.sent))
+	}
+
+	// Only the rejected SMS is left; a month later it is forgotten.
+	clock.Advance(progressMaxAge + time.Hour)
+	deliverer, _, _ = start(&fakeSink{name: "hook"})
+	if len(deliverer.rejected) != 0 || len(deliverer.sinkDone) != 0 {
+		t.Errorf("expired progress restored: rejected %d, in progress %d", len(deliverer.rejected), len(deliverer.sinkDone))
+	}
+}
+
+func TestDeliveryProgress_CorruptFileIgnored(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	dir := t.TempDir()
+	path := filepath.Join(dir, progressFileName)
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	deliverer, sender, _ := newTestDeliverer(testConfig())
+	deliverer.AddSink(&fakeSink{name: "hook", errs: []error{errors.New("down")}})
+	deliverer.restoreProgress(NewDeliveryProgress(dir))
+
+	pending := PendingSMS{Message: SMSMessage{Index: 1, From: "+100", Text: "hi"}, PartIndices: []int{1}}
+	if got := deliverer.Deliver(context.Background(), pending); got != deliveryDeferred || len(sender.sent) == 0 {
+		t.Fatalf("Deliver() = %v with %d sends, want deliveryDeferred after sending", got, len(sender.sent))
+	}
+	entries, err := NewDeliveryProgress(dir).Load()
+	if err != nil || len(entries) != 1 {
+		t.Errorf("rewritten progress = %v, %v; want one entry", entries, err)
+	}
+}
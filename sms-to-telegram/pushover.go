@@ -0,0 +1,104 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	pushoverAPIURL = "https://api.pushover.net/1/messages.json"
+	// Pushover rejects longer messages and titles outright.
+	pushoverMaxMessage = 1024
+	pushoverMaxTitle   = 250
+)
+
+// PushoverOptions configures the Pushover sink (PUSHOVER_* variables).
+type PushoverOptions struct {
+	Token string // application API token
+	User  string // user or group key
+	// Priority is -2 (no alert) to 1 (high); emergency (2) needs
+	// acknowledgement handling and is not supported.
+	Priority int
+}
+
+// PushoverSink pushes every SMS through the Pushover API. Any failure is
+// transient: messages are truncated to Pushover's limits, so a 4xx almost
+// always means a bad token/user key or exhausted quota — things the operator
+// fixes without the SMS being lost.
+type PushoverSink struct {
+	opts   PushoverOptions
+	apiURL string
+	client *http.Client
+	dryRun bool
+}
+
+func NewPushoverSink(opts PushoverOptions, cfg *Config) *PushoverSink {
+	return &PushoverSink{
+		opts:   opts,
+		apiURL: pushoverAPIURL,
+		client: &http.Client{Timeout: cfg.WebhookTimeout},
+		dryRun: cfg.DryRun,
+	}
+}
+
+func (p *PushoverSink) Name() string { return "pushover" }
+
+func (p *PushoverSink) Send(ctx context.Context, pending PendingSMS) error {
+	msg := pending.Message
+	form := url.Values{
+		"token":    {p.opts.Token},
+		"user":     {p.opts.User},
+		"title":    {truncateRunes("SMS from "+msg.From, pushoverMaxTitle)},
+		"message":  {truncateRunes(pushMessageText(pending), pushoverMaxMessage)},
+		"priority": {strconv.Itoa(p.opts.Priority)},
+	}
+	if !msg.Time.IsZero() {
+		form.Set("timestamp", strconv.FormatInt(msg.Time.Unix(), 10))
+	}
+	if p.dryRun {
+		slog.InfoContext(ctx, "DRY_RUN: Would push to Pushover", "priority", p.opts.Priority)
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.apiURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("building Pushover request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	status, err := doSinkRequest(p.client, req)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status >= 300 {
+		return fmt.Errorf("Pushover: HTTP %d", status)
+	}
+	slog.DebugContext(ctx, "Pushed SMS to Pushover")
+	return nil
+}
+
+// pushMessageText is the plain-text body for push sinks: the SMS text, or
+// the raw hex with the decode failure reason.
+func pushMessageText(pending PendingSMS) string {
+	if pending.RawFallback {
+		return fmt.Sprintf("[undecodable SMS: %s]\n%s", pending.RawReason, pending.Message.Text)
+	}
+	return displayText(pending)
+}
+
+// truncateRunes shortens s to at most max runes, marking the cut with "…".
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
@@ -0,0 +1,69 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestPushoverSink_Send(t *testing.T) {
+	var form map[string]string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = make(map[string]string)
+		for k := range r.PostForm {
+			form[k] = r.PostForm.Get(k)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.WebhookTimeout = time.Second
+	sink := NewPushoverSink(PushoverOptions{Token: "apptoken", User: "userkey", Priority: -1}, cfg)
+	sink.apiURL = srv.URL
+	smsTime := time.Date(2026, 3, 10, 8, 30, 0, 0, time.UTC)
+	pending := PendingSMS{Message: SMSMessage{From: "+100", Text: strings.Repeat("x", 2000), Time: smsTime}}
+
+	if err := sink.Send(context.Background(), pending); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if form["token"] != "apptoken" || form["user"] != "userkey" || form["priority"] != "-1" ||
+		form["title"] != "SMS from +100" || form["timestamp"] != "1773131400" {
+		t.Errorf("form = %v", form)
+	}
+	if n := utf8.RuneCountInString(form["message"]); n != pushoverMaxMessage {
+		t.Errorf("message length = %d runes, want truncation to %d", n, pushoverMaxMessage)
+	}
+
+	// A 4xx is most likely a bad token: retry, never reject the SMS.
+	status = http.StatusBadRequest
+	if err := sink.Send(context.Background(), pending); err == nil || errors.Is(err, errSinkRejected) {
+		t.Errorf("HTTP 400: Send() error = %v, want transient", err)
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"Привет мир", 7, "Привет…"},
+	} {
+		if got := truncateRunes(tt.in, tt.max); got != tt.want {
+			t.Errorf("truncateRunes(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PDU quarantine: an SMS the gateway cannot decode is still forwarded, but
+// a hex PDU in the middle of a chat message helps nobody. Telegram gets it
+// as an attached file instead, and with STATE_DIR a copy is kept in
+// STATE_DIR/quarantine, so a parser fix can be checked against it:
+//
+//	sms-to-telegram replay /var/lib/sms-to-telegram/quarantine
+//
+// The files are replay corpora: "#" comment lines with what is known about
+// the SMS, then the PDU of every SIM slot.
+
+// quarantineDirName is the PDU quarantine inside STATE_DIR.
+const quarantineDirName = "quarantine"
+
+// quarantineFileName names the file of an undecodable SMS after its PDUs,
+// so a retried delivery rewrites the same file.
+func quarantineFileName(pending PendingSMS) string {
+	return "pdu-" + contentFingerprint(strings.Join(pending.RawPDUs, "\n")) + ".txt"
+}
+
+// quarantineFile renders the file of an undecodable SMS. It holds message
+// content and is only written 0600.
+func quarantineFile(pending PendingSMS) []byte {
+	var sb strings.Builder
+	sb.WriteString("# sms-to-telegram: undecodable SMS\n")
+	if pending.Message.From != "" {
+		fmt.Fprintf(&sb, "# from: %s\n", pending.Message.From)
+	}
+	if !pending.Message.Time.IsZero() {
+		fmt.Fprintf(&sb, "# time: %s\n", formatMessageTime(pending.Message.Time))
+	}
+	fmt.Fprintf(&sb, "# sim_indices: %v\n", pending.PartIndices)
+	fmt.Fprintf(&sb, "# error: %s\n", strings.ReplaceAll(pending.RawReason, "\n", " "))
+	for _, raw := range pending.RawPDUs {
+		sb.WriteString(raw + "\n")
+	}
+	return []byte(sb.String())
+}
+
+// PDUQuarantine writes undecodable SMS to a directory.
+type PDUQuarantine struct {
+	dir string
+}
+
+func NewPDUQuarantine(dir string) *PDUQuarantine {
+	return &PDUQuarantine{dir: dir}
+}
+
+// Save writes the quarantine file of pending and returns its path.
+func (q *PDUQuarantine) Save(pending PendingSMS) (string, error) {
+	if err := os.MkdirAll(q.dir, 0o700); err != nil {
+		return "", fmt.Errorf("creating quarantine directory: %w", err)
+	}
+	path := filepath.Join(q.dir, quarantineFileName(pending))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, quarantineFile(pending), 0o600); err != nil {
+		return "", fmt.Errorf("writing quarantine file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("writing quarantine file: %w", err)
+	}
+	return path, nil
+}
+
+// quarantineUndecodable keeps a copy of SMS forwarded as raw PDUs. A copy
+// that cannot be written is logged; the SMS is forwarded anyway, with its
+// PDUs in the Telegram attachment and the payloads.
+func (d *Deliverer) quarantineUndecodable(next SMSHandler) SMSHandler {
+	return func(ctx context.Context, pending PendingSMS) deliveryStatus {
+		if d.quarantine == nil || !pending.RawFallback {
+			return next(ctx, pending)
+		}
+		if path, err := d.quarantine.Save(pending); err != nil {
+			slog.WarnContext(ctx, "Failed to quarantine undecodable PDU", "error", err)
+		} else {
+			slog.InfoContext(ctx, "Undecodable PDU quarantined", "file", path)
+		}
+		return next(ctx, pending)
+	}
+}
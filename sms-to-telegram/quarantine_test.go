@@ -0,0 +1,91 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// An undecodable PDU goes to Telegram as an attached file, is kept in the
+// quarantine directory as a replay corpus, and its slot is freed.
+func TestProcessMessages_UndecodablePDUQuarantined(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	rawPDU := "000401AA110000FF22"
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 6,1,,8", rawPDU}), nil)
+	cfg := testConfig()
+	cfg.ChatIDs = []int64{100}
+	deliverer, sender, _ := newTestDeliverer(cfg)
+	docs := &fakeDocSender{}
+	deliverer.telegram.docs = docs
+	dir := filepath.Join(t.TempDir(), quarantineDirName)
+	deliverer.quarantine = NewPDUQuarantine(dir)
+
+	if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+		t.Fatalf("processMessages() error = %v", err)
+	}
+	if len(sender.sent) != 0 || len(docs.docs) != 1 {
+		t.Fatalf("sent %d messages and %d documents, want one document", len(sender.sent), len(docs.docs))
+	}
+	doc := docs.docs[0]
+	if doc.ChatID != 100 || !strings.HasPrefix(doc.Filename, "pdu-") || !strings.Contains(string(doc.Data), rawPDU+"\n") {
+		t.Errorf("document %s to %d: %q", doc.Filename, doc.ChatID, doc.Data)
+	}
+	if !strings.Contains(doc.Caption, "undecodable") || !strings.Contains(doc.Caption, "<b>Problem:</b>") || strings.Contains(doc.Caption, rawPDU) {
+		t.Errorf("caption %q, want the problem without the PDU", doc.Caption)
+	}
+	if modem.commandCount("AT+CMGD=6") != 1 {
+		t.Error("quarantined slot must be deleted after delivery")
+	}
+
+	path := filepath.Join(dir, doc.Filename)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("quarantine file: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("quarantine file mode %v, want 0600", info.Mode().Perm())
+	}
+	pdus, err := readPDUCorpus(path)
+	if err != nil || len(pdus) != 1 || pdus[0].raw != rawPDU {
+		t.Errorf("replay reads %+v, %v; want the PDU", pdus, err)
+	}
+}
+
+// Neither a failing quarantine nor a failing upload loses the SMS: the
+// first is only logged, the second defers like any Telegram failure.
+func TestDeliverer_QuarantineFailures(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	cfg := testConfig()
+	cfg.ChatIDs = []int64{100}
+	cfg.TelegramRetries = 0
+	deliverer, _, _ := newTestDeliverer(cfg)
+	docs := &fakeDocSender{err: errors.New("connection reset")}
+	deliverer.telegram.docs = docs
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	deliverer.quarantine = NewPDUQuarantine(filepath.Join(blocker, quarantineDirName))
+
+	pending := PendingSMS{
+		Message:     SMSMessage{Index: 6, Text: "000401AA110000FF22"},
+		PartIndices: []int{6},
+		RawFallback: true,
+		RawReason:   "TPDU too short",
+		RawPDUs:     []string{"000401AA110000FF22"},
+	}
+	if got := deliverer.Deliver(context.Background(), pending); got != deliveryDeferred {
+		t.Errorf("Deliver() with a failing upload = %v, want deliveryDeferred", got)
+	}
+	docs.err = nil
+	if got := deliverer.Deliver(context.Background(), pending); got != deliveryDone {
+		t.Errorf("Deliver() = %v, want deliveryDone without a quarantine", got)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiterMaxIdle is how many callers the limiter tracks before it drops
+// those whose bucket has refilled; a full bucket is the same as no bucket.
+const rateLimiterMaxIdle = 1024
+
+// rateLimiter is a token bucket per caller (API_RATE_LIMIT): perMinute
+// requests at once, refilled at perMinute per minute. A nil limiter allows
+// everything.
+type rateLimiter struct {
+	perMinute float64
+
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+}
+
+type rateBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &rateLimiter{perMinute: float64(perMinute), buckets: make(map[string]*rateBucket)}
+}
+
+// take spends one request of caller. It returns 0 when allowed, otherwise
+// how long until the next request would be.
+func (l *rateLimiter) take(caller string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.refill(caller)
+	if b.tokens < 1 {
+		return l.wait(b)
+	}
+	b.tokens--
+	return 0
+}
+
+// exhausted is take without spending: how long caller must wait, or 0.
+func (l *rateLimiter) exhausted(caller string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b := l.refill(caller); b.tokens < 1 {
+		return l.wait(b)
+	}
+	return 0
+}
+
+// refill returns caller's bucket topped up for the time passed. Call with
+// mu held.
+func (l *rateLimiter) refill(caller string) *rateBucket {
+	now := clk.Now()
+	b, ok := l.buckets[caller]
+	if !ok {
+		if len(l.buckets) >= rateLimiterMaxIdle {
+			l.prune(now)
+		}
+		b = &rateBucket{tokens: l.perMinute, at: now}
+		l.buckets[caller] = b
+		return b
+	}
+	if elapsed := now.Sub(b.at); elapsed > 0 {
+		b.tokens = min(l.perMinute, b.tokens+elapsed.Minutes()*l.perMinute)
+		b.at = now
+	}
+	return b
+}
+
+func (l *rateLimiter) wait(b *rateBucket) time.Duration {
+	return time.Duration((1 - b.tokens) / l.perMinute * float64(time.Minute))
+}
+
+// prune drops the callers whose bucket is full again. Call with mu held.
+func (l *rateLimiter) prune(now time.Time) {
+	for caller, b := range l.buckets {
+		if b.tokens+now.Sub(b.at).Minutes()*l.perMinute >= l.perMinute {
+			delete(l.buckets, caller)
+		}
+	}
+}
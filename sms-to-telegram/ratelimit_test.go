@@ -0,0 +1,55 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	l := newRateLimiter(3)
+
+	for i := range 3 {
+		if wait := l.take("a"); wait != 0 {
+			t.Fatalf("request %d waits %v", i, wait)
+		}
+	}
+	if wait := l.take("a"); wait != 20*time.Second {
+		t.Fatalf("wait = %v, want 20s", wait)
+	}
+	if wait := l.exhausted("b"); wait != 0 {
+		t.Errorf("other caller waits %v", wait)
+	}
+	// Refilled at 3 a minute, never beyond 3.
+	clock.Advance(20 * time.Second)
+	if wait := l.take("a"); wait != 0 {
+		t.Errorf("after 20s: wait = %v", wait)
+	}
+	clock.Advance(time.Hour)
+	for range 3 {
+		l.take("a")
+	}
+	if l.exhausted("a") == 0 {
+		t.Error("bucket grew past the limit")
+	}
+
+	// Idle callers are forgotten once there are many.
+	for i := range rateLimiterMaxIdle {
+		l.take(fmt.Sprint(i))
+	}
+	clock.Advance(time.Minute)
+	l.take("new")
+	if n := len(l.buckets); n != 1 {
+		t.Errorf("%d buckets after pruning, want 1", n)
+	}
+
+	var unlimited *rateLimiter
+	if newRateLimiter(0) != nil || unlimited.take("a") != 0 || unlimited.exhausted("a") != 0 {
+		t.Error("a zero limit limits")
+	}
+}
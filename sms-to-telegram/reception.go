@@ -0,0 +1,177 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+// Reception strategies (RECEPTION_MODE).
+const (
+	receptionPoll   = "poll"
+	receptionHybrid = "hybrid"
+)
+
+// With push reception the modem loop reads the indications every urcEvery,
+// waiting up to urcWait each time.
+const (
+	urcEvery = time.Second
+	urcWait  = 100 * time.Millisecond
+)
+
+// reception runs the hybrid strategy: +CMTI new-message indications
+// (AT+CNMI=2,1) trigger a listing at once, and a slow poll
+// (PUSH_POLL_INTERVAL) is the safety net. The SMS stay stored, so an
+// indication only says when to look; the listing is what is trusted. A
+// modem that does not keep the setting, or a new SMS a listing finds
+// without its indication, means the firmware ignores them: the gateway
+// falls back to polling for the rest of the run. Created in run(); used by
+// the modem goroutine only. Nil-safe: a nil reception polls.
+type reception struct {
+	// hybrid: RECEPTION_MODE=hybrid and no fallback yet.
+	hybrid bool
+	// push: indications are enabled and verified in this session.
+	push bool
+	// wake: an indication arrived since the last listing.
+	wake bool
+	// announced are indices indicated and not listed since.
+	announced map[int]bool
+	// suspects were new in the last listing without an indication; one
+	// may still have been on its way.
+	suspects map[int]bool
+	// last are the received slots of the last listing; nil before the
+	// first listing of the session.
+	last map[int]bool
+}
+
+func newReception(mode string) *reception {
+	return &reception{hybrid: mode == receptionHybrid}
+}
+
+// start enables the indications for a new session (nil-safe). Only a
+// transport error is returned; a modem that refuses or ignores them falls
+// back to polling. Mode 1 keeps the SMS stored and only sends +CMTI, a
+// one-line URC the AT session skips inside responses; never mode 2 (+CMT),
+// which would hand SMS past the storage.
+func (r *reception) start(modem ATCommander) error {
+	if r == nil {
+		return nil
+	}
+	r.push, r.wake = false, false
+	r.announced, r.suspects, r.last = map[int]bool{}, map[int]bool{}, nil
+	if !r.hybrid {
+		return nil
+	}
+	_, err := modem.Command("AT+CNMI=2,1,0,0,0")
+	if at.IsTimeoutError(err) {
+		return err
+	}
+	if err != nil {
+		r.fallBack(fmt.Sprintf("AT+CNMI=2,1,0,0,0 refused: %v", err))
+		return nil
+	}
+	resp, err := modem.Command("AT+CNMI?")
+	if at.IsTimeoutError(err) {
+		return err
+	}
+	if joined := strings.Join(resp, " "); err != nil || !strings.Contains(joined, "+CNMI: 2,1") {
+		r.fallBack(fmt.Sprintf("AT+CNMI=2,1 not kept (got %q)", joined))
+		return r.stop(modem)
+	}
+	r.push = true
+	slog.Info("New SMS indications enabled", "strategy", receptionHybrid)
+	return nil
+}
+
+// stop switches the indications off again, as initModemSession left them.
+func (r *reception) stop(modem ATCommander) error {
+	if _, err := modem.Command("AT+CNMI=2,0,0,0,0"); at.IsTimeoutError(err) {
+		return err
+	}
+	return nil
+}
+
+// fallBack ends the hybrid strategy for the rest of the run.
+func (r *reception) fallBack(reason string) {
+	slog.Warn("New SMS indications not working - falling back to polling", "reason", reason)
+	r.hybrid, r.push = false, false
+}
+
+// pushing reports whether the session receives by indication. Nil-safe.
+func (r *reception) pushing() bool {
+	return r != nil && r.push
+}
+
+// urc takes the session's URCs (at.SimpleAT.OnURC). Nil-safe.
+func (r *reception) urc(line string) {
+	rest, ok := strings.CutPrefix(line, "+CMTI:")
+	if !ok || !r.pushing() {
+		return
+	}
+	// +CMTI: <mem>,<index>
+	fields := strings.Split(rest, ",")
+	index, err := strconv.Atoi(strings.TrimSpace(fields[len(fields)-1]))
+	if err != nil {
+		slog.Debug("Unparseable new SMS indication", "urc", line)
+		return
+	}
+	slog.Debug("New SMS indication", "index", index)
+	r.announced[index] = true
+	r.wake = true
+}
+
+// takeWake reports (once) whether an indication asks for a listing.
+func (r *reception) takeWake() bool {
+	wake := r.wake
+	r.wake = false
+	return wake
+}
+
+// listed checks a listing's received slots against the indications.
+// Nil-safe.
+func (r *reception) listed(received []int) {
+	if !r.pushing() {
+		return
+	}
+	for idx := range r.suspects {
+		if !r.announced[idx] {
+			r.fallBack(fmt.Sprintf("SMS at index %d arrived without indication", idx))
+			return
+		}
+		delete(r.announced, idx)
+	}
+	clear(r.suspects)
+
+	baseline := r.last == nil
+	last := make(map[int]bool, len(received))
+	for _, idx := range received {
+		if idx >= injectBaseIndex {
+			continue // virtual test SMS are never indicated
+		}
+		last[idx] = true
+		if !baseline && !r.last[idx] && !r.announced[idx] {
+			r.suspects[idx] = true
+		}
+		delete(r.announced, idx)
+	}
+	r.last = last
+}
+
+// describe renders the strategy for /status.
+func (r *reception) describe(cfg *Config) string {
+	switch {
+	case r.pushing():
+		return fmt.Sprintf("push (+CMTI), polling every %s", cfg.PushPollInterval)
+	case cfg.ReceptionMode == receptionHybrid:
+		return fmt.Sprintf("polling every %s (indications not working)", cfg.PollInterval)
+	default:
+		return fmt.Sprintf("polling every %s", cfg.PollInterval)
+	}
+}
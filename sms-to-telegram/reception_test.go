@@ -0,0 +1,113 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+func TestReception_Start(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		setErr   error
+		cnmi     []string
+		wantPush bool
+		wantCmds int // AT+CNMI commands sent
+	}{
+		{"poll", receptionPoll, nil, nil, false, 0},
+		{"kept", receptionHybrid, nil, []string{"+CNMI: 2,1,0,0,0"}, true, 2},
+		{"refused", receptionHybrid, at.ErrModemError, nil, false, 1},
+		{"ignored", receptionHybrid, nil, []string{"+CNMI: 2,0,0,0,0"}, false, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modem := newFakeAT()
+			modem.on("AT+CNMI=2,1,0,0,0", nil, tt.setErr)
+			modem.on("AT+CNMI?", tt.cnmi, nil)
+			r := newReception(tt.mode)
+
+			if err := r.start(modem); err != nil {
+				t.Fatalf("start() error = %v", err)
+			}
+			if r.pushing() != tt.wantPush {
+				t.Errorf("pushing() = %v, want %v", r.pushing(), tt.wantPush)
+			}
+			cmds := modem.commandCount("AT+CNMI=2,1,0,0,0") + modem.commandCount("AT+CNMI?") + modem.commandCount("AT+CNMI=2,0,0,0,0")
+			if cmds != tt.wantCmds {
+				t.Errorf("commands = %q, want %d AT+CNMI", modem.calls, tt.wantCmds)
+			}
+			// A fallback is for the rest of the run.
+			if tt.mode == receptionHybrid && !tt.wantPush {
+				if err := r.start(modem); err != nil || r.pushing() || modem.commandCount("AT+CNMI=2,1,0,0,0") != 1 {
+					t.Errorf("next session retried the indications: %q", modem.calls)
+				}
+			}
+		})
+	}
+
+	modem := newFakeAT()
+	modem.on("AT+CNMI=2,1,0,0,0", nil, at.ErrModemTimeout)
+	if err := newReception(receptionHybrid).start(modem); !at.IsTimeoutError(err) {
+		t.Errorf("start() error = %v, want the timeout", err)
+	}
+}
+
+func TestReception_Listed(t *testing.T) {
+	newPushing := func() *reception {
+		modem := newFakeAT()
+		modem.on("AT+CNMI?", []string{"+CNMI: 2,1,0,0,0"}, nil)
+		r := newReception(receptionHybrid)
+		if err := r.start(modem); err != nil || !r.pushing() {
+			t.Fatalf("start() = %v, pushing %v", err, r.pushing())
+		}
+		return r
+	}
+
+	// The first listing is the baseline; indicated arrivals wake the loop
+	// once; an indication after the listing that found the SMS is fine.
+	r := newPushing()
+	r.listed([]int{1, 2})
+	r.urc(`+CMTI: "SM",3`)
+	if !r.takeWake() || r.takeWake() {
+		t.Error("takeWake() should report the indication exactly once")
+	}
+	r.listed([]int{1, 2, 3})
+	r.listed([]int{1, 2, 3, 4})
+	r.urc(`+CMTI: "SM",4`)
+	r.listed([]int{1, 2, 3, injectBaseIndex})
+	if !r.pushing() {
+		t.Fatal("fell back although every SMS was indicated")
+	}
+
+	// A slot reused after a deletion is indicated again.
+	r.listed([]int{1})
+	r.urc(`+CMTI: "SM",2`)
+	r.listed([]int{1, 2})
+	if !r.pushing() {
+		t.Fatal("fell back on a reused slot")
+	}
+
+	// An SMS without indication by the next listing: firmware ignores them.
+	r.listed([]int{1, 2, 5})
+	if !r.pushing() {
+		t.Fatal("fell back before the indication could arrive")
+	}
+	r.listed([]int{1, 2})
+	if r.pushing() {
+		t.Error("still pushing after an SMS arrived without indication")
+	}
+	if got := r.describe(&Config{ReceptionMode: receptionHybrid, PollInterval: 10 * time.Second}); got != "polling every 10s (indications not working)" {
+		t.Errorf("describe() = %q", got)
+	}
+
+	var nilReception *reception
+	nilReception.listed([]int{1})
+	if nilReception.pushing() {
+		t.Error("nil reception pushes")
+	}
+}
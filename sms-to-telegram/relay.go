@@ -0,0 +1,65 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// relayTimeout bounds one relayed SMS: the wait for the modem goroutine
+// (between SIM polls) plus the AT+CMGS dialogs.
+const relayTimeout = 3 * time.Minute
+
+// RelaySink re-sends SMS as SMS to RELAY_NUMBER, like the carrier's call
+// forwarding but for texts. Only SMS a RULES_FILE relay action selected are
+// relayed, to the action's number if it names one; the others pass. The
+// text is prefixed with the original sender. The SMS goes through the
+// Outbox, so it is sent between SIM polls and DRY_RUN only logs it; the
+// received SMS stays on the SIM until the relayed one was submitted.
+type RelaySink struct {
+	number string
+	outbox *Outbox
+}
+
+func NewRelaySink(number string, outbox *Outbox) *RelaySink {
+	return &RelaySink{number: number, outbox: outbox}
+}
+
+func (s *RelaySink) Name() string { return "relay" }
+
+func (s *RelaySink) Send(ctx context.Context, pending PendingSMS) error {
+	if !pending.Relay {
+		return nil
+	}
+	to := s.number
+	if pending.RelayTo != "" {
+		to = pending.RelayTo
+	}
+	// Two gateways relaying to each other would ping-pong forever.
+	if pending.Message.From == to || pending.Message.From == s.number {
+		slog.InfoContext(ctx, "Not relaying SMS from the relay number back to it")
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, relayTimeout)
+	defer cancel()
+	res, err := s.outbox.Send(ctx, to, relayText(pending))
+	switch {
+	case errors.Is(err, errInvalidSMS), errors.Is(err, errTextModeSend):
+		return fmt.Errorf("%w: %v", errSinkRejected, err)
+	case err != nil:
+		return fmt.Errorf("relaying SMS: %w", err)
+	}
+	slog.InfoContext(ctx, "SMS relayed", "parts", res.Parts)
+	return nil
+}
+
+// relayText is the relayed SMS: the recipient only sees the gateway's
+// number as the sender.
+func relayText(pending PendingSMS) string {
+	return pending.Message.From + ": " + pending.Message.Text
+}
@@ -0,0 +1,73 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRelaySink(t *testing.T) {
+	const number = "+4915550001234"
+	bank := PendingSMS{Message: SMSMessage{From: "Bank", Text: "Your code 4711"}, PartIndices: []int{1}, Relay: true}
+
+	t.Run("relayed", func(t *testing.T) {
+		submitter := &fakeSubmitter{}
+		outbox := NewOutbox(false)
+		var got outgoingSMS
+		go func() {
+			got = <-outbox.pending()
+			outbox.submit(submitter, got)
+		}()
+		if err := NewRelaySink(number, outbox).Send(context.Background(), bank); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		if got.to != number || len(got.parts) != 1 || got.parts[0] != "Bank: Your code 4711" || len(submitter.cmds) != 1 {
+			t.Errorf("relayed %q to %q, modem saw %v", got.parts, got.to, submitter.cmds)
+		}
+	})
+
+	t.Run("number of the rule", func(t *testing.T) {
+		outbox := NewOutbox(true)
+		var got outgoingSMS
+		go func() {
+			got = <-outbox.pending()
+			outbox.submit(&fakeSubmitter{}, got)
+		}()
+		pending := bank
+		pending.RelayTo = "+4915550009999"
+		if err := NewRelaySink(number, outbox).Send(context.Background(), pending); err != nil || got.to != pending.RelayTo {
+			t.Errorf("Send() = %v, relayed to %q; want %s", err, got.to, pending.RelayTo)
+		}
+	})
+
+	// Neither an unselected SMS nor one from the relay number is sent: a
+	// Outbox nobody serves would block.
+	for _, pending := range []PendingSMS{
+		{Message: SMSMessage{From: "Bank", Text: "hi"}},
+		{Message: SMSMessage{From: number, Text: "Bank: Your code 4711"}, Relay: true},
+	} {
+		if err := NewRelaySink(number, NewOutbox(false)).Send(context.Background(), pending); err != nil {
+			t.Errorf("Send(%+v) error = %v, want nil without sending", pending.Message, err)
+		}
+	}
+
+	t.Run("text mode rejects", func(t *testing.T) {
+		outbox := NewOutbox(false)
+		go func() { outbox.refuse(<-outbox.pending(), errTextModeSend) }()
+		if err := NewRelaySink(number, outbox).Send(context.Background(), bank); !errors.Is(err, errSinkRejected) {
+			t.Errorf("Send() error = %v, want errSinkRejected", err)
+		}
+	})
+
+	t.Run("modem busy retries", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := NewRelaySink(number, NewOutbox(false)).Send(ctx, bank)
+		if !errors.Is(err, errOutboxStopped) || errors.Is(err, errSinkRejected) {
+			t.Errorf("Send() error = %v, want a transient errOutboxStopped", err)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+// reloadableKeys are the settings RELOAD_FILE may hold. They only affect
+// who receives an SMS and in what form, never the modem session, so they can
+// be swapped without reopening the serial port. RULES_FILE is re-read on
+// every reload even when its path is unchanged.
+var reloadableKeys = []string{
+	"TELEGRAM_CHAT_IDS", "ROUTING_RULES", "BLOCKED_SENDERS", "QUIET_HOURS", "PRIORITY_SENDERS",
+	"RULES_FILE",
+}
+
+// reloadableEnv snapshots the process environment of the reloadable keys,
+// taken before RELOAD_FILE is first applied: a key later removed from the
+// file falls back to it.
+func reloadableEnv() map[string]string {
+	base := make(map[string]string, len(reloadableKeys))
+	for _, key := range reloadableKeys {
+		base[key] = os.Getenv(key)
+	}
+	return base
+}
+
+// readReloadFile parses RELOAD_FILE: KEY=value lines as in a systemd
+// EnvironmentFile (blank lines and # comments skipped, one level of
+// surrounding quotes removed). Only reloadable keys are accepted.
+func readReloadFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading RELOAD_FILE: %w", err)
+	}
+	vars := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok {
+			return nil, fmt.Errorf("RELOAD_FILE line %d: want KEY=value", i+1)
+		}
+		if !slices.Contains(reloadableKeys, key) {
+			return nil, fmt.Errorf("RELOAD_FILE line %d: %s cannot be reloaded (allowed: %s)",
+				i+1, key, strings.Join(reloadableKeys, ", "))
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// loadConfigWithReloadFile overlays RELOAD_FILE (when set) on base and the
+// environment, then runs the regular loadConfig, so reloaded values get
+// exactly the startup validation.
+func loadConfigWithReloadFile(base map[string]string) (*Config, error) {
+	if path := os.Getenv("RELOAD_FILE"); path != "" {
+		vars, err := readReloadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range reloadableKeys {
+			value, ok := vars[key]
+			if !ok {
+				value = base[key]
+			}
+			os.Setenv(key, value)
+		}
+	}
+	return loadConfig()
+}
+
+// ConfigReloader re-reads the configuration on SIGHUP and hands valid
+// results to the delivery goroutine, which owns the settings they replace. An
+// invalid file is logged and the running configuration stays in effect.
+type ConfigReloader struct {
+	base    map[string]string
+	updates chan *Config
+}
+
+func NewConfigReloader(base map[string]string) *ConfigReloader {
+	return &ConfigReloader{base: base, updates: make(chan *Config, 1)}
+}
+
+// Run reloads on every signal from hup until ctx ends.
+func (r *ConfigReloader) Run(ctx context.Context, hup <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		if os.Getenv("RELOAD_FILE") == "" {
+			slog.Warn("SIGHUP ignored: RELOAD_FILE is not set")
+			continue
+		}
+		next, err := loadConfigWithReloadFile(r.base)
+		if err != nil {
+			slog.Error("Configuration reload failed, keeping the running configuration", "error", err)
+			continue
+		}
+		// Keep only the newest config when the modem loop has not taken the
+		// previous one yet.
+		select {
+		case stale := <-r.updates:
+			stale.SIMPIN.wipe()
+		default:
+		}
+		r.updates <- next
+	}
+}
+
+// pending returns the reload channel for the modem loop's select; nil
+// (never ready) for a nil reloader.
+func (r *ConfigReloader) pending() <-chan *Config {
+	if r == nil {
+		return nil
+	}
+	return r.updates
+}
+
+// applyReload copies the reloadable settings of next into the running
+// configuration. Runs on the delivery goroutine (StartQueue), the only
+// reader of these fields besides the blocklist (which locks). The SIM_PIN
+// next parsed again is wiped: the session keeps the one of the start.
+func applyReload(cfg, next *Config, deliverer *Deliverer) {
+	next.SIMPIN.wipe()
+	cfg.ChatIDs = next.ChatIDs
+	cfg.RoutingRules = next.RoutingRules
+	cfg.Rules = next.Rules
+	cfg.QuietHours = next.QuietHours
+	cfg.PrioritySenders = next.PrioritySenders
+	cfg.BlockedSenders = next.BlockedSenders
+	deliverer.notifier.SetChatIDs(next.ChatIDs)
+	deliverer.telegram.setPrioritySenders(next.PrioritySenders)
+	deliverer.blocklist.SetStatic(next.BlockedSenders)
+	slog.Info("Configuration reloaded",
+		"chat_ids", next.ChatIDs,
+		"routing_rules", len(next.RoutingRules),
+		"rules", len(next.Rules),
+		"blocked_senders", len(next.BlockedSenders),
+		"quiet_hours", next.QuietHours.String(),
+		"priority_senders", len(next.PrioritySenders),
+	)
+}
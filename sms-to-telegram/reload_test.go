@@ -0,0 +1,122 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func writeReloadFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadReloadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reload.env")
+	writeReloadFile(t, path, "# recipients\n\nTELEGRAM_CHAT_IDS=\"7, 8\"\nROUTING_RULES=Mon-Fri 09:00-18:00=7; *=8\nQUIET_HOURS=''\n")
+	vars, err := readReloadFile(path)
+	if err != nil {
+		t.Fatalf("readReloadFile() error = %v", err)
+	}
+	want := map[string]string{
+		"TELEGRAM_CHAT_IDS": "7, 8",
+		"ROUTING_RULES":     "Mon-Fri 09:00-18:00=7; *=8",
+		"QUIET_HOURS":       "",
+	}
+	if len(vars) != len(want) {
+		t.Fatalf("vars = %q, want %q", vars, want)
+	}
+	for k, v := range want {
+		if vars[k] != v {
+			t.Errorf("%s = %q, want %q", k, vars[k], v)
+		}
+	}
+
+	for _, content := range []string{"SERIAL_PORT=/dev/ttyUSB1\n", "TELEGRAM_CHAT_IDS\n"} {
+		writeReloadFile(t, path, content)
+		if _, err := readReloadFile(path); err == nil {
+			t.Errorf("readReloadFile(%q) should fail", content)
+		}
+	}
+}
+
+func TestLoadConfigWithReloadFile(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("TELEGRAM_BOT_TOKEN", "123:abc")
+	t.Setenv("TELEGRAM_CHAT_IDS", "42")
+	base := reloadableEnv()
+	path := filepath.Join(t.TempDir(), "reload.env")
+	t.Setenv("RELOAD_FILE", path)
+
+	writeReloadFile(t, path, "TELEGRAM_CHAT_IDS=7,8\nBLOCKED_SENDERS=Spam\n")
+	cfg, err := loadConfigWithReloadFile(base)
+	if err != nil {
+		t.Fatalf("loadConfigWithReloadFile() error = %v", err)
+	}
+	if !slices.Equal(cfg.ChatIDs, []int64{7, 8}) || !slices.Equal(cfg.BlockedSenders, []string{"Spam"}) {
+		t.Errorf("ChatIDs = %v, BlockedSenders = %v", cfg.ChatIDs, cfg.BlockedSenders)
+	}
+
+	// Keys removed from the file fall back to the original environment.
+	writeReloadFile(t, path, "BLOCKED_SENDERS=Spam\n")
+	if cfg, err = loadConfigWithReloadFile(base); err != nil || !slices.Equal(cfg.ChatIDs, []int64{42}) {
+		t.Errorf("after removing TELEGRAM_CHAT_IDS: ChatIDs = %v, err = %v", cfg.ChatIDs, err)
+	}
+
+	writeReloadFile(t, path, "TELEGRAM_CHAT_IDS=0\n")
+	if _, err := loadConfigWithReloadFile(base); err == nil {
+		t.Error("invalid chat ID in RELOAD_FILE should fail validation")
+	}
+}
+
+func TestConfigReloader_AppliesOnSIGHUP(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("TELEGRAM_BOT_TOKEN", "123:abc")
+	t.Setenv("TELEGRAM_CHAT_IDS", "100,200")
+	t.Setenv("SIM_PIN", "1234")
+	path := filepath.Join(t.TempDir(), "reload.env")
+	t.Setenv("RELOAD_FILE", path)
+	writeReloadFile(t, path, "TELEGRAM_CHAT_IDS=300\nBLOCKED_SENDERS=+491701234\nPRIORITY_SENDERS=Bank\n")
+
+	reloader := NewConfigReloader(reloadableEnv())
+	hup := make(chan os.Signal, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Run(ctx, hup)
+	hup <- syscall.SIGHUP
+
+	var next *Config
+	select {
+	case next = <-reloader.pending():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no configuration after SIGHUP")
+	}
+
+	cfg := testConfig()
+	deliverer, _, _ := newTestDeliverer(cfg)
+	deliverer.blocklist, _ = NewSenderBlocklist(nil, "")
+	pin := next.SIMPIN.b
+	applyReload(cfg, next, deliverer)
+
+	if next.SIMPIN.set() || string(pin) != "\x00\x00\x00\x00" {
+		t.Errorf("reloaded SIM_PIN not wiped: %q", pin)
+	}
+	if !slices.Equal(cfg.ChatIDs, []int64{300}) || !slices.Equal(deliverer.notifier.chatIDs, []int64{300}) {
+		t.Errorf("chat IDs = %v (notifier %v), want [300]", cfg.ChatIDs, deliverer.notifier.chatIDs)
+	}
+	if !deliverer.blocklist.Blocked("+49 170 1234") {
+		t.Error("reloaded BLOCKED_SENDERS entry not blocked")
+	}
+	if !deliverer.telegram.isPriority("BANK") {
+		t.Error("reloaded PRIORITY_SENDERS entry not priority")
+	}
+}
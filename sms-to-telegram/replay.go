@@ -0,0 +1,216 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
+)
+
+// replay: captured PDUs go through the code that handles a SIM listing
+// (listSMSMessages: decoding, raw fallback, multipart assembly) and the
+// Telegram formatting, one file at a time, so a parser change can be checked
+// against real traffic before it meets the SIM. Nothing is sent.
+
+// replayPDU is one captured PDU and where it was read.
+type replayPDU struct {
+	source string // file:line
+	raw    string
+}
+
+// replayStats counts the outcomes of a replay run.
+type replayStats struct {
+	pdus, messages, raw, incomplete, reports, skipped, errors int
+}
+
+func cmdReplay(args []string, stdout, stderr io.Writer) int {
+	fs := newCommandFlags("replay", stderr)
+	showFormat := fs.Bool("format", false, "also print the Telegram message (HTML) of every SMS")
+	verbose := fs.Bool("v", false, "log listing and multipart details at DEBUG level")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	cliLogging(stderr, *verbose)
+	files, err := replayFiles(fs.Args())
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+
+	var stats replayStats
+	for _, path := range files {
+		pdus, err := readPDUCorpus(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return 1
+		}
+		replayListing(stdout, pdus, *showFormat, &stats)
+	}
+	fmt.Fprintf(stdout, "\n%d PDUs: %d SMS, %d raw fallback, %d incomplete multipart, %d status reports, %d skipped, %d errors\n",
+		stats.pdus, stats.messages, stats.raw, stats.incomplete, stats.reports, stats.skipped, stats.errors)
+	if stats.raw > 0 || stats.errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+// replayFiles expands the arguments: files as given, directories to their
+// regular files, recursively and in name order.
+func replayFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && d.Type().IsRegular() {
+				files = append(files, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// readPDUCorpus reads one hex PDU per line. "#" comments, blank lines and the
+// "+CMGL:" and "OK" lines of a pasted AT+CMGL listing are skipped.
+func readPDUCorpus(path string) ([]replayPDU, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var pdus []replayPDU
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 4096), 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line == "OK" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "+CMGL:") {
+			continue
+		}
+		pdus = append(pdus, replayPDU{source: fmt.Sprintf("%s:%d", path, n), raw: strings.ToUpper(line)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return pdus, nil
+}
+
+// replayListing runs the PDUs of one file through listSMSMessages as one SIM
+// listing, the slot being the position in the file, and prints a line per
+// PDU. The parts of a multipart SMS must therefore share a file.
+func replayListing(w io.Writer, pdus []replayPDU, showFormat bool, stats *replayStats) {
+	stats.pdus += len(pdus)
+	results := make([]string, len(pdus))
+	var listing []string
+	for i, p := range pdus {
+		if err := checkListable(p.raw); err != nil {
+			// It would fail the whole listing on a modem too.
+			results[i] = "error      " + err.Error()
+			stats.errors++
+			continue
+		}
+		header, _ := cmglHeader(i, p.raw)
+		listing = append(listing, header, p.raw)
+	}
+
+	// No MULTIPART_MAX_AGE: a capture is older than any real one.
+	result, err := listSMSMessages(replayCommander(listing), 0)
+	if err != nil {
+		// checkListable vetted every PDU; keep going with the next file.
+		fmt.Fprintf(w, "%s: listing failed: %v\n", pdus[0].source, err)
+		stats.errors++
+		return
+	}
+	var formatted []string
+	for _, pending := range result.Pending {
+		first := pending.PartIndices[0]
+		if pending.RawFallback {
+			results[first] = "raw        " + pending.RawReason
+			stats.raw++
+		} else {
+			msg := pending.Message
+			results[first] = fmt.Sprintf("ok         %s %q", msg.From, msg.Text)
+			if len(pending.PartIndices) > 1 {
+				results[first] = fmt.Sprintf("ok         part 1/%d: %s %q", len(pending.PartIndices), msg.From, msg.Text)
+			}
+			stats.messages++
+		}
+		for part, index := range pending.PartIndices[1:] {
+			results[index] = fmt.Sprintf("ok         part %d/%d of %s", part+2, len(pending.PartIndices), pdus[first].source)
+		}
+		if showFormat {
+			chunks := buildTelegramMessages(pending)
+			formatted = append(formatted, fmt.Sprintf("--- %s\n%s", pdus[first].source, strings.Join(chunks, "\n--- (next chunk)\n")))
+		}
+	}
+	for _, index := range result.StatusReports {
+		results[index] = "report     status report (deleted without forwarding)"
+		stats.reports++
+	}
+	for i, p := range pdus {
+		if results[i] != "" {
+			continue
+		}
+		// Left on the SIM by listSMSMessages: find out why.
+		part, err := pdu.Parse(p.raw)
+		var notDeliver *pdu.NotDeliverError
+		switch {
+		case errors.As(err, &notDeliver):
+			results[i] = fmt.Sprintf("skipped    not an SMS-DELIVER (MTI %d)", notDeliver.MTI)
+			stats.skipped++
+		case err == nil && part.IsMultipart:
+			results[i] = fmt.Sprintf("incomplete part %d/%d, reference %d: other parts missing or conflicting", part.PartNumber, part.TotalParts, part.MultipartRef)
+			stats.incomplete++
+		default:
+			results[i] = "skipped    not forwarded"
+			stats.skipped++
+		}
+	}
+
+	for i, p := range pdus {
+		fmt.Fprintf(w, "%s  %s\n", p.source, results[i])
+	}
+	for _, f := range formatted {
+		fmt.Fprintf(w, "\n%s\n", f)
+	}
+}
+
+// replayCommander answers AT+CMGL=4 with a fixed listing.
+type replayCommander []string
+
+func (c replayCommander) Command(cmd string) ([]string, error) {
+	return c.CommandWithTimeout(cmd, 0)
+}
+
+func (c replayCommander) CommandWithTimeout(cmd string, _ time.Duration) ([]string, error) {
+	if cmd != "AT+CMGL=4" {
+		return nil, fmt.Errorf("replay: unexpected command %s", cmd)
+	}
+	return slices.Clone(c), nil
+}
+
+func (c replayCommander) Ping() error { return nil }
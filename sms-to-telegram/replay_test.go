@@ -0,0 +1,72 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCmdReplay(t *testing.T) {
+	defaultLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+	dir := t.TempDir()
+	files := map[string]string{
+		// A pasted listing: headers and OK are skipped, the parts assembled.
+		"a/listing.txt": "+CMGL: 3,1,,30\n" + pduGSM7Part2 + "\n+CMGL: 1,1,,29\n" + testPDUSingle + "\n" +
+			pduStatusReport + "\n" + pduGSM7Part1 + "\nOK\n",
+		// The other file's parts are not seen here.
+		"b.txt": "# one part only\n\n" + pduGSM7Part1 + "\n" + pduAlphaSender + "\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := runCLI([]string{"replay", "-format", dir}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d\nstdout: %s\nstderr: %s", code, stdout.String(), stderr.String())
+	}
+	out := stdout.String()
+	for _, want := range []string{
+		"listing.txt:2  ok         part 2/2 of ",
+		"listing.txt:4  ok         +358449480778 \"Тест1\"",
+		"listing.txt:5  report     status report",
+		"listing.txt:6  ok         part 1/2: +358449480778 \"HelloWorld\"",
+		"b.txt:3  incomplete part 1/2, reference 42",
+		"b.txt:4  ok         Google \"Hello\"",
+		"<b>From:</b> <code>Google</code>",
+		"6 PDUs: 3 SMS, 0 raw fallback, 1 incomplete multipart, 1 status reports, 0 skipped, 0 errors",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+
+	// Undecodable and unlistable PDUs fail the run.
+	bad := filepath.Join(dir, "bad.txt")
+	if err := os.WriteFile(bad, []byte("zz\n0791534874894370440C9153489484708700005221112183058012\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	if code := runCLI([]string{"replay", bad}, &stdout, &stderr); code != 1 {
+		t.Errorf("exit code = %d, want 1:\n%s", code, stdout.String())
+	}
+	if out := stdout.String(); !strings.Contains(out, "bad.txt:1  error ") || !strings.Contains(out, "bad.txt:2  raw ") {
+		t.Errorf("output lacks the error and raw lines:\n%s", out)
+	}
+
+	if code := runCLI([]string{"replay", filepath.Join(dir, "missing")}, &stdout, &stderr); code != 1 {
+		t.Errorf("missing file: exit code = %d, want 1", code)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RoutingRule sends SMS received inside Window to ChatIDs. A nil Window
+// ("*") matches any time.
+type RoutingRule struct {
+	Window  *TimeWindow
+	ChatIDs []int64
+}
+
+// parseRoutingRules parses ROUTING_RULES: "window=chat,chat; window=chat",
+// e.g. "Mon-Fri 09:00-18:00=100,200; *=300". Rules are tried in order.
+func parseRoutingRules(s string) ([]RoutingRule, error) {
+	var rules []RoutingRule
+	for _, ruleStr := range strings.Split(s, ";") {
+		ruleStr = strings.TrimSpace(ruleStr)
+		if ruleStr == "" {
+			continue
+		}
+		windowStr, chatsStr, ok := strings.Cut(ruleStr, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule %q (use window=chat_id,...)", ruleStr)
+		}
+		var rule RoutingRule
+		if windowStr = strings.TrimSpace(windowStr); windowStr != "*" {
+			window, err := ParseTimeWindow(windowStr)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", ruleStr, err)
+			}
+			rule.Window = window
+		}
+		chatIDs, err := parseIDList(chatsStr, "chat ID")
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", ruleStr, err)
+		}
+		if len(chatIDs) == 0 {
+			return nil, fmt.Errorf("rule %q: no chat IDs", ruleStr)
+		}
+		rule.ChatIDs = chatIDs
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// routeChats returns the chats of the first rule matching now, or defaults
+// (TELEGRAM_CHAT_IDS) when none matches.
+func routeChats(rules []RoutingRule, defaults []int64, now time.Time) []int64 {
+	for _, rule := range rules {
+		if rule.Window == nil || rule.Window.Contains(now) {
+			return rule.ChatIDs
+		}
+	}
+	return defaults
+}
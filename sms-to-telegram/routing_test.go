@@ -0,0 +1,59 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRouteChats(t *testing.T) {
+	rules, err := parseRoutingRules("Mon-Fri 09:00-18:00=100,200; Sat,Sun=300 ;")
+	if err != nil {
+		t.Fatalf("parseRoutingRules() error = %v", err)
+	}
+	defaults := []int64{900}
+	// 2026-03-10 is a Tuesday.
+	at := func(day, h int) time.Time { return time.Date(2026, 3, day, h, 0, 0, 0, time.Local) }
+	tests := []struct {
+		now  time.Time
+		want []int64
+	}{
+		{at(10, 10), []int64{100, 200}},
+		{at(10, 20), defaults},
+		{at(14, 10), []int64{300}},
+		{at(15, 23), []int64{300}},
+	}
+	for _, tt := range tests {
+		if got := routeChats(rules, defaults, tt.now); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("routeChats(%s) = %v, want %v", tt.now.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+
+	catchAll, err := parseRoutingRules("Sat 10:00-12:00=1; * = 2")
+	if err != nil {
+		t.Fatalf("parseRoutingRules() error = %v", err)
+	}
+	if got := routeChats(catchAll, defaults, at(10, 10)); fmt.Sprint(got) != "[2]" {
+		t.Errorf("routeChats() = %v, want catch-all [2]", got)
+	}
+	if got := routeChats(nil, defaults, at(10, 10)); fmt.Sprint(got) != "[900]" {
+		t.Errorf("routeChats() without rules = %v, want defaults", got)
+	}
+}
+
+func TestParseRoutingRulesInvalid(t *testing.T) {
+	for _, s := range []string{
+		"Mon-Fri 09:00-18:00",
+		"Mon-Fri 09:00-18:00=",
+		"Mon-Fri 09:00-18:00=abc",
+		"Someday=100",
+		"*=0",
+	} {
+		if _, err := parseRoutingRules(s); err == nil {
+			t.Errorf("parseRoutingRules(%q) should fail", s)
+		}
+	}
+}
@@ -0,0 +1,701 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
+)
+
+// RULES_FILE is the one place for per-message decisions: who gets an SMS
+// (Telegram chats, webhooks, the relay), in what form, and which SMS are
+// dropped. ROUTING_RULES and BLOCKED_SENDERS remain as shorthands; the
+// blocklist runs before the rules and ROUTING_RULES picks the chats of SMS
+// no rule routed. The language is deliberately small (no CEL or Starlark:
+// the binary stays free of interpreter dependencies). One rule per line,
+// blank lines and # comments skipped:
+//
+//	if <condition> then <action>; <action>...
+//
+// Conditions: from, text and smsc compared with == / != to a string or
+// matched with ~ against a regular expression (RE2); parts compared with
+// == != < <= > >= to a number; class compared with == / != to the TP-DCS
+// message class 0-3 (0: flash SMS); `time in "<window>"` (QUIET_HOURS syntax,
+// local time of processing); raw (an undecodable PDU forwarded as hex);
+// true. They combine with not, and, or and parentheses. Strings are Go
+// literals, "..." with escapes or `...` raw.
+//
+// Actions: route <chat>,... (Telegram chats instead of ROUTING_RULES);
+// text = "<template>" ($1-$9: capture groups of the last regular expression
+// the condition matched, $from, $text, $$); drop (delete without
+// forwarding, like a blocked sender); relay ["<number>"] (re-send it as SMS
+// to the number or RELAY_NUMBER as well, relay.go); webhook <n>,... or
+// webhook none (only these WEBHOOK_URLS entries get it); tag "<name>",...
+// (labels in Telegram and the sink payloads); extract (the named groups,
+// (?P<name>...), of the regular expressions the condition matched become
+// fields of the sink payloads); stop (skip the later rules).
+//
+// Every matching rule applies, in file order, each seeing the SMS as the
+// rules before it left it.
+
+// Rule is one RULES_FILE line.
+type Rule struct {
+	Line    int
+	cond    ruleExpr
+	route   []int64
+	text    *string // template; nil keeps the text
+	drop    bool
+	relay   bool
+	relayTo string // "": RELAY_NUMBER
+	// webhooks are sink names (webhook1...); nil keeps the selection.
+	webhooks []string
+	tags     []string
+	extract  bool
+	stop     bool
+	summary  string
+}
+
+// ruleEnv is the SMS a condition is evaluated against.
+type ruleEnv struct {
+	pending *PendingSMS
+	now     time.Time
+	// captures of the last regular expression that matched; named the
+	// named groups of every one that matched.
+	captures []string
+	named    map[string]string
+}
+
+func (env *ruleEnv) field(name string) string {
+	switch name {
+	case "from":
+		return env.pending.Message.From
+	case "text":
+		return env.pending.Message.Text
+	default:
+		return env.pending.Message.SMSC
+	}
+}
+
+type ruleExpr interface {
+	eval(env *ruleEnv) bool
+}
+
+type (
+	ruleTrue  struct{}
+	ruleRaw   struct{}
+	ruleNot   struct{ expr ruleExpr }
+	ruleAnd   struct{ left, right ruleExpr }
+	ruleOr    struct{ left, right ruleExpr }
+	ruleMatch struct {
+		field string
+		re    *regexp.Regexp
+	}
+	ruleEquals struct {
+		field, value string
+		negate       bool
+	}
+	ruleParts struct {
+		op string
+		n  int
+	}
+	ruleTime  struct{ window *TimeWindow }
+	ruleClass struct {
+		class  pdu.MessageClass
+		negate bool
+	}
+)
+
+func (ruleTrue) eval(*ruleEnv) bool         { return true }
+func (ruleRaw) eval(env *ruleEnv) bool      { return env.pending.RawFallback }
+func (e ruleNot) eval(env *ruleEnv) bool    { return !e.expr.eval(env) }
+func (e ruleAnd) eval(env *ruleEnv) bool    { return e.left.eval(env) && e.right.eval(env) }
+func (e ruleOr) eval(env *ruleEnv) bool     { return e.left.eval(env) || e.right.eval(env) }
+func (e ruleTime) eval(env *ruleEnv) bool   { return e.window.Contains(env.now) }
+func (e ruleEquals) eval(env *ruleEnv) bool { return (env.field(e.field) == e.value) != e.negate }
+func (e ruleClass) eval(env *ruleEnv) bool  { return (env.pending.Message.Class == e.class) != e.negate }
+
+func (e ruleMatch) eval(env *ruleEnv) bool {
+	m := e.re.FindStringSubmatch(env.field(e.field))
+	if m == nil {
+		return false
+	}
+	env.captures = m
+	for i, name := range e.re.SubexpNames() {
+		if name != "" && m[i] != "" {
+			if env.named == nil {
+				env.named = make(map[string]string)
+			}
+			env.named[name] = m[i]
+		}
+	}
+	return true
+}
+
+func (e ruleParts) eval(env *ruleEnv) bool {
+	parts := len(env.pending.PartIndices)
+	switch e.op {
+	case "==":
+		return parts == e.n
+	case "!=":
+		return parts != e.n
+	case "<":
+		return parts < e.n
+	case "<=":
+		return parts <= e.n
+	case ">":
+		return parts > e.n
+	default:
+		return parts >= e.n
+	}
+}
+
+// expandRuleTemplate fills a text = "..." template.
+func expandRuleTemplate(template string, env *ruleEnv) string {
+	return os.Expand(template, func(name string) string {
+		switch name {
+		case "from":
+			return env.pending.Message.From
+		case "text":
+			return env.pending.Message.Text
+		case "$":
+			return "$"
+		}
+		if i, err := strconv.Atoi(name); err == nil && i < len(env.captures) {
+			return env.captures[i]
+		}
+		return ""
+	})
+}
+
+// evalRules runs the rules over pending. It returns the SMS as the rules
+// left it, and the rule that dropped it (nil when none did).
+func evalRules(rules []Rule, pending PendingSMS, now time.Time) (PendingSMS, *Rule) {
+	for i := range rules {
+		rule := &rules[i]
+		env := &ruleEnv{pending: &pending, now: now}
+		if !rule.cond.eval(env) {
+			continue
+		}
+		slog.Debug("Rule matched", "trace", pending.TraceID, "line", rule.Line, "actions", rule.summary)
+		if rule.drop {
+			return pending, rule
+		}
+		if rule.route != nil {
+			pending.ChatIDs = rule.route
+		}
+		if rule.text != nil {
+			pending.Message.Text = expandRuleTemplate(*rule.text, env)
+		}
+		if rule.relay {
+			pending.Relay, pending.RelayTo = true, rule.relayTo
+		}
+		if rule.webhooks != nil {
+			pending.Webhooks = rule.webhooks
+		}
+		for _, tag := range rule.tags {
+			if !slices.Contains(pending.Tags, tag) {
+				pending.Tags = append(pending.Tags, tag)
+			}
+		}
+		if rule.extract && len(env.named) > 0 {
+			// The map may be shared with the SMS as read from the SIM.
+			fields := maps.Clone(pending.Fields)
+			if fields == nil {
+				fields = make(map[string]string, len(env.named))
+			}
+			maps.Copy(fields, env.named)
+			pending.Fields = fields
+		}
+		if rule.stop {
+			break
+		}
+	}
+	return pending, nil
+}
+
+// applyRules runs RULES_FILE over every SMS: a rule may drop it, route it to
+// other chats and webhooks, rewrite its text, tag it, extract fields or mark
+// it for relaying before the sinks see it.
+func (d *Deliverer) applyRules(next SMSHandler) SMSHandler {
+	return func(ctx context.Context, pending PendingSMS) deliveryStatus {
+		if len(d.cfg.Rules) == 0 {
+			return next(ctx, pending)
+		}
+		changed, dropped := evalRules(d.cfg.Rules, pending, clk.Now())
+		if dropped == nil {
+			return next(ctx, changed)
+		}
+		slog.InfoContext(ctx, "Dropping SMS by rule",
+			"rule_line", dropped.Line,
+			"from", pending.Message.From,
+			"indices", pending.PartIndices,
+			"text_fingerprint", contentFingerprint(pending.Message.Text),
+		)
+		d.finish(messageKey(pending), pending, archiveBlocked, "")
+		return deliveryDropped
+	}
+}
+
+// loadRulesFile reads RULES_FILE; an empty path means no rules.
+func loadRulesFile(path string) ([]Rule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("invalid RULES_FILE %q: must be absolute", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading RULES_FILE: %w", err)
+	}
+	rules, err := parseRules(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("RULES_FILE %w", err)
+	}
+	return rules, nil
+}
+
+// parseRules parses the RULES_FILE content.
+func parseRules(s string) ([]Rule, error) {
+	var rules []Rule
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		rule.Line = i + 1
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ruleToken is one lexical token of a rule.
+type ruleToken struct {
+	kind byte // 'w' word, 's' string, 'n' number, 'o' operator, 0 end of line
+	text string
+}
+
+func (t ruleToken) String() string {
+	if t.kind == 0 {
+		return "end of line"
+	}
+	return strconv.Quote(t.text)
+}
+
+var ruleOperators = []string{"==", "!=", "<=", ">=", "<", ">", "~", "=", "(", ")", ",", ";"}
+
+func lexRule(line string) ([]ruleToken, error) {
+	var toks []ruleToken
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"' || c == '`':
+			quoted, err := strconv.QuotedPrefix(line[i:])
+			if err != nil {
+				return nil, fmt.Errorf("unterminated string at column %d", i+1)
+			}
+			s, err := strconv.Unquote(quoted)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at column %d: %w", i+1, err)
+			}
+			toks = append(toks, ruleToken{'s', s})
+			i += len(quoted)
+		case c >= '0' && c <= '9' || c == '-':
+			j := i + 1
+			for j < len(line) && line[j] >= '0' && line[j] <= '9' {
+				j++
+			}
+			toks = append(toks, ruleToken{'n', line[i:j]})
+			i = j
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_':
+			j := i + 1
+			for j < len(line) && (line[j] >= 'a' && line[j] <= 'z' || line[j] >= 'A' && line[j] <= 'Z' || line[j] == '_') {
+				j++
+			}
+			toks = append(toks, ruleToken{'w', line[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range ruleOperators {
+				if strings.HasPrefix(line[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at column %d", c, i+1)
+			}
+			toks = append(toks, ruleToken{'o', op})
+			i += len(op)
+		}
+	}
+	return toks, nil
+}
+
+type ruleParser struct {
+	toks []ruleToken
+	pos  int
+}
+
+func (p *ruleParser) peek() ruleToken {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ruleToken{}
+}
+
+func (p *ruleParser) next() ruleToken {
+	t := p.peek()
+	if p.pos < len(p.toks) {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is kind/text.
+func (p *ruleParser) accept(kind byte, text string) bool {
+	if t := p.peek(); t.kind == kind && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *ruleParser) expect(kind byte, text string) error {
+	if t := p.next(); t.kind != kind || t.text != text {
+		return fmt.Errorf("want %q, got %s", text, t)
+	}
+	return nil
+}
+
+func (p *ruleParser) expectString(what string) (string, error) {
+	t := p.next()
+	if t.kind != 's' {
+		return "", fmt.Errorf("want %s as a quoted string, got %s", what, t)
+	}
+	return t.text, nil
+}
+
+func parseRule(line string) (Rule, error) {
+	toks, err := lexRule(line)
+	if err != nil {
+		return Rule{}, err
+	}
+	p := &ruleParser{toks: toks}
+	if err := p.expect('w', "if"); err != nil {
+		return Rule{}, err
+	}
+	var rule Rule
+	if rule.cond, err = p.parseOr(); err != nil {
+		return Rule{}, err
+	}
+	if err := p.expect('w', "then"); err != nil {
+		return Rule{}, err
+	}
+	var actions []string
+	for {
+		action := p.next()
+		if action.kind != 'w' {
+			return Rule{}, fmt.Errorf("want an action (route, text, drop, relay, webhook, tag, extract, stop), got %s", action)
+		}
+		switch action.text {
+		case "route":
+			var ids []string
+			for {
+				t := p.next()
+				if t.kind != 'n' {
+					return Rule{}, fmt.Errorf("route: want a chat ID, got %s", t)
+				}
+				ids = append(ids, t.text)
+				if !p.accept('o', ",") {
+					break
+				}
+			}
+			if rule.route, err = parseIDList(strings.Join(ids, ","), "chat ID"); err != nil {
+				return Rule{}, fmt.Errorf("route: %w", err)
+			}
+		case "text":
+			if err := p.expect('o', "="); err != nil {
+				return Rule{}, fmt.Errorf("text: %w", err)
+			}
+			template, err := p.expectString("the text template")
+			if err != nil {
+				return Rule{}, err
+			}
+			if err := checkRuleTemplate(template); err != nil {
+				return Rule{}, err
+			}
+			rule.text = &template
+		case "drop":
+			rule.drop = true
+		case "relay":
+			rule.relay = true
+			if p.peek().kind == 's' {
+				rule.relayTo = p.next().text
+				if !validDestination(rule.relayTo) {
+					return Rule{}, fmt.Errorf("relay: %q is not a phone number", rule.relayTo)
+				}
+			}
+		case "webhook":
+			if rule.webhooks, err = p.parseWebhooks(); err != nil {
+				return Rule{}, fmt.Errorf("webhook: %w", err)
+			}
+		case "extract":
+			if !hasNamedGroups(rule.cond) {
+				return Rule{}, fmt.Errorf("extract: the condition has no regular expression with named groups (?P<name>...)")
+			}
+			rule.extract = true
+		case "tag":
+			for {
+				tag, err := p.expectString("the tag")
+				if err != nil {
+					return Rule{}, fmt.Errorf("tag: %w", err)
+				}
+				if !validTag(tag) {
+					return Rule{}, fmt.Errorf("tag: %q must be 1 to 32 letters, digits or _", tag)
+				}
+				rule.tags = append(rule.tags, tag)
+				if !p.accept('o', ",") {
+					break
+				}
+			}
+		case "stop":
+			rule.stop = true
+		default:
+			return Rule{}, fmt.Errorf("unknown action %q (use route, text, drop, relay, webhook, tag, extract or stop)", action.text)
+		}
+		actions = append(actions, action.text)
+		if !p.accept('o', ";") {
+			break
+		}
+	}
+	if t := p.next(); t.kind != 0 {
+		return Rule{}, fmt.Errorf("unexpected %s after the actions", t)
+	}
+	if rule.drop && (rule.route != nil || rule.text != nil || rule.relay || rule.webhooks != nil || rule.tags != nil || rule.extract) {
+		return Rule{}, fmt.Errorf("drop can only be combined with stop")
+	}
+	rule.summary = strings.Join(actions, ",")
+	return rule, nil
+}
+
+// parseWebhooks parses the operand of a webhook action: none, or 1-based
+// WEBHOOK_URLS positions as sink names.
+func (p *ruleParser) parseWebhooks() ([]string, error) {
+	if p.accept('w', "none") {
+		return []string{}, nil
+	}
+	var names []string
+	for {
+		t := p.next()
+		n, err := strconv.Atoi(t.text)
+		if t.kind != 'n' || err != nil || n < 1 {
+			return nil, fmt.Errorf("want none or a WEBHOOK_URLS position (1, 2, ...), got %s", t)
+		}
+		names = append(names, fmt.Sprintf("webhook%d", n))
+		if !p.accept('o', ",") {
+			return names, nil
+		}
+	}
+}
+
+// hasNamedGroups reports whether a condition has a regular expression with
+// named groups for extract.
+func hasNamedGroups(expr ruleExpr) bool {
+	switch e := expr.(type) {
+	case ruleMatch:
+		return slices.ContainsFunc(e.re.SubexpNames(), func(name string) bool { return name != "" })
+	case ruleNot:
+		return hasNamedGroups(e.expr)
+	case ruleAnd:
+		return hasNamedGroups(e.left) || hasNamedGroups(e.right)
+	case ruleOr:
+		return hasNamedGroups(e.left) || hasNamedGroups(e.right)
+	}
+	return false
+}
+
+// validTag accepts what Telegram renders as a hashtag.
+func validTag(tag string) bool {
+	if tag == "" || len(tag) > 32 {
+		return false
+	}
+	for _, c := range tag {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// checkRules checks the rules against the rest of the configuration: a
+// relay needs RELAY_NUMBER, a webhook action existing WEBHOOK_URLS entries.
+func checkRules(rules []Rule, relayNumber string, webhooks int) error {
+	for _, rule := range rules {
+		if rule.relay && relayNumber == "" {
+			return fmt.Errorf("RULES_FILE line %d: relay needs RELAY_NUMBER", rule.Line)
+		}
+		for _, name := range rule.webhooks {
+			if n, _ := strconv.Atoi(strings.TrimPrefix(name, "webhook")); n > webhooks {
+				return fmt.Errorf("RULES_FILE line %d: webhook %d: WEBHOOK_URLS has %d entries", rule.Line, n, webhooks)
+			}
+		}
+	}
+	return nil
+}
+
+// checkRuleTemplate rejects placeholders expandRuleTemplate does not know.
+func checkRuleTemplate(template string) error {
+	var unknown string
+	os.Expand(template, func(name string) string {
+		if n, err := strconv.Atoi(name); err == nil && n >= 0 && n <= 9 {
+			return ""
+		}
+		if name != "from" && name != "text" && name != "$" && unknown == "" {
+			unknown = name
+		}
+		return ""
+	})
+	if unknown != "" {
+		return fmt.Errorf("text: unknown placeholder $%s (use $1-$9, $from, $text or $$)", unknown)
+	}
+	return nil
+}
+
+func (p *ruleParser) parseOr() (ruleExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept('w', "or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = ruleOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *ruleParser) parseAnd() (ruleExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept('w', "and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = ruleAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *ruleParser) parseUnary() (ruleExpr, error) {
+	if p.accept('w', "not") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return ruleNot{expr}, nil
+	}
+	if p.accept('o', "(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect('o', ")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+	return p.parseCondition()
+}
+
+func (p *ruleParser) parseCondition() (ruleExpr, error) {
+	t := p.next()
+	if t.kind != 'w' {
+		return nil, fmt.Errorf("want a condition, got %s", t)
+	}
+	switch t.text {
+	case "true":
+		return ruleTrue{}, nil
+	case "raw":
+		return ruleRaw{}, nil
+	case "from", "text", "smsc":
+		op := p.next()
+		if op.kind != 'o' || (op.text != "~" && op.text != "==" && op.text != "!=") {
+			return nil, fmt.Errorf("%s: want ~, == or !=, got %s", t.text, op)
+		}
+		value, err := p.expectString(t.text + " " + op.text + " operand")
+		if err != nil {
+			return nil, err
+		}
+		if op.text != "~" {
+			return ruleEquals{field: t.text, value: value, negate: op.text == "!="}, nil
+		}
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s ~: %w", t.text, err)
+		}
+		return ruleMatch{field: t.text, re: re}, nil
+	case "class":
+		op := p.next()
+		if op.kind != 'o' || (op.text != "==" && op.text != "!=") {
+			return nil, fmt.Errorf("class: want == or !=, got %s", op)
+		}
+		n := p.next()
+		class, err := strconv.Atoi(n.text)
+		if n.kind != 'n' || err != nil || class < 0 || class > 3 {
+			return nil, fmt.Errorf("class: want 0, 1, 2 or 3, got %s", n)
+		}
+		return ruleClass{class: pdu.Class0 + pdu.MessageClass(class), negate: op.text == "!="}, nil
+	case "parts":
+		op := p.next()
+		switch op.text {
+		case "==", "!=", "<", "<=", ">", ">=":
+		default:
+			return nil, fmt.Errorf("parts: want a comparison, got %s", op)
+		}
+		n := p.next()
+		count, err := strconv.Atoi(n.text)
+		if n.kind != 'n' || err != nil {
+			return nil, fmt.Errorf("parts: want a number, got %s", n)
+		}
+		return ruleParts{op: op.text, n: count}, nil
+	case "time":
+		if err := p.expect('w', "in"); err != nil {
+			return nil, fmt.Errorf("time: %w", err)
+		}
+		spec, err := p.expectString("the time window")
+		if err != nil {
+			return nil, err
+		}
+		window, err := ParseTimeWindow(spec)
+		if err != nil {
+			return nil, fmt.Errorf("time: %w", err)
+		}
+		return ruleTime{window}, nil
+	default:
+		return nil, fmt.Errorf("unknown condition %q (use from, text, smsc, parts, class, time, raw or true)", t.text)
+	}
+}
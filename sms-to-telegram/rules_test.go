@@ -0,0 +1,275 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
+)
+
+func TestParseRules_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+		want string
+	}{
+		{"missing if", `from == "x" then drop`, `want "if"`},
+		{"missing then", `if from == "x" drop`, `want "then"`},
+		{"no action", `if true then`, "want an action"},
+		{"unknown action", `if true then forward`, "unknown action"},
+		{"unknown condition", `if sender == "x" then drop`, "unknown condition"},
+		{"unquoted operand", `if from == bank then drop`, "quoted string"},
+		{"bad regexp", `if text ~ "(" then drop`, "text ~"},
+		{"bad window", `if time in "25:00-07:00" then drop`, "time:"},
+		{"parts operator", `if parts ~ "2" then drop`, "parts: want a comparison"},
+		{"unterminated string", `if from == "x then drop`, "unterminated string"},
+		{"unbalanced paren", `if (true then drop`, `want ")"`},
+		{"zero chat", `if true then route 0`, "route:"},
+		{"route without chats", `if true then route`, "want a chat ID"},
+		{"placeholder", `if true then text = "$sender"`, "unknown placeholder"},
+		{"drop and route", `if true then drop; route 1`, "only be combined with stop"},
+		{"drop and relay", `if true then relay; drop`, "only be combined with stop"},
+		{"drop and tag", `if true then tag "x"; drop`, "only be combined with stop"},
+		{"class operator", `if class < 1 then drop`, "class: want == or !="},
+		{"class range", `if class == 4 then drop`, "class: want 0, 1, 2 or 3"},
+		{"relay number", `if true then relay "Bank"`, "not a phone number"},
+		{"webhook zero", `if true then webhook 0`, "WEBHOOK_URLS position"},
+		{"webhook word", `if true then webhook all`, "WEBHOOK_URLS position"},
+		{"tag unquoted", `if true then tag otp`, "tag:"},
+		{"extract without groups", `if text ~ "\\d+" then extract`, "no regular expression with named groups"},
+		{"tag characters", `if true then tag "one-time code"`, "letters, digits or _"},
+		{"trailing tokens", `if true then stop stop`, "after the actions"},
+		{"stray character", `if from == "x" & true then drop`, "unexpected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRules("# comment\n\n" + tt.rule)
+			if err == nil || !strings.Contains(err.Error(), tt.want) || !strings.HasPrefix(err.Error(), "line 3: ") {
+				t.Errorf("parseRules(%q) error = %v, want line 3 and %q", tt.rule, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalRules(t *testing.T) {
+	// Saturday 23:30 local time.
+	now := time.Date(2025, 3, 1, 23, 30, 0, 0, time.Local)
+	otp := PendingSMS{
+		Message:     SMSMessage{From: "Bank", Text: "Your code: 123456. Do not share", SMSC: "+79000000000"},
+		PartIndices: []int{1},
+	}
+	long := PendingSMS{Message: SMSMessage{From: "+15550001234", Text: "part1part2"}, PartIndices: []int{2, 3}}
+
+	tests := []struct {
+		name      string
+		rules     string
+		pending   PendingSMS
+		wantText  string
+		wantChats []int64
+		wantRelay bool
+		wantDrop  int
+	}{
+		{
+			name:      "capture rewrite and route",
+			rules:     `if from == "Bank" and text ~ ` + "`code: (\\d+)`" + ` then text = "$from OTP $1 ($$)"; route 300, -100200`,
+			pending:   otp,
+			wantText:  "Bank OTP 123456 ($)",
+			wantChats: []int64{300, -100200},
+		},
+		{
+			name:     "no match keeps SMS",
+			rules:    `if from != "Bank" or parts > 1 then route 300`,
+			pending:  otp,
+			wantText: otp.Message.Text,
+		},
+		{
+			name:     "rules see earlier changes",
+			rules:    "if true then text = \"[$text]\"\nif text ~ `^\\[` then text = \"$text!\"",
+			pending:  long,
+			wantText: "[part1part2]!",
+		},
+		{
+			name:      "stop skips later rules",
+			rules:     "if parts >= 2 then route 1; stop\nif true then route 2",
+			pending:   long,
+			wantText:  long.Message.Text,
+			wantChats: []int64{1},
+		},
+		{
+			name:     "drop in a time window",
+			rules:    "if true then route 5\nif time in \"Sat,Sun 22:00-07:00\" and not (from ~ \"^\\\\+\" or raw) then drop",
+			pending:  otp,
+			wantDrop: 2,
+		},
+		{
+			name:     "time window outside",
+			rules:    `if time in "Mon-Fri" then drop`,
+			pending:  otp,
+			wantText: otp.Message.Text,
+		},
+		{
+			name:      "relay",
+			rules:     "if from == \"Bank\" then relay\nif parts > 1 then relay",
+			pending:   otp,
+			wantText:  otp.Message.Text,
+			wantRelay: true,
+		},
+		{
+			name:      "smsc",
+			rules:     `if smsc ~ "^\\+7" then route 7`,
+			pending:   otp,
+			wantText:  otp.Message.Text,
+			wantChats: []int64{7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := parseRules(tt.rules)
+			if err != nil {
+				t.Fatalf("parseRules() error = %v", err)
+			}
+			got, dropped := evalRules(rules, tt.pending, now)
+			if tt.wantDrop != 0 {
+				if dropped == nil || dropped.Line != tt.wantDrop {
+					t.Fatalf("dropped by %+v, want line %d", dropped, tt.wantDrop)
+				}
+				return
+			}
+			if dropped != nil {
+				t.Fatalf("dropped by line %d", dropped.Line)
+			}
+			if got.Message.Text != tt.wantText || !slices.Equal(got.ChatIDs, tt.wantChats) || got.Relay != tt.wantRelay {
+				t.Errorf("result = %q to %v relay %v, want %q to %v relay %v",
+					got.Message.Text, got.ChatIDs, got.Relay, tt.wantText, tt.wantChats, tt.wantRelay)
+			}
+		})
+	}
+}
+
+// The sink selection actions accumulate tags and let later rules replace the
+// relay number and the webhooks.
+func TestEvalRules_SinkActions(t *testing.T) {
+	rules, err := parseRules(`if class == 0 then tag "flash"; webhook none
+if from == "Bank" then tag "bank", "flash"; relay
+if text ~ "code" then relay "+4915550009999"; webhook 2, 3
+if class != 0 then tag "never"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flash := PendingSMS{Message: SMSMessage{From: "Bank", Text: "code 1", Class: pdu.Class0}}
+	got, _ := evalRules(rules, flash, time.Now())
+	if !slices.Equal(got.Tags, []string{"flash", "bank"}) || !got.Relay || got.RelayTo != "+4915550009999" ||
+		!slices.Equal(got.Webhooks, []string{"webhook2", "webhook3"}) {
+		t.Errorf("flash SMS: tags %v, relay %v to %q, webhooks %v", got.Tags, got.Relay, got.RelayTo, got.Webhooks)
+	}
+
+	plain := PendingSMS{Message: SMSMessage{From: "Shop", Text: "sale"}}
+	got, _ = evalRules(rules[:1], plain, time.Now())
+	if got.Tags != nil || got.Webhooks != nil || got.Relay {
+		t.Errorf("unmatched SMS: tags %v, webhooks %v, relay %v", got.Tags, got.Webhooks, got.Relay)
+	}
+	got, _ = evalRules(rules, PendingSMS{Message: SMSMessage{Class: pdu.Class0}}, time.Now())
+	if got.Webhooks == nil || len(got.Webhooks) != 0 {
+		t.Errorf("webhook none: webhooks = %#v, want empty", got.Webhooks)
+	}
+}
+
+// extract collects the named groups of every regular expression the
+// condition matched; later rules add to and overwrite the fields.
+func TestEvalRules_Extract(t *testing.T) {
+	rules, err := parseRules(`if from ~ "^(?P<bank>[A-Z][a-z]+)$" and text ~ ` + "`code (?P<otp>\\d+)(?: valid (?P<minutes>\\d+))?`" + ` then extract
+if text ~ "(?P<otp>\\d{2})$" then extract`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := PendingSMS{Message: SMSMessage{From: "Bank", Text: "code 4711"}}
+	got, _ := evalRules(rules, original, time.Now())
+	if want := map[string]string{"bank": "Bank", "otp": "11"}; !maps.Equal(got.Fields, want) {
+		t.Errorf("Fields = %v, want %v (unmatched group left out)", got.Fields, want)
+	}
+	if original.Fields != nil {
+		t.Error("evalRules changed the fields of the SMS it was given")
+	}
+}
+
+func TestCheckRules(t *testing.T) {
+	rules, err := parseRules("if true then webhook 1\n\nif true then relay \"+4915550009999\"; webhook 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		relay    string
+		webhooks int
+		want     string
+	}{
+		{"+4915550001234", 2, ""},
+		{"", 2, "line 3: relay needs RELAY_NUMBER"},
+		{"+4915550001234", 1, "line 3: webhook 2: WEBHOOK_URLS has 1 entries"},
+	}
+	for _, tt := range tests {
+		err := checkRules(rules, tt.relay, tt.webhooks)
+		if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("checkRules(%q, %d) error = %v, want %q", tt.relay, tt.webhooks, err, tt.want)
+		}
+	}
+}
+
+// TestDeliverer_Rules: the rule step reroutes and rewrites before Telegram,
+// and a dropped SMS reaches no sink.
+func TestDeliverer_Rules(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	cfg := testConfig()
+	rules, err := parseRules("if text ~ `code (\\d+)` then text = \"OTP $1\"; route 300\nif from == \"SPAM\" then drop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Rules = rules
+	deliverer, sender, _ := newTestDeliverer(cfg)
+	sink := &fakeSink{name: "webhook"}
+	deliverer.AddSink(sink)
+
+	otp := PendingSMS{Message: SMSMessage{Index: 1, From: "Bank", Text: "Your code 4711"}, PartIndices: []int{1}}
+	if got := deliverer.Deliver(context.Background(), otp); got != deliveryDone {
+		t.Fatalf("Deliver() = %v, want deliveryDone", got)
+	}
+	if len(sender.sentTo(100)) != 0 || len(sender.sentTo(300)) != 1 || !strings.Contains(sender.sentTo(300)[0].Text, "OTP 4711") {
+		t.Errorf("Telegram sends = %+v, want one rewritten SMS to chat 300", sender.sent)
+	}
+	if len(sink.sent) != 1 || sink.sent[0].Message.Text != "OTP 4711" {
+		t.Errorf("webhook got %+v, want the rewritten text", sink.sent)
+	}
+
+	spam := PendingSMS{Message: SMSMessage{Index: 2, From: "SPAM", Text: "buy"}, PartIndices: []int{2}}
+	if got := deliverer.Deliver(context.Background(), spam); got != deliveryDropped {
+		t.Fatalf("Deliver() = %v, want deliveryDropped", got)
+	}
+	if len(sink.sent) != 1 || len(sender.sent) != 1 {
+		t.Error("dropped SMS reached a sink")
+	}
+}
+
+func TestLoadRulesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules")
+	if err := os.WriteFile(path, []byte("# OTPs to the phone chat\nif text ~ `\\d{6}` then route 5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := loadRulesFile(path)
+	if err != nil || len(rules) != 1 || rules[0].Line != 2 {
+		t.Fatalf("loadRulesFile() = %+v, %v; want one rule on line 2", rules, err)
+	}
+	if _, err := loadRulesFile("rules"); err == nil {
+		t.Error("relative RULES_FILE accepted")
+	}
+	if _, err := loadRulesFile(path + ".missing"); err == nil {
+		t.Error("missing RULES_FILE accepted")
+	}
+}
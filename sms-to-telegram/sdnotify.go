@@ -0,0 +1,128 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SystemdNotifier implements the sd_notify(3) protocol for Type=notify units:
+// READY=1 once the modem is first healthy, STATUS= for `systemctl status`,
+// and WATCHDOG=1 while the modem loop makes progress. NewSystemdNotifier
+// returns nil outside systemd; all methods are nil-safe.
+type SystemdNotifier struct {
+	conn net.Conn
+	// watchdog is WatchdogSec= from WATCHDOG_USEC; 0 disables pings.
+	watchdog time.Duration
+
+	mu     sync.Mutex
+	ready  bool
+	status string
+}
+
+// NewSystemdNotifier connects to $NOTIFY_SOCKET; without it (not started by
+// systemd, or Type=simple) it returns nil.
+func NewSystemdNotifier() (*SystemdNotifier, error) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(path, "@") {
+		path = "\x00" + path[1:] // abstract namespace
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NOTIFY_SOCKET: %w", err)
+	}
+	n := &SystemdNotifier{conn: conn}
+	// WATCHDOG_PID guards against inheriting the variables from a parent.
+	if pid := os.Getenv("WATCHDOG_PID"); pid == "" || pid == strconv.Itoa(os.Getpid()) {
+		if usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64); err == nil && usec > 0 {
+			n.watchdog = time.Duration(usec) * time.Microsecond
+		}
+	}
+	return n, nil
+}
+
+func (n *SystemdNotifier) send(state string) {
+	if _, err := n.conn.Write([]byte(state)); err != nil {
+		slog.Warn("Failed to notify systemd", "error", err)
+	}
+}
+
+// Ready sends READY=1 on the first call.
+func (n *SystemdNotifier) Ready() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ready {
+		return
+	}
+	n.ready = true
+	n.send("READY=1")
+	slog.Info("Notified systemd: ready")
+}
+
+// Status updates the status line shown by `systemctl status`, when changed.
+func (n *SystemdNotifier) Status(status string) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.status == status {
+		return
+	}
+	n.status = status
+	n.send("STATUS=" + status)
+}
+
+// Stopping tells systemd that shutdown is in progress.
+func (n *SystemdNotifier) Stopping() {
+	if n == nil {
+		return
+	}
+	n.send("STOPPING=1")
+}
+
+func (n *SystemdNotifier) watchdogEnabled() bool {
+	return n != nil && n.watchdog > 0
+}
+
+// RunWatchdog pings the watchdog at half its timeout while live reports the
+// modem loop as making progress (HealthState.Live), so a wedged loop stops
+// the pings and systemd restarts the process. Returns at once without
+// WatchdogSec=.
+func (n *SystemdNotifier) RunWatchdog(ctx context.Context, live func() (bool, string)) {
+	if !n.watchdogEnabled() {
+		return
+	}
+	slog.Info("systemd watchdog enabled", "timeout", n.watchdog)
+	for {
+		n.watchdogTick(live)
+		select {
+		case <-ctx.Done():
+			return
+		case <-clk.After(n.watchdog / 2):
+		}
+	}
+}
+
+func (n *SystemdNotifier) watchdogTick(live func() (bool, string)) {
+	if ok, reason := live(); !ok {
+		slog.Error("Withholding systemd watchdog ping", "reason", reason)
+		return
+	}
+	n.send("WATCHDOG=1")
+}
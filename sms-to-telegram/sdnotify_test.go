@@ -0,0 +1,118 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// listenNotify stands in for systemd's notification socket.
+func listenNotify(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+// readNotify returns the datagrams received so far.
+func readNotify(t *testing.T, conn *net.UnixConn) []string {
+	t.Helper()
+	var out []string
+	buf := make([]byte, 512)
+	for {
+		conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		n, err := conn.Read(buf)
+		if err != nil {
+			return out
+		}
+		out = append(out, string(buf[:n]))
+	}
+}
+
+func TestNewSystemdNotifier_OutsideSystemd(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	n, err := NewSystemdNotifier()
+	if n != nil || err != nil {
+		t.Fatalf("NewSystemdNotifier() = %v, %v; want nil, nil", n, err)
+	}
+	// Nil-safe no-ops.
+	n.Ready()
+	n.Status("x")
+	n.Stopping()
+	if n.watchdogEnabled() {
+		t.Error("watchdog enabled on nil notifier")
+	}
+}
+
+func TestSystemdNotifier_ReadyAndStatus(t *testing.T) {
+	conn := listenNotify(t)
+	t.Setenv("WATCHDOG_USEC", "")
+	n, err := NewSystemdNotifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := NewErrorNotifier(nil, nil, true, "host", 0)
+	notifier.systemd = n
+
+	notifier.Heartbeat()
+	notifier.Heartbeat()
+	notifier.ModemDown("no_signal")
+	n.Stopping()
+
+	got := readNotify(t, conn)
+	want := []string{"READY=1", "STATUS=Modem healthy, polling SIM", "STATUS=Modem down: no_signal", "STOPPING=1"}
+	if len(got) != len(want) {
+		t.Fatalf("datagrams = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("datagram %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if n.watchdogEnabled() {
+		t.Error("watchdog enabled without WATCHDOG_USEC")
+	}
+}
+
+func TestSystemdNotifier_Watchdog(t *testing.T) {
+	conn := listenNotify(t)
+	t.Setenv("WATCHDOG_USEC", "60000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	n, err := NewSystemdNotifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.watchdog != time.Minute {
+		t.Fatalf("watchdog = %v, want 1m", n.watchdog)
+	}
+
+	clock := newFakeClock()
+	restore := swapClock(clock)
+	defer restore()
+	health := NewHealthState(nil)
+	n.watchdogTick(health.Live)
+	clock.Advance(livenessStallAfter + time.Second)
+	n.watchdogTick(health.Live) // stalled: no ping
+	health.Progress()
+	n.watchdogTick(health.Live)
+
+	if got := readNotify(t, conn); len(got) != 2 || got[0] != "WATCHDOG=1" || got[1] != "WATCHDOG=1" {
+		t.Errorf("datagrams = %q, want two WATCHDOG=1", got)
+	}
+
+	t.Setenv("WATCHDOG_PID", "1")
+	if n, _ := NewSystemdNotifier(); n.watchdogEnabled() {
+		t.Error("watchdog enabled for another process's WATCHDOG_PID")
+	}
+}
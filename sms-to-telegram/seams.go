@@ -9,6 +9,8 @@ import (
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
 )
 
 // TelegramSender is the narrow surface of the Telegram bot the pipeline uses.
@@ -17,12 +19,50 @@ type TelegramSender interface {
 	SendMessage(ctx context.Context, params *bot.SendMessageParams) (*models.Message, error)
 }
 
+// DocumentSender uploads files to Telegram (archive exports). *bot.Bot
+// satisfies it; tests substitute a fake.
+type DocumentSender interface {
+	SendDocument(ctx context.Context, params *bot.SendDocumentParams) (*models.Message, error)
+}
+
+// TelegramProber checks Bot API reachability for /readyz. *bot.Bot
+// satisfies it; tests substitute a fake.
+type TelegramProber interface {
+	GetMe(ctx context.Context) (*models.User, error)
+}
+
+// CommandMenuSetter registers the bot command menu (setMyCommands).
+// *bot.Bot satisfies it; tests substitute a fake.
+type CommandMenuSetter interface {
+	SetMyCommands(ctx context.Context, params *bot.SetMyCommandsParams) (bool, error)
+}
+
+// ChatInspector resolves the bot and its chats for --check-config and the
+// startup chat validation. *bot.Bot satisfies it; tests substitute a fake.
+type ChatInspector interface {
+	GetMe(ctx context.Context) (*models.User, error)
+	GetChat(ctx context.Context, params *bot.GetChatParams) (*models.ChatFullInfo, error)
+}
+
+// newTelegramBot creates the bot of the service; the integration test points
+// it at a mock Bot API.
+var newTelegramBot = bot.New
+
 // ATCommander is the narrow surface of the AT modem session used by the
-// diagnostics and SMS pipeline. *SimpleAT satisfies it; tests substitute a fake.
-type ATCommander interface {
-	Command(cmd string) ([]string, error)
-	CommandWithTimeout(cmd string, timeout time.Duration) ([]string, error)
-	Ping() error
+// diagnostics and SMS pipeline. *at.SimpleAT satisfies it; tests substitute
+// a fake.
+type ATCommander = at.CommandRunner
+
+// SecretCommander sends AT commands that carry a SIM PIN without logging
+// it. *at.SimpleAT satisfies it; tests substitute a fake.
+type SecretCommander interface {
+	CommandSecret(cmd []byte, timeout time.Duration) ([]string, error)
+}
+
+// SMSSubmitter drives the AT+CMGS prompt dialog for outgoing SMS.
+// *at.SimpleAT satisfies it; tests substitute a fake.
+type SMSSubmitter interface {
+	CommandWithPrompt(cmd, payload string, timeout time.Duration) ([]string, error)
 }
 
 // Clock abstracts time for deterministic tests of retry/backoff/grace logic.
@@ -0,0 +1,178 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// selfTestPrefix starts every self-test SMS; received SMS with it are
+	// consumed, never forwarded.
+	selfTestPrefix = "sms-to-telegram self-test "
+	// selfTestFirstDelay lets the modem session settle before the first
+	// round after startup.
+	selfTestFirstDelay = 5 * time.Minute
+)
+
+// SelfTestOptions configures the loopback self-test (SELFTEST_*).
+type SelfTestOptions struct {
+	// Number is the gateway's own phone number.
+	Number   string
+	Interval time.Duration
+	// Timeout is how long to wait for the SMS to come back.
+	Timeout time.Duration
+}
+
+// SelfTest periodically sends an SMS to the gateway's own number and waits
+// for it to arrive, covering what AT diagnostics cannot: a SIM that is
+// registered and shows signal but no longer receives (barred, out of
+// credit, SMSC trouble). Rounds run on their own goroutine and go through
+// the Outbox; the modem goroutine reports received self-test SMS via
+// Received. A failure alerts once, the next passing round sends a recovery.
+type SelfTest struct {
+	opts     SelfTestOptions
+	outbox   *Outbox
+	notifier *ErrorNotifier
+
+	mu       sync.Mutex
+	token    string        // text of the SMS awaited; empty between rounds
+	arrived  chan struct{} // closed when token is received
+	sentAt   time.Time
+	alerting bool // a failure alert was delivered; written by rounds only
+}
+
+func NewSelfTest(opts SelfTestOptions, outbox *Outbox, notifier *ErrorNotifier) *SelfTest {
+	return &SelfTest{opts: opts, outbox: outbox, notifier: notifier}
+}
+
+// Run performs a round selfTestFirstDelay after start and then every
+// interval until ctx ends.
+func (s *SelfTest) Run(ctx context.Context) {
+	slog.Info("Loopback self-test enabled", "to", s.opts.Number,
+		"interval", s.opts.Interval, "timeout", s.opts.Timeout)
+	delay := selfTestFirstDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-clk.After(delay):
+		}
+		delay = s.opts.Interval
+		// A modem that is already alerting would only fail the round with
+		// a duplicate alert.
+		if s.notifier.HasError() {
+			slog.Info("Self-test skipped: modem is in an error state")
+			continue
+		}
+		s.round(ctx)
+	}
+}
+
+// round sends one self-test SMS and waits for it.
+func (s *SelfTest) round(ctx context.Context) {
+	nonce := make([]byte, 4)
+	rand.Read(nonce)
+	token := selfTestPrefix + hex.EncodeToString(nonce)
+	arrived := make(chan struct{})
+	s.mu.Lock()
+	s.token, s.arrived, s.sentAt = token, arrived, clk.Now()
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.token, s.arrived = "", nil
+		s.mu.Unlock()
+	}()
+
+	sendCtx, cancel := context.WithTimeout(ctx, 3*cmgsTimeout)
+	_, err := s.outbox.Send(sendCtx, s.opts.Number, token)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		s.fail(ctx, fmt.Sprintf("sending the self-test SMS failed: %v", err))
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-arrived:
+		s.pass(ctx)
+	case <-clk.After(s.opts.Timeout):
+		s.fail(ctx, fmt.Sprintf("the self-test SMS did not arrive within %s", s.opts.Timeout))
+	}
+}
+
+// Received reports whether pending is a self-test SMS; the caller deletes
+// it without forwarding. Called on the delivery goroutine.
+func (s *SelfTest) Received(pending PendingSMS) bool {
+	if s == nil || !strings.HasPrefix(pending.Message.Text, selfTestPrefix) {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && pending.Message.Text == s.token {
+		slog.Info("Self-test SMS received", "latency", clk.Now().Sub(s.sentAt).Truncate(time.Second))
+		close(s.arrived)
+		s.token = ""
+	} else {
+		slog.Warn("Late or unknown self-test SMS received, deleting it", "trace", pending.TraceID, "from", pending.Message.From)
+	}
+	return true
+}
+
+// Failing reports whether a failure alert is active (/status).
+func (s *SelfTest) Failing() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.alerting
+}
+
+func (s *SelfTest) pass(ctx context.Context) {
+	if !s.alerting {
+		return
+	}
+	msg := fmt.Sprintf("<b>SMS Gateway Recovered</b>\n\n"+
+		"<b>Host:</b> %s\n"+
+		"<b>Status:</b> Loopback self-test SMS received again",
+		s.notifier.hostHTML())
+	if err := s.notifier.sendToTelegram(ctx, msg); err != nil {
+		slog.Error("Failed to send self-test recovery notification", "error", err)
+		return
+	}
+	s.mu.Lock()
+	s.alerting = false
+	s.mu.Unlock()
+}
+
+func (s *SelfTest) fail(ctx context.Context, reason string) {
+	slog.Error("Loopback self-test failed", "reason", reason)
+	if s.alerting {
+		return
+	}
+	msg := fmt.Sprintf("<b>SMS Gateway Alert</b>\n\n"+
+		"<b>Host:</b> %s\n"+
+		"<b>Error:</b> Loopback self-test failed: %s\n\n"+
+		"<i>The modem looks healthy, but SMS to <code>%s</code> do not come back. "+
+		"Check the SIM (credit, barring) and the SMS center.</i>",
+		s.notifier.hostHTML(), escapeHTML(reason), escapeHTML(s.opts.Number))
+	if err := s.notifier.sendToTelegram(ctx, msg); err != nil {
+		slog.Error("Failed to send self-test alert", "error", err)
+		return
+	}
+	s.mu.Lock()
+	s.alerting = true
+	s.mu.Unlock()
+}
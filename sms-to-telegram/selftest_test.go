@@ -0,0 +1,105 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pausedClock never fires After, so a round waits for the SMS itself.
+type pausedClock struct{ *fakeClock }
+
+func (pausedClock) After(time.Duration) <-chan time.Time { return nil }
+
+// serveOutbox plays the modem goroutine for one request: reply, and loop
+// the SMS back via Received when loopback is set.
+func serveOutbox(s *SelfTest, outbox *Outbox, loopback bool, sendErr error) {
+	req := <-outbox.pending()
+	if loopback {
+		s.Received(PendingSMS{Message: SMSMessage{From: req.to, Text: strings.Join(req.parts, "")}})
+	}
+	req.result <- outgoingResult{SendResult{Parts: len(req.parts)}, sendErr}
+}
+
+// TestSelfTest_Rounds: a failing round alerts once, repeated failures stay
+// quiet and the next passing round sends a recovery.
+func TestSelfTest_Rounds(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	sender := &fakeSender{}
+	notifier := NewErrorNotifier(sender, []int64{1}, false, "gw1", time.Second)
+	outbox := NewOutbox(false)
+	s := NewSelfTest(SelfTestOptions{Number: "+4915550001234", Interval: time.Hour, Timeout: time.Minute}, outbox, notifier)
+	ctx := context.Background()
+
+	steps := []struct {
+		name     string
+		loopback bool
+		sendErr  error
+		wantSent int
+	}{
+		{"passes quietly", true, nil, 0},
+		{"SMS lost", false, nil, 1},
+		{"send fails, no repeat", false, errors.New("+CMS ERROR: 38"), 1},
+		{"recovers", true, nil, 2},
+	}
+	for _, step := range steps {
+		if step.loopback {
+			// The timeout must not race the arrival.
+			clk = pausedClock{clock}
+		} else {
+			clk = clock
+		}
+		go serveOutbox(s, outbox, step.loopback, step.sendErr)
+		s.round(ctx)
+		if got := len(sender.sentTo(1)); got != step.wantSent {
+			t.Fatalf("%s: %d notifications, want %d", step.name, got, step.wantSent)
+		}
+	}
+	sent := sender.sentTo(1)
+	if !strings.Contains(sent[0].Text, "did not arrive within 1m0s") || !strings.Contains(sent[0].Text, "+4915550001234") {
+		t.Errorf("alert = %q", sent[0].Text)
+	}
+	if !strings.Contains(sent[1].Text, "Recovered") {
+		t.Errorf("recovery = %q", sent[1].Text)
+	}
+}
+
+func TestSelfTest_Received(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	var nilTest *SelfTest
+	sms := func(text string) PendingSMS { return PendingSMS{Message: SMSMessage{From: "+1", Text: text}} }
+	if nilTest.Received(sms(selfTestPrefix + "00")) {
+		t.Error("nil SelfTest consumed an SMS")
+	}
+
+	s := NewSelfTest(SelfTestOptions{}, nil, nil)
+	if s.Received(sms("your code is 1234")) {
+		t.Error("ordinary SMS consumed")
+	}
+	// Late or foreign self-test SMS are consumed between rounds too.
+	if !s.Received(sms(selfTestPrefix + "deadbeef")) {
+		t.Error("late self-test SMS not consumed")
+	}
+
+	arrived := make(chan struct{})
+	s.token, s.arrived = selfTestPrefix+"cafe", arrived
+	if !s.Received(sms(selfTestPrefix+"beef")) || s.token == "" {
+		t.Error("a different token must not complete the round")
+	}
+	if !s.Received(sms(selfTestPrefix + "cafe")) {
+		t.Fatal("awaited self-test SMS not consumed")
+	}
+	select {
+	case <-arrived:
+	default:
+		t.Error("arrival not signalled")
+	}
+	// A duplicate delivery must not close the channel twice.
+	s.Received(sms(selfTestPrefix + "cafe"))
+}
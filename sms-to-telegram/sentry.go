@@ -0,0 +1,341 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimal Sentry client (envelope endpoint, no SDK): diagnostic errors,
+// undecodable PDUs and panics of the modem goroutine. Reports never carry
+// SMS text; PDUs are sent only through redactPDU.
+
+const (
+	sentryTimeout = 10 * time.Second
+	// sentryMaxPDUKeys bounds the set of already reported PDUs.
+	sentryMaxPDUKeys = 1000
+)
+
+// modemIdentity is the last ATI answer, attached to error reports. Written
+// by the modem goroutine during diagnostics.
+var modemIdentity struct {
+	sync.Mutex
+	model, firmware string
+}
+
+// parseATI splits an ATI response into model and firmware: Quectel-style
+// answers put the firmware on a "Revision:" line, SIMCom-style answers are a
+// single "<model> <revision>" line kept whole as the model.
+func parseATI(lines []string) (model, firmware string) {
+	var parts []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line == "OK":
+		case strings.HasPrefix(line, "Revision:"):
+			firmware = strings.TrimSpace(strings.TrimPrefix(line, "Revision:"))
+		default:
+			parts = append(parts, line)
+		}
+	}
+	return strings.Join(parts, " "), firmware
+}
+
+func setModemIdentity(model, firmware string) {
+	modemIdentity.Lock()
+	modemIdentity.model, modemIdentity.firmware = model, firmware
+	modemIdentity.Unlock()
+}
+
+// parseSentryDSN turns https://<key>@<host>[/<prefix>]/<project> into the
+// envelope endpoint and public key. Errors never echo the DSN.
+func parseSentryDSN(dsn string) (endpoint, key string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", fmt.Errorf("unparseable DSN")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User.Username() == "" {
+		return "", "", fmt.Errorf("%s: must be http(s)://<key>@<host>/<project>", redactURL(dsn))
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	project := path[i+1:]
+	if project == "" || strings.Trim(project, "0123456789") != "" {
+		return "", "", fmt.Errorf("%s: DSN has no numeric project ID", redactURL(dsn))
+	}
+	endpoint = fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path[:i], project)
+	return endpoint, u.User.Username(), nil
+}
+
+// redactPDU masks the numbers and user data of an SMS-DELIVER PDU, keeping
+// the structure a parser bug depends on: lengths, address types, first
+// octet, PID, DCS, SCTS and the UDH. Octets past the parsed structure
+// (malformed input) stay masked.
+func redactPDU(pduHex string) string {
+	b, err := hex.DecodeString(pduHex)
+	if err != nil {
+		return fmt.Sprintf("<%d chars, not hex>", len(pduHex))
+	}
+	out := []byte(strings.Repeat("XX", len(b)))
+	keep := func(from, n int) {
+		for i := from; i < from+n && i < len(b); i++ {
+			copy(out[2*i:], fmt.Sprintf("%02X", b[i]))
+		}
+	}
+	at := func(i int) int {
+		if i < len(b) {
+			return int(b[i])
+		}
+		return 0
+	}
+
+	keep(0, 2) // SMSC length, SMSC type
+	i := 1 + at(0)
+	firstOctet := at(i)
+	keep(i, 3) // first octet, OA length (semi-octets), OA type
+	i += 3 + (at(i+1)+1)/2
+	keep(i, 10) // PID, DCS, SCTS, UDL
+	i += 10
+	if firstOctet&0x40 != 0 {
+		keep(i, 1+at(i)) // UDHL + UDH
+	}
+	return string(out)
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Stacktrace *sentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryMessage struct {
+	Formatted string `json:"formatted"`
+}
+
+type sentryEvent struct {
+	EventID     string                       `json:"event_id"`
+	Timestamp   time.Time                    `json:"timestamp"`
+	Platform    string                       `json:"platform"`
+	Level       string                       `json:"level"`
+	Logger      string                       `json:"logger"`
+	ServerName  string                       `json:"server_name"`
+	Environment string                       `json:"environment,omitempty"`
+	Message     *sentryMessage               `json:"message,omitempty"`
+	Exception   *sentryExceptions            `json:"exception,omitempty"`
+	Tags        map[string]string            `json:"tags,omitempty"`
+	Contexts    map[string]map[string]string `json:"contexts,omitempty"`
+	Extra       map[string]any               `json:"extra,omitempty"`
+}
+
+// SentryReporter sends events to a Sentry DSN (SENTRY_DSN) so failures are
+// visible even when Telegram delivery is what broke. All methods are
+// nil-safe (reporting disabled) and best effort.
+type SentryReporter struct {
+	endpoint    string
+	key         string
+	environment string
+	hostname    string
+	dryRun      bool
+	client      *http.Client
+
+	mu       sync.Mutex
+	reported map[string]struct{} // PDU fingerprints already reported
+	// lastType is the last reported diagnostic error type: the outer loop
+	// retries every 30s and would otherwise report the same outage each time.
+	lastType DiagnosticErrorType
+}
+
+func NewSentryReporter(dsn, environment, hostname string, dryRun bool) (*SentryReporter, error) {
+	endpoint, key, err := parseSentryDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &SentryReporter{
+		endpoint:    endpoint,
+		key:         key,
+		environment: environment,
+		hostname:    hostname,
+		dryRun:      dryRun,
+		client:      &http.Client{Timeout: sentryTimeout},
+		reported:    make(map[string]struct{}),
+	}, nil
+}
+
+func (s *SentryReporter) newEvent(level string) sentryEvent {
+	id := make([]byte, 16)
+	rand.Read(id)
+	modemIdentity.Lock()
+	modem := map[string]string{"model": modemIdentity.model, "firmware": modemIdentity.firmware}
+	modemIdentity.Unlock()
+	return sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   clk.Now().UTC(),
+		Platform:    "go",
+		Level:       level,
+		Logger:      "sms-to-telegram",
+		ServerName:  s.hostname,
+		Environment: s.environment,
+		Tags:        map[string]string{"modem.model": modem["model"]},
+		Contexts:    map[string]map[string]string{"modem": modem},
+	}
+}
+
+// ReportDiagnostic reports a modem diagnostic error unless the same type
+// was already reported since the last recovery.
+func (s *SentryReporter) ReportDiagnostic(ctx context.Context, diagErr *DiagnosticError) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	repeat := s.lastType == diagErr.Type
+	s.lastType = diagErr.Type
+	s.mu.Unlock()
+	if repeat {
+		return
+	}
+	ev := s.newEvent("error")
+	ev.Message = &sentryMessage{errorTypeName(diagErr.Type) + ": " + diagErr.Message}
+	ev.Tags["error_type"] = errorTypeName(diagErr.Type)
+	s.send(ctx, ev)
+}
+
+// Recovered re-arms diagnostic reporting after the modem is healthy again.
+func (s *SentryReporter) Recovered() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.lastType = ErrTypeNone
+	s.mu.Unlock()
+}
+
+// ReportUndecodablePDU reports an SMS forwarded as raw hex, once per PDU
+// set (it is seen again on every poll until deleted).
+func (s *SentryReporter) ReportUndecodablePDU(ctx context.Context, pending PendingSMS) {
+	if s == nil || !pending.RawFallback {
+		return
+	}
+	key := contentFingerprint(strings.Join(pending.RawPDUs, ","))
+	s.mu.Lock()
+	_, seen := s.reported[key]
+	if !seen {
+		if len(s.reported) >= sentryMaxPDUKeys {
+			s.reported = make(map[string]struct{})
+		}
+		s.reported[key] = struct{}{}
+	}
+	s.mu.Unlock()
+	if seen {
+		return
+	}
+
+	ev := s.newEvent("warning")
+	ev.Message = &sentryMessage{"Undecodable PDU: " + pending.RawReason}
+	ev.Tags["error_type"] = "pdu"
+	snippets := make([]string, len(pending.RawPDUs))
+	for i, pdu := range pending.RawPDUs {
+		snippets[i] = redactPDU(pdu)
+	}
+	ev.Extra = map[string]any{"pdus_redacted": snippets, "pdu_fingerprint": key}
+	s.send(ctx, ev)
+}
+
+// RecoverPanic is deferred on the modem goroutine: it reports a panic with
+// its stack, then re-panics so the process still crashes and restarts.
+func (s *SentryReporter) RecoverPanic() {
+	if s == nil {
+		return
+	}
+	r := recover()
+	if r == nil {
+		return
+	}
+	ev := s.newEvent("fatal")
+	ev.Exception = &sentryExceptions{Values: []sentryException{{
+		Type:       "panic",
+		Value:      fmt.Sprint(r),
+		Stacktrace: &sentryStacktrace{Frames: panicFrames()},
+	}}}
+	ctx, cancel := context.WithTimeout(context.Background(), sentryTimeout)
+	s.send(ctx, ev)
+	cancel()
+	panic(r)
+}
+
+// panicFrames returns the current stack without runtime frames, oldest
+// first as Sentry expects.
+func panicFrames() []sentryFrame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var out []sentryFrame
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "runtime.") {
+			out = append([]sentryFrame{{Function: f.Function, Filename: f.File, Lineno: f.Line}}, out...)
+		}
+		if !more {
+			return out
+		}
+	}
+}
+
+func (s *SentryReporter) send(ctx context.Context, ev sentryEvent) {
+	if s.dryRun {
+		slog.Info("DRY_RUN: Would report to Sentry", "endpoint", redactURL(s.endpoint), "level", ev.Level)
+		return
+	}
+	event, err := json.Marshal(ev)
+	if err != nil {
+		slog.Warn("Sentry report not encoded", "error", err)
+		return
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "{\"event_id\":%q}\n{\"type\":\"event\",\"length\":%d}\n", ev.EventID, len(event))
+	body.Write(event)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, &body)
+	if err != nil {
+		slog.Warn("Sentry report failed", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_client=sms-to-telegram, sentry_key="+s.key)
+	status, err := doSinkRequest(s.client, req)
+	switch {
+	case err != nil:
+		slog.Warn("Sentry report failed", "error", err)
+	case status/100 != 2:
+		slog.Warn("Sentry rejected report", "endpoint", redactURL(s.endpoint), "status", status)
+	default:
+		slog.Debug("Sentry report sent", "event_id", ev.EventID, "level", ev.Level)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/pdu"
+)
+
+func TestParseSentryDSN(t *testing.T) {
+	tests := []struct {
+		dsn, wantEndpoint string
+		valid             bool
+	}{
+		{"https://abc123@o1.ingest.sentry.io/4505", "https://o1.ingest.sentry.io/api/4505/envelope/", true},
+		{"http://abc@sentry.lan:9000/prefix/7/", "http://sentry.lan:9000/prefix/api/7/envelope/", true},
+		{"https://o1.ingest.sentry.io/4505", "", false}, // no key
+		{"https://abc@o1.ingest.sentry.io/", "", false},
+		{"https://abc@o1.ingest.sentry.io/project", "", false},
+		{"ftp://abc@host/1", "", false},
+	}
+	for _, tt := range tests {
+		endpoint, key, err := parseSentryDSN(tt.dsn)
+		if (err == nil) != tt.valid || endpoint != tt.wantEndpoint {
+			t.Errorf("parseSentryDSN(%q) = %q, %v; want %q (valid %v)", tt.dsn, endpoint, err, tt.wantEndpoint, tt.valid)
+		}
+		if err != nil && strings.Contains(err.Error(), "abc") {
+			t.Errorf("error %q leaks the DSN key", err)
+		}
+		if err == nil && key == "" {
+			t.Errorf("parseSentryDSN(%q): empty key", tt.dsn)
+		}
+	}
+}
+
+func TestParseATI(t *testing.T) {
+	for _, tt := range []struct {
+		lines           []string
+		model, firmware string
+	}{
+		{[]string{"Quectel", "EC25", "Revision: EC25EFAR06A06M4G", "OK"}, "Quectel EC25", "EC25EFAR06A06M4G"},
+		{[]string{"SIM800 R14.18"}, "SIM800 R14.18", ""},
+	} {
+		if model, firmware := parseATI(tt.lines); model != tt.model || firmware != tt.firmware {
+			t.Errorf("parseATI(%q) = %q, %q", tt.lines, model, firmware)
+		}
+	}
+}
+
+func TestRedactPDU(t *testing.T) {
+	raw, err := pdu.EncodeDeliver("+79991234567", "secret 4711", false, &pdu.Concat{Ref: 9, Total: 2, Part: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := redactPDU(raw)
+	if len(got) != len(raw) {
+		t.Fatalf("redacted length %d, want %d", len(got), len(raw))
+	}
+	// SMSC length, first octet, OA length and type survive; the six OA
+	// octets are masked.
+	if got[:8] != raw[:8] || got[8:20] != strings.Repeat("X", 12) {
+		t.Errorf("redactPDU() = %s\n       raw = %s", got, raw)
+	}
+	// PID..UDL and the 6-byte concat UDH survive, the text does not.
+	if got[20:40] != raw[20:40] || got[40:52] != raw[40:52] || strings.Trim(got[52:], "X") != "" {
+		t.Errorf("redactPDU() = %s\n       raw = %s", got, raw)
+	}
+	if got := redactPDU("zz"); !strings.Contains(got, "not hex") {
+		t.Errorf("redactPDU(non-hex) = %q", got)
+	}
+	redactPDU("0011") // truncated input must not panic
+}
+
+// sentryRecorder decodes every envelope's event.
+func sentryRecorder(t *testing.T) (dsn string, events *[]map[string]any) {
+	t.Helper()
+	var got []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/42/envelope/" || !strings.Contains(r.Header.Get("X-Sentry-Auth"), "sentry_key=pubkey") {
+			t.Errorf("request %s with auth %q", r.URL.Path, r.Header.Get("X-Sentry-Auth"))
+		}
+		sc := bufio.NewScanner(r.Body)
+		sc.Buffer(nil, 1<<20)
+		var lines []string
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		if len(lines) != 3 || !strings.Contains(lines[1], `"type":"event"`) {
+			t.Errorf("envelope = %q", lines)
+			return
+		}
+		var ev map[string]any
+		json.Unmarshal([]byte(lines[2]), &ev)
+		got = append(got, ev)
+	}))
+	t.Cleanup(srv.Close)
+	return strings.Replace(srv.URL, "://", "://pubkey@", 1) + "/42", &got
+}
+
+func TestSentryReporter_Diagnostic(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	setModemIdentity("Quectel EC25", "EC25EFAR06A06M4G")
+	t.Cleanup(func() { setModemIdentity("", "") })
+	dsn, events := sentryRecorder(t)
+	s, err := NewSentryReporter(dsn, "prod", "gw1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	diag := NewDiagnosticError(ErrTypeSimNotDetected, "SIM not inserted")
+	s.ReportDiagnostic(ctx, diag)
+	s.ReportDiagnostic(ctx, diag) // same outage, retried: not reported again
+	s.Recovered()
+	s.ReportDiagnostic(ctx, diag)
+
+	if len(*events) != 2 {
+		t.Fatalf("reported %d events, want 2", len(*events))
+	}
+	ev := (*events)[0]
+	tags := ev["tags"].(map[string]any)
+	modem := ev["contexts"].(map[string]any)["modem"].(map[string]any)
+	if ev["level"] != "error" || ev["server_name"] != "gw1" || ev["environment"] != "prod" ||
+		tags["error_type"] != errorTypeName(ErrTypeSimNotDetected) || modem["firmware"] != "EC25EFAR06A06M4G" {
+		t.Errorf("event = %v", ev)
+	}
+}
+
+func TestSentryReporter_UndecodablePDU(t *testing.T) {
+	dsn, events := sentryRecorder(t)
+	s, _ := NewSentryReporter(dsn, "", "gw1", false)
+	raw, _ := pdu.EncodeDeliver("+79991234567", "secret 4711", false, nil)
+	pending := PendingSMS{
+		Message:     SMSMessage{Text: raw},
+		RawFallback: true,
+		RawReason:   "malformed PDU: test",
+		RawPDUs:     []string{raw},
+	}
+	s.ReportUndecodablePDU(context.Background(), pending)
+	s.ReportUndecodablePDU(context.Background(), pending)
+	s.ReportUndecodablePDU(context.Background(), PendingSMS{Message: SMSMessage{Text: "decoded"}})
+
+	if len(*events) != 1 {
+		t.Fatalf("reported %d events, want 1 per PDU", len(*events))
+	}
+	body, _ := json.Marshal((*events)[0])
+	if strings.Contains(string(body), raw) || strings.Contains(string(body), "9999") {
+		t.Errorf("event leaks the PDU: %s", body)
+	}
+}
+
+func TestSentryReporter_RecoverPanic(t *testing.T) {
+	dsn, events := sentryRecorder(t)
+	s, _ := NewSentryReporter(dsn, "", "gw1", false)
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("re-panic value = %v, want boom", r)
+			}
+		}()
+		defer s.RecoverPanic()
+		panic("boom")
+	}()
+
+	if len(*events) != 1 {
+		t.Fatalf("reported %d events, want 1", len(*events))
+	}
+	exc := (*events)[0]["exception"].(map[string]any)["values"].([]any)[0].(map[string]any)
+	frames, _ := json.Marshal(exc["stacktrace"])
+	if exc["value"] != "boom" || !strings.Contains(string(frames), "TestSentryReporter_RecoverPanic") {
+		t.Errorf("exception = %v", exc)
+	}
+
+	var disabled *SentryReporter
+	disabled.ReportDiagnostic(context.Background(), NewDiagnosticError(ErrTypeNoSignal, "x"))
+	disabled.Recovered()
+}
@@ -0,0 +1,100 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// SignalAlertOptions configures the weak-signal alert (SIGNAL_ALERT_*).
+type SignalAlertOptions struct {
+	// ThresholdDBm: the signal is weak below it.
+	ThresholdDBm int
+	// After is how long every sample must stay below the threshold.
+	After time.Duration
+	// HysteresisDB: the alert clears at ThresholdDBm+HysteresisDB or more.
+	HysteresisDB int
+}
+
+// signalState tracks the weak-signal alert. Guarded by ErrorNotifier.mu.
+type signalState struct {
+	weakSince time.Time // first sample of the current weak run; zero if none
+	alerted   bool
+}
+
+// CheckSignal evaluates one +CSQ sample (every health check, ~60s). Like
+// CheckStorage it is a warning outside the error-type state machine: a weak
+// but working antenna still delivers SMS, just not for long. Unknown signal
+// (99) is skipped; losing the signal entirely is the No Signal diagnostic.
+func (n *ErrorNotifier) CheckSignal(ctx context.Context, rssi int) {
+	opts := n.signalAlert
+	if opts == nil || rssi < 0 || rssi > 31 {
+		return
+	}
+	dbm := csqToDBm(rssi)
+	now := clk.Now()
+
+	n.mu.Lock()
+	st := &n.signal
+	var alert, recovered bool
+	var weakFor time.Duration
+	switch {
+	case dbm < opts.ThresholdDBm:
+		if st.weakSince.IsZero() {
+			st.weakSince = now
+		}
+		weakFor = now.Sub(st.weakSince)
+		if !st.alerted && weakFor >= opts.After {
+			st.alerted, alert = true, true
+		}
+	case dbm >= opts.ThresholdDBm+opts.HysteresisDB:
+		st.weakSince = time.Time{}
+		if st.alerted {
+			st.alerted, recovered = false, true
+		}
+	default:
+		// Inside the hysteresis band: the weak run is broken, but an active
+		// alert stays until the signal is clearly better.
+		st.weakSince = time.Time{}
+	}
+	n.mu.Unlock()
+
+	switch {
+	case alert:
+		slog.Warn("Signal below threshold", "dbm", dbm, "rssi", rssi,
+			"threshold_dbm", opts.ThresholdDBm, "for", weakFor)
+		msg := fmt.Sprintf("<b>SMS Gateway Alert</b>\n\n"+
+			"<b>Host:</b> %s\n"+
+			"<b>Warning:</b> Weak signal: %d dBm (CSQ %d), below %d dBm for %s\n\n"+
+			"<i>SMS may soon stop arriving. Check the antenna, its cable and connector.</i>",
+			n.hostHTML(), dbm, rssi, opts.ThresholdDBm, weakFor.Truncate(time.Second))
+		if err := n.sendToTelegram(ctx, msg); err != nil {
+			slog.Error("Failed to send weak signal alert", "error", err)
+			// Re-arm so the alert is retried on the next weak sample.
+			n.mu.Lock()
+			n.signal.alerted = false
+			n.mu.Unlock()
+		}
+	case recovered:
+		slog.Info("Signal recovered", "dbm", dbm, "rssi", rssi)
+		msg := fmt.Sprintf("<b>SMS Gateway Recovered</b>\n\n"+
+			"<b>Host:</b> %s\n"+
+			"<b>Status:</b> Signal back to %d dBm (CSQ %d)",
+			n.hostHTML(), dbm, rssi)
+		if err := n.sendToTelegram(ctx, msg); err != nil {
+			slog.Error("Failed to send signal recovery notification", "error", err)
+		}
+	}
+}
+
+// resetSignalRun forgets the current weak run when the modem session ends:
+// the next session starts measuring afresh.
+func (n *ErrorNotifier) resetSignalRun() {
+	n.mu.Lock()
+	n.signal.weakSince = time.Time{}
+	n.mu.Unlock()
+}
@@ -0,0 +1,101 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCheckSignal: the alert fires once the signal stayed below the
+// threshold for the whole period, does not repeat, survives samples inside
+// the hysteresis band and clears above it.
+func TestCheckSignal(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	sender := &fakeSender{}
+	notifier := NewErrorNotifier(sender, []int64{1}, false, "gw1", time.Second)
+	notifier.signalAlert = &SignalAlertOptions{ThresholdDBm: -100, After: 3 * time.Minute, HysteresisDB: 6}
+	ctx := context.Background()
+
+	// CSQ 5 = -103 dBm, 7 = -99, 9 = -95, 10 = -93.
+	steps := []struct {
+		rssi      int
+		wantSent  int
+		wantAlert bool
+	}{
+		{5, 0, false},
+		{5, 0, false},
+		{7, 0, false}, // above the threshold: the weak run restarts
+		{5, 0, false},
+		{99, 0, false}, // unknown: does not break the run
+		{5, 0, false},
+		{5, 1, true}, // 3 minutes below
+		{5, 1, true}, // no repeat
+		{9, 1, true}, // -95 is inside the band (< -94)
+		{5, 1, true},
+		{10, 2, false}, // -93 clears
+		{10, 2, false},
+	}
+	for i, step := range steps {
+		notifier.CheckSignal(ctx, step.rssi)
+		if got := len(sender.sentTo(1)); got != step.wantSent {
+			t.Fatalf("step %d (CSQ %d): %d messages, want %d", i, step.rssi, got, step.wantSent)
+		}
+		if notifier.signal.alerted != step.wantAlert {
+			t.Fatalf("step %d (CSQ %d): alerted = %v, want %v", i, step.rssi, notifier.signal.alerted, step.wantAlert)
+		}
+		clock.Advance(time.Minute)
+	}
+	sent := sender.sentTo(1)
+	if !strings.Contains(sent[0].Text, "Weak signal: -103 dBm (CSQ 5), below -100 dBm for 3m0s") {
+		t.Errorf("alert = %q", sent[0].Text)
+	}
+	if !strings.Contains(sent[1].Text, "Signal back to -93 dBm") {
+		t.Errorf("recovery = %q", sent[1].Text)
+	}
+}
+
+func TestCheckSignal_RetriesFailedAlertAndResetsOnModemDown(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	sender := &fakeSender{script: func(call int, _ int64, _ string) error {
+		if call == 0 {
+			return errors.New("network down")
+		}
+		return nil
+	}}
+	notifier := NewErrorNotifier(sender, []int64{1}, false, "gw1", time.Second)
+	notifier.signalAlert = &SignalAlertOptions{ThresholdDBm: -100, After: time.Minute}
+	ctx := context.Background()
+
+	notifier.CheckSignal(ctx, 5)
+	clock.Advance(time.Minute)
+	notifier.CheckSignal(ctx, 5) // alert fails, re-armed
+	if notifier.signal.alerted {
+		t.Fatal("failed alert should be re-armed")
+	}
+	clock.Advance(time.Minute)
+	notifier.CheckSignal(ctx, 5)
+	if !notifier.signal.alerted || sender.calls != 2 {
+		t.Fatalf("alerted = %v after %d sends, want retried", notifier.signal.alerted, sender.calls)
+	}
+
+	// A new session measures afresh; the active alert is kept.
+	notifier.ModemDown("port closed")
+	notifier.CheckSignal(ctx, 10)
+	if sender.calls != 3 {
+		t.Errorf("sends = %d, want recovery after reconnect", sender.calls)
+	}
+	notifier.CheckSignal(ctx, 5)
+	notifier.ModemDown("port closed")
+	clock.Advance(time.Minute)
+	notifier.CheckSignal(ctx, 5)
+	if notifier.signal.alerted {
+		t.Error("weak run should restart after ModemDown")
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+// Batch deletion. Modems that take the AT+CMGD <delflag> argument delete
+// every read message with one command: AT+CMGD=<index>,1 removes the read
+// ones and leaves unread SMS (arrived after the listing, which marks what it
+// lists read) and stored outgoing ones alone. Deletion authority stays per
+// message: the flag is used only when the slots being freed, owned by SMS
+// that are settled, are all the read slots on the SIM, which makes it the
+// same as deleting them one by one. On a full SIM that is a long multipart
+// SMS, a batch of status reports or stale parts, or the SMS the delivery
+// queue finished while the modem was busy.
+
+// cmgdDeleteRead is the AT+CMGD <delflag> that deletes all read messages.
+const cmgdDeleteRead = 1
+
+// probeDeleteFlags reports whether the modem accepts AT+CMGD with
+// cmgdDeleteRead, from the ranges of AT+CMGD=? (SIM800: "+CMGD: (1-30),(0-4)").
+// Modems without the flag answer ERROR or list one range.
+func probeDeleteFlags(modem ATCommander) bool {
+	resp, err := modem.Command("AT+CMGD=?")
+	if err != nil {
+		return false
+	}
+	for _, line := range resp {
+		rest, ok := strings.CutPrefix(line, "+CMGD:")
+		if !ok {
+			continue
+		}
+		_, flags, ok := strings.Cut(rest, "),(")
+		if !ok {
+			return false
+		}
+		return rangeListContains(strings.TrimSuffix(strings.TrimSpace(flags), ")"), cmgdDeleteRead)
+	}
+	return false
+}
+
+// rangeListContains reports whether n is in an AT range list such as
+// "0-4" or "0,1,2".
+func rangeListContains(list string, n int) bool {
+	for _, item := range strings.Split(list, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		if !isRange {
+			hi = lo
+		}
+		from, err1 := strconv.Atoi(lo)
+		to, err2 := strconv.Atoi(hi)
+		if err1 == nil && err2 == nil && from <= n && n <= to {
+			return true
+		}
+	}
+	return false
+}
+
+// slotDeleter frees SIM slots; kind names them in the logs.
+type slotDeleter func(indices []int, kind string) error
+
+// simSlots is the modem session's view of the SIM: how it is listed and the
+// read SMS on it. Used by
+// the modem goroutine only; a nil simSlots deletes slot by slot.
+type simSlots struct {
+	// deleteRead: the modem takes cmgdDeleteRead.
+	deleteRead bool
+	// read are the received slots of the last listing not deleted since;
+	// nil before the first listing of the session.
+	read map[int]bool
+	// text: the session lists SMS in text mode.
+	text bool
+	// check follows whether deleted slots become free (deleteverify.go);
+	// nil checks nothing.
+	check *DeletionCheck
+}
+
+func newSIMSlots(deleteRead bool) *simSlots {
+	return &simSlots{deleteRead: deleteRead}
+}
+
+// textMode reports whether the session lists SMS in text mode. Nil-safe.
+func (s *simSlots) textMode() bool {
+	return s != nil && s.text
+}
+
+// listed records the received slots of a listing. Nil-safe.
+func (s *simSlots) listed(received []int) {
+	if s == nil {
+		return
+	}
+	s.read = make(map[int]bool, len(received))
+	for _, index := range received {
+		if index < injectBaseIndex {
+			s.read[index] = true
+		}
+	}
+	s.check.listed(received)
+}
+
+// deleter returns the slotDeleter of the session. Nil-safe.
+func (s *simSlots) deleter(modem ATCommander, cfg *Config) slotDeleter {
+	return func(indices []int, kind string) error {
+		if batched, err := s.deleteAllRead(modem, cfg, indices); batched || err != nil {
+			return err
+		}
+		errored, err := deleteSlots(modem, cfg, indices, kind)
+		if s != nil {
+			for _, index := range indices {
+				delete(s.read, index)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return s.checkDeleted(modem, cfg, indices, errored)
+	}
+}
+
+// checkDeleted hands deleted slots to the DeletionCheck. A new SMS in a
+// freed slot was marked read by the read-back, so the read slots of the
+// listing no longer are all the read SMS on the SIM: the delete flag waits
+// for the next listing. Nil-safe.
+func (s *simSlots) checkDeleted(modem ATCommander, cfg *Config, indices, errored []int) error {
+	if s == nil || cfg.DryRun {
+		return nil
+	}
+	arrived, err := s.check.deleted(modem, indices, errored)
+	if arrived {
+		s.read = nil
+	}
+	return err
+}
+
+// deleteAllRead frees indices with one AT+CMGD=<index>,1 if they are all
+// the read slots on the SIM, and reports whether it did. A refused batch
+// turns the flag off for the session; the caller then deletes slot by
+// slot. Nil-safe.
+func (s *simSlots) deleteAllRead(modem ATCommander, cfg *Config, indices []int) (bool, error) {
+	if s == nil || !s.deleteRead || cfg.DryRun || s.read == nil {
+		return false, nil
+	}
+	indices = slices.DeleteFunc(slices.Clone(indices), func(i int) bool { return i >= injectBaseIndex })
+	slices.Sort(indices)
+	indices = slices.Compact(indices)
+	if len(indices) < 2 || len(indices) != len(s.read) {
+		return false, nil
+	}
+	for _, index := range indices {
+		if !s.read[index] {
+			return false, nil
+		}
+	}
+	_, err := modem.Command(fmt.Sprintf("AT+CMGD=%d,%d", indices[0], cmgdDeleteRead))
+	switch {
+	case err == nil:
+		slog.Debug("Deleted all read SMS from SIM at once", "indices", indices)
+		clear(s.read)
+		return true, s.checkDeleted(modem, cfg, indices, nil)
+	case at.IsTimeoutError(err):
+		return false, fmt.Errorf("deleting %d read SMS: %w", len(indices), err)
+	}
+	slog.Warn("AT+CMGD delete flag refused, deleting slot by slot", "error", err)
+	s.deleteRead = false
+	return false, nil
+}
@@ -0,0 +1,167 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+func TestProbeDeleteFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		err   error
+		want  bool
+	}{
+		{"SIM800", []string{"+CMGD: (1-30),(0-4)"}, nil, true},
+		{"listed flags", []string{"+CMGD: (1-255),(0,1,2,3,4)"}, nil, true},
+		{"no read flag", []string{"+CMGD: (1-30),(0,4)"}, nil, false},
+		{"index range only", []string{"+CMGD: (1-30)"}, nil, false},
+		{"ERROR", nil, at.ErrModemError, false},
+		{"empty", nil, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modem := newFakeAT()
+			modem.on("AT+CMGD=?", tt.lines, tt.err)
+			if got := probeDeleteFlags(modem); got != tt.want {
+				t.Errorf("probeDeleteFlags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// cmgdCalls returns the deletion commands the modem got.
+func cmgdCalls(modem *fakeAT) []string {
+	return slices.DeleteFunc(slices.Clone(modem.calls), func(c string) bool { return !strings.HasPrefix(c, "AT+CMGD=") })
+}
+
+func TestProcessMessages_BatchDelete(t *testing.T) {
+	multipart := [][2]string{
+		{"+CMGL: 3,1,,30", pduGSM7Part1},
+		{"+CMGL: 4,1,,30", pduGSM7Part2},
+		{"+CMGL: 9,3,,29", testPDUSingle}, // stored outgoing: not ours
+	}
+	tests := []struct {
+		name    string
+		listing [][2]string
+		slots   *simSlots
+		setup   func(modem *fakeAT, cfg *Config)
+		want    []string
+	}{
+		{"one command for every read slot", multipart, newSIMSlots(true), nil, []string{"AT+CMGD=3,1"}},
+		{"without delete flags", multipart, newSIMSlots(false), nil, []string{"AT+CMGD=3", "AT+CMGD=4"}},
+		{"no session", multipart, nil, nil, []string{"AT+CMGD=3", "AT+CMGD=4"}},
+		{"other read slots stay", append([][2]string{{"+CMGL: 2,1,,26", pduStatusReport}}, multipart...), newSIMSlots(true), nil,
+			[]string{"AT+CMGD=2", "AT+CMGD=3,1"}},
+		{"single slot", [][2]string{{"+CMGL: 5,1,,29", testPDUSingle}}, newSIMSlots(true), nil, []string{"AT+CMGD=5"}},
+		{"batch refused", multipart, newSIMSlots(true), func(modem *fakeAT, _ *Config) {
+			modem.on("AT+CMGD=3,1", nil, at.ErrModemError)
+		}, []string{"AT+CMGD=3,1", "AT+CMGD=3", "AT+CMGD=4"}},
+		{"dry run", multipart, newSIMSlots(true), func(_ *fakeAT, cfg *Config) { cfg.DryRun = true }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(swapClock(newFakeClock()))
+			modem := newFakeAT()
+			modem.on("AT+CMGL=4", cmglListing(tt.listing...), nil)
+			cfg := testConfig()
+			deliverer, _, _ := newTestDeliverer(cfg)
+			deliverer.slots = tt.slots
+			if tt.setup != nil {
+				tt.setup(modem, cfg)
+			}
+
+			if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+				t.Fatalf("processMessages() error = %v", err)
+			}
+			if got := cmgdCalls(modem); !slices.Equal(got, tt.want) {
+				t.Errorf("deletions = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessMessages_BatchDeleteTransportError(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing(
+		[2]string{"+CMGL: 3,1,,30", pduGSM7Part1},
+		[2]string{"+CMGL: 4,1,,30", pduGSM7Part2},
+	), nil)
+	modem.on("AT+CMGD=3,1", nil, at.ErrModemTimeout)
+	cfg := testConfig()
+	deliverer, _, _ := newTestDeliverer(cfg)
+	deliverer.slots = newSIMSlots(true)
+
+	err := processMessages(context.Background(), modem, deliverer, cfg, 30)
+	if !at.IsTimeoutError(err) {
+		t.Fatalf("processMessages() error = %v, want the timeout", err)
+	}
+	// No per-slot deletes on a desynchronized session.
+	if got := cmgdCalls(modem); len(got) != 1 {
+		t.Errorf("deletions = %q", got)
+	}
+}
+
+// TestCollectDelivered_BatchDelete: SMS the delivery queue finished together
+// that own every read slot are freed with one command, unless a listing
+// failed since or DELETE_POLICY=never keeps them.
+func TestCollectDelivered_BatchDelete(t *testing.T) {
+	tests := []struct {
+		name      string
+		corrupted bool
+		policy    string
+		want      []string
+	}{
+		{"one command", false, deletePolicyAll, []string{"AT+CMGD=2,1"}},
+		{"after a corrupted listing", true, deletePolicyAll, []string{"AT+CMGD=2", "AT+CMGD=5"}},
+		{"DELETE_POLICY=never", false, deletePolicyNever, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(swapClock(newFakeClock()))
+			modem := newFakeAT()
+			modem.on("AT+CMGL=4", cmglListing(
+				[2]string{"+CMGL: 2,1,,24", pduAlphaSender},
+				[2]string{"+CMGL: 5,1,,29", testPDUSingle},
+			), nil)
+			modem.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 5,1,,24", testPDUSingle}), nil) // length mismatch
+			cfg := testConfig()
+			cfg.DeletePolicy = tt.policy
+			deliverer, _, _ := newTestDeliverer(cfg)
+			deliverer.slots = newSIMSlots(true)
+			// No worker: the test plays the delivery goroutine.
+			q := newDeliveryQueue(0)
+			deliverer.queue = q
+			if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+				t.Fatalf("processMessages() error = %v", err)
+			}
+			if tt.corrupted {
+				if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err == nil {
+					t.Fatal("processMessages() accepted a corrupted listing")
+				}
+			}
+			for range 2 {
+				job, _ := q.next()
+				q.complete(job, deliveryDone)
+			}
+
+			if err := collectDelivered(modem, deliverer, cfg); err != nil {
+				t.Fatalf("collectDelivered() error = %v", err)
+			}
+			if got := cmgdCalls(modem); !slices.Equal(got, tt.want) {
+				t.Errorf("deletions = %q, want %q", got, tt.want)
+			}
+			if len(q.queued) != 0 {
+				t.Errorf("queued = %v, want both settled", q.queued)
+			}
+		})
+	}
+}
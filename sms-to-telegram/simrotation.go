@@ -0,0 +1,300 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+// Scheduled SIM rotation (SIM_ROTATION, SIM_ROTATION_SCHEDULE). Prepaid SIMs
+// expire when they are not used for months; a dual-SIM modem or an eUICC
+// with several profiles keeps them alive by registering each in turn. At
+// every scheduled time the modem goroutine switches to the next target and
+// the session restarts on it; once the new SIM is registered, a
+// notification reports its IMSI and operator. A SIM that does not come up
+// is left again: after rotationMaxAttempts sessions the previous target is
+// switched back.
+
+// rotationMaxAttempts is the number of sessions a rotated SIM gets to come
+// up before the rotation is rolled back.
+const rotationMaxAttempts = 3
+
+// rotationRetry postpones a rotation while SMS are being delivered.
+const rotationRetry = time.Minute
+
+// errSIMRotated ends the session after a rotation: the modem re-reads the
+// SIM and is initialized again.
+var errSIMRotated = errors.New("SIM rotated: reinitializing the modem")
+
+// simTarget is one SIM of the rotation: a physical slot of a dual-SIM
+// module (AT+QDSIM, Quectel) or an eSIM profile by ICCID. Slot -1 is an
+// unknown SIM.
+type simTarget struct {
+	slot  int
+	iccid string
+}
+
+// String names the target for logs and notifications; an ICCID is masked.
+func (t simTarget) String() string {
+	if t.iccid != "" {
+		return "eSIM " + maskICCID([]string{t.iccid})
+	}
+	if t.slot < 0 {
+		return "unknown SIM"
+	}
+	return fmt.Sprintf("slot %d", t.slot)
+}
+
+// parseSIMTargets parses SIM_ROTATION: slot numbers and eSIM ICCIDs,
+// comma-separated, at least two and no repeats.
+func parseSIMTargets(s string) ([]simTarget, error) {
+	var targets []simTarget
+	seen := make(map[simTarget]bool)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		var t simTarget
+		if validICCID(entry) {
+			t.iccid = entry
+		} else if slot, err := strconv.Atoi(entry); err == nil && slot >= 0 && slot <= 9 {
+			t.slot = slot
+		} else {
+			return nil, fmt.Errorf("%q is neither a SIM slot (0-9) nor an eSIM ICCID", entry)
+		}
+		if seen[t] {
+			return nil, fmt.Errorf("%q is listed twice", entry)
+		}
+		seen[t] = true
+		targets = append(targets, t)
+	}
+	if len(targets) < 2 {
+		return nil, errors.New("at least two SIMs are needed")
+	}
+	return targets, nil
+}
+
+// simRotation rotates the SIM on its schedule. Created in run() and used by
+// the modem goroutine only. Nil-safe: a nil rotation never rotates.
+type simRotation struct {
+	targets  []simTarget
+	schedule *MaintenanceSchedule
+	// switched is set by a rotation until the new SIM is up; attempts
+	// counts the sessions started on it.
+	switched bool
+	from, to simTarget
+	attempts int
+}
+
+func newSIMRotation(targets []simTarget, schedule *MaintenanceSchedule) *simRotation {
+	if len(targets) == 0 {
+		return nil
+	}
+	return &simRotation{targets: targets, schedule: schedule}
+}
+
+// next returns a channel that fires at the next scheduled rotation; nil
+// (never) for a nil rotation.
+func (r *simRotation) next() <-chan time.Time {
+	if r == nil {
+		return nil
+	}
+	now := clk.Now()
+	next := r.schedule.Next(now)
+	slog.Debug("Next SIM rotation", "at", next)
+	return clk.After(next.Sub(now))
+}
+
+// rotate switches to the target after the active one. With retry the
+// delivery queue was busy and the rotation should be tried again after
+// rotationRetry. Only a transport error is returned, and errSIMRotated after
+// a switch; a refused switch is notified and waits for the next scheduled
+// time.
+func (r *simRotation) rotate(ctx context.Context, modem ATCommander, queue *deliveryQueue, notifier *ErrorNotifier) (retry bool, err error) {
+	// The slots of an unsettled SMS must not be deleted on another SIM.
+	if !queue.idle() {
+		slog.Info("SIM rotation postponed: SMS are being delivered", "retry_in", rotationRetry)
+		return true, nil
+	}
+	cur, err := r.current(modem)
+	if at.IsTimeoutError(err) {
+		return false, err
+	}
+	from := simTarget{slot: -1}
+	if cur >= 0 {
+		from = r.targets[cur]
+	}
+	to := r.targets[(cur+1)%len(r.targets)]
+	slog.Info("Rotating SIM", "from", from, "to", to)
+	if err := switchSIMTarget(modem, to); err != nil {
+		if at.IsTimeoutError(err) {
+			return false, err
+		}
+		slog.Error("SIM rotation failed", "to", to, "error", err)
+		notifyRotationFailure(ctx, notifier, fmt.Sprintf("SIM rotation to %s failed: %v", to, err))
+		return false, nil
+	}
+	r.switched, r.from, r.to, r.attempts = true, from, to, 0
+	return false, errSIMRotated
+}
+
+// current returns the index of the active target, -1 if unknown. ICCIDs are
+// matched first: an eSIM profile may sit in one of the slots too.
+func (r *simRotation) current(modem ATCommander) (int, error) {
+	var hasSlots, hasICCIDs bool
+	for _, t := range r.targets {
+		hasSlots = hasSlots || t.iccid == ""
+		hasICCIDs = hasICCIDs || t.iccid != ""
+	}
+	if hasICCIDs {
+		resp, err := modem.Command("AT+CCID")
+		if at.IsTimeoutError(err) {
+			return -1, err
+		}
+		if iccid := parseCCID(resp); err == nil && iccid != "" {
+			for i, t := range r.targets {
+				if t.iccid == iccid {
+					return i, nil
+				}
+			}
+		}
+	}
+	if hasSlots {
+		resp, err := modem.Command("AT+QDSIM?")
+		if at.IsTimeoutError(err) {
+			return -1, err
+		}
+		if slot, ok := parseQDSIM(resp); err == nil && ok {
+			for i, t := range r.targets {
+				if t.iccid == "" && t.slot == slot {
+					return i, nil
+				}
+			}
+		}
+	}
+	return -1, nil
+}
+
+// switchSIMTarget activates t. The modem reads the new SIM after the
+// session's AT+CFUN cycle.
+func switchSIMTarget(modem ATCommander, t simTarget) error {
+	if t.iccid != "" {
+		return switchESIMProfile(modem, t.iccid)
+	}
+	_, err := modem.Command(fmt.Sprintf("AT+QDSIM=%d", t.slot))
+	return err
+}
+
+// sessionStarting runs before every session init: a rotated SIM that did
+// not come up in rotationMaxAttempts sessions is switched back. Returns
+// errSIMRotated after switching back, or a transport error.
+func (r *simRotation) sessionStarting(ctx context.Context, modem ATCommander, notifier *ErrorNotifier) error {
+	if r == nil || !r.switched {
+		return nil
+	}
+	r.attempts++
+	if r.attempts <= rotationMaxAttempts {
+		return nil
+	}
+	r.switched = false
+	if r.from.slot < 0 {
+		slog.Error("Rotated SIM did not come up, previous SIM unknown", "sim", r.to)
+		notifyRotationFailure(ctx, notifier, fmt.Sprintf("SIM %s did not come up after %d attempts; the previous SIM is unknown", r.to, rotationMaxAttempts))
+		return nil
+	}
+	slog.Error("Rotated SIM did not come up, switching back", "sim", r.to, "back_to", r.from)
+	if err := switchSIMTarget(modem, r.from); err != nil {
+		if at.IsTimeoutError(err) {
+			return err
+		}
+		notifyRotationFailure(ctx, notifier, fmt.Sprintf("SIM %s did not come up and switching back to %s failed: %v", r.to, r.from, err))
+		return nil
+	}
+	notifyRotationFailure(ctx, notifier, fmt.Sprintf("SIM %s did not come up after %d attempts, switched back to %s", r.to, rotationMaxAttempts, r.from))
+	return errSIMRotated
+}
+
+// sessionUp reports a rotation once the session on the new SIM is
+// registered (best effort).
+func (r *simRotation) sessionUp(ctx context.Context, modem ATCommander, notifier *ErrorNotifier, charset string, operatorNames map[string]string) {
+	if r == nil || !r.switched {
+		return
+	}
+	r.switched = false
+	imsi, operator := "unknown", "unknown"
+	if resp, err := modem.Command("AT+CIMI"); err == nil {
+		if s := parseCIMI(resp); s != "" {
+			imsi = s
+		}
+	}
+	if resp, err := modem.Command("AT+COPS?"); err == nil {
+		if s := decodeTEString(parseCOPS(resp), charset); s != "" {
+			operator = operatorName(s, operatorNames)
+		}
+	}
+	slog.Info("SIM rotated", "sim", r.to, "imsi_masked", maskICCID([]string{imsi}), "operator", operator)
+	msg := fmt.Sprintf("<b>SMS Gateway SIM Rotation</b>\n\n"+
+		"<b>Host:</b> %s\n"+
+		"<b>SIM:</b> %s (was %s)\n"+
+		"<b>IMSI:</b> <code>%s</code>\n"+
+		"<b>Operator:</b> %s",
+		notifier.hostHTML(), escapeHTML(r.to.String()), escapeHTML(r.from.String()),
+		escapeHTML(imsi), escapeHTML(operator))
+	if err := notifier.sendToTelegram(ctx, msg); err != nil {
+		slog.Error("Failed to send SIM rotation notification", "error", err)
+	}
+}
+
+func notifyRotationFailure(ctx context.Context, notifier *ErrorNotifier, warning string) {
+	msg := fmt.Sprintf("<b>SMS Gateway Alert</b>\n\n"+
+		"<b>Host:</b> %s\n"+
+		"<b>Warning:</b> %s",
+		notifier.hostHTML(), escapeHTML(warning))
+	if err := notifier.sendToTelegram(ctx, msg); err != nil {
+		slog.Error("Failed to send SIM rotation alert", "error", err)
+	}
+}
+
+// parseCCID extracts the ICCID of an AT+CCID answer ("+CCID: <iccid>",
+// "+ICCID: <iccid>" or the bare number), without the F padding.
+func parseCCID(lines []string) string {
+	for _, line := range lines {
+		if _, rest, ok := strings.Cut(line, ":"); ok {
+			line = rest
+		}
+		s := strings.TrimRight(strings.Trim(strings.TrimSpace(line), `"`), "Ff")
+		if validICCID(s) {
+			return s
+		}
+	}
+	return ""
+}
+
+// parseQDSIM extracts the slot of "+QDSIM: <slot>".
+func parseQDSIM(lines []string) (int, bool) {
+	for _, line := range lines {
+		if rest, ok := strings.CutPrefix(line, "+QDSIM:"); ok {
+			slot, err := strconv.Atoi(strings.TrimSpace(rest))
+			return slot, err == nil
+		}
+	}
+	return 0, false
+}
+
+// parseCIMI extracts the IMSI (up to 15 digits) of an AT+CIMI answer.
+func parseCIMI(lines []string) string {
+	for _, line := range lines {
+		s := strings.TrimSpace(line)
+		if len(s) >= 6 && len(s) <= 15 && strings.Trim(s, "0123456789") == "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,234 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+func TestParseSIMTargets(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []simTarget
+		wantErr bool
+	}{
+		{"0,1", []simTarget{{slot: 0}, {slot: 1}}, false},
+		{" 1 , " + esimICCIDA, []simTarget{{slot: 1}, {iccid: esimICCIDA}}, false},
+		{esimICCIDA + "," + esimICCIDB, []simTarget{{iccid: esimICCIDA}, {iccid: esimICCIDB}}, false},
+		{"1", nil, true},
+		{"0,0", nil, true},
+		{"0,,1", nil, true},
+		{"0,10", nil, true},
+		{"0,-1", nil, true},
+		{"0,sim2", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSIMTargets(tt.in)
+		if (err != nil) != tt.wantErr || !slices.Equal(got, tt.want) {
+			t.Errorf("parseSIMTargets(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSIMRotationRotate(t *testing.T) {
+	slots := []simTarget{{slot: 0}, {slot: 1}}
+	esims := []simTarget{{iccid: esimICCIDB}, {iccid: esimICCIDA}}
+	tests := []struct {
+		name    string
+		targets []simTarget
+		script  func(f *fakeAT)
+		busy    bool
+		// wantCmd is the switch command, "" for none.
+		wantCmd   string
+		wantErr   error
+		wantRetry bool
+		wantFrom  string
+		wantAlert string
+	}{
+		{
+			name:    "next slot",
+			targets: slots,
+			script:  func(f *fakeAT) { f.on("AT+QDSIM?", []string{"+QDSIM: 0"}, nil) },
+			wantCmd: "AT+QDSIM=1", wantErr: errSIMRotated, wantFrom: "slot 0",
+		},
+		{
+			name:    "wraps around",
+			targets: slots,
+			script:  func(f *fakeAT) { f.on("AT+QDSIM?", []string{"+QDSIM: 1"}, nil) },
+			wantCmd: "AT+QDSIM=0", wantErr: errSIMRotated, wantFrom: "slot 1",
+		},
+		{
+			name:    "unknown current: first target",
+			targets: slots,
+			script:  func(f *fakeAT) { f.on("AT+QDSIM?", nil, at.ErrModemError) },
+			wantCmd: "AT+QDSIM=0", wantErr: errSIMRotated, wantFrom: "unknown SIM",
+		},
+		{
+			name:    "eSIM profiles by ICCID",
+			targets: esims,
+			script: func(f *fakeAT) {
+				f.on("AT+CCID", []string{"+CCID: " + esimICCIDB + "F"}, nil)
+				f.on(esimOpen, []string{"+CCHO: 1"}, nil)
+				f.on(esimSwitch, cglaAnswer("BF3103800100"+esimSuccess), nil)
+			},
+			wantCmd: esimSwitch, wantErr: errSIMRotated, wantFrom: "eSIM ****4567",
+		},
+		{
+			name:    "switch refused",
+			targets: slots,
+			script: func(f *fakeAT) {
+				f.on("AT+QDSIM?", []string{"+QDSIM: 0"}, nil)
+				f.on("AT+QDSIM=1", nil, at.ErrModemError)
+			},
+			wantCmd:   "AT+QDSIM=1",
+			wantAlert: "SIM rotation to slot 1 failed",
+		},
+		{
+			name:    "transport error",
+			targets: slots,
+			script:  func(f *fakeAT) { f.on("AT+QDSIM?", nil, at.ErrModemTimeout) },
+			wantErr: at.ErrModemTimeout,
+		},
+		{
+			name:      "postponed while delivering",
+			targets:   slots,
+			script:    func(f *fakeAT) {},
+			busy:      true,
+			wantRetry: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeAT()
+			tt.script(f)
+			sender := &fakeSender{}
+			notifier := NewErrorNotifier(sender, []int64{1}, false, "gw1", time.Second)
+			queue := newDeliveryQueue(0)
+			if tt.busy {
+				queue.submit(PendingSMS{Message: SMSMessage{Index: 1, From: "+1", Text: "x"}, PartIndices: []int{1}})
+			}
+			r := newSIMRotation(tt.targets, nil)
+
+			retry, err := r.rotate(context.Background(), f, queue, notifier)
+			if retry != tt.wantRetry || !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("rotate() = %v, %v; want %v, %v", retry, err, tt.wantRetry, tt.wantErr)
+			}
+			if tt.wantCmd != "" && f.commandCount(tt.wantCmd) != 1 {
+				t.Errorf("calls = %q, want one %s", f.calls, tt.wantCmd)
+			}
+			if tt.wantCmd == "" && slices.ContainsFunc(f.calls, func(c string) bool { return strings.HasPrefix(c, "AT+QDSIM=") }) {
+				t.Errorf("calls = %q, want no switch", f.calls)
+			}
+			if r.switched != errors.Is(err, errSIMRotated) || (r.switched && r.from.String() != tt.wantFrom) {
+				t.Errorf("switched = %v from %s, want from %q", r.switched, r.from, tt.wantFrom)
+			}
+			msgs := sender.sentTo(1)
+			if tt.wantAlert == "" && len(msgs) != 0 || tt.wantAlert != "" && (len(msgs) != 1 || !strings.Contains(msgs[0].Text, tt.wantAlert)) {
+				t.Errorf("alerts = %+v, want %q", msgs, tt.wantAlert)
+			}
+		})
+	}
+}
+
+func TestSIMRotationSessions(t *testing.T) {
+	ctx := context.Background()
+	rotated := func(t *testing.T) (*simRotation, *fakeAT, *fakeSender, *ErrorNotifier) {
+		t.Helper()
+		f := newFakeAT()
+		f.on("AT+QDSIM?", []string{"+QDSIM: 0"}, nil)
+		f.on("AT+CIMI", []string{"262019876543210"}, nil)
+		f.on("AT+COPS?", []string{`+COPS: 0,0,"T-Mobile <DE>",7`}, nil)
+		sender := &fakeSender{}
+		notifier := NewErrorNotifier(sender, []int64{1}, false, "gw1", time.Second)
+		r := newSIMRotation([]simTarget{{slot: 0}, {slot: 1}}, nil)
+		if _, err := r.rotate(ctx, f, newDeliveryQueue(0), notifier); !errors.Is(err, errSIMRotated) {
+			t.Fatalf("rotate() error = %v, want errSIMRotated", err)
+		}
+		return r, f, sender, notifier
+	}
+
+	t.Run("reported once up", func(t *testing.T) {
+		r, f, sender, notifier := rotated(t)
+		for range rotationMaxAttempts {
+			if err := r.sessionStarting(ctx, f, notifier); err != nil {
+				t.Fatalf("sessionStarting() error = %v", err)
+			}
+		}
+		r.sessionUp(ctx, f, notifier, "", nil)
+		r.sessionUp(ctx, f, notifier, "", nil)
+		msgs := sender.sentTo(1)
+		if len(msgs) != 1 {
+			t.Fatalf("sent %d messages, want 1", len(msgs))
+		}
+		for _, want := range []string{"slot 1 (was slot 0)", "<code>262019876543210</code>", "T-Mobile &lt;DE&gt;"} {
+			if !strings.Contains(msgs[0].Text, want) {
+				t.Errorf("notification = %q, missing %q", msgs[0].Text, want)
+			}
+		}
+		if err := r.sessionStarting(ctx, f, notifier); err != nil || f.commandCount("AT+QDSIM=0") != 0 {
+			t.Errorf("sessionStarting() after the report = %v, switch-back calls %d", err, f.commandCount("AT+QDSIM=0"))
+		}
+	})
+
+	t.Run("switched back", func(t *testing.T) {
+		r, f, sender, notifier := rotated(t)
+		for i := range rotationMaxAttempts {
+			if err := r.sessionStarting(ctx, f, notifier); err != nil {
+				t.Fatalf("sessionStarting() #%d error = %v", i+1, err)
+			}
+		}
+		if err := r.sessionStarting(ctx, f, notifier); !errors.Is(err, errSIMRotated) {
+			t.Fatalf("sessionStarting() error = %v, want errSIMRotated", err)
+		}
+		if f.commandCount("AT+QDSIM=0") != 1 {
+			t.Errorf("calls = %q, want AT+QDSIM=0", f.calls)
+		}
+		msgs := sender.sentTo(1)
+		if len(msgs) != 1 || !strings.Contains(msgs[0].Text, "switched back to slot 0") {
+			t.Errorf("alerts = %+v, want the switch back", msgs)
+		}
+		r.sessionUp(ctx, f, notifier, "", nil)
+		if len(sender.sentTo(1)) != 1 {
+			t.Error("rotation reported after switching back")
+		}
+	})
+
+	var none *simRotation
+	if none.next() != nil || none.sessionStarting(ctx, nil, nil) != nil {
+		t.Error("nil rotation is active")
+	}
+	none.sessionUp(ctx, nil, nil, "", nil)
+}
+
+func TestParseSIMIdentity(t *testing.T) {
+	for _, tt := range []struct {
+		lines []string
+		want  string
+	}{
+		{[]string{"+CCID: 89882280000012345678"}, esimICCIDA},
+		{[]string{"+ICCID: 8944476500001234567F"}, esimICCIDB},
+		{[]string{`"8944476500001234567F"`}, esimICCIDB},
+		{[]string{"ERROR"}, ""},
+	} {
+		if got := parseCCID(tt.lines); got != tt.want {
+			t.Errorf("parseCCID(%q) = %q, want %q", tt.lines, got, tt.want)
+		}
+	}
+	if got := parseCIMI([]string{"262019876543210"}); got != "262019876543210" {
+		t.Errorf("parseCIMI() = %q", got)
+	}
+	if got := parseCIMI([]string{"+CME ERROR: 10"}); got != "" {
+		t.Errorf("parseCIMI(error) = %q, want empty", got)
+	}
+	if slot, ok := parseQDSIM([]string{"+QDSIM: 1"}); !ok || slot != 1 {
+		t.Errorf("parseQDSIM() = %d, %v; want 1", slot, ok)
+	}
+}
@@ -0,0 +1,419 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Sink is one destination for received SMS (Telegram, webhook, ...). Send is
+// called from the delivery goroutine, one message at a time, and must honor
+// DRY_RUN itself (log instead of performing external side effects).
+//
+// A nil error means the SMS reached the destination. An error wrapping
+// errSinkRejected means the destination permanently refuses this message;
+// any other error is transient and the SMS is retried on the next poll.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, pending PendingSMS) error
+}
+
+// errSinkRejected marks a permanent, message-specific refusal: retrying the
+// same content is pointless.
+var errSinkRejected = errors.New("message permanently rejected")
+
+// deliveryStatus is the outcome of delivering one PendingSMS.
+type deliveryStatus int
+
+const (
+	// deliveryDone: every sink accepted the SMS — the SIM slots may be
+	// deleted.
+	deliveryDone deliveryStatus = iota
+	// deliveryRejected: a sink permanently rejected the content; the SMS
+	// stays on the SIM, an operator alert was emitted once, and the message
+	// is skipped (not re-sent) until process restart. Later SMS proceed.
+	deliveryRejected
+	// deliveryDeferred: transient failure, rate limit or destination
+	// misconfiguration — retain everything and let the next poll retry.
+	deliveryDeferred
+	// deliveryDropped: the sender is on the blocklist — nothing was sent and
+	// the SIM slots are deleted (an explicit operator decision).
+	deliveryDropped
+	// deliveryConsumed: a pipeline step took the SMS for itself (loopback
+	// self-test, already forwarded duplicate) — the SIM slots are deleted
+	// without archiving.
+	deliveryConsumed
+	// deliveryQueued: handed to the delivery queue — the SMS stays on the
+	// SIM and the modem goroutine goes on; its outcome comes back as a
+	// deliveryResult (deliveryqueue.go).
+	deliveryQueued
+	// deliveryKept: the SMS was forwarded before and DELETE_POLICY=never
+	// keeps it on the SIM — nothing is sent and its slots stay.
+	deliveryKept
+)
+
+// Deletion policies (DELETE_POLICY): when a forwarded SMS is deleted from
+// the SIM. "all" waits until every sink, and every routed Telegram chat,
+// accepted it, retrying the others; "any" deletes it once one of them did
+// and gives up on the rest; "never" leaves it on the SIM and skips it on
+// later polls. Blocked senders, self-test SMS, status reports and stale
+// parts are deleted under every policy.
+const (
+	deletePolicyAll   = "all"
+	deletePolicyAny   = "any"
+	deletePolicyNever = "never"
+)
+
+// Deliverer fans one received SMS out to every configured sink, Telegram
+// first. The SIM is the retry queue: the SMS is only reported done once all
+// sinks accepted it, and sinks that already accepted it are not re-sent to
+// while the others are retried. It persists across modem session reopens
+// (created once in run()).
+type Deliverer struct {
+	notifier *ErrorNotifier
+	cfg      *Config
+
+	// telegram is also sinks[0]; kept typed for its Telegram-specific state.
+	telegram *TelegramSink
+	sinks    []Sink
+	// sinkDone records, per message key, the sinks that already accepted a
+	// message that is not finished yet, and when.
+	sinkDone map[string]map[string]AuditDestination
+	// rejected remembers permanently rejected messages (by message key, with
+	// when they were rejected) so they are not re-sent to already-delivered
+	// destinations on every poll; the SIM slot stays until removed manually.
+	rejected map[string]time.Time
+	// kept holds the message keys of SMS forwarded under DELETE_POLICY=never,
+	// for SMS without PDUs (text mode) the delivered-PDU store cannot know.
+	kept map[string]struct{}
+	// blocklist drops SMS from denied senders; nil blocks nothing.
+	blocklist *SenderBlocklist
+	// archive records finished SMS for /export; nil disables archiving.
+	archive *MessageArchive
+	// audit records the outcome of every SMS; nil disables it. firstSeen
+	// holds, per message key, when delivery of an unfinished SMS began.
+	audit     *AuditLog
+	firstSeen map[string]time.Time
+	// selfTest consumes loopback self-test SMS; nil disables.
+	selfTest *SelfTest
+	// samples captures anonymized undecodable PDUs (PDU_SAMPLE_FILE); nil
+	// disables.
+	samples *PDUSampleFile
+	// quarantine keeps undecodable PDUs in STATE_DIR (quarantine.go); nil
+	// disables.
+	quarantine *PDUQuarantine
+	// translator translates the SMS text (translate.go); nil disables.
+	translator *Translator
+	// middleware are the pipeline steps run before the sinks (pipeline.go).
+	middleware []Middleware
+	// queue makes Deliver asynchronous (StartQueue); nil delivers in place.
+	queue *deliveryQueue
+	// progress persists sinkDone and rejected across restarts; nil keeps
+	// them in memory only.
+	progress *DeliveryProgress
+	// delivered remembers forwarded PDUs against re-delivery; nil disables.
+	delivered *DeliveredStore
+	// latency times the delivery phases (LATENCY_REPORT); nil disables.
+	latency *LatencyTracker
+	// injector adds synthetic SMS to the SIM listing (INJECT_API); nil
+	// disables.
+	injector *Injector
+	// slots is the modem session's view of the SIM for batch deletion
+	// (simdelete.go); set by runModemLoop and used by the modem goroutine
+	// only. Nil deletes slot by slot.
+	slots *simSlots
+	// deletions follows the deletions of every session (deleteverify.go);
+	// set in run() and used by the modem goroutine only. Nil checks
+	// nothing.
+	deletions *DeletionCheck
+	// reception is the SMS reception strategy (reception.go); set in run()
+	// and used by the modem goroutine only. Nil polls.
+	reception *reception
+	// cells tracks the serving cell (cell.go); set in run() and used by the
+	// modem goroutine only. Nil tracks nothing.
+	cells *cellTracker
+	// grouping merges rapid-fire SMS of one sender (group.go); set in run()
+	// and used by the modem goroutine only. Nil groups nothing.
+	grouping *senderGrouping
+	// rotation rotates the SIM on SIM_ROTATION_SCHEDULE (simrotation.go);
+	// set in run() and used by the modem goroutine only. Nil never rotates.
+	rotation *simRotation
+	// calls hangs up incoming calls (calls.go); set in run() and used by
+	// the modem goroutine only. Nil leaves them alone.
+	calls *callRejecter
+	// telegramSent hands the Telegram messages of a forwarded SMS, by
+	// message key, from fanOut to archiveOutcome, which may run on another
+	// goroutine (the delivery queue's).
+	telegramMu   sync.Mutex
+	telegramSent map[string][]TelegramMessageRef
+}
+
+// NewDeliverer creates a Deliverer whose only sink is Telegram; further sinks
+// are appended with AddSink.
+func NewDeliverer(sender TelegramSender, notifier *ErrorNotifier, cfg *Config) *Deliverer {
+	telegram := NewTelegramSink(sender, notifier, cfg)
+	d := &Deliverer{
+		notifier:  notifier,
+		cfg:       cfg,
+		telegram:  telegram,
+		sinks:     []Sink{telegram},
+		sinkDone:  make(map[string]map[string]AuditDestination),
+		rejected:  make(map[string]time.Time),
+		kept:      make(map[string]struct{}),
+		firstSeen: make(map[string]time.Time),
+
+		telegramSent: make(map[string][]TelegramMessageRef),
+	}
+	if cfg.Translate != nil {
+		d.translator = NewTranslator(*cfg.Translate, cfg.DryRun)
+	}
+	d.middleware = d.builtinMiddleware()
+	return d
+}
+
+// AddSink appends a sink after Telegram.
+func (d *Deliverer) AddSink(s Sink) {
+	d.sinks = append(d.sinks, s)
+}
+
+// messageKey identifies one pending SMS. The SIM indices are part of the
+// identity: two identical SMS in different slots are distinct deliveries.
+func messageKey(pending PendingSMS) string {
+	msg := pending.Message
+	return contentFingerprint(fmt.Sprint(pending.PartIndices) + "\x00" + msg.From + "\x00" +
+		msg.Time.String() + "\x00" + msg.Text)
+}
+
+// Deliver delivers one pending SMS, or with a started queue only submits it
+// and returns deliveryQueued.
+func (d *Deliverer) Deliver(ctx context.Context, pending PendingSMS) deliveryStatus {
+	if d.queue != nil {
+		return d.queue.submit(pending)
+	}
+	return d.deliverNow(ctx, pending)
+}
+
+// deliverNow runs one pending SMS through the middleware chain and forwards
+// it to every sink that has not accepted it yet.
+func (d *Deliverer) deliverNow(ctx context.Context, pending PendingSMS) deliveryStatus {
+	ctx = withTrace(ctx, pending.TraceID)
+	// The key of the SMS as read from the SIM: steps may change the content.
+	key := messageKey(pending)
+	handler := func(ctx context.Context, pending PendingSMS) deliveryStatus {
+		return d.fanOut(ctx, key, pending)
+	}
+	for i := len(d.middleware) - 1; i >= 0; i-- {
+		handler = d.middleware[i](handler)
+	}
+	return handler(ctx, pending)
+}
+
+// fanOut is the end of the pipeline: the sinks.
+func (d *Deliverer) fanOut(ctx context.Context, key string, pending PendingSMS) deliveryStatus {
+	pending.Instance = d.cfg.Instance
+	if _, isRejected := d.rejected[key]; isRejected {
+		slog.DebugContext(ctx, "Skipping previously rejected message", "index", pending.Message.Index)
+		return deliveryRejected
+	}
+	if _, seen := d.firstSeen[key]; !seen && d.auditing() {
+		d.firstSeen[key] = clk.Now()
+	}
+
+	// With DELETE_POLICY=any a failing sink does not stop the others: the
+	// first rejecting sink and the missed ones are remembered instead.
+	anySink := d.cfg.DeletePolicy == deletePolicyAny
+	var rejectedBy string
+	var missed []string
+	done := d.sinkDone[key]
+	for _, sink := range d.sinks {
+		if _, ok := done[sink.Name()]; ok {
+			continue
+		}
+		start := clk.Now()
+		err := sink.Send(ctx, pending)
+		d.latency.SinkCalled(key, sink.Name(), start, clk.Now().Sub(start))
+		switch {
+		case err == nil:
+			if done == nil {
+				done = make(map[string]AuditDestination)
+				d.sinkDone[key] = done
+			}
+			done[sink.Name()] = d.accepted(key, sink)
+			d.saveProgress()
+			continue
+		case errors.Is(err, errSinkRejected):
+			slog.ErrorContext(ctx, "Sink permanently rejected SMS", "sink", sink.Name(), "error", err)
+			if !anySink {
+				return d.reject(ctx, key, pending, sink.Name())
+			}
+			if rejectedBy == "" {
+				rejectedBy = sink.Name()
+			}
+		default:
+			slog.WarnContext(ctx, "Sink delivery deferred", "sink", sink.Name(), "error", err)
+			if !anySink {
+				return deliveryDeferred
+			}
+		}
+		missed = append(missed, sink.Name())
+	}
+	if len(missed) > 0 {
+		switch {
+		case len(done) == 0 && rejectedBy != "":
+			return d.reject(ctx, key, pending, rejectedBy)
+		case len(done) == 0:
+			return deliveryDeferred
+		}
+		slog.WarnContext(ctx, "SMS reached only some sinks, deleting it (DELETE_POLICY=any)",
+			"missed", missed, "indices", pending.PartIndices)
+	}
+
+	d.finish(key, pending, archiveForwarded, "")
+	d.delivered.Record(pduHash(pending))
+	if d.cfg.DeletePolicy == deletePolicyNever {
+		d.kept[key] = struct{}{}
+	}
+	if d.archiving() {
+		d.telegramMu.Lock()
+		d.telegramSent[key] = done[d.telegram.Name()].Messages
+		d.telegramMu.Unlock()
+	}
+	delete(d.sinkDone, key)
+	d.saveProgress()
+	return deliveryDone
+}
+
+// reject settles an SMS sink permanently refused: it stays on the SIM,
+// skipped until restart, and the operator is alerted once.
+func (d *Deliverer) reject(ctx context.Context, key string, pending PendingSMS, sink string) deliveryStatus {
+	d.finish(key, pending, auditRejected, sink)
+	delete(d.sinkDone, key)
+	d.rejected[key] = clk.Now()
+	d.latency.Forget(key)
+	d.saveProgress()
+	d.alertRejected(ctx, sink, pending)
+	return deliveryRejected
+}
+
+// accepted describes the acceptance of message key by sink, just now.
+func (d *Deliverer) accepted(key string, sink Sink) AuditDestination {
+	now := clk.Now()
+	dest := AuditDestination{Sink: sink.Name(), At: now}
+	if sink == Sink(d.telegram) {
+		dest.ChatIDs = d.telegram.lastChatIDs
+		dest.Messages = d.telegram.lastMessages
+	}
+	if seen, ok := d.firstSeen[key]; ok {
+		dest.LatencyMS = now.Sub(seen).Milliseconds()
+	}
+	return dest
+}
+
+// finish records the final outcome of an SMS in the metrics, the audit log
+// and, for undecodable SMS, PDU_SAMPLE_FILE.
+func (d *Deliverer) finish(key string, pending PendingSMS, outcome, rejectedBy string) {
+	d.notifier.metrics.SMSReceived()
+	d.recordParseFailure(pending)
+	d.auditOutcome(key, pending, outcome, rejectedBy)
+}
+
+// auditing reports whether outcomes are audited. DRY_RUN keeps messages on
+// the SIM, so auditing there would add a record every poll.
+func (d *Deliverer) auditing() bool {
+	return d.audit != nil && !d.cfg.DryRun
+}
+
+// auditOutcome writes the audit record of a finished SMS and forgets when
+// it was first seen. Audit failures are logged, never block delivery.
+func (d *Deliverer) auditOutcome(key string, pending PendingSMS, outcome, rejectedBy string) {
+	if !d.auditing() {
+		return
+	}
+	now := clk.Now()
+	received, ok := d.firstSeen[key]
+	if !ok {
+		received = now // blocked senders are never delivered
+	}
+	delete(d.firstSeen, key)
+	msg := pending.Message
+	rec := AuditRecord{
+		Time:            now,
+		Outcome:         outcome,
+		ID:              key,
+		From:            msg.From,
+		ReceivedAt:      received,
+		LatencyMS:       now.Sub(received).Milliseconds(),
+		Parts:           len(pending.PartIndices),
+		SIMIndices:      pending.PartIndices,
+		TextLength:      len([]rune(msg.Text)),
+		TextFingerprint: contentFingerprint(msg.Text),
+		Destinations:    []AuditDestination{},
+		RejectedBy:      rejectedBy,
+	}
+	if !msg.Time.IsZero() {
+		t := msg.Time
+		rec.SMSTime = &t
+	}
+	for _, sink := range d.sinks {
+		if dest, ok := d.sinkDone[key][sink.Name()]; ok {
+			rec.Destinations = append(rec.Destinations, dest)
+		}
+	}
+	if err := d.audit.Record(rec); err != nil {
+		slog.Error("Failed to write audit record", "trace", pending.TraceID, "indices", pending.PartIndices, "error", err)
+	}
+}
+
+// archiving reports whether finished SMS are archived. DRY_RUN keeps
+// messages on the SIM, so archiving there would add a record every poll.
+func (d *Deliverer) archiving() bool {
+	return d.archive != nil && !d.cfg.DryRun
+}
+
+// archiveOutcome records a finished SMS, with the Telegram messages it
+// became, right before its SIM slots are freed. Archive failures are
+// logged, never block delivery.
+func (d *Deliverer) archiveOutcome(pending PendingSMS, outcome string) {
+	if !d.archiving() {
+		return
+	}
+	key := messageKey(pending)
+	d.telegramMu.Lock()
+	sent := d.telegramSent[key]
+	delete(d.telegramSent, key)
+	d.telegramMu.Unlock()
+	if err := d.archive.Record(pending, outcome, sent); err != nil {
+		slog.Error("Failed to archive SMS", "trace", pending.TraceID, "indices", pending.PartIndices, "error", err)
+	}
+}
+
+// alertRejected notifies the operator (once per message — the caller dedups
+// via the rejected set) that an SMS is stuck on the SIM.
+func (d *Deliverer) alertRejected(ctx context.Context, sink string, pending PendingSMS) {
+	msg := fmt.Sprintf("<b>SMS Gateway Alert</b>\n\n"+
+		"<b>Error:</b> %s permanently rejected a forwarded SMS\n"+
+		"<b>From:</b> <code>%s</code>\n"+
+		"<b>SIM slot(s):</b> %s\n\n"+
+		"<i>The SMS is kept on the SIM and will occupy its slot until removed manually (e.g. AT+CMGD).</i>",
+		escapeHTML(sinkDisplayName(sink)),
+		escapeHTML(pending.Message.From),
+		escapeHTML(fmt.Sprint(pending.PartIndices)))
+
+	if err := d.notifier.sendToTelegram(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "Failed to send rejected-message alert", "error", err)
+	}
+}
+
+// sinkDisplayName keeps the historical "Telegram" wording in alerts.
+func sinkDisplayName(name string) string {
+	if name == "telegram" {
+		return "Telegram"
+	}
+	return "Sink " + name
+}
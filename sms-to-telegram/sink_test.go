@@ -0,0 +1,159 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestDeliverer_FanOutRetriesOnlyPendingSinks: a transient failure of a
+// later sink defers the SMS, and the retry does not re-send to sinks that
+// already accepted it.
+func TestDeliverer_FanOutRetriesOnlyPendingSinks(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	cfg := testConfig()
+	deliverer, sender, _ := newTestDeliverer(cfg)
+	extra := &fakeSink{name: "extra", errs: []error{errors.New("connection refused")}}
+	deliverer.AddSink(extra)
+
+	pending := PendingSMS{Message: SMSMessage{Index: 1, From: "+100", Text: "hi"}, PartIndices: []int{1}}
+	if got := deliverer.Deliver(context.Background(), pending); got != deliveryDeferred {
+		t.Fatalf("first Deliver() = %v, want deliveryDeferred", got)
+	}
+	if got := deliverer.Deliver(context.Background(), pending); got != deliveryDone {
+		t.Fatalf("retry Deliver() = %v, want deliveryDone", got)
+	}
+	if len(sender.sent) != len(cfg.ChatIDs) {
+		t.Errorf("telegram sends = %d, want %d (no re-send on retry)", len(sender.sent), len(cfg.ChatIDs))
+	}
+	if len(extra.sent) != 2 {
+		t.Errorf("extra sink sends = %d, want 2", len(extra.sent))
+	}
+	if len(deliverer.sinkDone) != 0 {
+		t.Errorf("sinkDone = %v, want cleared after completion", deliverer.sinkDone)
+	}
+
+	// The same content in another slot is a new message for every sink.
+	pending.PartIndices = []int{2}
+	if got := deliverer.Deliver(context.Background(), pending); got != deliveryDone || len(extra.sent) != 3 {
+		t.Errorf("Deliver() = %v with %d extra sends, want deliveryDone and 3", got, len(extra.sent))
+	}
+}
+
+// TestDeliverer_SinkRejectionAlertsOnce: a permanent rejection by any sink
+// keeps the SMS on the SIM, alerts once naming the sink, and later polls
+// skip it.
+func TestDeliverer_SinkRejectionAlertsOnce(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	cfg := testConfig()
+	deliverer, _, alerts := newTestDeliverer(cfg)
+	extra := &fakeSink{name: "hook", errs: []error{fmt.Errorf("%w: HTTP 400", errSinkRejected)}}
+	deliverer.AddSink(extra)
+
+	pending := PendingSMS{Message: SMSMessage{Index: 1, From: "+100", Text: "hi"}, PartIndices: []int{1}}
+	for i := 0; i < 2; i++ {
+		if got := deliverer.Deliver(context.Background(), pending); got != deliveryRejected {
+			t.Fatalf("Deliver() #%d = %v, want deliveryRejected", i+1, got)
+		}
+	}
+	if len(extra.sent) != 1 {
+		t.Errorf("sink sends = %d, want 1 (rejected messages are not retried)", len(extra.sent))
+	}
+	alerted := 0
+	for _, m := range alerts.sent {
+		if strings.Contains(m.Text, "Sink hook permanently rejected") {
+			alerted++
+		}
+	}
+	if alerted != len(cfg.ChatIDs) {
+		t.Errorf("rejection alerts = %d, want one per alert chat (%d)", alerted, len(cfg.ChatIDs))
+	}
+}
+
+// TestDeliverer_DeletePolicy: with DELETE_POLICY=any one sink, or one
+// Telegram chat, is enough to finish the SMS; "all" waits for every one.
+func TestDeliverer_DeletePolicy(t *testing.T) {
+	down := errors.New("connection refused")
+	tests := []struct {
+		name           string
+		extraErr       error
+		chat200Down    bool
+		chat100Down    bool
+		wantAll        deliveryStatus
+		wantAny        deliveryStatus
+		wantAnyChatIDs []int64
+	}{
+		{"sink down", down, false, false, deliveryDeferred, deliveryDone, []int64{100, 200}},
+		{"chat down", nil, true, false, deliveryDeferred, deliveryDone, []int64{100}},
+		{"all down", down, true, true, deliveryDeferred, deliveryDeferred, nil},
+		{"nothing accepted, sink rejects", fmt.Errorf("%w: HTTP 400", errSinkRejected), true, true, deliveryDeferred, deliveryRejected, nil},
+	}
+	for _, tt := range tests {
+		for _, policy := range []string{deletePolicyAll, deletePolicyAny} {
+			t.Run(tt.name+"/"+policy, func(t *testing.T) {
+				t.Cleanup(swapClock(newFakeClock()))
+				cfg := testConfig()
+				cfg.TelegramRetries = 0
+				cfg.DeletePolicy = policy
+				deliverer, sender, _ := newTestDeliverer(cfg)
+				sender.script = func(_ int, chatID int64, _ string) error {
+					if chatID == 200 && tt.chat200Down || chatID == 100 && tt.chat100Down {
+						return errors.New("network down")
+					}
+					return nil
+				}
+				deliverer.AddSink(&fakeSink{name: "extra", errs: []error{tt.extraErr}})
+
+				pending := PendingSMS{Message: SMSMessage{Index: 1, From: "+100", Text: "hi"}, PartIndices: []int{1}}
+				want := tt.wantAll
+				if policy == deletePolicyAny {
+					want = tt.wantAny
+				}
+				if got := deliverer.Deliver(context.Background(), pending); got != want {
+					t.Fatalf("Deliver() = %v, want %v", got, want)
+				}
+				if policy == deletePolicyAny && want == deliveryDone {
+					if got := deliverer.telegram.lastChatIDs; fmt.Sprint(got) != fmt.Sprint(tt.wantAnyChatIDs) {
+						t.Errorf("reached chats %v, want %v", got, tt.wantAnyChatIDs)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestProcessMessages_DeletePolicyNever: a forwarded SMS stays on the SIM
+// and is not forwarded again, also after a restart with the delivered-PDU
+// store.
+func TestProcessMessages_DeletePolicyNever(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing([2]string{"+CMGL: 5,1,,29", testPDUSingle}), nil)
+	cfg := testConfig()
+	cfg.DeletePolicy = deletePolicyNever
+	deliverer, sender, _ := newTestDeliverer(cfg)
+	deliverer.delivered = NewDeliveredStore("")
+
+	for range 2 {
+		if err := processMessages(context.Background(), modem, deliverer, cfg, 30); err != nil {
+			t.Fatalf("processMessages() error = %v", err)
+		}
+	}
+	if len(sender.sent) != len(cfg.ChatIDs) {
+		t.Errorf("telegram sends = %d, want one per chat", len(sender.sent))
+	}
+
+	restarted, resent, _ := newTestDeliverer(cfg)
+	restarted.delivered = deliverer.delivered
+	if err := processMessages(context.Background(), modem, restarted, cfg, 30); err != nil {
+		t.Fatalf("processMessages() error = %v", err)
+	}
+	if len(resent.sent) != 0 || modem.commandCount("AT+CMGD=5") != 0 {
+		t.Errorf("after restart: %d sends, %d deletions; want the SMS left alone", len(resent.sent), modem.commandCount("AT+CMGD=5"))
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsD push (STATSD_ADDR): the /metrics values sent over UDP every
+// STATSD_INTERVAL, for Datadog or Graphite setups without a Prometheus
+// scraper. Names stay those of /metrics. Gauges are sent as they are,
+// counters as the increase since the last push, and of the AT command
+// histogram only the _sum and _count, as counters. Plain StatsD has no
+// labels, so their values become name components
+// (sms_to_telegram_sim_storage_used.SM); STATSD_FORMAT=dogstatsd sends
+// them as tags instead.
+const (
+	statsdFormatPlain = "statsd"
+	statsdFormatDog   = "dogstatsd"
+)
+
+// statsdMaxPacket keeps a datagram within the usual Ethernet MTU, the size
+// StatsD servers read.
+const statsdMaxPacket = 1432
+
+// statsdNameEscaper keeps label values from breaking the plain line format.
+var statsdNameEscaper = strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", " ", "_", "\n", "_")
+
+// statsdTagEscaper keeps label values from breaking the DogStatsD tags.
+var statsdTagEscaper = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// StatsDOptions configures the StatsD push (STATSD_*).
+type StatsDOptions struct {
+	Addr     string
+	Interval time.Duration
+	// Format is "statsd" or "dogstatsd" (labels as tags).
+	Format string
+}
+
+// statsdWriter turns the samples of one push into StatsD lines.
+type statsdWriter struct {
+	tags bool
+	// kind is the type of the current family.
+	kind string
+	// pushed holds the counter totals of the last push by series, totals
+	// those of this one.
+	pushed, totals map[string]float64
+	lines          []string
+}
+
+func (s *statsdWriter) gauge(name, help string, value float64, labels ...string) {
+	s.family(name, help, "gauge")
+	s.sample(name, value, labels...)
+}
+
+func (s *statsdWriter) family(name, help, kind string) {
+	s.kind = kind
+}
+
+func (s *statsdWriter) sample(name string, value float64, labels ...string) {
+	kind := s.kind
+	if kind == "histogram" {
+		if strings.HasSuffix(name, "_bucket") {
+			return
+		}
+		kind = "counter"
+	}
+	series := name
+	var tags []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		if s.tags {
+			tags = append(tags, labels[i]+":"+statsdTagEscaper.Replace(labels[i+1]))
+		} else {
+			series += "." + statsdNameEscaper.Replace(labels[i+1])
+		}
+	}
+	suffix := ""
+	if len(tags) > 0 {
+		suffix = "|#" + strings.Join(tags, ",")
+	}
+
+	if kind == "counter" {
+		key := series + suffix
+		s.totals[key] = value
+		value -= s.pushed[key]
+		if value <= 0 {
+			return
+		}
+		s.lines = append(s.lines, series+":"+formatStatsDValue(value)+"|c"+suffix)
+		return
+	}
+	// A signed plain StatsD gauge is a change, not a value: a negative one
+	// (dBm) is set from zero.
+	if value < 0 && !s.tags {
+		s.lines = append(s.lines, series+":0|g")
+	}
+	s.lines = append(s.lines, series+":"+formatStatsDValue(value)+"|g"+suffix)
+}
+
+func formatStatsDValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// packets joins the lines into datagrams of at most statsdMaxPacket bytes.
+func (s *statsdWriter) packets() [][]byte {
+	var packets [][]byte
+	var packet []byte
+	for _, line := range s.lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > statsdMaxPacket {
+			packets = append(packets, packet)
+			packet = nil
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		packets = append(packets, packet)
+	}
+	return packets
+}
+
+// StatsDPusher sends the Metrics to a StatsD server from its own goroutine.
+type StatsDPusher struct {
+	opts    StatsDOptions
+	metrics *Metrics
+	conn    net.Conn
+	// counters are the counter totals of the last successful push.
+	counters map[string]float64
+	// failing is set after a failed push, so an unreachable server is
+	// logged once, not every interval.
+	failing bool
+}
+
+func NewStatsDPusher(opts StatsDOptions, metrics *Metrics) *StatsDPusher {
+	return &StatsDPusher{opts: opts, metrics: metrics, counters: make(map[string]float64)}
+}
+
+// Run pushes every interval until ctx ends.
+func (p *StatsDPusher) Run(ctx context.Context) {
+	slog.Info("StatsD push enabled", "addr", p.opts.Addr, "interval", p.opts.Interval, "format", p.opts.Format)
+	defer func() {
+		if p.conn != nil {
+			p.conn.Close()
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-clk.After(p.opts.Interval):
+		}
+		err := p.push()
+		switch {
+		case err != nil && !p.failing:
+			slog.Warn("StatsD push failed", "addr", p.opts.Addr, "error", err)
+		case err == nil && p.failing:
+			slog.Info("StatsD push works again", "addr", p.opts.Addr)
+		}
+		p.failing = err != nil
+	}
+}
+
+// push sends one round of samples. UDP is fire and forget, so an error is
+// a failed name lookup or a refusal reported by the local host.
+func (p *StatsDPusher) push() error {
+	if p.conn == nil {
+		conn, err := net.Dial("udp", p.opts.Addr)
+		if err != nil {
+			return err
+		}
+		p.conn = conn
+	}
+	w := &statsdWriter{tags: p.opts.Format == statsdFormatDog, pushed: p.counters, totals: make(map[string]float64)}
+	p.metrics.write(w)
+	for _, packet := range w.packets() {
+		if _, err := p.conn.Write(packet); err != nil {
+			return fmt.Errorf("sending to %s: %w", p.opts.Addr, err)
+		}
+	}
+	// Increases of a failed push are sent with the next one.
+	maps.Copy(p.counters, w.totals)
+	slog.Debug("StatsD push sent", "lines", len(w.lines))
+	return nil
+}
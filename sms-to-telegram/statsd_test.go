@@ -0,0 +1,116 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+// TestStatsDPusher: gauges are sent as they are, counters as increases,
+// the histogram as _sum and _count; labels become name components or tags.
+func TestStatsDPusher(t *testing.T) {
+	tests := []struct {
+		format      string
+		want, again []string
+	}{
+		{statsdFormatPlain, []string{
+			"sms_to_telegram_signal_dbm:0|g",
+			"sms_to_telegram_signal_dbm:-89|g",
+			"sms_to_telegram_sim_storage_used.SM:3|g",
+			"sms_to_telegram_pdu_parse_failures_total.malformed:1|c",
+			"sms_to_telegram_at_command_duration_seconds_count.CMGL:2|c",
+			"sms_to_telegram_at_command_errors_total.CMGL.timeout:1|c",
+		}, []string{"sms_to_telegram_pdu_parse_failures_total.malformed:1|c"}},
+		{statsdFormatDog, []string{
+			"sms_to_telegram_signal_dbm:-89|g",
+			"sms_to_telegram_sim_storage_used:3|g|#storage:SM",
+			"sms_to_telegram_pdu_parse_failures_total:1|c|#kind:malformed",
+			"sms_to_telegram_at_command_duration_seconds_sum:0.5|c|#command:CMGL",
+			"sms_to_telegram_at_command_errors_total:1|c|#command:CMGL,kind:timeout",
+		}, []string{"sms_to_telegram_pdu_parse_failures_total:1|c|#kind:malformed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			t.Cleanup(swapClock(newFakeClock()))
+			server, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer server.Close()
+			read := func() []string {
+				t.Helper()
+				server.SetReadDeadline(time.Now().Add(5 * time.Second))
+				buf := make([]byte, 65536)
+				n, _, err := server.ReadFrom(buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return strings.Split(string(buf[:n]), "\n")
+			}
+
+			metrics := NewMetrics()
+			metrics.SignalSampled(12)
+			metrics.StoragesSampled([]SIMStorage{{Name: "SM", Used: 3, Total: 30}})
+			metrics.PDUParseFailed(parseFailureMalformed)
+			metrics.ATCommandDone("AT+CMGL=4", 500*time.Millisecond, nil)
+			metrics.ATCommandDone("AT+CMGL=4", 0, at.ErrModemTimeout)
+			p := NewStatsDPusher(StatsDOptions{Addr: server.LocalAddr().String(), Interval: time.Second, Format: tt.format}, metrics)
+
+			if err := p.push(); err != nil {
+				t.Fatalf("push() error = %v", err)
+			}
+			lines := read()
+			for _, want := range tt.want {
+				if !slices.Contains(lines, want) {
+					t.Errorf("push lacks %q:\n%s", want, strings.Join(lines, "\n"))
+				}
+			}
+			for _, line := range lines {
+				if strings.Contains(line, "_bucket") {
+					t.Errorf("histogram bucket pushed: %q", line)
+				}
+			}
+
+			// Unchanged counters are not sent again.
+			metrics.PDUParseFailed(parseFailureMalformed)
+			if err := p.push(); err != nil {
+				t.Fatalf("push() error = %v", err)
+			}
+			lines = read()
+			var counters []string
+			for _, line := range lines {
+				if strings.Contains(line, "|c") {
+					counters = append(counters, line)
+				}
+			}
+			if !slices.Equal(counters, tt.again) {
+				t.Errorf("second push counters = %q, want %q", counters, tt.again)
+			}
+		})
+	}
+}
+
+func TestStatsDWriter_Packets(t *testing.T) {
+	w := &statsdWriter{}
+	for range 100 {
+		w.lines = append(w.lines, strings.Repeat("x", 99))
+	}
+	packets := w.packets()
+	total := 0
+	for _, packet := range packets {
+		if len(packet) > statsdMaxPacket {
+			t.Errorf("packet of %d bytes", len(packet))
+		}
+		total += strings.Count(string(packet), "\n") + 1
+	}
+	if total != 100 || len(packets) != 8 {
+		t.Errorf("%d lines in %d packets, want 100 in 8", total, len(packets))
+	}
+}
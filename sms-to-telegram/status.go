@@ -0,0 +1,119 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StatusSources are the subsystems /status aggregates. Everything is read
+// from state the modem goroutine recorded: the command never touches the
+// serial port (invariant 8). SelfTest, Outbox and Webhooks may be nil.
+type StatusSources struct {
+	Notifier *ErrorNotifier
+	Outbox   *Outbox
+	SelfTest *SelfTest
+	Webhooks *WebhookQueue
+	Build    BuildInfo
+}
+
+// statusText renders the /status reply.
+func statusText(src StatusSources) string {
+	m := src.Notifier.metrics.snapshot()
+	now := clk.Now()
+	var sb strings.Builder
+	line := func(label, value string) {
+		sb.WriteString("\n<b>" + label + ":</b> " + value)
+	}
+
+	sb.WriteString("<b>SMS Gateway Status</b>\n")
+	line("Host", src.Notifier.hostHTML())
+	version := escapeHTML(src.Build.Version)
+	if c := src.Build.ShortCommit(); c != "" {
+		version += " (" + escapeHTML(c) + ")"
+	}
+	line("Version", version)
+	line("Uptime", formatDuration(now.Sub(m.startedAt)))
+
+	if m.modemReason == "" {
+		line("Modem", "healthy")
+	} else {
+		line("Modem", "down: "+escapeHTML(m.modemReason))
+	}
+	alerts := src.Notifier.ActiveAlerts()
+	if src.SelfTest.Failing() {
+		alerts = append(alerts, "Self-test Failing")
+	}
+	if len(alerts) == 0 {
+		line("Alerts", "none")
+	} else {
+		line("Alerts", escapeHTML(strings.Join(alerts, ", ")))
+	}
+
+	if m.operator != "" {
+		line("Operator", escapeHTML(m.operator))
+	} else {
+		line("Operator", "unknown")
+	}
+	if m.rssi >= 0 && m.rssi <= 31 {
+		line("Signal", fmt.Sprintf("%d dBm (CSQ %d)", csqToDBm(m.rssi), m.rssi))
+	} else {
+		line("Signal", "unknown")
+	}
+	if m.reception != "" {
+		line("Reception", escapeHTML(m.reception))
+	}
+	if b := m.battery; b != nil {
+		power := "external power"
+		if b.OnBattery {
+			power = "on battery"
+		}
+		if b.Millivolts > 0 {
+			power += fmt.Sprintf(", %.2f V", float64(b.Millivolts)/1000)
+		}
+		line("Battery", fmt.Sprintf("%d%% (%s)", b.Percent, power))
+	}
+	if c := m.cell; c != nil {
+		line("Cell", fmt.Sprintf("LAC %s, CI %s since %s (%d changes)",
+			escapeHTML(c.LAC), escapeHTML(c.CellID), c.Time.Format("2006-01-02 15:04:05"), m.cellChanges))
+	}
+	if m.simUsed >= 0 && m.simTotal > 0 {
+		line("SIM storage", fmt.Sprintf("%d/%d slots (%d%%)", m.simUsed, m.simTotal, m.simUsed*100/m.simTotal))
+	} else {
+		line("SIM storage", "unknown")
+	}
+
+	if m.lastSMSAt.IsZero() {
+		line("Last SMS", "none since start")
+	} else {
+		line("Last SMS", fmt.Sprintf("%s (%s ago)", m.lastSMSAt.Format("2006-01-02 15:04:05"), formatDuration(now.Sub(m.lastSMSAt))))
+	}
+	line("Queues", fmt.Sprintf("%d SMS undelivered on SIM, %d multipart parts waiting, %d outgoing",
+		m.smsWaiting, m.partsWaiting, src.Outbox.Queued()))
+	if src.Webhooks != nil {
+		queued, dead := src.Webhooks.Stats()
+		line("Webhook retries", fmt.Sprintf("%d queued, %d dead-lettered", queued, dead))
+	}
+	return sb.String()
+}
+
+// formatDuration renders a duration as "3d 4h 5m", or in seconds below a
+// minute.
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return d.Truncate(time.Second).String()
+	}
+	d = d.Truncate(time.Minute)
+	days, hours, mins := d/(24*time.Hour), d%(24*time.Hour)/time.Hour, d%time.Hour/time.Minute
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh %dm", days, hours, mins)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, mins)
+	default:
+		return fmt.Sprintf("%dm", mins)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusText(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	sender := &fakeSender{}
+	notifier := NewErrorNotifier(sender, []int64{1}, false, "gw<1>", time.Second)
+	notifier.metrics = NewMetrics()
+	src := StatusSources{
+		Notifier: notifier,
+		Build:    BuildInfo{Version: "1.2.0", Commit: "894ff69c1e2d"},
+	}
+
+	clock.Advance(30 * time.Second)
+	body := statusText(src)
+	for _, want := range []string{
+		"<b>Host:</b> <code>gw&lt;1&gt;</code>",
+		"<b>Version:</b> 1.2.0 (894ff69)",
+		"<b>Uptime:</b> 30s",
+		"<b>Modem:</b> down: starting",
+		"<b>Alerts:</b> none",
+		"<b>Operator:</b> unknown",
+		"<b>Signal:</b> unknown",
+		"<b>SIM storage:</b> unknown",
+		"<b>Last SMS:</b> none since start",
+		"<b>Queues:</b> 0 SMS undelivered on SIM, 0 multipart parts waiting, 0 outgoing",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("status before the first session lacks %q:\n%s", want, body)
+		}
+	}
+
+	// A healthy session with a filling SIM and one message stuck on it.
+	notifier.Heartbeat()
+	notifier.metrics.OperatorSampled("Vodafone.de")
+	notifier.metrics.SignalSampled(12)
+	notifier.CheckStorage(context.Background(), 25, 30)
+	notifier.metrics.QueueSampled(1, 2)
+	notifier.metrics.ReceptionSampled("push (+CMTI), polling every 5m0s")
+	notifier.metrics.BatterySampled(BatterySample{OnBattery: true, Percent: 64, Millivolts: 3912})
+	notifier.metrics.CellChanged(CellChange{Time: clock.Now(), LAC: "4E48", CellID: "1F4E"})
+	notifier.metrics.SMSReceived()
+	clock.Advance(26*time.Hour + 5*time.Minute)
+	body = statusText(src)
+	for _, want := range []string{
+		"<b>Uptime:</b> 1d 2h 5m",
+		"<b>Modem:</b> healthy",
+		"<b>Alerts:</b> SIM Storage Low",
+		"<b>Operator:</b> Vodafone.de",
+		"<b>Signal:</b> -89 dBm (CSQ 12)",
+		"<b>SIM storage:</b> 25/30 slots (83%)",
+		"<b>Reception:</b> push (+CMTI), polling every 5m0s",
+		"<b>Battery:</b> 64% (on battery, 3.91 V)",
+		"<b>Cell:</b> LAC 4E48, CI 1F4E since 2026-01-01 12:00:30 (0 changes)",
+		"(1d 2h 5m ago)",
+		"1 SMS undelivered on SIM, 2 multipart parts waiting",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("status lacks %q:\n%s", want, body)
+		}
+	}
+
+	notifier.NotifyError(context.Background(), NewDiagnosticError(ErrTypeSimNotDetected, "no SIM"))
+	body = statusText(src)
+	for _, want := range []string{
+		"<b>Modem:</b> down: SIM Not Detected",
+		"<b>Alerts:</b> SIM Not Detected, SIM Storage Low",
+		"<b>Signal:</b> unknown",
+		"<b>Operator:</b> unknown",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("status after an error lacks %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestFormatUptime(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{1500 * time.Millisecond, "1s"},
+		{59 * time.Second, "59s"},
+		{90 * time.Second, "1m"},
+		{3*time.Hour + 7*time.Minute, "3h 7m"},
+		{50 * time.Hour, "2d 2h 0m"},
+	}
+	for _, tt := range tests {
+		if got := formatDuration(tt.d); got != tt.want {
+			t.Errorf("formatDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestParseCOPS(t *testing.T) {
+	tests := []struct {
+		lines []string
+		want  string
+	}{
+		{[]string{`+COPS: 0,0,"Vodafone.de"`, "OK"}, "Vodafone.de"},
+		{[]string{`+COPS: 0,2,"26202"`}, "26202"},
+		{[]string{"+COPS: 0", "OK"}, ""},
+		{[]string{"OK"}, ""},
+	}
+	for _, tt := range tests {
+		if got := parseCOPS(tt.lines); got != tt.want {
+			t.Errorf("parseCOPS(%q) = %q, want %q", tt.lines, got, tt.want)
+		}
+	}
+}
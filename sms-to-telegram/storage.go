@@ -0,0 +1,150 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+// Message storages the gateway receives SMS in (SMS_STORAGE): the SIM card
+// and the modem's own memory.
+const (
+	storageSM = "SM"
+	storageME = "ME"
+)
+
+// otherStorage is the failover storage of name.
+func otherStorage(name string) string {
+	if name == storageME {
+		return storageSM
+	}
+	return storageME
+}
+
+// smsStorage picks the storage of every modem session: SMS_STORAGE first,
+// the other one when it cannot be selected (modem ERROR, capacity 0) or its
+// listing is refused. The storage that worked is tried first by the next
+// session too, so a broken one is not retried on every reopen. Like the
+// eSIM switch and SIM rotation, a failover waits for the delivery queue to
+// be idle: the PartIndices of a queued or put-back SMS are slots in the
+// storage it was listed from. Created in run(); used by the modem goroutine
+// only.
+type smsStorage struct {
+	preferred string
+	next      string
+	queue     *deliveryQueue
+}
+
+func newSMSStorage(preferred string, queue *deliveryQueue) *smsStorage {
+	return &smsStorage{preferred: preferred, next: preferred, queue: queue}
+}
+
+// order is the storages to try, best first; only the current one while
+// SMS from it are unsettled.
+func (s *smsStorage) order() []string {
+	if !s.queue.idle() {
+		return []string{s.next}
+	}
+	return []string{s.next, otherStorage(s.next)}
+}
+
+// selected records the storage a session got.
+func (s *smsStorage) selected(name string) {
+	s.next = name
+}
+
+// failed records that name refused the listing: the next session starts
+// with the other storage.
+func (s *smsStorage) failed(name string) {
+	if name == s.next && !s.queue.idle() {
+		slog.Warn("SMS storage refused the listing - failover waits for the SMS being delivered",
+			"storage", name)
+		return
+	}
+	if name == s.next {
+		slog.Warn("SMS storage refused the listing - next session tries the other one",
+			"storage", name, "next", otherStorage(name))
+		s.next = otherStorage(name)
+	}
+}
+
+// selectStorage selects the first usable storage of candidates for reading,
+// writing and receiving (mem1-3). initFailure turns a modem ERROR into the
+// session error; it is only used when no candidate works.
+func selectStorage(modem ATCommander, candidates []string, initFailure func(cmd string, err error) error) (SIMStorage, error) {
+	var firstCmd string
+	var firstErr error
+	for _, name := range candidates {
+		cmd := fmt.Sprintf(`AT+CPMS="%s","%s","%s"`, name, name, name)
+		resp, err := modem.Command(cmd)
+		if at.IsTimeoutError(err) {
+			return SIMStorage{}, NewSessionError(err)
+		}
+		if err == nil {
+			// Unknown counts (-1) are fine; a capacity of 0 is a SIM that
+			// cannot take SMS.
+			used, total := parseCPMSCounts(resp)
+			if total != 0 {
+				return SIMStorage{Name: name, Used: used, Total: total}, nil
+			}
+			err = fmt.Errorf("capacity %d", total)
+		}
+		slog.Warn("SMS storage unusable", "storage", name, "error", err)
+		if firstErr == nil {
+			firstCmd, firstErr = cmd, err
+		}
+	}
+	if at.IsModemError(firstErr) {
+		return SIMStorage{}, initFailure(firstCmd, firstErr)
+	}
+	return SIMStorage{}, NewDiagnosticError(ErrTypeModemInitFailed,
+		"No usable SMS storage (%s: %v)", candidates[0], firstErr)
+}
+
+// StorageSelected alerts when a session receives SMS in another storage
+// than SMS_STORAGE, and once more when it is back on it. Like CheckStorage
+// it is a warning outside the error-type state machine.
+func (n *ErrorNotifier) StorageSelected(ctx context.Context, preferred, active string) {
+	n.mu.Lock()
+	previous := n.storageFailover
+	switch {
+	case active != preferred && previous != active:
+		n.storageFailover = active
+	case active == preferred && previous != "":
+		n.storageFailover = ""
+	default:
+		n.mu.Unlock()
+		return
+	}
+	n.mu.Unlock()
+
+	if active != preferred {
+		slog.Warn("Receiving SMS in failover storage", "preferred", preferred, "storage", active)
+		msg := fmt.Sprintf("<b>SMS Gateway Alert</b>\n\n"+
+			"<b>Host:</b> %s\n"+
+			"<b>Warning:</b> SMS storage %s is unusable, receiving SMS in %s instead\n\n"+
+			"<i>Check the SIM (some report no SMS capacity) and restart the gateway to use %s again.</i>",
+			n.hostHTML(), preferred, active, preferred)
+		if err := n.sendToTelegram(ctx, msg); err != nil {
+			slog.Error("Failed to send storage failover alert", "error", err)
+			// Re-arm so the alert is retried by the next session.
+			n.mu.Lock()
+			n.storageFailover = previous
+			n.mu.Unlock()
+		}
+		return
+	}
+	slog.Info("Receiving SMS in preferred storage again", "storage", active)
+	msg := fmt.Sprintf("<b>SMS Gateway Recovered</b>\n\n"+
+		"<b>Host:</b> %s\n"+
+		"<b>Status:</b> Receiving SMS in storage %s again",
+		n.hostHTML(), active)
+	if err := n.sendToTelegram(ctx, msg); err != nil {
+		slog.Error("Failed to send storage recovery notification", "error", err)
+	}
+}
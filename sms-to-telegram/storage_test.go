@@ -0,0 +1,156 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kogeler/tooling/sms-to-telegram/pkg/at"
+)
+
+const (
+	cpmsSM = `AT+CPMS="SM","SM","SM"`
+	cpmsME = `AT+CPMS="ME","ME","ME"`
+)
+
+func TestInitModemSession_StorageFailover(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(modem *fakeAT)
+		want     SIMStorage
+		wantType DiagnosticErrorType // ErrTypeNone: no diagnostic error
+		wantSess bool
+	}{
+		{"preferred works", func(modem *fakeAT) {
+			modem.on(cpmsSM, []string{"+CPMS: 3,30,3,30,3,30"}, nil)
+		}, SIMStorage{Name: storageSM, Used: 3, Total: 30}, ErrTypeNone, false},
+		{"preferred refused", func(modem *fakeAT) {
+			modem.on(cpmsSM, nil, at.ErrModemError)
+			modem.on(cpmsME, []string{"+CPMS: 0,100,0,100,0,100"}, nil)
+		}, SIMStorage{Name: storageME, Used: 0, Total: 100}, ErrTypeNone, false},
+		{"preferred without capacity", func(modem *fakeAT) {
+			modem.on(cpmsSM, []string{"+CPMS: 0,0,0,0,0,0"}, nil)
+			modem.on(cpmsME, []string{"+CPMS: 1,100,1,100,1,100"}, nil)
+		}, SIMStorage{Name: storageME, Used: 1, Total: 100}, ErrTypeNone, false},
+		{"both refused, SIM out", func(modem *fakeAT) {
+			modem.on(cpmsSM, nil, at.ErrModemError)
+			modem.on(cpmsME, nil, at.ErrModemError)
+			modem.on("AT+CPIN?", nil, at.ErrModemError)
+		}, SIMStorage{}, ErrTypeSimNotDetected, false},
+		{"no capacity anywhere", func(modem *fakeAT) {
+			modem.on(cpmsSM, []string{"+CPMS: 0,0,0,0,0,0"}, nil)
+			modem.on(cpmsME, []string{"+CPMS: 0,0,0,0,0,0"}, nil)
+		}, SIMStorage{}, ErrTypeModemInitFailed, false},
+		{"timeout", func(modem *fakeAT) {
+			modem.on(cpmsSM, nil, at.ErrModemTimeout)
+		}, SIMStorage{}, ErrTypeNone, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modem := newFakeAT()
+			modem.on("AT+CMGF?", []string{"+CMGF: 0"}, nil)
+			tt.setup(modem)
+
+			got, err := initModemSession(modem, []string{storageSM, storageME}, "", false)
+			var diagErr *DiagnosticError
+			var sessErr *SessionError
+			switch {
+			case tt.wantSess:
+				if !errors.As(err, &sessErr) {
+					t.Fatalf("error = %v, want SessionError", err)
+				}
+			case tt.wantType != ErrTypeNone:
+				if !errors.As(err, &diagErr) || diagErr.Type != tt.wantType {
+					t.Fatalf("error = %v, want %s", err, errorTypeName(tt.wantType))
+				}
+			case err != nil:
+				t.Fatalf("initModemSession() error = %v", err)
+			}
+			if got.SIMStorage != tt.want {
+				t.Errorf("storage = %+v, want %+v", got.SIMStorage, tt.want)
+			}
+		})
+	}
+}
+
+func TestSMSStorage(t *testing.T) {
+	s := newSMSStorage(storageSM, nil)
+	if got := s.order(); !slices.Equal(got, []string{"SM", "ME"}) {
+		t.Fatalf("order() = %q", got)
+	}
+	// A session fell back to ME: the next one starts there.
+	s.selected(storageME)
+	if got := s.order(); !slices.Equal(got, []string{"ME", "SM"}) {
+		t.Errorf("order() after failover = %q", got)
+	}
+	// ME refused its listing: back to SM first.
+	s.failed(storageME)
+	if got := s.order(); !slices.Equal(got, []string{"SM", "ME"}) {
+		t.Errorf("order() after a refused listing = %q", got)
+	}
+	s.failed(storageME) // not the one tried first any more
+	if got := s.order(); got[0] != storageSM {
+		t.Errorf("order() = %q, want SM first", got)
+	}
+}
+
+// TestSMSStorage_NoFailoverInFlight: while an SMS listed from SM is being
+// delivered, its slots must not be deleted in ME.
+func TestSMSStorage_NoFailoverInFlight(t *testing.T) {
+	queue := newDeliveryQueue(0)
+	pending := PendingSMS{Message: SMSMessage{Index: 4, From: "+1", Text: "x"}, PartIndices: []int{4}}
+	queue.submit(pending)
+	s := newSMSStorage(storageSM, queue)
+
+	s.failed(storageSM)
+	if got := s.order(); !slices.Equal(got, []string{"SM"}) {
+		t.Fatalf("order() with an SMS in flight = %q, want SM only", got)
+	}
+	// SM cannot be selected: the session fails instead of moving to ME.
+	modem := newFakeAT()
+	modem.on("AT+CMGF?", []string{"+CMGF: 0"}, nil)
+	modem.on(cpmsSM, nil, at.ErrModemError)
+	modem.on(cpmsME, []string{"+CPMS: 0,100,0,100,0,100"}, nil)
+	modem.on("AT+CPIN?", []string{"+CPIN: READY"}, nil)
+	if session, err := initModemSession(modem, s.order(), "", false); err == nil || session.Name == storageME {
+		t.Fatalf("initModemSession() = %+v, %v; want an error without ME", session.SIMStorage, err)
+	}
+
+	queue.settled(pending)
+	s.failed(storageSM)
+	if got := s.order(); !slices.Equal(got, []string{"ME", "SM"}) {
+		t.Errorf("order() once settled = %q, want the failover", got)
+	}
+}
+
+func TestStorageSelected(t *testing.T) {
+	sender := &fakeSender{}
+	notifier := NewErrorNotifier(sender, []int64{1}, false, "gw1", time.Second)
+	ctx := context.Background()
+
+	notifier.StorageSelected(ctx, storageSM, storageSM)
+	if len(sender.sent) != 0 {
+		t.Fatalf("alerted on the preferred storage: %+v", sender.sent)
+	}
+	notifier.StorageSelected(ctx, storageSM, storageME)
+	notifier.StorageSelected(ctx, storageSM, storageME) // next session, same state
+	if len(sender.sent) != 1 || !strings.Contains(sender.sent[0].Text, "SMS storage SM is unusable, receiving SMS in ME instead") {
+		t.Fatalf("alerts = %+v, want one failover alert", sender.sent)
+	}
+	if got := notifier.ActiveAlerts(); !slices.Contains(got, "Storage Failover") {
+		t.Errorf("ActiveAlerts() = %q", got)
+	}
+	notifier.StorageSelected(ctx, storageSM, storageSM)
+	if len(sender.sent) != 2 || !strings.Contains(sender.sent[1].Text, "Receiving SMS in storage SM again") {
+		t.Errorf("alerts = %+v, want a recovery", sender.sent)
+	}
+	if got := notifier.ActiveAlerts(); slices.Contains(got, "Storage Failover") {
+		t.Errorf("ActiveAlerts() after recovery = %q", got)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AT+CMGS helpers for outgoing SMS; the PDUs themselves are encoded by
+// pkg/pdu.
+
+// parseCMGSReference extracts the message reference from "+CMGS: <mr>".
+func parseCMGSReference(lines []string) (int, bool) {
+	for _, line := range lines {
+		if rest, ok := strings.CutPrefix(line, "+CMGS:"); ok {
+			var mr int
+			if _, err := fmt.Sscanf(strings.TrimSpace(rest), "%d", &mr); err == nil {
+				return mr, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// validDestination accepts an optional "+" followed by 3-20 digits.
+func validDestination(to string) bool {
+	digits := strings.TrimPrefix(to, "+")
+	if len(digits) < 3 || len(digits) > 20 {
+		return false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
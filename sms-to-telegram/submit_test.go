@@ -0,0 +1,31 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import "testing"
+
+func TestParseCMGSReference(t *testing.T) {
+	if mr, ok := parseCMGSReference([]string{"", "+CMGS: 17"}); !ok || mr != 17 {
+		t.Errorf("parseCMGSReference() = %d, %v; want 17, true", mr, ok)
+	}
+	if _, ok := parseCMGSReference([]string{"OK"}); ok {
+		t.Error("no +CMGS line should report no reference")
+	}
+}
+
+func TestValidDestination(t *testing.T) {
+	for to, want := range map[string]bool{
+		"+4915550001234": true,
+		"015550001234":   true,
+		"112":            true,
+		"+12":            false,
+		"+49 1555":       false,
+		"VODAFONE":       false,
+		"":               false,
+	} {
+		if got := validDestination(to); got != want {
+			t.Errorf("validDestination(%q) = %v, want %v", to, got, want)
+		}
+	}
+}
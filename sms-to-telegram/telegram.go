@@ -4,6 +4,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -69,154 +70,238 @@ func classifySendError(err error) (sendClass, time.Duration) {
 	return sendTransient, 0
 }
 
-// deliveryStatus is the outcome of delivering one PendingSMS.
-type deliveryStatus int
-
-const (
-	// deliveryDone: every chunk reached every configured chat — the SIM
-	// slots may be deleted.
-	deliveryDone deliveryStatus = iota
-	// deliveryRejected: Telegram permanently rejected the content; the SMS
-	// stays on the SIM, an operator alert was emitted once, and the message
-	// is skipped (not re-sent) until process restart. Later SMS proceed.
-	deliveryRejected
-	// deliveryDeferred: transient failure, rate limit or destination
-	// misconfiguration — retain everything and let the next poll retry.
-	deliveryDeferred
-)
-
-// Deliverer sends assembled SMS to all chats with per-chat 429 cooldowns,
-// bounded transient retries, a plain-text fallback for content-rejected HTML,
-// and a once-per-message operator alert for permanent rejections.
-// It persists across modem session reopens (created once in run()).
-type Deliverer struct {
+// TelegramSink delivers SMS to the routed Telegram chats with per-chat 429
+// cooldowns, bounded transient retries, a plain-text fallback for
+// content-rejected HTML and once-per-chat destination alerts. It is always
+// the first sink of the Deliverer and persists across modem session reopens.
+type TelegramSink struct {
 	sender   TelegramSender
 	notifier *ErrorNotifier
 	cfg      *Config
+	// docs uploads the PDUs of undecodable SMS as a file; nil inlines them
+	// as hex.
+	docs DocumentSender
 
 	cooldownUntil map[int64]time.Time
-	// rejected remembers permanently rejected messages (by content
-	// fingerprint) so they are not re-sent to already-delivered chats on
-	// every poll; the SIM slot stays until removed manually.
-	rejected map[string]struct{}
 	// destIssue tracks per-chat destination failures (kicked bot, deleted
 	// chat) with stateless dedup, deliberately OUTSIDE the modem-recovery
 	// state machine: a modem session restart must not announce a false
 	// "Recovered" while a Telegram destination is still broken.
 	destIssue map[int64]bool
+	// priority holds normalized PRIORITY_SENDERS (see normalizeSender).
+	priority map[string]struct{}
+	// lastChatIDs are the routed chats of the last successful Send, and
+	// lastMessages the messages it created, for the audit log and archive.
+	lastChatIDs  []int64
+	lastMessages []TelegramMessageRef
 }
 
-func NewDeliverer(sender TelegramSender, notifier *ErrorNotifier, cfg *Config) *Deliverer {
-	return &Deliverer{
+// TelegramMessageRef identifies one Telegram message created for an SMS; a
+// long SMS takes several per chat.
+type TelegramMessageRef struct {
+	ChatID    int64 `json:"chat_id"`
+	MessageID int   `json:"message_id"`
+}
+
+func NewTelegramSink(sender TelegramSender, notifier *ErrorNotifier, cfg *Config) *TelegramSink {
+	t := &TelegramSink{
 		sender:        sender,
 		notifier:      notifier,
 		cfg:           cfg,
 		cooldownUntil: make(map[int64]time.Time),
-		rejected:      make(map[string]struct{}),
 		destIssue:     make(map[int64]bool),
 	}
+	t.setPrioritySenders(cfg.PrioritySenders)
+	return t
 }
 
-// transientRetryDelays: short in-place retries for transient errors. The SIM
-// is the durable queue, so long in-loop backoff would only stall polling —
-// the next poll cycle is the real retry.
-var transientRetryDelays = []time.Duration{5 * time.Second, 10 * time.Second}
+func (t *TelegramSink) setPrioritySenders(senders []string) {
+	t.priority = make(map[string]struct{}, len(senders))
+	for _, s := range senders {
+		t.priority[normalizeSender(s)] = struct{}{}
+	}
+}
 
-// Deliver forwards one pending SMS to every configured chat.
-func (d *Deliverer) Deliver(ctx context.Context, pending PendingSMS) deliveryStatus {
-	chunks := buildTelegramMessages(pending)
-	// The SIM indices are part of the identity: two identical SMS in
-	// different slots are distinct deliveries.
-	key := contentFingerprint(fmt.Sprint(pending.PartIndices) + "\x00" + strings.Join(chunks, "\x00"))
+// isPriority reports whether sender is a PRIORITY_SENDERS entry. Priority
+// SMS always alert with sound, overriding quiet hours.
+func (t *TelegramSink) isPriority(sender string) bool {
+	_, ok := t.priority[normalizeSender(sender)]
+	return ok && sender != ""
+}
 
-	if _, isRejected := d.rejected[key]; isRejected {
-		slog.Debug("Skipping previously rejected message", "index", pending.Message.Index)
-		return deliveryRejected
+// silentDelivery reports whether pending is delivered without a
+// notification sound: inside QUIET_HOURS, unless the sender is priority.
+func (t *TelegramSink) silentDelivery(pending PendingSMS) bool {
+	if !t.cfg.QuietHours.Contains(clk.Now()) {
+		return false
+	}
+	if t.isPriority(pending.Message.From) {
+		slog.Info("Priority sender during quiet hours, delivering with sound",
+			"trace", pending.TraceID, "from", pending.Message.From, "indices", pending.PartIndices)
+		return false
 	}
+	return true
+}
 
-	if d.cfg.DryRun {
+func (t *TelegramSink) Name() string { return "telegram" }
+
+// Send forwards one pending SMS to every routed chat. All chats must be
+// reached for success, and a partial delivery is retried as a whole; with
+// DELETE_POLICY=any one chat is enough and the others are given up on.
+func (t *TelegramSink) Send(ctx context.Context, pending PendingSMS) error {
+	chunks := buildTelegramMessages(truncateForChat(pending, t.cfg))
+	var upload *telegramUpload
+	if pending.RawFallback && t.docs != nil {
+		// The PDUs go as a file (quarantine.go): hex in a chat helps nobody.
+		chunks = []string{formatRawFallbackCaption(pending.Message, pending.RawReason, pending.Instance)}
+		upload = &telegramUpload{name: quarantineFileName(pending), data: quarantineFile(pending)}
+	}
+	silent := t.silentDelivery(pending)
+	chatIDs := pending.ChatIDs
+	if chatIDs == nil {
+		chatIDs = routeChats(t.cfg.RoutingRules, t.cfg.ChatIDs, clk.Now())
+	}
+
+	if t.cfg.DryRun {
 		for i, chunk := range chunks {
-			slog.Info("DRY_RUN: Would send to Telegram",
-				"chat_ids", d.cfg.ChatIDs,
+			slog.InfoContext(ctx, "DRY_RUN: Would send to Telegram",
+				"chat_ids", chatIDs,
 				"chunk", fmt.Sprintf("%d/%d", i+1, len(chunks)),
+				"silent", silent,
 				"text_length", len(chunk),
 				"text_fingerprint", contentFingerprint(chunk),
 			)
-			slog.Debug("DRY_RUN message content", "text", chunk)
+			slog.DebugContext(ctx, "DRY_RUN message content", "text", chunk)
 		}
-		return deliveryDone
+		t.lastChatIDs = chatIDs
+		t.lastMessages = nil
+		return nil
 	}
 
-	if d.sender == nil {
-		slog.Error("Telegram sender not initialized")
-		return deliveryDeferred
+	if t.sender == nil {
+		return errors.New("telegram sender not initialized")
 	}
 
 	// All chats must be available before the first chunk goes out: partially
 	// delivering and retrying later multiplies duplicates.
+	anyChat := t.cfg.DeletePolicy == deletePolicyAny
 	now := clk.Now()
-	for _, chatID := range d.cfg.ChatIDs {
-		if until, ok := d.cooldownUntil[chatID]; ok && now.Before(until) {
-			slog.Info("Chat in rate-limit cooldown, deferring delivery",
-				"chat_id", chatID, "until", until)
-			return deliveryDeferred
+	for _, chatID := range chatIDs {
+		if until, ok := t.cooldownUntil[chatID]; ok && now.Before(until) && !anyChat {
+			return fmt.Errorf("chat %d in rate-limit cooldown until %s", chatID, until.Format(time.RFC3339))
 		}
 	}
 
-	for _, chatID := range d.cfg.ChatIDs {
-		for i, chunk := range chunks {
-			status := d.sendChunk(ctx, chatID, chunk)
-			if status == deliveryRejected {
-				d.rejected[key] = struct{}{}
-				d.alertRejected(ctx, pending)
-				return deliveryRejected
-			}
-			if status != deliveryDone {
-				return status
-			}
-			slog.Debug("Chunk delivered", "chat_id", chatID, "chunk", i+1, "total", len(chunks))
+	var messages []TelegramMessageRef
+	var reached []int64
+	var firstErr error
+	for _, chatID := range chatIDs {
+		sent, err := t.sendToChat(ctx, chatID, chunks, silent, upload)
+		messages = append(messages, sent...)
+		if err == nil {
+			reached = append(reached, chatID)
+			continue
+		}
+		if !anyChat {
+			return err
+		}
+		slog.WarnContext(ctx, "Telegram chat missed the SMS", "chat_id", chatID, "error", err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if len(reached) == 0 && firstErr != nil {
+		return firstErr
+	}
+	t.lastChatIDs = reached
+	t.lastMessages = messages
+	return nil
+}
+
+// sendToChat sends every chunk to one chat and returns the messages sent.
+func (t *TelegramSink) sendToChat(ctx context.Context, chatID int64, chunks []string, silent bool, upload *telegramUpload) ([]TelegramMessageRef, error) {
+	if until, ok := t.cooldownUntil[chatID]; ok && clk.Now().Before(until) {
+		return nil, fmt.Errorf("chat %d in rate-limit cooldown until %s", chatID, until.Format(time.RFC3339))
+	}
+	var messages []TelegramMessageRef
+	for i, chunk := range chunks {
+		status, messageID := t.sendChunk(ctx, chatID, chunk, silent, upload)
+		switch status {
+		case deliveryDone:
+			messages = append(messages, TelegramMessageRef{ChatID: chatID, MessageID: messageID})
+		case deliveryRejected:
+			return messages, fmt.Errorf("%w: chat %d refused the content", errSinkRejected, chatID)
+		default:
+			return messages, fmt.Errorf("delivery to chat %d deferred", chatID)
 		}
+		slog.DebugContext(ctx, "Chunk delivered", "chat_id", chatID, "chunk", i+1, "total", len(chunks))
 	}
+	return messages, nil
+}
 
-	return deliveryDone
+// telegramUpload is a file sent with a message, which becomes its caption.
+type telegramUpload struct {
+	name string
+	data []byte
 }
 
-// sendChunk sends one message to one chat, applying the retry policy.
-func (d *Deliverer) sendChunk(ctx context.Context, chatID int64, text string) deliveryStatus {
+// sendChunk sends one message to one chat, applying the retry policy, and
+// returns the ID of the message on success. A silent chunk is delivered
+// without a notification sound; with an upload, text is the caption of the
+// document.
+func (t *TelegramSink) sendChunk(ctx context.Context, chatID int64, text string, silent bool, upload *telegramUpload) (deliveryStatus, int) {
 	plainFallbackTried := false
 	parseMode := models.ParseModeHTML
 	payload := text
 
 	for attempt := 0; ; attempt++ {
 		if ctx.Err() != nil {
-			return deliveryDeferred
+			return deliveryDeferred, 0
 		}
 
-		sendCtx, cancel := context.WithTimeout(ctx, d.cfg.TelegramSendTimeout)
-		_, err := d.sender.SendMessage(sendCtx, &bot.SendMessageParams{
-			ChatID:    chatID,
-			Text:      payload,
-			ParseMode: parseMode,
-		})
+		sendCtx, cancel := context.WithTimeout(ctx, t.cfg.TelegramSendTimeout)
+		var (
+			sent *models.Message
+			err  error
+		)
+		if upload != nil {
+			sent, err = t.docs.SendDocument(sendCtx, &bot.SendDocumentParams{
+				ChatID:              chatID,
+				Document:            &models.InputFileUpload{Filename: upload.name, Data: bytes.NewReader(upload.data)},
+				Caption:             payload,
+				ParseMode:           parseMode,
+				DisableNotification: silent,
+			})
+		} else {
+			sent, err = t.sender.SendMessage(sendCtx, &bot.SendMessageParams{
+				ChatID:              chatID,
+				Text:                payload,
+				ParseMode:           parseMode,
+				DisableNotification: silent,
+			})
+		}
 		cancel()
 
 		class, retryAfter := classifySendError(err)
 		switch class {
 		case sendOK:
-			d.clearDestinationFailure(ctx, chatID)
-			return deliveryDone
+			t.clearDestinationFailure(ctx, chatID)
+			if sent == nil {
+				return deliveryDone, 0
+			}
+			return deliveryDone, sent.ID
 
 		case sendRateLimited:
-			d.cooldownUntil[chatID] = clk.Now().Add(retryAfter)
-			slog.Warn("Telegram rate limit, cooling chat down",
+			t.cooldownUntil[chatID] = clk.Now().Add(retryAfter)
+			slog.WarnContext(ctx, "Telegram rate limit, cooling chat down",
 				"chat_id", chatID, "retry_after", retryAfter)
-			return deliveryDeferred
+			return deliveryDeferred, 0
 
 		case sendDestinationFailed:
-			slog.Error("Telegram destination/configuration error",
+			slog.ErrorContext(ctx, "Telegram destination/configuration error",
 				"chat_id", chatID, "error", err)
-			d.alertDestinationFailure(ctx, chatID, err)
-			return deliveryDeferred
+			t.alertDestinationFailure(ctx, chatID, err)
+			return deliveryDeferred, 0
 
 		case sendContentRejected:
 			if !plainFallbackTried {
@@ -225,26 +310,29 @@ func (d *Deliverer) sendChunk(ctx context.Context, chatID int64, text string) de
 				plainFallbackTried = true
 				parseMode = ""
 				payload = htmlToPlain(text)
-				slog.Warn("Telegram rejected HTML content, retrying as plain text",
+				slog.WarnContext(ctx, "Telegram rejected HTML content, retrying as plain text",
 					"chat_id", chatID, "error", err)
 				continue
 			}
-			slog.Error("Telegram permanently rejected message content",
+			slog.ErrorContext(ctx, "Telegram permanently rejected message content",
 				"chat_id", chatID, "error", err)
-			return deliveryRejected
+			return deliveryRejected, 0
 
 		case sendTransient:
-			if attempt >= len(transientRetryDelays) {
-				slog.Warn("Transient Telegram failure, deferring to next poll",
+			// Short in-place retries only (TELEGRAM_RETRIES): the SIM is the
+			// durable queue, so long in-loop backoff would only stall
+			// polling — the next poll cycle is the real retry.
+			if attempt >= t.cfg.TelegramRetries {
+				slog.WarnContext(ctx, "Transient Telegram failure, deferring to next poll",
 					"chat_id", chatID, "attempts", attempt+1, "error", err)
-				return deliveryDeferred
+				return deliveryDeferred, 0
 			}
-			delay := transientRetryDelays[attempt]
-			slog.Warn("Transient Telegram failure, retrying",
+			delay := t.cfg.TelegramRetryDelay << attempt
+			slog.WarnContext(ctx, "Transient Telegram failure, retrying",
 				"chat_id", chatID, "attempt", attempt+1, "retry_in", delay, "error", err)
 			select {
 			case <-ctx.Done():
-				return deliveryDeferred
+				return deliveryDeferred, 0
 			case <-clk.After(delay):
 			}
 		}
@@ -254,51 +342,35 @@ func (d *Deliverer) sendChunk(ctx context.Context, chatID int64, text string) de
 // alertDestinationFailure broadcasts a once-per-chat alert about a broken
 // destination (kicked bot, deleted chat, bad token). Stateless with its own
 // dedup — see the destIssue field comment.
-func (d *Deliverer) alertDestinationFailure(ctx context.Context, chatID int64, sendErr error) {
-	if d.destIssue[chatID] {
+func (t *TelegramSink) alertDestinationFailure(ctx context.Context, chatID int64, sendErr error) {
+	if t.destIssue[chatID] {
 		return
 	}
-	d.destIssue[chatID] = true
+	t.destIssue[chatID] = true
 
 	msg := fmt.Sprintf("<b>SMS Gateway Alert</b>\n\n"+
 		"<b>Error:</b> Telegram rejects deliveries to chat <code>%d</code>\n"+
 		"<b>Details:</b> %s\n\n"+
 		"<i>Check that the bot is still a member of that chat and the token is valid. SMS are retained on the SIM until delivery succeeds.</i>",
 		chatID, escapeHTML(sendErr.Error()))
-	if err := d.notifier.sendToTelegram(ctx, msg); err != nil {
-		slog.Error("Failed to send destination-failure alert", "error", err)
-		d.destIssue[chatID] = false // re-arm so the alert is retried
+	if err := t.notifier.sendToTelegram(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "Failed to send destination-failure alert", "error", err)
+		t.destIssue[chatID] = false // re-arm so the alert is retried
 	}
 }
 
 // clearDestinationFailure sends a one-time notice when a previously failing
 // destination accepts messages again.
-func (d *Deliverer) clearDestinationFailure(ctx context.Context, chatID int64) {
-	if !d.destIssue[chatID] {
+func (t *TelegramSink) clearDestinationFailure(ctx context.Context, chatID int64) {
+	if !t.destIssue[chatID] {
 		return
 	}
-	d.destIssue[chatID] = false
+	t.destIssue[chatID] = false
 
 	msg := fmt.Sprintf("<b>SMS Gateway Recovered</b>\n\n"+
 		"<b>Status:</b> Deliveries to chat <code>%d</code> work again", chatID)
-	if err := d.notifier.sendToTelegram(ctx, msg); err != nil {
-		slog.Error("Failed to send destination-recovery notice", "error", err)
-	}
-}
-
-// alertRejected notifies the operator (once per message — the caller dedups
-// via the rejected set) that an SMS is stuck on the SIM.
-func (d *Deliverer) alertRejected(ctx context.Context, pending PendingSMS) {
-	msg := fmt.Sprintf("<b>SMS Gateway Alert</b>\n\n"+
-		"<b>Error:</b> Telegram permanently rejected a forwarded SMS\n"+
-		"<b>From:</b> <code>%s</code>\n"+
-		"<b>SIM slot(s):</b> %s\n\n"+
-		"<i>The SMS is kept on the SIM and will occupy its slot until removed manually (e.g. AT+CMGD).</i>",
-		escapeHTML(pending.Message.From),
-		escapeHTML(fmt.Sprint(pending.PartIndices)))
-
-	if err := d.notifier.sendToTelegram(ctx, msg); err != nil {
-		slog.Error("Failed to send rejected-message alert", "error", err)
+	if err := t.notifier.sendToTelegram(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "Failed to send destination-recovery notice", "error", err)
 	}
 }
 
@@ -318,20 +390,21 @@ func htmlToPlain(s string) string {
 // HTML messages, each safely below Telegram's visible-length limit.
 func buildTelegramMessages(pending PendingSMS) []string {
 	if pending.RawFallback {
-		return []string{formatRawFallbackMessage(pending.Message, pending.RawReason)}
+		return []string{formatRawFallbackMessage(pending.Message, pending.RawReason, pending.Instance)}
 	}
 
 	msg := pending.Message
-	header := formatMessageHeader(msg)
+	header := formatMessageHeader(msg) + formatTags(pending.Tags) + formatInstanceLine(pending.Instance)
 	headerVisible := len([]rune(htmlToPlain(header)))
 	budget := telegramMaxVisible - chunkSafetyMargin - headerVisible
 	if budget < 256 {
 		budget = 256
 	}
 
-	body := []rune(msg.Text)
+	text := displayText(pending)
+	body := []rune(text)
 	if len(body) <= budget {
-		return []string{header + "\n" + escapeHTML(msg.Text)}
+		return []string{header + "\n" + escapeHTML(text)}
 	}
 
 	total := (len(body) + budget - 1) / budget
@@ -349,11 +422,44 @@ func buildTelegramMessages(pending PendingSMS) []string {
 	return messages
 }
 
+// truncateForChat cuts the text, transliteration and translation of an SMS
+// to TELEGRAM_MAX_TEXT_LENGTH characters each, so multi-kilobyte
+// concatenated spam does not flood the chats. Only the Telegram copy is
+// cut: the archive and the other sinks keep the full text.
+func truncateForChat(pending PendingSMS, cfg *Config) PendingSMS {
+	if cfg.TelegramMaxText <= 0 || pending.RawFallback {
+		return pending
+	}
+	archived := cfg.Archive && !cfg.DryRun
+	pending.Message.Text = truncateText(pending.Message.Text, cfg.TelegramMaxText, archived)
+	pending.Transliteration = truncateText(pending.Transliteration, cfg.TelegramMaxText, archived)
+	if tr := pending.Translation; tr != nil {
+		cut := *tr
+		cut.Text = truncateText(tr.Text, cfg.TelegramMaxText, archived)
+		pending.Translation = &cut
+	}
+	return pending
+}
+
+// truncateText shortens s to max characters and says how many were left
+// out and, when archived, where to find them.
+func truncateText(s string, max int, archived bool) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	where := ""
+	if archived {
+		where = ", full text in archive"
+	}
+	return fmt.Sprintf("%s… (truncated, %d more chars%s)", string(runes[:max]), len(runes)-max, where)
+}
+
 // formatMessageHeader renders the metadata block shared by all chunks.
 func formatMessageHeader(msg SMSMessage) string {
 	var sb strings.Builder
 	sb.WriteString("<b>SMS Received</b>\n\n")
-	sb.WriteString(fmt.Sprintf("<b>From:</b> <code>%s</code>\n", escapeHTML(msg.From)))
+	sb.WriteString(formatFrom(msg.From))
 	sb.WriteString(fmt.Sprintf("<b>Time:</b> %s\n", formatMessageTime(msg.Time)))
 	if msg.SMSC != "" {
 		sb.WriteString(fmt.Sprintf("<b>SMSC:</b> %s\n", escapeHTML(msg.SMSC)))
@@ -364,6 +470,24 @@ func formatMessageHeader(msg SMSMessage) string {
 	return sb.String()
 }
 
+// formatFrom renders the From line, with the flag of the sender's country
+// for international numbers.
+func formatFrom(from string) string {
+	if flag := senderFlag(from); flag != "" {
+		return fmt.Sprintf("<b>From:</b> %s <code>%s</code>\n", flag, escapeHTML(from))
+	}
+	return fmt.Sprintf("<b>From:</b> <code>%s</code>\n", escapeHTML(from))
+}
+
+// formatTags renders RULES_FILE tags as hashtags, so Telegram's search
+// finds them.
+func formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return "<b>Tags:</b> #" + escapeHTML(strings.Join(tags, " #")) + "\n"
+}
+
 // formatMessageTime renders the SMS timestamp; a zero time means the PDU
 // carried an invalid SCTS.
 func formatMessageTime(t time.Time) string {
@@ -373,18 +497,36 @@ func formatMessageTime(t time.Time) string {
 	return t.Format("2006-01-02 15:04:05")
 }
 
+// formatRawFallbackCaption renders the caption of an undecodable SMS sent
+// with its PDUs attached.
+func formatRawFallbackCaption(msg SMSMessage, reason string, instance *Instance) string {
+	var sb strings.Builder
+	sb.WriteString("<b>SMS Received (undecodable)</b>\n\n")
+	if msg.From != "" {
+		sb.WriteString(formatFrom(msg.From))
+	}
+	if !msg.Time.IsZero() {
+		sb.WriteString(fmt.Sprintf("<b>Time:</b> %s\n", formatMessageTime(msg.Time)))
+	}
+	sb.WriteString(fmt.Sprintf("<b>Problem:</b> %s\n", escapeHTML(truncateRunes(reason, 300))))
+	sb.WriteString(formatInstanceLine(instance))
+	sb.WriteString("\n<i>The raw PDU is attached.</i>")
+	return sb.String()
+}
+
 // formatRawFallbackMessage renders an undecodable-but-framed PDU so its
 // content is preserved for the operator before the slot is freed.
-func formatRawFallbackMessage(msg SMSMessage, reason string) string {
+func formatRawFallbackMessage(msg SMSMessage, reason string, instance *Instance) string {
 	var sb strings.Builder
 	sb.WriteString("<b>SMS Received (undecodable)</b>\n\n")
 	if msg.From != "" {
-		sb.WriteString(fmt.Sprintf("<b>From:</b> <code>%s</code>\n", escapeHTML(msg.From)))
+		sb.WriteString(formatFrom(msg.From))
 	}
 	if !msg.Time.IsZero() {
 		sb.WriteString(fmt.Sprintf("<b>Time:</b> %s\n", formatMessageTime(msg.Time)))
 	}
 	sb.WriteString(fmt.Sprintf("<b>Problem:</b> %s\n", escapeHTML(reason)))
+	sb.WriteString(formatInstanceLine(instance))
 	sb.WriteString(fmt.Sprintf("\n<b>Raw PDU:</b>\n<code>%s</code>", escapeHTML(msg.Text)))
 	return sb.String()
 }
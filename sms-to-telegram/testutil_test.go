@@ -72,6 +72,7 @@ func swapClock(c Clock) func() {
 type sentMessage struct {
 	ChatID int64
 	Text   string
+	Silent bool // DisableNotification
 }
 
 // fakeSender records every SendMessage call and answers via the script hook.
@@ -91,7 +92,7 @@ func (f *fakeSender) SendMessage(ctx context.Context, params *bot.SendMessagePar
 	call := f.calls
 	f.calls++
 	chatID, _ := params.ChatID.(int64)
-	f.sent = append(f.sent, sentMessage{ChatID: chatID, Text: params.Text})
+	f.sent = append(f.sent, sentMessage{ChatID: chatID, Text: params.Text, Silent: params.DisableNotification})
 	script := f.script
 	f.mu.Unlock()
 	if script != nil {
@@ -99,7 +100,7 @@ func (f *fakeSender) SendMessage(ctx context.Context, params *bot.SendMessagePar
 			return nil, err
 		}
 	}
-	return &models.Message{}, nil
+	return &models.Message{ID: 1000 + call}, nil
 }
 
 func (f *fakeSender) sentTo(chatID int64) []sentMessage {
@@ -114,10 +115,64 @@ func (f *fakeSender) sentTo(chatID int64) []sentMessage {
 	return out
 }
 
+// fakeDocSender records every SendDocument call (archive exports).
+type fakeDocSender struct {
+	mu   sync.Mutex
+	docs []sentDocument
+	err  error
+}
+
+type sentDocument struct {
+	ChatID   int64
+	Filename string
+	Caption  string
+	Data     []byte
+}
+
+func (f *fakeDocSender) SendDocument(ctx context.Context, params *bot.SendDocumentParams) (*models.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	doc := sentDocument{Caption: params.Caption}
+	doc.ChatID, _ = params.ChatID.(int64)
+	if upload, ok := params.Document.(*models.InputFileUpload); ok {
+		doc.Filename = upload.Filename
+		doc.Data, _ = io.ReadAll(upload.Data)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.docs = append(f.docs, doc)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.Message{}, nil
+}
+
+// --- fakeSink ----------------------------------------------------------------
+
+// fakeSink records every Send call and fails with the queued errors first.
+type fakeSink struct {
+	name string
+	errs []error
+	sent []PendingSMS
+}
+
+func (f *fakeSink) Name() string { return f.name }
+
+func (f *fakeSink) Send(_ context.Context, pending PendingSMS) error {
+	f.sent = append(f.sent, pending)
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	return nil
+}
+
 // --- fakeAT ------------------------------------------------------------------
 //
 // Command-level fake for pipeline/diagnostics tests (the byte-level scripted
-// port below is for SimpleAT framing tests).
+// port for SimpleAT framing tests lives in pkg/at).
 
 type fakeATResp struct {
 	lines []string
@@ -130,6 +185,8 @@ type fakeAT struct {
 	// response repeats.
 	responses map[string][]fakeATResp
 	calls     []string
+	// secrets are the commands sent through CommandSecret (in calls too).
+	secrets []string
 }
 
 func newFakeAT() *fakeAT {
@@ -162,6 +219,15 @@ func (f *fakeAT) CommandWithTimeout(cmd string, _ time.Duration) ([]string, erro
 	return resp.lines, resp.err
 }
 
+// CommandSecret records the command like any other, so tests can script
+// and count it.
+func (f *fakeAT) CommandSecret(cmd []byte, timeout time.Duration) ([]string, error) {
+	f.mu.Lock()
+	f.secrets = append(f.secrets, string(cmd))
+	f.mu.Unlock()
+	return f.CommandWithTimeout(string(cmd), timeout)
+}
+
 func (f *fakeAT) Ping() error {
 	_, err := f.CommandWithTimeout("AT", 2*time.Second)
 	return err
@@ -178,63 +244,3 @@ func (f *fakeAT) commandCount(cmd string) int {
 	}
 	return n
 }
-
-// --- scriptedPort --------------------------------------------------------------
-//
-// Byte-level serial port fake. Each Read consumes one scripted chunk; an empty
-// queue behaves like a VTIME timeout (0 bytes, io.EOF), matching tarm/serial
-// over os.File. Writes are recorded and can enqueue response chunks.
-
-type readChunk struct {
-	data []byte
-	err  error
-}
-
-type scriptedPort struct {
-	mu      sync.Mutex
-	chunks  []readChunk
-	writes  []string
-	onWrite func(written string) []readChunk
-}
-
-// chunk builds a data chunk; use eofChunk() to simulate an idle read timeout.
-func chunk(s string) readChunk   { return readChunk{data: []byte(s)} }
-func eofChunk() readChunk        { return readChunk{err: io.EOF} }
-func errChunk(e error) readChunk { return readChunk{err: e} }
-
-func (p *scriptedPort) enqueue(chunks ...readChunk) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.chunks = append(p.chunks, chunks...)
-}
-
-func (p *scriptedPort) Read(b []byte) (int, error) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	if len(p.chunks) == 0 {
-		return 0, io.EOF // idle: VTIME expired with no data
-	}
-	ch := p.chunks[0]
-	p.chunks = p.chunks[1:]
-	n := copy(b, ch.data)
-	if n < len(ch.data) {
-		// Remainder stays queued for the next read.
-		p.chunks = append([]readChunk{{data: ch.data[n:], err: ch.err}}, p.chunks...)
-		return n, nil
-	}
-	return n, ch.err
-}
-
-func (p *scriptedPort) Write(b []byte) (int, error) {
-	p.mu.Lock()
-	written := string(b)
-	p.writes = append(p.writes, written)
-	hook := p.onWrite
-	p.mu.Unlock()
-	if hook != nil {
-		if resp := hook(written); resp != nil {
-			p.enqueue(resp...)
-		}
-	}
-	return len(b), nil
-}
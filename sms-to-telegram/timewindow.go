@@ -0,0 +1,122 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeWindow is a weekly time-of-day range in the host's local time, e.g.
+// "22:00-07:00", "Mon-Fri 09:00-18:00" or "Sat,Sun". A time range whose end
+// is before its start wraps past midnight; the part after midnight belongs
+// to the day the window started on. Without days the window applies every
+// day, without a time range it covers the whole day.
+type TimeWindow struct {
+	days       [7]bool // indexed by time.Weekday
+	start, end int     // minutes since midnight; end is exclusive
+	spec       string
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseClock parses "HH:MM" (24h) into minutes since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (use HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseDays parses "Mon-Fri", "Sat,Sun" or "Fri-Mon" (ranges wrap).
+func parseDays(s string) ([7]bool, error) {
+	var days [7]bool
+	for _, item := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(strings.ToLower(strings.TrimSpace(item)), "-")
+		from, ok := weekdayNames[first]
+		if !ok {
+			return days, fmt.Errorf("invalid weekday %q (use Mon..Sun)", first)
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdayNames[last]; !ok {
+				return days, fmt.Errorf("invalid weekday %q (use Mon..Sun)", last)
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// ParseTimeWindow parses "[days] [HH:MM-HH:MM]" (at least one of the two).
+func ParseTimeWindow(s string) (*TimeWindow, error) {
+	w := &TimeWindow{start: 0, end: 24 * 60, spec: strings.Join(strings.Fields(s), " ")}
+	for i := range w.days {
+		w.days[i] = true
+	}
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid time window %q (use [Mon-Fri] HH:MM-HH:MM)", s)
+	}
+	rangeStr := fields[len(fields)-1]
+	if len(fields) == 2 || !strings.Contains(rangeStr, ":") {
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		w.days = days
+		if len(fields) == 1 {
+			return w, nil
+		}
+	}
+
+	from, to, ok := strings.Cut(rangeStr, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid time window %q (use [Mon-Fri] HH:MM-HH:MM)", s)
+	}
+	var err error
+	if w.start, err = parseClock(from); err != nil {
+		return nil, err
+	}
+	if w.end, err = parseClock(to); err != nil {
+		return nil, err
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("invalid time window %q: empty range", s)
+	}
+	return w, nil
+}
+
+// Contains reports whether t falls inside the window. Nil-safe (a nil
+// window contains nothing).
+func (w *TimeWindow) Contains(t time.Time) bool {
+	if w == nil {
+		return false
+	}
+	t = t.Local()
+	m := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	if w.start < w.end {
+		return w.days[today] && m >= w.start && m < w.end
+	}
+	yesterday := (today + 6) % 7
+	return (w.days[today] && m >= w.start) || (w.days[yesterday] && m < w.end)
+}
+
+func (w *TimeWindow) String() string {
+	if w == nil {
+		return ""
+	}
+	return w.spec
+}
@@ -0,0 +1,64 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeWindow(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2026, 3, 10, h, m, 0, 0, time.Local) }
+	tests := []struct {
+		window string
+		at     time.Time
+		want   bool
+	}{
+		{"09:00-18:00", at(9, 0), true},
+		{"09:00-18:00", at(17, 59), true},
+		{"09:00-18:00", at(18, 0), false},
+		{"09:00-18:00", at(8, 59), false},
+		// Wraps past midnight.
+		{"22:00-07:00", at(23, 30), true},
+		{"22:00-07:00", at(0, 0), true},
+		{"22:00-07:00", at(6, 59), true},
+		{"22:00-07:00", at(7, 0), false},
+		{"22:00-07:00", at(12, 0), false},
+		// 2026-03-10 is a Tuesday.
+		{"Mon-Fri 09:00-18:00", at(10, 0), true},
+		{"Sat,Sun", at(10, 0), false},
+		{"Sat,Sun", at(10, 0).AddDate(0, 0, 4), true},
+		{"Fri-Mon", at(10, 0).AddDate(0, 0, -1), true},
+		{"Wed-Thu", at(10, 0), false},
+		// After midnight belongs to the day the window started on.
+		{"Mon 22:00-07:00", at(3, 0), true},
+		{"Tue 22:00-07:00", at(3, 0), false},
+		{"Tue 22:00-07:00", at(23, 0), true},
+	}
+	for _, tt := range tests {
+		w, err := ParseTimeWindow(tt.window)
+		if err != nil {
+			t.Fatalf("ParseTimeWindow(%q) error = %v", tt.window, err)
+		}
+		if got := w.Contains(tt.at); got != tt.want {
+			t.Errorf("%s.Contains(%s) = %v, want %v", tt.window, tt.at.Format("15:04"), got, tt.want)
+		}
+	}
+
+	var disabled *TimeWindow
+	if disabled.Contains(at(23, 0)) {
+		t.Error("nil window must contain nothing")
+	}
+}
+
+func TestParseTimeWindowInvalid(t *testing.T) {
+	for _, s := range []string{
+		"", "22:00", "22-07", "24:00-07:00", "10:00-10:00", "ab:cd-07:00",
+		"Monday 09:00-18:00", "Mon-Xyz", "Mon 09:00-18:00 extra",
+	} {
+		if _, err := ParseTimeWindow(s); err == nil {
+			t.Errorf("ParseTimeWindow(%q) should fail", s)
+		}
+	}
+}
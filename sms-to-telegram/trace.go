@@ -0,0 +1,60 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// Trace IDs: every PDU read from the SIM gets one, and the SMS built from
+// it carries it (PendingSMS.TraceID) through assembly, the pipeline steps
+// and every sink, as the "trace" attribute of their log entries. It is the
+// fingerprint of the PDU, so the same SMS keeps its ID over the polls that
+// retry it and across restarts; a multipart SMS takes the ID of its first
+// part. The listing code logs it explicitly; the delivery path passes it in
+// the context (withTrace) and logs with the slog *Context functions, which
+// traceHandler completes.
+
+// traceID is the trace ID of a raw PDU.
+func traceID(raw string) string {
+	return contentFingerprint(strings.ToUpper(raw))
+}
+
+type traceKey struct{}
+
+// withTrace returns ctx carrying the trace ID of the SMS being delivered.
+func withTrace(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceKey{}, id)
+}
+
+// traceFromContext returns the trace ID in ctx, or "".
+func traceFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(traceKey{}).(string)
+	return id
+}
+
+// traceHandler adds the trace ID of the context to every record.
+type traceHandler struct {
+	slog.Handler
+}
+
+func (h traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := traceFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("trace", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceHandler) WithGroup(name string) slog.Handler {
+	return traceHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,69 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// TestListSMSMessages_TraceIDs: every SMS carries the trace ID of its PDU,
+// a multipart SMS that of its first part wherever it sits on the SIM.
+func TestListSMSMessages_TraceIDs(t *testing.T) {
+	modem := newFakeAT()
+	modem.on("AT+CMGL=4", cmglListing(
+		[2]string{"+CMGL: 1,1,,30", pduGSM7Part2},
+		[2]string{"+CMGL: 2,1,,29", testPDUSingle},
+		[2]string{"+CMGL: 3,1,,30", pduGSM7Part1},
+	), nil)
+	result, err := listSMSMessages(modem, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]string{2: traceID(testPDUSingle), 3: traceID(pduGSM7Part1)}
+	if len(result.Pending) != 2 {
+		t.Fatalf("got %d SMS, want 2", len(result.Pending))
+	}
+	for _, p := range result.Pending {
+		if p.TraceID == "" || p.TraceID != want[p.PartIndices[0]] {
+			t.Errorf("SMS at %v: trace %q, want %q", p.PartIndices, p.TraceID, want[p.PartIndices[0]])
+		}
+	}
+	if traceID(testPDUSingle) != traceID(strings.ToLower(testPDUSingle)) {
+		t.Error("trace ID depends on the hex case")
+	}
+}
+
+// TestDeliverer_TraceInLogs: the sinks' log entries name the SMS they are
+// about; entries about no SMS carry no trace.
+func TestDeliverer_TraceInLogs(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	defaultLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(newLogHandler(&buf, &Config{LogLevel: slog.LevelInfo, LogFormat: "text"})))
+
+	cfg := testConfig()
+	cfg.DryRun = true
+	deliverer, _, _ := newTestDeliverer(cfg)
+	pending := PendingSMS{Message: SMSMessage{Index: 1, From: "Bank", Text: "hi"}, PartIndices: []int{1}, TraceID: "0a1b2c3d4e5f"}
+	if got := deliverer.Deliver(context.Background(), pending); got != deliveryDone {
+		t.Fatalf("Deliver() = %v", got)
+	}
+	slog.Info("Unrelated")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("log has %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	if !strings.Contains(lines[0], "DRY_RUN: Would send to Telegram") || !strings.Contains(lines[0], "trace=0a1b2c3d4e5f") {
+		t.Errorf("sink entry without trace: %s", lines[0])
+	}
+	if strings.Contains(lines[1], "trace=") {
+		t.Errorf("unrelated entry has a trace: %s", lines[1])
+	}
+}
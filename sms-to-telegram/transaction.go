@@ -0,0 +1,232 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Transaction SMS parsing (TRANSACTION_TEMPLATES_FILE): banks announce every
+// card payment by SMS, in a fixed format per bank. A template describes one
+// format, the SMS text with placeholders where the values are:
+//
+//	MyBank Purchase {amount} {currency} at {merchant}. Balance {balance} {currency}{*}
+//
+// One template per line, the sender first (* for any), blank lines and #
+// comments skipped; the first template of the sender that matches the
+// whole text wins. The values go to the sink payloads as "transaction", so
+// a budgeting tool gets numbers instead of prose.
+
+// transactionFields are the placeholders a template may use, with what they
+// match; {*} skips any text.
+var transactionFields = map[string]string{
+	"amount":   `[-+\x{2212}]?\d(?:[\d\s'.,]*\d)?`,
+	"balance":  `[-+\x{2212}]?\d(?:[\d\s'.,]*\d)?`,
+	"currency": `[^\s\d]+`,
+	"merchant": `.+?`,
+	"card":     `\S+`,
+}
+
+// Transaction holds the values a template extracted. Amounts are decimal
+// numbers with a dot, signed as in the SMS.
+type Transaction struct {
+	Amount   json.Number `json:"amount"`
+	Currency string      `json:"currency,omitempty"`
+	Merchant string      `json:"merchant,omitempty"`
+	Balance  json.Number `json:"balance,omitempty"`
+	Card     string      `json:"card,omitempty"`
+}
+
+// LogValue renders the values as one string, so the privacy mode masks them
+// like SMS text under the "transaction" key.
+func (t Transaction) LogValue() slog.Value {
+	var parts []string
+	for _, f := range []struct{ name, value string }{
+		{"amount", string(t.Amount)}, {"currency", t.Currency}, {"merchant", t.Merchant},
+		{"balance", string(t.Balance)}, {"card", t.Card},
+	} {
+		if f.value != "" {
+			parts = append(parts, fmt.Sprintf("%s=%q", f.name, f.value))
+		}
+	}
+	return slog.StringValue(strings.Join(parts, " "))
+}
+
+// TransactionTemplate is one TRANSACTION_TEMPLATES_FILE line.
+type TransactionTemplate struct {
+	Line   int
+	sender string // "*" matches any sender
+	re     *regexp.Regexp
+}
+
+// loadTransactionTemplates reads TRANSACTION_TEMPLATES_FILE; an empty path
+// means none.
+func loadTransactionTemplates(path string) ([]TransactionTemplate, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("invalid TRANSACTION_TEMPLATES_FILE %q: must be absolute", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading TRANSACTION_TEMPLATES_FILE: %w", err)
+	}
+	templates, err := parseTransactionTemplates(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("TRANSACTION_TEMPLATES_FILE %w", err)
+	}
+	return templates, nil
+}
+
+func parseTransactionTemplates(s string) ([]TransactionTemplate, error) {
+	var templates []TransactionTemplate
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sender, text, _ := strings.Cut(line, " ")
+		re, err := compileTransactionTemplate(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		templates = append(templates, TransactionTemplate{Line: i + 1, sender: sender, re: re})
+	}
+	return templates, nil
+}
+
+// compileTransactionTemplate turns a template into an anchored regular
+// expression. Literal text matches case-insensitively, any run of white
+// space as any other.
+func compileTransactionTemplate(text string) (*regexp.Regexp, error) {
+	if text == "" {
+		return nil, fmt.Errorf("want a sender and a template")
+	}
+	var expr strings.Builder
+	expr.WriteString(`(?is)^\s*`)
+	seen := map[string]bool{}
+	for text != "" {
+		open := strings.IndexByte(text, '{')
+		if open < 0 {
+			expr.WriteString(quoteTemplateText(text))
+			break
+		}
+		expr.WriteString(quoteTemplateText(text[:open]))
+		end := strings.IndexByte(text[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated placeholder at %q", text[open:])
+		}
+		name := text[open+1 : open+end]
+		text = text[open+end+1:]
+		if name == "*" {
+			expr.WriteString(`.*?`)
+			continue
+		}
+		pattern, ok := transactionFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown placeholder {%s} (use amount, currency, merchant, balance, card or *)", name)
+		}
+		if seen[name] {
+			// A repeated placeholder only has to be there again.
+			expr.WriteString(`(?:` + pattern + `)`)
+			continue
+		}
+		seen[name] = true
+		expr.WriteString(`(?P<` + name + `>` + pattern + `)`)
+	}
+	if !seen["amount"] {
+		return nil, fmt.Errorf("the template has no {amount}")
+	}
+	expr.WriteString(`\s*$`)
+	return regexp.Compile(expr.String())
+}
+
+var templateSpace = regexp.MustCompile(`\s+`)
+
+func quoteTemplateText(s string) string {
+	words := templateSpace.Split(s, -1)
+	for i, w := range words {
+		words[i] = regexp.QuoteMeta(w)
+	}
+	return strings.Join(words, `\s+`)
+}
+
+// matchTransaction returns the values of the first template that matches
+// pending, with the line of that template; nil when none does.
+func matchTransaction(templates []TransactionTemplate, pending PendingSMS) (*Transaction, int) {
+	for _, t := range templates {
+		if t.sender != "*" && !strings.EqualFold(t.sender, pending.Message.From) {
+			continue
+		}
+		m := t.re.FindStringSubmatch(pending.Message.Text)
+		if m == nil {
+			continue
+		}
+		value := func(name string) string {
+			if i := t.re.SubexpIndex(name); i > 0 {
+				return strings.TrimSpace(m[i])
+			}
+			return ""
+		}
+		tx := &Transaction{
+			Amount:   normalizeAmount(value("amount")),
+			Currency: value("currency"),
+			Merchant: value("merchant"),
+			Balance:  normalizeAmount(value("balance")),
+			Card:     value("card"),
+		}
+		return tx, t.Line
+	}
+	return nil, 0
+}
+
+// normalizeAmount turns "1 234,56", "1,234.56" or "1'234" into a JSON
+// number. The last separator followed by one or two digits is the decimal
+// point; every other separator groups thousands.
+func normalizeAmount(s string) json.Number {
+	if s == "" {
+		return ""
+	}
+	sign := ""
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "−") {
+		sign = "-"
+	}
+	s = strings.TrimLeft(s, "+-−")
+	decimals := ""
+	if i := strings.LastIndexAny(s, ".,"); i >= 0 && len(s)-i-1 >= 1 && len(s)-i-1 <= 2 {
+		decimals = "." + s[i+1:]
+		s = s[:i]
+	}
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	return json.Number(sign + digits + decimals)
+}
+
+// parseTransaction attaches the values of a matching
+// TRANSACTION_TEMPLATES_FILE template to the SMS.
+func (d *Deliverer) parseTransaction(next SMSHandler) SMSHandler {
+	return func(ctx context.Context, pending PendingSMS) deliveryStatus {
+		if len(d.cfg.TransactionTemplates) == 0 || pending.RawFallback {
+			return next(ctx, pending)
+		}
+		if tx, line := matchTransaction(d.cfg.TransactionTemplates, pending); tx != nil {
+			slog.InfoContext(ctx, "Transaction SMS parsed", "template_line", line)
+			slog.DebugContext(ctx, "Transaction values", "transaction", *tx)
+			pending.Transaction = tx
+		}
+		return next(ctx, pending)
+	}
+}
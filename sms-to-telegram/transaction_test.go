@@ -0,0 +1,138 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseTransactionTemplates_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"no template", "MyBank", "want a sender and a template"},
+		{"no amount", "MyBank Paid at {merchant}", "no {amount}"},
+		{"unknown placeholder", "MyBank Paid {amount} {shop}", "unknown placeholder {shop}"},
+		{"unterminated", "MyBank Paid {amount", "unterminated placeholder"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTransactionTemplates("# bank\n" + tt.template)
+			if err == nil || !strings.Contains(err.Error(), tt.want) || !strings.HasPrefix(err.Error(), "line 2: ") {
+				t.Errorf("parseTransactionTemplates(%q) error = %v, want line 2 and %q", tt.template, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchTransaction(t *testing.T) {
+	templates, err := parseTransactionTemplates(`
+MyBank Purchase {amount} {currency} at {merchant}. Balance {balance} {currency}{*}
+MyBank Card *{card}: refund {amount}{currency}
+900 Списание {amount}р {merchant} Баланс: {balance}р
+* Paid {amount}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		from string
+		text string
+		want *Transaction
+		line int
+	}{
+		{
+			name: "purchase",
+			from: "MyBank",
+			text: "PURCHASE 1,234.56 EUR at Coffee  Shop GmbH. Balance 10 000,00 EUR. Thank you!",
+			want: &Transaction{Amount: "1234.56", Currency: "EUR", Merchant: "Coffee  Shop GmbH", Balance: "10000.00"},
+			line: 2,
+		},
+		{
+			name: "second template of the sender",
+			from: "mybank",
+			text: "Card *4321: refund -12,5€",
+			want: &Transaction{Amount: "-12.5", Currency: "€", Card: "4321"},
+			line: 3,
+		},
+		{
+			name: "cyrillic",
+			from: "900",
+			text: "Списание 1 500р PYATEROCHKA Баланс: 3 210,40р",
+			want: &Transaction{Amount: "1500", Merchant: "PYATEROCHKA", Balance: "3210.40"},
+			line: 4,
+		},
+		{name: "any sender", from: "+4915550001234", text: "Paid 5", want: &Transaction{Amount: "5"}, line: 5},
+		{name: "whole text must match", from: "+4915550001234", text: "Paid 5 for parking"},
+		{name: "other sender", from: "OtherBank", text: "Purchase 1 EUR at X. Balance 2 EUR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, line := matchTransaction(templates, PendingSMS{Message: SMSMessage{From: tt.from, Text: tt.text}})
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("matchTransaction() = %+v from line %d, want no match", *got, line)
+				}
+				return
+			}
+			if got == nil || *got != *tt.want || line != tt.line {
+				t.Errorf("matchTransaction() = %+v from line %d, want %+v from line %d", got, line, *tt.want, tt.line)
+			}
+		})
+	}
+}
+
+func TestNormalizeAmount(t *testing.T) {
+	for in, want := range map[string]json.Number{
+		"1,234.56": "1234.56",
+		"1.234,56": "1234.56",
+		"1 234":    "1234",
+		"1,234":    "1234",
+		"1'234.5":  "1234.5",
+		"−7,00":    "-7.00",
+		"+3":       "3",
+		"":         "",
+	} {
+		if got := normalizeAmount(in); got != want {
+			t.Errorf("normalizeAmount(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// The values reach the sinks as "transaction" in the payload.
+func TestDeliverer_Transaction(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	cfg := testConfig()
+	path := filepath.Join(t.TempDir(), "templates")
+	if err := os.WriteFile(path, []byte("MyBank Paid {amount} {currency} at {merchant}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := loadTransactionTemplates(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.TransactionTemplates = templates
+	deliverer, _, _ := newTestDeliverer(cfg)
+	sink := &fakeSink{name: "webhook"}
+	deliverer.AddSink(sink)
+
+	pending := PendingSMS{Message: SMSMessage{Index: 1, From: "MyBank", Text: "Paid 9.99 USD at Books"}, PartIndices: []int{1}}
+	if got := deliverer.Deliver(context.Background(), pending); got != deliveryDone {
+		t.Fatalf("Deliver() = %v, want deliveryDone", got)
+	}
+	body, err := json.Marshal(newSMSPayload(sink.sent[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"transaction":{"amount":9.99,"currency":"USD","merchant":"Books"}`; !strings.Contains(string(body), want) {
+		t.Errorf("payload %s, want %s", body, want)
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Automatic translation (TRANSLATE_PROVIDER): the operator's SMS arrive in
+// the language of the country, which the recipients may not read. Every SMS
+// is sent to a translation service and the translation is shown under the
+// original; SMS already in the target language are left alone. The SMS
+// text leaves the gateway for that service, so this is off by default.
+
+// translateProviders are the supported services with their default base
+// URLs; LibreTranslate is self-hosted and has none.
+var translateProviders = map[string]string{
+	"deepl":          "https://api.deepl.com",
+	"google":         "https://translation.googleapis.com",
+	"libretranslate": "",
+}
+
+// translateCacheSize bounds the translations kept for SMS that are
+// delivered again (deferred, or rejected by one sink).
+const translateCacheSize = 256
+
+// translateMaxResponse bounds a service answer; a translated SMS is a few
+// kilobytes at most.
+const translateMaxResponse = 1 << 20
+
+// TranslateOptions configures the translation step (TRANSLATE_* variables).
+type TranslateOptions struct {
+	Provider string // deepl, google or libretranslate
+	URL      string // service base URL
+	APIKey   string // optional for LibreTranslate
+	Target   string // target language code, e.g. "en"
+	Timeout  time.Duration
+}
+
+// Translation is the translated text of an SMS.
+type Translation struct {
+	Text string `json:"text"`
+	// Source is the language the service detected; empty when it did not
+	// say.
+	Source string `json:"source,omitempty"`
+	Target string `json:"target"`
+}
+
+// loadTranslateConfig reads TRANSLATE_*; TRANSLATE_PROVIDER enables
+// translation.
+func loadTranslateConfig() (*TranslateOptions, error) {
+	provider := strings.ToLower(strings.TrimSpace(os.Getenv("TRANSLATE_PROVIDER")))
+	if provider == "" {
+		return nil, nil
+	}
+	defaultURL, ok := translateProviders[provider]
+	if !ok {
+		return nil, fmt.Errorf("invalid TRANSLATE_PROVIDER %q (use deepl, google or libretranslate)", provider)
+	}
+	key, err := secretEnv("TRANSLATE_API_KEY")
+	if err != nil {
+		return nil, err
+	}
+	opts := &TranslateOptions{
+		Provider: provider,
+		URL:      os.Getenv("TRANSLATE_URL"),
+		APIKey:   key,
+		Target:   strings.TrimSpace(os.Getenv("TRANSLATE_TARGET")),
+		Timeout:  10 * time.Second,
+	}
+	if provider == "deepl" && opts.URL == "" && strings.HasSuffix(key, ":fx") {
+		// Keys of the free plan only work on the free endpoint.
+		defaultURL = "https://api-free.deepl.com"
+	}
+	if opts.URL == "" {
+		opts.URL = defaultURL
+	}
+	if opts.URL == "" {
+		return nil, fmt.Errorf("TRANSLATE_URL is required with TRANSLATE_PROVIDER=%s", provider)
+	}
+	if err := validateWebhookURL(opts.URL); err != nil {
+		return nil, fmt.Errorf("invalid TRANSLATE_URL: %w", err)
+	}
+	if key == "" && provider != "libretranslate" {
+		return nil, fmt.Errorf("TRANSLATE_API_KEY is required with TRANSLATE_PROVIDER=%s", provider)
+	}
+	if opts.Target == "" {
+		return nil, fmt.Errorf("TRANSLATE_TARGET is required with TRANSLATE_PROVIDER")
+	}
+	if !validLanguage(opts.Target) {
+		return nil, fmt.Errorf("invalid TRANSLATE_TARGET %q (use a language code such as en or pt-BR)", opts.Target)
+	}
+	if s := os.Getenv("TRANSLATE_TIMEOUT"); s != "" {
+		opts.Timeout, err = time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRANSLATE_TIMEOUT %q: %w", s, err)
+		}
+		if opts.Timeout <= 0 {
+			return nil, fmt.Errorf("invalid TRANSLATE_TIMEOUT %q: must be > 0", s)
+		}
+	}
+	return opts, nil
+}
+
+// validLanguage accepts language codes like "en", "EN-GB" or "zh-Hans".
+func validLanguage(s string) bool {
+	lang, region, _ := strings.Cut(s, "-")
+	if len(lang) < 2 || len(lang) > 3 || len(region) > 4 {
+		return false
+	}
+	for _, r := range lang + region {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// sameLanguage compares the detected source with the target by their
+// language only: a German SMS needs no translation to "DE-AT".
+func sameLanguage(source, target string) bool {
+	source, _, _ = strings.Cut(source, "-")
+	target, _, _ = strings.Cut(target, "-")
+	return source != "" && strings.EqualFold(source, target)
+}
+
+// Translator calls the configured translation service. It is used by the
+// delivery goroutine only, one SMS at a time.
+type Translator struct {
+	opts   TranslateOptions
+	client *http.Client
+	dryRun bool
+	// cache maps the fingerprint of a text to its translation (nil: no
+	// translation needed), so an SMS delivered again is neither sent to the
+	// service again nor translated differently for the remaining sinks.
+	cache map[string]*Translation
+}
+
+func NewTranslator(opts TranslateOptions, dryRun bool) *Translator {
+	return &Translator{
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		dryRun: dryRun,
+		cache:  make(map[string]*Translation),
+	}
+}
+
+// Translate returns the translation of text, or nil when it already is in
+// the target language.
+func (t *Translator) Translate(ctx context.Context, text string) (*Translation, error) {
+	key := contentFingerprint(text)
+	if tr, ok := t.cache[key]; ok {
+		return tr, nil
+	}
+	if t.dryRun {
+		slog.InfoContext(ctx, "DRY_RUN: Would translate SMS",
+			"provider", t.opts.Provider, "endpoint", redactURL(t.opts.URL))
+		return nil, nil
+	}
+	var (
+		tr  Translation
+		err error
+	)
+	switch t.opts.Provider {
+	case "deepl":
+		tr, err = t.deepl(ctx, text)
+	case "google":
+		tr, err = t.google(ctx, text)
+	default:
+		tr, err = t.libreTranslate(ctx, text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tr.Target = t.opts.Target
+	var result *Translation
+	if !sameLanguage(tr.Source, t.opts.Target) && strings.TrimSpace(tr.Text) != strings.TrimSpace(text) {
+		result = &tr
+	}
+	if len(t.cache) >= translateCacheSize {
+		clear(t.cache)
+	}
+	t.cache[key] = result
+	return result, nil
+}
+
+// deepl calls DeepL's /v2/translate.
+func (t *Translator) deepl(ctx context.Context, text string) (Translation, error) {
+	var resp struct {
+		Translations []struct {
+			DetectedSourceLanguage string `json:"detected_source_language"`
+			Text                   string `json:"text"`
+		} `json:"translations"`
+	}
+	err := t.post(ctx, "/v2/translate", map[string]any{
+		"text":        []string{text},
+		"target_lang": strings.ToUpper(t.opts.Target),
+	}, map[string]string{"Authorization": "DeepL-Auth-Key " + t.opts.APIKey}, &resp)
+	if err != nil {
+		return Translation{}, err
+	}
+	if len(resp.Translations) == 0 {
+		return Translation{}, fmt.Errorf("DeepL returned no translation")
+	}
+	return Translation{Text: resp.Translations[0].Text, Source: resp.Translations[0].DetectedSourceLanguage}, nil
+}
+
+// google calls the Cloud Translation API (Basic, v2).
+func (t *Translator) google(ctx context.Context, text string) (Translation, error) {
+	var resp struct {
+		Data struct {
+			Translations []struct {
+				TranslatedText         string `json:"translatedText"`
+				DetectedSourceLanguage string `json:"detectedSourceLanguage"`
+			} `json:"translations"`
+		} `json:"data"`
+	}
+	err := t.post(ctx, "/language/translate/v2", map[string]any{
+		"q":      []string{text},
+		"target": t.opts.Target,
+		"format": "text",
+	}, map[string]string{"X-Goog-Api-Key": t.opts.APIKey}, &resp)
+	if err != nil {
+		return Translation{}, err
+	}
+	if len(resp.Data.Translations) == 0 {
+		return Translation{}, fmt.Errorf("Google Translate returned no translation")
+	}
+	tr := resp.Data.Translations[0]
+	return Translation{Text: tr.TranslatedText, Source: tr.DetectedSourceLanguage}, nil
+}
+
+// libreTranslate calls a LibreTranslate server's /translate.
+func (t *Translator) libreTranslate(ctx context.Context, text string) (Translation, error) {
+	var resp struct {
+		TranslatedText   string `json:"translatedText"`
+		DetectedLanguage struct {
+			Language string `json:"language"`
+		} `json:"detectedLanguage"`
+	}
+	body := map[string]any{"q": text, "source": "auto", "target": t.opts.Target, "format": "text"}
+	if t.opts.APIKey != "" {
+		body["api_key"] = t.opts.APIKey
+	}
+	if err := t.post(ctx, "/translate", body, nil, &resp); err != nil {
+		return Translation{}, err
+	}
+	return Translation{Text: resp.TranslatedText, Source: resp.DetectedLanguage.Language}, nil
+}
+
+// post sends one JSON request to the service and decodes the answer into
+// out. Errors name the provider and the redacted URL, never the key.
+func (t *Translator) post(ctx context.Context, path string, body any, headers map[string]string, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encoding translation request: %w", err)
+	}
+	endpoint := strings.TrimRight(t.opts.URL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("building translation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// *url.Error repeats the full URL.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s %s: %w", t.opts.Provider, redactURL(t.opts.URL), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: HTTP %d", t.opts.Provider, redactURL(t.opts.URL), resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, translateMaxResponse)).Decode(out); err != nil {
+		return fmt.Errorf("%s %s: decoding response: %w", t.opts.Provider, redactURL(t.opts.URL), err)
+	}
+	return nil
+}
+
+// displayText is the SMS text for the sinks read by people (Telegram,
+// Pushover, Gotify): the text as received, with its transliteration and
+// translation under it.
+func displayText(pending PendingSMS) string {
+	text := pending.Message.Text
+	if pending.Transliteration != "" {
+		text += "\n\nTransliteration:\n" + pending.Transliteration
+	}
+	if tr := pending.Translation; tr != nil {
+		from := tr.Source
+		if from == "" {
+			from = "?"
+		}
+		text += fmt.Sprintf("\n\nTranslation (%s → %s):\n%s", strings.ToLower(from), strings.ToLower(tr.Target), tr.Text)
+	}
+	return text
+}
+
+// translate attaches the translation of the SMS text. Translation is a
+// courtesy: when the service fails, the SMS is forwarded untranslated
+// rather than held back.
+func (d *Deliverer) translate(next SMSHandler) SMSHandler {
+	return func(ctx context.Context, pending PendingSMS) deliveryStatus {
+		if d.translator == nil || pending.RawFallback || strings.TrimSpace(pending.Message.Text) == "" {
+			return next(ctx, pending)
+		}
+		tr, err := d.translator.Translate(ctx, pending.Message.Text)
+		switch {
+		case err != nil:
+			slog.WarnContext(ctx, "Translation failed, forwarding the SMS untranslated", "error", err)
+		case tr != nil:
+			slog.InfoContext(ctx, "SMS translated", "source", tr.Source, "target", tr.Target)
+			slog.DebugContext(ctx, "Translation", "text", tr.Text)
+			pending.Translation = tr
+		}
+		return next(ctx, pending)
+	}
+}
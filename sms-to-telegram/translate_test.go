@@ -0,0 +1,155 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTranslator_Providers(t *testing.T) {
+	tests := []struct {
+		provider string
+		path     string
+		header   string // header carrying the key; empty: in the body
+		response string
+		want     Translation
+	}{
+		{
+			provider: "deepl",
+			path:     "/v2/translate",
+			header:   "Authorization",
+			response: `{"translations":[{"detected_source_language":"DE","text":"Your balance is low"}]}`,
+			want:     Translation{Text: "Your balance is low", Source: "DE", Target: "en"},
+		},
+		{
+			provider: "google",
+			path:     "/language/translate/v2",
+			header:   "X-Goog-Api-Key",
+			response: `{"data":{"translations":[{"translatedText":"Your balance is low","detectedSourceLanguage":"de"}]}}`,
+			want:     Translation{Text: "Your balance is low", Source: "de", Target: "en"},
+		},
+		{
+			provider: "libretranslate",
+			path:     "/translate",
+			response: `{"translatedText":"Your balance is low","detectedLanguage":{"confidence":90,"language":"de"}}`,
+			want:     Translation{Text: "Your balance is low", Source: "de", Target: "en"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			var calls int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				var body map[string]any
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("request body: %v", err)
+				}
+				if r.URL.Path != tt.path {
+					t.Errorf("path = %s, want %s", r.URL.Path, tt.path)
+				}
+				if tt.header != "" && !strings.Contains(r.Header.Get(tt.header), "k3y") {
+					t.Errorf("%s = %q, want the API key", tt.header, r.Header.Get(tt.header))
+				}
+				if tt.header == "" && body["api_key"] != "k3y" {
+					t.Errorf("api_key = %v, want the API key", body["api_key"])
+				}
+				w.Write([]byte(tt.response))
+			}))
+			defer srv.Close()
+
+			tr := NewTranslator(TranslateOptions{Provider: tt.provider, URL: srv.URL, APIKey: "k3y", Target: "en", Timeout: time.Second}, false)
+			for range 2 {
+				got, err := tr.Translate(context.Background(), "Ihr Guthaben ist niedrig")
+				if err != nil || got == nil || *got != tt.want {
+					t.Fatalf("Translate() = %+v, %v; want %+v", got, err, tt.want)
+				}
+			}
+			if calls != 1 {
+				t.Errorf("service called %d times, want 1 (cached)", calls)
+			}
+		})
+	}
+}
+
+func TestTranslator_NotNeeded(t *testing.T) {
+	for name, response := range map[string]string{
+		"target language":  `{"translatedText":"Your balance is low","detectedLanguage":{"language":"en"}}`,
+		"same text":        `{"translatedText":" Your balance is low","detectedLanguage":{"language":"fr"}}`,
+		"region of target": `{"translatedText":"Your balance is low!","detectedLanguage":{"language":"EN-US"}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(response))
+			}))
+			defer srv.Close()
+			tr := NewTranslator(TranslateOptions{Provider: "libretranslate", URL: srv.URL, Target: "en-GB", Timeout: time.Second}, false)
+			if got, err := tr.Translate(context.Background(), "Your balance is low"); err != nil || got != nil {
+				t.Errorf("Translate() = %+v, %v; want nil, nil", got, err)
+			}
+		})
+	}
+}
+
+func TestTranslator_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusForbidden)
+	}))
+	defer srv.Close()
+	tr := NewTranslator(TranslateOptions{Provider: "deepl", URL: srv.URL + "/?token=s3cret", APIKey: "s3cret", Target: "en", Timeout: time.Second}, false)
+	_, err := tr.Translate(context.Background(), "Hallo")
+	if err == nil || !strings.Contains(err.Error(), "HTTP 403") || strings.Contains(err.Error(), "s3cret") {
+		t.Errorf("Translate() error = %v, want HTTP 403 without the key", err)
+	}
+	if len(tr.cache) != 0 {
+		t.Error("a failed translation was cached")
+	}
+}
+
+// The translation reaches Telegram under the original and the payloads as
+// "translation"; a failing service forwards the SMS untranslated.
+func TestDeliverer_Translate(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"translatedText":"Top up <now>","detectedLanguage":{"language":"de"}}`))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.Translate = &TranslateOptions{Provider: "libretranslate", URL: srv.URL, Target: "en", Timeout: time.Second}
+	deliverer, sender, _ := newTestDeliverer(cfg)
+	sink := &fakeSink{name: "webhook"}
+	deliverer.AddSink(sink)
+
+	pending := PendingSMS{Message: SMSMessage{Index: 1, From: "Operator", Text: "Jetzt aufladen"}, PartIndices: []int{1}}
+	if got := deliverer.Deliver(context.Background(), pending); got != deliveryDone {
+		t.Fatalf("Deliver() = %v, want deliveryDone", got)
+	}
+	if text := sender.sent[0].Text; !strings.Contains(text, "Jetzt aufladen\n\nTranslation (de → en):\nTop up &lt;now&gt;") {
+		t.Errorf("Telegram message %q, want the escaped translation under the original", text)
+	}
+	body, err := json.Marshal(newSMSPayload(sink.sent[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"translation":{"text":"Top up \u003cnow\u003e","source":"de","target":"en"}`; !strings.Contains(string(body), want) {
+		t.Errorf("payload %s, want %s", body, want)
+	}
+
+	status = http.StatusServiceUnavailable
+	pending = PendingSMS{Message: SMSMessage{Index: 2, From: "Operator", Text: "Neues Angebot"}, PartIndices: []int{2}}
+	if got := deliverer.Deliver(context.Background(), pending); got != deliveryDone {
+		t.Fatalf("Deliver() with the service down = %v, want deliveryDone", got)
+	}
+	if last := sink.sent[len(sink.sent)-1]; last.Translation != nil {
+		t.Errorf("Translation = %+v, want none", last.Translation)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Transliteration (TRANSLITERATE): some recipients cannot render the script
+// of an SMS, an old phone behind the relay or a pager-style device. Cyrillic
+// and Greek letters are written in Latin letters, "Привет" as "Privet";
+// everything else is kept. "append" shows the Latin text under the original
+// in the sinks read by people, "replace" changes the text itself, for every
+// sink and the relay.
+const (
+	transliterateAppend  = "append"
+	transliterateReplace = "replace"
+)
+
+// transliterationTable maps lower-case letters to Latin. Cyrillic follows
+// the Russian ICAO passport scheme, with the extra letters of Ukrainian,
+// Belarusian, Serbian and Macedonian; Greek follows ELOT 743.
+var transliterationTable = map[rune]string{
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "ie", 'ы': "y", 'ь': "", 'э': "e", 'ю': "iu", 'я': "ia",
+	'є': "ie", 'і': "i", 'ї': "i", 'ґ': "g", 'ў': "u",
+	'ђ': "dj", 'ј': "j", 'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz",
+	'ѓ': "gj", 'ќ': "kj", 'ѕ': "dz",
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i",
+	'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+	'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+	'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+	'ά': "a", 'έ': "e", 'ή': "i", 'ί': "i", 'ό': "o", 'ύ': "y", 'ώ': "o",
+	'ϊ': "i", 'ϋ': "y", 'ΐ': "i", 'ΰ': "y",
+}
+
+// transliterate writes the Cyrillic and Greek letters of s in Latin
+// letters and reports whether there were any. An upper-case letter that
+// becomes several Latin letters is capitalised ("Щука" → "Shchuka"), or
+// upper-cased in an upper-case word ("ЩУКА" → "SHCHUKA").
+func transliterate(s string) (string, bool) {
+	var sb strings.Builder
+	changed := false
+	for i, r := range s {
+		latin, ok := transliterationTable[unicode.ToLower(r)]
+		if !ok {
+			sb.WriteRune(r)
+			continue
+		}
+		changed = true
+		if !unicode.IsUpper(r) || latin == "" {
+			sb.WriteString(latin)
+			continue
+		}
+		next, _ := utf8.DecodeRuneInString(s[i+utf8.RuneLen(r):])
+		if unicode.IsUpper(next) {
+			sb.WriteString(strings.ToUpper(latin))
+			continue
+		}
+		first, size := utf8.DecodeRuneInString(latin)
+		sb.WriteRune(unicode.ToUpper(first))
+		sb.WriteString(latin[size:])
+	}
+	return sb.String(), changed
+}
+
+// transliterate applies TRANSLITERATE to SMS with Cyrillic or Greek text.
+func (d *Deliverer) transliterate(next SMSHandler) SMSHandler {
+	return func(ctx context.Context, pending PendingSMS) deliveryStatus {
+		if d.cfg.Transliterate == "" || pending.RawFallback {
+			return next(ctx, pending)
+		}
+		latin, changed := transliterate(pending.Message.Text)
+		if !changed {
+			return next(ctx, pending)
+		}
+		slog.DebugContext(ctx, "SMS transliterated", "mode", d.cfg.Transliterate, "text", latin)
+		if d.cfg.Transliterate == transliterateReplace {
+			pending.Message.Text = latin
+		} else {
+			pending.Transliteration = latin
+		}
+		return next(ctx, pending)
+	}
+}
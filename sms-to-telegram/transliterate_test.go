@@ -0,0 +1,69 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTransliterate(t *testing.T) {
+	tests := []struct {
+		in, want string
+		changed  bool
+	}{
+		{"Привет, мир!", "Privet, mir!", true},
+		{"Щука ЩУКА Щ", "Shchuka SHCHUKA Shch", true},
+		{"Ваш код: 4711. Никому не сообщайте", "Vash kod: 4711. Nikomu ne soobshchaite", true},
+		{"Об'єднання Київ", "Ob'iednannia Kiiv", true},
+		{"Подъезд, Объём", "Podieezd, Obieem", true},
+		{"Ђорђе Љубљана", "Djordje Ljubljana", true},
+		{"Καλημέρα Αθήνα", "Kalimera Athina", true},
+		{"Your code is 4711 €", "Your code is 4711 €", false},
+		{"Grüße 😀", "Grüße 😀", false},
+	}
+	for _, tt := range tests {
+		got, changed := transliterate(tt.in)
+		if got != tt.want || changed != tt.changed {
+			t.Errorf("transliterate(%q) = %q, %v; want %q, %v", tt.in, got, changed, tt.want, tt.changed)
+		}
+	}
+}
+
+func TestDeliverer_Transliterate(t *testing.T) {
+	for _, mode := range []string{transliterateAppend, transliterateReplace} {
+		t.Run(mode, func(t *testing.T) {
+			t.Cleanup(swapClock(newFakeClock()))
+			cfg := testConfig()
+			cfg.Transliterate = mode
+			deliverer, sender, _ := newTestDeliverer(cfg)
+			sink := &fakeSink{name: "webhook"}
+			deliverer.AddSink(sink)
+
+			pending := PendingSMS{Message: SMSMessage{Index: 1, From: "MTS", Text: "Баланс <5 руб"}, PartIndices: []int{1}}
+			if got := deliverer.Deliver(context.Background(), pending); got != deliveryDone {
+				t.Fatalf("Deliver() = %v, want deliveryDone", got)
+			}
+			got := sink.sent[0]
+			text := sender.sent[0].Text
+			switch mode {
+			case transliterateAppend:
+				if got.Message.Text != "Баланс <5 руб" || got.Transliteration != "Balans <5 rub" {
+					t.Errorf("text %q, transliteration %q", got.Message.Text, got.Transliteration)
+				}
+				if !strings.Contains(text, "Баланс &lt;5 руб\n\nTransliteration:\nBalans &lt;5 rub") {
+					t.Errorf("Telegram message %q, want the transliteration under the original", text)
+				}
+			case transliterateReplace:
+				if got.Message.Text != "Balans <5 rub" || got.Transliteration != "" {
+					t.Errorf("text %q, transliteration %q", got.Message.Text, got.Transliteration)
+				}
+				if strings.Contains(text, "Баланс") {
+					t.Errorf("Telegram message %q still has the original", text)
+				}
+			}
+		})
+	}
+}
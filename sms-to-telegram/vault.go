@@ -0,0 +1,220 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Minimal HashiCorp Vault client (HTTP API, token auth): secrets are read
+// once at startup from a KV secret, and the token is renewed while running
+// so the next start can still use it.
+
+const (
+	vaultTimeout = 10 * time.Second
+	// vaultMinRenew bounds the renewal interval for very short token TTLs.
+	vaultMinRenew = time.Minute
+)
+
+type VaultClient struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+// NewVaultClient returns nil without VAULT_ADDR. The token comes from
+// VAULT_TOKEN or VAULT_TOKEN_FILE.
+func NewVaultClient() (*VaultClient, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+	if err := validateWebhookURL(addr); err != nil {
+		return nil, fmt.Errorf("invalid VAULT_ADDR: %w", err)
+	}
+	token, err := secretEnv("VAULT_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, fmt.Errorf("VAULT_TOKEN or VAULT_TOKEN_FILE is required with VAULT_ADDR")
+	}
+	return &VaultClient{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		client: &http.Client{Timeout: vaultTimeout},
+	}, nil
+}
+
+// do calls the Vault API and decodes the "data" object of the response.
+// Errors name the path, never the token.
+func (v *VaultClient) do(ctx context.Context, method, path string, out any) error {
+	var body io.Reader
+	if method == http.MethodPost {
+		body = bytes.NewReader([]byte("{}"))
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.addr+"/v1/"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	resp, err := v.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("vault %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		return fmt.Errorf("vault %s: HTTP %d", path, resp.StatusCode)
+	}
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+		Auth json.RawMessage `json:"auth"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&envelope); err != nil {
+		return fmt.Errorf("vault %s: decoding response: %w", path, err)
+	}
+	raw := envelope.Data
+	if len(raw) == 0 || string(raw) == "null" {
+		raw = envelope.Auth
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("vault %s: decoding data: %w", path, err)
+	}
+	return nil
+}
+
+// ReadSecret reads a KV secret at path ("secret/data/sms-to-telegram" for
+// KV v2, "secret/sms-to-telegram" for KV v1) as string values.
+func (v *VaultClient) ReadSecret(ctx context.Context, path string) (map[string]string, error) {
+	var data map[string]json.RawMessage
+	if err := v.do(ctx, http.MethodGet, strings.TrimPrefix(path, "/"), &data); err != nil {
+		return nil, err
+	}
+	// KV v2 nests the values under data.data next to data.metadata.
+	if inner, ok := data["data"]; ok {
+		if _, hasMeta := data["metadata"]; hasMeta {
+			data = nil
+			if err := json.Unmarshal(inner, &data); err != nil {
+				return nil, fmt.Errorf("vault %s: decoding KV v2 data: %w", path, err)
+			}
+		}
+	}
+	out := make(map[string]string, len(data))
+	for k, raw := range data {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("vault %s: value of %s is not a string", path, k)
+		}
+		out[k] = s
+	}
+	return out, nil
+}
+
+// loadVaultSecrets fills secret settings from VAULT_SECRET_PATH before the
+// configuration is parsed. Only secretKeys are taken, and only when neither
+// the variable nor its _FILE variant is set, so local overrides win. The
+// values are set in this process's environment for loadConfig; they are
+// not visible in /proc/<pid>/environ and no child processes are started.
+func loadVaultSecrets(ctx context.Context, vault *VaultClient) ([]string, error) {
+	path := os.Getenv("VAULT_SECRET_PATH")
+	if path == "" {
+		return nil, fmt.Errorf("VAULT_SECRET_PATH is required with VAULT_ADDR")
+	}
+	secrets, err := vault.ReadSecret(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	for key := range secrets {
+		if !slices.Contains(secretKeys, key) {
+			return nil, fmt.Errorf("vault %s: unsupported key %s (allowed: %s)", path, key, strings.Join(secretKeys, ", "))
+		}
+	}
+	var loaded []string
+	for _, key := range secretKeys {
+		value, ok := secrets[key]
+		if !ok || os.Getenv(key) != "" || os.Getenv(key+"_FILE") != "" {
+			continue
+		}
+		os.Setenv(key, value)
+		loaded = append(loaded, key)
+	}
+	return loaded, nil
+}
+
+// startupVault connects to Vault when configured and loads the secrets;
+// a nil client means Vault is not used.
+func startupVault() (*VaultClient, []string, error) {
+	vault, err := NewVaultClient()
+	if err != nil || vault == nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+	defer cancel()
+	keys, err := loadVaultSecrets(ctx, vault)
+	if err != nil {
+		return nil, nil, err
+	}
+	return vault, keys, nil
+}
+
+type vaultTokenInfo struct {
+	TTL       int  `json:"ttl"`
+	Renewable bool `json:"renewable"`
+}
+
+type vaultAuth struct {
+	LeaseDuration int  `json:"lease_duration"`
+	Renewable     bool `json:"renewable"`
+}
+
+// RunRenewal renews the token at half its TTL until ctx ends. Tokens
+// without TTL (root, periodic with no expiry) or not renewable are left
+// alone. Failures are logged and retried; they never stop forwarding.
+func (v *VaultClient) RunRenewal(ctx context.Context) {
+	var info vaultTokenInfo
+	if err := v.do(ctx, http.MethodGet, "auth/token/lookup-self", &info); err != nil {
+		slog.Warn("Vault token lookup failed, not renewing", "error", err)
+		return
+	}
+	if info.TTL <= 0 || !info.Renewable {
+		slog.Info("Vault token needs no renewal", "ttl", info.TTL, "renewable", info.Renewable)
+		return
+	}
+	ttl := time.Duration(info.TTL) * time.Second
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-clk.After(max(ttl/2, vaultMinRenew)):
+		}
+		var auth vaultAuth
+		if err := v.do(ctx, http.MethodPost, "auth/token/renew-self", &auth); err != nil {
+			slog.Warn("Vault token renewal failed", "error", err)
+			continue
+		}
+		ttl = time.Duration(auth.LeaseDuration) * time.Second
+		slog.Debug("Vault token renewed", "ttl", ttl)
+		if !auth.Renewable {
+			slog.Warn("Vault token is no longer renewable", "ttl", ttl)
+			return
+		}
+	}
+}
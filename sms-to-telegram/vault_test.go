@@ -0,0 +1,98 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fakeVault serves KV v1 and v2 secrets and the token endpoints.
+func fakeVault(t *testing.T, renewals *int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.test" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/sms":
+			w.Write([]byte(`{"data":{"data":{"TELEGRAM_BOT_TOKEN":"123:vault","API_TOKEN":"api"},"metadata":{"version":3}}}`))
+		case "/v1/kv/sms":
+			w.Write([]byte(`{"data":{"GOTIFY_TOKEN":"g1"}}`))
+		case "/v1/secret/data/bad":
+			w.Write([]byte(`{"data":{"data":{"SERIAL_PORT":"/dev/ttyUSB9"},"metadata":{}}}`))
+		case "/v1/auth/token/lookup-self":
+			w.Write([]byte(`{"data":{"ttl":3600,"renewable":true}}`))
+		case "/v1/auth/token/renew-self":
+			*renewals++
+			// The second renewal reaches the max TTL and ends the loop.
+			fmt.Fprintf(w, `{"auth":{"lease_duration":3600,"renewable":%t}}`, *renewals < 2)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLoadVaultSecrets(t *testing.T) {
+	clearConfigEnv(t)
+	var renewals int
+	srv := fakeVault(t, &renewals)
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "s.test")
+	t.Setenv("VAULT_TOKEN_FILE", "")
+	t.Setenv("API_TOKEN", "local") // explicit settings win over Vault
+
+	t.Setenv("VAULT_SECRET_PATH", "secret/data/sms")
+	vault, keys, err := startupVault()
+	if err != nil {
+		t.Fatalf("startupVault() error = %v", err)
+	}
+	if strings.Join(keys, ",") != "TELEGRAM_BOT_TOKEN" || os.Getenv("TELEGRAM_BOT_TOKEN") != "123:vault" || os.Getenv("API_TOKEN") != "local" {
+		t.Errorf("loaded %v: token %q, api %q", keys, os.Getenv("TELEGRAM_BOT_TOKEN"), os.Getenv("API_TOKEN"))
+	}
+
+	// KV v1: values directly under data.
+	if secrets, err := vault.ReadSecret(context.Background(), "kv/sms"); err != nil || secrets["GOTIFY_TOKEN"] != "g1" {
+		t.Errorf("ReadSecret(kv v1) = %v, %v", secrets, err)
+	}
+
+	for _, path := range []string{"secret/data/bad", "secret/data/missing"} {
+		t.Setenv("VAULT_SECRET_PATH", path)
+		if _, _, err := startupVault(); err == nil {
+			t.Errorf("VAULT_SECRET_PATH=%s should fail", path)
+		} else if strings.Contains(err.Error(), "s.test") {
+			t.Errorf("error leaks the token: %v", err)
+		}
+	}
+
+	t.Setenv("VAULT_TOKEN", "")
+	if _, _, err := startupVault(); err == nil {
+		t.Error("VAULT_ADDR without a token should fail")
+	}
+	t.Setenv("VAULT_ADDR", "")
+	if vault, _, err := startupVault(); vault != nil || err != nil {
+		t.Errorf("without VAULT_ADDR: %v, %v", vault, err)
+	}
+}
+
+func TestVaultClient_RunRenewal(t *testing.T) {
+	restore := swapClock(newFakeClock())
+	defer restore()
+	var renewals int
+	srv := fakeVault(t, &renewals)
+	vault := &VaultClient{addr: srv.URL, token: "s.test", client: srv.Client()}
+
+	vault.RunRenewal(context.Background()) // returns once the token is no longer renewable
+	if renewals != 2 {
+		t.Errorf("renewals = %d, want 2", renewals)
+	}
+}
@@ -0,0 +1,217 @@
+// Dashboard of the SMS gateway. Everything shown comes from the JSON API of
+// the same server. SMS text is attacker-controlled: it is only ever set as
+// textContent, never parsed as HTML.
+"use strict";
+
+const refreshMs = 10000;
+const tokenKey = "sms-to-telegram-token";
+const svgNS = "http://www.w3.org/2000/svg";
+
+// api calls the HTTP API, asking for a bearer token (API_TOKEN or an OIDC
+// token) on 401 and keeping it for the browser session. Basic auth users
+// (API_USERS) get the browser's own login dialog instead.
+async function api(path, options = {}) {
+  for (let attempt = 0; attempt < 2; attempt++) {
+    const headers = Object.assign({}, options.headers);
+    const token = sessionStorage.getItem(tokenKey);
+    if (token) {
+      headers["Authorization"] = "Bearer " + token;
+    }
+    const resp = await fetch(path, Object.assign({}, options, { headers, cache: "no-store" }));
+    const bearer = (resp.headers.get("WWW-Authenticate") || "").includes("Bearer");
+    if (resp.status === 401 && attempt === 0 && bearer) {
+      const entered = window.prompt("API token");
+      if (!entered) {
+        throw new Error("unauthorized");
+      }
+      sessionStorage.setItem(tokenKey, entered.trim());
+      continue;
+    }
+    const body = await resp.json().catch(() => ({}));
+    if (!resp.ok) {
+      throw new Error(body.error || resp.statusText);
+    }
+    return body;
+  }
+  throw new Error("unauthorized");
+}
+
+function el(tag, text, className) {
+  const node = document.createElement(tag);
+  if (text !== undefined) {
+    node.textContent = text;
+  }
+  if (className) {
+    node.className = className;
+  }
+  return node;
+}
+
+function formatTime(s) {
+  return new Date(s).toLocaleString();
+}
+
+function formatDuration(seconds) {
+  const d = Math.floor(seconds / 86400);
+  const h = Math.floor((seconds % 86400) / 3600);
+  const m = Math.floor((seconds % 3600) / 60);
+  if (d > 0) {
+    return d + "d " + h + "h";
+  }
+  if (h > 0) {
+    return h + "h " + m + "m";
+  }
+  return m + "m";
+}
+
+async function refreshStatus() {
+  const st = await api("/api/v1/status");
+  document.getElementById("host").textContent = st.host;
+  document.getElementById("version").textContent = st.version + (st.commit ? " (" + st.commit + ")" : "");
+  document.getElementById("inbox-section").hidden = !st.inbox;
+  document.getElementById("send-section").hidden = !st.send;
+
+  const rows = [
+    ["Uptime", formatDuration(st.uptime_seconds)],
+    ["Modem", st.modem, st.modem !== "healthy"],
+    ["Ready", st.ready ? "yes" : "no", !st.ready],
+    ["Alerts", st.alerts.length ? st.alerts.join(", ") : "none", st.alerts.length > 0],
+    ["Operator", st.operator || "unknown"],
+    ["Signal", st.signal && st.signal.dbm !== null ? st.signal.dbm + " dBm (CSQ " + st.signal.csq + ")" : "unknown"],
+    ["SIM storage", st.sim_used !== undefined && st.sim_total ? st.sim_used + "/" + st.sim_total + " slots" : "unknown"],
+    ["Last SMS", st.last_sms ? formatTime(st.last_sms) : "none since start"],
+    ["Queues", st.sms_waiting + " SMS on SIM, " + st.parts_waiting + " parts waiting, " + st.outgoing + " outgoing"],
+  ];
+  if (st.webhook_queued !== undefined) {
+    rows.push(["Webhook retries", st.webhook_queued + " queued, " + st.webhook_dead_letters + " dead-lettered",
+      st.webhook_dead_letters > 0]);
+  }
+  for (const [name, result] of Object.entries(st.checks || {})) {
+    rows.push(["Check " + name, result, result !== "ok"]);
+  }
+  const dl = document.getElementById("status");
+  dl.replaceChildren();
+  for (const [label, value, bad] of rows) {
+    dl.append(el("dt", label), el("dd", value, bad ? "bad" : ""));
+  }
+}
+
+async function refreshSignal() {
+  const { samples } = await api("/api/v1/signal");
+  const svg = document.getElementById("signal");
+  svg.replaceChildren();
+  const width = 600;
+  const height = 160;
+  // -113 dBm (CSQ 0) to -51 dBm (CSQ 31).
+  const y = (dbm) => height - ((dbm + 113) / 62) * height;
+  for (const dbm of [-110, -100, -90, -80, -70, -60]) {
+    const line = document.createElementNS(svgNS, "line");
+    line.setAttribute("x1", 0);
+    line.setAttribute("x2", width);
+    line.setAttribute("y1", y(dbm));
+    line.setAttribute("y2", y(dbm));
+    const label = document.createElementNS(svgNS, "text");
+    label.setAttribute("x", 2);
+    label.setAttribute("y", y(dbm) - 2);
+    label.textContent = dbm + " dBm";
+    svg.append(line, label);
+  }
+  const known = samples.filter((s) => s.dbm !== null);
+  const range = document.getElementById("signal-range");
+  if (known.length === 0) {
+    range.textContent = "No signal samples yet.";
+    return;
+  }
+  const t0 = Date.parse(samples[0].time);
+  const span = Math.max(Date.parse(samples[samples.length - 1].time) - t0, 1);
+  const points = known.map((s) => ((Date.parse(s.time) - t0) / span) * width + "," + y(s.dbm));
+  const polyline = document.createElementNS(svgNS, "polyline");
+  polyline.setAttribute("points", points.join(" "));
+  svg.append(polyline);
+  range.textContent = formatTime(samples[0].time) + " – " + formatTime(samples[samples.length - 1].time);
+}
+
+async function refreshLogs() {
+  const { lines } = await api("/api/v1/logs");
+  const pre = document.getElementById("logs");
+  const atBottom = pre.scrollTop + pre.clientHeight >= pre.scrollHeight - 4;
+  pre.textContent = lines.join("\n");
+  if (atBottom) {
+    pre.scrollTop = pre.scrollHeight;
+  }
+}
+
+async function loadMessages() {
+  if (document.getElementById("inbox-section").hidden) {
+    return;
+  }
+  // The last week, newest first.
+  const since = new Date(Date.now() - 7 * 86400 * 1000).toISOString();
+  const params = new URLSearchParams({ since, limit: "1000" });
+  const q = document.getElementById("q").value.trim();
+  if (q) {
+    params.set("q", q);
+  }
+  const resp = await api("/api/v1/messages?" + params);
+  const tbody = document.getElementById("messages");
+  tbody.replaceChildren();
+  for (const m of resp.messages.reverse()) {
+    const tr = el("tr");
+    tr.append(el("td", formatTime(m.sms_time || m.archived_at)), el("td", m.from), el("td", m.outcome), el("td", m.text));
+    tbody.append(tr);
+  }
+  document.getElementById("inbox-note").textContent =
+    resp.messages.length + " SMS of the last 7 days" + (resp.truncated ? " (more not shown)" : "");
+}
+
+async function sendSMS(event) {
+  event.preventDefault();
+  const result = document.getElementById("send-result");
+  const to = document.getElementById("to").value.trim();
+  const text = document.getElementById("text").value;
+  if (!window.confirm("Send this SMS to " + to + "?")) {
+    return;
+  }
+  result.textContent = "Sending…";
+  result.className = "";
+  try {
+    const res = await api("/api/v1/send", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ to, text }),
+    });
+    result.textContent = "Sent (" + res.parts + " part" + (res.parts === 1 ? "" : "s") + ").";
+    document.getElementById("text").value = "";
+  } catch (err) {
+    result.textContent = "Not sent: " + err.message;
+    result.className = "bad";
+  }
+}
+
+function report(err) {
+  document.getElementById("version").textContent = "error: " + err.message;
+}
+
+async function refresh() {
+  try {
+    await refreshStatus();
+    await Promise.all([refreshSignal(), refreshLogs()]);
+  } catch (err) {
+    report(err);
+  }
+}
+
+document.addEventListener("DOMContentLoaded", async () => {
+  document.getElementById("search").addEventListener("submit", (event) => {
+    event.preventDefault();
+    loadMessages().catch(report);
+  });
+  document.getElementById("send").addEventListener("submit", sendSMS);
+  document.getElementById("logout").addEventListener("click", () => {
+    sessionStorage.removeItem(tokenKey);
+    window.location.reload();
+  });
+  await refresh();
+  loadMessages().catch(report);
+  setInterval(refresh, refreshMs);
+});
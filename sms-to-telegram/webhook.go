@@ -0,0 +1,310 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// SMSPayload is the JSON document machine sinks (webhook, MQTT) emit for
+// every received SMS.
+type SMSPayload struct {
+	From string `json:"from"`
+	Text string `json:"text"`
+	// Timestamp is the SMSC timestamp; null when the SCTS was invalid.
+	Timestamp  *time.Time `json:"timestamp"`
+	SMSC       string     `json:"smsc,omitempty"`
+	Parts      int        `json:"parts"`
+	SIMIndices []int      `json:"sim_indices"`
+	RawPDUs    []string   `json:"raw_pdus"`
+	// RawReason is set when the PDU could not be decoded and Text holds the
+	// raw hex instead.
+	RawReason string `json:"raw_reason,omitempty"`
+	// Tags are the RULES_FILE tags of the SMS, Fields the values its
+	// extract actions took from the text.
+	Tags   []string          `json:"tags,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
+	// Transaction is set when a TRANSACTION_TEMPLATES_FILE template matched.
+	Transaction *Transaction `json:"transaction,omitempty"`
+	// Translation is set when TRANSLATE_PROVIDER translated the text.
+	Translation *Translation `json:"translation,omitempty"`
+	// Transliteration is the text in Latin letters (TRANSLITERATE=append).
+	Transliteration string `json:"transliteration,omitempty"`
+	// Instance is set with INSTANCE_NAME or INSTANCE_LABELS.
+	Instance *Instance `json:"instance,omitempty"`
+}
+
+func newSMSPayload(pending PendingSMS) SMSPayload {
+	msg := pending.Message
+	p := SMSPayload{
+		From:       msg.From,
+		Text:       msg.Text,
+		SMSC:       msg.SMSC,
+		Parts:      len(pending.PartIndices),
+		SIMIndices: pending.PartIndices,
+		RawPDUs:    pending.RawPDUs,
+		Tags:       pending.Tags,
+		Fields:     pending.Fields,
+
+		Transaction: pending.Transaction,
+		Translation: pending.Translation,
+
+		Transliteration: pending.Transliteration,
+		Instance:        pending.Instance,
+	}
+	if !msg.Time.IsZero() {
+		t := msg.Time
+		p.Timestamp = &t
+	}
+	if pending.RawFallback {
+		p.RawReason = pending.RawReason
+	}
+	return p
+}
+
+// Webhook payload formats (WEBHOOK_FORMAT).
+const (
+	webhookFormatJSON        = "json"
+	webhookFormatCloudEvents = "cloudevents"
+)
+
+// cloudEventType is the CloudEvents type of every received SMS.
+const cloudEventType = "io.github.kogeler.sms-to-telegram.sms.received"
+
+// cloudEvent is a CloudEvents 1.0 event in structured JSON mode.
+type cloudEvent struct {
+	SpecVersion     string     `json:"specversion"`
+	ID              string     `json:"id"`
+	Source          string     `json:"source"`
+	Type            string     `json:"type"`
+	Subject         string     `json:"subject,omitempty"`
+	Time            time.Time  `json:"time"`
+	DataContentType string     `json:"datacontenttype"`
+	Data            SMSPayload `json:"data"`
+}
+
+// newCloudEvent wraps the SMS payload. The id is the message key, so a
+// retried POST carries the same source+id and consumers can deduplicate it;
+// time is the SMSC timestamp, or now when it was invalid.
+func newCloudEvent(source string, pending PendingSMS) cloudEvent {
+	payload := newSMSPayload(pending)
+	t := clk.Now()
+	if payload.Timestamp != nil {
+		t = *payload.Timestamp
+	}
+	return cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              messageKey(pending),
+		Source:          source,
+		Type:            cloudEventType,
+		Subject:         payload.From,
+		Time:            t,
+		DataContentType: "application/json",
+		Data:            payload,
+	}
+}
+
+// Webhook signature headers (WEBHOOK_SECRET). The signature covers the
+// delivery ID, the timestamp and the body, so a receiver that rejects stale
+// timestamps and remembers recent IDs cannot be fed a replayed request.
+const (
+	webhookIDHeader        = "X-Webhook-Id"
+	webhookTimestampHeader = "X-Signature-Timestamp"
+	webhookSignatureHeader = "X-Signature"
+	// minWebhookSecretLen rejects secrets short enough to guess.
+	minWebhookSecretLen = 16
+)
+
+// signWebhook returns the X-Signature value for a delivery: "sha256=" and the
+// hex HMAC-SHA256 of "<id>.<timestamp>.<body>" under secret.
+func signWebhook(secret []byte, id, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookSink POSTs every SMS as JSON to one URL. 2xx is success; 400, 413,
+// 415 and 422 mean the endpoint refuses this payload for good; anything else
+// (network errors, 5xx, auth/not-found misconfiguration) is retried on the
+// next poll, keeping the SMS on the SIM, or by the WebhookQueue when one is
+// attached.
+type WebhookSink struct {
+	name   string
+	url    string
+	client *http.Client
+	dryRun bool
+	// source is the CloudEvents source; empty sends the plain SMSPayload.
+	source string
+	// template renders the body instead (WEBHOOK_TEMPLATE_FILE); host is
+	// its .Host.
+	template *WebhookTemplate
+	host     string
+	// secret signs every request; nil sends them unsigned.
+	secret []byte
+	// queue takes failed POSTs for retries (WEBHOOK_RETRY_MAX_AGE); nil
+	// leaves them to the Deliverer.
+	queue *WebhookQueue
+}
+
+func NewWebhookSink(name, rawURL string, cfg *Config) *WebhookSink {
+	w := &WebhookSink{
+		name:   name,
+		url:    rawURL,
+		client: &http.Client{Timeout: cfg.WebhookTimeout},
+		dryRun: cfg.DryRun,
+	}
+	if cfg.WebhookSecret != "" {
+		w.secret = []byte(cfg.WebhookSecret)
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "unknown"
+	}
+	if cfg.Instance != nil {
+		hostname = cfg.Instance.Name
+	}
+	switch {
+	case cfg.WebhookTemplate != nil:
+		w.template, w.host = cfg.WebhookTemplate, hostname
+	case cfg.WebhookFormat == webhookFormatCloudEvents:
+		w.source = "urn:sms-to-telegram:" + hostname
+	}
+	return w
+}
+
+func (w *WebhookSink) Name() string { return w.name }
+
+// redactURL keeps only scheme and host: webhook paths and queries often
+// embed secrets.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid url>"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func (w *WebhookSink) Send(ctx context.Context, pending PendingSMS) error {
+	if pending.Webhooks != nil && !slices.Contains(pending.Webhooks, w.name) {
+		slog.DebugContext(ctx, "Webhook not selected by the rules", "sink", w.name)
+		return nil
+	}
+	var body []byte
+	var err error
+	contentType := "application/json"
+	switch {
+	case w.template != nil:
+		body, contentType, err = w.template.Render(newWebhookTemplateData(pending, w.host))
+	case w.source != "":
+		body, err = json.Marshal(newCloudEvent(w.source, pending))
+		contentType = "application/cloudevents+json"
+	default:
+		body, err = json.Marshal(newSMSPayload(pending))
+	}
+	if err != nil {
+		return fmt.Errorf("%w: encoding payload: %v", errSinkRejected, err)
+	}
+	if w.dryRun {
+		slog.InfoContext(ctx, "DRY_RUN: Would POST webhook",
+			"sink", w.name, "endpoint", redactURL(w.url), "bytes", len(body))
+		return nil
+	}
+
+	id := messageKey(pending)
+	if w.queue == nil {
+		return w.post(ctx, id, contentType, body)
+	}
+	// With a retry queue the event is done once it is delivered or stored.
+	if w.queue.waiting(w.name) {
+		return w.queue.enqueue(ctx, w, id, contentType, body, nil)
+	}
+	err = w.post(ctx, id, contentType, body)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, errSinkRejected):
+		return w.queue.deadLetterRejected(ctx, w, id, contentType, body, err)
+	default:
+		return w.queue.enqueue(ctx, w, id, contentType, body, err)
+	}
+}
+
+// post makes one delivery attempt of an encoded event.
+func (w *WebhookSink) post(ctx context.Context, id, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: building request: %v", errSinkRejected, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if w.secret != nil {
+		// The ID is the message key, like the CloudEvents id: a retried
+		// POST of the same SMS is recognisable as a duplicate.
+		timestamp := strconv.FormatInt(clk.Now().Unix(), 10)
+		req.Header.Set(webhookIDHeader, id)
+		req.Header.Set(webhookTimestampHeader, timestamp)
+		req.Header.Set(webhookSignatureHeader, signWebhook(w.secret, id, timestamp, body))
+	}
+
+	status, err := doSinkRequest(w.client, req)
+	if err != nil {
+		return err
+	}
+	switch {
+	case status >= 200 && status < 300:
+		slog.DebugContext(ctx, "Webhook delivered", "sink", w.name, "status", status)
+		return nil
+	case status == http.StatusBadRequest, status == http.StatusRequestEntityTooLarge,
+		status == http.StatusUnsupportedMediaType, status == http.StatusUnprocessableEntity:
+		return fmt.Errorf("%w: POST %s: HTTP %d", errSinkRejected, redactURL(w.url), status)
+	default:
+		return fmt.Errorf("POST %s: HTTP %d", redactURL(w.url), status)
+	}
+}
+
+// doSinkRequest performs an HTTP sink request and returns the status code.
+// The response body is drained and discarded; transport errors name only the
+// redacted endpoint.
+func doSinkRequest(client *http.Client, req *http.Request) (int, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		// *url.Error repeats the full URL; report the redacted endpoint.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, fmt.Errorf("%s %s: %w", req.Method, redactURL(req.URL.String()), err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) // allow connection reuse
+	return resp.StatusCode, nil
+}
+
+// validateWebhookURL accepts absolute http(s) URLs. The error never echoes
+// the URL itself: it may carry a secret.
+func validateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("unparseable URL")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s: must be an absolute http(s) URL", redactURL(rawURL))
+	}
+	return nil
+}
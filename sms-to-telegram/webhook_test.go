@@ -0,0 +1,251 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookSink_Send(t *testing.T) {
+	var got SMSPayload
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("invalid JSON body %s: %v", body, err)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.WebhookTimeout = time.Second
+	sink := NewWebhookSink("webhook1", srv.URL+"/hook?secret=s3cr3t", cfg)
+	smsTime := time.Date(2026, 3, 10, 8, 30, 0, 0, time.UTC)
+	pending := PendingSMS{
+		Message:     SMSMessage{Index: 4, From: "+100", Text: "code 1234", Time: smsTime, SMSC: "+4912"},
+		PartIndices: []int{4, 5},
+		RawPDUs:     []string{"07AA", "07BB"},
+		Tags:        []string{"otp"},
+	}
+	if err := sink.Send(context.Background(), pending); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+	if got.From != "+100" || got.Text != "code 1234" || got.SMSC != "+4912" || got.Parts != 2 ||
+		got.Timestamp == nil || !got.Timestamp.Equal(smsTime) || strings.Join(got.RawPDUs, ",") != "07AA,07BB" ||
+		strings.Join(got.Tags, ",") != "otp" {
+		t.Errorf("payload = %+v, want the SMS fields", got)
+	}
+}
+
+func TestWebhookSink_CloudEvents(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	var got cloudEvent
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.WebhookTimeout = time.Second
+	cfg.WebhookFormat = webhookFormatCloudEvents
+	sink := NewWebhookSink("webhook1", srv.URL, cfg)
+	smsTime := time.Date(2026, 3, 10, 8, 30, 0, 0, time.UTC)
+	pending := PendingSMS{Message: SMSMessage{From: "+100", Text: "code 1234", Time: smsTime}, PartIndices: []int{4}}
+	if err := sink.Send(context.Background(), pending); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if contentType != "application/cloudevents+json" {
+		t.Errorf("Content-Type = %q, want application/cloudevents+json", contentType)
+	}
+	if got.SpecVersion != "1.0" || got.Type != cloudEventType || got.ID != messageKey(pending) ||
+		!strings.HasPrefix(got.Source, "urn:sms-to-telegram:") || got.Subject != "+100" ||
+		!got.Time.Equal(smsTime) || got.DataContentType != "application/json" {
+		t.Errorf("event attributes = %+v", got)
+	}
+	if got.Data.Text != "code 1234" || got.Data.Parts != 1 {
+		t.Errorf("event data = %+v, want the SMS payload", got.Data)
+	}
+
+	// Invalid SCTS: the event time falls back to now.
+	pending.Message.Time = time.Time{}
+	sink.Send(context.Background(), pending)
+	if !got.Time.Equal(clk.Now()) {
+		t.Errorf("time = %v, want now (%v) for an invalid SCTS", got.Time, clk.Now())
+	}
+}
+
+func TestWebhookSink_Signature(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	secret := "0123456789abcdef-secret"
+	var header http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.WebhookTimeout = time.Second
+	cfg.WebhookSecret = secret
+	pending := PendingSMS{Message: SMSMessage{From: "+100", Text: "code 1234"}, PartIndices: []int{4}}
+	if err := NewWebhookSink("webhook1", srv.URL, cfg).Send(context.Background(), pending); err != nil {
+		t.Fatal(err)
+	}
+
+	// What a receiver recomputes: HMAC-SHA256 over "<id>.<timestamp>.<body>".
+	id, timestamp := header.Get(webhookIDHeader), header.Get(webhookTimestampHeader)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id + "." + timestamp + "." + string(body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := header.Get(webhookSignatureHeader); got != want {
+		t.Errorf("X-Signature = %q, want %q", got, want)
+	}
+	if id != messageKey(pending) || timestamp != strconv.FormatInt(clk.Now().Unix(), 10) {
+		t.Errorf("id = %q, timestamp = %q", id, timestamp)
+	}
+
+	// Every part is covered: a replay with a new timestamp or ID, or another
+	// body, does not verify.
+	for name, forged := range map[string]string{
+		"timestamp": signWebhook([]byte(secret), id, timestamp+"0", body),
+		"id":        signWebhook([]byte(secret), id+"x", timestamp, body),
+		"body":      signWebhook([]byte(secret), id, timestamp, append(body, ' ')),
+		"secret":    signWebhook([]byte("another-secret-value"), id, timestamp, body),
+	} {
+		if forged == want {
+			t.Errorf("signature does not cover the %s", name)
+		}
+	}
+
+	// A retry later is signed again with its own timestamp.
+	clock.Advance(time.Minute)
+	NewWebhookSink("webhook1", srv.URL, cfg).Send(context.Background(), pending)
+	if header.Get(webhookTimestampHeader) == timestamp || header.Get(webhookIDHeader) != id {
+		t.Errorf("retry headers = %v", header)
+	}
+
+	// Unsigned without a secret.
+	cfg.WebhookSecret = ""
+	NewWebhookSink("webhook1", srv.URL, cfg).Send(context.Background(), pending)
+	if header.Get(webhookSignatureHeader) != "" || header.Get(webhookTimestampHeader) != "" {
+		t.Errorf("unsigned webhook has signature headers: %v", header)
+	}
+}
+
+func TestWebhookSink_StatusClassification(t *testing.T) {
+	tests := []struct {
+		status       int
+		wantErr      bool
+		wantRejected bool
+	}{
+		{http.StatusOK, false, false},
+		{http.StatusNoContent, false, false},
+		{http.StatusBadRequest, true, true},
+		{http.StatusUnprocessableEntity, true, true},
+		{http.StatusUnauthorized, true, false},
+		{http.StatusNotFound, true, false},
+		{http.StatusTooManyRequests, true, false},
+		{http.StatusBadGateway, true, false},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		cfg := testConfig()
+		cfg.WebhookTimeout = time.Second
+		err := NewWebhookSink("webhook1", srv.URL+"/token-in-path", cfg).Send(context.Background(), PendingSMS{})
+		srv.Close()
+
+		if (err != nil) != tt.wantErr || errors.Is(err, errSinkRejected) != tt.wantRejected {
+			t.Errorf("HTTP %d: Send() error = %v, wantErr %v, wantRejected %v", tt.status, err, tt.wantErr, tt.wantRejected)
+		}
+		if err != nil && strings.Contains(err.Error(), "token-in-path") {
+			t.Errorf("HTTP %d: error %q leaks the URL path", tt.status, err)
+		}
+	}
+}
+
+// TestWebhookSink_TransportErrorRedacted: connection failures are transient
+// and never echo the URL path or query.
+func TestWebhookSink_TransportErrorRedacted(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL + "/hook?key=s3cr3t"
+	srv.Close()
+
+	cfg := testConfig()
+	cfg.WebhookTimeout = time.Second
+	err := NewWebhookSink("webhook1", url, cfg).Send(context.Background(), PendingSMS{})
+	if err == nil || errors.Is(err, errSinkRejected) {
+		t.Fatalf("Send() error = %v, want a transient error", err)
+	}
+	if strings.Contains(err.Error(), "s3cr3t") {
+		t.Errorf("error %q leaks the URL query", err)
+	}
+}
+
+func TestWebhookSink_DryRun(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+	defer srv.Close()
+	cfg := testConfig()
+	cfg.DryRun = true
+	if err := NewWebhookSink("webhook1", srv.URL, cfg).Send(context.Background(), PendingSMS{}); err != nil || called {
+		t.Errorf("DRY_RUN Send() = %v, called = %v; want nil without a request", err, called)
+	}
+}
+
+// A webhook action of RULES_FILE limits the SMS to the named webhooks.
+func TestWebhookSink_RuleSelection(t *testing.T) {
+	posts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { posts++ }))
+	defer srv.Close()
+	cfg := testConfig()
+	cfg.WebhookTimeout = time.Second
+	sink := NewWebhookSink("webhook2", srv.URL, cfg)
+	for _, webhooks := range [][]string{nil, {"webhook2"}, {"webhook1"}, {}} {
+		if err := sink.Send(context.Background(), PendingSMS{Webhooks: webhooks}); err != nil {
+			t.Fatalf("Send() with webhooks %v error = %v", webhooks, err)
+		}
+	}
+	if posts != 2 {
+		t.Errorf("posts = %d, want 2 (all webhooks, then webhook2 alone)", posts)
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	for _, tt := range []struct {
+		url   string
+		valid bool
+	}{
+		{"https://example.com/hook", true},
+		{"http://10.0.0.5:8080/sms", true},
+		{"ftp://example.com/x", false},
+		{"example.com/hook", false},
+		{"https:///path", false},
+	} {
+		if err := validateWebhookURL(tt.url); (err == nil) != tt.valid {
+			t.Errorf("validateWebhookURL(%q) = %v, want valid %v", tt.url, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Webhook retry queue (WEBHOOK_RETRY_MAX_AGE). Without it the SIM is the
+// retry queue and a webhook that is down holds every later SMS on the SIM.
+// With it, a failed POST is kept in STATE_DIR and retried with backoff by
+// its own goroutine, so the SMS can be deleted once the event is stored;
+// an event that cannot be delivered within the maximum age, or that the
+// endpoint refuses, is moved to the dead-letter file instead of being lost.
+
+const (
+	webhookQueueFileName      = "webhook_queue.json"
+	webhookDeadLetterFileName = "webhook_dead_letter.ndjson"
+	// The delay after the first failed attempt, doubling up to the maximum.
+	webhookRetryInitialDelay = 30 * time.Second
+	webhookRetryMaxDelay     = 15 * time.Minute
+	// webhookQueueLimit bounds the events kept per webhook; beyond it new
+	// events are dead-lettered right away.
+	webhookQueueLimit = 1000
+)
+
+// webhookEvent is one webhook POST waiting for a retry: the encoded body
+// as first sent, so every attempt carries the same payload.
+type webhookEvent struct {
+	// ID is the message key (X-Webhook-Id).
+	ID          string `json:"id"`
+	ContentType string `json:"content_type"`
+	Body        string `json:"body"`
+	// Endpoint fingerprints the webhook URL, so a reordered WEBHOOK_URLS
+	// does not send the event to another endpoint after a restart.
+	Endpoint    string    `json:"endpoint"`
+	Queued      time.Time `json:"queued"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// webhookDeadLetter is one line of the dead-letter file.
+type webhookDeadLetter struct {
+	Time time.Time `json:"time"`
+	Sink string    `json:"sink"`
+	// URL is redacted to scheme and host, like in the logs.
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+	webhookEvent
+}
+
+// WebhookQueue keeps the failed POSTs of every webhook sink attached to it,
+// per sink in delivery order: a sink's events are retried oldest first and
+// a new event for a sink with queued ones waits behind them. The queue file
+// and the dead-letter file hold SMS content and are written 0600. Nil-safe.
+type WebhookQueue struct {
+	dir      string
+	maxAge   time.Duration
+	notifier *ErrorNotifier
+	sinks    map[string]*WebhookSink
+
+	mu          sync.Mutex
+	events      map[string][]webhookEvent
+	deadLetters int
+	saved       []byte // last written queue, to skip no-op writes
+	// wake has a token when an event was queued.
+	wake chan struct{}
+}
+
+func NewWebhookQueue(stateDir string, maxAge time.Duration, notifier *ErrorNotifier) *WebhookQueue {
+	return &WebhookQueue{
+		dir:      stateDir,
+		maxAge:   maxAge,
+		notifier: notifier,
+		sinks:    make(map[string]*WebhookSink),
+		events:   make(map[string][]webhookEvent),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Attach makes sink queue its failed POSTs here. Call for every webhook
+// sink before Load.
+func (q *WebhookQueue) Attach(sink *WebhookSink) {
+	if q == nil {
+		return
+	}
+	q.sinks[sink.name] = sink
+	sink.queue = q
+}
+
+// Load restores the events queued before a restart and counts the
+// dead-lettered ones. Events of a webhook that is no longer configured are
+// dead-lettered.
+func (q *WebhookQueue) Load() error {
+	data, err := os.ReadFile(filepath.Join(q.dir, webhookQueueFileName))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("reading webhook queue: %w", err)
+	default:
+		if err := json.Unmarshal(data, &q.events); err != nil {
+			return fmt.Errorf("parsing webhook queue: %w", err)
+		}
+		q.saved = data
+	}
+	dead, err := os.ReadFile(filepath.Join(q.dir, webhookDeadLetterFileName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("reading webhook dead letters: %w", err)
+	}
+	q.deadLetters = bytes.Count(dead, []byte("\n"))
+
+	queued := 0
+	for name, events := range q.events {
+		sink := q.sinks[name]
+		var kept []webhookEvent
+		for _, ev := range events {
+			if sink == nil || ev.Endpoint != contentFingerprint(sink.url) {
+				if err := q.deadLetter(name, "", ev, "webhook no longer configured"); err != nil {
+					return err
+				}
+				continue
+			}
+			kept = append(kept, ev)
+		}
+		q.setEvents(name, kept)
+		queued += len(kept)
+	}
+	if err := q.save(); err != nil {
+		return err
+	}
+	if queued > 0 {
+		slog.Info("Restored webhook retry queue", "events", queued)
+	}
+	return nil
+}
+
+// Stats returns the events waiting for a retry and the dead-lettered ones
+// (since the dead-letter file was last emptied). Nil-safe.
+func (q *WebhookQueue) Stats() (queued, deadLettered int) {
+	if q == nil {
+		return 0, 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, events := range q.events {
+		queued += len(events)
+	}
+	return queued, q.deadLetters
+}
+
+// waiting reports whether sink has queued events, which a new one must
+// wait behind.
+func (q *WebhookQueue) waiting(sink string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.events[sink]) > 0
+}
+
+// enqueue stores the event of a POST that failed with cause (nil: not
+// attempted, queued behind earlier events). An error means it could not be
+// stored and the SMS has to stay on the SIM.
+func (q *WebhookQueue) enqueue(ctx context.Context, sink *WebhookSink, id, contentType string, body []byte, cause error) error {
+	now := clk.Now()
+	ev := webhookEvent{
+		ID:          id,
+		ContentType: contentType,
+		Body:        string(body),
+		Endpoint:    contentFingerprint(sink.url),
+		Queued:      now,
+		NextAttempt: now,
+	}
+	if cause != nil {
+		ev.Attempts = 1
+		ev.NextAttempt = now.Add(webhookRetryDelay(1))
+		ev.LastError = cause.Error()
+	}
+
+	q.mu.Lock()
+	if len(q.events[sink.name]) >= webhookQueueLimit {
+		q.mu.Unlock()
+		slog.ErrorContext(ctx, "Webhook retry queue full, dead-lettering event", "sink", sink.name)
+		if err := q.deadLetter(sink.name, sink.url, ev, "retry queue full"); err != nil {
+			return err
+		}
+		q.alert(ctx, sink.name, 1, "retry queue full")
+		return nil
+	}
+	q.events[sink.name] = append(q.events[sink.name], ev)
+	err := q.save()
+	if err != nil {
+		// Not stored: the Deliverer retries the whole SMS instead.
+		q.events[sink.name] = q.events[sink.name][:len(q.events[sink.name])-1]
+	}
+	q.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	slog.WarnContext(ctx, "Webhook event queued for retry", "sink", sink.name, "error", cause)
+	poke(q.wake)
+	return nil
+}
+
+// Run retries the queued events until ctx ends.
+func (q *WebhookQueue) Run(ctx context.Context) {
+	for {
+		wait := q.retryDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-clk.After(wait):
+		}
+	}
+}
+
+// retryDue attempts the events that are due, per sink oldest first, stops
+// at a sink's first failure, and returns how long until the next event is
+// due.
+func (q *WebhookQueue) retryDue(ctx context.Context) time.Duration {
+	next := webhookRetryMaxDelay
+	for name, sink := range q.sinks {
+		dead, reason := 0, ""
+		for ctx.Err() == nil {
+			q.mu.Lock()
+			events := q.events[name]
+			q.mu.Unlock()
+			if len(events) == 0 {
+				break
+			}
+			// Only this goroutine removes events, so the head stays put
+			// while the POST runs.
+			ev := events[0]
+			now := clk.Now()
+			if now.Sub(ev.Queued) >= q.maxAge {
+				reason = fmt.Sprintf("not delivered within %s (%d attempts): %s", q.maxAge, ev.Attempts, ev.LastError)
+				if !q.pop(name, sink, ev, reason) {
+					break
+				}
+				dead++
+				continue
+			}
+			if wait := ev.NextAttempt.Sub(now); wait > 0 {
+				next = min(next, wait)
+				break
+			}
+
+			err := sink.post(ctx, ev.ID, ev.ContentType, []byte(ev.Body))
+			if err == nil {
+				slog.InfoContext(ctx, "Queued webhook event delivered", "sink", name, "attempts", ev.Attempts+1)
+				q.pop(name, sink, ev, "")
+				continue
+			}
+			if errors.Is(err, errSinkRejected) {
+				reason = err.Error()
+				if !q.pop(name, sink, ev, reason) {
+					break
+				}
+				dead++
+				continue
+			}
+			ev.Attempts++
+			ev.LastError = err.Error()
+			ev.NextAttempt = now.Add(webhookRetryDelay(ev.Attempts))
+			q.mu.Lock()
+			q.events[name][0] = ev
+			if err := q.save(); err != nil {
+				slog.ErrorContext(ctx, "Failed to save webhook retry queue", "error", err)
+			}
+			q.mu.Unlock()
+			slog.WarnContext(ctx, "Webhook retry failed", "sink", name, "attempts", ev.Attempts,
+				"next_attempt", ev.NextAttempt.Format(time.TimeOnly), "error", err)
+			next = min(next, webhookRetryDelay(ev.Attempts))
+			break
+		}
+		if dead > 0 {
+			q.alert(ctx, name, dead, reason)
+		}
+	}
+	return next
+}
+
+// pop removes the head event of sink after delivering it, or dead-letters
+// it when reason is set. An event that cannot be written to the
+// dead-letter file stays queued and pop reports false.
+func (q *WebhookQueue) pop(name string, sink *WebhookSink, ev webhookEvent, reason string) bool {
+	if reason != "" {
+		if err := q.deadLetter(name, sink.url, ev, reason); err != nil {
+			slog.Error("Failed to dead-letter webhook event", "sink", name, "error", err)
+			return false
+		}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.setEvents(name, q.events[name][1:])
+	if err := q.save(); err != nil {
+		slog.Error("Failed to save webhook retry queue", "error", err)
+	}
+	return true
+}
+
+// deadLetter appends ev to the dead-letter file.
+func (q *WebhookQueue) deadLetter(sink, rawURL string, ev webhookEvent, reason string) error {
+	rec := webhookDeadLetter{Time: clk.Now(), Sink: sink, Reason: reason, webhookEvent: ev}
+	if rawURL != "" {
+		rec.URL = redactURL(rawURL)
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(q.dir, webhookDeadLetterFileName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening webhook dead letters: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("writing webhook dead letters: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	q.deadLetters++
+	q.mu.Unlock()
+	slog.Error("Webhook event dead-lettered", "sink", sink, "reason", reason)
+	return nil
+}
+
+// deadLetterRejected stores an event the endpoint refused for good, in
+// place of keeping its SMS on the SIM.
+func (q *WebhookQueue) deadLetterRejected(ctx context.Context, sink *WebhookSink, id, contentType string, body []byte, cause error) error {
+	now := clk.Now()
+	ev := webhookEvent{ID: id, ContentType: contentType, Body: string(body), Endpoint: contentFingerprint(sink.url),
+		Queued: now, NextAttempt: now, Attempts: 1, LastError: cause.Error()}
+	if err := q.deadLetter(sink.name, sink.url, ev, cause.Error()); err != nil {
+		return err
+	}
+	q.alert(ctx, sink.name, 1, cause.Error())
+	return nil
+}
+
+// alert tells the operator that n events of sink were dead-lettered.
+func (q *WebhookQueue) alert(ctx context.Context, sink string, n int, reason string) {
+	msg := fmt.Sprintf("<b>SMS Gateway Alert</b>\n\n"+
+		"<b>Error:</b> %d event(s) of %s moved to the dead-letter file\n"+
+		"<b>Reason:</b> %s\n\n"+
+		"<i>They are kept in %s for manual replay.</i>",
+		n, escapeHTML(sinkDisplayName(sink)), escapeHTML(reason), escapeHTML(webhookDeadLetterFileName))
+	if err := q.notifier.sendToTelegram(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "Failed to send dead-letter alert", "error", err)
+	}
+}
+
+// setEvents replaces the events of sink, dropping the key when none are
+// left. Called with mu held (or before Run).
+func (q *WebhookQueue) setEvents(sink string, events []webhookEvent) {
+	if len(events) == 0 {
+		delete(q.events, sink)
+		return
+	}
+	q.events[sink] = events
+}
+
+// save writes the queue (atomically, 0600). Called with mu held (or before
+// Run).
+func (q *WebhookQueue) save() error {
+	data, err := json.Marshal(q.events)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data, q.saved) {
+		return nil
+	}
+	if err := writeFileAtomic(filepath.Join(q.dir, webhookQueueFileName), data, 0o600); err != nil {
+		return fmt.Errorf("writing webhook queue: %w", err)
+	}
+	q.saved = data
+	return nil
+}
+
+// webhookRetryDelay is the wait after the attempts-th failed attempt.
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := webhookRetryInitialDelay
+	for i := 1; i < attempts && delay < webhookRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, webhookRetryMaxDelay)
+}
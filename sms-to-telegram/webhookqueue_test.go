@@ -0,0 +1,209 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testWebhook is an endpoint answering with a settable status and
+// recording the sender of every SMS it received.
+type testWebhook struct {
+	*httptest.Server
+	mu     sync.Mutex
+	status int
+	got    []string
+}
+
+func newTestWebhook(t *testing.T) *testWebhook {
+	t.Helper()
+	h := &testWebhook{status: http.StatusOK}
+	h.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p SMSPayload
+		json.NewDecoder(r.Body).Decode(&p)
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.got = append(h.got, p.From)
+		w.WriteHeader(h.status)
+	}))
+	t.Cleanup(h.Close)
+	return h
+}
+
+func (h *testWebhook) answer(status int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status = status
+}
+
+func (h *testWebhook) received() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.got...)
+}
+
+// newTestWebhookQueue attaches a webhook sink for url to a queue in dir.
+func newTestWebhookQueue(t *testing.T, dir, url string) (*WebhookQueue, *WebhookSink, *fakeSender) {
+	t.Helper()
+	cfg := testConfig()
+	cfg.WebhookTimeout = time.Second
+	alerts := &fakeSender{}
+	q := NewWebhookQueue(dir, time.Hour, NewErrorNotifier(alerts, []int64{1}, false, "gw", time.Second))
+	sink := NewWebhookSink("webhook1", url, cfg)
+	q.Attach(sink)
+	if err := q.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return q, sink, alerts
+}
+
+func smsFrom(from string) PendingSMS {
+	return PendingSMS{Message: SMSMessage{From: from, Text: "hi"}, PartIndices: []int{len(from)}}
+}
+
+func TestWebhookQueue_Retry(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	hook := newTestWebhook(t)
+	dir := t.TempDir()
+	q, sink, _ := newTestWebhookQueue(t, dir, hook.URL)
+	ctx := context.Background()
+
+	// Down: the first SMS is stored, the second waits behind it unsent.
+	hook.answer(http.StatusServiceUnavailable)
+	for _, from := range []string{"+1", "+2"} {
+		if err := sink.Send(ctx, smsFrom(from)); err != nil {
+			t.Fatalf("Send(%s) = %v, want nil once queued", from, err)
+		}
+	}
+	if queued, dead := q.Stats(); queued != 2 || dead != 0 || len(hook.received()) != 1 {
+		t.Fatalf("stats = %d, %d; requests %q", queued, dead, hook.received())
+	}
+	if info, err := os.Stat(filepath.Join(dir, webhookQueueFileName)); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("queue file: %v, %v", info, err)
+	}
+
+	// Not due yet, then due and failing again: the delay doubles.
+	if wait := q.retryDue(ctx); wait != webhookRetryInitialDelay || len(hook.received()) != 1 {
+		t.Fatalf("wait = %v, requests %q", wait, hook.received())
+	}
+	clock.Advance(webhookRetryInitialDelay)
+	if wait := q.retryDue(ctx); wait != 2*webhookRetryInitialDelay || len(hook.received()) != 2 {
+		t.Fatalf("wait = %v, requests %q", wait, hook.received())
+	}
+
+	// Back up: both go out, in order.
+	hook.answer(http.StatusOK)
+	clock.Advance(2 * webhookRetryInitialDelay)
+	q.retryDue(ctx)
+	if got := strings.Join(hook.received(), ","); got != "+1,+1,+1,+2" {
+		t.Errorf("requests = %s, want +1 three times, then +2", got)
+	}
+	if queued, dead := q.Stats(); queued != 0 || dead != 0 {
+		t.Errorf("stats = %d, %d after recovery", queued, dead)
+	}
+
+	// Nothing queued: delivered directly.
+	sink.Send(ctx, smsFrom("+3"))
+	if queued, _ := q.Stats(); queued != 0 || len(hook.received()) != 5 {
+		t.Errorf("direct delivery queued %d, requests %q", queued, hook.received())
+	}
+}
+
+func TestWebhookQueue_DeadLetter(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	hook := newTestWebhook(t)
+	dir := t.TempDir()
+	q, sink, alerts := newTestWebhookQueue(t, dir, hook.URL+"/hook?key=s3cr3t")
+	ctx := context.Background()
+
+	// Refused for good: dead-lettered at once, the SMS can leave the SIM.
+	hook.answer(http.StatusUnprocessableEntity)
+	if err := sink.Send(ctx, smsFrom("+1")); err != nil {
+		t.Fatalf("Send() = %v, want nil once dead-lettered", err)
+	}
+	// Down past the maximum age.
+	hook.answer(http.StatusBadGateway)
+	sink.Send(ctx, smsFrom("+2"))
+	clock.Advance(time.Hour)
+	q.retryDue(ctx)
+	if queued, dead := q.Stats(); queued != 0 || dead != 2 {
+		t.Fatalf("stats = %d, %d; want 0 queued, 2 dead-lettered", queued, dead)
+	}
+	if len(alerts.sent) != 2 || !strings.Contains(alerts.sent[1].Text, "dead-letter") {
+		t.Errorf("alerts = %+v", alerts.sent)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, webhookDeadLetterFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cr3t") {
+		t.Errorf("dead letters leak the URL: %s", data)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var rec webhookDeadLetter
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	var payload SMSPayload
+	json.Unmarshal([]byte(rec.Body), &payload)
+	if rec.Sink != "webhook1" || rec.URL != redactURL(hook.URL) || rec.Attempts != 1 || payload.From != "+2" ||
+		!strings.Contains(rec.Reason, "HTTP 502") {
+		t.Errorf("dead letter = %+v", rec)
+	}
+
+	// Counted again after a restart, and shown by /status.
+	q, _, _ = newTestWebhookQueue(t, dir, hook.URL+"/hook?key=s3cr3t")
+	notifier := NewErrorNotifier(&fakeSender{}, []int64{1}, false, "gw", time.Second)
+	notifier.metrics = NewMetrics()
+	if body := statusText(StatusSources{Notifier: notifier, Webhooks: q}); !strings.Contains(body, "<b>Webhook retries:</b> 0 queued, 2 dead-lettered") {
+		t.Errorf("status lacks the webhook queue:\n%s", body)
+	}
+}
+
+func TestWebhookQueue_Restart(t *testing.T) {
+	clock := newFakeClock()
+	t.Cleanup(swapClock(clock))
+	hook := newTestWebhook(t)
+	dir := t.TempDir()
+	_, sink, _ := newTestWebhookQueue(t, dir, hook.URL)
+	hook.answer(http.StatusServiceUnavailable)
+	sink.Send(context.Background(), smsFrom("+1"))
+
+	// Same endpoint: the event is retried after the restart.
+	q, _, _ := newTestWebhookQueue(t, dir, hook.URL)
+	if queued, _ := q.Stats(); queued != 1 {
+		t.Fatalf("restored %d events, want 1", queued)
+	}
+	// Another URL in that slot: it must not get the event.
+	q, _, _ = newTestWebhookQueue(t, dir, hook.URL+"/other")
+	if queued, dead := q.Stats(); queued != 0 || dead != 1 {
+		t.Errorf("stats = %d, %d; want the event dead-lettered", queued, dead)
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		5:  8 * time.Minute,
+		6:  webhookRetryMaxDelay,
+		40: webhookRetryMaxDelay,
+	} {
+		if got := webhookRetryDelay(attempts); got != want {
+			t.Errorf("webhookRetryDelay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Webhook body templates (WEBHOOK_TEMPLATE_FILE), so a webhook can post
+// straight into an API such as PagerDuty Events or Opsgenie. With
+// WEBHOOK_FORMAT=json the whole file is a text/template whose output must
+// be a JSON document; with WEBHOOK_FORMAT=form every line is
+// "key=<template>" and the gateway URL-encodes the rendered values.
+
+// webhookFormatForm is the form-encoded WEBHOOK_FORMAT, only valid with a
+// template.
+const webhookFormatForm = "form"
+
+// webhookTemplateData is what a template sees: the webhook payload fields
+// plus the gateway's host name and the message key.
+type webhookTemplateData struct {
+	SMSPayload
+	ID   string
+	Host string
+}
+
+// WebhookTemplate renders webhook bodies.
+type WebhookTemplate struct {
+	// body renders a JSON template; nil for a form template.
+	body *template.Template
+	// fields are the form lines, in file order.
+	fields []webhookFormField
+}
+
+type webhookFormField struct {
+	key   string
+	value *template.Template
+}
+
+// webhookTemplateFuncs are the functions templates may call besides the
+// text/template builtins.
+var webhookTemplateFuncs = template.FuncMap{
+	// json encodes a value as JSON, quotes included: "text": {{json .Text}}.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// truncate shortens s to at most n characters (API field limits).
+	"truncate": func(n int, s string) string {
+		if r := []rune(s); len(r) > n {
+			return string(r[:max(n, 0)])
+		}
+		return s
+	},
+}
+
+// loadWebhookTemplate reads WEBHOOK_TEMPLATE_FILE for format (json or
+// form). Errors name the line, never the content: the file may hold an API
+// key.
+func loadWebhookTemplate(path, format string) (*WebhookTemplate, error) {
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("invalid WEBHOOK_TEMPLATE_FILE %q: must be absolute", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading WEBHOOK_TEMPLATE_FILE: %w", err)
+	}
+	t, err := parseWebhookTemplate(string(data), format)
+	if err != nil {
+		return nil, fmt.Errorf("WEBHOOK_TEMPLATE_FILE %w", err)
+	}
+	return t, nil
+}
+
+// parseWebhookTemplate parses a template and renders it once with a sample
+// SMS, so a template that cannot produce a valid body fails at startup.
+func parseWebhookTemplate(src, format string) (*WebhookTemplate, error) {
+	t := &WebhookTemplate{}
+	if format == webhookFormatForm {
+		for i, line := range strings.Split(src, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, value, ok := strings.Cut(line, "=")
+			if !ok || strings.TrimSpace(key) == "" {
+				return nil, fmt.Errorf("line %d: want key=value", i+1)
+			}
+			tmpl, err := template.New(key).Option("missingkey=error").Funcs(webhookTemplateFuncs).Parse(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			t.fields = append(t.fields, webhookFormField{key: strings.TrimSpace(key), value: tmpl})
+		}
+		if len(t.fields) == 0 {
+			return nil, fmt.Errorf("has no fields")
+		}
+	} else {
+		tmpl, err := template.New("webhook").Option("missingkey=error").Funcs(webhookTemplateFuncs).Parse(src)
+		if err != nil {
+			return nil, err
+		}
+		t.body = tmpl
+	}
+
+	now := clk.Now()
+	sample := webhookTemplateData{
+		SMSPayload: SMSPayload{From: "+491701234567", Text: "Sample \"SMS\"\nline 2", Timestamp: &now, Parts: 1,
+			SIMIndices: []int{1}, RawPDUs: []string{}},
+		ID:   "0123456789ab",
+		Host: "sms-gateway",
+	}
+	if _, _, err := t.Render(sample); err != nil {
+		return nil, fmt.Errorf("renders no valid body for a sample SMS: %w", err)
+	}
+	return t, nil
+}
+
+// Render returns the body and its content type for data.
+func (t *WebhookTemplate) Render(data webhookTemplateData) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if t.body != nil {
+		if err := t.body.Execute(&buf, data); err != nil {
+			return nil, "", err
+		}
+		if !json.Valid(buf.Bytes()) {
+			// Usually text inserted without the json function.
+			return nil, "", fmt.Errorf("output is not valid JSON (insert strings with {{json .Field}})")
+		}
+		return buf.Bytes(), "application/json", nil
+	}
+	form := url.Values{}
+	for _, f := range t.fields {
+		buf.Reset()
+		if err := f.value.Execute(&buf, data); err != nil {
+			return nil, "", err
+		}
+		form.Add(f.key, buf.String())
+	}
+	return []byte(form.Encode()), "application/x-www-form-urlencoded", nil
+}
+
+// newWebhookTemplateData is the template view of pending.
+func newWebhookTemplateData(pending PendingSMS, host string) webhookTemplateData {
+	return webhookTemplateData{SMSPayload: newSMSPayload(pending), ID: messageKey(pending), Host: host}
+}
@@ -0,0 +1,106 @@
+// Copyright © 2025 kogeler
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pagerDutyTemplate is the README's PagerDuty Events v2 example.
+const pagerDutyTemplate = `{
+  "routing_key": "R0UTINGKEY",
+  "event_action": "trigger",
+  "dedup_key": {{json .ID}},
+  "payload": {
+    "summary": {{json (printf "SMS from %s: %s" .From .Text | truncate 1024)}},
+    "source": {{json .Host}},
+    "severity": "info",
+    "timestamp": {{json .Timestamp}}
+  }
+}`
+
+func TestParseWebhookTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		src     string
+		wantErr bool
+	}{
+		{"pagerduty", webhookFormatJSON, pagerDutyTemplate, false},
+		{"text not JSON-encoded", webhookFormatJSON, `{"text": "{{.Text}}"}`, true},
+		{"unknown field", webhookFormatJSON, `{"x": {{json .Body}}}`, true},
+		{"syntax error", webhookFormatJSON, `{"x": {{json .Text}`, true},
+		{"form", webhookFormatForm, "# Opsgenie-style form\nmessage=SMS from {{.From}}\ndescription={{.Text}}\n", false},
+		{"form line without key", webhookFormatForm, "message\n", true},
+		{"form without fields", webhookFormatForm, "# nothing\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseWebhookTemplate(tt.src, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWebhookTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookSink_Template(t *testing.T) {
+	t.Cleanup(swapClock(newFakeClock()))
+	var body, contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body, contentType = string(b), r.Header.Get("Content-Type")
+	}))
+	defer srv.Close()
+	smsTime := time.Date(2026, 3, 10, 8, 30, 0, 0, time.UTC)
+	pending := PendingSMS{
+		Message:     SMSMessage{From: "+100", Text: "code \"1234\"\nbye & " + strings.Repeat("x", 2000), Time: smsTime},
+		PartIndices: []int{4},
+	}
+
+	cfg := testConfig()
+	cfg.WebhookTimeout = time.Second
+	var err error
+	if cfg.WebhookTemplate, err = parseWebhookTemplate(pagerDutyTemplate, webhookFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewWebhookSink("webhook1", srv.URL, cfg).Send(context.Background(), pending); err != nil {
+		t.Fatal(err)
+	}
+	var event struct {
+		DedupKey string `json:"dedup_key"`
+		Payload  struct {
+			Summary   string    `json:"summary"`
+			Timestamp time.Time `json:"timestamp"`
+		}
+	}
+	if err := json.Unmarshal([]byte(body), &event); err != nil || contentType != "application/json" {
+		t.Fatalf("body %s (%s): %v", body, contentType, err)
+	}
+	if event.DedupKey != messageKey(pending) || !event.Payload.Timestamp.Equal(smsTime) ||
+		len([]rune(event.Payload.Summary)) != 1024 || !strings.HasPrefix(event.Payload.Summary, "SMS from +100: code \"1234\"\nbye &") {
+		t.Errorf("event = %+v", event)
+	}
+
+	cfg.WebhookTemplate, err = parseWebhookTemplate("message=SMS from {{.From}}\ndescription={{.Text}}", webhookFormatForm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	NewWebhookSink("webhook1", srv.URL, cfg).Send(context.Background(), pending)
+	form, err := url.ParseQuery(body)
+	if err != nil || contentType != "application/x-www-form-urlencoded" {
+		t.Fatalf("body %s (%s): %v", body, contentType, err)
+	}
+	if form.Get("message") != "SMS from +100" || form.Get("description") != pending.Message.Text {
+		t.Errorf("form = %v", form)
+	}
+}